@@ -0,0 +1,103 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+// AddToAll adds the data to each of the sent Rings, hashing it only once. All
+// Rings must share the same m/k parameters and mode, which is validated before
+// any is modified. Each Ring is locked in turn rather than all at once.
+func AddToAll(data []byte, rings ...*Ring) error {
+	p, err := commonParams(rings)
+	if err != nil || len(rings) == 0 {
+		return err
+	}
+	hash := p.rounds(data)
+	for _, r := range rings {
+		if err := r.addHashed(p, &hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestInAll tests the data against each of the sent Rings, hashing it only
+// once. The result holds the outcome of Test for each Ring in order, and each
+// test is counted as Test counts it. It returns nil if any Ring is nil or the
+// Rings do not share the same m/k parameters and mode.
+func TestInAll(data []byte, rings ...*Ring) []bool {
+	p, err := commonParams(rings)
+	if err != nil || len(rings) == 0 {
+		return nil
+	}
+	var buf [32]uint64
+	hash := p.rounds(data)
+	indices := p.indices(&hash, buf[:0])
+	found := make([]bool, len(rings))
+	for i, r := range rings {
+		found[i] = r.countTest(&hash, r.testIndices(p, indices))
+	}
+	return found
+}
+
+// commonParams returns the parameters shared by all rings, which must not be
+// empty.
+func commonParams(rings []*Ring) (params, error) {
+	var p params
+	for i, r := range rings {
+		if r == nil {
+			return p, ErrNilRing
+		}
+		if r.set.Load() == nil {
+			return p, ErrUninitialized
+		}
+		if i == 0 {
+			p = r.set.Load().params
+		} else if err := p.compatible(r.set.Load().params); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// indices appends the index of the bit array for each of the hash rounds to
+// buf.
+func (p *params) indices(hash *rounds, buf []uint64) []uint64 {
+	for i := uint64(0); i < p.hash; i++ {
+		buf = append(buf, p.index(hash, i))
+	}
+	return buf
+}
+
+// addHashed adds the hash rounds of data, which were derived for p, as Add
+// does: the add is counted, and logged by WithUpdateLog. It fails if the
+// parameters of the ring changed since.
+func (r *Ring) addHashed(p params, hash *rounds) error {
+	r.lock()
+	defer r.unlock()
+	b := r.set.Load()
+	if err := p.compatible(b.params); err != nil {
+		return err
+	}
+	r.addRounds(b, hash)
+	return nil
+}
+
+// testIndices returns if all bits at indices, which were derived for p, are
+// active. It returns false if the parameters of the ring changed since.
+func (r *Ring) testIndices(p params, indices []uint64) bool {
+	if r.offHeap {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+	}
+	b := r.set.Load()
+	if b.params != p || len(indices) > 0 && !b.testSummary(indices[0]) {
+		return false
+	}
+	for _, index := range indices {
+		if !b.get(index) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// newRings returns n rings with identical parameters.
+func newRings(n int) []*ring.Ring {
+	rings := make([]*ring.Ring, n)
+	for i := range rings {
+		rings[i], _ = ring.Init(100000, fpRate)
+	}
+	return rings
+}
+
+func benchmarkAddToAll(b *testing.B, n int) {
+	// keys the length of a typical URL
+	buff := make([]byte, 64)
+	b.Run("Add", func(b *testing.B) {
+		rings := newRings(n)
+		for i := 0; i < b.N; i++ {
+			intToByte(buff, i)
+			for _, r := range rings {
+				r.Add(buff)
+			}
+		}
+	})
+	b.Run("AddToAll", func(b *testing.B) {
+		rings := newRings(n)
+		for i := 0; i < b.N; i++ {
+			intToByte(buff, i)
+			ring.AddToAll(buff, rings...)
+		}
+	})
+}
+
+func BenchmarkAddToAll4(b *testing.B)  { benchmarkAddToAll(b, 4) }
+func BenchmarkAddToAll16(b *testing.B) { benchmarkAddToAll(b, 16) }
+
+func TestAddToAll(t *testing.T) {
+	rings, want := newRings(4), newRings(4)
+	buff := make([]byte, 4)
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		if err := ring.AddToAll(buff, rings...); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range want {
+			r.Add(buff)
+		}
+	}
+	for i := range rings {
+		got, _ := rings[i].MarshalBinary()
+		exp, _ := want[i].MarshalBinary()
+		if !bytes.Equal(got, exp) {
+			t.Fatalf("ring %d differs from individual Adds", i)
+		}
+	}
+}
+
+// TestAddToAllRecorded ensures AddToAll counts and logs each add as Add does.
+func TestAddToAllRecorded(t *testing.T) {
+	a, _ := ring.Init(100000, fpRate, ring.WithUpdateLog(10))
+	b, _ := ring.Init(100000, fpRate, ring.WithUpdateLog(10))
+	a.EnableCounters()
+	b.Add([]byte("other"))
+	if err := ring.AddToAll([]byte("data"), a, b); err != nil {
+		t.Fatal(err)
+	}
+	if adds := a.Metrics().Adds; adds != 1 {
+		t.Fatalf("%d adds counted, expected 1", adds)
+	}
+	updates, _, err := b.Updates(0)
+	if err != nil || len(updates) != 2 {
+		t.Fatalf("%d updates logged, expected 2: %v", len(updates), err)
+	}
+	replica, _ := ring.Init(100000, fpRate)
+	if err := replica.ApplyUpdates(updates); err != nil || !replica.Test([]byte("data")) {
+		t.Fatalf("logged update of AddToAll not applied: %v", err)
+	}
+}
+
+func TestAddToAllMismatch(t *testing.T) {
+	a, _ := ring.Init(100000, fpRate)
+	b, _ := ring.Init(100000, fpRate)
+	c, _ := ring.Init(1000, fpRate)
+	if err := ring.AddToAll([]byte("data"), a, b, c); err == nil {
+		t.Fatal("mismatched parameters not captured")
+	}
+	if a.Test([]byte("data")) || b.Test([]byte("data")) {
+		t.Fatal("ring modified despite mismatched parameters")
+	}
+	if err := ring.AddToAll([]byte("data"), a, nil); err == nil {
+		t.Fatal("nil ring not captured")
+	}
+	if ring.TestInAll([]byte("data"), a, c) != nil {
+		t.Fatal("mismatched parameters not captured")
+	}
+	if err := ring.AddToAll([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTestInAll(t *testing.T) {
+	rings := newRings(3)
+	for i, r := range rings {
+		r.Add([]byte(fmt.Sprint(i)))
+	}
+	for i := range rings {
+		found := ring.TestInAll([]byte(fmt.Sprint(i)), rings...)
+		for j, r := range rings {
+			if found[j] != r.Test([]byte(fmt.Sprint(i))) {
+				t.Fatalf("TestInAll differs from Test for ring %d", j)
+			}
+		}
+		if !found[i] {
+			t.Fatalf("data %d missing", i)
+		}
+	}
+}
+
+// TestTestInAllCounted ensures the tests of TestInAll are counted as those of
+// Test, and sampled by WithGroundTruth.
+func TestTestInAllCounted(t *testing.T) {
+	a, _ := ring.Init(100000, fpRate, ring.WithGroundTruth(1, 100))
+	b, _ := ring.Init(100000, fpRate, ring.WithGroundTruth(1, 100))
+	a.EnableCounters()
+	a.Add([]byte("data"))
+	ring.TestInAll([]byte("data"), a, b)
+	ring.TestInAll([]byte("other"), a, b)
+	if s := a.Stats(); s.Tests != 2 || s.Hits != 1 {
+		t.Fatalf("%d tests and %d hits counted, expected 2 and 1", s.Tests, s.Hits)
+	}
+	if m := b.Metrics(); m.SampledTests != 2 {
+		t.Fatalf("%d tests sampled, expected 2", m.SampledTests)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// bigEndian reports if the host stores the most significant byte of a word
+// first.
+var bigEndian = func() bool {
+	x := uint32(1)
+	return *(*uint8)(unsafe.Pointer(&x)) == 0
+}()
+
+// newBytes returns n zeroed bytes whose capacity is padded to whole 32-bit
+// words, as required by atomicOr.
+func newBytes(n uint64) []uint8 {
+	return make([]uint8, n, (n+3)&^3)
+}
+
+// atomicOr atomically sets the bits of mask in b[i]. There is no atomic byte
+// operation, so the aligned 32-bit word holding the byte is updated instead;
+// the capacity of b must extend to the end of that word.
+func atomicOr(b []uint8, i uint64, mask uint8) {
+	word := (*uint32)(unsafe.Add(unsafe.Pointer(&b[0]), i&^3))
+	shift := (i & 3) * 8
+	if bigEndian {
+		shift = 24 - shift
+	}
+	bits := uint32(mask) << shift
+	for {
+		old := atomic.LoadUint32(word)
+		if old&bits == bits || atomic.CompareAndSwapUint32(word, old, old|bits) {
+			return
+		}
+	}
+}
+
+// atomicLoad atomically loads b[i], which may be concurrently updated with
+// atomicOr.
+func atomicLoad(b []uint8, i uint64) uint8 {
+	word := (*uint32)(unsafe.Add(unsafe.Pointer(&b[0]), i&^3))
+	shift := (i & 3) * 8
+	if bigEndian {
+		shift = 24 - shift
+	}
+	return uint8(atomic.LoadUint32(word) >> shift)
+}
+
+// atomicZero atomically clears n bytes of b from i, both multiples of 4, one
+// aligned 32-bit word at a time.
+func atomicZero(b []uint8, i, n uint64) {
+	for end := i + n; i < end; i += 4 {
+		atomic.StoreUint32((*uint32)(unsafe.Add(unsafe.Pointer(&b[0]), i)), 0)
+	}
+}
+
+// atomicCopy atomically stores src into b from i, a multiple of 4, one aligned
+// 32-bit word at a time. Bytes of the final word beyond src are zeroed, so the
+// capacity of b must extend to the end of that word.
+func atomicCopy(b []uint8, i uint64, src []uint8) {
+	for j := 0; j < len(src); j += 4 {
+		var w [4]uint8
+		copy(w[:], src[j:])
+		word := uint32(w[0]) | uint32(w[1])<<8 | uint32(w[2])<<16 | uint32(w[3])<<24
+		if bigEndian {
+			word = uint32(w[3]) | uint32(w[2])<<8 | uint32(w[1])<<16 | uint32(w[0])<<24
+		}
+		atomic.StoreUint32((*uint32)(unsafe.Add(unsafe.Pointer(&b[0]), i+uint64(j))), word)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAtomicOr(t *testing.T) {
+	// an odd length exercises the padded capacity
+	b := newBytes(7)
+	var wg sync.WaitGroup
+	for bit := uint64(0); bit < 7*8; bit++ {
+		wg.Add(1)
+		go func(bit uint64) {
+			defer wg.Done()
+			atomicOr(b, bit/8, 1<<(bit%8))
+		}(bit)
+	}
+	wg.Wait()
+	for i, v := range b {
+		if v != 0xff {
+			t.Fatalf("byte %d is %#x", i, v)
+		}
+	}
+
+	b = newBytes(5)
+	atomicOr(b, 2, 0x81)
+	for i, v := range b {
+		if (i == 2) != (v == 0x81) || (i != 2 && v != 0) {
+			t.Fatalf("byte %d is %#x", i, v)
+		}
+	}
+}
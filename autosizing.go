@@ -0,0 +1,203 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrMultiplier is returned by NewAutoSizing given an expected multiplier below
+// 1 or beyond the range of elements.
+var ErrMultiplier = errors.New("error: multiplier must be at least 1")
+
+// AutoSizingOption configures the construction of an auto-sizing ring.
+type AutoSizingOption func(*autoSizingOptions)
+
+// autoSizingOptions holds the configuration collected from AutoSizingOptions.
+type autoSizingOptions struct {
+	multiplier float64 // expected total per distinct sampled data, 0 to grow
+	opts       []Option
+}
+
+// WithExpectedMultiplier sizes the ring of an AutoSizing for multiplier times
+// the number of data sampled, once the sample is complete. Without it, the
+// AutoSizing grows as a ScalableRing from twice the sample.
+func WithExpectedMultiplier(multiplier float64) AutoSizingOption {
+	return func(o *autoSizingOptions) {
+		o.multiplier = multiplier
+	}
+}
+
+// WithRingOptions sets the Options of the ring sized by WithExpectedMultiplier.
+func WithRingOptions(opts ...Option) AutoSizingOption {
+	return func(o *autoSizingOptions) {
+		o.opts = append(o.opts, opts...)
+	}
+}
+
+// AutoSizing is a filter for streams of unknown cardinality. It holds the
+// digests of the first sampleSize distinct data exactly, answering Test without
+// false positives, and then sizes a filter for the cardinality estimated from
+// the sample: a Ring for a multiple of the sample given by
+// WithExpectedMultiplier, or otherwise a ScalableRing. The sampled data is
+// added to the filter, and the sample discarded. It is safe for concurrent use,
+// and Test never misses data whose Add has returned, in either phase.
+type AutoSizing struct {
+	falsePositive float64
+	sampleSize    int
+	o             autoSizingOptions
+
+	sized  atomic.Pointer[autoSized] // filter of the second phase, nil while sampling
+	sample map[Digest]struct{}       // digests of the first phase, guarded by mutex
+	mutex  *sync.RWMutex             // mutex for locking the first phase
+}
+
+// autoSized is the filter sized for the estimated cardinality, one of ring or
+// scalable.
+type autoSized struct {
+	ring     *Ring
+	scalable *ScalableRing
+}
+
+// NewAutoSizing initializes and returns a new auto-sizing filter within the
+// falsePositive rate, sampling sampleSize distinct data, or an error.
+func NewAutoSizing(falsePositive float64, sampleSize int, opts ...AutoSizingOption) (*AutoSizing, error) {
+	var o autoSizingOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	_, err := checkArgs(sampleSize, falsePositive)
+	var multiplierErr error
+	if o.multiplier != 0 && !(o.multiplier >= 1 && float64(sampleSize)*o.multiplier < math.MaxInt/scalableGrowth) {
+		multiplierErr = fmt.Errorf("%w, got %g", ErrMultiplier, o.multiplier)
+	}
+	if err := joinErrors(err, multiplierErr); err != nil {
+		return nil, err
+	}
+	a := &AutoSizing{
+		falsePositive: falsePositive,
+		sampleSize:    sampleSize,
+		o:             o,
+		sample:        make(map[Digest]struct{}),
+		mutex:         &sync.RWMutex{},
+	}
+	// the parameters of the filter are checked now, rather than at the end of
+	// the sample
+	ro := options{}
+	for _, opt := range o.opts {
+		opt(&ro)
+	}
+	if err := ro.validate(); err != nil {
+		return nil, err
+	}
+	if _, _, err := optimalParams(uint64(a.elements(sampleSize)), falsePositive, uint64(ro.rounds)); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// elements returns the number of elements of the filter for a sample of n
+// distinct data, or of its first layer.
+func (a *AutoSizing) elements(n int) int {
+	if a.o.multiplier == 0 {
+		return n * scalableGrowth
+	}
+	return int(math.Ceil(float64(n) * a.o.multiplier))
+}
+
+// newSized returns the filter for a sample of n distinct data.
+func (a *AutoSizing) newSized(n int) (*autoSized, error) {
+	if a.o.multiplier == 0 {
+		s, err := InitScalable(a.elements(n), a.falsePositive)
+		return &autoSized{scalable: s}, err
+	}
+	r, err := New(a.elements(n), a.falsePositive, a.o.opts...)
+	return &autoSized{ring: r}, err
+}
+
+// Add adds the data to the filter. Adding the last data of the sample sizes
+// the filter, which holds the write lock while the sample is added to it. It
+// returns an error if the filter cannot be sized or grown.
+func (a *AutoSizing) Add(data []byte) error {
+	d := NewDigest(data)
+	if f := a.sized.Load(); f != nil {
+		return f.add(d)
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if f := a.sized.Load(); f != nil {
+		// sized in the meantime
+		return f.add(d)
+	}
+	a.sample[d] = struct{}{}
+	if len(a.sample) < a.sampleSize {
+		return nil
+	}
+	f, err := a.newSized(len(a.sample))
+	if err != nil {
+		return err
+	}
+	for d := range a.sample {
+		if err := f.add(d); err != nil {
+			return err
+		}
+	}
+	// published only once holding the sample, so Test never misses it
+	a.sized.Store(f)
+	a.sample = nil
+	return nil
+}
+
+// Test returns a bool if the data is in the filter. True indicates that the
+// data may be in the filter, while false indicates that the data is not in the
+// filter. While sampling, the answer is exact, barring a collision of digests.
+func (a *AutoSizing) Test(data []byte) bool {
+	d := NewDigest(data)
+	if f := a.sized.Load(); f != nil {
+		return f.test(d)
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if f := a.sized.Load(); f != nil {
+		return f.test(d)
+	}
+	_, ok := a.sample[d]
+	return ok
+}
+
+// Sized returns if the sample is complete, and the filter sized.
+func (a *AutoSizing) Sized() bool {
+	return a.sized.Load() != nil
+}
+
+// Ring returns the ring sized with WithExpectedMultiplier, or nil while
+// sampling or without WithExpectedMultiplier.
+func (a *AutoSizing) Ring() *Ring {
+	if f := a.sized.Load(); f != nil {
+		return f.ring
+	}
+	return nil
+}
+
+// add adds the data of the digest to the filter.
+func (f *autoSized) add(d Digest) error {
+	if f.ring != nil {
+		f.ring.AddHash(d)
+		return nil
+	}
+	return f.scalable.AddHash(d)
+}
+
+// test tests the data of the digest against the filter.
+func (f *autoSized) test(d Digest) bool {
+	if f.ring != nil {
+		return f.ring.TestHash(d)
+	}
+	return f.scalable.TestHash(d)
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestAutoSizing ensures Test is exact while sampling, and holds every data
+// within the rate once sized, in both modes of sizing.
+func TestAutoSizing(t *testing.T) {
+	for _, c := range []struct {
+		multiplier float64
+		opts       []ring.Option
+	}{{10, nil}, {10, []ring.Option{ring.WithBlocked()}}, {0, nil}} {
+		opts := []ring.AutoSizingOption{ring.WithRingOptions(c.opts...)}
+		if c.multiplier != 0 {
+			opts = append(opts, ring.WithExpectedMultiplier(c.multiplier))
+		}
+		a, err := ring.NewAutoSizing(0.01, 1000, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buff := make([]byte, 4)
+		for i := 0; i < 999; i++ {
+			intToByte(buff, i)
+			a.Add(buff)
+			a.Add(buff)
+		}
+		if a.Sized() {
+			t.Fatal("sized before the end of the sample")
+		}
+		for i := 0; i < 100000; i++ {
+			intToByte(buff, i)
+			if a.Test(buff) != (i < 999) {
+				t.Fatalf("%d: inexact while sampling", i)
+			}
+		}
+		for i := 999; i < 10000; i++ {
+			intToByte(buff, i)
+			if err := a.Add(buff); err != nil {
+				t.Fatal(err)
+			}
+			if !a.Sized() {
+				t.Fatalf("%d: not sized at the end of the sample", i)
+			}
+		}
+		if c.multiplier == 0 && a.Ring() != nil {
+			t.Fatal("ring sized without a multiplier")
+		}
+		if want, _ := ring.New(10000, 0.01, c.opts...); c.multiplier != 0 && a.Ring().Parameters() != want.Parameters() {
+			t.Fatal("ring not sized for the multiple of the sample")
+		}
+		positives := 0
+		for i := 0; i < 110000; i++ {
+			intToByte(buff, i)
+			if i < 10000 && !a.Test(buff) {
+				t.Fatalf("%d missing once sized", i)
+			}
+			if i >= 10000 && a.Test(buff) {
+				positives++
+			}
+		}
+		if rate := float64(positives) / 100000; rate > 0.015 {
+			t.Fatalf("false positive rate %f exceeds 0.01", rate)
+		}
+	}
+}
+
+// TestAutoSizingConcurrent ensures data is never missed across the transition
+// between phases, which the race detector verifies too.
+func TestAutoSizingConcurrent(t *testing.T) {
+	a, _ := ring.NewAutoSizing(0.01, 2000, ring.WithExpectedMultiplier(20))
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			buff := make([]byte, 4)
+			for i := w; i < 40000; i += 8 {
+				intToByte(buff, i)
+				if err := a.Add(buff); err != nil {
+					t.Error(err)
+					return
+				}
+				if !a.Test(buff) {
+					t.Errorf("%d missing after its Add", i)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	buff := make([]byte, 4)
+	for i := 0; i < 40000; i++ {
+		intToByte(buff, i)
+		if !a.Test(buff) {
+			t.Fatalf("%d missing", i)
+		}
+	}
+}
+
+// TestAutoSizingMemory ensures the memory of the sample is returned once the
+// filter is sized.
+func TestAutoSizingMemory(t *testing.T) {
+	heap := func() int64 {
+		var m runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&m)
+		return int64(m.HeapAlloc)
+	}
+	const sample = 200000
+	before := heap()
+	a, _ := ring.NewAutoSizing(0.01, sample, ring.WithExpectedMultiplier(2))
+	buff := make([]byte, 4)
+	for i := 0; i < sample-1; i++ {
+		intToByte(buff, i)
+		a.Add(buff)
+	}
+	sampling := heap() - before
+	a.Add([]byte("last"))
+	sized := heap() - before
+	if !a.Sized() || sized*4 > sampling {
+		t.Fatalf("%d bytes while sampling, %d bytes once sized", sampling, sized)
+	}
+	runtime.KeepAlive(a)
+}
+
+// TestAutoSizingErrors ensures invalid arguments are rejected together.
+func TestAutoSizingErrors(t *testing.T) {
+	_, err := ring.NewAutoSizing(2, 0, ring.WithExpectedMultiplier(0.5))
+	for _, want := range []error{ring.ErrFalsePositive, ring.ErrElements, ring.ErrMultiplier} {
+		if !errors.Is(err, want) {
+			t.Errorf("%v does not match %v", err, want)
+		}
+	}
+	_, err = ring.NewAutoSizing(0.01, 10, ring.WithExpectedMultiplier(2), ring.WithRingOptions(ring.WithBlocked(), ring.WithOneHash()))
+	if !errors.Is(err, ring.ErrOptions) {
+		t.Errorf("expected ErrOptions, got %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "sync/atomic"
+
+const (
+	// summaryBlock is the number of bits in the main bit array covered by a
+	// single bit of the summary. 512 bits is a typical cache line, so a set
+	// summary bit costs at most one extra line fetch.
+	summaryBlock = 512
+
+	// chunkShift is log2 of the number of bytes in a chunk of the main bit
+	// array (64MB). Chunks are allocated on first write, so very large rings
+	// never need a single huge contiguous allocation, and untouched regions
+	// consume no memory.
+	chunkShift = 26
+	chunkBytes = 1 << chunkShift
+	chunkMask  = chunkBytes - 1
+)
+
+// params are the parameters of a ring, which determine the bits of the data
+// added to it. Constructors and UnmarshalBinary methods reject zero bits and
+// hash rounds, so reduce never divides by zero.
+type params struct {
+	size  uint64 // number of bits, never 0 (bit array is size/8+1)
+	hash  uint64 // number of hash rounds
+	mask  uint64 // range of reduce minus 1 in power of two mode, otherwise 0
+	part  uint64 // bits per hash round in partitioned mode, otherwise 0
+	seed  uint64 // seed of the hash rounds, 0 if unseeded
+	flags uint8  // construction mode flags
+}
+
+// reduce maps a hash round onto an index of the bit array, of a partition in
+// partitioned mode, or of a block in blocked mode, using a single AND in power
+// of two mode.
+func (p *params) reduce(round uint64) uint64 {
+	if p.mask != 0 {
+		return round & p.mask
+	}
+	if p.part != 0 {
+		return round % p.part
+	}
+	if p.flags&flagBlocked != 0 {
+		return round % (p.size / summaryBlock)
+	}
+	return round % p.size
+}
+
+// index returns the index of the bit array for the i-th hash round. In
+// partitioned mode each round selects a bit within its own partition, and in
+// blocked mode within the block selected by round 0. A bit within a block
+// needs only 9 bits of a round, so each further round is split into 7 fields
+// selecting a bit each, which are far less correlated than the fields of
+// successive rounds.
+func (p *params) index(hash *rounds, i uint64) uint64 {
+	if p.part != 0 {
+		return i*p.part + p.reduce(hash.at(i))
+	}
+	if p.flags&flagBlocked != 0 {
+		return p.reduce(hash.at(0))*summaryBlock + hash.at(1+i/7)>>(9*(i%7))%summaryBlock
+	}
+	return p.reduce(hash.at(i))
+}
+
+// rounds returns the rounds of hashing for data, from a single hash in one hash
+// mode.
+func (p *params) rounds(data []byte) rounds {
+	if p.flags&flagOneHash != 0 {
+		return oneHashRounds(data, p.seed)
+	}
+	return hashRounds(data, p.seed)
+}
+
+// bitset is the main bit array of a ring together with its summary and the
+// parameters it was built for. A bitset is the unit published to lock-free
+// readers: once published its parameters and chunk table never change, while
+// bits within its chunks and summary are only ever set, with atomic
+// operations. Clearing a ring or allocating a chunk publishes a new bitset.
+type bitset struct {
+	params
+	chunks  [][]uint8 // main bit array, nil chunks are entirely unset
+	mapped  []bool    // chunks allocated off the Go heap
+	offHeap bool      // allocate chunks off the Go heap where supported
+	length  uint64    // number of bytes in the main bit array
+	summary []uint8   // one bit per 512-bit block of bits, set if any is set
+
+	stamps []uint32       // epoch of the last write per block, with WithFastReset
+	epoch  *atomic.Uint32 // current epoch, shared by copies of the bitset
+}
+
+// newBitset returns an empty bitset for a ring with the parameters p. No
+// chunks are allocated until written.
+func newBitset(p params, offHeap bool) *bitset {
+	length := p.size/8 + 1
+	chunks := (length + chunkMask) >> chunkShift
+	return &bitset{
+		params:  p,
+		chunks:  make([][]uint8, chunks),
+		mapped:  make([]bool, chunks),
+		offHeap: offHeap,
+		length:  length,
+		summary: newBytes(summarySize(p.size)),
+	}
+}
+
+// chunkLen returns the number of bytes in the i-th chunk.
+func (b *bitset) chunkLen(i int) uint64 {
+	if rest := b.length - uint64(i)<<chunkShift; rest < chunkBytes {
+		return rest
+	}
+	return chunkBytes
+}
+
+// get returns if the bit at index is active. It is safe to call concurrently
+// with set.
+func (b *bitset) get(index uint64) bool {
+	c := b.chunks[index>>(chunkShift+3)]
+	if c == nil || b.stamps != nil && !b.fresh(index/summaryBlock) {
+		return false
+	}
+	return atomicLoad(c, (index/8)&chunkMask)&(1<<(index%8)) != 0
+}
+
+// withChunk returns a copy of b with the chunk holding index allocated, if it
+// is not already. The copy shares all other chunks and the summary with b, so
+// b must not be used by writers afterwards.
+func (b *bitset) withChunk(index uint64) *bitset {
+	i := index >> (chunkShift + 3)
+	if b.chunks[i] != nil {
+		return b
+	}
+	n := *b
+	n.chunks = append([][]uint8(nil), b.chunks...)
+	n.mapped = append([]bool(nil), b.mapped...)
+	n.chunks[i] = n.newChunk(int(i))
+	return &n
+}
+
+// single returns the main bit array if it is held in a single allocated chunk,
+// sliced to its exact length so indexing needs no chunk lookup. It returns nil
+// otherwise.
+func (b *bitset) single() []uint8 {
+	if len(b.chunks) != 1 || b.chunks[0] == nil {
+		return nil
+	}
+	return b.chunks[0][:b.length]
+}
+
+// set activates the bit at index and its summary bit. The chunk holding it is
+// allocated in place if necessary, which is only allowed before b is
+// published; published bitsets must be replaced using withChunk first.
+func (b *bitset) set(index uint64) {
+	i := index >> (chunkShift + 3)
+	c := b.chunks[i]
+	if c == nil {
+		c = b.newChunk(int(i))
+		b.chunks[i] = c
+	}
+	if b.stamps != nil {
+		b.touch(index / summaryBlock)
+	}
+	atomicOr(c, (index/8)&chunkMask, 1<<(index%8))
+	block := index / summaryBlock
+	atomicOr(b.summary, block/8, 1<<(block%8))
+}
+
+// copyTo copies the logical main bit array into out, which must be length
+// bytes long. Unallocated chunks are skipped, so out should be zeroed.
+func (b *bitset) copyTo(out []byte) {
+	for i, c := range b.chunks {
+		start := uint64(i) << chunkShift
+		copy(out[start:], c)
+		if c != nil {
+			b.clearStale(out[start:start+uint64(len(c))], start)
+		}
+	}
+}
+
+// copyFrom copies data into the main bit array, allocating only the chunks
+// holding an active bit. The summary must be rebuilt afterwards.
+func (b *bitset) copyFrom(data []byte) {
+	for i := range b.chunks {
+		start := uint64(i) << chunkShift
+		if start >= uint64(len(data)) {
+			break
+		}
+		end := start + b.chunkLen(i)
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		if isZero(data[start:end]) {
+			continue
+		}
+		c := b.newChunk(i)
+		copy(c, data[start:end])
+		b.chunks[i] = c
+	}
+}
+
+// isZero returns if every byte of data is 0.
+func isZero(data []byte) bool {
+	for _, v := range data {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// allocated returns the number of bytes held by allocated chunks.
+func (b *bitset) allocated() uint64 {
+	var n uint64
+	for _, c := range b.chunks {
+		n += uint64(len(c))
+	}
+	return n
+}
+
+// summarySize returns the number of bytes needed to summarize a ring with size
+// bits.
+func summarySize(size uint64) uint64 {
+	return size/summaryBlock/8 + 1
+}
+
+// testSummary returns false if the block holding index has no active bits, in
+// which case the index is guaranteed to be inactive. A single probe of the
+// summary can therefore reject most misses while the ring is sparsely
+// populated.
+func (b *bitset) testSummary(index uint64) bool {
+	block := index / summaryBlock
+	if b.stamps != nil {
+		return b.fresh(block)
+	}
+	return atomicLoad(b.summary, block/8)&(1<<(block%8)) != 0
+}
+
+// rebuildSummary recomputes the summary from the main bit array. It must be
+// called whenever bits are replaced wholesale.
+func (b *bitset) rebuildSummary() {
+	b.summary = buildSummary(b, b.size)
+}
+
+// buildSummary returns a new summary of the main bit array of b, one bit per
+// 64-byte block. Chunks hold a whole number of blocks.
+func buildSummary(b *bitset, size uint64) []uint8 {
+	summary := newBytes(summarySize(size))
+	for i, c := range b.chunks {
+		first := uint64(i) << chunkShift * 8 / summaryBlock
+		for start := uint64(0); start < uint64(len(c)); start += summaryBlock / 8 {
+			end := start + summaryBlock/8
+			if end > uint64(len(c)) {
+				end = uint64(len(c))
+			}
+			if !isZero(c[start:end]) {
+				block := first + start*8/summaryBlock
+				summary[block/8] |= 1 << (block % 8)
+			}
+		}
+	}
+	return summary
+}
@@ -0,0 +1,381 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// testNoSummary tests the data against the main bit array only.
+func testNoSummary(r *Ring, data []byte) bool {
+	hash := generateMultiHash(data)
+	b := r.set.Load()
+	for i := uint64(0); i < r.hash; i++ {
+		index := getRound(hash, i) % r.size
+		if !b.get(index) {
+			return false
+		}
+	}
+	return true
+}
+
+// summaryCoherent reports if the summary matches a fresh rebuild, without
+// modifying the ring.
+func summaryCoherent(r *Ring) bool {
+	b := r.set.Load()
+	return bytes.Equal(b.summary, buildSummary(b, r.size))
+}
+
+func TestSummaryIdentical(t *testing.T) {
+	r, _ := Init(10000, 0.01)
+	buff := make([]byte, 4)
+	for i := 0; i < 5000; i++ {
+		rand.Read(buff)
+		r.Add(buff)
+	}
+	for i := 0; i < 100000; i++ {
+		rand.Read(buff)
+		if r.Test(buff) != testNoSummary(r, buff) {
+			t.Fatalf("summary changed result for %x", buff)
+		}
+	}
+}
+
+func TestSummaryDesync(t *testing.T) {
+	r, _ := Init(1000, 0.01)
+	data := []byte("hello")
+	r.Add(data)
+
+	// a cleared summary rejects everything
+	b := r.set.Load()
+	for i := range b.summary {
+		b.summary[i] = 0
+	}
+	if summaryCoherent(r) {
+		t.Fatal("cleared summary reported as coherent")
+	}
+	if r.Test(data) {
+		t.Fatal("cleared summary was not consulted")
+	}
+	b.rebuildSummary()
+	if !summaryCoherent(r) || !r.Test(data) {
+		t.Fatal("rebuilt summary rejects added data")
+	}
+
+	// a saturated summary is always safe
+	for i := range b.summary {
+		b.summary[i] = 0xff
+	}
+	if !r.Test(data) || r.Test([]byte("world")) != testNoSummary(r, []byte("world")) {
+		t.Fatal("saturated summary changed result")
+	}
+	if summaryCoherent(r) {
+		t.Fatal("saturated summary reported as coherent")
+	}
+}
+
+func TestSummaryCoherent(t *testing.T) {
+	r, _ := Init(10000, 0.01)
+	r2, _ := Init(10000, 0.01)
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		rand.Read(buff)
+		r.Add(buff)
+		rand.Read(buff)
+		r2.Add(buff)
+	}
+	if !summaryCoherent(r) {
+		t.Fatal("summary incoherent after Add")
+	}
+	if err := r.Merge(r2); err != nil {
+		t.Fatal(err)
+	}
+	if !summaryCoherent(r) {
+		t.Fatal("summary incoherent after Merge")
+	}
+
+	out, _ := r.MarshalBinary()
+	// unmarshal into a ring with a stale summary
+	r3, _ := Init(10000, 0.01)
+	b := r3.set.Load()
+	for i := range b.summary {
+		b.summary[i] = 0xff
+	}
+	if err := r3.UnmarshalBinary(out); err != nil {
+		t.Fatal(err)
+	}
+	if !summaryCoherent(r3) {
+		t.Fatal("summary incoherent after UnmarshalBinary")
+	}
+
+	r.Reset()
+	for _, s := range r.set.Load().summary {
+		if s != 0 {
+			t.Fatal("summary not cleared on Reset")
+		}
+	}
+}
+
+// BenchmarkTestMissSparse tests absent elements in a sparsely populated Ring,
+// where the summary rejects most misses with a single probe.
+func BenchmarkTestMissSparse(b *testing.B) {
+	r, _ := Init(1000000, 0.001)
+	buff := make([]byte, 8)
+	for i := uint64(0); i < 10000; i++ {
+		binary.LittleEndian.PutUint64(buff, i)
+		r.Add(buff)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		binary.LittleEndian.PutUint64(buff, uint64(i)+1<<32)
+		r.Test(buff)
+	}
+}
+
+// newSizedRing returns a ring with an explicit size and number of hash rounds.
+func newSizedRing(size, hash uint64) *Ring {
+	r := &Ring{params: params{size: size, hash: hash}, mutex: &sync.RWMutex{}}
+	r.set.Store(newBitset(r.params, false))
+	return r
+}
+
+func TestChunkBoundary(t *testing.T) {
+	r := newSizedRing(2*chunkBytes*8+1000, 3)
+	b := r.set.Load()
+	if len(b.chunks) != 3 || b.chunkLen(2) != 126 {
+		t.Fatalf("unexpected chunk layout: %d chunks, last %d bytes", len(b.chunks), b.chunkLen(2))
+	}
+	if b.allocated() != 0 {
+		t.Fatal("chunks allocated before any write")
+	}
+
+	for _, index := range []uint64{chunkBytes*8 - 1, chunkBytes * 8} {
+		b.set(index)
+		if !b.get(index) || b.get(index-2) || b.get(index+2) {
+			t.Fatalf("unexpected bits around %d", index)
+		}
+	}
+	if b.allocated() != 2*chunkBytes || b.chunks[2] != nil {
+		t.Fatalf("unexpected allocation: %d bytes", b.allocated())
+	}
+	if !summaryCoherent(r) {
+		t.Fatal("summary incoherent across chunk boundary")
+	}
+
+	// unmarshaling skips chunks without active bits
+	out, _ := r.MarshalBinary()
+	r2 := new(Ring)
+	if err := r2.UnmarshalBinary(out); err != nil {
+		t.Fatal(err)
+	}
+	if r2.set.Load().allocated() != 2*chunkBytes {
+		t.Fatal("unmarshal allocated untouched chunks")
+	}
+	out[len(out)-1] = 1
+	if err := r2.UnmarshalBinary(out); err != nil {
+		t.Fatal(err)
+	}
+	b2 := r2.set.Load()
+	if b2.allocated() != 2*chunkBytes+126 || !b2.get(2*chunkBytes*8+1000) {
+		t.Fatal("unmarshal lost the last chunk")
+	}
+}
+
+func TestChunkMembership(t *testing.T) {
+	// spans two chunks
+	r := newSizedRing(chunkBytes*8+chunkBytes, 7)
+	r2 := newSizedRing(chunkBytes*8+chunkBytes, 7)
+	elems := make([][]byte, 10000)
+	for i := range elems {
+		elems[i] = make([]byte, 16)
+		rand.Read(elems[i])
+		if i%2 == 0 {
+			r.Add(elems[i])
+		} else {
+			r2.Add(elems[i])
+		}
+	}
+	if len(r.set.Load().chunks) != 2 || r.set.Load().chunks[1] == nil {
+		t.Fatal("elements did not span both chunks")
+	}
+	if err := r.Merge(r2); err != nil {
+		t.Fatal(err)
+	}
+	for _, el := range elems {
+		if !r.Test(el) {
+			t.Fatal("element missing across chunks")
+		}
+	}
+}
+
+func TestChunkUntouchedMemory(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	// 1GB of bits
+	r := newSizedRing(1<<33, 7)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	// only the 2MB summary and chunk table are allocated
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > 8<<20 {
+		t.Fatalf("untouched chunks consumed %d bytes", grown)
+	}
+	r.Add([]byte("hello"))
+	if n := r.set.Load().allocated(); n == 0 || n > 7*chunkBytes {
+		t.Fatalf("unexpected allocation after Add: %d bytes", n)
+	}
+	runtime.KeepAlive(r)
+}
+
+// benchmarkHotPath measures Add and Test on a ring with k hash rounds for
+// several key sizes.
+func benchmarkHotPath(b *testing.B, k uint64) {
+	for _, keySize := range []int{8, 64, 1024} {
+		r := newSizedRing(1<<24, k)
+		key := make([]byte, keySize)
+		b.Run(fmt.Sprintf("Add/key=%d", keySize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				binary.LittleEndian.PutUint64(key, uint64(i))
+				r.Add(key)
+			}
+		})
+		b.Run(fmt.Sprintf("Test/key=%d", keySize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				binary.LittleEndian.PutUint64(key, uint64(i))
+				r.Test(key)
+			}
+		})
+	}
+}
+
+func BenchmarkHotPathK4(b *testing.B) {
+	benchmarkHotPath(b, 4)
+}
+
+func BenchmarkHotPathK7(b *testing.B) {
+	benchmarkHotPath(b, 7)
+}
+
+// TestLockFreeReaders races lock-free Test calls against Adds publishing new
+// chunks, Merges and Resets; run with -race to check the synchronization.
+func TestLockFreeReaders(t *testing.T) {
+	// the second chunk holds only 1KB
+	size := uint64(chunkBytes*8 + 8192)
+	r := newSizedRing(size, 3)
+	m := newSizedRing(size, 3)
+	buff := make([]byte, 8)
+	for i := uint64(0); i < 1000; i++ {
+		binary.LittleEndian.PutUint64(buff, i)
+		m.Add(buff)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < runtime.GOMAXPROCS(0)+1; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buff := make([]byte, 8)
+			for j := uint64(0); ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				binary.LittleEndian.PutUint64(buff, j%2000)
+				r.Test(buff)
+			}
+		}()
+	}
+	for round := 0; round < 20; round++ {
+		for i := uint64(1000); i < 2000; i++ {
+			binary.LittleEndian.PutUint64(buff, i)
+			r.Add(buff)
+		}
+		if err := r.Merge(m); err != nil {
+			t.Fatal(err)
+		}
+		for i := uint64(0); i < 2000; i++ {
+			binary.LittleEndian.PutUint64(buff, i)
+			if !r.Test(buff) {
+				t.Fatalf("data %d missing after Add and Merge", i)
+			}
+		}
+		r.Reset()
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestPartitionedIndex ensures each hash round selects a bit within its own
+// partition.
+func TestPartitionedIndex(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithPartitioned()},
+		{WithPartitioned(), WithPowerOfTwoSize()},
+	} {
+		r, _ := Init(1000, 0.01, opts...)
+		buff := make([]byte, 8)
+		for i := uint64(0); i < 1000; i++ {
+			binary.LittleEndian.PutUint64(buff, i)
+			hash := hashRounds(buff, 0)
+			for round := uint64(0); round < r.hash; round++ {
+				if index := r.index(&hash, round); index/r.part != round {
+					t.Fatalf("round %d selected index %d outside its partition", round, index)
+				}
+			}
+		}
+	}
+}
+
+// TestMaxLength lowers the largest bit array to that of a 32-bit platform,
+// ensuring rings are rejected exactly beyond it, before any allocation, and
+// whichever Options round their size up.
+func TestMaxLength(t *testing.T) {
+	defer func(old uint64) { maxLength = old }(maxLength)
+	maxLength = math.MaxInt32 - 18
+
+	// sized directly, so the boundary is exact
+	if _, err := newParams((maxLength-1)*8+7, 3, 0); err != nil {
+		t.Fatalf("largest ring rejected: %v", err)
+	}
+	if _, err := newParams((maxLength-1)*8+8, 3, 0); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("ring beyond the limit not captured: %v", err)
+	}
+
+	// about 1.9GB of bits fits, but not once rounded to a power of two
+	elements := int(float64(maxLength-1) * 8 / 1.1 * math.Pow(math.Log(2), 2) / -math.Log(0.001))
+	r, err := Init(elements, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.set.Load().allocated() != 0 {
+		t.Fatal("chunks allocated by Init")
+	}
+	if _, err := Init(elements, 0.001, WithPowerOfTwoSize()); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("rounded ring beyond the limit not captured: %v", err)
+	}
+	if _, err := Init(elements+elements/4, 0.001); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("ring beyond the limit not captured: %v", err)
+	}
+	if _, err := Init(elements, 0.001, WithOneHash()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Init(elements+elements/4, 0.001, WithOneHash()); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("one hash ring beyond the limit not captured: %v", err)
+	}
+	// counters are allocated by InitCounting, so only the failure is tested
+	if _, err := InitCounting(elements/4, 0.001); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("counting ring beyond the limit not captured: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// bloomierVersion is the marshaled version of a bloomier map.
+const bloomierVersion = 21
+
+var (
+	// ErrBitsPerValue is returned by BuildMap given bitsPerValue that are
+	// not between 1 and 8.
+	ErrBitsPerValue = errors.New("error: bitsPerValue must be between 1 and 8")
+	// ErrValueTooLarge is returned by BuildMap given a value that does
+	// not fit in bitsPerValue.
+	ErrValueTooLarge = errors.New("error: value exceeds bitsPerValue")
+	// ErrValues is returned by BuildMap given different numbers of keys
+	// and values.
+	ErrValues = errors.New("error: keys and values must have the same length")
+	// ErrConflict is returned by BuildMap given a key more than once with
+	// different values.
+	ErrConflict = errors.New("error: key given with conflicting values")
+)
+
+// BloomierMap is a static map from keys to small values, in the manner of a
+// Bloomier filter, built once from a fixed set of keys. Each key is placed
+// like a key of a Xor filter, but its three slots xor to a 16-bit word holding
+// both its value and a fingerprint, so keys outside the set are reported as
+// unknown unless their fingerprint matches by chance. With bitsPerValue value
+// bits, that false mapping rate is 2^-(16-bitsPerValue), for example 1/4096
+// with 4-bit values, at about 2.5 bytes per key. It is safe for concurrent use.
+type BloomierMap struct {
+	xorTable
+	value uint     // bits per value
+	words []uint16 // 3 blocks of fingerprints and values
+}
+
+// BuildMap builds a map from each of keys to the value at the same index, or
+// returns an error. Values must fit in bitsPerValue (1-8) bits. A key given
+// more than once must always have the same value. Construction may fail for a
+// given seed and is retried with new seeds, as for BuildXor.
+func BuildMap(keys [][]byte, values []uint8, bitsPerValue int) (*BloomierMap, error) {
+	if bitsPerValue < 1 || bitsPerValue > 8 {
+		return nil, ErrBitsPerValue
+	}
+	if len(keys) != len(values) {
+		return nil, ErrValues
+	}
+	type entry struct {
+		hash  uint64
+		value uint8
+	}
+	entries := make([]entry, len(keys))
+	for i, key := range keys {
+		if values[i]>>bitsPerValue != 0 {
+			return nil, fmt.Errorf("%w: value %d exceeds %d bits", ErrValueTooLarge, values[i], bitsPerValue)
+		}
+		entries[i] = entry{xorHash(key), values[i]}
+	}
+	// values are looked up by hash once placed, so keep one entry per hash
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hash < entries[j].hash })
+	unique := entries[:0]
+	for i, e := range entries {
+		if i > 0 && e.hash == entries[i-1].hash {
+			if e.value != entries[i-1].value {
+				return nil, ErrConflict
+			}
+			continue
+		}
+		unique = append(unique, e)
+	}
+	entries = unique
+	hashes := make([]uint64, len(entries))
+	for i, e := range entries {
+		hashes[i] = e.hash
+	}
+
+	m := &BloomierMap{xorTable: newXorTable(len(hashes)), value: uint(bitsPerValue)}
+	stack, slots, err := m.peel(hashes)
+	if err != nil {
+		return nil, err
+	}
+	// assign in reverse, so each slot is set after its other two
+	m.words = make([]uint16, 3*m.blockLength)
+	for n := len(stack) - 1; n >= 0; n-- {
+		h, h0, h1, h2 := m.locations(stack[n])
+		i := sort.Search(len(entries), func(i int) bool { return entries[i].hash >= stack[n] })
+		word := m.fingerprint(h)<<m.value | uint16(entries[i].value)
+		m.words[slots[n]] = 0
+		m.words[slots[n]] = word ^ m.words[h0] ^ m.words[h1] ^ m.words[h2]
+	}
+	return m, nil
+}
+
+// fingerprint returns the fingerprint of the seeded hash h, in the bits above
+// the value.
+func (m *BloomierMap) fingerprint(h uint64) uint16 {
+	return uint16(h^h>>32) >> m.value
+}
+
+// Get returns the value of the key and true, or false if the key is not in
+// the map. Keys outside the map are reported with a random value, rather than
+// as not in the map, at the false mapping rate.
+func (m *BloomierMap) Get(key []byte) (uint8, bool) {
+	h, h0, h1, h2 := m.locations(xorHash(key))
+	word := m.words[h0] ^ m.words[h1] ^ m.words[h2]
+	if word>>m.value != m.fingerprint(h) {
+		return 0, false
+	}
+	return uint8(word & (1<<m.value - 1)), true
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (m *BloomierMap) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 18+len(m.words)*2)
+	out[0] = bloomierVersion
+	out[1] = uint8(m.value)
+	binary.BigEndian.PutUint64(out[2:10], m.seed)
+	binary.BigEndian.PutUint64(out[10:18], m.blockLength)
+	for i, w := range m.words {
+		binary.BigEndian.PutUint16(out[18+i*2:], w)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It must
+// not be called concurrently with Get.
+func (m *BloomierMap) UnmarshalBinary(data []byte) error {
+	if len(data) < 18 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != bloomierVersion {
+		return versionError(data[0])
+	}
+	if data[1] < 1 || data[1] > 8 {
+		return ErrBitsPerValue
+	}
+	blockLength := binary.BigEndian.Uint64(data[10:18])
+	if blockLength == 0 || blockLength > math.MaxUint32 {
+		return &CorruptError{"block length", blockLength}
+	}
+	if err := checkData(uint64(len(data)), 18+6*blockLength); err != nil {
+		return err
+	}
+	words := make([]uint16, 3*blockLength)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[18+i*2:])
+	}
+	m.value = uint(data[1])
+	m.seed = binary.BigEndian.Uint64(data[2:10])
+	m.blockLength = blockLength
+	m.words = words
+	return nil
+}
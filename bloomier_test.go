@@ -0,0 +1,122 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// BenchmarkBuildMap tests building a BloomierMap of 4-bit values from 1M keys.
+func BenchmarkBuildMap(b *testing.B) {
+	keys := xorKeys(0, 1000000)
+	values := make([]uint8, len(keys))
+	for i := range values {
+		values[i] = uint8(i % 16)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ring.BuildMap(keys, values, 4); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestBloomierMap ensures every key maps to its value, and measures the rate
+// at which foreign keys are mapped against the expected 2^-(16-bitsPerValue).
+func TestBloomierMap(t *testing.T) {
+	const n, probes = 200000, 1000000
+	for _, bits := range []int{1, 4, 8} {
+		keys := xorKeys(0, n)
+		values := make([]uint8, n)
+		for i := range values {
+			values[i] = uint8(i*7) & (1<<bits - 1)
+		}
+		m, err := ring.BuildMap(keys, values, bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, key := range keys {
+			if v, ok := m.Get(key); !ok || v != values[i] {
+				t.Fatalf("key %d mapped to %d, %v, expected %d", i, v, ok, values[i])
+			}
+		}
+		mapped := 0
+		buff := make([]byte, 4)
+		for i := n; i < n+probes; i++ {
+			intToByte(buff, i)
+			if _, ok := m.Get(buff); ok {
+				mapped++
+			}
+		}
+		expected := 1 / float64(uint(1)<<(16-bits))
+		if rate := float64(mapped) / probes; rate > expected*1.3 || rate < expected*0.7 {
+			t.Fatalf("false mapping rate %f with %d bits, expected %f", rate, bits, expected)
+		}
+	}
+}
+
+// TestBloomierMapKeys ensures duplicate keys are accepted with one value, and
+// invalid values and conflicting duplicates are rejected.
+func TestBloomierMapKeys(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("a"), nil}
+	m, err := ring.BuildMap(keys, []uint8{1, 2, 1, 3}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m.Get(nil); !ok || v != 3 {
+		t.Fatalf("empty key mapped to %d, %v", v, ok)
+	}
+	if _, err := ring.BuildMap(keys, []uint8{1, 2, 0, 3}, 2); err == nil {
+		t.Fatal("conflicting values not captured")
+	}
+	if _, err := ring.BuildMap(keys, []uint8{1, 2, 1, 4}, 2); err == nil {
+		t.Fatal("value overflow not captured")
+	}
+	if _, err := ring.BuildMap(keys, []uint8{1, 2}, 2); err == nil {
+		t.Fatal("length mismatch not captured")
+	}
+	for _, bits := range []int{0, 9} {
+		if _, err := ring.BuildMap(keys, []uint8{0, 0, 0, 0}, bits); err == nil {
+			t.Fatalf("%d bits per value not captured", bits)
+		}
+	}
+	if _, err := ring.BuildMap(nil, nil, 4); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBloomierMapMarshal(t *testing.T) {
+	keys := xorKeys(0, 10000)
+	values := make([]uint8, len(keys))
+	for i := range values {
+		values[i] = uint8(i % 16)
+	}
+	m, _ := ring.BuildMap(keys, values, 4)
+	data, _ := m.MarshalBinary()
+	var m2 ring.BloomierMap
+	if err := m2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, key := range keys {
+		if v, ok := m2.Get(key); !ok || v != values[i] {
+			t.Fatalf("key %d mapped to %d after unmarshal", i, v)
+		}
+	}
+	if data2, _ := m2.MarshalBinary(); !bytes.Equal(data, data2) {
+		t.Fatal("marshaled data changed")
+	}
+	for _, n := range []int{0, 17, 18, len(data) - 1} {
+		if m2.UnmarshalBinary(data[:n]) == nil {
+			t.Fatalf("truncation to %d bytes not captured", n)
+		}
+	}
+	data[1] = 9
+	if m2.UnmarshalBinary(data) == nil {
+		t.Fatal("bits per value not captured")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ErrBudget is returned by InitByBytes and InitByBytesFP given a budget too
+// small for a meaningful ring: less than 9 bytes, for the 64 bits of the
+// smallest ring, or less than a bit for each element. A bit per element allows
+// a false positive rate of no better than 63%.
+var ErrBudget = errors.New("error: byte budget is too small")
+
+// InitByBytes initializes and returns a new ring with a bit array of at most
+// maxBytes bytes, with the number of hash rounds giving the lowest false
+// positive rate once elements have been added, or an error. The rate reached
+// is reported by the FalsePositiveRate of Parameters.
+func InitByBytes(maxBytes uint64, elements int) (*Ring, error) {
+	n, elementsErr := elementCount(elements)
+	size, err := budgetSize(maxBytes)
+	if err := joinErrors(elementsErr, err); err != nil {
+		return nil, err
+	}
+	if size < n {
+		return nil, fmt.Errorf("%w: %d bits for %d elements", ErrBudget, size, n)
+	}
+	k := OptimalK(size, n)
+	if k > maxHash {
+		k = maxHash
+	}
+	return newBudgetRing(Parameters{Bits: size, HashRounds: k}), nil
+}
+
+// InitByBytesFP initializes and returns a new ring with a bit array of at most
+// maxBytes bytes, with the number of hash rounds holding the most elements
+// within the falsePositive rate, or an error. The number of elements is
+// reported by the Capacity of Parameters.
+func InitByBytesFP(maxBytes uint64, falsePositive float64) (*Ring, error) {
+	size, err := budgetSize(maxBytes)
+	if err := joinErrors(checkFalsePositive(falsePositive), err); err != nil {
+		return nil, err
+	}
+	// the optimal number of hash rounds depends on the rate alone
+	k := -math.Log2(falsePositive)
+	if math.Floor(k) > maxHash {
+		return nil, fmt.Errorf("%w: falsePositive %g needs %.0f rounds, limit %d",
+			ErrHashRounds, falsePositive, math.Floor(k), maxHash)
+	}
+	best := Parameters{Bits: size}
+	var elements uint64
+	for _, c := range []float64{math.Floor(k), math.Ceil(k)} {
+		c = math.Min(math.Max(c, 1), maxHash)
+		p := Parameters{Bits: size, HashRounds: uint64(c)}
+		if n := p.Capacity(falsePositive); n > elements {
+			best, elements = p, n
+		}
+	}
+	if elements == 0 || elements > size {
+		return nil, fmt.Errorf("%w: %d bits hold %d elements at falsePositive %g",
+			ErrBudget, size, elements, falsePositive)
+	}
+	r := newBudgetRing(best)
+	r.target = falsePositive
+	return r, nil
+}
+
+// budgetSize returns the number of bits of a ring whose bit array, of
+// size/8+1 bytes, fits in maxBytes bytes.
+func budgetSize(maxBytes uint64) (uint64, error) {
+	if maxBytes < minSize/8+1 {
+		return 0, fmt.Errorf("%w: %d bytes, need at least %d", ErrBudget, maxBytes, minSize/8+1)
+	}
+	if maxBytes > maxLength {
+		return 0, fmt.Errorf("%w: %d bytes exceed %d bytes", ErrTooLarge, maxBytes, maxLength)
+	}
+	return (maxBytes - 1) * 8, nil
+}
+
+// newBudgetRing returns a ring in the default mode with the parameters p.
+func newBudgetRing(p Parameters) *Ring {
+	r := &Ring{mutex: &sync.RWMutex{}}
+	r.size = p.Bits
+	r.hash = p.HashRounds
+	r.set.Store(r.emptyBitset(r.params))
+	return r
+}
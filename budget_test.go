@@ -0,0 +1,121 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestInitByBytes ensures the bit array fills but never exceeds the budget,
+// and that the reported rate is that of the formula at the best number of hash
+// rounds.
+func TestInitByBytes(t *testing.T) {
+	// rate returns (1-(1-1/m)^(kn))^k
+	rate := func(m, k, n uint64) float64 {
+		return math.Pow(1-math.Pow(1-1/float64(m), float64(k*n)), float64(k))
+	}
+	for _, budget := range []uint64{9, 100, 1 << 16, 1 << 22} {
+		for _, elements := range []int{1, 100, 100000} {
+			r, err := ring.InitByBytes(budget, elements)
+			if (budget-1)*8 < uint64(elements) {
+				if !errors.Is(err, ring.ErrBudget) {
+					t.Fatalf("%d bytes for %d elements: expected ErrBudget, got %v", budget, elements, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := r.MarshalBinary()
+			if length := uint64(len(data) - 17); length > budget || length < budget-1 {
+				t.Fatalf("%d bytes for %d elements: bit array of %d bytes", budget, elements, length)
+			}
+			p := r.Parameters()
+			n := uint64(elements)
+			want := rate(p.Bits, p.HashRounds, n)
+			if got := p.FalsePositiveRate(n); math.Abs(got-want) > want*1e-9 {
+				t.Fatalf("%d bytes for %d elements: rate %g, expected %g", budget, elements, got, want)
+			}
+			if p.HashRounds > 1 && rate(p.Bits, p.HashRounds-1, n) < want ||
+				p.HashRounds < 64 && rate(p.Bits, p.HashRounds+1, n) < want {
+				t.Fatalf("%d bytes for %d elements: %d rounds are not the best", budget, elements, p.HashRounds)
+			}
+		}
+	}
+}
+
+// TestInitByBytesFP ensures the ring holds the reported capacity within the
+// rate, and no more, and measures the rate once it is filled.
+func TestInitByBytesFP(t *testing.T) {
+	for _, fp := range []float64{0.1, 0.01, 0.001} {
+		r, err := ring.InitByBytesFP(1<<16, fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := r.MarshalBinary()
+		if length := len(data) - 17; length > 1<<16 {
+			t.Fatalf("bit array of %d bytes exceeds the budget", length)
+		}
+		p := r.Parameters()
+		capacity := p.Capacity(fp)
+		if p.FalsePositiveRate(capacity) > fp || p.FalsePositiveRate(capacity+1) <= fp {
+			t.Fatalf("%g: capacity %d is not the largest within the rate", fp, capacity)
+		}
+		// the default sizing needs as many bits for the capacity
+		if sized, _ := ring.InitUint(capacity, fp); sized.Parameters().Bits < p.Bits*99/100 {
+			t.Fatalf("%g: %d elements need %d bits, not %d", fp, capacity, sized.Parameters().Bits, p.Bits)
+		}
+
+		buff := make([]byte, 4)
+		for i := 0; i < int(capacity); i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+		}
+		positives := 0
+		const probes = 1000000
+		for i := int(capacity); i < int(capacity)+probes; i++ {
+			intToByte(buff, i)
+			if r.Test(buff) {
+				positives++
+			}
+		}
+		// allow for sampling noise around the target
+		if rate := float64(positives) / probes; rate > fp*1.1 {
+			t.Fatalf("False positive rate %f exceeds %f", rate, fp)
+		}
+	}
+}
+
+// TestInitByBytesErrors ensures budgets too small for a meaningful ring, and
+// invalid arguments, are rejected.
+func TestInitByBytesErrors(t *testing.T) {
+	errs := map[error][]error{}
+	// collect records the error of a constructor expected to match want
+	collect := func(want error) func(*ring.Ring, error) {
+		return func(_ *ring.Ring, err error) {
+			errs[want] = append(errs[want], err)
+		}
+	}
+	collect(ring.ErrBudget)(ring.InitByBytes(8, 1))
+	collect(ring.ErrBudget)(ring.InitByBytes(1000, 8000))
+	collect(ring.ErrElements)(ring.InitByBytes(1000, 0))
+	collect(ring.ErrTooLarge)(ring.InitByBytes(math.MaxUint64, 1))
+	collect(ring.ErrBudget)(ring.InitByBytesFP(8, 0.01))
+	collect(ring.ErrBudget)(ring.InitByBytesFP(9, 1e-19))
+	collect(ring.ErrBudget)(ring.InitByBytesFP(9, 0.9))
+	collect(ring.ErrFalsePositive)(ring.InitByBytesFP(1000, 0))
+	collect(ring.ErrHashRounds)(ring.InitByBytesFP(1000, 1e-30))
+	for want, got := range errs {
+		for _, err := range got {
+			if !errors.Is(err, want) {
+				t.Errorf("expected %v, got %v", want, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"runtime"
+	"sync"
+)
+
+// BuildFrom initializes a ring sized for the tokens at the falsePositive rate
+// and adds every token to it, hashing in parallel across workers goroutines.
+// Workers set bits with atomic operations rather than the mutex, so
+// construction scales with the number of workers. A workers value below 1 uses
+// GOMAXPROCS. The returned ring is a regular, fully synchronized ring.
+func BuildFrom(tokens [][]byte, falsePositive float64, workers int) (*Ring, error) {
+	r, err := Init(len(tokens), falsePositive)
+	if err != nil {
+		return nil, err
+	}
+	workers = buildWorkers(workers)
+	b := r.prepareBuild()
+
+	chunk := (len(tokens) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(tokens); start += chunk {
+		end := start + chunk
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		wg.Add(1)
+		go func(tokens [][]byte) {
+			defer wg.Done()
+			for _, data := range tokens {
+				r.addAtomic(b, data)
+			}
+		}(tokens[start:end])
+	}
+	wg.Wait()
+	return r, nil
+}
+
+// BuildFromChan initializes a ring sized for elements at the falsePositive rate
+// and adds every token received from tokens until it is closed, hashing in
+// parallel across workers goroutines as with BuildFrom.
+func BuildFromChan(tokens <-chan []byte, elements int, falsePositive float64, workers int) (*Ring, error) {
+	r, err := Init(elements, falsePositive)
+	if err != nil {
+		return nil, err
+	}
+	workers = buildWorkers(workers)
+	b := r.prepareBuild()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for data := range tokens {
+				r.addAtomic(b, data)
+			}
+		}()
+	}
+	wg.Wait()
+	return r, nil
+}
+
+// buildWorkers returns the number of workers to build with.
+func buildWorkers(workers int) int {
+	if workers < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return workers
+}
+
+// prepareBuild allocates every chunk of a new ring up front, so concurrent
+// builders never race to allocate one.
+func (r *Ring) prepareBuild() *bitset {
+	b := r.set.Load()
+	for i := range b.chunks {
+		b.chunks[i] = b.newChunk(i)
+	}
+	return b
+}
+
+// addAtomic adds the data to the fully allocated bitset b of a ring under
+// construction, without taking the mutex.
+func (r *Ring) addAtomic(b *bitset, data []byte) {
+	hash := r.rounds(data)
+	for i := uint64(0); i < r.hash; i++ {
+		index := r.index(&hash, i)
+		atomicOr(b.chunks[index>>(chunkShift+3)], (index/8)&chunkMask, 1<<(index%8))
+		block := index / summaryBlock
+		atomicOr(b.summary, block/8, 1<<(block%8))
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// buildTokens returns n random tokens.
+func buildTokens(n int) [][]byte {
+	tokens := make([][]byte, n)
+	for i := range tokens {
+		tokens[i] = make([]byte, 16)
+		rand.Read(tokens[i])
+	}
+	return tokens
+}
+
+// BenchmarkBuildFrom builds a Ring from a million tokens with 1, 4, and 16
+// workers.
+func BenchmarkBuildFrom(b *testing.B) {
+	tokens := buildTokens(tests)
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := ring.BuildFrom(tokens, fpRate, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestBuildFrom ensures a Ring built in parallel contains every token and is
+// identical to one built sequentially.
+func TestBuildFrom(t *testing.T) {
+	tokens := buildTokens(100000)
+	r, err := ring.BuildFrom(tokens, fpRate, 8)
+	if err != nil {
+		t.Fatalf("Error calling BuildFrom: %v", err)
+	}
+	seq, _ := ring.Init(len(tokens), fpRate)
+	for _, token := range tokens {
+		if !r.Test(token) {
+			t.Fatal("Token missing after BuildFrom")
+		}
+		seq.Add(token)
+	}
+	out, _ := r.MarshalBinary()
+	want, _ := seq.MarshalBinary()
+	if !bytes.Equal(out, want) {
+		t.Fatal("BuildFrom differs from sequential Add")
+	}
+
+	// the built ring is a regular ring
+	r.Add([]byte("hello"))
+	if !r.Test([]byte("hello")) {
+		t.Fatal("Built Ring unusable")
+	}
+
+	if _, err := ring.BuildFrom(nil, fpRate, 1); err == nil {
+		t.Fatal("Expected error building from no tokens")
+	}
+}
+
+// TestBuildFromChan ensures a Ring built from a channel contains every token.
+func TestBuildFromChan(t *testing.T) {
+	tokens := buildTokens(100000)
+	ch := make(chan []byte, 64)
+	go func() {
+		for _, token := range tokens {
+			ch <- token
+		}
+		close(ch)
+	}()
+	r, err := ring.BuildFromChan(ch, len(tokens), fpRate, 0)
+	if err != nil {
+		t.Fatalf("Error calling BuildFromChan: %v", err)
+	}
+	for _, token := range tokens {
+		if !r.Test(token) {
+			t.Fatal("Token missing after BuildFromChan")
+		}
+	}
+	if _, err := ring.BuildFromChan(ch, 0, fpRate, 1); err == nil {
+		t.Fatal("Expected error building with no elements")
+	}
+}
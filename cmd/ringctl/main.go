@@ -0,0 +1,385 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Command ringctl creates, inspects and modifies rings persisted to files.
+//
+// Usage:
+//
+//	ringctl create --elements 1000000 --fp 0.01 --out filter.bin
+//	ringctl add --in filter.bin --keys keys.txt
+//	ringctl test --in filter.bin --key foo
+//	ringctl stats --in filter.bin
+//	ringctl merge a.bin b.bin --out c.bin
+//	ringctl convert --in filter.bin --out filter.gz --to compressed
+//
+// Files are read in any of three encodings, detected from their first bytes:
+// dense, the output of MarshalBinary; sparse, the output of MarshalBinary of
+// the CompactRing of the ring, smaller while the ring is sparsely filled; and
+// compressed, the dense encoding compressed with gzip. Files are written dense,
+// unless converted, and replaced atomically.
+//
+// The add command reads one key per line from the file of --keys, or from the
+// standard input if it is "-", and writes the ring back to --in, or to --out.
+// The stats command prints the parameters and statistics of the ring as JSON.
+//
+// The exit status is 0 on success, 1 if the key of test is not present, and 2
+// on any error, so scripts can tell a missing key from a failure.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/tannerryan/ring"
+)
+
+// Exit statuses.
+const (
+	exitOK     = 0 // success, or the key is present
+	exitAbsent = 1 // the key is not present
+	exitError  = 2 // invalid usage, or an error
+)
+
+// Encodings of ring files.
+const (
+	dense      = "dense"
+	sparse     = "sparse"
+	compressed = "compressed"
+)
+
+// errUsage is returned for invalid arguments, after the usage is printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command of args, returning its exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: ringctl create|add|test|stats|merge|convert [flags]")
+		return exitError
+	}
+	commands := map[string]func([]string, io.Reader, io.Writer, io.Writer) (bool, error){
+		"create":  create,
+		"add":     add,
+		"test":    test,
+		"stats":   stats,
+		"merge":   merge,
+		"convert": convert,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "ringctl: unknown command %q\n", args[0])
+		return exitError
+	}
+	present, err := command(args[1:], stdin, stdout, stderr)
+	switch {
+	case errors.Is(err, errUsage):
+		return exitError
+	case err != nil:
+		fmt.Fprintf(stderr, "ringctl %s: %v\n", args[0], err)
+		return exitError
+	case !present:
+		return exitAbsent
+	}
+	return exitOK
+}
+
+// parse parses the flags of args, which may follow positional arguments, and
+// returns the positional arguments. It reports errUsage if the flags are
+// invalid, or if the number of positional arguments is not n.
+func parse(fs *flag.FlagSet, args []string, n int, stderr io.Writer) ([]string, error) {
+	fs.SetOutput(stderr)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != n {
+		fmt.Fprintf(stderr, "ringctl %s: expected %d arguments, got %d\n", fs.Name(), n, len(positional))
+		fs.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// required reports errUsage if any of the flags is empty.
+func required(fs *flag.FlagSet, stderr io.Writer, flags ...string) error {
+	for _, name := range flags {
+		if fs.Lookup(name).Value.String() == "" {
+			fmt.Fprintf(stderr, "ringctl %s: --%s is required\n", fs.Name(), name)
+			fs.Usage()
+			return errUsage
+		}
+	}
+	return nil
+}
+
+func create(args []string, _ io.Reader, _, stderr io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	elements := fs.Int("elements", 0, "number of elements the ring is sized for")
+	fp := fs.Float64("fp", 0.01, "false positive rate at the number of elements")
+	seed := fs.Uint64("seed", 0, "seed of the hash rounds, 0 for unseeded")
+	out := fs.String("out", "", "file to write")
+	if _, err := parse(fs, args, 0, stderr); err != nil {
+		return false, err
+	}
+	if err := required(fs, stderr, "out"); err != nil {
+		return false, err
+	}
+	var opts []ring.Option
+	if *seed != 0 {
+		opts = append(opts, ring.WithSeed(*seed))
+	}
+	r, err := ring.Init(*elements, *fp, opts...)
+	if err != nil {
+		return false, err
+	}
+	return true, write(*out, r, dense)
+}
+
+func add(args []string, stdin io.Reader, stdout, stderr io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	in := fs.String("in", "", "file of the ring")
+	keys := fs.String("keys", "", `file of keys, one per line, or "-" for the standard input`)
+	out := fs.String("out", "", "file to write, instead of --in")
+	if _, err := parse(fs, args, 0, stderr); err != nil {
+		return false, err
+	}
+	if err := required(fs, stderr, "in", "keys"); err != nil {
+		return false, err
+	}
+	r, _, err := read(*in)
+	if err != nil {
+		return false, err
+	}
+	rd := stdin
+	if *keys != "-" {
+		f, err := os.Open(*keys)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		rd = f
+	}
+	n, err := r.AddFromReader(rd)
+	if err != nil {
+		return false, err
+	}
+	if *out == "" {
+		*out = *in
+	}
+	if err := write(*out, r, dense); err != nil {
+		return false, err
+	}
+	fmt.Fprintf(stdout, "added %d keys\n", n)
+	return true, nil
+}
+
+func test(args []string, _ io.Reader, stdout, stderr io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	in := fs.String("in", "", "file of the ring")
+	key := fs.String("key", "", "key to test")
+	if _, err := parse(fs, args, 0, stderr); err != nil {
+		return false, err
+	}
+	if err := required(fs, stderr, "in", "key"); err != nil {
+		return false, err
+	}
+	r, _, err := read(*in)
+	if err != nil {
+		return false, err
+	}
+	present := r.Test([]byte(*key))
+	fmt.Fprintln(stdout, present)
+	return present, nil
+}
+
+// report is the output of stats.
+type report struct {
+	Encoding       string
+	FileBytes      int64
+	Parameters     ring.Parameters
+	SetBits        uint64
+	Fill           float64
+	EstimatedItems float64
+	FalsePositive  float64
+	MemoryBytes    uint64
+}
+
+func stats(args []string, _ io.Reader, stdout, stderr io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	in := fs.String("in", "", "file of the ring")
+	if _, err := parse(fs, args, 0, stderr); err != nil {
+		return false, err
+	}
+	if err := required(fs, stderr, "in"); err != nil {
+		return false, err
+	}
+	r, encoding, err := read(*in)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(*in)
+	if err != nil {
+		return false, err
+	}
+	s := r.Stats()
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return true, enc.Encode(report{
+		Encoding:       encoding,
+		FileBytes:      info.Size(),
+		Parameters:     r.Parameters(),
+		SetBits:        s.SetBits,
+		Fill:           s.Fill,
+		EstimatedItems: s.EstimatedItems,
+		FalsePositive:  s.FalsePositive,
+		MemoryBytes:    s.MemoryBytes,
+	})
+}
+
+func merge(args []string, _ io.Reader, _, stderr io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write")
+	files, err := parse(fs, args, 2, stderr)
+	if err != nil {
+		return false, err
+	}
+	if err := required(fs, stderr, "out"); err != nil {
+		return false, err
+	}
+	a, _, err := read(files[0])
+	if err != nil {
+		return false, err
+	}
+	b, _, err := read(files[1])
+	if err != nil {
+		return false, err
+	}
+	if err := a.Merge(b); err != nil {
+		return false, err
+	}
+	return true, write(*out, a, dense)
+}
+
+func convert(args []string, _ io.Reader, _, stderr io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	in := fs.String("in", "", "file of the ring")
+	out := fs.String("out", "", "file to write")
+	to := fs.String("to", "", "encoding to write: dense, sparse or compressed")
+	if _, err := parse(fs, args, 0, stderr); err != nil {
+		return false, err
+	}
+	if err := required(fs, stderr, "in", "out", "to"); err != nil {
+		return false, err
+	}
+	if *to != dense && *to != sparse && *to != compressed {
+		fmt.Fprintf(stderr, "ringctl convert: unknown encoding %q\n", *to)
+		return false, errUsage
+	}
+	r, _, err := read(*in)
+	if err != nil {
+		return false, err
+	}
+	return true, write(*out, r, *to)
+}
+
+// gzipMagic are the first bytes of gzip data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// read reads the ring of the file, returning it and its encoding.
+func read(path string) (*ring.Ring, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	rd := bufio.NewReader(f)
+	head, _ := rd.Peek(2)
+	encoding := dense
+	var src io.Reader = rd
+	if bytes.Equal(head, gzipMagic) {
+		zr, err := gzip.NewReader(rd)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", path, err)
+		}
+		encoding, src = compressed, zr
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", path, err)
+	}
+	r := new(ring.Ring)
+	if err := r.UnmarshalBinary(data); err != nil {
+		if encoding != dense || !errors.Is(err, ring.ErrBadVersion) {
+			return nil, "", fmt.Errorf("%s: %w", path, err)
+		}
+		// the version of a CompactRing
+		c := new(ring.CompactRing)
+		if err := c.UnmarshalBinary(data); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", path, err)
+		}
+		return c.Expand(), sparse, nil
+	}
+	return r, encoding, nil
+}
+
+// write writes the ring to the file in the encoding, through a temporary file
+// of the same directory renamed over it once complete.
+func write(path string, r *ring.Ring, encoding string) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = f.Chmod(0o644); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	switch encoding {
+	case dense:
+		_, err = r.WriteTo(w)
+	case compressed:
+		zw := gzip.NewWriter(w)
+		if _, err = r.WriteTo(zw); err == nil {
+			err = zw.Close()
+		}
+	case sparse:
+		var data []byte
+		if data, err = r.Compact().MarshalBinary(); err == nil {
+			_, err = w.Write(data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
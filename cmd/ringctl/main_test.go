@@ -0,0 +1,126 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ringctl runs the command, returning its exit status and output.
+func ringctl(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// keys returns n keys, one per line.
+func keys(prefix string, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(prefix + strconv.Itoa(i) + "\n")
+	}
+	return b.String()
+}
+
+// TestCommands drives every command against files of a temporary directory.
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	if err := os.WriteFile(path("keys.txt"), []byte(keys("a", 1000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"create", "--elements", "10000", "--fp", "0.01", "--out", path("a.bin")},
+		{"create", "--elements", "10000", "--fp", "0.01", "--out", path("b.bin")},
+		{"add", "--in", path("a.bin"), "--keys", path("keys.txt")},
+	} {
+		if code, _, stderr := ringctl(t, "", args...); code != exitOK {
+			t.Fatalf("%v: exit %d: %s", args, code, stderr)
+		}
+	}
+	// keys of the standard input
+	if code, stdout, stderr := ringctl(t, keys("b", 1000), "add", "--in", path("b.bin"), "--keys", "-"); code != exitOK || stdout != "added 1000 keys\n" {
+		t.Fatalf("add from stdin: exit %d: %q %s", code, stdout, stderr)
+	}
+
+	if code, stdout, _ := ringctl(t, "", "test", "--in", path("a.bin"), "--key", "a7"); code != exitOK || stdout != "true\n" {
+		t.Fatalf("present key: exit %d, %q", code, stdout)
+	}
+	if code, stdout, _ := ringctl(t, "", "test", "--in", path("a.bin"), "--key", "b7"); code != exitAbsent || stdout != "false\n" {
+		t.Fatalf("absent key: exit %d, %q", code, stdout)
+	}
+
+	if code, _, stderr := ringctl(t, "", "merge", path("a.bin"), path("b.bin"), "--out", path("c.bin")); code != exitOK {
+		t.Fatalf("merge: exit %d: %s", code, stderr)
+	}
+	for _, key := range []string{"a7", "b7"} {
+		if code, _, _ := ringctl(t, "", "test", "--in", path("c.bin"), "--key", key); code != exitOK {
+			t.Fatalf("merged ring lacks %s", key)
+		}
+	}
+
+	// every encoding reads back as the same ring
+	dense, _ := os.ReadFile(path("c.bin"))
+	for _, to := range []string{"sparse", "compressed", "dense"} {
+		converted := path("c." + to)
+		if code, _, stderr := ringctl(t, "", "convert", "--in", path("c.bin"), "--out", converted, "--to", to); code != exitOK {
+			t.Fatalf("convert to %s: exit %d: %s", to, code, stderr)
+		}
+		back := path("back." + to)
+		if code, _, stderr := ringctl(t, "", "convert", "--in", converted, "--out", back, "--to", "dense"); code != exitOK {
+			t.Fatalf("convert from %s: exit %d: %s", to, code, stderr)
+		}
+		if data, _ := os.ReadFile(back); !bytes.Equal(data, dense) {
+			t.Fatalf("%s encoding does not round trip", to)
+		}
+		code, stdout, _ := ringctl(t, "", "stats", "--in", converted)
+		var r report
+		if err := json.Unmarshal([]byte(stdout), &r); code != exitOK || err != nil {
+			t.Fatalf("stats of %s: exit %d: %v", to, code, err)
+		}
+		if r.Encoding != to || r.Parameters.Bits == 0 || r.EstimatedItems < 1800 || r.EstimatedItems > 2200 {
+			t.Fatalf("unexpected stats of %s: %+v", to, r)
+		}
+	}
+}
+
+// TestErrors ensures errors exit with exitError, distinct from absent keys.
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.bin")
+	large := filepath.Join(dir, "large.bin")
+	garbage := filepath.Join(dir, "garbage.bin")
+	ringctl(t, "", "create", "--elements", "100", "--out", small)
+	ringctl(t, "", "create", "--elements", "1000", "--out", large)
+	os.WriteFile(garbage, []byte("not a ring"), 0o644)
+
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"create", "--elements", "100"},
+		{"create", "--elements", "0", "--out", filepath.Join(dir, "zero.bin")},
+		{"create", "--bogus"},
+		{"test", "--in", filepath.Join(dir, "missing.bin"), "--key", "a"},
+		{"test", "--in", garbage, "--key", "a"},
+		{"merge", small, large, "--out", filepath.Join(dir, "out.bin")},
+		{"merge", small, "--out", filepath.Join(dir, "out.bin")},
+		{"convert", "--in", small, "--out", filepath.Join(dir, "out.bin"), "--to", "zip"},
+	} {
+		if code, _, stderr := ringctl(t, "", args...); code != exitError || stderr == "" {
+			t.Fatalf("%v: expected exit %d with a message, got %d", args, exitError, code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.bin")); !os.IsNotExist(err) {
+		t.Fatal("failed merge wrote its output")
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sync"
+)
+
+const (
+	// compactVersion is the marshaled version of a compact ring.
+	compactVersion = 23
+	// compactSeededVersion is the marshaled version of a compact ring with a
+	// seed, which follows the count.
+	compactSeededVersion = 26
+	// compactSample is the number of zeros of the upper bits between samples
+	// of their positions.
+	compactSample = 256
+)
+
+// CompactRing is an immutable, compressed copy of a Ring, queried directly in
+// its compressed form. The positions of the set bits are stored with the
+// Elias-Fano encoding, needing 2+ceil(log2(m/n)) bits for each of n set bits of
+// m, so it only saves memory while the ring is sparsely filled. At a false
+// positive rate of 0.1%, a ring holding a tenth of the data it was sized for
+// compacts to about 40% of its size, while a ring filled to capacity has half
+// its bits set and grows by about three quarters. Bytes reports the size, so
+// callers can choose the smaller form.
+//
+// Each probe of Test searches the encoding rather than reading a single bit,
+// which makes Test about 3.5 times slower than on a Ring of a million elements.
+// It is safe for concurrent use.
+type CompactRing struct {
+	params          // parameters of the ring
+	count  uint64   // number of set bits
+	low    uint     // bits of each position stored in lower
+	lower  []uint64 // low bits of each position, packed
+	upper  []uint64 // unary coded high bits of each position
+	zeros  []uint64 // position in upper of every 256th zero
+}
+
+// Compact returns a compressed copy of the ring, holding its current data. The
+// copy of a zero Ring holds no data.
+func (r *Ring) Compact() *CompactRing {
+	if r.set.Load() == nil {
+		return newCompact(params{}, nil)
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	b := r.set.Load()
+
+	var positions []uint64
+	var scratch []uint8
+	for i, chunk := range b.chunks {
+		if chunk == nil {
+			continue
+		}
+		start := uint64(i) << chunkShift
+		if b.stamps != nil {
+			// drop blocks written before the last Reset
+			scratch = append(scratch[:0], chunk...)
+			b.clearStale(scratch, start)
+			chunk = scratch
+		}
+		for j, v := range chunk {
+			for ; v != 0; v &= v - 1 {
+				positions = append(positions, (start+uint64(j))*8+uint64(bits.TrailingZeros8(v)))
+			}
+		}
+	}
+	return newCompact(b.params, positions)
+}
+
+// Expand returns a Ring holding the bits of the compact ring, with its
+// parameters and no Options, the inverse of Compact. The Ring of a zero
+// CompactRing is a zero Ring.
+func (c *CompactRing) Expand() *Ring {
+	if c.hash == 0 {
+		return new(Ring)
+	}
+	r := &Ring{params: c.params, mutex: new(sync.RWMutex)}
+	b := r.emptyBitset(c.params)
+	var high, i uint64
+	for u := uint64(0); i < c.count; u++ {
+		if c.upper[u/64]&(1<<(u%64)) == 0 {
+			high++
+			continue
+		}
+		b.set(high<<c.low | c.getLower(i))
+		i++
+	}
+	r.set.Store(b)
+	return r
+}
+
+// newCompact returns a compact ring holding the sorted positions.
+func newCompact(p params, positions []uint64) *CompactRing {
+	c := &CompactRing{params: p, count: uint64(len(positions))}
+	c.low = lowBits(p.size, c.count)
+	c.lower = make([]uint64, (c.count*uint64(c.low)+63)/64)
+	// one bit per position, and one zero ending each bucket of high bits
+	c.upper = make([]uint64, (c.count+p.size>>c.low+1+63)/64)
+	for i, pos := range positions {
+		c.setLower(uint64(i), pos&(1<<c.low-1))
+		u := pos>>c.low + uint64(i)
+		c.upper[u/64] |= 1 << (u % 64)
+	}
+	c.sample()
+	return c
+}
+
+// lowBits returns the number of low bits of each of count positions below size
+// stored directly, floor(log2(size/count)), which bounds the upper bits to
+// about two per position.
+func lowBits(size, count uint64) uint {
+	if count == 0 {
+		count = 1
+	}
+	if size/count <= 1 {
+		return 0
+	}
+	return uint(bits.Len64(size/count) - 1)
+}
+
+// setLower stores the low bits v of the i-th position.
+func (c *CompactRing) setLower(i, v uint64) {
+	if c.low == 0 {
+		return
+	}
+	bit := i * uint64(c.low)
+	word, shift := bit/64, bit%64
+	c.lower[word] |= v << shift
+	if shift+uint64(c.low) > 64 {
+		c.lower[word+1] |= v >> (64 - shift)
+	}
+}
+
+// getLower returns the low bits of the i-th position.
+func (c *CompactRing) getLower(i uint64) uint64 {
+	if c.low == 0 {
+		return 0
+	}
+	bit := i * uint64(c.low)
+	word, shift := bit/64, bit%64
+	v := c.lower[word] >> shift
+	if shift+uint64(c.low) > 64 {
+		v |= c.lower[word+1] << (64 - shift)
+	}
+	return v & (1<<c.low - 1)
+}
+
+// sample records the position of every 256th zero of the upper bits.
+func (c *CompactRing) sample() {
+	c.zeros = c.zeros[:0]
+	var seen uint64
+	for w, word := range c.upper {
+		zeros := uint64(64 - bits.OnesCount64(word))
+		for next := uint64(len(c.zeros)) * compactSample; next < seen+zeros; next += compactSample {
+			c.zeros = append(c.zeros, uint64(w)*64+selectBit(^word, next-seen))
+		}
+		seen += zeros
+	}
+}
+
+// selectBit returns the position of the n-th set bit of word, which must have
+// more than n set bits.
+func selectBit(word, n uint64) uint64 {
+	for ; n > 0; n-- {
+		word &= word - 1
+	}
+	return uint64(bits.TrailingZeros64(word))
+}
+
+// selectZero returns the position in the upper bits of the n-th zero.
+func (c *CompactRing) selectZero(n uint64) uint64 {
+	pos := c.zeros[n/compactSample]
+	n %= compactSample
+	w := pos / 64
+	// zeros of the first word at or after the sample
+	word := ^c.upper[w] &^ (1<<(pos%64) - 1)
+	for {
+		zeros := uint64(bits.OnesCount64(word))
+		if n < zeros {
+			return w*64 + selectBit(word, n)
+		}
+		n -= zeros
+		w++
+		word = ^c.upper[w]
+	}
+}
+
+// has returns if the bit at index is set.
+func (c *CompactRing) has(index uint64) bool {
+	high, low := index>>c.low, index&(1<<c.low-1)
+	// the bucket of high holds the ones between its preceding zero and its own
+	var start uint64
+	if high > 0 {
+		start = c.selectZero(high-1) + 1
+	}
+	for u := start; c.upper[u/64]&(1<<(u%64)) != 0; u++ {
+		if v := c.getLower(u - high); v >= low {
+			// positions are sorted, so no later one can match
+			return v == low
+		}
+	}
+	return false
+}
+
+// Test returns a bool if the data is in the ring. True indicates that the data
+// may be in the ring, while false indicates that the data is not in the ring.
+func (c *CompactRing) Test(data []byte) bool {
+	if c.hash == 0 {
+		// the copy of a zero Ring, or a zero CompactRing
+		return false
+	}
+	hash := c.rounds(data)
+	for i := uint64(0); i < c.hash; i++ {
+		if !c.has(c.index(&hash, i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Bytes returns the memory used by the compressed bits.
+func (c *CompactRing) Bytes() uint64 {
+	return uint64(len(c.lower)+len(c.upper)+len(c.zeros)) * 8
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (c *CompactRing) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 26, 34+(len(c.lower)+len(c.upper))*8)
+	out[0] = compactVersion
+	out[1] = c.flags
+	binary.BigEndian.PutUint64(out[2:10], c.size)
+	binary.BigEndian.PutUint64(out[10:18], c.hash)
+	binary.BigEndian.PutUint64(out[18:26], c.count)
+	if c.seed != 0 {
+		out[0] = compactSeededVersion
+		out = binary.BigEndian.AppendUint64(out, c.seed)
+	}
+	for _, w := range c.lower {
+		out = binary.BigEndian.AppendUint64(out, w)
+	}
+	for _, w := range c.upper {
+		out = binary.BigEndian.AppendUint64(out, w)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. The
+// positions are decoded and re-encoded, so malformed data is rejected rather
+// than answering queries wrongly. It must not be called concurrently with
+// Test.
+func (c *CompactRing) UnmarshalBinary(data []byte) error {
+	if len(data) < 26 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	header := 26
+	switch data[0] {
+	case compactVersion:
+	case compactSeededVersion:
+		header = 34
+		if len(data) < header {
+			return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+		}
+	default:
+		return versionError(data[0])
+	}
+	size := binary.BigEndian.Uint64(data[2:10])
+	if size == 0 {
+		return &CorruptError{"size", size}
+	}
+	p, err := newParams(size, binary.BigEndian.Uint64(data[10:18]), data[1])
+	if err != nil {
+		return err
+	}
+	count := binary.BigEndian.Uint64(data[18:26])
+	if count > size || count > uint64(len(data))*8 {
+		return &CorruptError{"count", count}
+	}
+	if header == 34 {
+		p.seed = binary.BigEndian.Uint64(data[26:34])
+	}
+	n := &CompactRing{params: p, count: count}
+	n.low = lowBits(size, count)
+	lower := (count*uint64(n.low) + 63) / 64
+	upper := (count + size>>n.low + 1 + 63) / 64
+	if err := checkData(uint64(len(data)), uint64(header)+(lower+upper)*8); err != nil {
+		return err
+	}
+	n.lower = make([]uint64, lower)
+	n.upper = make([]uint64, upper)
+	for i := range n.lower {
+		n.lower[i] = binary.BigEndian.Uint64(data[header+i*8:])
+	}
+	for i := range n.upper {
+		n.upper[i] = binary.BigEndian.Uint64(data[header+(int(lower)+i)*8:])
+	}
+	// decode every position, which must be sorted and within the ring
+	positions := make([]uint64, 0, count)
+	var high uint64
+	for u := uint64(0); u < upper*64 && uint64(len(positions)) < count; u++ {
+		if n.upper[u/64]&(1<<(u%64)) == 0 {
+			high++
+			continue
+		}
+		pos := high<<n.low | n.getLower(uint64(len(positions)))
+		if pos >= size || len(positions) > 0 && pos <= positions[len(positions)-1] {
+			return &CorruptError{"position", pos}
+		}
+		positions = append(positions, pos)
+	}
+	if uint64(len(positions)) != count {
+		return &CorruptError{"count", count}
+	}
+	*c = *newCompact(n.params, positions)
+	return nil
+}
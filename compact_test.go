@@ -0,0 +1,154 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// compactPair returns a ring sized for tests elements holding the first n, and
+// its compact copy.
+func compactPair(n int, opts ...ring.Option) (*ring.Ring, *ring.CompactRing) {
+	r, _ := ring.Init(tests, fpRate, opts...)
+	buff := make([]byte, 4)
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	return r, r.Compact()
+}
+
+// rawBytes returns the size of the bit array of a ring.
+func rawBytes(r *ring.Ring) uint64 {
+	data, _ := r.MarshalBinary()
+	return uint64(len(data))
+}
+
+// benchmarkCompactTest measures Test on a ring holding a tenth of its
+// capacity, for comparison with the same ring uncompressed.
+func benchmarkCompactTest(b *testing.B, compact bool) {
+	r, c := compactPair(tests / 10)
+	buff := make([]byte, 4)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i%(tests/5))
+		if compact {
+			c.Test(buff)
+		} else {
+			r.Test(buff)
+		}
+	}
+}
+
+func BenchmarkCompactTest(b *testing.B)     { benchmarkCompactTest(b, true) }
+func BenchmarkCompactTestRing(b *testing.B) { benchmarkCompactTest(b, false) }
+
+// TestCompactEquivalence ensures a compact ring answers exactly like the ring
+// it was made from, across modes and fills, and is smaller than the ring while
+// sparsely filled.
+func TestCompactEquivalence(t *testing.T) {
+	for _, tc := range []struct {
+		n    int
+		opts []ring.Option
+	}{
+		{0, nil},
+		{tests / 10, nil},
+		{tests, nil},
+		{tests / 10, []ring.Option{ring.WithPowerOfTwoSize()}},
+		{tests / 10, []ring.Option{ring.WithOneHash()}},
+		{tests / 10, []ring.Option{ring.WithPartitioned(), ring.WithPowerOfTwoSize()}},
+	} {
+		r, c := compactPair(tc.n, tc.opts...)
+		buff := make([]byte, 4)
+		for i := 0; i < tests; i++ {
+			intToByte(buff, i)
+			if c.Test(buff) != r.Test(buff) {
+				t.Fatalf("data %d: compact %v, ring %v", i, c.Test(buff), r.Test(buff))
+			}
+		}
+		raw := rawBytes(r)
+		switch tc.n {
+		case 0:
+			if c.Bytes() > 64 {
+				t.Fatalf("empty compact %d bytes", c.Bytes())
+			}
+		case tests / 10:
+			if c.Bytes() > raw/2 {
+				t.Fatalf("compact %d bytes, ring %d bytes", c.Bytes(), raw)
+			}
+		case tests:
+			// a full ring is incompressible, and grows by about half
+			if c.Bytes() > raw*2 {
+				t.Fatalf("compact %d bytes, ring %d bytes", c.Bytes(), raw)
+			}
+		}
+	}
+}
+
+// TestCompactFastReset ensures bits written before a constant time Reset are
+// not carried into the compact ring.
+func TestCompactFastReset(t *testing.T) {
+	r, _ := ring.Init(10000, fpRate, ring.WithFastReset())
+	r.Add([]byte("before"))
+	r.Reset()
+	r.Add([]byte("after"))
+	c := r.Compact()
+	if c.Test([]byte("before")) || !c.Test([]byte("after")) {
+		t.Fatal("unexpected data after Reset")
+	}
+}
+
+func TestCompactMarshal(t *testing.T) {
+	_, c := compactPair(tests/10, ring.WithPowerOfTwoSize())
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c2 ring.CompactRing
+	if err := c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	buff := make([]byte, 4)
+	for i := 0; i < tests/5; i++ {
+		intToByte(buff, i)
+		if c.Test(buff) != c2.Test(buff) {
+			t.Fatalf("data %d changed after unmarshal", i)
+		}
+	}
+	if data2, _ := c2.MarshalBinary(); !bytes.Equal(data, data2) {
+		t.Fatal("marshaled data changed")
+	}
+	for _, n := range []int{0, 25, 26, len(data) - 1} {
+		if c2.UnmarshalBinary(data[:n]) == nil {
+			t.Fatalf("truncation to %d bytes not captured", n)
+		}
+	}
+	// a count beyond the encoded positions
+	data[25]++
+	if c2.UnmarshalBinary(data) == nil {
+		t.Fatal("count not captured")
+	}
+}
+
+// TestCompactExpand ensures expanding a compact ring restores the ring it was
+// made from.
+func TestCompactExpand(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithSeed(3)}, {ring.WithBlocked()}, {ring.WithFastReset()}} {
+		r, c := compactPair(tests/10, opts...)
+		if !c.Expand().Equal(r) {
+			t.Fatal("expanded ring differs")
+		}
+	}
+	empty, c := compactPair(0)
+	if !c.Expand().Equal(empty) {
+		t.Fatal("expanded empty ring differs")
+	}
+	if new(ring.CompactRing).Expand().Test([]byte("data")) {
+		t.Fatal("expanded zero ring holds data")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// Comparison is the structural difference between two rings, as reported by
+// Compare. Rings of differing parameters only hold the parameters of each, and
+// their Differences.
+type Comparison struct {
+	A, B            ComparedRing          // each of the rings compared
+	ParametersEqual bool                  // rings share every parameter, so can be merged
+	Differences     []ParameterDifference // differing parameters, in order of Parameters
+	HammingDistance uint64                // bits active in one ring alone, A.Only + B.Only
+}
+
+// ComparedRing describes one of the rings of a Comparison.
+type ComparedRing struct {
+	Parameters     Parameters // parameters of the ring
+	SetBits        uint64     // number of active bits
+	Only           uint64     // number of bits active in this ring alone
+	EstimatedItems float64    // estimated number of distinct data added, from SetBits
+}
+
+// ParameterDifference is a parameter differing between the rings of a
+// Comparison, formatted for logs.
+type ParameterDifference struct {
+	Field string // name of the field of Parameters, or OneHash
+	A, B  string // value of each ring
+}
+
+// Compare returns the structural difference between the rings: whether their
+// parameters match, field by field, and for rings of equal parameters the
+// active bits of each, those active in one alone, and the data estimated from
+// them. The bits are counted exactly, a word at a time, under a read lock of
+// both rings at once, so the figures are consistent with each other; writers
+// of either wait, while Test does not. Nil and zero Rings compare as rings of
+// zero parameters.
+func Compare(a, b *Ring) Comparison {
+	var c Comparison
+	ab, bb := a.loadSet(), b.loadSet()
+	if a != nil && b != nil && a != b && ab != nil && bb != nil {
+		defer rlockPair(a, b)()
+		// either ring may have been replaced by UnmarshalBinary in the meantime
+		ab, bb = a.set.Load(), b.set.Load()
+	} else if a == b && ab != nil {
+		a.mutex.RLock()
+		defer a.mutex.RUnlock()
+		ab = a.set.Load()
+		bb = ab
+	}
+	c.Differences = differences(ab, bb)
+	c.ParametersEqual = len(c.Differences) == 0
+	if ab != nil {
+		c.A.Parameters = ab.parameters()
+	}
+	if bb != nil {
+		c.B.Parameters = bb.parameters()
+	}
+	if !c.ParametersEqual || ab == nil {
+		return c
+	}
+	for i := range ab.chunks {
+		ac, bc := ab.chunks[i], bb.chunks[i]
+		if ac == nil && bc == nil {
+			continue
+		}
+		start := uint64(i) << chunkShift
+		for off, end := uint64(0), ab.chunkLen(i); off < end; off += 8 {
+			x, y := ab.word(ac, start, off, end), bb.word(bc, start, off, end)
+			c.A.SetBits += uint64(bits.OnesCount64(x))
+			c.B.SetBits += uint64(bits.OnesCount64(y))
+			c.A.Only += uint64(bits.OnesCount64(x &^ y))
+			c.B.Only += uint64(bits.OnesCount64(y &^ x))
+		}
+	}
+	c.HammingDistance = c.A.Only + c.B.Only
+	c.A.EstimatedItems = ab.estimate(float64(c.A.SetBits) / float64(ab.size))
+	c.B.EstimatedItems = bb.estimate(float64(c.B.SetBits) / float64(bb.size))
+	return c
+}
+
+// loadSet returns the bit array of the ring, or nil for a nil or zero Ring.
+func (r *Ring) loadSet() *bitset {
+	if r == nil {
+		return nil
+	}
+	return r.set.Load()
+}
+
+// differences returns the parameters differing between the bitsets, nil
+// standing for zero parameters.
+func differences(a, b *bitset) []ParameterDifference {
+	var pa, pb Parameters
+	var oa, ob bool
+	if a != nil {
+		pa, oa = a.parameters(), a.flags&flagOneHash != 0
+	}
+	if b != nil {
+		pb, ob = b.parameters(), b.flags&flagOneHash != 0
+	}
+	var diffs []ParameterDifference
+	add := func(field string, x, y interface{}) {
+		if x != y {
+			diffs = append(diffs, ParameterDifference{field, fmt.Sprint(x), fmt.Sprint(y)})
+		}
+	}
+	add("Bits", pa.Bits, pb.Bits)
+	add("HashRounds", pa.HashRounds, pb.HashRounds)
+	add("Partitioned", pa.Partitioned, pb.Partitioned)
+	add("PowerOfTwo", pa.PowerOfTwo, pb.PowerOfTwo)
+	add("Blocked", pa.Blocked, pb.Blocked)
+	add("Seed", pa.Seed, pb.Seed)
+	add("OneHash", oa, ob)
+	return diffs
+}
+
+// String returns a summary of the comparison for logs, on a single line, such
+// as
+//
+//	rings differ by 212 bits: a 48712 set (130 only, ~est 5.03k items),
+//	b 48794 set (212 only, ~est 5.04k items)
+//
+// or, for rings of differing parameters,
+//
+//	parameters differ: Bits 958506 != 479253, HashRounds 7 != 6
+func (c Comparison) String() string {
+	if !c.ParametersEqual {
+		var sb strings.Builder
+		sb.WriteString("parameters differ: ")
+		for i, d := range c.Differences {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "%s %s != %s", d.Field, d.A, d.B)
+		}
+		return sb.String()
+	}
+	if c.HammingDistance == 0 {
+		return fmt.Sprintf("rings identical: %d set (~est %s items)", c.A.SetBits, formatCount(c.A.EstimatedItems))
+	}
+	return fmt.Sprintf("rings differ by %d bits: a %s, b %s", c.HammingDistance,
+		c.A.summary(), c.B.summary())
+}
+
+// summary returns the counts of the ring for String.
+func (r ComparedRing) summary() string {
+	return fmt.Sprintf("%d set (%d only, ~est %s items)", r.SetBits, r.Only, formatCount(r.EstimatedItems))
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestCompareIdentical ensures rings holding the same data compare equal, with
+// the counts of each.
+func TestCompareIdentical(t *testing.T) {
+	a, _ := ring.Init(10000, 0.01)
+	b, _ := ring.Init(10000, 0.01)
+	for _, key := range ring.RandomKeys(5000, 1) {
+		a.Add(key)
+		b.Add(key)
+	}
+	c := ring.Compare(a, b)
+	if !c.ParametersEqual || c.Differences != nil || c.HammingDistance != 0 || c.A != c.B {
+		t.Fatalf("unexpected comparison %+v", c)
+	}
+	if want := a.Histogram(1)[0]; c.A.SetBits != want {
+		t.Fatalf("%d active bits, expected %d", c.A.SetBits, want)
+	}
+	if math.Abs(c.A.EstimatedItems-5000) > 100 {
+		t.Fatalf("%g items estimated, expected about 5000", c.A.EstimatedItems)
+	}
+	if self := ring.Compare(a, a); self.HammingDistance != 0 || self.A != c.A || self.B != c.A {
+		t.Fatalf("unexpected comparison with itself %+v", self)
+	}
+	if s := c.String(); !strings.HasPrefix(s, "rings identical: ") {
+		t.Fatalf("unexpected summary %q", s)
+	}
+}
+
+// TestCompareSubset ensures a ring holding a subset of the data of another has
+// no bits of its own, and that the counts agree with HammingDistance.
+func TestCompareSubset(t *testing.T) {
+	a, _ := ring.Init(10000, 0.01, ring.WithFastReset())
+	b, _ := ring.Init(10000, 0.01, ring.WithFastReset())
+	keys := ring.RandomKeys(6000, 2)
+	for i, key := range keys {
+		if i < 2000 {
+			a.Add(key)
+		}
+		b.Add(key)
+	}
+	c := ring.Compare(a, b)
+	distance, _ := ring.HammingDistance(a, b)
+	if c.A.Only != 0 || c.B.Only == 0 || c.HammingDistance != distance || c.B.SetBits-c.A.SetBits != c.B.Only {
+		t.Fatalf("unexpected comparison %+v, distance %d", c, distance)
+	}
+	if c.A.EstimatedItems >= c.B.EstimatedItems {
+		t.Fatalf("subset estimated %g items, superset %g", c.A.EstimatedItems, c.B.EstimatedItems)
+	}
+	if s := c.String(); !strings.HasPrefix(s, "rings differ by ") || !strings.Contains(s, "(0 only") {
+		t.Fatalf("unexpected summary %q", s)
+	}
+	// a reset ring holds nothing of its own either
+	b.Reset()
+	if c := ring.Compare(a, b); c.B.SetBits != 0 || c.A.Only != c.A.SetBits {
+		t.Fatalf("unexpected comparison after Reset %+v", c)
+	}
+}
+
+// TestCompareParameters ensures rings of differing parameters only report the
+// parameters, listing each difference.
+func TestCompareParameters(t *testing.T) {
+	a, _ := ring.Init(10000, 0.01)
+	b, _ := ring.Init(20000, 0.01, ring.WithSeed(7))
+	a.Add([]byte("a"))
+	b.Add([]byte("b"))
+	c := ring.Compare(a, b)
+	var fields []string
+	for _, d := range c.Differences {
+		fields = append(fields, d.Field)
+	}
+	if c.ParametersEqual || !reflect.DeepEqual(fields, []string{"Bits", "Seed"}) {
+		t.Fatalf("unexpected differences %+v", c.Differences)
+	}
+	if c.A.Parameters != a.Parameters() || c.B.Parameters != b.Parameters() ||
+		c.A.SetBits != 0 || c.B.SetBits != 0 || c.HammingDistance != 0 {
+		t.Fatalf("unexpected comparison %+v", c)
+	}
+	if s := c.String(); s != "parameters differ: Bits "+c.Differences[0].A+" != "+c.Differences[0].B+", Seed 0 != 7" {
+		t.Fatalf("unexpected summary %q", s)
+	}
+	one, _ := ring.Init(10000, 0.01, ring.WithPartitioned())
+	two, _ := ring.Init(10000, 0.01, ring.WithPartitioned(), ring.WithOneHash())
+	if c := ring.Compare(one, two); c.Differences[len(c.Differences)-1].Field != "OneHash" {
+		t.Fatalf("unexpected differences %+v", c.Differences)
+	}
+	if c := ring.Compare(a, nil); c.ParametersEqual || c.B.Parameters != (ring.Parameters{}) {
+		t.Fatalf("unexpected comparison with nil %+v", c)
+	}
+	if c := ring.Compare(nil, &ring.Ring{}); !c.ParametersEqual || c.HammingDistance != 0 {
+		t.Fatalf("unexpected comparison of zero rings %+v", c)
+	}
+}
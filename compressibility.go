@@ -0,0 +1,447 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+const (
+	// sparseVersion is the marshaled version of a ring listing its active
+	// bits.
+	sparseVersion = 28
+	// compressedVersion is the marshaled version of a ring compressed with
+	// DEFLATE.
+	compressedVersion = 29
+)
+
+// sparseHeader is the length of the header of a sparse ring: version, flags,
+// seed, size and hash.
+const sparseHeader = 26
+
+// maxExpansion is the largest ratio of the bit array to the data of its
+// sparse form, that of DEFLATE, so neither form claims more memory for the
+// data than compressed data could.
+const maxExpansion = 1032
+
+// ErrSparse is returned by MarshalBinaryFormat for the sparse form of a ring
+// whose bit array is over 1032 times larger, as for a large ring of a fill
+// below about 6e-5. The compressed form suits such rings.
+var ErrSparse = errors.New("error: bit array too large for its sparse form")
+
+const (
+	// hintSpans is the number of spans of the bit array sampled by
+	// CompressibilityHint.
+	hintSpans = 32
+	// hintSpanBytes is the length of each span sampled by
+	// CompressibilityHint, long enough to hold several runs of zero bytes at
+	// the fill of a sparse ring.
+	hintSpanBytes = 2048
+)
+
+// Serialization is a binary form of a ring, as recommended by
+// CompressibilityHint.
+type Serialization int
+
+const (
+	// SerializationDense is the bit array as is, written by MarshalBinary.
+	SerializationDense Serialization = iota
+	// SerializationSparse lists the indices of the active bits, each as a
+	// varint of its distance from the previous one, smallest for rings of a
+	// low fill. The bit array may be at most 1032 times larger, as described
+	// by ErrSparse.
+	SerializationSparse
+	// SerializationCompressed is the dense form compressed with DEFLATE,
+	// smaller than it for rings of a fill far from one half.
+	SerializationCompressed
+)
+
+// String returns the name of the serialization.
+func (s Serialization) String() string {
+	switch s {
+	case SerializationDense:
+		return "dense"
+	case SerializationSparse:
+		return "sparse"
+	case SerializationCompressed:
+		return "compressed"
+	}
+	return fmt.Sprintf("Serialization(%d)", int(s))
+}
+
+// Hint is an estimate of the size of each binary form of a ring, as returned
+// by CompressibilityHint.
+type Hint struct {
+	Fill        float64       // fraction of active bits, sampled
+	Entropy     float64       // zero-order entropy of a bit at the fill, in bits
+	MeanZeroRun float64       // mean length of the runs of zero bytes, sampled
+	Recommended Serialization // form of the smallest estimated size
+
+	DenseSize      int // size of the dense form, exactly
+	SparseSize     int // estimated size of the sparse form, 0 beyond ErrSparse
+	CompressedSize int // estimated size of the compressed form
+}
+
+// Size returns the size of the form s of the hint, or 0 for an unknown form.
+func (h Hint) Size(s Serialization) int {
+	switch s {
+	case SerializationDense:
+		return h.DenseSize
+	case SerializationSparse:
+		return h.SparseSize
+	case SerializationCompressed:
+		return h.CompressedSize
+	}
+	return 0
+}
+
+// CompressibilityHint estimates the size of each binary form of the ring, to
+// choose one without writing them all, as for exporting many rings at once.
+// The fill and the runs of zero bytes are sampled from 32 spans of 2KB spread
+// over the bit array, or from all of it if smaller, under a read lock, so the
+// cost is the same for any size of ring. The sparse size follows from the
+// fill, and the compressed size from the entropy at the fill and the runs, by
+// a model of DEFLATE within about 20% for rings of millions of bits. Rings
+// under a fill of about 0.03 are smallest sparse, and those above about 0.2,
+// such as rings filled to their capacity, dense. A zero Ring returns a zero
+// Hint.
+func (r *Ring) CompressibilityHint() Hint {
+	if r.set.Load() == nil {
+		return Hint{}
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.set.Load().hint()
+}
+
+// hint returns the compressibility hint of the bitset. Writers must be
+// excluded.
+func (b *bitset) hint() Hint {
+	var buf [maxHeader]byte
+	header := len(b.header(&buf))
+	h := Hint{DenseSize: header + int(b.length)}
+
+	ones, total, zeros, continued := b.sampleRuns()
+	h.Fill = float64(ones) / float64(total)
+	p := math.Min(h.Fill, 1-h.Fill)
+	if p > 0 {
+		h.Entropy = -p*math.Log2(p) - (1-p)*math.Log2(1-p)
+	}
+	// the probability a zero byte is followed by another
+	q := 1.0
+	if zeros > 0 {
+		q = float64(continued) / float64(zeros)
+	}
+	h.MeanZeroRun = math.Inf(1)
+	if q < 1 {
+		h.MeanZeroRun = 1 / (1 - q)
+	}
+
+	// each gap between active bits takes a byte per 7 bits, the gaps being
+	// geometric at the fill
+	set := h.Fill * float64(b.size)
+	perGap := 1.0
+	for j := 1; j < 10; j++ {
+		perGap += math.Pow(1-h.Fill, math.Pow(128, float64(j)))
+	}
+	h.SparseSize = sparseHeader + uvarintLen(uint64(set)) + int(math.Ceil(set*perGap))
+	if b.length > maxExpansion*uint64(h.SparseSize) {
+		h.SparseSize = 0
+	}
+
+	h.CompressedSize = compressedSize(float64(b.length), float64(b.size)/8*h.Entropy, p, q) + 1 + header
+	h.Recommended = SerializationDense
+	for _, s := range []Serialization{SerializationSparse, SerializationCompressed} {
+		if size := h.Size(s); size != 0 && size < h.Size(h.Recommended) {
+			h.Recommended = s
+		}
+	}
+	return h
+}
+
+// compressedSize estimates the length of DEFLATE of n bytes of the entropy in
+// bytes, at the lesser fill p of ones and zeros, with zero bytes followed by
+// another at probability q. DEFLATE codes bytes rather than bits, so it
+// exceeds the entropy by a factor growing as the fill drops, fitted to
+// measurements of compress/flate: from 8% at a fill of 0.2 to 80% at 0.001.
+// Runs of zero bytes longer than the 258 bytes of a match take a match of
+// about 12 bits each. Data whose code is within 80% of its length is stored
+// rather than coded, in blocks of 65535 bytes with 5 bytes of header each.
+func compressedSize(n, entropy, p, q float64) int {
+	stored := n + 5*math.Ceil(n/65535) + 2
+	var factor float64
+	if p > 0 {
+		factor = math.Max(1.08, 0.8+0.145*math.Log(1/p))
+	}
+	// the expected number of matches beyond the first of each run
+	extra := n / 258
+	if q < 1 {
+		runs := n * (1 - q)
+		extra = runs * math.Pow(q, 258) / (1 - math.Pow(q, 258))
+	}
+	size := entropy*factor + 1.5*extra + 32
+	if size > 0.8*stored {
+		size = stored
+	}
+	return int(math.Ceil(size))
+}
+
+// sampleRuns returns the active bits and number of bits sampled from the
+// bitset, with the number of zero bytes followed by another byte within the
+// sample, and of those followed by a zero byte. Writers must be excluded.
+func (b *bitset) sampleRuns() (ones, total, zeros, continued uint64) {
+	span, spans := uint64(hintSpanBytes), uint64(hintSpans)
+	if b.length <= span*spans {
+		span, spans = b.length, 1
+	}
+	for i := uint64(0); i < spans; i++ {
+		var start uint64
+		if spans > 1 {
+			start = i * (b.length - span) / (spans - 1)
+		}
+		previous := b.sampleByte(start)
+		ones += uint64(bits.OnesCount8(previous))
+		for j := start + 1; j < start+span; j++ {
+			v := b.sampleByte(j)
+			ones += uint64(bits.OnesCount8(v))
+			if previous == 0 {
+				zeros++
+				if v == 0 {
+					continued++
+				}
+			}
+			previous = v
+		}
+	}
+	total = span * spans * 8
+	if spans == 1 {
+		// bits past size are never set
+		total = b.size
+	}
+	return ones, total, zeros, continued
+}
+
+// sampleByte returns byte i of the logical bit array. A nil chunk, or a block
+// stale with WithFastReset, holds zeros. Writers must be excluded.
+func (b *bitset) sampleByte(i uint64) uint8 {
+	c := b.chunks[i>>chunkShift]
+	if c == nil || b.stamps != nil && !b.fresh(i*8/summaryBlock) {
+		return 0
+	}
+	return atomicLoad(c, i&chunkMask)
+}
+
+// uvarintLen returns the length of the varint of v.
+func uvarintLen(v uint64) int {
+	return (bits.Len64(v|1) + 6) / 7
+}
+
+// MarshalBinaryFormat returns the binary form s of the ring, read by
+// UnmarshalBinary like that of MarshalBinary. The bits are copied under the
+// read lock, as by MarshalBinary; the compressed form is compressed after the
+// lock is released. Forms other than SerializationDense are written with
+// versions earlier releases reject as ErrUnknownVersion. A zero Ring returns
+// ErrUninitialized.
+func (r *Ring) MarshalBinaryFormat(s Serialization) ([]byte, error) {
+	if s < SerializationDense || s > SerializationCompressed {
+		return nil, fmt.Errorf("%w: unknown serialization %d", ErrOptions, int(s))
+	}
+	if r.set.Load() == nil {
+		return nil, ErrUninitialized
+	}
+	r.mutex.RLock()
+	b := r.set.Load()
+	var out []byte
+	if s == SerializationSparse {
+		out = b.marshalSparse()
+	} else {
+		out = b.marshal()
+	}
+	r.mutex.RUnlock()
+	if s == SerializationSparse && b.length > maxExpansion*uint64(len(out)) {
+		return nil, fmt.Errorf("%w: %d bytes in %d", ErrSparse, b.length, len(out))
+	}
+	if s == SerializationCompressed {
+		var buf bytes.Buffer
+		buf.WriteByte(compressedVersion)
+		// writes to a bytes.Buffer never fail
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		w.Write(out)
+		w.Close()
+		out = buf.Bytes()
+	}
+	return r.countMarshaled(out), nil
+}
+
+// MarshalBinaryAuto returns the binary form of the ring recommended by
+// CompressibilityHint, the smallest by its estimates, as MarshalBinaryFormat.
+func (r *Ring) MarshalBinaryAuto() ([]byte, error) {
+	return r.MarshalBinaryFormat(r.CompressibilityHint().Recommended)
+}
+
+// marshalSparse returns the sparse form of the bitset: the header, the number
+// of active bits, and the gap before each as a varint. Writers must be
+// excluded.
+func (b *bitset) marshalSparse() []byte {
+	out := make([]byte, sparseHeader, sparseHeader+binary.MaxVarintLen64)
+	out[0] = sparseVersion
+	out[1] = b.flags
+	binary.BigEndian.PutUint64(out[2:10], b.seed)
+	binary.BigEndian.PutUint64(out[10:18], b.size)
+	binary.BigEndian.PutUint64(out[18:26], b.hash)
+	var indices []uint64
+	for i := range b.chunks {
+		c := b.chunks[i]
+		if c == nil {
+			continue
+		}
+		start := uint64(i) << chunkShift
+		for off, end := uint64(0), b.chunkLen(i); off < end; off += 8 {
+			for w := b.word(c, start, off, end); w != 0; w &= w - 1 {
+				indices = append(indices, (start+off)*8+uint64(bits.TrailingZeros64(w)))
+			}
+		}
+	}
+	out = binary.AppendUvarint(out, uint64(len(indices)))
+	next := uint64(0)
+	for _, index := range indices {
+		out = binary.AppendUvarint(out, index-next)
+		next = index + 1
+	}
+	return out
+}
+
+// decodeRingSparse decodes sparse data, as written by MarshalBinaryFormat,
+// into a bit array. Indices must increase and fall within the ring.
+func decodeRingSparse(data []byte, limit uint64) (params, []byte, error) {
+	if len(data) < sparseHeader+1 {
+		return params{}, nil, fmt.Errorf("%w: incorrect length: %d, expected at least %d",
+			ErrTruncated, len(data), sparseHeader+1)
+	}
+	size := binary.BigEndian.Uint64(data[10:18])
+	p, err := newParams(size, binary.BigEndian.Uint64(data[18:26]), data[1])
+	if err != nil {
+		return params{}, nil, err
+	}
+	p.seed = binary.BigEndian.Uint64(data[2:10])
+	if err := checkMemory(size, limit); err != nil {
+		return params{}, nil, err
+	}
+	if size/8+1 > maxExpansion*uint64(len(data)) {
+		return params{}, nil, fmt.Errorf("%w: bit array of %d bytes from %d bytes", ErrCorrupt, size/8+1, len(data))
+	}
+	data = data[sparseHeader:]
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return params{}, nil, sparseError(n)
+	}
+	if count > size {
+		return params{}, nil, &CorruptError{"count", count}
+	}
+	data = data[n:]
+	out := make([]byte, size/8+1)
+	next := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		gap, n := binary.Uvarint(data)
+		if n <= 0 {
+			return params{}, nil, sparseError(n)
+		}
+		data = data[n:]
+		if gap >= size-next {
+			return params{}, nil, &CorruptError{"index", i}
+		}
+		index := next + gap
+		out[index/8] |= 1 << (index % 8)
+		next = index + 1
+	}
+	if len(data) != 0 {
+		return params{}, nil, fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, len(data))
+	}
+	return p, out, nil
+}
+
+// sparseError returns the error of a varint binary.Uvarint failed to read
+// with n.
+func sparseError(n int) error {
+	if n == 0 {
+		return fmt.Errorf("%w: varint ends early", ErrTruncated)
+	}
+	return fmt.Errorf("%w: varint overflows 64 bits", ErrCorrupt)
+}
+
+// decodeRingCompressed decodes compressed data, as written by
+// MarshalBinaryFormat, by decoding the dense form it holds. The header of the
+// dense form is checked against limit before the rest is decompressed.
+func decodeRingCompressed(data []byte, limit uint64) (params, []byte, error) {
+	// a bytes.Reader is an io.ByteReader, so flate reads no byte past the
+	// stream
+	in := bytes.NewReader(data[1:])
+	fr := flate.NewReader(in)
+	defer fr.Close()
+	header := make([]byte, 1, maxHeader)
+	if _, err := io.ReadFull(fr, header); err != nil {
+		return params{}, nil, inflateError(err)
+	}
+	var length int
+	var decode func([]byte, uint64) (params, []byte, error)
+	switch header[0] {
+	case 1:
+		length, decode = 17, decodeRingV1
+	case 2:
+		length, decode = 18, decodeRingV2
+	case 3:
+		length, decode = 26, decodeRingV3
+	default:
+		return params{}, nil, &CorruptError{"compressed version", uint64(header[0])}
+	}
+	header = header[:length]
+	if _, err := io.ReadFull(fr, header[1:]); err != nil {
+		return params{}, nil, inflateError(err)
+	}
+	var flags uint8
+	if header[0] != 1 {
+		flags = header[1]
+	}
+	size := binary.BigEndian.Uint64(header[length-16 : length-8])
+	if _, err := newParams(size, binary.BigEndian.Uint64(header[length-8:length]), flags); err != nil {
+		return params{}, nil, err
+	}
+	if err := checkMemory(size, limit); err != nil {
+		return params{}, nil, err
+	}
+	// the bit array grows as it is decompressed rather than as its header
+	// claims, so it is bounded by the data
+	dense := bytes.NewBuffer(header)
+	expected := int64(size/8 + 1)
+	n, err := io.Copy(dense, io.LimitReader(fr, expected+1))
+	if err != nil {
+		return params{}, nil, inflateError(err)
+	}
+	if n < expected {
+		return params{}, nil, fmt.Errorf("%w: compressed data ends early", ErrTruncated)
+	}
+	if n > expected {
+		return params{}, nil, fmt.Errorf("%w: trailing compressed data", ErrCorrupt)
+	}
+	if in.Len() != 0 {
+		return params{}, nil, fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, in.Len())
+	}
+	return decode(dense.Bytes(), limit)
+}
+
+// inflateError returns the error of decompressing data that failed with err.
+func inflateError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: compressed data ends early", ErrTruncated)
+	}
+	return fmt.Errorf("%w: %v", ErrCorrupt, err)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestCompressibilityHint fills rings to a low, medium and high fill, ensuring
+// the recommendation moves from sparse to compressed to dense, and that every
+// estimated size is within 20% of the size of the form.
+func TestCompressibilityHint(t *testing.T) {
+	for _, c := range []struct {
+		items int
+		want  ring.Serialization
+	}{
+		{150, ring.SerializationSparse},
+		{11000, ring.SerializationCompressed},
+		{100000, ring.SerializationDense},
+	} {
+		r, _ := ring.Init(100000, 0.01)
+		for _, key := range ring.RandomKeys(c.items, 1) {
+			r.Add(key)
+		}
+		h := r.CompressibilityHint()
+		if h.Recommended != c.want {
+			t.Fatalf("%d items: recommended %v, expected %v: %+v", c.items, h.Recommended, c.want, h)
+		}
+		if fill := r.Stats().Fill; math.Abs(h.Fill-fill) > 0.1*fill {
+			t.Fatalf("%d items: fill %g, expected about %g", c.items, h.Fill, fill)
+		}
+		smallest := math.MaxInt
+		for _, s := range []ring.Serialization{ring.SerializationDense, ring.SerializationSparse, ring.SerializationCompressed} {
+			data, err := r.MarshalBinaryFormat(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if estimate := h.Size(s); math.Abs(float64(estimate-len(data))) > 0.2*float64(len(data)) {
+				t.Fatalf("%d items: %v estimated at %d bytes, actually %d", c.items, s, estimate, len(data))
+			}
+			if len(data) < smallest {
+				smallest = len(data)
+			}
+		}
+		auto, err := r.MarshalBinaryAuto()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(auto) != smallest {
+			t.Fatalf("%d items: automatic form of %d bytes, smallest %d", c.items, len(auto), smallest)
+		}
+		var loaded ring.Ring
+		if err := loaded.UnmarshalBinary(auto); err != nil || !loaded.Equal(r) {
+			t.Fatalf("%d items: automatic form not loaded: %v", c.items, err)
+		}
+	}
+}
+
+// TestSerializationRoundTrip ensures every form loads back to the same ring,
+// for rings of every mode and of stale blocks, and that unknown forms and zero
+// Rings are rejected.
+func TestSerializationRoundTrip(t *testing.T) {
+	for _, opts := range [][]ring.Option{
+		nil,
+		{ring.WithPartitioned(), ring.WithOneHash(), ring.WithPowerOfTwoSize()},
+		{ring.WithBlocked(), ring.WithSeed(42)},
+		{ring.WithFastReset()},
+	} {
+		r, _ := ring.Init(5000, 0.01, opts...)
+		for _, key := range ring.RandomKeys(3000, 2) {
+			r.Add(key)
+		}
+		r.Reset()
+		for _, key := range ring.RandomKeys(500, 3) {
+			r.Add(key)
+		}
+		for _, s := range []ring.Serialization{ring.SerializationDense, ring.SerializationSparse, ring.SerializationCompressed} {
+			data, err := r.MarshalBinaryFormat(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded ring.Ring
+			if err := loaded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("%v: %v", s, err)
+			}
+			if !loaded.Equal(r) || loaded.Parameters() != r.Parameters() {
+				t.Fatalf("%v: loaded ring differs", s)
+			}
+		}
+	}
+	// a large empty ring is far smaller compressed than sparse can hold
+	empty, _ := ring.Init(1000000, 0.01)
+	if _, err := empty.MarshalBinaryFormat(ring.SerializationSparse); !errors.Is(err, ring.ErrSparse) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if h := empty.CompressibilityHint(); h.SparseSize != 0 || h.Recommended != ring.SerializationCompressed {
+		t.Fatalf("unexpected hint of an empty ring %+v", h)
+	}
+	r, _ := ring.Init(100, 0.01)
+	if _, err := r.MarshalBinaryFormat(3); !errors.Is(err, ring.ErrOptions) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var zero ring.Ring
+	if _, err := zero.MarshalBinaryAuto(); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if h := zero.CompressibilityHint(); h != (ring.Hint{}) {
+		t.Fatalf("unexpected hint of a zero Ring %+v", h)
+	}
+	if s := ring.SerializationCompressed.String(); s != "compressed" {
+		t.Fatalf("unexpected name %q", s)
+	}
+}
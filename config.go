@@ -0,0 +1,143 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// defaultElements is the number of elements of a Config without any.
+	defaultElements = 1000000
+	// defaultFalsePositive is the rate of a Config without one.
+	defaultFalsePositive = 0.01
+)
+
+// Modes of a Config, selecting the layout of the ring's bits.
+const (
+	ModeDefault     = "default"     // bits shared by every hash round
+	ModePartitioned = "partitioned" // as WithPartitioned
+	ModeOneHash     = "one-hash"    // as WithOneHash
+	ModeBlocked     = "blocked"     // as WithBlocked
+)
+
+// Config describes a ring in a form suited to configuration files, decoded
+// with encoding/json or a YAML decoder honoring the yaml tags. Zero fields take
+// their defaults, and fields unknown to Config are ignored by the decoders, so
+// a file may hold the settings of several releases.
+type Config struct {
+	// Elements is the number of elements the ring holds within its rate, by
+	// default 1000000.
+	Elements int `json:"elements,omitempty" yaml:"elements,omitempty"`
+	// FalsePositive is the false positive rate once Elements have been added,
+	// by default 0.01.
+	FalsePositive float64 `json:"falsePositive,omitempty" yaml:"falsePositive,omitempty"`
+	// Seed seeds the hash rounds as WithSeed, by default 0 for unseeded.
+	Seed uint64 `json:"seed,omitempty" yaml:"seed,omitempty"`
+	// Mode is one of the Mode constants, by default ModeDefault.
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// MaxMemoryBytes limits the bit array as WithMaxMemory, by default only by
+	// SetDefaultMaxMemory and the platform.
+	MaxMemoryBytes uint64 `json:"maxMemoryBytes,omitempty" yaml:"maxMemoryBytes,omitempty"`
+}
+
+// ConfigError lists every problem found by Config.Validate. It matches each of
+// their errors with errors.Is, such as ErrElements and ErrFalsePositive.
+type ConfigError struct {
+	Problems []error // problems in the order of the fields of Config
+}
+
+// Error implements the error interface.
+func (e *ConfigError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, err := range e.Problems {
+		problems[i] = err.Error()
+	}
+	return "error: invalid config: " + strings.Join(problems, "; ")
+}
+
+// Is returns if any of the problems is target.
+func (e *ConfigError) Is(target error) bool {
+	for _, err := range e.Problems {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns a *ConfigError listing every problem of the config, or nil.
+// Besides the range of each field, the rate of a valid Elements and
+// FalsePositive must be reachable within 64 hash rounds and the platform's
+// limit on the bit array, as with New.
+func (c Config) Validate() error {
+	var problems []error
+	if c.Elements < 0 {
+		problems = append(problems, fmt.Errorf("%w, got %d", ErrElements, c.Elements))
+	}
+	if math.IsNaN(c.FalsePositive) || c.FalsePositive < 0 || c.FalsePositive >= 1 {
+		problems = append(problems, fmt.Errorf("%w, got %g", ErrFalsePositive, c.FalsePositive))
+	}
+	if problems == nil {
+		if _, _, err := optimalParams(uint64(c.elements()), c.falsePositive(), 0); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if _, ok := configModes[c.mode()]; !ok {
+		problems = append(problems, fmt.Errorf("%w: unknown mode %q", ErrOptions, c.Mode))
+	}
+	if problems == nil {
+		return nil
+	}
+	return &ConfigError{problems}
+}
+
+// configModes holds the Options of each mode.
+var configModes = map[string][]Option{
+	ModeDefault:     nil,
+	ModePartitioned: {WithPartitioned()},
+	ModeOneHash:     {WithOneHash()},
+	ModeBlocked:     {WithBlocked()},
+}
+
+// elements returns Elements, or its default.
+func (c Config) elements() int {
+	if c.Elements == 0 {
+		return defaultElements
+	}
+	return c.Elements
+}
+
+// falsePositive returns FalsePositive, or its default.
+func (c Config) falsePositive() float64 {
+	if c.FalsePositive == 0 {
+		return defaultFalsePositive
+	}
+	return c.FalsePositive
+}
+
+// mode returns Mode, or its default.
+func (c Config) mode() string {
+	if c.Mode == "" {
+		return ModeDefault
+	}
+	return c.Mode
+}
+
+// NewFromConfig initializes and returns a new ring as described by the config,
+// or the error of Validate or New.
+func NewFromConfig(c Config) (*Ring, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	opts := append([]Option{WithSeed(c.Seed)}, configModes[c.mode()]...)
+	if c.MaxMemoryBytes != 0 {
+		opts = append(opts, WithMaxMemory(c.MaxMemoryBytes))
+	}
+	return New(c.elements(), c.falsePositive(), opts...)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestNewFromConfig ensures rings built from JSON configs have the parameters
+// of rings built by New from the same settings, with defaults for zero and
+// unknown fields.
+func TestNewFromConfig(t *testing.T) {
+	for _, c := range []struct {
+		json          string
+		elements      int
+		falsePositive float64
+		opts          []ring.Option
+	}{
+		{`{}`, 1000000, 0.01, nil},
+		{`{"elements": 5000, "falsePositive": 0.001}`, 5000, 0.001, nil},
+		{`{"elements": 5000, "mode": "default", "window": "1h", "slices": 4}`, 5000, 0.01, nil},
+		{`{"elements": 5000, "mode": "partitioned"}`, 5000, 0.01, []ring.Option{ring.WithPartitioned()}},
+		{`{"elements": 5000, "mode": "one-hash"}`, 5000, 0.01, []ring.Option{ring.WithOneHash()}},
+		{`{"elements": 5000, "mode": "blocked", "seed": 18446744073709551615}`, 5000, 0.01,
+			[]ring.Option{ring.WithBlocked(), ring.WithSeed(1<<64 - 1)}},
+		{`{"falsePositive": 0.1, "seed": 42, "maxMemoryBytes": 1048576}`, 1000000, 0.1,
+			[]ring.Option{ring.WithSeed(42)}},
+	} {
+		var config ring.Config
+		if err := json.Unmarshal([]byte(c.json), &config); err != nil {
+			t.Fatalf("%s: %v", c.json, err)
+		}
+		r, err := ring.NewFromConfig(config)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.json, err)
+		}
+		want, _ := ring.New(c.elements, c.falsePositive, c.opts...)
+		if r.Parameters() != want.Parameters() {
+			t.Fatalf("%s: parameters %+v, expected %+v", c.json, r.Parameters(), want.Parameters())
+		}
+	}
+}
+
+// TestConfigValidate ensures Validate reports every problem of invalid JSON
+// configs at once, and that NewFromConfig rejects them.
+func TestConfigValidate(t *testing.T) {
+	for _, c := range []struct {
+		json string
+		errs []error
+	}{
+		{`{"elements": -1}`, []error{ring.ErrElements}},
+		{`{"falsePositive": 1.5}`, []error{ring.ErrFalsePositive}},
+		{`{"mode": "sliced"}`, []error{ring.ErrOptions}},
+		{`{"elements": -5, "falsePositive": -0.1, "mode": "Blocked"}`,
+			[]error{ring.ErrElements, ring.ErrFalsePositive, ring.ErrOptions}},
+		{`{"falsePositive": 1e-30}`, []error{ring.ErrHashRounds}},
+		{`{"elements": 1000000, "maxMemoryBytes": 1024}`, []error{ring.ErrTooLarge}},
+	} {
+		var config ring.Config
+		if err := json.Unmarshal([]byte(c.json), &config); err != nil {
+			t.Fatalf("%s: %v", c.json, err)
+		}
+		r, err := ring.NewFromConfig(config)
+		if r != nil || err == nil {
+			t.Fatalf("%s: expected an error", c.json)
+		}
+		for _, want := range c.errs {
+			if !errors.Is(err, want) {
+				t.Fatalf("%s: error %q is not %v", c.json, err, want)
+			}
+		}
+		var configErr *ring.ConfigError
+		if errors.As(err, &configErr) && len(configErr.Problems) != len(c.errs) {
+			t.Fatalf("%s: %d problems, expected %d", c.json, len(configErr.Problems), len(c.errs))
+		}
+	}
+	if err := (ring.Config{}).Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "sync/atomic"
+
+// Metrics holds the number of operations on a ring since EnableCounters or the
+// last ResetMetrics. The sampled tests of WithGroundTruth are counted from the
+// creation of the ring or the last ResetMetrics, with or without
+// EnableCounters. Metrics are not part of the binary form of a ring:
+// MarshalBinary does not write them, and UnmarshalBinary keeps those of the
+// receiver.
+type Metrics struct {
+	Adds           uint64 // data added, whether or not already present
+	Tests          uint64 // data tested
+	Hits           uint64 // data tested and reported present
+	Resets         uint64 // calls of Reset
+	Merges         uint64 // rings merged into the ring
+	BytesMarshaled uint64 // bytes returned by MarshalBinary
+
+	SampledTests   uint64 // tests checked by WithGroundTruth
+	TruePositives  uint64 // sampled tests reporting data added present
+	FalsePositives uint64 // sampled tests reporting data never added present
+}
+
+// counters holds the Metrics of a ring. Rings count nothing until
+// EnableCounters, leaving a single atomic load on the hot paths. The counts are
+// updated with atomic additions, never under a lock, and ResetMetrics replaces
+// the counters as a whole.
+type counters struct {
+	adds      atomic.Uint64
+	tests     atomic.Uint64
+	hits      atomic.Uint64
+	resets    atomic.Uint64
+	merges    atomic.Uint64
+	marshaled atomic.Uint64
+}
+
+// EnableCounters starts counting the operations on the ring reported by
+// Metrics and Stats. Counting costs an atomic addition per operation, a few
+// nanoseconds, and continues for the life of the ring; calls after the first
+// have no effect.
+func (r *Ring) EnableCounters() {
+	if r.counters.Load() == nil {
+		r.counters.CompareAndSwap(nil, new(counters))
+	}
+}
+
+// Metrics returns the number of operations on the ring since EnableCounters or
+// the last ResetMetrics, or zero Metrics if counting is not enabled. Each count
+// is read atomically, and Hits never exceed Tests; operations concurrent with
+// Metrics may be reported in some counts and not yet in others.
+func (r *Ring) Metrics() Metrics {
+	var m Metrics
+	if r.truth != nil {
+		r.truth.fill(&m)
+	}
+	c := r.counters.Load()
+	if c == nil {
+		return m
+	}
+	// hits are read before tests, and counted after them
+	m.Hits = c.hits.Load()
+	m.Adds = c.adds.Load()
+	m.Tests = c.tests.Load()
+	m.Resets = c.resets.Load()
+	m.Merges = c.merges.Load()
+	m.BytesMarshaled = c.marshaled.Load()
+	return m
+}
+
+// ResetMetrics sets the Metrics of the ring to zero, all at once, if counting
+// is enabled, and the sampled tests of WithGroundTruth. Operations concurrent
+// with ResetMetrics are counted either before or after it.
+func (r *Ring) ResetMetrics() {
+	if r.truth != nil {
+		r.truth.resetCounts()
+	}
+	if r.counters.Load() != nil {
+		r.counters.Store(new(counters))
+	}
+}
+
+// countAdds counts n data added to the ring.
+func (r *Ring) countAdds(n uint64) {
+	if c := r.counters.Load(); c != nil {
+		c.adds.Add(n)
+	}
+}
+
+// countTest counts a test of the data of the hash rounds reporting hit, which
+// it returns.
+func (r *Ring) countTest(hash *rounds, hit bool) bool {
+	if r.truth != nil {
+		r.truth.observe(hash, hit)
+	}
+	if c := r.counters.Load(); c != nil {
+		c.tests.Add(1)
+		if hit {
+			c.hits.Add(1)
+		}
+	}
+	return hit
+}
+
+// countReset counts a call of Reset.
+func (r *Ring) countReset() {
+	if c := r.counters.Load(); c != nil {
+		c.resets.Add(1)
+	}
+}
+
+// countMerge counts a ring merged into the ring.
+func (r *Ring) countMerge() {
+	if c := r.counters.Load(); c != nil {
+		c.merges.Add(1)
+	}
+}
+
+// countMarshaled counts n bytes marshaled, returning them.
+func (r *Ring) countMarshaled(out []byte) []byte {
+	if c := r.counters.Load(); c != nil {
+		c.marshaled.Add(uint64(len(out)))
+	}
+	return out
+}
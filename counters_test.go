@@ -0,0 +1,127 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestMetrics ensures Metrics counts the operations of a scripted workload.
+func TestMetrics(t *testing.T) {
+	r, _ := ring.New(1000, 0.001)
+	r.Add([]byte("uncounted"))
+	if m := r.Metrics(); m != (ring.Metrics{}) {
+		t.Fatalf("counted before EnableCounters: %+v", m)
+	}
+	r.EnableCounters()
+	buff := make([]byte, 4)
+	for i := 0; i < 100; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	r.AddHash(ring.NewDigest([]byte("digest")))
+	for i := 0; i < 150; i++ {
+		intToByte(buff, i)
+		r.Test(buff)
+	}
+	r.TestHash(ring.NewDigest([]byte("digest")))
+	other, _ := ring.New(1000, 0.001)
+	r.Merge(other)
+	r.MergeAll(other, other)
+	data, _ := r.MarshalBinary()
+	r.MarshalBinary()
+	r.Reset()
+
+	m := r.Metrics()
+	want := ring.Metrics{Adds: 101, Tests: 151, Hits: m.Hits, Resets: 1, Merges: 3, BytesMarshaled: 2 * uint64(len(data))}
+	if m != want {
+		t.Fatalf("%+v, expected %+v", m, want)
+	}
+	if m.Hits < 101 || m.Hits > 103 {
+		t.Fatalf("%d hits, expected about 101", m.Hits)
+	}
+	if s := r.Stats(); s.Metrics != m {
+		t.Fatalf("Stats holds %+v, expected %+v", s.Metrics, m)
+	}
+
+	// metrics are kept by UnmarshalBinary, and not written by MarshalBinary
+	if err := r.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Metrics(); got != m {
+		t.Fatalf("after UnmarshalBinary: %+v, expected %+v", got, m)
+	}
+	loaded := new(ring.Ring)
+	loaded.UnmarshalBinary(data)
+	if got := loaded.Metrics(); got != (ring.Metrics{}) {
+		t.Fatalf("metrics unmarshaled: %+v", got)
+	}
+
+	r.ResetMetrics()
+	if got := r.Metrics(); got != (ring.Metrics{}) {
+		t.Fatalf("after ResetMetrics: %+v", got)
+	}
+	r.Add([]byte("counted"))
+	if got := r.Metrics(); got.Adds != 1 {
+		t.Fatalf("not counting after ResetMetrics: %+v", got)
+	}
+}
+
+// TestMetricsConcurrent ensures snapshots never report more hits than tests
+// under concurrent Test and ResetMetrics, which the race detector verifies
+// too.
+func TestMetricsConcurrent(t *testing.T) {
+	r, _ := ring.New(1000, 0.01)
+	r.EnableCounters()
+	r.Add([]byte("present"))
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				r.Test([]byte("present"))
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		if m := r.Metrics(); m.Hits > m.Tests {
+			t.Fatalf("%d hits of %d tests", m.Hits, m.Tests)
+		}
+		if i%100 == 0 {
+			r.ResetMetrics()
+		}
+	}
+	wg.Wait()
+}
+
+// BenchmarkCounters compares Add and Test with and without counting, on a ring
+// small enough for the cost of counting not to be lost in cache misses.
+func BenchmarkCounters(b *testing.B) {
+	for _, counted := range []bool{false, true} {
+		r, _ := ring.New(1000, 0.01)
+		name := "uncounted"
+		if counted {
+			r.EnableCounters()
+			name = "counted"
+		}
+		buff := make([]byte, 4)
+		b.Run(name+"/Add", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				intToByte(buff, i&1023)
+				r.Add(buff)
+			}
+		})
+		b.Run(name+"/Test", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				intToByte(buff, i&1023)
+				r.Test(buff)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// countingVersion is the marshaled version of a counting ring, distinct
+	// from the versions of Ring so neither can be unmarshaled as the other.
+	countingVersion = 16
+	// countingPackedVersion is the marshaled version of a counting ring with
+	// counters narrower than a byte, recording their width.
+	countingPackedVersion = 24
+)
+
+// ErrCounterBits is returned by InitCounting given a WithCounterBits width
+// other than 4 or 8.
+var ErrCounterBits = errors.New("error: counter bits must be 4 or 8")
+
+// CountingRing is a counting bloom filter. It shares the hashing and parameter
+// math of Ring, but stores an 8-bit counter per position rather than a bit, so
+// data can be removed again. WithCounterBits(4) packs two 4-bit counters per
+// byte instead, halving the memory.
+//
+// Counters saturate at their maximum, 255 or 15, rather than overflowing. A
+// saturated counter no longer knows its true count, so Remove leaves it
+// untouched: it can never return to zero, and data hashing only to saturated
+// counters tests positive until the ring is Reset. Saturation needs far more
+// additions than a correctly sized ring sees, so it only affects heavily
+// overfilled rings.
+type CountingRing struct {
+	params                 // size, hash rounds and mode
+	bits     uint8         // bits per counter, 4 or 8
+	counters []uint8       // counters, packed into bytes
+	mutex    *sync.RWMutex // mutex for locking all operations
+}
+
+// CountingOption configures the construction of a counting ring.
+type CountingOption func(*countingOptions)
+
+// countingOptions holds the configuration collected from CountingOptions.
+type countingOptions struct {
+	bits int // bits per counter
+}
+
+// WithCounterBits sets the width of each counter to bits, which must be 4 or 8
+// (the default). Four-bit counters saturate at 15, which a correctly sized ring
+// almost never reaches, and take half the memory of 8-bit counters.
+func WithCounterBits(bits int) CountingOption {
+	return func(o *countingOptions) {
+		o.bits = bits
+	}
+}
+
+// InitCounting initializes and returns a new counting ring, or an error. It is
+// sized like Init, for elements within a falsePositive rate, with the sent
+// CountingOptions.
+func InitCounting(elements int, falsePositive float64, opts ...CountingOption) (*CountingRing, error) {
+	o := countingOptions{bits: 8}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var bitsErr error
+	if o.bits != 4 && o.bits != 8 {
+		bitsErr = fmt.Errorf("%w, got %d", ErrCounterBits, o.bits)
+	}
+	n, err := checkArgs(elements, falsePositive)
+	if err := joinErrors(bitsErr, err); err != nil {
+		return nil, err
+	}
+	size, hash, err := optimalParams(n, falsePositive, 0)
+	if err != nil {
+		return nil, err
+	}
+	if counterBytes(size, uint8(o.bits)) > maxLength {
+		return nil, fmt.Errorf("%w: %d counters", ErrTooLarge, size)
+	}
+	return &CountingRing{
+		params:   params{size: size, hash: hash},
+		bits:     uint8(o.bits),
+		counters: make([]uint8, counterBytes(size, uint8(o.bits))),
+		mutex:    &sync.RWMutex{},
+	}, nil
+}
+
+// counterBytes returns the number of bytes holding size counters of bits each.
+func counterBytes(size uint64, bits uint8) uint64 {
+	if bits == 4 {
+		return (size + 1) / 2
+	}
+	return size
+}
+
+// max returns the value at which counters saturate.
+func (c *CountingRing) max() uint8 {
+	return 1<<c.bits - 1
+}
+
+// get returns the counter at index.
+func (c *CountingRing) get(index uint64) uint8 {
+	if c.bits == 4 {
+		// even counters in the low nibble, odd in the high
+		return c.counters[index>>1] >> (index & 1 * 4) & 0x0f
+	}
+	return c.counters[index]
+}
+
+// set stores v, which must fit the counter, in the counter at index.
+func (c *CountingRing) set(index uint64, v uint8) {
+	if c.bits == 4 {
+		shift := index & 1 * 4
+		c.counters[index>>1] = c.counters[index>>1]&^(0x0f<<shift) | v<<shift
+		return
+	}
+	c.counters[index] = v
+}
+
+// Bytes returns the memory used by the counters.
+func (c *CountingRing) Bytes() uint64 {
+	return uint64(len(c.counters))
+}
+
+// Add adds the data to the ring, incrementing its counters.
+func (c *CountingRing) Add(data []byte) {
+	hash := hashRounds(data, 0)
+	c.mutex.Lock()
+	for i := uint64(0); i < c.hash; i++ {
+		index := c.reduce(hash.at(i))
+		if v := c.get(index); v < c.max() {
+			c.set(index, v+1)
+		}
+	}
+	c.mutex.Unlock()
+}
+
+// Remove removes the data from the ring, decrementing its counters. It returns
+// false and leaves the ring untouched if the data is not in the ring, so
+// removing data that was never added cannot cause false negatives. Removing a
+// false positive can, as it decrements counters of other data. Saturated
+// counters are never decremented, as their true count is unknown: decrementing
+// one could bring it to zero while other data still hashes to it, causing a
+// false negative.
+func (c *CountingRing) Remove(data []byte) bool {
+	hash := hashRounds(data, 0)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.test(&hash) {
+		return false
+	}
+	for i := uint64(0); i < c.hash; i++ {
+		index := c.reduce(hash.at(i))
+		if v := c.get(index); v < c.max() {
+			c.set(index, v-1)
+		}
+	}
+	return true
+}
+
+// Test returns a bool if the data is in the ring. True indicates that the data
+// may be in the ring, while false indicates that the data is not in the ring.
+func (c *CountingRing) Test(data []byte) bool {
+	hash := hashRounds(data, 0)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.test(&hash)
+}
+
+// test returns if every counter of the hash rounds is non-zero.
+func (c *CountingRing) test(hash *rounds) bool {
+	for i := uint64(0); i < c.hash; i++ {
+		if c.get(c.reduce(hash.at(i))) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// EstimateCount returns an estimate of the number of times the data was added,
+// less the times it was removed: the smallest of its counters, as each counter
+// also counts any other data sharing it. The error is one-sided: the estimate
+// never falls below the true count, except that counters saturate at 255, or 15
+// with 4-bit counters, which caps every estimate.
+func (c *CountingRing) EstimateCount(data []byte) uint64 {
+	hash := hashRounds(data, 0)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	min := c.max()
+	for i := uint64(0); i < c.hash; i++ {
+		if v := c.get(c.reduce(hash.at(i))); v < min {
+			min = v
+		}
+	}
+	return uint64(min)
+}
+
+// TestAtLeast returns a bool if the data may have been added at least n times.
+// False indicates that the data was added fewer than n times, while true may be
+// caused by other data sharing its counters. For n above the saturation value
+// it is only true if every counter of the data is saturated.
+func (c *CountingRing) TestAtLeast(data []byte, n uint64) bool {
+	if max := uint64(c.max()); n > max {
+		n = max
+	}
+	return c.EstimateCount(data) >= n
+}
+
+// Reset clears the ring.
+func (c *CountingRing) Reset() {
+	c.mutex.Lock()
+	for i := range c.counters {
+		c.counters[i] = 0
+	}
+	c.mutex.Unlock()
+}
+
+// halve halves every counter n times, rounding down. It must be called with
+// the mutex held.
+func (c *CountingRing) halve(n uint64) {
+	if n > uint64(c.bits) {
+		// every counter reaches zero
+		n = uint64(c.bits)
+	}
+	for i, v := range c.counters {
+		if c.bits == 4 {
+			// halve each nibble on its own, so no bit crosses between them
+			c.counters[i] = v&0x0f>>n | v>>4>>n<<4
+		} else {
+			c.counters[i] = v >> n
+		}
+	}
+}
+
+// Merge adds the counters of the sent CountingRing to its own, saturating
+// rather than overflowing, so data added to either ring can be removed from
+// the result once for each time it was added. The rings must have the same
+// parameters and counter width. Merging a CountingRing into itself is a no-op.
+func (c *CountingRing) Merge(m *CountingRing) error {
+	if c == nil || m == nil {
+		return ErrNilRing
+	}
+	if c == m {
+		return nil
+	}
+	if err := c.compatible(m.params); err != nil {
+		return err
+	}
+	if c.bits != m.bits {
+		return &IncompatibleError{"counter bits", uint64(c.bits), uint64(m.bits)}
+	}
+	// lock in address order, as in Ring.MergeContext
+	if uintptr(unsafe.Pointer(c)) < uintptr(unsafe.Pointer(m)) {
+		c.mutex.Lock()
+		m.mutex.RLock()
+	} else {
+		m.mutex.RLock()
+		c.mutex.Lock()
+	}
+	defer c.mutex.Unlock()
+	defer m.mutex.RUnlock()
+	max := uint(c.max())
+	for i := uint64(0); i < c.size; i++ {
+		if sum := uint(c.get(i)) + uint(m.get(i)); sum < max {
+			c.set(i, uint8(sum))
+		} else {
+			c.set(i, uint8(max))
+		}
+	}
+	return nil
+}
+
+// EstimateCardinality returns an estimate of the number of distinct data in the
+// ring, from the fraction of non-zero counters (Swamidass and Baldi).
+func (c *CountingRing) EstimateCardinality() uint64 {
+	c.mutex.RLock()
+	var set float64
+	for i := uint64(0); i < c.size; i++ {
+		if c.get(i) != 0 {
+			set++
+		}
+	}
+	c.mutex.RUnlock()
+	m, k := float64(c.size), float64(c.hash)
+	if set >= m {
+		// every counter is set, so the ring is beyond any estimate
+		return math.MaxUint64
+	}
+	return uint64(math.Round(-m / k * math.Log(1-set/m)))
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. Rings of
+// 8-bit counters are marshaled as before 4-bit counters were supported, while
+// 4-bit rings record the width in a byte following the version.
+func (c *CountingRing) MarshalBinary() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.bits == 8 {
+		out := make([]byte, len(c.counters)+17)
+		out[0] = countingVersion
+		binary.BigEndian.PutUint64(out[1:9], c.size)
+		binary.BigEndian.PutUint64(out[9:17], c.hash)
+		copy(out[17:], c.counters)
+		return out, nil
+	}
+	out := make([]byte, len(c.counters)+18)
+	out[0] = countingPackedVersion
+	out[1] = c.bits
+	binary.BigEndian.PutUint64(out[2:10], c.size)
+	binary.BigEndian.PutUint64(out[10:18], c.hash)
+	copy(out[18:], c.counters)
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (c *CountingRing) UnmarshalBinary(data []byte) error {
+	if len(data) < 17 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	bits := uint8(8)
+	switch data[0] {
+	case countingVersion:
+		data = data[1:]
+	case countingPackedVersion:
+		if len(data) < 18 {
+			return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+		}
+		if bits = data[1]; bits != 4 {
+			return &CorruptError{"counter bits", uint64(bits)}
+		}
+		data = data[2:]
+	default:
+		return versionError(data[0])
+	}
+	size := binary.BigEndian.Uint64(data[0:8])
+	hash := binary.BigEndian.Uint64(data[8:16])
+	if size == 0 {
+		return &CorruptError{"size", size}
+	}
+	if hash == 0 || hash > maxHash {
+		return &CorruptError{"hash", hash}
+	}
+	if err := checkData(uint64(len(data)-16), counterBytes(size, bits)); err != nil {
+		return err
+	}
+	counters := make([]uint8, len(data)-16)
+	copy(counters, data[16:])
+	if bits == 4 && size%2 == 1 && counters[len(counters)-1]>>4 != 0 {
+		// the unused high nibble of an odd number of counters
+		return &CorruptError{"padding", uint64(counters[len(counters)-1])}
+	}
+
+	if c.mutex == nil {
+		c.mutex = &sync.RWMutex{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.params = params{size: size, hash: hash}
+	c.bits = bits
+	c.counters = counters
+	return nil
+}
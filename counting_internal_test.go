@@ -0,0 +1,58 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestCountingNibbles sets counters of a 4-bit ring at random against an
+// oracle, ensuring no counter disturbs the other half of its byte, including
+// the unpaired last counter of an odd size.
+func TestCountingNibbles(t *testing.T) {
+	for _, size := range []uint64{1, 2, 7, 64} {
+		c := &CountingRing{params: params{size: size, hash: 1}, bits: 4,
+			counters: make([]uint8, counterBytes(size, 4))}
+		want := make([]uint8, size)
+		rng := rand.New(rand.NewSource(int64(size)))
+		for n := 0; n < 10000; n++ {
+			i, v := uint64(rng.Intn(int(size))), uint8(rng.Intn(16))
+			c.set(i, v)
+			want[i] = v
+			for j := range want {
+				if got := c.get(uint64(j)); got != want[j] {
+					t.Fatalf("size %d: counter %d is %d after setting %d to %d, want %d",
+						size, j, got, i, v, want[j])
+				}
+			}
+		}
+		if size%2 == 1 && c.counters[len(c.counters)-1]>>4 != 0 {
+			t.Fatalf("size %d: padding nibble written", size)
+		}
+	}
+}
+
+// TestCountingHalveNibbles ensures halving 4-bit counters shifts no bit from
+// the high counter of a byte into the low one.
+func TestCountingHalveNibbles(t *testing.T) {
+	c := &CountingRing{params: params{size: 2, hash: 1}, bits: 4, counters: make([]uint8, 1)}
+	for lo := uint8(0); lo < 16; lo++ {
+		for hi := uint8(0); hi < 16; hi++ {
+			for n := uint64(0); n <= 5; n++ {
+				c.set(0, lo)
+				c.set(1, hi)
+				c.halve(n)
+				shift := n
+				if shift > 4 {
+					shift = 4
+				}
+				if c.get(0) != lo>>shift || c.get(1) != hi>>shift {
+					t.Fatalf("halving %d,%d %d times gave %d,%d", lo, hi, n, c.get(0), c.get(1))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,344 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// BenchmarkCountingAdd tests adding elements to a CountingRing.
+func BenchmarkCountingAdd(b *testing.B) {
+	c, _ := ring.InitCounting(tests, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		c.Add(buff)
+	}
+}
+
+// TestCountingCycles adds, removes and re-adds data, ensuring membership
+// follows each step.
+func TestCountingCycles(t *testing.T) {
+	c, _ := ring.InitCounting(10000, fpRate)
+	buff := make([]byte, 4)
+	for cycle := 0; cycle < 3; cycle++ {
+		for i := 0; i < 10000; i++ {
+			intToByte(buff, i)
+			c.Add(buff)
+		}
+		for i := 0; i < 10000; i++ {
+			intToByte(buff, i)
+			if !c.Test(buff) {
+				t.Fatalf("cycle %d: data %d missing", cycle, i)
+			}
+		}
+		// remove the even half
+		for i := 0; i < 10000; i += 2 {
+			intToByte(buff, i)
+			if !c.Remove(buff) {
+				t.Fatalf("cycle %d: data %d not removed", cycle, i)
+			}
+		}
+		fp := 0
+		for i := 0; i < 10000; i++ {
+			intToByte(buff, i)
+			found := c.Test(buff)
+			if i%2 == 1 && !found {
+				t.Fatalf("cycle %d: data %d missing after removing others", cycle, i)
+			}
+			if i%2 == 0 && found {
+				fp++
+			}
+		}
+		if float64(fp)/5000 > fpRate*5 {
+			t.Fatalf("cycle %d: %d removed data still present", cycle, fp)
+		}
+		for i := 1; i < 10000; i += 2 {
+			intToByte(buff, i)
+			c.Remove(buff)
+		}
+	}
+}
+
+// TestCountingRemoveAbsent ensures removing data never added leaves other data
+// in the ring.
+func TestCountingRemoveAbsent(t *testing.T) {
+	c, _ := ring.InitCounting(1000, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		c.Add(buff)
+	}
+	for i := 1000; i < 100000; i++ {
+		intToByte(buff, i)
+		found := c.Test(buff)
+		if c.Remove(buff) != found {
+			t.Fatalf("Remove of %d disagrees with Test", i)
+		}
+		if found {
+			// a false positive, whose removal is allowed to cause misses
+			c.Add(buff)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		if !c.Test(buff) {
+			t.Fatalf("data %d missing", i)
+		}
+	}
+}
+
+// TestCountingSaturation ensures counters stick at their maximum, so data
+// added more times than a counter holds is never removed.
+func TestCountingSaturation(t *testing.T) {
+	c, _ := ring.InitCounting(100, fpRate)
+	data := []byte("saturated")
+	for i := 0; i < 300; i++ {
+		c.Add(data)
+	}
+	for i := 0; i < 300; i++ {
+		c.Remove(data)
+	}
+	if !c.Test(data) {
+		t.Fatal("saturated counters decremented")
+	}
+	c.Reset()
+	if c.Test(data) {
+		t.Fatal("data present after Reset")
+	}
+}
+
+// TestCountingSaturationNibble ensures 4-bit counters saturate at 15, leaving
+// saturated counters in place on Remove, while counts below 15 are removed
+// exactly.
+func TestCountingSaturationNibble(t *testing.T) {
+	c, err := ring.InitCounting(100, fpRate, ring.WithCounterBits(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("saturated")
+	for i := 0; i < 20; i++ {
+		c.Add(data)
+	}
+	if n := c.EstimateCount(data); n != 15 {
+		t.Fatalf("saturated count %d, want 15", n)
+	}
+	if !c.TestAtLeast(data, 100) {
+		t.Fatal("saturated data below cap")
+	}
+	for i := 0; i < 20; i++ {
+		c.Remove(data)
+	}
+	if !c.Test(data) {
+		t.Fatal("saturated counters decremented")
+	}
+	c.Reset()
+	for i := 0; i < 14; i++ {
+		c.Add(data)
+	}
+	for i := 0; i < 14; i++ {
+		if !c.Remove(data) {
+			t.Fatalf("removal %d failed", i)
+		}
+	}
+	if c.Test(data) {
+		t.Fatal("data present after removing each addition")
+	}
+}
+
+// TestCountingNibbleMemory ensures 4-bit counters take half the memory of
+// 8-bit counters, and behave the same below saturation.
+func TestCountingNibbleMemory(t *testing.T) {
+	c8, _ := ring.InitCounting(10000, fpRate)
+	c4, _ := ring.InitCounting(10000, fpRate, ring.WithCounterBits(4))
+	if c4.Bytes() != (c8.Bytes()+1)/2 {
+		t.Fatalf("4-bit counters use %d bytes, 8-bit %d", c4.Bytes(), c8.Bytes())
+	}
+	buff := make([]byte, 4)
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		c8.Add(buff)
+		c4.Add(buff)
+	}
+	for i := 0; i < 20000; i++ {
+		intToByte(buff, i)
+		if c8.Test(buff) != c4.Test(buff) || c8.EstimateCount(buff) != c4.EstimateCount(buff) {
+			t.Fatalf("data %d differs between counter widths", i)
+		}
+	}
+	if _, err := ring.InitCounting(100, fpRate, ring.WithCounterBits(5)); err == nil {
+		t.Fatal("invalid counter bits not captured")
+	}
+	if c8.Merge(c4) == nil {
+		t.Fatal("merge of counter widths not captured")
+	}
+}
+
+func TestCountingMerge(t *testing.T) {
+	a, _ := ring.InitCounting(1000, fpRate)
+	b, _ := ring.InitCounting(1000, fpRate)
+	a.Add([]byte("a"))
+	b.Add([]byte("a"))
+	b.Add([]byte("b"))
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Test([]byte("b")) {
+		t.Fatal("merged data missing")
+	}
+	// added twice across both rings, so removable twice
+	a.Remove([]byte("a"))
+	if !a.Test([]byte("a")) {
+		t.Fatal("merged counters not summed")
+	}
+	a.Remove([]byte("a"))
+	if a.Test([]byte("a")) {
+		t.Fatal("data present after removing each addition")
+	}
+	if err := a.Merge(a); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := ring.InitCounting(2000, fpRate)
+	if a.Merge(c) == nil || a.Merge(nil) == nil {
+		t.Fatal("incompatible merge not captured")
+	}
+}
+
+func TestCountingMarshal(t *testing.T) {
+	c, _ := ring.InitCounting(1000, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		c.Add(buff)
+	}
+	data, _ := c.MarshalBinary()
+	var c2 ring.CountingRing
+	if err := c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		if !c2.Test(buff) || !c2.Remove(buff) {
+			t.Fatalf("data %d missing after unmarshal", i)
+		}
+	}
+	// rings and counting rings cannot be unmarshaled as each other
+	var r ring.Ring
+	if r.UnmarshalBinary(data) == nil {
+		t.Fatal("counting ring unmarshaled as a ring")
+	}
+	if err := c2.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("truncated data not captured")
+	}
+}
+
+// TestCountingMarshalNibble ensures 4-bit counters round trip, keeping their
+// width and counts.
+func TestCountingMarshalNibble(t *testing.T) {
+	c, _ := ring.InitCounting(1001, fpRate, ring.WithCounterBits(4))
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		c.Add(buff)
+		c.Add(buff)
+	}
+	data, _ := c.MarshalBinary()
+	var c2 ring.CountingRing
+	if err := c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if c2.Bytes() != c.Bytes() {
+		t.Fatalf("unmarshaled %d bytes, want %d", c2.Bytes(), c.Bytes())
+	}
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		if c2.EstimateCount(buff) < 2 {
+			t.Fatalf("data %d lost its count after unmarshal", i)
+		}
+	}
+	if err := c.Merge(&c2); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("truncated data not captured")
+	}
+	data[1] = 5
+	var corrupt *ring.CorruptError
+	if err := c2.UnmarshalBinary(data); !errors.As(err, &corrupt) || corrupt.Field != "counter bits" || corrupt.Value != 5 {
+		t.Fatalf("invalid counter bits not captured: %v", err)
+	}
+}
+
+func TestCountingCardinality(t *testing.T) {
+	c, _ := ring.InitCounting(100000, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < 50000; i++ {
+		intToByte(buff, i)
+		c.Add(buff)
+		// duplicates do not count
+		c.Add(buff)
+	}
+	if n := c.EstimateCardinality(); n < 49000 || n > 51000 {
+		t.Fatalf("estimated %d distinct elements, want about 50000", n)
+	}
+}
+
+// TestCountingEstimate adds keys with known multiplicities among heavily skewed
+// background traffic, ensuring estimates never fall below the truth and stay
+// close for the heavy keys.
+func TestCountingEstimate(t *testing.T) {
+	c, _ := ring.InitCounting(10000, fpRate)
+	buff := make([]byte, 4)
+	// skewed background: key i added 1 + 1000/(i+1) times
+	for i := 0; i < 5000; i++ {
+		intToByte(buff, i)
+		for j := 0; j < 1+1000/(i+1); j++ {
+			c.Add(buff)
+		}
+	}
+	for i := 0; i < 5000; i++ {
+		intToByte(buff, i)
+		truth := uint64(1 + 1000/(i+1))
+		if truth > 255 {
+			truth = 255
+		}
+		if est := c.EstimateCount(buff); est < truth {
+			t.Fatalf("key %d estimated %d, added %d times", i, est, truth)
+		}
+	}
+	for _, n := range []uint64{1, 5, 100} {
+		data := []byte(fmt.Sprintf("multiplicity-%d", n))
+		for i := uint64(0); i < n; i++ {
+			c.Add(data)
+		}
+		est := c.EstimateCount(data)
+		if est < n {
+			t.Fatalf("estimated %d, added %d times", est, n)
+		}
+		if n >= 5 && float64(est) > float64(n)*1.5 {
+			t.Fatalf("estimated %d, added %d times", est, n)
+		}
+		if !c.TestAtLeast(data, n) {
+			t.Fatalf("TestAtLeast(%d) false", n)
+		}
+	}
+	// saturated keys cap the estimate
+	for i := 0; i < 300; i++ {
+		c.Add([]byte("saturated"))
+	}
+	if est := c.EstimateCount([]byte("saturated")); est != 255 {
+		t.Fatalf("saturated key estimated %d", est)
+	}
+	if !c.TestAtLeast([]byte("saturated"), 1000) {
+		t.Fatal("saturated key below 1000")
+	}
+	if c.EstimateCount([]byte("absent")) != 0 && !c.Test([]byte("absent")) {
+		t.Fatal("absent key estimated above 0")
+	}
+}
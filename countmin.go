@@ -0,0 +1,257 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+)
+
+// countMinVersion is the marshaled version of a count-min sketch.
+const countMinVersion = 25
+
+var (
+	// ErrEpsilon is returned by InitCountMin given an epsilon that is not
+	// between 0 and 1.
+	ErrEpsilon = errors.New("error: epsilon must be greater than 0 and less than 1")
+	// ErrDelta is returned by InitCountMin given a delta that is not between 0
+	// and 1.
+	ErrDelta = errors.New("error: delta must be greater than 0 and less than 1")
+)
+
+// CountMin is a count-min sketch, estimating how many times each data was
+// updated. It holds depth rows of width counters, and each update increments
+// one counter per row, selected by the same hash rounds as Ring, so a Digest
+// feeds both a ring and a sketch with a single hash.
+//
+// Estimates never fall below the true count. Sized for epsilon and delta, an
+// estimate exceeds the true count by more than epsilon times the total of all
+// updates with a probability of at most delta.
+type CountMin struct {
+	params                     // width (size) and depth (hash) of the sketch
+	conservative bool          // only raise counters below the new estimate
+	counts       []uint64      // depth rows of width counters
+	mutex        *sync.RWMutex // mutex for locking all operations
+}
+
+// CountMinOption configures the construction of a count-min sketch.
+type CountMinOption func(*countMinOptions)
+
+// countMinOptions holds the configuration collected from CountMinOptions.
+type countMinOptions struct {
+	conservative bool // use conservative update
+}
+
+// WithConservativeUpdate makes each update raise only the counters of the data
+// that are below its new estimate, rather than incrementing all of them. This
+// lowers the overestimation of infrequent data sharing counters with frequent
+// data, at the cost of reading every counter before writing.
+func WithConservativeUpdate() CountMinOption {
+	return func(o *countMinOptions) {
+		o.conservative = true
+	}
+}
+
+// InitCountMin initializes and returns a new count-min sketch, or an error. It
+// is sized with ceil(e/epsilon) counters per row and ceil(ln(1/delta)) rows,
+// with the sent CountMinOptions.
+func InitCountMin(epsilon, delta float64, opts ...CountMinOption) (*CountMin, error) {
+	var problems []error
+	if !(epsilon > 0 && epsilon < 1) {
+		problems = append(problems, fmt.Errorf("%w, got %g", ErrEpsilon, epsilon))
+	}
+	if !(delta > 0 && delta < 1) {
+		problems = append(problems, fmt.Errorf("%w, got %g", ErrDelta, delta))
+	}
+	if err := joinErrors(problems...); err != nil {
+		return nil, err
+	}
+	o := countMinOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	width := math.Ceil(math.E / epsilon)
+	depth := math.Ceil(math.Log(1 / delta))
+	if width*depth*8 > float64(maxLength) {
+		return nil, fmt.Errorf("%w: %.0f counters", ErrTooLarge, width*depth)
+	}
+	return &CountMin{
+		params:       params{size: uint64(width), hash: uint64(depth)},
+		conservative: o.conservative,
+		counts:       make([]uint64, uint64(width*depth)),
+		mutex:        &sync.RWMutex{},
+	}, nil
+}
+
+// Update increments the count of the data.
+func (c *CountMin) Update(data []byte) {
+	hash := c.rounds(data)
+	c.mutex.Lock()
+	c.update(&hash)
+	c.mutex.Unlock()
+}
+
+// UpdateWithDigest increments the count of the data of the digest, like Update
+// without hashing the data again.
+func (c *CountMin) UpdateWithDigest(d Digest) {
+	hash := d.rounds(&c.params)
+	c.mutex.Lock()
+	c.update(&hash)
+	c.mutex.Unlock()
+}
+
+// update increments the counters of the hash rounds. It must be called with
+// the mutex held.
+func (c *CountMin) update(hash *rounds) {
+	if !c.conservative {
+		for i := uint64(0); i < c.hash; i++ {
+			c.counts[i*c.size+c.index(hash, i)]++
+		}
+		return
+	}
+	next := c.estimate(hash) + 1
+	for i := uint64(0); i < c.hash; i++ {
+		if j := i*c.size + c.index(hash, i); c.counts[j] < next {
+			c.counts[j] = next
+		}
+	}
+}
+
+// Estimate returns an estimate of the number of times the data was updated:
+// the smallest of its counters, as each counter also counts any other data
+// sharing it.
+func (c *CountMin) Estimate(data []byte) uint64 {
+	hash := c.rounds(data)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.estimate(&hash)
+}
+
+// EstimateWithDigest returns an estimate of the number of times the data of the
+// digest was updated, like Estimate without hashing the data again.
+func (c *CountMin) EstimateWithDigest(d Digest) uint64 {
+	hash := d.rounds(&c.params)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.estimate(&hash)
+}
+
+// estimate returns the smallest counter of the hash rounds.
+func (c *CountMin) estimate(hash *rounds) uint64 {
+	min := uint64(math.MaxUint64)
+	for i := uint64(0); i < c.hash; i++ {
+		if v := c.counts[i*c.size+c.index(hash, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// Reset clears the sketch.
+func (c *CountMin) Reset() {
+	c.mutex.Lock()
+	for i := range c.counts {
+		c.counts[i] = 0
+	}
+	c.mutex.Unlock()
+}
+
+// Merge adds the counters of the sent CountMin to its own, so estimates of the
+// result cover the updates of both. The sketches must have the same width and
+// depth, and may differ in conservative update: sums of counters never fall
+// below the summed true counts either way. Merging a CountMin into itself is a
+// no-op.
+func (c *CountMin) Merge(m *CountMin) error {
+	if c == nil || m == nil {
+		return ErrNilRing
+	}
+	if c == m {
+		return nil
+	}
+	if c.size != m.size {
+		return &IncompatibleError{"width", c.size, m.size}
+	}
+	if c.hash != m.hash {
+		return &IncompatibleError{"depth", c.hash, m.hash}
+	}
+	// lock in address order, as in Ring.MergeContext
+	if uintptr(unsafe.Pointer(c)) < uintptr(unsafe.Pointer(m)) {
+		c.mutex.Lock()
+		m.mutex.RLock()
+	} else {
+		m.mutex.RLock()
+		c.mutex.Lock()
+	}
+	defer c.mutex.Unlock()
+	defer m.mutex.RUnlock()
+	for i, v := range m.counts {
+		c.counts[i] += v
+	}
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (c *CountMin) MarshalBinary() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make([]byte, 18, 18+len(c.counts)*8)
+	out[0] = countMinVersion
+	if c.conservative {
+		out[1] = 1
+	}
+	binary.BigEndian.PutUint64(out[2:10], c.size)
+	binary.BigEndian.PutUint64(out[10:18], c.hash)
+	for _, v := range c.counts {
+		out = binary.BigEndian.AppendUint64(out, v)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (c *CountMin) UnmarshalBinary(data []byte) error {
+	if len(data) < 18 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != countMinVersion {
+		return versionError(data[0])
+	}
+	if data[1] > 1 {
+		return &CorruptError{"flags", uint64(data[1])}
+	}
+	width := binary.BigEndian.Uint64(data[2:10])
+	depth := binary.BigEndian.Uint64(data[10:18])
+	cells := uint64(len(data)-18) / 8
+	// divide rather than multiply, so the header cannot overflow the check
+	if width == 0 {
+		return &CorruptError{"width", width}
+	}
+	if depth == 0 {
+		return &CorruptError{"depth", depth}
+	}
+	if width > cells/depth {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if err := checkData(uint64(len(data)), 18+width*depth*8); err != nil {
+		return err
+	}
+	counts := make([]uint64, width*depth)
+	for i := range counts {
+		counts[i] = binary.BigEndian.Uint64(data[18+i*8:])
+	}
+
+	if c.mutex == nil {
+		c.mutex = &sync.RWMutex{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.params = params{size: width, hash: depth}
+	c.conservative = data[1] == 1
+	c.counts = counts
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// BenchmarkCountMinUpdate tests updating a CountMin.
+func BenchmarkCountMinUpdate(b *testing.B) {
+	c, _ := ring.InitCountMin(0.001, 0.01)
+	buff := make([]byte, 4)
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		c.Update(buff)
+	}
+}
+
+// BenchmarkDigestRingCountMin tests feeding a Ring and a CountMin from one
+// digest.
+func BenchmarkDigestRingCountMin(b *testing.B) {
+	r, _ := ring.Init(tests, fpRate)
+	c, _ := ring.InitCountMin(0.001, 0.01)
+	buff := make([]byte, 4)
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		d := ring.NewDigest(buff)
+		r.AddHash(d)
+		c.UpdateWithDigest(d)
+	}
+}
+
+// zipfStream returns n updates drawn from a Zipfian distribution over keys,
+// with the true count of each key.
+func zipfStream(n, keys int) ([]int, map[int]uint64) {
+	z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, uint64(keys-1))
+	stream := make([]int, n)
+	counts := make(map[int]uint64)
+	for i := range stream {
+		stream[i] = int(z.Uint64())
+		counts[stream[i]]++
+	}
+	return stream, counts
+}
+
+// TestCountMinZipf ensures estimates over a Zipfian stream never fall below
+// the true counts, and exceed them by more than epsilon times the stream
+// length for at most a delta fraction of keys, with and without conservative
+// update. Conservative estimates must never exceed the standard ones.
+func TestCountMinZipf(t *testing.T) {
+	const epsilon, delta = 0.001, 0.01
+	stream, counts := zipfStream(200000, 50000)
+	c, _ := ring.InitCountMin(epsilon, delta)
+	cc, _ := ring.InitCountMin(epsilon, delta, ring.WithConservativeUpdate())
+	buff := make([]byte, 4)
+	for _, key := range stream {
+		intToByte(buff, key)
+		c.Update(buff)
+		cc.Update(buff)
+	}
+	bound := uint64(epsilon * float64(len(stream)))
+	var over, overConservative, total, totalConservative uint64
+	for key, count := range counts {
+		intToByte(buff, key)
+		est, estConservative := c.Estimate(buff), cc.Estimate(buff)
+		if est < count || estConservative < count {
+			t.Fatalf("key %d: estimates %d, %d below count %d", key, est, estConservative, count)
+		}
+		if estConservative > est {
+			t.Fatalf("key %d: conservative estimate %d above %d", key, estConservative, est)
+		}
+		if est-count > bound {
+			over++
+		}
+		if estConservative-count > bound {
+			overConservative++
+		}
+		total += est - count
+		totalConservative += estConservative - count
+	}
+	if float64(over) > delta*float64(len(counts)) || float64(overConservative) > delta*float64(len(counts)) {
+		t.Fatalf("%d and %d of %d keys beyond the error bound", over, overConservative, len(counts))
+	}
+	if totalConservative >= total {
+		t.Fatalf("conservative update did not lower the error: %d, %d", totalConservative, total)
+	}
+}
+
+// TestCountMinMergeMarshal ensures merged sketches sum their counts and
+// sketches round trip through marshaling.
+func TestCountMinMergeMarshal(t *testing.T) {
+	a, _ := ring.InitCountMin(0.01, 0.01)
+	b, _ := ring.InitCountMin(0.01, 0.01, ring.WithConservativeUpdate())
+	for i := 0; i < 3; i++ {
+		a.Update([]byte("a"))
+	}
+	for i := 0; i < 4; i++ {
+		b.Update([]byte("a"))
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.Estimate([]byte("a")); n < 7 {
+		t.Fatalf("merged estimate %d, want at least 7", n)
+	}
+	if err := a.Merge(a); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := ring.InitCountMin(0.001, 0.01)
+	if a.Merge(c) == nil || a.Merge(nil) == nil {
+		t.Fatal("incompatible merge not captured")
+	}
+
+	data, _ := b.MarshalBinary()
+	var b2 ring.CountMin
+	if err := b2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if b2.Estimate([]byte("a")) != b.Estimate([]byte("a")) {
+		t.Fatal("estimate changed after unmarshal")
+	}
+	if again, _ := b2.MarshalBinary(); !bytes.Equal(again, data) {
+		t.Fatal("sketch changed by marshaling")
+	}
+	if b2.UnmarshalBinary(data[:len(data)-1]) == nil {
+		t.Fatal("truncated data not captured")
+	}
+	// a header claiming more counters than the data holds
+	data[9] = 0xff
+	if b2.UnmarshalBinary(data) == nil {
+		t.Fatal("oversized header not captured")
+	}
+	if _, err := ring.InitCountMin(0, 0.01); err == nil {
+		t.Fatal("invalid epsilon not captured")
+	}
+	if _, err := ring.InitCountMin(0.01, 1); err == nil {
+		t.Fatal("invalid delta not captured")
+	}
+}
+
+// TestDigest ensures a digest answers like its data, in every mode of Ring,
+// and that one digest feeds both a Ring and a CountMin.
+func TestDigest(t *testing.T) {
+	modes := [][]ring.Option{
+		nil,
+		{ring.WithPowerOfTwoSize()},
+		{ring.WithPartitioned()},
+		{ring.WithOneHash()},
+		{ring.WithFastReset()},
+	}
+	buff := make([]byte, 4)
+	for m, opts := range modes {
+		byData, _ := ring.Init(1000, fpRate, opts...)
+		byDigest, _ := ring.Init(1000, fpRate, opts...)
+		c, _ := ring.InitCountMin(0.01, 0.01)
+		for i := 0; i < 1000; i++ {
+			intToByte(buff, i)
+			d := ring.NewDigest(buff)
+			byData.Add(buff)
+			byDigest.AddHash(d)
+			c.UpdateWithDigest(d)
+		}
+		for i := 0; i < 5000; i++ {
+			intToByte(buff, i)
+			d := ring.NewDigest(buff)
+			if byData.Test(buff) != byDigest.TestHash(d) || byDigest.Test(buff) != byData.TestHash(d) {
+				t.Fatalf("mode %d: data %d differs between data and digest", m, i)
+			}
+			if c.Estimate(buff) != c.EstimateWithDigest(d) {
+				t.Fatalf("mode %d: estimate of %d differs between data and digest", m, i)
+			}
+			if i < 1000 && c.Estimate(buff) == 0 {
+				t.Fatalf("mode %d: data %d not counted", m, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// replicatedVersion is the marshaled version of a replicated ring.
+const replicatedVersion = 27
+
+// ErrReplica is returned by InitReplicated given an empty or overlong replica
+// ID.
+var ErrReplica = errors.New("error: replica ID must be 1 to 65535 bytes")
+
+// ReplicatedRing is a Ring replicated across peers as a state-based CRDT. Each
+// replica has an ID, and a version vector counting the additions of every
+// replica it has seen: Add advances the count of its own replica, and Merge
+// takes the pointwise maximum of both vectors along with the union of the
+// bits. Merges are idempotent, commutative and associative, so replicas
+// exchanging their state in any order, any number of times, converge.
+//
+// The version vector lets Merge skip a replica whose additions are all known:
+// if every count of the argument is at most that of the receiver, it holds no
+// bit the receiver lacks, and Merge returns at once without touching the bits.
+type ReplicatedRing struct {
+	replica string            // ID of the replica
+	ring    *Ring             // bits of the replica
+	mutex   sync.RWMutex      // guards vector
+	vector  map[string]uint64 // additions seen, by replica ID
+}
+
+// InitReplicated initializes and returns a new replicated ring of the replica
+// ID, sized like Init, or an error. Replicas merged together must share every
+// parameter and Option, and hold distinct IDs.
+func InitReplicated(replica string, elements int, falsePositive float64, opts ...Option) (*ReplicatedRing, error) {
+	if len(replica) == 0 || len(replica) > math.MaxUint16 {
+		return nil, fmt.Errorf("%w, got %d bytes", ErrReplica, len(replica))
+	}
+	r, err := Init(elements, falsePositive, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplicatedRing{replica: replica, ring: r, vector: make(map[string]uint64)}, nil
+}
+
+// Replica returns the ID of the replica.
+func (r *ReplicatedRing) Replica() string {
+	return r.replica
+}
+
+// Ring returns the ring holding the bits of the replica, for reads such as
+// Stats. Writes to it bypass the version vector, so Merge may skip them.
+func (r *ReplicatedRing) Ring() *Ring {
+	return r.ring
+}
+
+// Add adds the data to the ring, and advances the count of the replica.
+func (r *ReplicatedRing) Add(data []byte) {
+	r.ring.Add(data)
+	// counted once the bits are set, so a vector never claims missing bits
+	r.mutex.Lock()
+	r.vector[r.replica]++
+	r.mutex.Unlock()
+}
+
+// Test returns the result of Test of the ring.
+func (r *ReplicatedRing) Test(data []byte) bool {
+	return r.ring.Test(data)
+}
+
+// Version returns a copy of the version vector of the replica: the number of
+// additions of each replica it has seen, by replica ID.
+func (r *ReplicatedRing) Version() map[string]uint64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	vector := make(map[string]uint64, len(r.vector))
+	for id, n := range r.vector {
+		vector[id] = n
+	}
+	return vector
+}
+
+// dominates returns if every count of vector is at most that of the replica.
+// The read lock must be held.
+func (r *ReplicatedRing) dominates(vector map[string]uint64) bool {
+	for id, n := range vector {
+		if n > r.vector[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge merges the sent replica into itself, taking the union of their bits
+// and the pointwise maximum of their version vectors. If the version vector of
+// m is dominated by that of the receiver, Merge returns nil without merging
+// the bits. Rings of other parameters return an error matching
+// ErrIncompatible, leaving the receiver untouched.
+func (r *ReplicatedRing) Merge(m *ReplicatedRing) error {
+	if r == m {
+		return nil
+	}
+	// the vector of m is read before its bits, so it never claims more
+	vector := m.Version()
+	r.mutex.RLock()
+	skip := r.dominates(vector)
+	r.mutex.RUnlock()
+	if skip {
+		return nil
+	}
+	if err := r.ring.Merge(m.ring); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for id, n := range vector {
+		if n > r.vector[id] {
+			r.vector[id] = n
+		}
+	}
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The replica
+// ID and version vector precede the binary form of the ring.
+func (r *ReplicatedRing) MarshalBinary() ([]byte, error) {
+	r.mutex.RLock()
+	ids := make([]string, 0, len(r.vector))
+	for id := range r.vector {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	out := make([]byte, 1, 7+len(r.replica))
+	out[0] = replicatedVersion
+	out = appendReplica(out, r.replica)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(ids)))
+	for _, id := range ids {
+		out = appendReplica(out, id)
+		out = binary.BigEndian.AppendUint64(out, r.vector[id])
+	}
+	r.mutex.RUnlock()
+	// marshaled after the vector, so it never claims missing bits
+	data, err := r.ring.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	out = binary.BigEndian.AppendUint64(out, uint64(len(data)))
+	return append(out, data...), nil
+}
+
+// appendReplica appends the replica ID to out, prefixed by its length.
+func appendReplica(out []byte, id string) []byte {
+	out = binary.BigEndian.AppendUint16(out, uint16(len(id)))
+	return append(out, id...)
+}
+
+// readReplica reads a replica ID prefixed by its length from data, returning
+// it with the rest of data.
+func readReplica(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	n := int(binary.BigEndian.Uint16(data[0:2]))
+	if len(data) < 2+n {
+		return "", nil, fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	return string(data[2 : 2+n]), data[2+n:], nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It must
+// not be called concurrently with other methods.
+func (r *ReplicatedRing) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != replicatedVersion {
+		return versionError(data[0])
+	}
+	replica, data, err := readReplica(data[1:])
+	if err != nil {
+		return err
+	}
+	if len(replica) == 0 {
+		return &CorruptError{"replica", 0}
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	entries := binary.BigEndian.Uint32(data[0:4])
+	data = data[4:]
+	vector := make(map[string]uint64)
+	for i := uint32(0); i < entries; i++ {
+		var id string
+		if id, data, err = readReplica(data); err != nil {
+			return err
+		}
+		if len(data) < 8 {
+			return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+		}
+		if _, ok := vector[id]; ok || len(id) == 0 {
+			return &CorruptError{"vector", uint64(i)}
+		}
+		vector[id] = binary.BigEndian.Uint64(data[0:8])
+		data = data[8:]
+	}
+	if len(data) < 8 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	length := binary.BigEndian.Uint64(data[0:8])
+	data = data[8:]
+	if length > uint64(len(data)) {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if length < uint64(len(data)) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, uint64(len(data))-length)
+	}
+	ring := &Ring{}
+	if err := ring.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.replica, r.ring, r.vector = replica, ring, vector
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// replicas returns three replicas after a random sequence of additions and
+// merges between them.
+func replicas(t *testing.T, rnd *rand.Rand) []*ring.ReplicatedRing {
+	var rs []*ring.ReplicatedRing
+	for _, id := range []string{"a", "b", "c"} {
+		r, err := ring.InitReplicated(id, 1000, 0.01)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs = append(rs, r)
+	}
+	for i := 0; i < 200; i++ {
+		if rnd.Intn(4) == 0 {
+			if err := rs[rnd.Intn(3)].Merge(rs[rnd.Intn(3)]); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			rs[rnd.Intn(3)].Add([]byte(fmt.Sprint(rnd.Intn(500))))
+		}
+	}
+	return rs
+}
+
+// cloneReplica returns a copy of the replica.
+func cloneReplica(t *testing.T, r *ring.ReplicatedRing) *ring.ReplicatedRing {
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ring.ReplicatedRing{}
+	if err := c.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// merged returns a copy of r with each of rs merged into it in order.
+func merged(t *testing.T, r *ring.ReplicatedRing, rs ...*ring.ReplicatedRing) *ring.ReplicatedRing {
+	c := cloneReplica(t, r)
+	for _, m := range rs {
+		if err := c.Merge(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// sameState returns if the replicas hold the same bits and version vector.
+func sameState(a, b *ring.ReplicatedRing) bool {
+	return a.Ring().Equal(b.Ring()) && reflect.DeepEqual(a.Version(), b.Version())
+}
+
+// TestReplicatedLaws ensures Merge is idempotent, commutative and associative
+// over replicas of random operation sequences.
+func TestReplicatedLaws(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		rs := replicas(t, rnd)
+		a, b, c := rs[0], rs[1], rs[2]
+		if !sameState(merged(t, a, a), a) || !sameState(merged(t, a, b, b), merged(t, a, b)) {
+			t.Fatalf("seed %d: merge is not idempotent", seed)
+		}
+		if !sameState(merged(t, a, b), merged(t, b, a)) {
+			t.Fatalf("seed %d: merge is not commutative", seed)
+		}
+		if !sameState(merged(t, merged(t, a, b), c), merged(t, a, merged(t, b, c))) {
+			t.Fatalf("seed %d: merge is not associative", seed)
+		}
+	}
+}
+
+// TestReplicatedConverge ensures replicas converge once each has merged the
+// others, holding every addition.
+func TestReplicatedConverge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	rs := replicas(t, rnd)
+	var added uint64
+	for _, r := range rs {
+		added += r.Version()[r.Replica()]
+	}
+	for _, r := range rs {
+		for _, m := range rs {
+			if err := r.Merge(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, r := range rs[:2] {
+		if err := r.Merge(rs[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var total uint64
+	for _, n := range rs[0].Version() {
+		total += n
+	}
+	if total != added {
+		t.Fatalf("vector counts %d additions, expected %d", total, added)
+	}
+	for _, r := range rs[1:] {
+		if !sameState(r, rs[0]) {
+			t.Fatalf("replica %s did not converge", r.Replica())
+		}
+	}
+}
+
+// TestReplicatedDominated ensures Merge skips a replica whose additions are all
+// known, and merges otherwise.
+func TestReplicatedDominated(t *testing.T) {
+	a, _ := ring.InitReplicated("a", 100, 0.01)
+	b, _ := ring.InitReplicated("b", 100, 0.01)
+	b.Add([]byte("x"))
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Test([]byte("x")) || a.Version()["b"] != 1 {
+		t.Fatal("expected merge of b")
+	}
+	// bits written to the ring directly bypass the vector, so are skipped
+	b.Ring().Add([]byte("y"))
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Test([]byte("y")) {
+		t.Fatal("expected dominated merge to be skipped")
+	}
+	b.Add([]byte("z"))
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Test([]byte("y")) || !a.Test([]byte("z")) {
+		t.Fatal("expected merge of b")
+	}
+}
+
+// TestReplicatedIncompatible ensures replicas of other parameters are
+// rejected.
+func TestReplicatedIncompatible(t *testing.T) {
+	a, _ := ring.InitReplicated("a", 100, 0.01)
+	b, _ := ring.InitReplicated("b", 1000, 0.01)
+	b.Add([]byte("x"))
+	if err := a.Merge(b); !errors.Is(err, ring.ErrIncompatible) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(a.Version()) != 0 {
+		t.Fatal("expected vector to be untouched")
+	}
+	if _, err := ring.InitReplicated("", 100, 0.01); !errors.Is(err, ring.ErrReplica) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestReplicatedMarshal ensures the replica ID, version vector and bits
+// survive a round trip, and that truncated data is rejected.
+func TestReplicatedMarshal(t *testing.T) {
+	rs := replicas(t, rand.New(rand.NewSource(2)))
+	c := cloneReplica(t, rs[0])
+	if c.Replica() != "a" || !sameState(c, rs[0]) {
+		t.Fatal("round trip changed the replica")
+	}
+	data, _ := rs[0].MarshalBinary()
+	for _, n := range []int{0, 1, 5, len(data) / 2, len(data) - 1} {
+		if err := c.UnmarshalBinary(data[:n]); !errors.Is(err, ring.ErrTruncated) {
+			t.Fatalf("length %d: unexpected error %v", n, err)
+		}
+	}
+	if err := c.UnmarshalBinary(append(data, 0)); !errors.Is(err, ring.ErrCorrupt) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var r ring.Ring
+	if err := r.UnmarshalBinary(data); !errors.Is(err, ring.ErrBadVersion) || errors.Is(err, ring.ErrUnknownVersion) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
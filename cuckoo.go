@@ -0,0 +1,328 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+const (
+	// cuckooVersion is the marshaled version of a cuckoo filter.
+	cuckooVersion = 18
+	// cuckooKicks is the number of relocations attempted before a filter is
+	// considered full.
+	cuckooKicks = 500
+)
+
+var (
+	// ErrFull is returned when data cannot be added to a full Cuckoo or
+	// Quotient filter.
+	ErrFull = errors.New("error: filter is full")
+
+	// ErrFingerprintBits is returned by InitCuckoo given fingerprintBits that
+	// are not between 1 and 32.
+	ErrFingerprintBits = errors.New("error: fingerprintBits must be between 1 and 32")
+	// ErrBucketSize is returned by InitCuckoo given a bucketSize that is not
+	// between 1 and 8.
+	ErrBucketSize = errors.New("error: bucketSize must be between 1 and 8")
+)
+
+// Cuckoo is a cuckoo filter (Fan et al.), which supports deletion and needs
+// less space than a bloom filter at low false positive rates. Each data is
+// stored as a fingerprint in one of two candidate buckets; when both are full,
+// resident fingerprints are relocated to their alternate bucket. The false
+// positive rate is at most 2*bucketSize/2^fingerprintBits.
+//
+// A fingerprint that cannot be placed after a bounded number of relocations is
+// kept aside rather than dropped, so the filter never has false negatives;
+// further Adds return ErrFull until a Delete makes room.
+type Cuckoo struct {
+	fingerprint uint          // bits per fingerprint
+	bucketSize  uint64        // fingerprints per bucket
+	buckets     uint64        // number of buckets, a power of two
+	table       []uint64      // packed fingerprints, 0 for an empty slot
+	count       uint64        // number of stored fingerprints
+	victim      uint64        // fingerprint that could not be placed, or 0
+	victimIndex uint64        // bucket of the victim
+	seed        uint64        // state for choosing fingerprints to relocate
+	mutex       *sync.RWMutex // mutex for locking all operations
+}
+
+// InitCuckoo initializes and returns a new cuckoo filter for elements, or an
+// error. fingerprintBits (1-32) determines the false positive rate, and
+// bucketSize (1-8) the fingerprints per bucket; 12 and 4 give a rate below 0.2%
+// at load factors up to 95%. The buckets are sized to hold elements at a 95%
+// load factor, rounded up to a power of two.
+func InitCuckoo(elements, fingerprintBits, bucketSize int) (*Cuckoo, error) {
+	_, err := elementCount(elements)
+	problems := []error{err}
+	if fingerprintBits < 1 || fingerprintBits > 32 {
+		problems = append(problems, fmt.Errorf("%w, got %d", ErrFingerprintBits, fingerprintBits))
+	}
+	if bucketSize < 1 || bucketSize > 8 {
+		problems = append(problems, fmt.Errorf("%w, got %d", ErrBucketSize, bucketSize))
+	}
+	if err := joinErrors(problems...); err != nil {
+		return nil, err
+	}
+	buckets := uint64(math.Ceil(float64(elements) / 0.95 / float64(bucketSize)))
+	if buckets < 2 {
+		buckets = 2
+	}
+	buckets = 1 << bits.Len64(buckets-1)
+	c := &Cuckoo{
+		fingerprint: uint(fingerprintBits),
+		bucketSize:  uint64(bucketSize),
+		buckets:     buckets,
+		seed:        1,
+		mutex:       &sync.RWMutex{},
+	}
+	c.table = make([]uint64, (c.slots()*uint64(c.fingerprint)+63)/64)
+	return c, nil
+}
+
+// slots returns the number of fingerprint slots.
+func (c *Cuckoo) slots() uint64 {
+	return c.buckets * c.bucketSize
+}
+
+// slot returns the fingerprint in slot i.
+func (c *Cuckoo) slot(i uint64) uint64 {
+	bit := i * uint64(c.fingerprint)
+	word, shift := bit/64, bit%64
+	v := c.table[word] >> shift
+	if shift+uint64(c.fingerprint) > 64 {
+		v |= c.table[word+1] << (64 - shift)
+	}
+	return v & (1<<c.fingerprint - 1)
+}
+
+// setSlot stores the fingerprint f in slot i.
+func (c *Cuckoo) setSlot(i, f uint64) {
+	mask := uint64(1)<<c.fingerprint - 1
+	bit := i * uint64(c.fingerprint)
+	word, shift := bit/64, bit%64
+	c.table[word] = c.table[word]&^(mask<<shift) | f<<shift
+	if shift+uint64(c.fingerprint) > 64 {
+		c.table[word+1] = c.table[word+1]&^(mask>>(64-shift)) | f>>(64-shift)
+	}
+}
+
+// locate returns the fingerprint and first candidate bucket of data.
+func (c *Cuckoo) locate(data []byte) (uint64, uint64) {
+	hash := generateMultiHash(data)
+	f := hash[1] & (1<<c.fingerprint - 1)
+	if f == 0 {
+		// 0 marks an empty slot
+		f = 1
+	}
+	return f, hash[0] & (c.buckets - 1)
+}
+
+// alternate returns the other candidate bucket of the fingerprint f in bucket
+// i. It is its own inverse, so either bucket leads to the other.
+func (c *Cuckoo) alternate(i, f uint64) uint64 {
+	return (i ^ fmix(f*murmur64c1)) & (c.buckets - 1)
+}
+
+// insert stores f in bucket i if it has an empty slot.
+func (c *Cuckoo) insert(i, f uint64) bool {
+	for s := i * c.bucketSize; s < (i+1)*c.bucketSize; s++ {
+		if c.slot(s) == 0 {
+			c.setSlot(s, f)
+			c.count++
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns if bucket i holds f.
+func (c *Cuckoo) contains(i, f uint64) bool {
+	for s := i * c.bucketSize; s < (i+1)*c.bucketSize; s++ {
+		if c.slot(s) == f {
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes one copy of f from bucket i.
+func (c *Cuckoo) remove(i, f uint64) bool {
+	for s := i * c.bucketSize; s < (i+1)*c.bucketSize; s++ {
+		if c.slot(s) == f {
+			c.setSlot(s, 0)
+			c.count--
+			return true
+		}
+	}
+	return false
+}
+
+// place stores f in bucket i or its alternate, relocating resident
+// fingerprints if both are full. A fingerprint that cannot be placed becomes
+// the victim.
+func (c *Cuckoo) place(i, f uint64) {
+	if c.insert(i, f) || c.insert(c.alternate(i, f), f) {
+		return
+	}
+	for kick := 0; kick < cuckooKicks; kick++ {
+		// xorshift, to pick the slot to relocate
+		c.seed ^= c.seed << 13
+		c.seed ^= c.seed >> 7
+		c.seed ^= c.seed << 17
+		s := i*c.bucketSize + c.seed%c.bucketSize
+		evicted := c.slot(s)
+		c.setSlot(s, f)
+		f, i = evicted, c.alternate(i, evicted)
+		if c.insert(i, f) {
+			return
+		}
+	}
+	c.victim, c.victimIndex = f, i
+}
+
+// Add adds the data to the filter. It returns ErrFull, leaving the filter
+// unchanged, if a previous Add could not be placed and no room has been made
+// since.
+func (c *Cuckoo) Add(data []byte) error {
+	f, i := c.locate(data)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.victim != 0 {
+		return ErrFull
+	}
+	c.place(i, f)
+	return nil
+}
+
+// Test returns a bool if the data is in the filter. True indicates that the
+// data may be in the filter, while false indicates that the data is not in the
+// filter.
+func (c *Cuckoo) Test(data []byte) bool {
+	f, i := c.locate(data)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	j := c.alternate(i, f)
+	if c.victim == f && (c.victimIndex == i || c.victimIndex == j) {
+		return true
+	}
+	return c.contains(i, f) || c.contains(j, f)
+}
+
+// Delete removes one copy of the data from the filter, returning false if it
+// is not in the filter. Only data that was added may be deleted: deleting a
+// false positive removes the fingerprint of other data.
+func (c *Cuckoo) Delete(data []byte) bool {
+	f, i := c.locate(data)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	j := c.alternate(i, f)
+	if c.victim == f && (c.victimIndex == i || c.victimIndex == j) {
+		c.victim = 0
+		return true
+	}
+	if !c.remove(i, f) && !c.remove(j, f) {
+		return false
+	}
+	if c.victim != 0 {
+		// retry the victim now there is room
+		f, i := c.victim, c.victimIndex
+		c.victim = 0
+		c.place(i, f)
+	}
+	return true
+}
+
+// Reset clears the filter.
+func (c *Cuckoo) Reset() {
+	c.mutex.Lock()
+	for i := range c.table {
+		c.table[i] = 0
+	}
+	c.count, c.victim = 0, 0
+	c.mutex.Unlock()
+}
+
+// LoadFactor returns the fraction of slots holding a fingerprint.
+func (c *Cuckoo) LoadFactor() float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	count := c.count
+	if c.victim != 0 {
+		count++
+	}
+	return float64(count) / float64(c.slots())
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (c *Cuckoo) MarshalBinary() ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	out := make([]byte, 43+len(c.table)*8)
+	out[0] = cuckooVersion
+	out[1] = uint8(c.fingerprint)
+	out[2] = uint8(c.bucketSize)
+	binary.BigEndian.PutUint64(out[3:11], c.buckets)
+	binary.BigEndian.PutUint64(out[11:19], c.count)
+	binary.BigEndian.PutUint64(out[19:27], c.victim)
+	binary.BigEndian.PutUint64(out[27:35], c.victimIndex)
+	binary.BigEndian.PutUint64(out[35:43], c.seed)
+	for i, w := range c.table {
+		binary.BigEndian.PutUint64(out[43+i*8:], w)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (c *Cuckoo) UnmarshalBinary(data []byte) error {
+	if len(data) < 43 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != cuckooVersion {
+		return versionError(data[0])
+	}
+	n := Cuckoo{
+		fingerprint: uint(data[1]),
+		bucketSize:  uint64(data[2]),
+		buckets:     binary.BigEndian.Uint64(data[3:11]),
+		count:       binary.BigEndian.Uint64(data[11:19]),
+		victim:      binary.BigEndian.Uint64(data[19:27]),
+		victimIndex: binary.BigEndian.Uint64(data[27:35]),
+		seed:        binary.BigEndian.Uint64(data[35:43]),
+	}
+	if n.fingerprint < 1 || n.fingerprint > 32 {
+		return ErrFingerprintBits
+	}
+	if n.bucketSize < 1 || n.bucketSize > 8 {
+		return ErrBucketSize
+	}
+	if n.buckets < 2 || n.buckets&(n.buckets-1) != 0 || n.buckets > uint64(len(data)) ||
+		n.victimIndex >= n.buckets || n.victim>>n.fingerprint != 0 || n.seed == 0 {
+		return fmt.Errorf("%w: unexpected header", ErrCorrupt)
+	}
+	words := (n.slots()*uint64(n.fingerprint) + 63) / 64
+	if err := checkData(uint64(len(data)), 43+words*8); err != nil {
+		return err
+	}
+	n.table = make([]uint64, words)
+	for i := range n.table {
+		n.table[i] = binary.BigEndian.Uint64(data[43+i*8:])
+	}
+
+	if c.mutex == nil {
+		c.mutex = &sync.RWMutex{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n.mutex = c.mutex
+	*c = n
+	return nil
+}
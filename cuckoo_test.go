@@ -0,0 +1,168 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// BenchmarkCuckooAdd tests adding elements to a Cuckoo filter.
+func BenchmarkCuckooAdd(b *testing.B) {
+	c, _ := ring.InitCuckoo(b.N, 12, 4)
+	buff := make([]byte, 4)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		c.Add(buff)
+	}
+}
+
+// fillCuckoo adds elements until the filter is full, returning the number
+// added before Add returned ErrFull.
+func fillCuckoo(t *testing.T, c *ring.Cuckoo) int {
+	buff := make([]byte, 4)
+	for i := 0; ; i++ {
+		intToByte(buff, i)
+		if err := c.Add(buff); errors.Is(err, ring.ErrFull) {
+			return i
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestCuckooLoad fills the filter, ensuring it reaches a 95% load factor
+// without false negatives, and measures the false positive rate against
+// theory.
+func TestCuckooLoad(t *testing.T) {
+	const fingerprint, bucket = 12, 4
+	c, _ := ring.InitCuckoo(100000, fingerprint, bucket)
+	added := fillCuckoo(t, c)
+	if load := c.LoadFactor(); load < 0.95 {
+		t.Fatalf("full at load factor %f", load)
+	}
+	buff := make([]byte, 4)
+	for i := 0; i < added; i++ {
+		intToByte(buff, i)
+		if !c.Test(buff) {
+			t.Fatalf("data %d missing", i)
+		}
+	}
+	fp := 0
+	const probes = 1000000
+	for i := added; i < added+probes; i++ {
+		intToByte(buff, i)
+		if c.Test(buff) {
+			fp++
+		}
+	}
+	// each probe compares against 2*bucket fingerprints at the load factor
+	theory := 1 - math.Pow(1-1/math.Pow(2, fingerprint), 2*bucket*c.LoadFactor())
+	if rate := float64(fp) / probes; rate > theory*1.2 || rate < theory*0.8 {
+		t.Fatalf("false positive rate %f, theory %f", rate, theory)
+	}
+}
+
+func TestCuckooDelete(t *testing.T) {
+	c, _ := ring.InitCuckoo(10000, 16, 4)
+	buff := make([]byte, 4)
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		if err := c.Add(buff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10000; i += 2 {
+		intToByte(buff, i)
+		if !c.Delete(buff) {
+			t.Fatalf("data %d not deleted", i)
+		}
+	}
+	present := 0
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		found := c.Test(buff)
+		if i%2 == 1 && !found {
+			t.Fatalf("data %d missing after deleting others", i)
+		}
+		if i%2 == 0 && found {
+			present++
+		}
+	}
+	if present > 10 {
+		t.Fatalf("%d deleted data still present", present)
+	}
+	// duplicates are stored and deleted once each
+	c.Add([]byte("twice"))
+	c.Add([]byte("twice"))
+	c.Delete([]byte("twice"))
+	if !c.Test([]byte("twice")) {
+		t.Fatal("second copy missing")
+	}
+	c.Delete([]byte("twice"))
+	if c.Test([]byte("twice")) || c.Delete([]byte("twice")) {
+		t.Fatal("deleted data present")
+	}
+}
+
+// TestCuckooFullDelete ensures a Delete makes room once the filter is full.
+func TestCuckooFullDelete(t *testing.T) {
+	c, _ := ring.InitCuckoo(1000, 12, 4)
+	added := fillCuckoo(t, c)
+	buff := make([]byte, 4)
+	intToByte(buff, 0)
+	if !c.Delete(buff) {
+		t.Fatal("data not deleted")
+	}
+	for i := 1; i < added; i++ {
+		intToByte(buff, i)
+		if !c.Test(buff) {
+			t.Fatalf("data %d missing", i)
+		}
+	}
+	if err := c.Add([]byte("room")); err != nil && !errors.Is(err, ring.ErrFull) {
+		t.Fatal(err)
+	}
+}
+
+func TestCuckooMarshal(t *testing.T) {
+	for _, fingerprint := range []int{7, 12, 32} {
+		c, _ := ring.InitCuckoo(1000, fingerprint, 4)
+		added := fillCuckoo(t, c)
+		data, _ := c.MarshalBinary()
+		var c2 ring.Cuckoo
+		if err := c2.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		buff := make([]byte, 4)
+		for i := 0; i < added; i++ {
+			intToByte(buff, i)
+			if !c2.Test(buff) {
+				t.Fatalf("data %d missing after unmarshal", i)
+			}
+		}
+		if data2, _ := c2.MarshalBinary(); !bytes.Equal(data, data2) {
+			t.Fatal("marshaled data changed")
+		}
+		for _, n := range []int{0, 42, len(data) - 1} {
+			if c2.UnmarshalBinary(data[:n]) == nil {
+				t.Fatalf("truncation to %d bytes not captured", n)
+			}
+		}
+	}
+}
+
+func TestCuckooParameters(t *testing.T) {
+	for _, p := range [][3]int{{0, 12, 4}, {100, 0, 4}, {100, 33, 4}, {100, 12, 0}, {100, 12, 9}} {
+		if _, err := ring.InitCuckoo(p[0], p[1], p[2]); err == nil {
+			t.Fatalf("parameters %v not captured", p)
+		}
+	}
+}
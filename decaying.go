@@ -0,0 +1,114 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DecayingCounting is a counting bloom filter whose counters decay over time,
+// for questions like "seen more than n times in the last hour". It stores its
+// counters in a CountingRing, and every half-life each counter is halved,
+// rounding down, so counts of data that stops being added fade out rather than
+// expiring all at once.
+//
+// Decay is applied lazily: each call first applies the halvings due since the
+// last one according to the clock, so no background goroutine is needed.
+// Decay may also be called directly to halve the counters at times of the
+// caller's choosing.
+type DecayingCounting struct {
+	counting *CountingRing    // counters, and the mutex for all operations
+	halfLife time.Duration    // time between halvings, 0 for none
+	clock    func() time.Time // source of the current time
+	next     atomic.Int64     // unix nanoseconds of the next halving
+	start    time.Time        // time from which halvings are scheduled
+	steps    uint64           // number of scheduled halvings applied
+}
+
+// InitDecaying initializes and returns a new decaying counting ring, or an
+// error. It is sized like Init, for elements within a falsePositive rate. Its
+// counters are halved every halfLife, measured by clock; a halfLife of 0
+// disables scheduled decay, leaving only Decay, and a nil clock uses
+// time.Now.
+func InitDecaying(elements int, falsePositive float64, halfLife time.Duration,
+	clock func() time.Time) (*DecayingCounting, error) {
+	c, err := InitCounting(elements, falsePositive)
+	if err != nil {
+		return nil, err
+	}
+	if clock == nil {
+		clock = time.Now
+	}
+	d := &DecayingCounting{counting: c, halfLife: halfLife, clock: clock, start: clock()}
+	d.next.Store(d.start.Add(halfLife).UnixNano())
+	return d, nil
+}
+
+// advance applies the halvings scheduled up to now.
+func (d *DecayingCounting) advance() {
+	if d.halfLife <= 0 {
+		return
+	}
+	now := d.clock()
+	if now.UnixNano() < d.next.Load() {
+		return
+	}
+	d.counting.mutex.Lock()
+	defer d.counting.mutex.Unlock()
+	due := uint64(now.Sub(d.start) / d.halfLife)
+	if due > d.steps {
+		d.counting.halve(due - d.steps)
+		d.steps = due
+		d.next.Store(d.start.Add(time.Duration(due+1) * d.halfLife).UnixNano())
+	}
+}
+
+// Decay halves every counter now, rounding down, in addition to any scheduled
+// halvings.
+func (d *DecayingCounting) Decay() {
+	d.advance()
+	d.counting.mutex.Lock()
+	d.counting.halve(1)
+	d.counting.mutex.Unlock()
+}
+
+// Add adds the data to the ring, incrementing its counters.
+func (d *DecayingCounting) Add(data []byte) {
+	d.advance()
+	d.counting.Add(data)
+}
+
+// Test returns a bool if the data is in the ring. True indicates that the data
+// may be in the ring, while false indicates that the data is not in the ring,
+// or that its counters have decayed to zero.
+func (d *DecayingCounting) Test(data []byte) bool {
+	d.advance()
+	return d.counting.Test(data)
+}
+
+// EstimateCount returns an estimate of the decayed count of the data: the
+// number of times it was added since the last halving, plus the count before
+// that halved and rounded down. Like CountingRing.EstimateCount the error is
+// one-sided: the estimate never falls below the decayed count, as halving a
+// counter shared with other data never rounds below halving each share
+// separately. Counters never fall below zero.
+func (d *DecayingCounting) EstimateCount(data []byte) uint64 {
+	d.advance()
+	return d.counting.EstimateCount(data)
+}
+
+// TestAtLeast returns a bool if the decayed count of the data, as defined by
+// EstimateCount, may be at least n. False indicates that the decayed count is
+// below n, so the data was added fewer than n times since the last halving.
+func (d *DecayingCounting) TestAtLeast(data []byte, n uint64) bool {
+	d.advance()
+	return d.counting.TestAtLeast(data, n)
+}
+
+// Reset clears the ring, without changing the schedule of halvings.
+func (d *DecayingCounting) Reset() {
+	d.counting.Reset()
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	c.now = c.now.Add(d)
+	c.mutex.Unlock()
+}
+
+// TestDecayingSchedule ensures counts halve once per half-life, including
+// several missed half-lives at once, and never drop below zero.
+func TestDecayingSchedule(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	d, _ := ring.InitDecaying(1000, fpRate, time.Hour, clock.Now)
+	data := []byte("hello")
+	for i := 0; i < 100; i++ {
+		d.Add(data)
+	}
+	for _, step := range []struct {
+		advance time.Duration
+		count   uint64
+	}{
+		{59 * time.Minute, 100},
+		{time.Minute, 50},
+		{time.Hour, 25},
+		{3 * time.Hour, 3},
+		{time.Hour, 1},
+		{time.Hour, 0},
+		{100 * time.Hour, 0},
+	} {
+		clock.Advance(step.advance)
+		if count := d.EstimateCount(data); count != step.count {
+			t.Fatalf("count %d, expected %d", count, step.count)
+		}
+	}
+	if d.Test(data) || d.TestAtLeast(data, 1) {
+		t.Fatal("decayed data still present")
+	}
+
+	// adds after a halving count in full until the next one
+	d.Add(data)
+	d.Add(data)
+	if !d.TestAtLeast(data, 2) || d.TestAtLeast(data, 3) {
+		t.Fatalf("count %d, expected 2", d.EstimateCount(data))
+	}
+}
+
+// TestDecayingManual ensures Decay halves the counters without a schedule.
+func TestDecayingManual(t *testing.T) {
+	d, _ := ring.InitDecaying(1000, fpRate, 0, nil)
+	data := []byte("hello")
+	for i := 0; i < 7; i++ {
+		d.Add(data)
+	}
+	for _, count := range []uint64{3, 1, 0, 0} {
+		d.Decay()
+		if c := d.EstimateCount(data); c != count {
+			t.Fatalf("count %d, expected %d", c, count)
+		}
+	}
+	d.Add(data)
+	d.Reset()
+	if d.Test(data) {
+		t.Fatal("data present after Reset")
+	}
+}
+
+// TestDecayingLowerBound ensures the estimate never falls below the decayed
+// count of data sharing counters with other data.
+func TestDecayingLowerBound(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	// a small ring, so counters are shared
+	d, _ := ring.InitDecaying(100, 0.1, time.Minute, clock.Now)
+	buff := make([]byte, 4)
+	var decayed uint64
+	for round := 0; round < 5; round++ {
+		// each datum is added 5 times per round, then halved
+		for i := 0; i < 1000; i++ {
+			intToByte(buff, i%200)
+			d.Add(buff)
+		}
+		clock.Advance(time.Minute)
+		decayed = (decayed + 5) / 2
+	}
+	for i := 0; i < 200; i++ {
+		intToByte(buff, i)
+		if c := d.EstimateCount(buff); c < decayed {
+			t.Fatalf("data %d count %d below its decayed count %d", i, c, decayed)
+		}
+	}
+}
+
+// TestDecayingConcurrent ensures scheduled halvings race safely with Adds and
+// Tests.
+func TestDecayingConcurrent(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	d, _ := ring.InitDecaying(1000, fpRate, time.Millisecond, clock.Now)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			buff := make([]byte, 4)
+			for i := 0; i < 10000; i++ {
+				intToByte(buff, i%100)
+				d.Add(buff)
+				d.EstimateCount(buff)
+				if g == 0 {
+					clock.Advance(time.Microsecond * 100)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,292 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+const (
+	// defaultExactLimit is the number of distinct lines DedupLines tracks
+	// exactly without WithExactLimit.
+	defaultExactLimit = 1 << 16
+	// dedupBuffer is the size of the buffer of DedupLines. Longer lines are
+	// hashed in pieces of this size.
+	dedupBuffer = 64 << 10
+)
+
+// DedupOption configures DedupLines.
+type DedupOption func(*dedupOptions)
+
+// dedupOptions holds the configuration collected from DedupOptions.
+type dedupOptions struct {
+	expected      int                             // expected number of distinct lines, or 0
+	falsePositive float64                         // false positive rate of the filter
+	exactLimit    int                             // distinct lines tracked exactly
+	every         int64                           // lines between calls of progress
+	progress      func(written, suppressed int64) // progress callback, or nil
+}
+
+// WithDedupExpected sizes the filter of DedupLines for the number of distinct
+// lines. Without it, the filter grows as a ScalableRing.
+func WithDedupExpected(lines int) DedupOption {
+	return func(o *dedupOptions) {
+		o.expected = lines
+	}
+}
+
+// WithDedupFalsePositive sets the false positive rate of the filter of
+// DedupLines, by default 0.001: the rate at which lines never seen are
+// suppressed once the filter is used.
+func WithDedupFalsePositive(falsePositive float64) DedupOption {
+	return func(o *dedupOptions) {
+		o.falsePositive = falsePositive
+	}
+}
+
+// WithExactLimit sets the number of distinct lines DedupLines tracks exactly,
+// by default 65536, before moving them into a filter. A limit of 0 uses the
+// filter from the start, and a negative limit never does.
+func WithExactLimit(lines int) DedupOption {
+	return func(o *dedupOptions) {
+		o.exactLimit = lines
+	}
+}
+
+// WithDedupProgress calls fn with the number of lines written and suppressed
+// so far every time another every lines are read, and once more at the end.
+func WithDedupProgress(every int64, fn func(written, suppressed int64)) DedupOption {
+	return func(o *dedupOptions) {
+		o.every = every
+		o.progress = fn
+	}
+}
+
+// DedupLines writes each line of r to w the first time it is seen, as it is
+// read, returning the number of lines written and suppressed. Lines keep their
+// line endings, and a final line without one is written as it is; lines are
+// compared without their final "\n", so "a\r\n" and "a\n" differ, while a
+// final "a" is a duplicate of "a\n". Empty lines are deduplicated like any
+// other.
+//
+// Lines are tracked by a 256-bit digest, exactly in a set of digests until it
+// holds WithExactLimit lines, and then in a filter sized for WithDedupExpected,
+// or otherwise growing. The set costs about 50 bytes per distinct line, but
+// only suppresses a line not seen if their digests collide, while the filter
+// costs 2 bytes per line at the default rate, but suppresses lines never seen
+// at its false positive rate. Inputs of fewer distinct lines than the limit
+// are deduplicated exactly; where every line matters, pass a negative limit.
+//
+// Lines longer than 64KB are hashed in pieces, and held in a temporary file
+// until they are known to be new, so memory is bounded whatever the length of
+// the lines. The first error of r, w, or the temporary file is returned.
+func DedupLines(r io.Reader, w io.Writer, opts ...DedupOption) (written, suppressed int64, err error) {
+	o := dedupOptions{falsePositive: defaultDedupFalsePositive, exactLimit: defaultExactLimit}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	d := &dedupLines{options: o, exact: make(map[Digest]struct{})}
+	if o.exactLimit == 0 {
+		if err := d.useFilter(); err != nil {
+			return 0, 0, err
+		}
+	}
+	defer d.closeSpool()
+	br := bufio.NewReaderSize(r, dedupBuffer)
+	bw := bufio.NewWriter(w)
+	var lines int64
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) == 0 && err == io.EOF {
+			break
+		}
+		lines++
+		var seen bool
+		var werr error
+		if err == bufio.ErrBufferFull {
+			seen, err = d.longLine(br, bw, line)
+		} else if err == nil || err == io.EOF {
+			var serr error
+			if seen, serr = d.seen(NewDigest(trimNewline(line))); serr != nil {
+				return written, suppressed, serr
+			}
+			if !seen {
+				_, werr = bw.Write(line)
+			}
+		}
+		if err != nil && err != io.EOF {
+			bw.Flush()
+			return written, suppressed, err
+		}
+		if werr != nil {
+			return written, suppressed, werr
+		}
+		if seen {
+			suppressed++
+		} else {
+			written++
+		}
+		if o.progress != nil && o.every > 0 && lines%o.every == 0 {
+			o.progress(written, suppressed)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return written, suppressed, err
+	}
+	if o.progress != nil {
+		o.progress(written, suppressed)
+	}
+	return written, suppressed, nil
+}
+
+// dedupLines is the state of DedupLines.
+type dedupLines struct {
+	options dedupOptions
+	exact   map[Digest]struct{}        // digests of the lines, until the filter is used
+	filter  func(Digest) (bool, error) // tests and adds a digest, once used
+	spool   *os.File                   // temporary file of long lines, or nil
+	chain   []byte                     // digest of the pieces so far and the next piece
+}
+
+// seen reports whether the line of the digest was seen, and records it.
+func (d *dedupLines) seen(digest Digest) (bool, error) {
+	if d.filter != nil {
+		return d.filter(digest)
+	}
+	if _, ok := d.exact[digest]; ok {
+		return true, nil
+	}
+	d.exact[digest] = struct{}{}
+	if d.options.exactLimit > 0 && len(d.exact) >= d.options.exactLimit {
+		return false, d.useFilter()
+	}
+	return false, nil
+}
+
+// useFilter moves the digests of the exact set into a filter, used from then
+// on.
+func (d *dedupLines) useFilter() error {
+	if expected := d.options.expected; expected > 0 {
+		if expected < 2*len(d.exact) {
+			expected = 2 * len(d.exact)
+		}
+		r, err := New(expected, d.options.falsePositive)
+		if err != nil {
+			return err
+		}
+		d.filter = func(digest Digest) (bool, error) {
+			return r.testAndAddHash(digest), nil
+		}
+	} else {
+		initial := 4 * len(d.exact)
+		if initial < defaultExactLimit {
+			initial = defaultExactLimit
+		}
+		s, err := InitScalable(initial, d.options.falsePositive)
+		if err != nil {
+			return err
+		}
+		d.filter = func(digest Digest) (bool, error) {
+			if s.TestHash(digest) {
+				return true, nil
+			}
+			return false, s.AddHash(digest)
+		}
+	}
+	for digest := range d.exact {
+		if _, err := d.filter(digest); err != nil {
+			return err
+		}
+	}
+	d.exact = nil
+	return nil
+}
+
+// longLine reads the rest of a line longer than the buffer, whose first piece
+// is first, hashing it in pieces and spooling it to the temporary file, and
+// writes it to w if it was not seen. Each piece is hashed together with the
+// digest of the pieces before it. It returns whether the line was seen, and
+// the error ending the line, nil or io.EOF, or of the spool.
+func (d *dedupLines) longLine(br *bufio.Reader, w io.Writer, first []byte) (bool, error) {
+	if d.spool == nil {
+		f, err := os.CreateTemp("", "dedup")
+		if err != nil {
+			return false, err
+		}
+		d.spool = f
+	} else if err := d.resetSpool(); err != nil {
+		return false, err
+	}
+	digest := NewDigest(first)
+	if _, err := d.spool.Write(first); err != nil {
+		return false, err
+	}
+	var end error
+	for {
+		piece, err := br.ReadSlice('\n')
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return false, err
+		}
+		if _, err := d.spool.Write(piece); err != nil {
+			return false, err
+		}
+		full := err == bufio.ErrBufferFull
+		if !full {
+			piece = trimNewline(piece)
+		}
+		d.chain = d.chain[:0]
+		for _, h := range digest.hash {
+			d.chain = binary.LittleEndian.AppendUint64(d.chain, h)
+		}
+		digest = NewDigest(append(d.chain, piece...))
+		if !full {
+			end = err
+			break
+		}
+	}
+	seen, serr := d.seen(digest)
+	if serr != nil {
+		return false, serr
+	}
+	if !seen {
+		if _, serr := d.spool.Seek(0, io.SeekStart); serr != nil {
+			return false, serr
+		}
+		if _, serr := io.Copy(w, d.spool); serr != nil {
+			return false, serr
+		}
+	}
+	return seen, end
+}
+
+// resetSpool empties the temporary file for the next long line.
+func (d *dedupLines) resetSpool() error {
+	if _, err := d.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return d.spool.Truncate(0)
+}
+
+// closeSpool removes the temporary file, if any.
+func (d *dedupLines) closeSpool() {
+	if d.spool != nil {
+		d.spool.Close()
+		os.Remove(d.spool.Name())
+	}
+}
+
+// trimNewline returns the line without its final "\n", if any.
+func trimNewline(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		return line[:n-1]
+	}
+	return line
+}
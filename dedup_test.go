@@ -0,0 +1,127 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestDedupLines ensures each line is written once, with its line ending, in
+// the order first seen.
+func TestDedupLines(t *testing.T) {
+	in := "b\na\r\nb\n\na\n\nb\r\na\r\nc"
+	var out bytes.Buffer
+	written, suppressed, err := ring.DedupLines(strings.NewReader(in), &out)
+	if err != nil || written != 6 || suppressed != 3 {
+		t.Fatalf("%d written, %d suppressed: %v", written, suppressed, err)
+	}
+	if want := "b\na\r\n\na\nb\r\nc"; out.String() != want {
+		t.Fatalf("unexpected output %q, expected %q", out.String(), want)
+	}
+
+	// a final line without a line ending is a duplicate of a line with one
+	out.Reset()
+	if written, suppressed, _ := ring.DedupLines(strings.NewReader("x\nx"), &out); written != 1 || suppressed != 1 || out.String() != "x\n" {
+		t.Fatalf("%d written, %d suppressed: %q", written, suppressed, out.String())
+	}
+
+	out.Reset()
+	if written, suppressed, err := ring.DedupLines(strings.NewReader(""), &out); written != 0 || suppressed != 0 || err != nil || out.Len() != 0 {
+		t.Fatalf("empty input: %d written, %d suppressed, %q: %v", written, suppressed, out.String(), err)
+	}
+}
+
+// TestDedupLinesHuge ensures lines far longer than the buffer are compared
+// whole and written unchanged.
+func TestDedupLinesHuge(t *testing.T) {
+	a := strings.Repeat("a", 200000)
+	b := a[:len(a)-1] + "b"
+	// lines of exactly the buffer, and of the buffer and its line ending
+	c := strings.Repeat("c", 64<<10)
+	in := a + "\n" + b + "\n" + a + "\r\n" + c + "\n" + a + "\n" + c + "\n" + b
+	var out bytes.Buffer
+	written, suppressed, err := ring.DedupLines(strings.NewReader(in), &out)
+	if err != nil || written != 4 || suppressed != 3 {
+		t.Fatalf("%d written, %d suppressed: %v", written, suppressed, err)
+	}
+	if want := a + "\n" + b + "\n" + a + "\r\n" + c + "\n"; out.String() != want {
+		t.Fatalf("output of %d bytes, expected %d", out.Len(), len(want))
+	}
+	// read a byte at a time, the pieces split elsewhere
+	out.Reset()
+	if written, _, _ := ring.DedupLines(iotest.OneByteReader(strings.NewReader(in)), &out); written != 4 {
+		t.Fatalf("%d written a byte at a time", written)
+	}
+}
+
+// TestDedupLinesSuppression measures the lines wrongly suppressed by the filter
+// on crafted duplicates, and ensures none are in exact mode.
+func TestDedupLinesSuppression(t *testing.T) {
+	var in strings.Builder
+	for i := 0; i < 100000; i++ {
+		in.WriteString(strconv.Itoa(i) + "\n")
+		if i%4 == 0 {
+			in.WriteString(strconv.Itoa(i/2) + "\n")
+		}
+	}
+	// 100000 distinct lines, and 25000 duplicates of earlier lines
+	for _, c := range []struct {
+		name      string
+		opts      []ring.DedupOption
+		maxWrong  int64
+		finalCall bool
+	}{
+		{"exact", []ring.DedupOption{ring.WithExactLimit(-1)}, 0, false},
+		{"sized", []ring.DedupOption{ring.WithExactLimit(1000), ring.WithDedupExpected(100000), ring.WithDedupFalsePositive(0.01)}, 2000, false},
+		{"growing", []ring.DedupOption{ring.WithExactLimit(0), ring.WithDedupFalsePositive(0.01)}, 2000, true},
+	} {
+		var calls int
+		var last [2]int64
+		opts := append(c.opts, ring.WithDedupProgress(10000, func(written, suppressed int64) {
+			calls++
+			last = [2]int64{written, suppressed}
+		}))
+		written, suppressed, err := ring.DedupLines(strings.NewReader(in.String()), io.Discard, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrong := 100000 - written
+		if written+suppressed != 125000 || wrong < 0 || wrong > c.maxWrong {
+			t.Fatalf("%s: %d written, %d suppressed", c.name, written, suppressed)
+		}
+		if calls != 13 || last != [2]int64{written, suppressed} {
+			t.Fatalf("%s: %d progress calls, last %v", c.name, calls, last)
+		}
+		t.Logf("%s: %d distinct lines suppressed", c.name, wrong)
+	}
+}
+
+// TestDedupLinesErrors ensures errors of the reader and writer are returned.
+func TestDedupLinesErrors(t *testing.T) {
+	failing := io.MultiReader(strings.NewReader("a\nb\n"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	var out bytes.Buffer
+	written, _, err := ring.DedupLines(failing, &out)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || written != 2 || out.String() != "a\nb\n" {
+		t.Fatalf("%d written, %q: %v", written, out.String(), err)
+	}
+	if _, _, err := ring.DedupLines(strings.NewReader(strings.Repeat("line\n", 1)), failWriter{}); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("expected io.ErrShortWrite, got %v", err)
+	}
+}
+
+// failWriter fails every write.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrShortWrite
+}
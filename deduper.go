@@ -0,0 +1,205 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultDedupFalsePositive is the rate of a DeduperConfig without one.
+	defaultDedupFalsePositive = 0.001
+	// defaultGenerations is the number of generations of a DeduperConfig
+	// without any.
+	defaultGenerations = 4
+)
+
+var (
+	// ErrWindow is returned by NewDeduper given a window that is not positive.
+	ErrWindow = errors.New("error: window must be greater than 0")
+	// ErrRate is returned by NewDeduper given a rate that is not positive.
+	ErrRate = errors.New("error: rate must be greater than 0")
+	// ErrGenerations is returned by NewDeduper given fewer than 2
+	// generations.
+	ErrGenerations = errors.New("error: generations must be at least 2")
+)
+
+// DeduperConfig describes a Deduper. Window and Rate are required; other zero
+// fields take their defaults.
+type DeduperConfig struct {
+	// Window is how long an ID is remembered after it is first seen, at least.
+	Window time.Duration
+	// Rate is the expected number of distinct IDs per second.
+	Rate float64
+	// FalsePositive is the rate at which IDs never seen are reported seen at
+	// the expected Rate, by default 0.001.
+	FalsePositive float64
+	// Generations is the number of rings the window is split across, by
+	// default 4. IDs are remembered for up to Window/(Generations-1) longer
+	// than Window, so more generations expire IDs closer to Window, at the
+	// cost of testing more rings.
+	Generations int
+	// Clock is the source of the current time, by default time.Now.
+	Clock func() time.Time
+}
+
+// DeduperStats counts the IDs of a Deduper.
+type DeduperStats struct {
+	Duplicates uint64 // IDs reported seen, as duplicates to suppress
+	Uniques    uint64 // IDs reported not seen, and passed on
+}
+
+// Deduper reports whether IDs, such as those of messages of a stream, were seen
+// within a time window, for consumers suppressing redelivered messages. IDs
+// are held in a ring per generation: new IDs are added to the current
+// generation, and every Window/(Generations-1) the oldest generation is cleared
+// to become the current one, so IDs expire without a counter per ID.
+//
+// Generations are rotated lazily, by the calls due to rotate them, as for
+// DecayingCounting, so no background goroutine is needed. A Deduper is safe
+// for concurrent use: of concurrent calls of Seen with the same ID, exactly
+// one reports it unseen.
+type Deduper struct {
+	mutex       sync.RWMutex     // guards generations, written only to rotate
+	generations []*Ring          // rings of each generation, current first
+	span        time.Duration    // time covered by each generation
+	clock       func() time.Time // source of the current time
+	start       time.Time        // time from which rotations are scheduled
+	steps       uint64           // number of scheduled rotations applied
+	next        atomic.Int64     // unix nanoseconds of the next rotation
+
+	duplicates atomic.Uint64
+	uniques    atomic.Uint64
+}
+
+// NewDeduper returns a new Deduper for the config, or an error listing every
+// problem of the config. Each generation is sized for the IDs of its span at
+// Rate, with FalsePositive split evenly between the generations.
+func NewDeduper(c DeduperConfig) (*Deduper, error) {
+	var problems []error
+	if c.Window <= 0 {
+		problems = append(problems, fmt.Errorf("%w, got %v", ErrWindow, c.Window))
+	}
+	if !(c.Rate > 0) || math.IsInf(c.Rate, 1) {
+		problems = append(problems, fmt.Errorf("%w, got %g", ErrRate, c.Rate))
+	}
+	if c.FalsePositive == 0 {
+		c.FalsePositive = defaultDedupFalsePositive
+	}
+	problems = append(problems, checkFalsePositive(c.FalsePositive))
+	if c.Generations == 0 {
+		c.Generations = defaultGenerations
+	}
+	if c.Generations < 2 {
+		problems = append(problems, fmt.Errorf("%w, got %d", ErrGenerations, c.Generations))
+	}
+	if err := joinErrors(problems...); err != nil {
+		return nil, err
+	}
+	if c.Clock == nil {
+		c.Clock = time.Now
+	}
+
+	span := c.Window / time.Duration(c.Generations-1)
+	if span <= 0 {
+		span = 1
+	}
+	elements := math.Ceil(c.Rate * span.Seconds())
+	if elements > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: %g IDs per generation", ErrTooLarge, elements)
+	}
+	d := &Deduper{span: span, clock: c.Clock, start: c.Clock()}
+	for i := 0; i < c.Generations; i++ {
+		r, err := Init(int(elements), c.FalsePositive/float64(c.Generations))
+		if err != nil {
+			return nil, err
+		}
+		d.generations = append(d.generations, r)
+	}
+	d.next.Store(d.start.Add(span).UnixNano())
+	return d, nil
+}
+
+// advance applies the rotations scheduled up to now. A clock more than
+// Generations spans ahead clears every generation once.
+func (d *Deduper) advance() {
+	now := d.clock()
+	if now.UnixNano() < d.next.Load() {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	due := uint64(now.Sub(d.start) / d.span)
+	if due <= d.steps {
+		return
+	}
+	for i := uint64(0); i < due-d.steps && i < uint64(len(d.generations)); i++ {
+		last := len(d.generations) - 1
+		oldest := d.generations[last]
+		oldest.Reset()
+		copy(d.generations[1:], d.generations[:last])
+		d.generations[0] = oldest
+	}
+	d.steps = due
+	d.next.Store(d.start.Add(time.Duration(due+1) * d.span).UnixNano())
+}
+
+// Seen reports whether the ID was seen within the window, and records it as
+// seen. IDs never seen are reported seen at about the FalsePositive rate of
+// the config.
+func (d *Deduper) Seen(id []byte) bool {
+	d.advance()
+	digest := NewDigest(id)
+	d.mutex.RLock()
+	seen := false
+	for _, r := range d.generations[1:] {
+		if r.TestHash(digest) {
+			seen = true
+			break
+		}
+	}
+	if !seen {
+		seen = d.generations[0].testAndAddHash(digest)
+	}
+	d.mutex.RUnlock()
+	if seen {
+		d.duplicates.Add(1)
+	} else {
+		d.uniques.Add(1)
+	}
+	return seen
+}
+
+// SeenString reports whether the ID was seen within the window, as Seen.
+func (d *Deduper) SeenString(id string) bool {
+	return d.Seen([]byte(id))
+}
+
+// Stats returns the number of IDs reported seen and not seen.
+func (d *Deduper) Stats() DeduperStats {
+	return DeduperStats{Duplicates: d.duplicates.Load(), Uniques: d.uniques.Load()}
+}
+
+// testAndAddHash adds the data of the digest to the ring, returning if it was
+// reported present beforehand, as testAndAdd.
+func (r *Ring) testAndAddHash(d Digest) bool {
+	if r.set.Load() == nil {
+		return false
+	}
+	r.lock()
+	defer r.unlock()
+	b := r.set.Load()
+	hash := d.rounds(&b.params)
+	if r.countTest(&hash, b.test(&hash)) {
+		return true
+	}
+	r.addRounds(b, &hash)
+	return false
+}
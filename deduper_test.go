@@ -0,0 +1,109 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestDeduper ensures IDs are reported seen within the window, and accepted
+// again once they expire.
+func TestDeduper(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	d, err := ring.NewDeduper(ring.DeduperConfig{Window: time.Minute, Rate: 100, Clock: clock.Now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.SeenString("a") || !d.SeenString("a") {
+		t.Fatal("a not reported seen after its first sighting")
+	}
+	// remembered for the whole window, whenever within a generation it came
+	clock.Advance(50 * time.Second)
+	if d.SeenString("b") || !d.SeenString("a") {
+		t.Fatal("a expired within the window")
+	}
+	clock.Advance(59 * time.Second)
+	if !d.SeenString("b") {
+		t.Fatal("b expired within the window")
+	}
+	// with 4 generations, IDs expire within a third of the window past it
+	clock.Advance(21 * time.Second)
+	if d.SeenString("a") {
+		t.Fatal("a not expired after the window")
+	}
+	if !d.SeenString("a") {
+		t.Fatal("a not reported seen once accepted again")
+	}
+	clock.Advance(time.Hour)
+	if d.SeenString("a") || d.SeenString("b") {
+		t.Fatal("IDs not expired after a long pause")
+	}
+	if s := d.Stats(); s.Duplicates != 4 || s.Uniques != 5 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+// TestDeduperFalsePositive ensures distinct IDs at the expected rate are
+// rarely reported seen.
+func TestDeduperFalsePositive(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	d, _ := ring.NewDeduper(ring.DeduperConfig{Window: 10 * time.Second, Rate: 1000, FalsePositive: 0.01, Clock: clock.Now})
+	for i := 0; i < 100000; i++ {
+		if i%1000 == 0 {
+			clock.Advance(time.Second)
+		}
+		d.SeenString(strconv.Itoa(i))
+	}
+	if s := d.Stats(); s.Duplicates > 2000 {
+		t.Fatalf("%d of 100000 distinct IDs reported seen", s.Duplicates)
+	}
+}
+
+// TestDeduperConcurrent ensures exactly one of concurrent consumers of the
+// same IDs reports each unseen, across rotations.
+func TestDeduperConcurrent(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	d, _ := ring.NewDeduper(ring.DeduperConfig{Window: time.Hour, Rate: 10, Clock: clock.Now})
+	var uniques atomic.Int32
+	var wg sync.WaitGroup
+	for w := 0; w < 100; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if w == 0 && i%10 == 0 {
+					clock.Advance(time.Minute)
+				}
+				if !d.SeenString(strconv.Itoa(i)) {
+					uniques.Add(1)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if uniques.Load() != 100 {
+		t.Fatalf("%d IDs reported unseen, expected 100", uniques.Load())
+	}
+}
+
+// TestNewDeduperInvalid ensures every problem of the config is reported.
+func TestNewDeduperInvalid(t *testing.T) {
+	_, err := ring.NewDeduper(ring.DeduperConfig{Rate: -1, FalsePositive: 2, Generations: 1})
+	for _, target := range []error{ring.ErrWindow, ring.ErrRate, ring.ErrFalsePositive, ring.ErrGenerations} {
+		if !errors.Is(err, target) {
+			t.Fatalf("expected %v, got %v", target, err)
+		}
+	}
+	if _, err := ring.NewDeduper(ring.DeduperConfig{Window: time.Hour, Rate: 1e12}); !errors.Is(err, ring.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// diagnoseSeed seeds the random keys of Diagnose.
+	diagnoseSeed = 0x5eed
+	// minBucketBits is the fewest active bits expected per region by the
+	// uniformity test of Diagnose, below which it uses fewer regions.
+	minBucketBits = 5
+	// uniformityWarn and uniformityFail are the deviations of the uniformity
+	// statistic of Diagnose, in standard deviations, beyond which it warns or
+	// fails. Healthy rings exceed the first about once in 4000 diagnoses.
+	uniformityWarn = 3.5
+	uniformityFail = 10
+	// fpWarn and fpFail are the false positive rates beyond which Diagnose
+	// warns or fails.
+	fpWarn = 0.1
+	fpFail = 0.5
+)
+
+// DiagnosisLevel is the outcome of a check of Diagnose.
+type DiagnosisLevel uint8
+
+const (
+	// DiagnosisPass is a check finding nothing wrong.
+	DiagnosisPass DiagnosisLevel = iota
+	// DiagnosisSkipped is a check that could not run, such as a uniformity
+	// test of a ring too empty to test.
+	DiagnosisSkipped
+	// DiagnosisWarn is a check finding the ring degraded, such as filled
+	// beyond its design, but usable.
+	DiagnosisWarn
+	// DiagnosisFail is a check finding the ring unfit for use, such as bits
+	// clustered as by a corrupted bit array.
+	DiagnosisFail
+)
+
+// String returns the name of the level.
+func (l DiagnosisLevel) String() string {
+	switch l {
+	case DiagnosisPass:
+		return "pass"
+	case DiagnosisSkipped:
+		return "skipped"
+	case DiagnosisWarn:
+		return "warn"
+	case DiagnosisFail:
+		return "fail"
+	}
+	return fmt.Sprintf("DiagnosisLevel(%d)", uint8(l))
+}
+
+// Finding is the outcome of a check of Diagnose.
+type Finding struct {
+	Check       string         // name of the check: uniformity, false positives or fill
+	Level       DiagnosisLevel // outcome of the check
+	Value       float64        // statistic of the check, as explained
+	Explanation string         // human-readable explanation of the outcome
+}
+
+// Diagnosis is the outcome of Diagnose: its findings, and the worst of their
+// levels, skipped checks counting as passed.
+type Diagnosis struct {
+	Level    DiagnosisLevel
+	Findings []Finding
+}
+
+// String returns the level of the diagnosis, followed by a line per finding.
+func (d Diagnosis) String() string {
+	var sb strings.Builder
+	sb.WriteString(d.Level.String())
+	for _, f := range d.Findings {
+		fmt.Fprintf(&sb, "\n%s: %s: %s", f.Check, f.Level, f.Explanation)
+	}
+	return sb.String()
+}
+
+// add appends the finding, keeping the level of the diagnosis the worst.
+func (d *Diagnosis) add(f Finding) {
+	d.Findings = append(d.Findings, f)
+	if f.Level != DiagnosisSkipped && f.Level > d.Level {
+		d.Level = f.Level
+	}
+}
+
+// Diagnose checks the health of the ring, such as one loaded from a source of
+// unknown provenance, with three checks:
+//
+//   - uniformity: a chi-square test of the active bits of up to 64 regions of
+//     the bit array against a uniform spread, as by Histogram. The Value is
+//     the statistic in standard deviations from its mean; bits clustered by a
+//     poor hash or a corrupted bit array fail it.
+//   - false positives: the rate at which sample random keys, absent from the
+//     ring, are reported present, as by ValidateAgainst. A rate above 0.1
+//     warns, and above 0.5 fails, as for a saturated ring.
+//   - fill: the fraction of active bits against the fill predicted by the
+//     number of additions, if counted since the ring was empty by
+//     EnableCounters without merges or resets, or otherwise by the capacity
+//     of the hash rounds, that of Init for the ring. A ring holding more than
+//     its capacity warns, and twice as much fails; one holding more bits than
+//     its additions set warns, as bits came from elsewhere.
+//
+// Each check takes a read lock of its own, so Add, Merge and Reset wait, while
+// Test does not. A sample below 1 skips the false positive check. A zero Ring
+// fails.
+func (r *Ring) Diagnose(sample int) Diagnosis {
+	var d Diagnosis
+	b := r.set.Load()
+	if b == nil {
+		d.add(Finding{Check: "ring", Level: DiagnosisFail, Explanation: ErrUninitialized.Error()})
+		return d
+	}
+	r.mutex.RLock()
+	b = r.set.Load()
+	var ones uint64
+	counts := b.histogram(skewBuckets)
+	for _, c := range counts {
+		ones += c
+	}
+	buckets := ones / minBucketBits
+	if buckets > skewBuckets {
+		buckets = skewBuckets
+	}
+	if buckets < 2 {
+		counts = nil
+	} else if buckets < skewBuckets {
+		counts = b.histogram(int(buckets))
+	}
+	r.mutex.RUnlock()
+
+	fill := float64(ones) / float64(b.size)
+	d.add(uniformity(b, counts, fill))
+	d.add(r.falsePositives(b, sample, fill))
+	d.add(r.fillFinding(b, fill))
+	return d
+}
+
+// uniformity returns the chi-square test of the active bits of the regions.
+// Regions hold binomially many active bits, of variance w*fill*(1-fill) for
+// w bits, and k times as much in blocked mode, where the bits of each data
+// fall together.
+func uniformity(b *bitset, counts []uint64, fill float64) Finding {
+	f := Finding{Check: "uniformity"}
+	if len(counts) < 2 || fill >= 1 {
+		f.Level = DiagnosisSkipped
+		f.Explanation = fmt.Sprintf("too few or too many active bits to test, %.4f of them", fill)
+		return f
+	}
+	n := uint64(len(counts))
+	dispersion := fill * (1 - fill)
+	if b.flags&flagBlocked != 0 {
+		dispersion *= float64(b.hash)
+	}
+	var stat float64
+	for i, c := range counts {
+		width := (uint64(i)+1)*b.size/n - uint64(i)*b.size/n
+		expected := fill * float64(width)
+		d := float64(c) - expected
+		stat += d * d / (dispersion * float64(width))
+	}
+	df := float64(n - 1)
+	f.Value = (stat - df) / math.Sqrt(2*df)
+	switch {
+	case f.Value > uniformityFail:
+		f.Level = DiagnosisFail
+	case f.Value > uniformityWarn:
+		f.Level = DiagnosisWarn
+	}
+	f.Explanation = fmt.Sprintf("active bits of %d regions deviate from a uniform spread by %.1f standard deviations", n, f.Value)
+	if f.Level != DiagnosisPass {
+		f.Explanation += ", as for a poor hash or a corrupted bit array"
+	}
+	return f
+}
+
+// falsePositives returns the false positive rate of sample random keys.
+func (r *Ring) falsePositives(b *bitset, sample int, fill float64) Finding {
+	f := Finding{Check: "false positives"}
+	if sample < 1 {
+		f.Level = DiagnosisSkipped
+		f.Explanation = "no keys sampled"
+		return f
+	}
+	f.Value = r.ValidateAgainst(RandomKeys(sample, diagnoseSeed))
+	switch {
+	case f.Value > fpFail:
+		f.Level = DiagnosisFail
+	case f.Value > fpWarn:
+		f.Level = DiagnosisWarn
+	}
+	f.Explanation = fmt.Sprintf("%d random keys report a false positive rate of %.4g, against %.4g predicted by the fill",
+		sample, f.Value, math.Pow(fill, float64(b.hash)))
+	if f.Level != DiagnosisPass {
+		f.Explanation += ", as for a saturated ring"
+	}
+	return f
+}
+
+// fillFinding returns the fill against that predicted by the additions, or by
+// the capacity of the ring.
+func (r *Ring) fillFinding(b *bitset, fill float64) Finding {
+	f := Finding{Check: "fill", Value: fill}
+	m, k := float64(b.size), float64(b.hash)
+	if metrics := r.Metrics(); metrics.Adds > 0 && metrics.Merges == 0 && metrics.Resets == 0 {
+		adds := float64(metrics.Adds)
+		predicted := -math.Expm1(-k * adds / m)
+		// additions may repeat, so only a fill beyond the prediction, and its
+		// noise, is suspect
+		if fill > predicted+4*math.Sqrt(predicted*(1-predicted)/m)+0.01 {
+			f.Level = DiagnosisWarn
+			f.Explanation = fmt.Sprintf("fill of %.4f exceeds the %.4f set by %.0f additions, so bits were set elsewhere", fill, predicted, adds)
+		} else {
+			f.Explanation = fmt.Sprintf("fill of %.4f is within the %.4f set by %.0f additions", fill, predicted, adds)
+		}
+		return f
+	}
+	// the capacity at which the optimal number of rounds is k
+	capacity := m * math.Ln2 / k
+	items := b.estimate(fill)
+	switch {
+	case items > 2*capacity:
+		f.Level = DiagnosisFail
+	case items > capacity*1.1:
+		f.Level = DiagnosisWarn
+	}
+	f.Explanation = fmt.Sprintf("fill of %.4f estimates %.0f items, against a capacity of %.0f for %d hash rounds", fill, items, capacity, b.hash)
+	return f
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// diagnosedRing returns a ring of 20000 elements holding n of them.
+func diagnosedRing(t *testing.T, n int, opts ...ring.Option) *ring.Ring {
+	r, err := ring.Init(20000, 0.01, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.EnableCounters()
+	for _, key := range ring.RandomKeys(n, 7) {
+		r.Add(key)
+	}
+	return r
+}
+
+// finding returns the finding of the check.
+func finding(t *testing.T, d ring.Diagnosis, check string) ring.Finding {
+	for _, f := range d.Findings {
+		if f.Check == check {
+			return f
+		}
+	}
+	t.Fatalf("no finding of %s in %v", check, d)
+	return ring.Finding{}
+}
+
+// TestDiagnoseHealthy ensures healthy rings of every mode pass.
+func TestDiagnoseHealthy(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithPartitioned()}, {ring.WithBlocked()}, {ring.WithPowerOfTwoSize()}} {
+		for _, n := range []int{1000, 20000} {
+			r := diagnosedRing(t, n, opts...)
+			if d := r.Diagnose(10000); d.Level != ring.DiagnosisPass || len(d.Findings) != 3 {
+				t.Fatalf("%d elements: unexpected diagnosis %v", n, d)
+			}
+		}
+	}
+	empty, _ := ring.Init(1000, 0.01)
+	d := empty.Diagnose(0)
+	if d.Level != ring.DiagnosisPass || finding(t, d, "uniformity").Level != ring.DiagnosisSkipped ||
+		finding(t, d, "false positives").Level != ring.DiagnosisSkipped {
+		t.Fatalf("unexpected diagnosis of an empty ring %v", d)
+	}
+}
+
+// TestDiagnoseCorrupt ensures a ring whose bit array is half zeroed fails the
+// uniformity test.
+func TestDiagnoseCorrupt(t *testing.T) {
+	data, _ := diagnosedRing(t, 20000).MarshalBinary()
+	// the bit array trails the header
+	for i := len(data) / 2; i < len(data); i++ {
+		data[i] = 0
+	}
+	var r ring.Ring
+	if err := r.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	d := r.Diagnose(1000)
+	if d.Level != ring.DiagnosisFail || finding(t, d, "uniformity").Level != ring.DiagnosisFail {
+		t.Fatalf("unexpected diagnosis of a corrupted ring %v", d)
+	}
+	if !strings.Contains(d.String(), "corrupted bit array") {
+		t.Fatalf("unexpected explanation %q", d)
+	}
+}
+
+// TestDiagnoseOverfilled ensures rings beyond their capacity warn or fail,
+// and bits set other than by counted additions warn.
+func TestDiagnoseOverfilled(t *testing.T) {
+	r := diagnosedRing(t, 100000)
+	if d := r.Diagnose(1000); d.Level != ring.DiagnosisFail || finding(t, d, "false positives").Level != ring.DiagnosisFail {
+		t.Fatalf("unexpected diagnosis of a saturated ring %v", d)
+	}
+
+	data, _ := diagnosedRing(t, 30000).MarshalBinary()
+	var loaded ring.Ring
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if f := finding(t, loaded.Diagnose(0), "fill"); f.Level != ring.DiagnosisWarn {
+		t.Fatalf("unexpected finding of a ring beyond its capacity %v", f)
+	}
+	loaded.EnableCounters()
+	loaded.Add([]byte("x"))
+	if f := finding(t, loaded.Diagnose(0), "fill"); f.Level != ring.DiagnosisWarn || !strings.Contains(f.Explanation, "set elsewhere") {
+		t.Fatalf("unexpected finding of bits set elsewhere %v", f)
+	}
+
+	var zero ring.Ring
+	if d := zero.Diagnose(10); d.Level != ring.DiagnosisFail {
+		t.Fatalf("unexpected diagnosis of a zero Ring %v", d)
+	}
+}
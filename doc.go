@@ -5,6 +5,40 @@
 /*
 Package ring provides a high performance and thread safe bloom filter.
 
+Data
+
+Every filter treats data as an opaque byte string. Empty data is valid, and
+nil is the same data as an empty slice, so data added as one is found as the
+other, in the filter itself or after marshaling it.
+
+Errors
+
+Errors wrap the exported Err variables with contextual detail, so they should
+be matched with errors.Is rather than by their text. Constructors return
+ErrElements, ErrFalsePositive, ErrHashRounds and ErrTooLarge, along with the
+parameter errors of each filter, such as ErrShards for InitRingSet and
+ErrBudget for InitByBytes, and ErrOptions for conflicting Options.
+UnmarshalBinary methods return ErrTruncated, ErrBadVersion, or its
+ErrUnknownVersion for data of later releases, and ErrCorrupt, often as a
+*CorruptError naming the offending field, or the parameter errors of the
+matching constructor. Every invalid argument of a constructor, and every
+invalid field of a header, is reported at once with its value and valid range,
+in a single error matching each of their Err variables. Operations of two
+rings, such as Merge, return ErrNilRing and ErrIncompatible, whose
+*IncompatibleError is retrieved with errors.As. Methods of a zero Ring return
+ErrUninitialized; those returning no error, such as Add, do nothing, and
+TryAdd reports the data it could not add.
+
+Compatibility
+
+Rings marshaled by earlier releases unmarshal, as their parameters are part of
+their binary form. Init no longer rounds the optimal number of bits and hash
+rounds up independently, which could miss the falsePositive rate, so for the
+same elements and falsePositive it may choose different parameters than
+releases before Parameters was added. Rings of different parameters cannot be
+merged: to keep merging with rings of such a release, create new rings by
+unmarshaling one of them and calling Reset.
+
 License
 
 Copyright (c) 2019 Tanner Ryan. All rights reserved. Use of this source code is
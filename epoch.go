@@ -0,0 +1,129 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// With WithFastReset, each 512-bit block of the main bit array carries a stamp,
+// and its bits are only valid while the stamp matches the epoch of the ring.
+// Reset increments the epoch, invalidating every block at once; a stale block
+// is zeroed and restamped the first time a bit in it is set. A block whose
+// stamp matches the epoch has been written since the last Reset, so the stamps
+// also take the place of the summary.
+
+// emptyBitset returns an empty bitset for the ring with the parameters p.
+func (r *Ring) emptyBitset(p params) *bitset {
+	b := newBitset(p, r.offHeap)
+	if r.fastReset {
+		b.stamps = make([]uint32, p.size/summaryBlock+1)
+		b.epoch = new(atomic.Uint32)
+	}
+	return b
+}
+
+// advance invalidates every block by incrementing the epoch. It returns false
+// if the epoch is exhausted, in which case the bitset must be replaced.
+func (b *bitset) advance() bool {
+	if b.stamps == nil || b.epoch.Load() == math.MaxUint32 {
+		return false
+	}
+	b.epoch.Add(1)
+	return true
+}
+
+// fresh returns if the bits of the block are valid in the current epoch.
+func (b *bitset) fresh(block uint64) bool {
+	return atomic.LoadUint32(&b.stamps[block]) == b.epoch.Load()
+}
+
+// touch makes the block valid in the current epoch, zeroing it first if it is
+// stale. The block is zeroed before it is stamped, so lock-free readers never
+// observe bits from a previous epoch. The chunk holding the block must be
+// allocated.
+func (b *bitset) touch(block uint64) {
+	epoch := b.epoch.Load()
+	if atomic.LoadUint32(&b.stamps[block]) == epoch {
+		return
+	}
+	start := block * summaryBlock / 8
+	c := b.chunks[start>>chunkShift]
+	b.clearBlock(c, start&chunkMask)
+	atomic.StoreUint32(&b.stamps[block], epoch)
+}
+
+// clearBlock atomically zeroes the block starting at byte i of the chunk c.
+// The final block of the bit array may be shorter, but chunks are padded to
+// whole words.
+func (b *bitset) clearBlock(c []uint8, i uint64) {
+	n := uint64(cap(c)) - i
+	if n > summaryBlock/8 {
+		n = summaryBlock / 8
+	}
+	atomicZero(c, i, n)
+}
+
+// clearStale zeroes the stale blocks of out, which holds the bytes of the main
+// bit array from byte start, a multiple of the block size. It must not race
+// with writers.
+func (b *bitset) clearStale(out []uint8, start uint64) {
+	if b.stamps == nil {
+		return
+	}
+	for i := uint64(0); i < uint64(len(out)); i += summaryBlock / 8 {
+		if b.fresh((start + i) * 8 / summaryBlock) {
+			continue
+		}
+		end := i + summaryBlock/8
+		if end > uint64(len(out)) {
+			end = uint64(len(out))
+		}
+		for j := i; j < end; j++ {
+			out[j] = 0
+		}
+	}
+}
+
+// normalize zeroes and restamps every stale block, so the raw bits match the
+// logical bits and every stamp is current. Concurrent lock-free readers observe
+// no change; writers must be excluded.
+func (b *bitset) normalize() {
+	if b.stamps == nil {
+		return
+	}
+	epoch := b.epoch.Load()
+	for block := range b.stamps {
+		if atomic.LoadUint32(&b.stamps[block]) == epoch {
+			continue
+		}
+		start := uint64(block) * summaryBlock / 8
+		if c := b.chunks[start>>chunkShift]; c != nil && start < b.length {
+			b.clearBlock(c, start&chunkMask)
+		}
+		atomic.StoreUint32(&b.stamps[block], epoch)
+	}
+}
+
+// logical returns a copy of b without stamps holding its logical bits, or b
+// itself if it has no stamps. It must not race with writers.
+func (b *bitset) logical() *bitset {
+	if b.stamps == nil {
+		return b
+	}
+	l := newBitset(b.params, false)
+	for i, c := range b.chunks {
+		if c == nil {
+			continue
+		}
+		n := l.newChunk(i)
+		copy(n, c)
+		b.clearStale(n, uint64(i)<<chunkShift)
+		l.chunks[i] = n
+	}
+	l.rebuildSummary()
+	return l
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// addRange adds the integers in [from, to) to each ring.
+func addRange(from, to uint64, rings ...*Ring) {
+	buff := make([]byte, 8)
+	for i := from; i < to; i++ {
+		binary.LittleEndian.PutUint64(buff, i)
+		for _, r := range rings {
+			r.Add(buff)
+		}
+	}
+}
+
+// sameMarshal reports if two rings marshal identically.
+func sameMarshal(a, b *Ring) bool {
+	x, _ := a.MarshalBinary()
+	y, _ := b.MarshalBinary()
+	return bytes.Equal(x, y)
+}
+
+// BenchmarkResetLarge measures a Reset of a large ring followed by 1000 Adds,
+// which must reallocate the cleared chunks unless epochs are used.
+func BenchmarkResetLarge(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Clear", nil},
+		{"Epoch", []Option{WithFastReset()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			// 180MB of bits over three chunks
+			r, _ := Init(100000000, 0.001, tc.opts...)
+			for i := 0; i < b.N; i++ {
+				addRange(0, 1000, r)
+				r.Reset()
+			}
+		})
+	}
+}
+
+// BenchmarkProbeFastReset measures Add and Test with and without stamps.
+func BenchmarkProbeFastReset(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Plain", nil},
+		{"Epoch", []Option{WithFastReset()}},
+	} {
+		r, _ := Init(1000000, 0.001, tc.opts...)
+		buff := make([]byte, 8)
+		b.Run(tc.name+"/Add", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				binary.LittleEndian.PutUint64(buff, uint64(i))
+				r.Add(buff)
+			}
+		})
+		b.Run(tc.name+"/Test", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				binary.LittleEndian.PutUint64(buff, uint64(i))
+				r.Test(buff)
+			}
+		})
+	}
+}
+
+func TestFastReset(t *testing.T) {
+	r, _ := Init(100000, 0.001, WithFastReset())
+	plain, _ := Init(100000, 0.001)
+	for round := uint64(0); round < 5; round++ {
+		addRange(round*1000, round*1000+5000, r, plain)
+		if !sameMarshal(r, plain) {
+			t.Fatalf("round %d differs from a plain ring", round)
+		}
+		r.Reset()
+		plain.Reset()
+		buff := make([]byte, 8)
+		for i := round * 1000; i < round*1000+5000; i++ {
+			binary.LittleEndian.PutUint64(buff, i)
+			if r.Test(buff) {
+				t.Fatalf("data %d present after Reset", i)
+			}
+		}
+		if !sameMarshal(r, plain) {
+			t.Fatalf("round %d differs from a plain ring after Reset", round)
+		}
+	}
+}
+
+func TestFastResetChunks(t *testing.T) {
+	// the second chunk holds only 1KB
+	size := uint64(chunkBytes*8 + 8192)
+	r := &Ring{params: params{size: size, hash: 3}, mutex: &sync.RWMutex{}, fastReset: true}
+	r.set.Store(r.emptyBitset(r.params))
+	plain := newSizedRing(size, 3)
+	addRange(0, 10000, r)
+	r.Reset()
+	addRange(5000, 15000, r, plain)
+	if !sameMarshal(r, plain) {
+		t.Fatal("stale bits marshaled")
+	}
+}
+
+func TestFastResetExhausted(t *testing.T) {
+	r, _ := Init(1000, 0.001, WithFastReset())
+	r.set.Load().epoch.Store(math.MaxUint32)
+	addRange(0, 100, r)
+	r.Reset()
+	b := r.set.Load()
+	if b.epoch.Load() != 0 || !b.isCleared() {
+		t.Fatal("exhausted epoch not replaced by a cleared bitset")
+	}
+}
+
+// isCleared reports if no chunk holds an active bit.
+func (b *bitset) isCleared() bool {
+	for _, c := range b.chunks {
+		if !isZero(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFastResetMerge(t *testing.T) {
+	fast, _ := Init(100000, 0.001, WithFastReset())
+	plain, _ := Init(100000, 0.001)
+	want, _ := Init(100000, 0.001)
+	addRange(0, 5000, fast, plain)
+	fast.Reset()
+	addRange(5000, 6000, fast, want)
+	addRange(10000, 11000, plain)
+	// stale bits of the sent ring must not be merged
+	if err := plain.Merge(fast); err != nil {
+		t.Fatal(err)
+	}
+	addRange(0, 5000, want)
+	addRange(10000, 11000, want)
+	if !sameMarshal(plain, want) {
+		t.Fatal("merge from a fast reset ring differs")
+	}
+	// stale bits of the receiver must not reappear
+	fast.Reset()
+	other, _ := Init(100000, 0.001)
+	addRange(20000, 21000, other)
+	if err := fast.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	if !sameMarshal(fast, other) {
+		t.Fatal("merge into a fast reset ring differs")
+	}
+}
+
+// TestFastResetConcurrent interleaves Reset, Add and Test, ensuring data is
+// only missing if a Reset happened since it was added.
+func TestFastResetConcurrent(t *testing.T) {
+	r, _ := Init(10000, 0.01, WithFastReset())
+	var resets int64
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i uint64) {
+			defer wg.Done()
+			buff := make([]byte, 16)
+			for j := uint64(0); ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				binary.LittleEndian.PutUint64(buff, i)
+				binary.LittleEndian.PutUint64(buff[8:], j)
+				before := atomic.LoadInt64(&resets)
+				r.Add(buff)
+				found := r.Test(buff)
+				if !found && before%2 == 0 && atomic.LoadInt64(&resets) == before {
+					t.Error("data missing without a Reset")
+					return
+				}
+			}
+		}(uint64(i))
+	}
+	for i := 0; i < 10000; i++ {
+		// odd while a Reset is in progress
+		atomic.AddInt64(&resets, 1)
+		r.Reset()
+		atomic.AddInt64(&resets, 1)
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ErrExchange is returned by Exchange when the peer sends frames that do not
+// follow the exchange protocol.
+var ErrExchange = errors.New("error: peer does not follow the exchange protocol")
+
+const (
+	// exchangeVersion is the version of the exchange protocol, the first byte
+	// of a digest.
+	exchangeVersion = 1
+	// digestLength is the length of a digest frame: the version, the flags,
+	// seed, size and hash rounds of the ring, and its fingerprint.
+	digestLength = 34
+)
+
+// Exchange synchronizes the ring with the ring of a peer calling Exchange on
+// the other end of the conn, so both end up holding the elements of both. Each
+// side first sends a digest of its ring, its parameters and fingerprint. If
+// the fingerprints are equal, nothing more is sent. Otherwise each side sends
+// its marshaled ring, and merges that of the peer into its own.
+//
+// A peer whose ring has other parameters is rejected from its digest alone,
+// with an *IncompatibleError matching ErrIncompatible, and neither ring is
+// changed; a zero Ring is sent as a ring of size 0, and returns
+// ErrUninitialized. The marshaled ring of the peer is only read if it has the
+// length of that of the ring, and is merged only once read completely, so a
+// peer that disconnects mid-transfer leaves the ring unchanged. Frames that do
+// not follow the protocol return ErrExchange.
+//
+// Deadlines of the conn apply to every read and write, and are the way to
+// bound an exchange with an unresponsive peer. Exchange does not close the
+// conn; after an error the state of the protocol is unknown, and the conn
+// should be closed.
+func Exchange(conn net.Conn, r *Ring) error {
+	if r == nil {
+		return ErrNilRing
+	}
+	data, err := r.MarshalBinary()
+	if err != nil && !errors.Is(err, ErrUninitialized) {
+		return err
+	}
+
+	// the digest and the state sent are of the same snapshot of the ring
+	var own params
+	var digest [digestLength]byte
+	digest[0] = exchangeVersion
+	if data != nil {
+		own, _, _ = ringDecoders[data[0]](data, 0)
+		digest[1] = own.flags
+		binary.BigEndian.PutUint64(digest[2:10], own.seed)
+		binary.BigEndian.PutUint64(digest[10:18], own.size)
+		binary.BigEndian.PutUint64(digest[18:26], own.hash)
+		fingerprint, _ := murmur128(data)
+		binary.BigEndian.PutUint64(digest[26:34], fingerprint)
+	}
+	var peer [digestLength]byte
+	if err := exchangeFrames(conn, net.Buffers{digest[:]}, func() error {
+		_, err := io.ReadFull(conn, peer[:])
+		return err
+	}); err != nil {
+		return fmt.Errorf("error: exchange of digests: %w", err)
+	}
+	if peer[0] != exchangeVersion {
+		return fmt.Errorf("%w: unknown version %d", ErrExchange, peer[0])
+	}
+	if data == nil {
+		return ErrUninitialized
+	}
+	if err := own.compatible(params{
+		flags: peer[1],
+		seed:  binary.BigEndian.Uint64(peer[2:10]),
+		size:  binary.BigEndian.Uint64(peer[10:18]),
+		hash:  binary.BigEndian.Uint64(peer[18:26]),
+	}); err != nil {
+		return err
+	}
+	if bytes.Equal(digest[26:34], peer[26:34]) {
+		return nil
+	}
+
+	// rings of the same parameters have marshaled forms of the same length
+	var length, peerLength [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(data)))
+	var state []byte
+	if err := exchangeFrames(conn, net.Buffers{length[:], data}, func() error {
+		if _, err := io.ReadFull(conn, peerLength[:]); err != nil {
+			return err
+		}
+		if n := binary.BigEndian.Uint64(peerLength[:]); n != uint64(len(data)) {
+			return fmt.Errorf("%w: state of %d bytes, expected %d", ErrExchange, n, len(data))
+		}
+		state = make([]byte, len(data))
+		_, err := io.ReadFull(conn, state)
+		return err
+	}); err != nil {
+		if errors.Is(err, ErrExchange) {
+			return err
+		}
+		return fmt.Errorf("error: exchange of states: %w", err)
+	}
+	m := new(Ring)
+	if err := m.UnmarshalBinary(state); err != nil {
+		return fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	return r.Merge(m)
+}
+
+// exchangeFrames writes the frame to the conn while read reads the frame of
+// the peer, as both sides write before reading. A write blocked on a peer that
+// stopped reading is ended by the write deadline once read fails.
+func exchangeFrames(conn net.Conn, frame net.Buffers, read func() error) error {
+	written := make(chan error, 1)
+	go func() {
+		_, err := frame.WriteTo(conn)
+		written <- err
+	}()
+	if err := read(); err != nil {
+		conn.SetWriteDeadline(time.Now())
+		<-written
+		return err
+	}
+	return <-written
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// exchange runs Exchange of a and b over a pipe, returning the errors of each
+// side.
+func exchange(a, b *ring.Ring, wrap func(net.Conn) net.Conn) (error, error) {
+	ca, cb := net.Pipe()
+	defer ca.Close()
+	defer cb.Close()
+	if wrap != nil {
+		cb = wrap(cb)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		err := ring.Exchange(cb, b)
+		// a failed side closes its conn, as callers should
+		if err != nil {
+			cb.Close()
+		}
+		errs <- err
+	}()
+	err := ring.Exchange(ca, a)
+	if err != nil {
+		ca.Close()
+	}
+	return err, <-errs
+}
+
+// writeLimit closes the conn once limit bytes were written, as a peer
+// disconnecting mid-transfer, and counts the bytes written.
+type writeLimit struct {
+	net.Conn
+	limit   int
+	written int
+}
+
+func (c *writeLimit) Write(p []byte) (int, error) {
+	if c.written+len(p) > c.limit {
+		n, _ := c.Conn.Write(p[:c.limit-c.written])
+		c.written += n
+		c.Conn.Close()
+		return n, io.ErrClosedPipe
+	}
+	n, err := c.Conn.Write(p)
+	c.written += n
+	return n, err
+}
+
+// TestExchange ensures rings converge in either direction, and rings already
+// equal exchange only their digests.
+func TestExchange(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		a, b int
+	}{
+		{"both", 1000, 1000},
+		{"a to b", 1000, 0},
+		{"b to a", 0, 1000},
+	} {
+		a, _ := ring.Init(10000, 0.01)
+		b, _ := ring.Init(10000, 0.01)
+		for i := 0; i < c.a; i++ {
+			a.Add([]byte("a" + strconv.Itoa(i)))
+		}
+		for i := 0; i < c.b; i++ {
+			b.Add([]byte("b" + strconv.Itoa(i)))
+		}
+		if erra, errb := exchange(a, b, nil); erra != nil || errb != nil {
+			t.Fatalf("%s: %v, %v", c.name, erra, errb)
+		}
+		if !a.Equal(b) {
+			t.Fatalf("%s: rings differ after the exchange", c.name)
+		}
+		for i := 0; i < c.a; i++ {
+			if !b.Test([]byte("a" + strconv.Itoa(i))) {
+				t.Fatalf("%s: b lacks a%d", c.name, i)
+			}
+		}
+		for i := 0; i < c.b; i++ {
+			if !a.Test([]byte("b" + strconv.Itoa(i))) {
+				t.Fatalf("%s: a lacks b%d", c.name, i)
+			}
+		}
+
+		counted := &writeLimit{limit: 1 << 30}
+		if erra, errb := exchange(a, b, func(c net.Conn) net.Conn {
+			counted.Conn = c
+			return counted
+		}); erra != nil || errb != nil {
+			t.Fatalf("%s: second exchange: %v, %v", c.name, erra, errb)
+		}
+		if counted.written > 64 {
+			t.Fatalf("%s: equal rings sent %d bytes", c.name, counted.written)
+		}
+	}
+}
+
+// TestExchangeIncompatible ensures rings of other parameters are rejected on
+// both sides without changing either.
+func TestExchangeIncompatible(t *testing.T) {
+	for _, opts := range [][]ring.Option{{ring.WithSeed(1)}, {ring.WithPowerOfTwoSize()}} {
+		a, _ := ring.Init(10000, 0.01)
+		b, _ := ring.Init(10000, 0.01, opts...)
+		a.Add([]byte("a"))
+		b.Add([]byte("b"))
+		erra, errb := exchange(a, b, nil)
+		var incompatible *ring.IncompatibleError
+		if !errors.As(erra, &incompatible) || !errors.Is(errb, ring.ErrIncompatible) {
+			t.Fatalf("expected IncompatibleError, got %v, %v", erra, errb)
+		}
+		if a.Test([]byte("b")) || b.Test([]byte("a")) {
+			t.Fatal("incompatible rings were merged")
+		}
+	}
+
+	a, _ := ring.Init(10000, 0.01)
+	erra, errb := exchange(a, new(ring.Ring), nil)
+	if !errors.Is(erra, ring.ErrIncompatible) || !errors.Is(errb, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrIncompatible and ErrUninitialized, got %v, %v", erra, errb)
+	}
+	if err := ring.Exchange(nil, nil); !errors.Is(err, ring.ErrNilRing) {
+		t.Fatalf("expected ErrNilRing, got %v", err)
+	}
+}
+
+// TestExchangeDisconnect ensures a peer disconnecting mid-transfer leaves the
+// ring unchanged.
+func TestExchangeDisconnect(t *testing.T) {
+	a, _ := ring.Init(10000, 0.01)
+	b, _ := ring.Init(10000, 0.01)
+	a.Add([]byte("a"))
+	for i := 0; i < 1000; i++ {
+		b.Add([]byte("b" + strconv.Itoa(i)))
+	}
+	before, _ := a.MarshalBinary()
+	erra, errb := exchange(a, b, func(c net.Conn) net.Conn {
+		return &writeLimit{Conn: c, limit: 1000}
+	})
+	if !errors.Is(erra, io.ErrUnexpectedEOF) || errb == nil {
+		t.Fatalf("expected io.ErrUnexpectedEOF, got %v, %v", erra, errb)
+	}
+	after, _ := a.MarshalBinary()
+	if string(before) != string(after) {
+		t.Fatal("ring changed by a partial transfer")
+	}
+}
+
+// TestExchangeProtocol ensures frames of another protocol and silent peers are
+// rejected.
+func TestExchangeProtocol(t *testing.T) {
+	r, _ := ring.Init(1000, 0.01)
+	ca, cb := net.Pipe()
+	go func() {
+		io.CopyN(io.Discard, cb, 34)
+		cb.Write(make([]byte, 34))
+		cb.Close()
+	}()
+	if err := ring.Exchange(ca, r); !errors.Is(err, ring.ErrExchange) {
+		t.Fatalf("expected ErrExchange, got %v", err)
+	}
+	ca.Close()
+
+	silent, peer := net.Pipe()
+	defer peer.Close()
+	defer silent.Close()
+	silent.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	if err := ring.Exchange(silent, r); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected os.ErrDeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"expvar"
+	"sync"
+)
+
+// published holds the expvar.Maps registered by PublishExpvar, by name. The
+// expvar package cannot remove a variable, so each Map is kept for the life of
+// the process and rebound to whichever ring is published under its name.
+var published = struct {
+	sync.Mutex
+	maps  map[string]*expvar.Map
+	rings map[string]*Ring
+}{maps: make(map[string]*expvar.Map), rings: make(map[string]*Ring)}
+
+// PublishExpvar publishes the counters of the ring as an expvar.Map under the
+// name, holding
+//
+//	adds    number of data added, whether or not already present
+//	tests   number of data tested
+//	hits    number of data tested and reported present
+//	resets  number of calls of Reset
+//	fill    fraction of active bits, as reported by Stats
+//	items   estimated number of distinct data added, as reported by Stats
+//
+// It calls EnableCounters, and the fill and items are computed when read.
+// Publishing another ring under the name of a ring published earlier replaces
+// it, so rings recreated under one name need no cleanup. Like expvar.Publish,
+// it panics if the name is already used by a variable not published by
+// PublishExpvar.
+func (r *Ring) PublishExpvar(name string) {
+	r.EnableCounters()
+	published.Lock()
+	defer published.Unlock()
+	m, ok := published.maps[name]
+	if !ok {
+		m = new(expvar.Map)
+		expvar.Publish(name, m)
+		published.maps[name] = m
+	}
+	published.rings[name] = r
+	m.Init()
+	m.Set("adds", expvar.Func(func() interface{} { return r.Metrics().Adds }))
+	m.Set("tests", expvar.Func(func() interface{} { return r.Metrics().Tests }))
+	m.Set("hits", expvar.Func(func() interface{} { return r.Metrics().Hits }))
+	m.Set("resets", expvar.Func(func() interface{} { return r.Metrics().Resets }))
+	m.Set("fill", expvar.Func(func() interface{} { return r.Stats().Fill }))
+	m.Set("items", expvar.Func(func() interface{} { return r.Stats().EstimatedItems }))
+}
+
+// UnpublishExpvar empties the expvar.Map published under the name, if it holds
+// the counters of the ring, and releases the reference held to the ring, so a
+// short-lived ring can be collected. The empty Map stays registered, as expvar
+// cannot remove it, and the ring keeps counting.
+func (r *Ring) UnpublishExpvar(name string) {
+	published.Lock()
+	defer published.Unlock()
+	if published.rings[name] != r {
+		return
+	}
+	delete(published.rings, name)
+	published.maps[name].Init()
+}
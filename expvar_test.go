@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// readExpvar returns the values of the map published under the name.
+func readExpvar(t *testing.T, name string) map[string]float64 {
+	t.Helper()
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatalf("%s is not published", name)
+	}
+	values := map[string]float64{}
+	if err := json.Unmarshal([]byte(v.String()), &values); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return values
+}
+
+// TestPublishExpvar ensures the published counters follow Add, Test and Reset
+// traffic.
+func TestPublishExpvar(t *testing.T) {
+	r, _ := ring.New(10000, 0.001)
+	r.Add([]byte("before publishing"))
+	r.PublishExpvar("ring_test_publish")
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	r.AddHash(ring.NewDigest([]byte("digest")))
+	r.AddString("string")
+	for i := 0; i < 2000; i++ {
+		intToByte(buff, i)
+		r.Test(buff)
+	}
+	r.TestHash(ring.NewDigest([]byte("digest")))
+	values := readExpvar(t, "ring_test_publish")
+	for key, want := range map[string]float64{"adds": 1002, "tests": 2001, "resets": 0} {
+		if values[key] != want {
+			t.Errorf("%s: %g, expected %g", key, values[key], want)
+		}
+	}
+	if hits := values["hits"]; hits < 1001 || hits > 1005 {
+		t.Errorf("hits: %g, expected about 1001", hits)
+	}
+	if items := values["items"]; math.Abs(items-1003) > 50 {
+		t.Errorf("items: %g, expected about 1003", items)
+	}
+	if fill := values["fill"]; fill <= 0 || fill >= 0.5 {
+		t.Errorf("fill: %g", fill)
+	}
+
+	r.Reset()
+	values = readExpvar(t, "ring_test_publish")
+	if values["resets"] != 1 || values["fill"] != 0 || values["items"] != 0 {
+		t.Errorf("after Reset: %v", values)
+	}
+}
+
+// TestUnpublishExpvar ensures a name is rebound to the last ring published
+// under it, and emptied only by that ring.
+func TestUnpublishExpvar(t *testing.T) {
+	first, _ := ring.New(100, 0.01)
+	first.PublishExpvar("ring_test_unpublish")
+	first.Add([]byte("first"))
+
+	second, _ := ring.New(100, 0.01)
+	second.PublishExpvar("ring_test_unpublish")
+	if values := readExpvar(t, "ring_test_unpublish"); values["adds"] != 0 {
+		t.Fatalf("name not rebound: %v", values)
+	}
+	first.UnpublishExpvar("ring_test_unpublish")
+	second.Add([]byte("second"))
+	if values := readExpvar(t, "ring_test_unpublish"); values["adds"] != 1 {
+		t.Fatalf("unpublished by another ring: %v", values)
+	}
+	second.UnpublishExpvar("ring_test_unpublish")
+	if values := readExpvar(t, "ring_test_unpublish"); len(values) != 0 {
+		t.Fatalf("not emptied: %v", values)
+	}
+
+	// a name used by another variable panics, as with expvar.Publish
+	expvar.NewInt("ring_test_foreign")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	first.PublishExpvar("ring_test_foreign")
+}
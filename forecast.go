@@ -0,0 +1,57 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"math"
+	"time"
+)
+
+// TargetFalsePositive returns the falsePositive rate the ring was sized for by
+// New, Init, InitUint or InitByBytesFP, or 0 for rings sized otherwise, such as
+// by InitByBytes, or a zero Ring. Like Options, it is not marshaled, and a ring
+// loaded by UnmarshalBinary keeps its own.
+func (r *Ring) TargetFalsePositive() float64 {
+	return r.target
+}
+
+// RemainingCapacity returns the number of distinct data that can be added to
+// the ring before its theoretical false positive rate, that of the
+// FalsePositiveRate of Parameters, exceeds the target of TargetFalsePositive:
+// the Capacity of the ring at the target, less the data estimated from its
+// fill, as reported by Stats. It is 0 once the target is reached, and for rings
+// without a target, or a zero Ring. The estimate is that of Stats, so it costs
+// the same for any size of ring, and loses precision as the ring saturates.
+func (r *Ring) RemainingCapacity() uint64 {
+	if r.target == 0 || r.set.Load() == nil {
+		return 0
+	}
+	capacity := r.Parameters().Capacity(r.target)
+	items := r.Stats().EstimatedItems
+	if items >= float64(capacity) {
+		return 0
+	}
+	return capacity - uint64(math.Ceil(items))
+}
+
+// ForecastBreach returns the time until the ring exceeds its target false
+// positive rate if distinct data keeps being added at ratePerSecond, from its
+// RemainingCapacity: 0 once the target is reached, or for rings without a
+// target. A rate of 0 or less, or NaN, never breaches it, returning the
+// largest time.Duration, as do forecasts beyond it.
+func (r *Ring) ForecastBreach(ratePerSecond float64) time.Duration {
+	remaining := r.RemainingCapacity()
+	if remaining == 0 {
+		return 0
+	}
+	if !(ratePerSecond > 0) {
+		return math.MaxInt64
+	}
+	seconds := float64(remaining) / ratePerSecond
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
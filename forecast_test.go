@@ -0,0 +1,73 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestRemainingCapacity fills a ring in steps, ensuring its remaining capacity
+// decreases, and reaches 0 about when the measured false positive rate
+// exceeds the target.
+func TestRemainingCapacity(t *testing.T) {
+	const elements, target, step = 10000, 0.01, 250
+	r, _ := ring.Init(elements, target)
+	if r.TargetFalsePositive() != target {
+		t.Fatalf("target %g, expected %g", r.TargetFalsePositive(), target)
+	}
+	if remaining := r.RemainingCapacity(); remaining < elements {
+		t.Fatalf("empty ring has %d remaining, expected at least %d", remaining, elements)
+	}
+	absent := ring.RandomKeys(100000, 2)
+	keys := ring.RandomKeys(3*elements, 1)
+	previous := uint64(math.MaxUint64)
+	exhausted, breached := -1, -1
+	for added := step; added <= len(keys); added += step {
+		for _, key := range keys[added-step : added] {
+			r.Add(key)
+		}
+		remaining := r.RemainingCapacity()
+		if remaining > previous || (remaining == previous && remaining != 0) {
+			t.Fatalf("%d added: %d remaining after %d", added, remaining, previous)
+		}
+		previous = remaining
+		if remaining == 0 && exhausted < 0 {
+			exhausted = added
+		}
+		if breached < 0 && r.ValidateAgainst(absent) > target {
+			breached = added
+		}
+	}
+	if exhausted < 0 || breached < 0 || math.Abs(float64(exhausted-breached)) > 0.1*elements {
+		t.Fatalf("capacity exhausted at %d, rate breached at %d", exhausted, breached)
+	}
+}
+
+// TestForecastBreach ensures the forecast divides the remaining capacity by
+// the rate, and handles rates never reaching it.
+func TestForecastBreach(t *testing.T) {
+	r, _ := ring.Init(10000, 0.01)
+	remaining := r.RemainingCapacity()
+	if got, want := r.ForecastBreach(100), time.Duration(float64(remaining)/100*float64(time.Second)); got != want {
+		t.Fatalf("forecast %v, expected %v", got, want)
+	}
+	for _, rate := range []float64{0, -1, math.NaN(), 1e-300} {
+		if got := r.ForecastBreach(rate); got != math.MaxInt64 {
+			t.Fatalf("rate %g: forecast %v, expected never", rate, got)
+		}
+	}
+	b, _ := ring.InitByBytes(1000, 100)
+	if b.RemainingCapacity() != 0 || b.ForecastBreach(1) != 0 {
+		t.Fatal("expected no capacity without a target")
+	}
+	fp, _ := ring.InitByBytesFP(1000, 0.01)
+	if fp.TargetFalsePositive() != 0.01 || fp.RemainingCapacity() == 0 {
+		t.Fatal("expected the target of InitByBytesFP")
+	}
+}
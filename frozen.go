@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrBuilt is returned by the methods of a Builder once it has been built.
+var ErrBuilt = errors.New("error: builder has already been built")
+
+// Builder populates a ring offline, before sealing it into a FrozenRing or
+// handing it over as a Ring. Add takes no locks, so a Builder is not safe for
+// concurrent use; BuildFrom suits building from several goroutines. Once built,
+// every method of the Builder returns ErrBuilt, so the result can no longer be
+// changed through it.
+type Builder struct {
+	ring   *Ring
+	noLock bool // locking of the built ring
+}
+
+// NewBuilder returns a builder of a ring of elements within the falsePositive
+// rate, as New with the same arguments. WithOffHeap is rejected, as a
+// FrozenRing is never closed.
+func NewBuilder(elements int, falsePositive float64, opts ...Option) (*Builder, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.offHeap {
+		return nil, fmt.Errorf("%w: WithOffHeap conflicts with NewBuilder", ErrOptions)
+	}
+	r, err := New(elements, falsePositive, opts...)
+	if err != nil {
+		return nil, err
+	}
+	b := &Builder{ring: r, noLock: r.noLock}
+	r.noLock = true
+	return b, nil
+}
+
+// Add adds the data to the ring being built.
+func (b *Builder) Add(data []byte) error {
+	if b.ring == nil {
+		return ErrBuilt
+	}
+	b.ring.Add(data)
+	return nil
+}
+
+// Build seals the ring into a FrozenRing and invalidates the builder.
+func (b *Builder) Build() (*FrozenRing, error) {
+	r, err := b.BuildRing()
+	if err != nil {
+		return nil, err
+	}
+	return &FrozenRing{set: r.set.Load()}, nil
+}
+
+// BuildRing returns the ring, a regular ring with the locking chosen by the
+// options of NewBuilder, and invalidates the builder.
+func (b *Builder) BuildRing() (*Ring, error) {
+	r := b.ring
+	if r == nil {
+		return nil, ErrBuilt
+	}
+	b.ring = nil
+	r.noLock = b.noLock
+	return r, nil
+}
+
+// FrozenRing is an immutable ring, built by a Builder. It has no methods to
+// change its data, and Test takes no lock. It is safe for concurrent use.
+type FrozenRing struct {
+	set *bitset
+}
+
+// Test returns a bool if the data is in the ring. True indicates that the data
+// may be in the ring, while false indicates that the data is not in the ring.
+func (f *FrozenRing) Test(data []byte) bool {
+	hash := f.set.rounds(data)
+	return f.set.test(&hash)
+}
+
+// TestHash returns a bool if the data of the digest is in the ring, like Test
+// without hashing the data again.
+func (f *FrozenRing) TestHash(d Digest) bool {
+	hash := d.rounds(&f.set.params)
+	return f.set.test(&hash)
+}
+
+// Parameters returns the parameters of the ring.
+func (f *FrozenRing) Parameters() Parameters {
+	return f.set.parameters()
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The data is
+// that of a Ring with the same bits, so it can be unmarshaled into a Ring.
+func (f *FrozenRing) MarshalBinary() ([]byte, error) {
+	return f.set.marshal(), nil
+}
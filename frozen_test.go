@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestBuilder ensures Build and BuildRing hold the same data, with the
+// parameters of New.
+func TestBuilder(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithPartitioned(), ring.WithSeed(42)}, {ring.WithBlocked()}} {
+		frozen, built := buildBoth(t, 10000, opts)
+		want, _ := ring.New(10000, 0.01, opts...)
+		if frozen.Parameters() != want.Parameters() || built.Parameters() != want.Parameters() {
+			t.Fatalf("parameters %+v and %+v, expected %+v", frozen.Parameters(), built.Parameters(), want.Parameters())
+		}
+		buff := make([]byte, 4)
+		for i := 0; i < 100000; i++ {
+			intToByte(buff, i)
+			if frozen.Test(buff) != built.Test(buff) || frozen.TestHash(ring.NewDigest(buff)) != built.Test(buff) {
+				t.Fatalf("%d: frozen and built rings disagree", i)
+			}
+			if i < 10000 && !frozen.Test(buff) {
+				t.Fatalf("%d missing", i)
+			}
+		}
+		a, _ := frozen.MarshalBinary()
+		b, _ := built.MarshalBinary()
+		if !bytes.Equal(a, b) {
+			t.Fatal("frozen and built rings marshal differently")
+		}
+		var decoded ring.Ring
+		if err := decoded.UnmarshalBinary(a); err != nil || !decoded.Equal(built) {
+			t.Fatalf("frozen ring does not unmarshal into a ring: %v", err)
+		}
+	}
+}
+
+// buildBoth returns a frozen and a mutable ring of the same elements.
+func buildBoth(t *testing.T, elements int, opts []ring.Option) (*ring.FrozenRing, *ring.Ring) {
+	a, err := ring.NewBuilder(elements, 0.01, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ring.NewBuilder(elements, 0.01, opts...)
+	buff := make([]byte, 4)
+	for i := 0; i < elements; i++ {
+		intToByte(buff, i)
+		a.Add(buff)
+		b.Add(buff)
+	}
+	frozen, err := a.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, err := b.BuildRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frozen, built
+}
+
+// TestBuilderBuilt ensures a builder is invalidated by Build and BuildRing,
+// and that the built ring is locked again.
+func TestBuilderBuilt(t *testing.T) {
+	for _, build := range []func(*ring.Builder) error{
+		func(b *ring.Builder) error { _, err := b.Build(); return err },
+		func(b *ring.Builder) error { _, err := b.BuildRing(); return err },
+	} {
+		b, _ := ring.NewBuilder(1000, 0.01)
+		if err := build(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Add([]byte("late")); !errors.Is(err, ring.ErrBuilt) {
+			t.Fatalf("Add: expected ErrBuilt, got %v", err)
+		}
+		if _, err := b.Build(); !errors.Is(err, ring.ErrBuilt) {
+			t.Fatalf("Build: expected ErrBuilt, got %v", err)
+		}
+		if _, err := b.BuildRing(); !errors.Is(err, ring.ErrBuilt) {
+			t.Fatalf("BuildRing: expected ErrBuilt, got %v", err)
+		}
+	}
+	if _, err := ring.NewBuilder(1000, 0.01, ring.WithOffHeap()); !errors.Is(err, ring.ErrOptions) {
+		t.Fatalf("WithOffHeap: expected ErrOptions, got %v", err)
+	}
+	if _, err := ring.NewBuilder(0, 0.01); !errors.Is(err, ring.ErrElements) {
+		t.Fatalf("expected ErrElements, got %v", err)
+	}
+	// the built ring takes its lock again, which the race detector verifies
+	b, _ := ring.NewBuilder(1000, 0.01)
+	r, _ := b.BuildRing()
+	done := make(chan bool)
+	go func() {
+		r.Add([]byte("a"))
+		done <- true
+	}()
+	r.Add([]byte("b"))
+	<-done
+	if !r.Test([]byte("a")) || !r.Test([]byte("b")) {
+		t.Fatal("concurrent adds missing")
+	}
+}
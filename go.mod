@@ -1,3 +1,5 @@
 module github.com/tannerryan/ring
 
-go 1.14
+go 1.19
+
+require golang.org/x/text v0.14.0
@@ -0,0 +1,114 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"unsafe"
+)
+
+// HammingDistance returns the number of bits differing between the rings, the
+// popcount of their XOR, computed a word at a time under a read lock of each,
+// so writers of either wait, while Test does not. It is a cheap measure of the
+// drift between replicas: rings whose data differs by n elements differ by at
+// most k*n bits. Rings of different parameters return an error matching
+// ErrIncompatible, nil rings ErrNilRing, and zero Rings ErrUninitialized.
+func HammingDistance(a, b *Ring) (uint64, error) {
+	var distance uint64
+	err := diffWords(a, b, func(_, x uint64) bool {
+		distance += uint64(bits.OnesCount64(x))
+		return true
+	})
+	return distance, err
+}
+
+// DifferingWords returns the indices of the 64-bit words differing between the
+// rings, in order, the word of index i holding bytes 8*i to 8*i+7 of the bit
+// array, as written by MarshalBinary after its header. At most limit indices
+// are returned, or every one if limit is 0 or less. The rings are compared as
+// by HammingDistance, returning its errors.
+func DifferingWords(a, b *Ring, limit int) ([]uint64, error) {
+	var words []uint64
+	err := diffWords(a, b, func(word, _ uint64) bool {
+		words = append(words, word)
+		return limit <= 0 || len(words) < limit
+	})
+	return words, err
+}
+
+// diffWords calls fn with the index and XOR of each word differing between the
+// rings, under a read lock of each, until fn returns false.
+func diffWords(a, b *Ring, fn func(word, x uint64) bool) error {
+	if a == nil || b == nil {
+		return ErrNilRing
+	}
+	if a.set.Load() == nil || b.set.Load() == nil {
+		return ErrUninitialized
+	}
+	if a == b {
+		return nil
+	}
+	if err := a.set.Load().compatible(b.set.Load().params); err != nil {
+		return err
+	}
+	defer rlockPair(a, b)()
+
+	ab, bb := a.set.Load(), b.set.Load()
+	// either ring may have been replaced by UnmarshalBinary in the meantime
+	if err := ab.compatible(bb.params); err != nil {
+		return err
+	}
+	for i := range ab.chunks {
+		ac, bc := ab.chunks[i], bb.chunks[i]
+		if ac == nil && bc == nil {
+			continue
+		}
+		start := uint64(i) << chunkShift
+		for off, end := uint64(0), ab.chunkLen(i); off < end; off += 8 {
+			if x := ab.word(ac, start, off, end) ^ bb.word(bc, start, off, end); x != 0 {
+				if !fn((start+off)/8, x) {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rlockPair takes the read locks of the distinct rings in address order, as
+// Merge takes its locks, returning a function releasing them.
+func rlockPair(a, b *Ring) func() {
+	first, second := a, b
+	if uintptr(unsafe.Pointer(b)) < uintptr(unsafe.Pointer(a)) {
+		first, second = b, a
+	}
+	first.mutex.RLock()
+	second.mutex.RLock()
+	return func() {
+		second.mutex.RUnlock()
+		first.mutex.RUnlock()
+	}
+}
+
+// word returns the 64-bit word at offset off of the chunk c starting at byte
+// start of the bit array, of length end, as little endian, so bit j of the
+// word is bit j of the bit array from the word. A nil chunk, or a block stale
+// with WithFastReset, holds zeros. Writers must be excluded.
+func (b *bitset) word(c []uint8, start, off, end uint64) uint64 {
+	if c == nil {
+		return 0
+	}
+	// words never straddle blocks
+	if b.stamps != nil && !b.fresh((start+off)*8/summaryBlock) {
+		return 0
+	}
+	if off+8 <= end {
+		return binary.LittleEndian.Uint64(c[off:])
+	}
+	var buf [8]byte
+	copy(buf[:], c[off:end])
+	return binary.LittleEndian.Uint64(buf[:])
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// naiveDiff returns the Hamming distance and differing words of the rings, bit
+// by bit over their binary forms.
+func naiveDiff(t *testing.T, a, b *ring.Ring) (uint64, []uint64) {
+	da, _ := a.MarshalBinary()
+	db, _ := b.MarshalBinary()
+	header := len(da) - int(a.Parameters().Bits/8+1)
+	var distance uint64
+	var words []uint64
+	for i := header; i < len(da); i++ {
+		differs := false
+		for j := 0; j < 8; j++ {
+			if (da[i]>>j)&1 != (db[i]>>j)&1 {
+				distance++
+				differs = true
+			}
+		}
+		word := uint64(i-header) / 8
+		if differs && (len(words) == 0 || words[len(words)-1] != word) {
+			words = append(words, word)
+		}
+	}
+	return distance, words
+}
+
+// TestHammingDistance ensures identical rings are at distance 0, and an added
+// element moves them at most k bits apart.
+func TestHammingDistance(t *testing.T) {
+	a, _ := ring.Init(10000, 0.01)
+	b, _ := ring.Init(10000, 0.01)
+	for _, key := range ring.RandomKeys(1000, 1) {
+		a.Add(key)
+		b.Add(key)
+	}
+	if d, err := ring.HammingDistance(a, b); err != nil || d != 0 {
+		t.Fatalf("distance %d, %v, expected 0", d, err)
+	}
+	b.Add([]byte("extra"))
+	d, err := ring.HammingDistance(a, b)
+	if err != nil || d == 0 || d > a.Parameters().HashRounds {
+		t.Fatalf("distance %d, %v, expected at most %d", d, err, a.Parameters().HashRounds)
+	}
+	words, _ := ring.DifferingWords(a, b, 0)
+	if len(words) == 0 || uint64(len(words)) > d {
+		t.Fatalf("%d differing words of a distance of %d", len(words), d)
+	}
+	if d, _ := ring.HammingDistance(a, a); d != 0 {
+		t.Fatalf("distance %d to itself", d)
+	}
+}
+
+// TestHammingDistanceNaive compares the distance and differing words of
+// random rings with a bit by bit reference.
+func TestHammingDistanceNaive(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, opts := range [][]ring.Option{nil, {ring.WithFastReset()}, {ring.WithOffHeap()}, {ring.WithBlocked()}} {
+		for trial := 0; trial < 10; trial++ {
+			elements := 1 + rnd.Intn(1<<14)
+			a, _ := ring.Init(elements, 0.01, opts...)
+			b, _ := ring.Init(elements, 0.01, opts...)
+			if rnd.Intn(2) == 0 {
+				// stale blocks of WithFastReset must count as empty
+				a.Add([]byte("reset"))
+				a.Reset()
+			}
+			for i, n := 0, rnd.Intn(elements); i < n; i++ {
+				key := []byte{byte(rnd.Intn(256)), byte(rnd.Intn(256)), byte(rnd.Intn(256))}
+				switch rnd.Intn(3) {
+				case 0:
+					a.Add(key)
+				case 1:
+					b.Add(key)
+				default:
+					a.Add(key)
+					b.Add(key)
+				}
+			}
+			distance, words := naiveDiff(t, a, b)
+			if d, err := ring.HammingDistance(a, b); err != nil || d != distance {
+				t.Fatalf("distance %d, %v, expected %d", d, err, distance)
+			}
+			got, err := ring.DifferingWords(b, a, 0)
+			if err != nil || len(got) != len(words) {
+				t.Fatalf("%d differing words, %v, expected %d", len(got), err, len(words))
+			}
+			for i := range got {
+				if got[i] != words[i] {
+					t.Fatalf("differing word %d is %d, expected %d", i, got[i], words[i])
+				}
+			}
+			if limited, _ := ring.DifferingWords(a, b, 3); len(words) > 3 && len(limited) != 3 {
+				t.Fatalf("%d differing words beyond the limit of 3", len(limited))
+			}
+			a.Close()
+			b.Close()
+		}
+	}
+}
+
+// TestHammingDistanceErrors ensures incompatible, nil and zero rings are
+// rejected.
+func TestHammingDistanceErrors(t *testing.T) {
+	a, _ := ring.Init(1000, 0.01)
+	b, _ := ring.Init(2000, 0.01)
+	if _, err := ring.HammingDistance(a, b); !errors.Is(err, ring.ErrIncompatible) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := ring.DifferingWords(a, nil, 1); !errors.Is(err, ring.ErrNilRing) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := ring.HammingDistance(a, &ring.Ring{}); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -146,11 +146,93 @@ func generateMultiHash(data []byte) [4]uint64 {
 	return [4]uint64{h1, h2, h3, h4}
 }
 
-// getRound retrieves the simulated nth round of hashing, fed from 4
-// pre-generated hashes.
-func getRound(hash [4]uint64, n uint64) uint64 {
-	index := 2 + (((n + (n % 2)) % 4) / 2)
-	pre := hash[n%2]
-	post := n * hash[index]
-	return pre + post
+// rounds holds the halves of a multihash arranged by round, so each simulated
+// round of hashing is a single multiply-add. Round n is base[n%4] +
+// n*step[n%4], cycling through the pairs (h1, h3), (h2, h4), (h1, h4) and
+// (h2, h3).
+type rounds struct {
+	base [4]uint64
+	step [4]uint64
+}
+
+// newRounds returns the rounds fed from 4 pre-generated hashes.
+func newRounds(hash [4]uint64) rounds {
+	return rounds{
+		base: [4]uint64{hash[0], hash[1], hash[0], hash[1]},
+		step: [4]uint64{hash[2], hash[3], hash[3], hash[2]},
+	}
+}
+
+// hashRounds returns the rounds of hashing for data, with the seed.
+func hashRounds(data []byte, seed uint64) rounds {
+	return newRounds(reseed(generateMultiHash(data), seed))
+}
+
+// reseed returns the hash remixed with the seed, so rings of different seeds
+// derive unrelated rounds from the same hash. A seed of 0 leaves it unchanged.
+func reseed(hash [4]uint64, seed uint64) [4]uint64 {
+	if seed == 0 {
+		return hash
+	}
+	for i := range hash {
+		hash[i] = fmix(hash[i] ^ fmix(seed+uint64(i)*murmur64c1))
+	}
+	return hash
+}
+
+// hashedOnce is called by oneHashRounds for each hash, replaceable by tests
+// counting them. The data is not passed to it, which would make every data
+// added or tested escape to the heap.
+var hashedOnce = func() {}
+
+// oneHashRounds returns the rounds of hashing for data from a single 128-bit
+// hash, with the seed. The second pair of halves is derived by remixing the
+// first, rather than by hashing the data again.
+func oneHashRounds(data []byte, seed uint64) rounds {
+	hashedOnce()
+	h1, h2 := murmur128(data)
+	return seededRemixRounds(h1, h2, seed)
+}
+
+// seededRemixRounds returns the rounds of remixRounds from a single 128-bit
+// hash remixed with the seed.
+func seededRemixRounds(h1, h2, seed uint64) rounds {
+	if seed != 0 {
+		h := reseed([4]uint64{h1, h2}, seed)
+		h1, h2 = h[0], h[1]
+	}
+	return remixRounds(h1, h2)
+}
+
+// remixRounds returns the rounds fed from a single 128-bit hash, deriving the
+// second pair of halves by remixing the first.
+func remixRounds(h1, h2 uint64) rounds {
+	return newRounds([4]uint64{h1, h2, fmix(h1 ^ murmur64c1), fmix(h2 ^ murmur64c2)})
+}
+
+// Digest is the hash of some data, computed once by NewDigest and usable in
+// place of the data by any ring or sketch of this package, such as Ring.AddHash
+// and CountMin.UpdateWithDigest, so one pass over the data feeds them all.
+type Digest struct {
+	hash [4]uint64 // multihash of the data
+}
+
+// NewDigest returns the digest of data.
+func NewDigest(data []byte) Digest {
+	return Digest{hash: generateMultiHash(data)}
+}
+
+// rounds returns the rounds of hashing of the digest for a filter of p,
+// matching p.rounds of the data.
+func (d *Digest) rounds(p *params) rounds {
+	if p.flags&flagOneHash != 0 {
+		// the first hash of the multihash is the single hash of the data
+		return seededRemixRounds(d.hash[0], d.hash[1], p.seed)
+	}
+	return newRounds(reseed(d.hash, p.seed))
+}
+
+// at retrieves the simulated nth round of hashing.
+func (r *rounds) at(n uint64) uint64 {
+	return r.base[n&3] + n*r.step[n&3]
 }
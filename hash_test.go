@@ -1,6 +1,13 @@
 package ring
 
-import "testing"
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
 
 func BenchmarkGenerateMultiHash(b *testing.B) {
 	data := []byte{0x00, 0x12, 0x34, 0x56, 0x78, 0x00}
@@ -35,3 +42,177 @@ func TestGenerateMultiHash(t *testing.T) {
 		}
 	}
 }
+
+// benchmarkReduce measures the per-probe cost of reducing a hash round to an
+// index of the bit array.
+func benchmarkReduce(b *testing.B, opts ...Option) {
+	r, _ := Init(1000000, 0.001, opts...)
+	hash := hashRounds([]byte("hello"), 0)
+	// chain each index into the next round so probes cannot overlap
+	var index uint64
+	for i := 0; i < b.N; i++ {
+		index = r.reduce(hash.at(index))
+	}
+	_ = index
+}
+
+func BenchmarkReduceModulo(b *testing.B) {
+	benchmarkReduce(b)
+}
+
+func BenchmarkReduceMask(b *testing.B) {
+	benchmarkReduce(b, WithPowerOfTwoSize())
+}
+
+// getRound is the original derivation of the simulated nth round of hashing,
+// kept as a reference for rounds.
+func getRound(hash [4]uint64, n uint64) uint64 {
+	index := 2 + (((n + (n % 2)) % 4) / 2)
+	pre := hash[n%2]
+	post := n * hash[index]
+	return pre + post
+}
+
+func TestRounds(t *testing.T) {
+	buff := make([]byte, 8)
+	for i := uint64(0); i < 1000; i++ {
+		binary.LittleEndian.PutUint64(buff, i)
+		hash := generateMultiHash(buff)
+		rounds := newRounds(hash)
+		for n := uint64(0); n < 100; n++ {
+			if rounds.at(n) != getRound(hash, n) {
+				t.Fatalf("round %d of %d does not match", n, i)
+			}
+		}
+	}
+}
+
+// TestRoundsMarshal ensures filters built from a fixed corpus are unchanged by
+// the derivation of rounds.
+func TestRoundsMarshal(t *testing.T) {
+	for _, tc := range []struct {
+		opts []Option
+		sum  string
+	}{
+		{nil, "e0e35dc852697cb3e668c59e8b3302f7ca3dce74b6f6b9bb5eae869891d4625e"},
+		{[]Option{WithPowerOfTwoSize()}, "12acca51437a2d4dde53715d10d220c1946b875df9a6a015722736e9534e70e1"},
+	} {
+		r, _ := Init(10000, 0.001, tc.opts...)
+		buff := make([]byte, 8)
+		for i := uint64(0); i < 10000; i++ {
+			binary.LittleEndian.PutUint64(buff, i*7919)
+			r.Add(buff)
+		}
+		data, _ := r.MarshalBinary()
+		if sum := fmt.Sprintf("%x", sha256.Sum256(data)); sum != tc.sum {
+			t.Fatalf("marshaled filter changed: %s", sum)
+		}
+	}
+}
+
+// benchmarkGetRound measures the per-operation cost of deriving k rounds of
+// hashing with getRound.
+func benchmarkGetRound(b *testing.B, k uint64) {
+	hash := generateMultiHash([]byte("hello"))
+	var sum uint64
+	for i := 0; i < b.N; i++ {
+		for n := uint64(0); n < k; n++ {
+			sum += getRound(hash, n)
+		}
+	}
+	_ = sum
+}
+
+// benchmarkRounds measures the per-operation cost of deriving k rounds of
+// hashing with rounds, including arranging the halves.
+func benchmarkRounds(b *testing.B, k uint64) {
+	hash := generateMultiHash([]byte("hello"))
+	var sum uint64
+	for i := 0; i < b.N; i++ {
+		rounds := newRounds(hash)
+		for n := uint64(0); n < k; n++ {
+			sum += rounds.at(n)
+		}
+	}
+	_ = sum
+}
+
+func BenchmarkGetRoundK7(b *testing.B)  { benchmarkGetRound(b, 7) }
+func BenchmarkGetRoundK14(b *testing.B) { benchmarkGetRound(b, 14) }
+func BenchmarkRoundsK7(b *testing.B)    { benchmarkRounds(b, 7) }
+func BenchmarkRoundsK14(b *testing.B)   { benchmarkRounds(b, 14) }
+
+// TestOneHashCalls ensures one hash mode hashes data exactly once per Add and
+// Test, whatever the number of hash rounds, and never through the two hashes of
+// generateMultiHash.
+func TestOneHashCalls(t *testing.T) {
+	calls := 0
+	hashedOnce = func() { calls++ }
+	defer func() { hashedOnce = func() {} }()
+	for _, fp := range []float64{0.1, 0.001, 1e-9} {
+		r, _ := Init(1000, fp, WithOneHash())
+		data := []byte("hello")
+		calls = 0
+		r.Add(data)
+		if calls != 1 {
+			t.Fatalf("Add hashed %d times with %d rounds", calls, r.hash)
+		}
+		calls = 0
+		if !r.Test(data) || calls != 1 {
+			t.Fatalf("Test hashed %d times with %d rounds", calls, r.hash)
+		}
+		// the default mode never hashes through oneHashRounds
+		r2, _ := Init(1000, fp)
+		calls = 0
+		r2.Add(data)
+		r2.Test(data)
+		if calls != 0 {
+			t.Fatalf("default mode hashed %d times through oneHashRounds", calls)
+		}
+	}
+}
+
+// TestSegmentSize ensures one hash partitions are whole words, and large
+// enough for the exact false positive rate of a partitioned ring.
+func TestSegmentSize(t *testing.T) {
+	for _, n := range []int{1, 100, 1000000} {
+		for _, fp := range []float64{0.5, 0.01, 1e-6} {
+			r, _ := Init(n, fp, WithOneHash())
+			if r.part%64 != 0 || r.size != r.part*r.hash {
+				t.Fatalf("partition of %d bits for %d rounds, size %d", r.part, r.hash, r.size)
+			}
+			exact := math.Pow(1-math.Pow(1-1/float64(r.part), float64(n)), float64(r.hash))
+			if exact > fp {
+				t.Fatalf("exact rate %g exceeds %g for %d elements", exact, fp, n)
+			}
+		}
+	}
+}
+
+// TestAddSeedSwapped ensures Add and TestAndAdd hash the data again when the
+// bit array is replaced by one of another seed between hashing and locking, so
+// the data is not added under the old seed.
+func TestAddSeedSwapped(t *testing.T) {
+	for name, add := range map[string]func(r *Ring, data []byte){
+		"Add":        func(r *Ring, data []byte) { r.Add(data) },
+		"TestAndAdd": func(r *Ring, data []byte) { r.TestAndAdd(data) },
+	} {
+		r, _ := New(1000, 0.01, WithSeed(1))
+		other, _ := New(1000, 0.01, WithSeed(2))
+		data := []byte("swapped")
+		r.mutex.Lock()
+		done := make(chan struct{})
+		go func() {
+			add(r, data)
+			close(done)
+		}()
+		// let the add hash the data under seed 1 and wait for the lock
+		time.Sleep(10 * time.Millisecond)
+		r.set.Store(other.set.Load())
+		r.mutex.Unlock()
+		<-done
+		if !r.Test(data) {
+			t.Errorf("%s: data added under the replaced seed", name)
+		}
+	}
+}
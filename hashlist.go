@@ -0,0 +1,208 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// defaultDigestWidth is the width of the digests of ImportHashList without
+	// WithDigestWidth, that of hex SHA-1 digests.
+	defaultDigestWidth = 40
+	// maxDigestWidth is the widest digest of ImportHashList, that of hex
+	// SHA-512 digests.
+	maxDigestWidth = 128
+	// defaultImportFalsePositive is the rate of the ring of ImportHashList
+	// without WithImportFalsePositive.
+	defaultImportFalsePositive = 0.001
+	// importBuffer is the size of the buffer of ImportHashList, which also
+	// bounds the length of its lines.
+	importBuffer = 64 << 10
+)
+
+// ErrMalformedLine is matched by the *LineError of ImportHashList for a line
+// that is not a hex digest of the width, optionally followed by ":count".
+var ErrMalformedLine = errors.New("error: line is not a hex digest")
+
+// ImportOption configures ImportHashList.
+type ImportOption func(*importOptions)
+
+// importOptions holds the configuration collected from ImportOptions.
+type importOptions struct {
+	width         int               // number of hex digits of each digest
+	lines         int               // expected number of lines, or 0 to estimate
+	falsePositive float64           // false positive rate of the ring
+	opts          []Option          // options of the ring
+	skip          bool              // skip malformed lines rather than fail
+	every         int64             // lines between calls of progress
+	progress      func(lines int64) // progress callback, or nil
+}
+
+// WithDigestWidth sets the number of hex digits of each digest, by default 40,
+// those of SHA-1. The width must be even, and at most 128.
+func WithDigestWidth(width int) ImportOption {
+	return func(o *importOptions) {
+		o.width = width
+	}
+}
+
+// WithExpectedLines sizes the ring for the number of lines. Without it, the
+// number is estimated from the size of a reader with a Stat method, such as an
+// *os.File, and the width of its lines, which overestimates lines with a count.
+func WithExpectedLines(lines int) ImportOption {
+	return func(o *importOptions) {
+		o.lines = lines
+	}
+}
+
+// WithImportFalsePositive sets the false positive rate of the ring, by default
+// 0.001.
+func WithImportFalsePositive(falsePositive float64) ImportOption {
+	return func(o *importOptions) {
+		o.falsePositive = falsePositive
+	}
+}
+
+// WithImportRingOptions sets the Options of the ring.
+func WithImportRingOptions(opts ...Option) ImportOption {
+	return func(o *importOptions) {
+		o.opts = append(o.opts, opts...)
+	}
+}
+
+// WithSkipMalformed skips malformed lines rather than failing on the first.
+func WithSkipMalformed() ImportOption {
+	return func(o *importOptions) {
+		o.skip = true
+	}
+}
+
+// WithProgress calls fn with the number of lines read every time another every
+// lines are read, from the goroutine of ImportHashList.
+func WithProgress(every int64, fn func(lines int64)) ImportOption {
+	return func(o *importOptions) {
+		o.every = every
+		o.progress = fn
+	}
+}
+
+// ImportHashList returns a ring holding the digests of a hash list, such as
+// the SHA-1 list of Have I Been Pwned: a digest of hex digits of a fixed width
+// per line, in either case, optionally followed by ":" and a count, which is
+// skipped. Each digest is decoded to its bytes, which are added, so data is
+// tested with the raw digest of the same hash function, such as the 20 bytes
+// of sha1.Sum. Empty lines are skipped, and lines may end in "\r\n".
+//
+// Lines are read and decoded without allocating, and hashed once outside the
+// write lock, which is taken once per batch of lines, as by
+// AddFromReaderSize. The ring is sized for WithExpectedLines, or for the lines
+// estimated from the size of rd. Without either, ImportHashList returns an
+// error matching ErrElements.
+//
+// A malformed line returns a *LineError matching ErrMalformedLine, unless
+// WithSkipMalformed is given, and an error of rd a *LineError holding it. A
+// final line without a line ending is added like any other.
+func ImportHashList(rd io.Reader, opts ...ImportOption) (*Ring, error) {
+	o := importOptions{width: defaultDigestWidth, falsePositive: defaultImportFalsePositive}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.width < 2 || o.width > maxDigestWidth || o.width%2 != 0 {
+		return nil, fmt.Errorf("%w: WithDigestWidth(%d) is not an even width of 2 to %d", ErrOptions, o.width, maxDigestWidth)
+	}
+	if o.lines == 0 {
+		if f, ok := rd.(interface{ Stat() (os.FileInfo, error) }); ok {
+			if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+				// each line holds at least the digest and a line ending
+				o.lines = int(info.Size() / int64(o.width+1))
+			}
+		}
+	}
+	r, err := New(o.lines, o.falsePositive, o.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(rd, importBuffer)
+	var digest [maxDigestWidth / 2]byte
+	batch := make([]Digest, 0, readBatch)
+	var line int64
+	for {
+		text, err := br.ReadSlice('\n')
+		if len(text) == 0 && err == io.EOF {
+			break
+		}
+		line++
+		if err == bufio.ErrBufferFull {
+			if !o.skip {
+				return nil, &LineError{line, fmt.Errorf("%w: longer than %d bytes", ErrMalformedLine, importBuffer)}
+			}
+			// the rest of the line is skipped along with it
+			for err == bufio.ErrBufferFull {
+				_, err = br.ReadSlice('\n')
+			}
+			text = nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, &LineError{line, err}
+		} else if data, perr := parseHashLine(text, o.width, digest[:]); perr != nil {
+			if !o.skip {
+				return nil, &LineError{line, perr}
+			}
+		} else if data != nil {
+			batch = append(batch, NewDigest(data))
+			if len(batch) == readBatch {
+				r.addBatch(batch)
+				batch = batch[:0]
+			}
+		}
+		if o.progress != nil && o.every > 0 && line%o.every == 0 {
+			o.progress(line)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	r.addBatch(batch)
+	return r, nil
+}
+
+// parseHashLine decodes the digest of the line of a hash list into buf,
+// returning it, or nil for an empty line.
+func parseHashLine(text []byte, width int, buf []byte) ([]byte, error) {
+	if n := len(text); n > 0 && text[n-1] == '\n' {
+		text = text[:n-1]
+	}
+	if n := len(text); n > 0 && text[n-1] == '\r' {
+		text = text[:n-1]
+	}
+	if len(text) == 0 {
+		return nil, nil
+	}
+	if len(text) < width {
+		return nil, fmt.Errorf("%w: %d digits, expected %d", ErrMalformedLine, len(text), width)
+	}
+	if rest := text[width:]; len(rest) > 0 {
+		if rest[0] != ':' || len(rest) == 1 {
+			return nil, fmt.Errorf("%w: expected %d digits and an optional :count", ErrMalformedLine, width)
+		}
+		for _, c := range rest[1:] {
+			if c < '0' || c > '9' {
+				return nil, fmt.Errorf("%w: count is not a number", ErrMalformedLine)
+			}
+		}
+	}
+	n, err := hex.Decode(buf, text[:width])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedLine, err)
+	}
+	return buf[:n], nil
+}
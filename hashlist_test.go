@@ -0,0 +1,121 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestImportHashList ensures the digests of the fixture in testdata, the SHA-1
+// digests of password0 to password99 in either case, some with a count, some
+// ending in "\r\n", the last without a line ending, are imported, skipping its
+// malformed lines 21, 41, 61 and 81.
+func TestImportHashList(t *testing.T) {
+	f, err := os.Open("testdata/hashlist.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var progress []int64
+	r, err := ring.ImportHashList(f, ring.WithSkipMalformed(), ring.WithProgress(50, func(lines int64) {
+		progress = append(progress, lines)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if sum := sha1.Sum([]byte("password" + strconv.Itoa(i))); !r.Test(sum[:]) {
+			t.Fatalf("digest of password%d missing", i)
+		}
+	}
+	if sum := sha1.Sum([]byte("y")); r.Test(sum[:]) {
+		t.Fatal("digest of a malformed line added")
+	}
+	// sized from the file, of 105 lines of at least 41 bytes
+	if p := r.Parameters(); p.Bits < 1000 || p.Bits > 2000 {
+		t.Fatalf("ring of %d bits for about 100 lines", p.Bits)
+	}
+	if len(progress) != 2 || progress[0] != 50 || progress[1] != 100 {
+		t.Fatalf("unexpected progress %v", progress)
+	}
+}
+
+// TestImportHashListMalformed ensures malformed lines fail the import by
+// default, with the number of the line.
+func TestImportHashListMalformed(t *testing.T) {
+	data, _ := os.ReadFile("testdata/hashlist.txt")
+	_, err := ring.ImportHashList(strings.NewReader(string(data)), ring.WithExpectedLines(100))
+	var lineErr *ring.LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 21 || !errors.Is(err, ring.ErrMalformedLine) {
+		t.Fatalf("expected ErrMalformedLine at line 21, got %v", err)
+	}
+	for _, line := range []string{
+		"0123:1",
+		strings.Repeat("ab", 20) + ":",
+		strings.Repeat("ab", 20) + " 1",
+		strings.Repeat("zz", 20),
+		strings.Repeat("a", 1<<17),
+	} {
+		if _, err := ring.ImportHashList(strings.NewReader(line+"\n"), ring.WithExpectedLines(1)); !errors.Is(err, ring.ErrMalformedLine) {
+			t.Fatalf("%.50q: expected ErrMalformedLine, got %v", line, err)
+		}
+	}
+
+	// lines longer than the buffer are skipped whole
+	long := strings.Repeat("a", 1<<17) + "\n" + strings.Repeat("ab", 20) + "\n"
+	r, err := ring.ImportHashList(strings.NewReader(long), ring.WithExpectedLines(1), ring.WithSkipMalformed())
+	if digest, _ := hex.DecodeString(strings.Repeat("ab", 20)); err != nil || !r.Test(digest) {
+		t.Fatalf("digest after a long line missing: %v", err)
+	}
+}
+
+// TestImportHashListOptions ensures other widths are imported, and invalid
+// widths, unknown sizes and errors of the reader are reported.
+func TestImportHashListOptions(t *testing.T) {
+	var list strings.Builder
+	for i := 0; i < 50; i++ {
+		sum := sha256.Sum256([]byte(strconv.Itoa(i)))
+		list.WriteString(hex.EncodeToString(sum[:]) + "\n")
+	}
+	r, err := ring.ImportHashList(strings.NewReader(list.String()), ring.WithDigestWidth(64),
+		ring.WithExpectedLines(50), ring.WithImportFalsePositive(0.01), ring.WithImportRingOptions(ring.WithSeed(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if sum := sha256.Sum256([]byte(strconv.Itoa(i))); !r.Test(sum[:]) {
+			t.Fatalf("digest %d missing", i)
+		}
+	}
+	if r.Parameters().Seed != 3 {
+		t.Fatal("ring options not applied")
+	}
+
+	for _, width := range []int{0, 3, 130} {
+		if _, err := ring.ImportHashList(strings.NewReader(""), ring.WithDigestWidth(width), ring.WithExpectedLines(1)); !errors.Is(err, ring.ErrOptions) {
+			t.Fatalf("width %d: expected ErrOptions, got %v", width, err)
+		}
+	}
+	if _, err := ring.ImportHashList(strings.NewReader(list.String())); !errors.Is(err, ring.ErrElements) {
+		t.Fatalf("expected ErrElements, got %v", err)
+	}
+	failing := io.MultiReader(strings.NewReader(list.String()[:65*3]), iotest.ErrReader(io.ErrUnexpectedEOF))
+	_, err = ring.ImportHashList(failing, ring.WithDigestWidth(64), ring.WithExpectedLines(50), ring.WithSkipMalformed())
+	var lineErr *ring.LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 4 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF at line 4, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+)
+
+// skewBuckets is the number of regions of the bit array compared by Skew.
+const skewBuckets = 64
+
+// Histogram returns the number of active bits in each of buckets regions of
+// equal width of the bit array, in order, to spot regions a poor hash or key
+// encoding sets more than others. Regions differ in width by at most a bit,
+// and buckets beyond the number of bits are capped at it. Bits are counted a
+// word at a time, skipping blocks never written, under a read lock, so Add,
+// Merge and Reset wait, while Test does not. A zero Ring, or buckets below 1,
+// returns nil.
+func (r *Ring) Histogram(buckets int) []uint64 {
+	if r.set.Load() == nil || buckets < 1 {
+		return nil
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.set.Load().histogram(buckets)
+}
+
+// histogram returns the active bits of each of buckets regions of the bit
+// array.
+func (b *bitset) histogram(buckets int) []uint64 {
+	n := uint64(buckets)
+	if n > b.size {
+		n = b.size
+	}
+	counts := make([]uint64, n)
+	// bucket returns the region of the bit
+	bucket := func(bit uint64) uint64 {
+		hi, lo := bits.Mul64(bit, n)
+		q, _ := bits.Div64(hi, lo, b.size)
+		return q
+	}
+	blocks := (b.size + summaryBlock - 1) / summaryBlock
+	for block := uint64(0); block < blocks; block++ {
+		if b.stamps != nil && !b.fresh(block) {
+			continue
+		}
+		start := block * summaryBlock
+		c := b.chunks[start>>(chunkShift+3)]
+		if c == nil {
+			continue
+		}
+		// blocks never straddle chunks, and bits past size are never set
+		for bit := start; bit < start+summaryBlock && bit < b.size; bit += 32 {
+			i := (bit / 8) & chunkMask
+			last := bit + 31
+			if last >= b.size {
+				last = b.size - 1
+			}
+			if first := bucket(bit); first == bucket(last) && i+4 <= uint64(cap(c)) {
+				word := atomic.LoadUint32((*uint32)(unsafe.Add(unsafe.Pointer(&c[0]), i)))
+				counts[first] += uint64(bits.OnesCount32(word))
+				continue
+			}
+			// the word straddles regions
+			for j := bit; j <= last; j += 8 {
+				v := atomicLoad(c, (j/8)&chunkMask)
+				for k := uint64(0); k < 8 && j+k <= last; k++ {
+					if v&(1<<k) != 0 {
+						counts[bucket(j+k)]++
+					}
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// Skew returns the coefficient of variation of the active bits of 64 regions
+// of the bit array, as counted by Histogram: the standard deviation of their
+// counts over the mean. A uniform hash keeps it near 0, up to sampling noise
+// shrinking with the size of the ring, while keys hashed to a few regions
+// raise it towards 8, the square root of the number of regions less one. A
+// zero or empty Ring returns 0.
+func (r *Ring) Skew() float64 {
+	return skew(r.Histogram(skewBuckets))
+}
+
+// skew returns the coefficient of variation of the counts.
+func skew(counts []uint64) float64 {
+	if len(counts) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, c := range counts {
+		sum += float64(c)
+	}
+	if sum == 0 {
+		return 0
+	}
+	mean := sum / float64(len(counts))
+	var variance float64
+	for _, c := range counts {
+		d := float64(c) - mean
+		variance += d * d
+	}
+	return math.Sqrt(variance/float64(len(counts))) / mean
+}
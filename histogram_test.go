@@ -0,0 +1,91 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// setBits sets the bits of the indices through updates of constant rounds, as
+// a hash mapping every data to a single index would.
+func setBits(t *testing.T, r *ring.Ring, indices ...uint64) {
+	var updates []ring.Update
+	for _, i := range indices {
+		updates = append(updates, ring.Update{Hash: [4]uint64{i, i, 0, 0}})
+	}
+	if err := r.ApplyUpdates(updates); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestHistogram ensures bits are counted in the region holding them, for
+// regions of any width.
+func TestHistogram(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithFastReset()}, {ring.WithOffHeap()}} {
+		r, _ := ring.Init(10000, 0.01, opts...)
+		bits := r.Parameters().Bits
+		indices := []uint64{0, 31, 32, 100, 511, 512, bits / 2, bits - 1}
+		setBits(t, r, indices...)
+		for _, buckets := range []int{1, 3, 64, 1000, int(bits), int(bits) + 10} {
+			h := r.Histogram(buckets)
+			if buckets > int(bits) {
+				buckets = int(bits)
+			}
+			if len(h) != buckets {
+				t.Fatalf("%d buckets, expected %d", len(h), buckets)
+			}
+			expected := make([]uint64, buckets)
+			for _, i := range indices {
+				expected[i*uint64(buckets)/bits]++
+			}
+			for i := range h {
+				if h[i] != expected[i] {
+					t.Fatalf("%d buckets: bucket %d holds %d bits, expected %d", buckets, i, h[i], expected[i])
+				}
+			}
+		}
+		r.Reset()
+		if h := r.Histogram(1); h[0] != 0 {
+			t.Fatalf("%d bits after Reset", h[0])
+		}
+		r.Close()
+	}
+	var zero ring.Ring
+	if zero.Histogram(8) != nil || zero.Skew() != 0 {
+		t.Fatal("expected no histogram of a zero Ring")
+	}
+}
+
+// TestSkew ensures uniform keys have a low skew, and keys hashed to a single
+// region a high one.
+func TestSkew(t *testing.T) {
+	r, _ := ring.Init(100000, 0.01)
+	if s := r.Skew(); s != 0 {
+		t.Fatalf("empty ring has skew %f", s)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	key := make([]byte, 16)
+	for i := 0; i < 50000; i++ {
+		rnd.Read(key)
+		r.Add(key)
+	}
+	if s := r.Skew(); s > 0.05 {
+		t.Fatalf("uniform keys have skew %f", s)
+	}
+
+	clustered, _ := ring.Init(100000, 0.01)
+	bits := clustered.Parameters().Bits
+	var indices []uint64
+	for i := 0; i < 50000; i++ {
+		indices = append(indices, uint64(rnd.Int63n(int64(bits/64))))
+	}
+	setBits(t, clustered, indices...)
+	if s := clustered.Skew(); s < 7 {
+		t.Fatalf("clustered keys have skew %f", s)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "sync/atomic"
+
+// Inverse is an inverse bloom filter: a fixed array of recently observed
+// hashes, for deduplicating recent data where dropping new data is worse than
+// missing a duplicate. Each data maps to a single slot holding the last hash
+// observed there, so a duplicate is missed once other data has displaced it,
+// while new data is reported as seen only if its 64-bit hash equals the one
+// stored in its slot, a probability of about 2^-64 per observation. It is safe
+// for concurrent use without locking.
+type Inverse struct {
+	slots []uint64 // last observed hash per slot, 0 if empty
+}
+
+// InitInverse initializes and returns a new inverse filter with capacity slots,
+// or an error. Each slot takes 8 bytes; duplicates are detected reliably while
+// the number of distinct data observed between them is well below capacity.
+func InitInverse(capacity int) (*Inverse, error) {
+	if _, err := elementCount(capacity); err != nil {
+		return nil, err
+	}
+	return &Inverse{slots: make([]uint64, capacity)}, nil
+}
+
+// Observe records the data and returns a bool if it was probably observed
+// before. True indicates that the data was observed before, barring a
+// collision of 64-bit hashes, while false indicates that it was not observed
+// or has since been displaced.
+func (v *Inverse) Observe(data []byte) bool {
+	hash := generateMultiHash(data)
+	value := hash[1]
+	if value == 0 {
+		// 0 marks an empty slot
+		value = 1
+	}
+	slot := &v.slots[hash[0]%uint64(len(v.slots))]
+	return atomic.SwapUint64(slot, value) == value
+}
+
+// Reset forgets every observed data. Observations concurrent with Reset may
+// survive it.
+func (v *Inverse) Reset() {
+	for i := range v.slots {
+		atomic.StoreUint64(&v.slots[i], 0)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// BenchmarkDedupRecent compares deduplicating a stream where a quarter of the
+// data repeats recently, with an Inverse filter and with a Ring.
+func BenchmarkDedupRecent(b *testing.B) {
+	b.Run("Inverse", func(b *testing.B) {
+		v, _ := ring.InitInverse(1 << 20)
+		buff := make([]byte, 4)
+		for i := 0; i < b.N; i++ {
+			intToByte(buff, i-i%4/3*100)
+			v.Observe(buff)
+		}
+	})
+	b.Run("Ring", func(b *testing.B) {
+		r, _ := ring.Init(1<<20, fpRate)
+		buff := make([]byte, 4)
+		for i := 0; i < b.N; i++ {
+			intToByte(buff, i-i%4/3*100)
+			if !r.Test(buff) {
+				r.Add(buff)
+			}
+		}
+	})
+}
+
+func TestInverse(t *testing.T) {
+	v, _ := ring.InitInverse(1000)
+	buff := make([]byte, 4)
+	for i := 0; i < 100000; i++ {
+		intToByte(buff, i)
+		if v.Observe(buff) {
+			t.Fatalf("new data %d reported as seen", i)
+		}
+		if !v.Observe(buff) {
+			t.Fatalf("data %d not seen immediately after", i)
+		}
+	}
+	v.Reset()
+	if v.Observe(buff) {
+		t.Fatal("data seen after Reset")
+	}
+	if _, err := ring.InitInverse(0); err == nil {
+		t.Fatal("zero capacity not captured")
+	}
+}
+
+// TestInverseConcurrent observes disjoint data from several goroutines,
+// ensuring new data is never reported as seen and each goroutine's repeat is
+// usually detected.
+func TestInverseConcurrent(t *testing.T) {
+	v, _ := ring.InitInverse(1 << 16)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			buff := make([]byte, 8)
+			missed := 0
+			for i := 0; i < 10000; i++ {
+				intToByte(buff, g)
+				intToByte(buff[4:], i)
+				if v.Observe(buff) {
+					t.Errorf("new data %d/%d reported as seen", g, i)
+					return
+				}
+				if !v.Observe(buff) {
+					// displaced by another goroutine in between
+					missed++
+				}
+			}
+			if missed > 100 {
+				t.Errorf("goroutine %d missed %d repeats", g, missed)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// MaxPrefixAddrs is the largest number of addresses AddPrefix adds, that of an
+// IPv4 /16 or an IPv6 /112.
+const MaxPrefixAddrs = 1 << 16
+
+var (
+	// ErrPrefix is returned by AddPrefix given an invalid prefix.
+	ErrPrefix = errors.New("error: prefix is invalid")
+	// ErrPrefixTooLarge is returned by AddPrefix given a prefix of more than
+	// MaxPrefixAddrs addresses.
+	ErrPrefixTooLarge = fmt.Errorf("error: prefix holds more than %d addresses", MaxPrefixAddrs)
+)
+
+// ipBytes returns the canonical encoding of the address: the 16 bytes of its
+// IPv6 form, IPv4 addresses being mapped to ::ffff:a.b.c.d, without its zone.
+// The zero Addr is encoded as no bytes, distinct from ::.
+func ipBytes(a netip.Addr, buf *[16]byte) []byte {
+	if !a.IsValid() {
+		return buf[:0]
+	}
+	*buf = a.As16()
+	return buf[:]
+}
+
+// AddIP adds the address to the ring. Addresses are added in a canonical
+// encoding, the 16 bytes of their IPv6 form, so an IPv4 address and its
+// IPv4-mapped IPv6 form, such as 192.0.2.1 and ::ffff:192.0.2.1, are the same
+// data. Zones are ignored.
+func (r *Ring) AddIP(a netip.Addr) {
+	var buf [16]byte
+	r.Add(ipBytes(a, &buf))
+}
+
+// TestIP returns a bool if the address is in the ring, in the encoding of
+// AddIP. True indicates that the address may be in the ring, while false
+// indicates that the address is not in the ring.
+func (r *Ring) TestIP(a netip.Addr) bool {
+	var buf [16]byte
+	return r.Test(ipBytes(a, &buf))
+}
+
+// AddPrefix adds every address of the prefix to the ring, as by AddIP, under a
+// single write lock per batch. The host bits of the prefix are ignored. It
+// returns an error matching ErrPrefix for an invalid prefix, or matching
+// ErrPrefixTooLarge for a prefix of more than MaxPrefixAddrs addresses, in
+// which case nothing is added. A zero Ring returns ErrUninitialized.
+func (r *Ring) AddPrefix(p netip.Prefix) error {
+	if r.set.Load() == nil {
+		return ErrUninitialized
+	}
+	if !p.IsValid() {
+		return fmt.Errorf("%w: %v", ErrPrefix, p)
+	}
+	p = p.Masked()
+	if host := p.Addr().BitLen() - p.Bits(); host > 16 {
+		return fmt.Errorf("%w: %v holds 2^%d", ErrPrefixTooLarge, p, host)
+	}
+	var buf [16]byte
+	batch := make([]Digest, 0, readBatch)
+	for a := p.Addr(); a.IsValid() && p.Contains(a); a = a.Next() {
+		batch = append(batch, NewDigest(ipBytes(a, &buf)))
+		if len(batch) == readBatch {
+			r.addBatch(batch)
+			batch = batch[:0]
+		}
+	}
+	r.addBatch(batch)
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestIP ensures the encodings of one address are the same data, and distinct
+// addresses are not.
+func TestIP(t *testing.T) {
+	r, _ := ring.New(1000, 0.0001)
+	r.AddIP(netip.MustParseAddr("192.0.2.1"))
+	r.AddIP(netip.MustParseAddr("2001:db8::1%eth0"))
+	for _, s := range []string{"192.0.2.1", "::ffff:192.0.2.1", "::ffff:c000:201", "2001:db8::1", "2001:db8::1%eth1"} {
+		if !r.TestIP(netip.MustParseAddr(s)) {
+			t.Errorf("%s missing", s)
+		}
+	}
+	for _, s := range []string{"192.0.2.2", "::192.0.2.1", "::c000:201", "64:ff9b::192.0.2.1", "2001:db8::2", "::"} {
+		if r.TestIP(netip.MustParseAddr(s)) {
+			t.Errorf("%s present", s)
+		}
+	}
+	if r.TestIP(netip.Addr{}) {
+		t.Error("zero Addr present")
+	}
+	r.AddIP(netip.Addr{})
+	if !r.TestIP(netip.Addr{}) || r.TestIP(netip.IPv6Unspecified()) {
+		t.Error("zero Addr is not distinct from ::")
+	}
+}
+
+// TestAddPrefix ensures every address of a prefix is added, in both families,
+// and that prefixes beyond MaxPrefixAddrs are rejected without adding.
+func TestAddPrefix(t *testing.T) {
+	r, _ := ring.New(100000, 0.0001)
+	for _, s := range []string{"10.1.2.3/24", "2001:db8::/112", "::ffff:172.16.0.0/124", "198.51.100.7/32"} {
+		if err := r.AddPrefix(netip.MustParsePrefix(s)); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"10.1.2.0", "10.1.2.255", "::ffff:10.1.2.128", "2001:db8::ffff", "172.16.0.15", "198.51.100.7"} {
+		if !r.TestIP(netip.MustParseAddr(s)) {
+			t.Errorf("%s missing", s)
+		}
+	}
+	for _, s := range []string{"10.1.3.0", "10.1.1.255", "2001:db8::1:0", "172.16.0.16", "198.51.100.8"} {
+		if r.TestIP(netip.MustParseAddr(s)) {
+			t.Errorf("%s present", s)
+		}
+	}
+
+	// the largest prefixes are added up to their last address
+	full, _ := ring.New(ring.MaxPrefixAddrs, 0.001)
+	if err := full.AddPrefix(netip.MustParsePrefix("255.255.0.0/16")); err != nil {
+		t.Fatal(err)
+	}
+	if !full.TestIP(netip.MustParseAddr("255.255.255.255")) {
+		t.Error("last address of the prefix missing")
+	}
+
+	empty, _ := ring.New(1000, 0.01)
+	for _, s := range []string{"10.0.0.0/15", "0.0.0.0/0", "2001:db8::/111", "::/0"} {
+		if err := empty.AddPrefix(netip.MustParsePrefix(s)); !errors.Is(err, ring.ErrPrefixTooLarge) {
+			t.Errorf("%s: expected ErrPrefixTooLarge, got %v", s, err)
+		}
+	}
+	if err := empty.AddPrefix(netip.Prefix{}); !errors.Is(err, ring.ErrPrefix) {
+		t.Errorf("expected ErrPrefix, got %v", err)
+	}
+	if fresh, _ := ring.New(1000, 0.01); !empty.Equal(fresh) {
+		t.Error("rejected prefixes added to the ring")
+	}
+	if err := new(ring.Ring).AddPrefix(netip.MustParsePrefix("10.0.0.0/24")); !errors.Is(err, ring.ErrUninitialized) {
+		t.Errorf("expected ErrUninitialized, got %v", err)
+	}
+}
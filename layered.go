@@ -0,0 +1,147 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// ErrLayers is returned by InitLayered given no layers.
+var ErrLayers = errors.New("error: layers must be greater than 0")
+
+// Layered is a layered bloom filter, which answers whether data was seen at
+// least n times, for small n, with a ring per count rather than a counter per
+// bit. Adding data sets it in the lowest layer that does not yet hold it, so
+// data added n times is held by the first n layers.
+//
+// Each layer reports data it does not hold at the false positive rate of a
+// ring, so data can be promoted past its true count: data added once reaches
+// the second layer at about that rate.
+type Layered struct {
+	params             // parameters shared by every layer
+	layers []*Ring     // layers, lowest first
+	mutex  *sync.Mutex // mutex serializing promotions
+}
+
+// InitLayered initializes and returns a new layered ring of layers rings, or an
+// error. Each layer is sized like Init, for elements within a falsePositive
+// rate.
+func InitLayered(elements int, falsePositive float64, layers int) (*Layered, error) {
+	var layersErr error
+	if layers <= 0 {
+		layersErr = fmt.Errorf("%w, got %d", ErrLayers, layers)
+	}
+	_, err := checkArgs(elements, falsePositive)
+	if err := joinErrors(layersErr, err); err != nil {
+		return nil, err
+	}
+	l := &Layered{mutex: &sync.Mutex{}}
+	for i := 0; i < layers; i++ {
+		r, err := Init(elements, falsePositive)
+		if err != nil {
+			return nil, err
+		}
+		l.layers = append(l.layers, r)
+	}
+	l.params = l.layers[0].params
+	return l, nil
+}
+
+// Add adds the data to the lowest layer not holding it, and returns the number
+// of layers now holding it: the number of times it was added, up to the number
+// of layers. Data hashes once for all layers.
+func (l *Layered) Add(data []byte) int {
+	var buf [32]uint64
+	hash := l.rounds(data)
+	indices := l.indices(&hash, buf[:0])
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, r := range l.layers {
+		if !r.testIndices(l.params, indices) {
+			r.addHashed(l.params, &hash)
+			return i + 1
+		}
+	}
+	return len(l.layers)
+}
+
+// TestAtLeast returns a bool if the data may have been added at least n times.
+// False indicates that the data was added fewer than n times, while true may be
+// caused by false positives in the layers. For n above the number of layers it
+// is only true if the data reached every layer.
+func (l *Layered) TestAtLeast(data []byte, n int) bool {
+	if n > len(l.layers) {
+		n = len(l.layers)
+	}
+	if n < 1 {
+		return true
+	}
+	var buf [32]uint64
+	hash := l.rounds(data)
+	indices := l.indices(&hash, buf[:0])
+	// promotion fills layers in order, so every layer below n must hold it
+	for _, r := range l.layers[:n] {
+		if !r.testIndices(l.params, indices) {
+			return false
+		}
+	}
+	return true
+}
+
+// Test returns a bool if the data is in the ring, having been added at least
+// once.
+func (l *Layered) Test(data []byte) bool {
+	return l.TestAtLeast(data, 1)
+}
+
+// Reset clears every layer.
+func (l *Layered) Reset() {
+	l.mutex.Lock()
+	for _, r := range l.layers {
+		r.Reset()
+	}
+	l.mutex.Unlock()
+}
+
+// Merge merges each layer of the sent Layered into the same layer of its own.
+// The rings must have the same parameters and number of layers.
+//
+// The result is an approximation, as counts are not added: data added twice to
+// one ring and once to the other is held by two layers of the result, not
+// three. Counts in the result are the largest of the counts in either ring, so
+// TestAtLeast can report false for data added n times across both.
+func (l *Layered) Merge(m *Layered) error {
+	if l == nil || m == nil {
+		return ErrNilRing
+	}
+	if l == m {
+		return nil
+	}
+	if err := l.compatible(m.params); err != nil {
+		return err
+	}
+	if len(l.layers) != len(m.layers) {
+		return &IncompatibleError{"layers", uint64(len(l.layers)), uint64(len(m.layers))}
+	}
+	// lock in address order, as in Ring.MergeContext
+	if uintptr(unsafe.Pointer(l)) < uintptr(unsafe.Pointer(m)) {
+		l.mutex.Lock()
+		m.mutex.Lock()
+	} else {
+		m.mutex.Lock()
+		l.mutex.Lock()
+	}
+	defer l.mutex.Unlock()
+	defer m.mutex.Unlock()
+	for i, r := range l.layers {
+		if err := r.Merge(m.layers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// BenchmarkLayeredAdd tests adding elements to a 4-layer Layered ring.
+func BenchmarkLayeredAdd(b *testing.B) {
+	l, _ := ring.InitLayered(tests, fpRate, 4)
+	buff := make([]byte, 4)
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i%(tests/4))
+		l.Add(buff)
+	}
+}
+
+// TestLayeredThresholds adds data known numbers of times, ensuring each
+// reaches exactly its layer, and that data added once is falsely promoted at
+// no more than the per-layer false positive rate.
+func TestLayeredThresholds(t *testing.T) {
+	const n, layers = 100000, 4
+	l, _ := ring.InitLayered(n, fpRate, layers)
+	buff := make([]byte, 4)
+	promoted := 0
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		// data i is added i%6 times
+		for times := 1; times <= i%6; times++ {
+			reached := l.Add(buff)
+			expected := times
+			if expected > layers {
+				expected = layers
+			}
+			if reached < expected {
+				t.Fatalf("data %d added %d times reached layer %d", i, times, reached)
+			}
+			if reached > expected && times == 1 {
+				promoted++
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		for k := 1; k <= i%6 && k <= layers; k++ {
+			if !l.TestAtLeast(buff, k) {
+				t.Fatalf("data %d added %d times not at least %d", i, i%6, k)
+			}
+		}
+	}
+	if rate := float64(promoted) / (n * 5 / 6); rate > fpRate {
+		t.Fatalf("false promotion rate %f exceeds %f", rate, fpRate)
+	}
+
+	// data added fewer times is rejected at the next layer, barring false
+	// positives
+	rejected := 0
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		if i%6 < layers && !l.TestAtLeast(buff, i%6+1) {
+			rejected++
+		}
+	}
+	if rate := 1 - float64(rejected)/(n*4/6); rate > 2*fpRate {
+		t.Fatalf("false threshold rate %f exceeds %f", rate, 2*fpRate)
+	}
+	if !l.TestAtLeast(buff, 0) || l.TestAtLeast([]byte("missing"), layers+1) {
+		t.Fatal("unexpected result for thresholds outside the layers")
+	}
+}
+
+func TestLayeredResetMerge(t *testing.T) {
+	l, _ := ring.InitLayered(1000, fpRate, 3)
+	m, _ := ring.InitLayered(1000, fpRate, 3)
+	a, b := []byte("a"), []byte("b")
+	l.Add(a)
+	l.Add(a)
+	m.Add(a)
+	m.Add(b)
+	if err := l.Merge(m); err != nil {
+		t.Fatal(err)
+	}
+	// counts are the largest of either ring, not their sum
+	if !l.TestAtLeast(a, 2) || l.TestAtLeast(a, 3) || !l.Test(b) || l.TestAtLeast(b, 2) {
+		t.Fatal("unexpected counts after Merge")
+	}
+	other, _ := ring.InitLayered(1000, fpRate, 2)
+	if l.Merge(other) == nil || l.Merge(nil) == nil || l.Merge(l) != nil {
+		t.Fatal("unexpected Merge result")
+	}
+	l.Reset()
+	if l.Test(a) || l.Add(a) != 1 {
+		t.Fatal("data present after Reset")
+	}
+	if _, err := ring.InitLayered(1000, fpRate, 0); err == nil {
+		t.Fatal("zero layers not captured")
+	}
+}
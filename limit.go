@@ -0,0 +1,44 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrMemoryLimit is returned by New, Init, InitUint and UnmarshalBinary when
+// the bit array of a ring would exceed the limit set by WithMaxMemory or
+// SetDefaultMaxMemory. It matches ErrTooLarge too.
+var ErrMemoryLimit = fmt.Errorf("%w for the memory limit", ErrTooLarge)
+
+// defaultMaxMemory is the limit of rings without WithMaxMemory, 0 for none.
+var defaultMaxMemory atomic.Uint64
+
+// SetDefaultMaxMemory limits the bit array of rings to maxBytes bytes, as
+// WithMaxMemory, for rings created afterwards without WithMaxMemory and for
+// UnmarshalBinary into such rings, including zero Rings. A limit of 0, the
+// default, leaves bit arrays limited only by the platform. It returns the
+// previous limit, and is safe to call concurrently.
+func SetDefaultMaxMemory(maxBytes uint64) uint64 {
+	return defaultMaxMemory.Swap(maxBytes)
+}
+
+// memoryLimit returns the limit of the ring's bit array in bytes, 0 for none.
+func (r *Ring) memoryLimit() uint64 {
+	if r.maxMemory != 0 {
+		return r.maxMemory
+	}
+	return defaultMaxMemory.Load()
+}
+
+// checkMemory returns ErrMemoryLimit if the bit array of a ring of size bits
+// exceeds limit bytes, unless limit is 0.
+func checkMemory(size, limit uint64) error {
+	if limit != 0 && size/8+1 > limit {
+		return fmt.Errorf("%w: bit array of %d bytes exceeds %d bytes", ErrMemoryLimit, size/8+1, limit)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestWithMaxMemory ensures New rejects rings beyond the limit with
+// ErrMemoryLimit, reporting the size of their bit array, and accepts rings
+// within it.
+func TestWithMaxMemory(t *testing.T) {
+	m, _, _ := ring.EstimateParameters(100000, 0.01)
+	length := m/8 + 1
+	_, err := ring.New(100000, 0.01, ring.WithMaxMemory(length-1))
+	if !errors.Is(err, ring.ErrMemoryLimit) || !errors.Is(err, ring.ErrTooLarge) {
+		t.Fatalf("expected ErrMemoryLimit, got %v", err)
+	}
+	if !strings.Contains(err.Error(), strconv.FormatUint(length, 10)+" bytes") {
+		t.Fatalf("%q does not hold the size of %d bytes", err, length)
+	}
+	if _, err := ring.New(100000, 0.01, ring.WithMaxMemory(length)); err != nil {
+		t.Fatalf("ring at the limit rejected: %v", err)
+	}
+}
+
+// TestSetDefaultMaxMemory ensures the default limit applies to rings without
+// their own, which WithMaxMemory overrides, and that no limit is the default.
+func TestSetDefaultMaxMemory(t *testing.T) {
+	if previous := ring.SetDefaultMaxMemory(4096); previous != 0 {
+		t.Fatalf("default limit %d, expected none", previous)
+	}
+	defer ring.SetDefaultMaxMemory(0)
+	if _, err := ring.New(100000, 0.01); !errors.Is(err, ring.ErrMemoryLimit) {
+		t.Fatalf("expected ErrMemoryLimit, got %v", err)
+	}
+	if _, err := ring.Init(1000, 0.01); err != nil {
+		t.Fatalf("ring within the default limit rejected: %v", err)
+	}
+	if _, err := ring.New(100000, 0.01, ring.WithMaxMemory(1<<20)); err != nil {
+		t.Fatalf("WithMaxMemory does not override the default: %v", err)
+	}
+	if previous := ring.SetDefaultMaxMemory(0); previous != 4096 {
+		t.Fatalf("previous limit %d, expected 4096", previous)
+	}
+	if _, err := ring.New(100000, 0.01); err != nil {
+		t.Fatalf("ring rejected without a limit: %v", err)
+	}
+}
+
+// TestUnmarshalMaxMemory ensures UnmarshalBinary rejects data of rings beyond
+// the limit from the header alone, leaving the receiver unchanged, and that
+// without a limit an inflated header is still only truncated.
+func TestUnmarshalMaxMemory(t *testing.T) {
+	large, _ := ring.Init(100000, 0.01)
+	data, _ := large.MarshalBinary()
+	r, _ := ring.New(100, 0.01, ring.WithMaxMemory(1024))
+	r.Add([]byte("data"))
+	if err := r.UnmarshalBinary(data); !errors.Is(err, ring.ErrMemoryLimit) {
+		t.Fatalf("expected ErrMemoryLimit, got %v", err)
+	}
+	if !r.Test([]byte("data")) || r.Parameters().Bits == large.Parameters().Bits {
+		t.Fatal("receiver changed")
+	}
+
+	// a header claiming 64MB, followed by a few bytes of bits
+	small, _ := ring.Init(100, 0.01)
+	inflated, _ := small.MarshalBinary()
+	binary.BigEndian.PutUint64(inflated[1:9], 8<<26)
+	if err := new(ring.Ring).UnmarshalBinary(inflated); !errors.Is(err, ring.ErrTruncated) {
+		t.Fatalf("without a limit: expected ErrTruncated, got %v", err)
+	}
+	ring.SetDefaultMaxMemory(1 << 20)
+	defer ring.SetDefaultMaxMemory(0)
+	err := new(ring.Ring).UnmarshalBinary(inflated)
+	if !errors.Is(err, ring.ErrMemoryLimit) || !strings.Contains(err.Error(), strconv.Itoa(1<<26+1)+" bytes") {
+		t.Fatalf("expected ErrMemoryLimit for %d bytes, got %v", 1<<26+1, err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "runtime"
+
+const (
+	// spinActive is the number of attempts to take the write lock, each
+	// followed by a short busy wait, before an adaptive lock starts yielding.
+	spinActive = 16
+	// spinPassive is the number of further attempts, each followed by a yield
+	// of the processor, before an adaptive lock blocks on the mutex.
+	spinPassive = 16
+	// spinPause is the number of iterations of each busy wait.
+	spinPause = 32
+)
+
+// lock takes the write lock, spinning first if the ring uses an adaptive lock.
+// Rings using WithNoLock take no lock.
+func (r *Ring) lock() {
+	if r.noLock {
+		return
+	}
+	if r.adaptive {
+		r.spinLock()
+		return
+	}
+	r.mutex.Lock()
+}
+
+// unlock advances the version of the ring and releases the write lock taken by
+// lock, and then calls the saturation warnings the write crossed.
+func (r *Ring) unlock() {
+	r.version.Add(1)
+	if !r.noLock {
+		r.mutex.Unlock()
+	}
+	if r.saturation != nil {
+		r.warnSaturation()
+	}
+}
+
+// spinLock takes the write lock, retrying for a bounded number of attempts
+// with backoff before parking on the mutex. Write critical sections are far
+// shorter than parking and waking a goroutine, so the lock is usually free
+// again within a few attempts.
+func (r *Ring) spinLock() {
+	for i := 0; i < spinActive; i++ {
+		if r.mutex.TryLock() {
+			return
+		}
+		pause(spinPause << (i / 4))
+	}
+	for i := 0; i < spinPassive; i++ {
+		if r.mutex.TryLock() {
+			return
+		}
+		runtime.Gosched()
+	}
+	r.mutex.Lock()
+}
+
+// pause busy waits for n iterations.
+//
+//go:noinline
+func pause(n int) {
+	for i := 0; i < n; i++ {
+	}
+}
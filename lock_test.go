@@ -0,0 +1,88 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// benchmarkContention measures Add with parallelism writers per GOMAXPROCS,
+// with and without an adaptive lock.
+func benchmarkContention(b *testing.B, parallelism int) {
+	for _, tc := range []struct {
+		name string
+		opts []ring.Option
+	}{
+		{"Mutex", nil},
+		{"Adaptive", []ring.Option{ring.WithAdaptiveLock()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			r, _ := ring.Init(tests, fpRate, tc.opts...)
+			var next int64
+			b.SetParallelism(parallelism)
+			b.RunParallel(func(pb *testing.PB) {
+				buff := make([]byte, 4)
+				for pb.Next() {
+					intToByte(buff, int(atomic.AddInt64(&next, 1)))
+					r.Add(buff)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkAddUncontended measures Add from a single goroutine.
+func BenchmarkAddUncontended(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []ring.Option
+	}{
+		{"Mutex", nil},
+		{"Adaptive", []ring.Option{ring.WithAdaptiveLock()}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			r, _ := ring.Init(tests, fpRate, tc.opts...)
+			buff := make([]byte, 4)
+			for i := 0; i < b.N; i++ {
+				intToByte(buff, i)
+				r.Add(buff)
+			}
+		})
+	}
+}
+
+func BenchmarkAddContentionLow(b *testing.B)    { benchmarkContention(b, 1) }
+func BenchmarkAddContentionMedium(b *testing.B) { benchmarkContention(b, 4) }
+func BenchmarkAddContentionHigh(b *testing.B)   { benchmarkContention(b, 16) }
+
+// TestAdaptiveLock ensures concurrent Adds through an adaptive lock are all
+// observed.
+func TestAdaptiveLock(t *testing.T) {
+	r, _ := ring.Init(100000, fpRate, ring.WithAdaptiveLock())
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buff := make([]byte, 4)
+			for j := i; j < 80000; j += 8 {
+				intToByte(buff, j)
+				r.Add(buff)
+			}
+		}(i)
+	}
+	wg.Wait()
+	buff := make([]byte, 4)
+	for j := 0; j < 80000; j++ {
+		intToByte(buff, j)
+		if !r.Test(buff) {
+			t.Fatalf("data %d missing", j)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+// logLevel is the level of an event, with the values of the levels of
+// log/slog.
+type logLevel int
+
+const (
+	levelDebug logLevel = -4
+	levelInfo  logLevel = 0
+	levelWarn  logLevel = 4
+)
+
+// logFunc logs an event with the alternating keys and values of args, as
+// slog.Logger.Log. The package depends on log/slog only where it is
+// available, through WithLogger.
+type logFunc func(level logLevel, msg string, args ...interface{})
+
+// eventLog logs the events of a ring. Rings without WithLogger have none, so
+// each event costs a nil check.
+type eventLog struct {
+	name string  // name of WithName
+	fn   logFunc // logger of WithLogger
+}
+
+// newEventLog returns the eventLog of a ring named name logging with fn, or
+// nil if fn is nil.
+func newEventLog(name string, fn logFunc) *eventLog {
+	if fn == nil {
+		return nil
+	}
+	return &eventLog{name: name, fn: fn}
+}
+
+// WithName names the ring in the events of WithLogger, as the attribute
+// "ring".
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// logEvent logs an event of the ring with the attributes of args after its
+// name and version. It must be called without the write lock held, and only
+// if the ring has an eventLog, which callers check first so no arguments are
+// built otherwise.
+func (r *Ring) logEvent(level logLevel, msg string, args ...interface{}) {
+	attrs := make([]interface{}, 0, 4+len(args))
+	if r.log.name != "" {
+		attrs = append(attrs, "ring", r.log.name)
+	}
+	attrs = append(attrs, "version", r.Version())
+	r.log.fn(level, msg, append(attrs, args...)...)
+}
+
+// logLoaded logs the outcome of UnmarshalBinary of data.
+func (r *Ring) logLoaded(data []byte, err error) {
+	if err != nil {
+		r.logEvent(levelWarn, "ring load failed", "error", err)
+		return
+	}
+	// rings are marshaled in the earliest format holding their parameters
+	var buf [maxHeader]byte
+	args := []interface{}{"format", int(data[0])}
+	if marshaled := r.set.Load().header(&buf)[0]; marshaled != data[0] {
+		args = append(args, "marshaled_format", int(marshaled))
+	}
+	r.logEvent(levelInfo, "ring loaded", args...)
+}
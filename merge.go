@@ -0,0 +1,268 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// parallelBytes is the minimum bit array size before Merge splits the work
+	// across multiple goroutines.
+	parallelBytes = 1 << 19
+	// mergeBatch is the number of bytes OR'd between cancellation checks.
+	mergeBatch = 1 << 16
+)
+
+var (
+	// ErrIncompatible is matched, with errors.Is, by the errors of merging
+	// rings of different parameters. The error itself is an
+	// *IncompatibleError naming the parameter that differs.
+	ErrIncompatible = errors.New("error: rings must have the same m/k parameters and mode")
+
+	// ErrNilRing is returned by operations of two rings, such as Merge, when
+	// either the receiver or the sent ring is nil.
+	ErrNilRing = errors.New("error: ring must not be nil")
+)
+
+// IncompatibleError describes the first parameter found to differ between two
+// rings that must share their parameters, such as in Merge. It unwraps to
+// ErrIncompatible.
+type IncompatibleError struct {
+	Field    string // name of the parameter, such as "size" or "hash"
+	Receiver uint64 // value of the receiver, or of the first ring
+	Argument uint64 // value of the sent ring
+}
+
+// Error implements the error interface.
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("error: rings differ in %s: %d and %d", e.Field, e.Receiver, e.Argument)
+}
+
+// Unwrap returns ErrIncompatible.
+func (e *IncompatibleError) Unwrap() error {
+	return ErrIncompatible
+}
+
+// compatible returns an *IncompatibleError for the first of the size, hash
+// rounds, mode flags and seed differing between p and m, or nil. The remaining
+// parameters are derived from these.
+func (p params) compatible(m params) error {
+	switch {
+	case p.size != m.size:
+		return &IncompatibleError{"size", p.size, m.size}
+	case p.hash != m.hash:
+		return &IncompatibleError{"hash", p.hash, m.hash}
+	case p.flags != m.flags:
+		return &IncompatibleError{"flags", uint64(p.flags), uint64(m.flags)}
+	case p.seed != m.seed:
+		return &IncompatibleError{"seed", p.seed, m.seed}
+	}
+	return nil
+}
+
+// Merge merges the sent Ring into itself. It is equivalent to MergeContext with
+// a background context.
+func (r *Ring) Merge(m *Ring) error {
+	return r.MergeContext(context.Background(), m)
+}
+
+// MergeAll merges each of the sent Rings into itself. All Rings are validated
+// before any is merged, so a mismatched Ring leaves the receiver untouched. As
+// with Merge, the receiver itself may appear in the list and is skipped.
+func (r *Ring) MergeAll(rings ...*Ring) error {
+	if r == nil {
+		return ErrNilRing
+	}
+	for _, m := range rings {
+		if m == nil {
+			return ErrNilRing
+		}
+		if r.set.Load() == nil || m.set.Load() == nil {
+			return ErrUninitialized
+		}
+		if err := r.set.Load().compatible(m.set.Load().params); err != nil {
+			return err
+		}
+	}
+	for _, m := range rings {
+		if err := r.Merge(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeContext merges the sent Ring into itself. Parameters are validated
+// before any bits are touched, and large rings are OR'd in parallel across
+// GOMAXPROCS goroutines. Merging a Ring into itself is a documented no-op
+// returning nil; it never takes the locks, so it cannot self-deadlock.
+//
+// The merge is all-or-nothing: chunks of the bit array changed by the merge are
+// built in scratch memory and published together once complete, so concurrent
+// Test operations observe either none or all of the sent Ring, and a merge
+// cancelled part way returns ctx.Err() and leaves the receiver untouched. The
+// merge therefore temporarily needs memory for a second copy of the changed
+// chunks, and of the whole sent Ring if it uses WithFastReset.
+func (r *Ring) MergeContext(ctx context.Context, m *Ring) (err error) {
+	if r == nil || m == nil {
+		return ErrNilRing
+	}
+	if r == m {
+		return nil
+	}
+	if r.set.Load() == nil || m.set.Load() == nil {
+		return ErrUninitialized
+	}
+	if err := r.set.Load().compatible(m.set.Load().params); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.log != nil {
+		defer func() {
+			if err == nil {
+				r.logEvent(levelDebug, "ring merged", "fill", r.Stats().Fill)
+			}
+		}()
+	}
+	defer r.warnSaturation()
+	// lock in address order, so rings merging into each other concurrently
+	// cannot deadlock
+	if uintptr(unsafe.Pointer(r)) < uintptr(unsafe.Pointer(m)) {
+		r.mutex.Lock()
+		m.mutex.RLock()
+	} else {
+		m.mutex.RLock()
+		r.mutex.Lock()
+	}
+	defer r.mutex.Unlock()
+	defer m.mutex.RUnlock()
+
+	rb, mb := r.set.Load(), m.set.Load()
+	// either ring may have been replaced by UnmarshalBinary in the meantime
+	if err := rb.compatible(mb.params); err != nil {
+		return err
+	}
+	// with WithFastReset, blocks from an earlier epoch hold stale bits, so the
+	// receiver is brought up to date and the sent ring read from a copy
+	rb.normalize()
+	mb = mb.logical()
+	// changed chunks are written to scratch chunks, so lock-free readers
+	// observe the merge all at once when the new bitset is published
+	dst := &bitset{
+		params:  rb.params,
+		chunks:  make([][]uint8, len(rb.chunks)),
+		mapped:  make([]bool, len(rb.chunks)),
+		offHeap: rb.offHeap,
+		length:  rb.length,
+		summary: newBytes(uint64(len(rb.summary))),
+		stamps:  rb.stamps,
+		epoch:   rb.epoch,
+	}
+	if err := mergeChunks(ctx, dst, rb, mb); err != nil {
+		dst.release(rb)
+		return err
+	}
+	for i := range dst.summary {
+		dst.summary[i] = rb.summary[i] | mb.summary[i]
+	}
+	r.set.Store(dst)
+	r.version.Add(1)
+	r.countSetBits(dst)
+	r.dropDigests()
+	r.truncateUpdates()
+	r.invalidateTruth()
+	rb.release(dst)
+	r.countMerge()
+	return nil
+}
+
+// mergeChunks stores the union of the chunks of a and b into the empty chunk
+// table of dst. Unchanged chunks of a are shared with dst, while changed chunks
+// are written to new chunks. Chunks of b are never shared, as b remains in use.
+func mergeChunks(ctx context.Context, dst, a, b *bitset) error {
+	for i, bc := range b.chunks {
+		ac := a.chunks[i]
+		switch {
+		case bc == nil:
+			dst.chunks[i], dst.mapped[i] = ac, a.mapped[i]
+		case ac == nil:
+			c := dst.newChunk(i)
+			dst.chunks[i] = c
+			copy(c, bc)
+		default:
+			c := dst.newChunk(i)
+			dst.chunks[i] = c
+			if err := orBits(ctx, c, ac, bc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// orBits stores a|b into dst, splitting the work into contiguous chunks across
+// GOMAXPROCS goroutines. It returns ctx.Err() if ctx is done
+// before all bytes were OR'd, in which case dst is partially written.
+func orBits(ctx context.Context, dst, a, b []uint8) error {
+	workers := runtime.GOMAXPROCS(0)
+	if len(b) < parallelBytes || workers < 2 {
+		return orChunk(ctx, dst, a, b)
+	}
+
+	chunk := (len(b) + workers - 1) / workers
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start := w * chunk
+		if start >= len(b) {
+			break
+		}
+		end := start + chunk
+		if end > len(b) {
+			end = len(b)
+		}
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			errs[w] = orChunk(ctx, dst[start:end], a[start:end], b[start:end])
+		}(w, start, end)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orChunk stores a|b into dst in batches, checking ctx between each batch.
+func orChunk(ctx context.Context, dst, a, b []uint8) error {
+	dst, a = dst[:len(b)], a[:len(b)]
+	for start := 0; start < len(b); start += mergeBatch {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		end := start + mergeBatch
+		if end > len(b) {
+			end = len(b)
+		}
+		for i := start; i < end; i++ {
+			dst[i] = a[i] | b[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,483 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// mergeElements sizes rings large enough to be merged in parallel.
+const mergeElements = 500000
+
+// cancelAfter is a context that is cancelled once Done has been called more
+// than n times, simulating a cancellation part way through a merge.
+type cancelAfter struct {
+	context.Context
+	n    int32
+	ch   chan struct{}
+	once sync.Once
+}
+
+func newCancelAfter(n int32) *cancelAfter {
+	return &cancelAfter{Context: context.Background(), n: n, ch: make(chan struct{})}
+}
+
+func (c *cancelAfter) Done() <-chan struct{} {
+	if atomic.AddInt32(&c.n, -1) < 0 {
+		c.once.Do(func() { close(c.ch) })
+	}
+	return c.ch
+}
+
+func (c *cancelAfter) Err() error {
+	select {
+	case <-c.ch:
+		return context.Canceled
+	default:
+		return nil
+	}
+}
+
+// BenchmarkMerge merges two populated 1GB rings with 1, 2, 4 and up to
+// NumCPU goroutines, so the scaling of the parallel merge is measured. It is
+// skipped unless RING_BENCH_LARGE is set, as it allocates over 3GB.
+func BenchmarkMerge(b *testing.B) {
+	if os.Getenv("RING_BENCH_LARGE") == "" {
+		b.Skip("set RING_BENCH_LARGE to merge 1GB rings")
+	}
+	// 1GB of bits at 0.1% false positives
+	elements := (1 << 33) / 14
+	r, err := ring.Init(elements, fpRate)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r2, err := ring.Init(elements, fpRate)
+	if err != nil {
+		b.Fatal(err)
+	}
+	// random data reaches every chunk, so none is merged by sharing it
+	data := make([]byte, 16)
+	for i := 0; i < 100000; i++ {
+		rand.Read(data)
+		r.Add(data)
+		rand.Read(data)
+		r2.Add(data)
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for procs := 1; ; procs *= 2 {
+		if procs > runtime.NumCPU() {
+			procs = runtime.NumCPU()
+		}
+		b.Run(fmt.Sprintf("procs=%d", procs), func(b *testing.B) {
+			runtime.GOMAXPROCS(procs)
+			b.SetBytes(int64(r.MarshaledSize()))
+			for i := 0; i < b.N; i++ {
+				if err := r.Merge(r2); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		if procs == runtime.NumCPU() {
+			break
+		}
+	}
+}
+
+// TestMergeParallel ensures a parallel Merge produces the right Ring.
+func TestMergeParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	for _, ctx := range []context.Context{context.Background(), newCancelAfter(1 << 20)} {
+		r, _ := ring.Init(mergeElements, fpRate)
+		r2, _ := ring.Init(mergeElements, fpRate)
+		elems := make([][]byte, 10000)
+		for i := range elems {
+			elems[i] = make([]byte, 16)
+			rand.Read(elems[i])
+			if i%2 == 0 {
+				r.Add(elems[i])
+			} else {
+				r2.Add(elems[i])
+			}
+		}
+		if err := r.MergeContext(ctx, r2); err != nil {
+			t.Fatalf("Error calling Merge: %v", err)
+		}
+		for i, el := range elems {
+			if !r.Test(el) {
+				t.Fatalf("Element %d not found after Merge", i)
+			}
+		}
+	}
+}
+
+// TestMergeContextCancelled ensures a cancelled MergeContext reports the
+// context error and leaves the receiver untouched, whether cancelled before or
+// part way through the merge.
+func TestMergeContextCancelled(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	r, _ := ring.Init(mergeElements, fpRate)
+	r2, _ := ring.Init(mergeElements, fpRate)
+	r.Add([]byte("receiver"))
+	elems := make([][]byte, 10000)
+	for i := range elems {
+		elems[i] = make([]byte, 16)
+		rand.Read(elems[i])
+		r2.Add(elems[i])
+	}
+	before, _ := r.MarshalBinary()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for name, ctx := range map[string]context.Context{
+		"before": cancelled,
+		"during": newCancelAfter(4),
+	} {
+		if err := r.MergeContext(ctx, r2); err != context.Canceled {
+			t.Fatalf("%s: expected context.Canceled, got %v", name, err)
+		}
+		after, _ := r.MarshalBinary()
+		if !bytes.Equal(before, after) {
+			t.Fatalf("%s: cancelled MergeContext modified the receiver", name)
+		}
+		for _, el := range elems {
+			if r.Test(el) {
+				t.Fatalf("%s: cancelled MergeContext partially merged", name)
+			}
+		}
+	}
+
+	// different params are rejected before the context is consulted
+	r3, _ := ring.Init(100, fpRate)
+	if err := r.MergeContext(cancelled, r3); err == nil || err == context.Canceled {
+		t.Fatalf("Expected parameter error, got %v", err)
+	}
+}
+
+// TestMergeNil ensures merging a nil Ring errors and merging a Ring into itself
+// is a no-op.
+func TestMergeNil(t *testing.T) {
+	r, _ := ring.Init(100, fpRate)
+	if r.Merge(nil) == nil {
+		t.Fatal("Expected error calling Merge with nil")
+	}
+	data := []byte("hello")
+	r.Add(data)
+	if err := r.Merge(r); err != nil {
+		t.Fatalf("Unexpected error calling Merge with itself: %v", err)
+	}
+	if !r.Test(data) {
+		t.Fatal("Data missing after merging into itself")
+	}
+}
+
+// TestMergeNilReceiver ensures every operation of two rings returns ErrNilRing
+// for a nil argument or receiver, rather than panicking.
+func TestMergeNilReceiver(t *testing.T) {
+	r, _ := ring.Init(100, fpRate)
+	c, _ := ring.InitCounting(100, fpRate)
+	m, _ := ring.InitCountMin(0.01, 0.01)
+	l, _ := ring.InitLayered(100, fpRate, 2)
+	q, _ := ring.InitQuotient(100, 8)
+	s, _ := ring.InitRingSet(2, 100, fpRate)
+	var (
+		nr *ring.Ring
+		nc *ring.CountingRing
+		nm *ring.CountMin
+		nl *ring.Layered
+		nq *ring.Quotient
+		ns *ring.RingSet
+	)
+	for name, err := range map[string]error{
+		"Merge":                 r.Merge(nil),
+		"Merge receiver":        nr.Merge(r),
+		"Merge both":            nr.Merge(nil),
+		"MergeAll":              r.MergeAll(r, nil),
+		"MergeAll receiver":     nr.MergeAll(r),
+		"MergeContext":          r.MergeContext(context.Background(), nil),
+		"AddToAll":              ring.AddToAll([]byte("data"), r, nil),
+		"CountingRing":          c.Merge(nil),
+		"CountingRing receiver": nc.Merge(c),
+		"CountingRing both":     nc.Merge(nil),
+		"CountMin":              m.Merge(nil),
+		"CountMin receiver":     nm.Merge(m),
+		"Layered":               l.Merge(nil),
+		"Layered receiver":      nl.Merge(l),
+		"Quotient":              q.Merge(nil),
+		"Quotient receiver":     nq.Merge(q),
+		"RingSet":               s.Merge(nil),
+		"RingSet receiver":      ns.Merge(s),
+	} {
+		if !errors.Is(err, ring.ErrNilRing) {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+	}
+	if r.Equal(nil) || nr.Equal(r) || !nr.Equal(nil) {
+		t.Fatal("nil ring equal to a ring")
+	}
+}
+
+// TestMergeAtomic ensures concurrent Test calls observe either none or all of
+// a merge: once the later of two merged elements is seen, the earlier one must
+// be seen too.
+func TestMergeAtomic(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	for _, ctx := range []context.Context{context.Background(), newCancelAfter(1 << 20)} {
+		r, _ := ring.Init(mergeElements, fpRate)
+		rounds := 20
+		pairs := make([][2][]byte, rounds)
+		for i := range pairs {
+			for j := range pairs[i] {
+				pairs[i][j] = make([]byte, 16)
+				rand.Read(pairs[i][j])
+			}
+		}
+
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					for _, p := range pairs {
+						if r.Test(p[1]) && !r.Test(p[0]) {
+							t.Error("Observed a partially merged Ring")
+							return
+						}
+					}
+				}
+			}()
+		}
+
+		for _, p := range pairs {
+			r2, _ := ring.Init(mergeElements, fpRate)
+			r2.Add(p[0])
+			r2.Add(p[1])
+			if err := r.MergeContext(ctx, r2); err != nil {
+				t.Errorf("Error calling Merge: %v", err)
+			}
+		}
+		close(done)
+		wg.Wait()
+	}
+}
+
+// TestMergeBidirectional ensures rings merging into each other concurrently,
+// while being added to, neither deadlock nor race.
+func TestMergeBidirectional(t *testing.T) {
+	a, _ := ring.Init(1000, fpRate)
+	b, _ := ring.Init(1000, fpRate)
+
+	var wg sync.WaitGroup
+	merge := func(dst, src *ring.Ring) {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if err := dst.Merge(src); err != nil {
+				t.Errorf("Error calling Merge: %v", err)
+				return
+			}
+		}
+	}
+	add := func(r *ring.Ring, seed int) {
+		defer wg.Done()
+		buff := make([]byte, 8)
+		for i := 0; i < 1000; i++ {
+			intToByte(buff, seed)
+			intToByte(buff[4:], i)
+			r.Add(buff)
+		}
+	}
+	wg.Add(4)
+	go merge(a, b)
+	go merge(b, a)
+	go add(a, 1)
+	go add(b, 2)
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Minute):
+		t.Fatal("Deadlock merging rings into each other")
+	}
+
+	// both rings contain everything once merged in each direction
+	a.Merge(b)
+	b.Merge(a)
+	buff := make([]byte, 8)
+	for seed := 1; seed <= 2; seed++ {
+		for i := 0; i < 1000; i++ {
+			intToByte(buff, seed)
+			intToByte(buff[4:], i)
+			if !a.Test(buff) || !b.Test(buff) {
+				t.Fatal("Data missing after bidirectional Merge")
+			}
+		}
+	}
+}
+
+// TestMergeSelf ensures merging a Ring into itself, directly or through
+// MergeAll, is a no-op that returns without deadlocking.
+func TestMergeSelf(t *testing.T) {
+	r, _ := ring.Init(1000, fpRate)
+	r2, _ := ring.Init(1000, fpRate)
+	data := []byte("hello")
+	other := []byte("world")
+	r.Add(data)
+	r2.Add(other)
+
+	finished := make(chan error)
+	go func() {
+		if err := r.Merge(r); err != nil {
+			finished <- err
+			return
+		}
+		finished <- r.MergeAll(r, r2, r)
+	}()
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Fatalf("Unexpected error merging a Ring into itself: %v", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("Deadlock merging a Ring into itself")
+	}
+	if !r.Test(data) || !r.Test(other) {
+		t.Fatal("Data missing after MergeAll")
+	}
+}
+
+// TestMergeAllInvalid ensures MergeAll validates every Ring before merging any.
+func TestMergeAllInvalid(t *testing.T) {
+	r, _ := ring.Init(1000, fpRate)
+	r2, _ := ring.Init(1000, fpRate)
+	r3, _ := ring.Init(100, fpRate)
+	data := []byte("hello")
+	r2.Add(data)
+	if r.MergeAll(r2, r3) == nil {
+		t.Fatal("Expected error calling MergeAll with different params")
+	}
+	if r.MergeAll(r2, nil) == nil {
+		t.Fatal("Expected error calling MergeAll with nil")
+	}
+	if r.Test(data) {
+		t.Fatal("Failed MergeAll modified the receiver")
+	}
+}
+
+// craftRing returns a ring of the sent parameters, built by unmarshaling.
+func craftRing(t *testing.T, size, hash uint64, flags uint8) *ring.Ring {
+	data := []byte{2, flags}
+	data = binary.BigEndian.AppendUint64(data, size)
+	data = binary.BigEndian.AppendUint64(data, hash)
+	data = append(data, make([]byte, size/8+1)...)
+	r := &ring.Ring{}
+	if err := r.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// TestMergeIncompatible ensures every combination of differing parameters is
+// reported as the first differing field, with both values, and unwraps to
+// ErrIncompatible, both from Merge and from the functions hashing for many
+// rings.
+func TestMergeIncompatible(t *testing.T) {
+	base := craftRing(t, 1024, 4, 0)
+	for _, c := range []struct {
+		size, hash uint64
+		flags      uint8
+		field      string
+		r, a       uint64
+	}{
+		{2048, 4, 0, "size", 1024, 2048},
+		{1024, 5, 0, "hash", 4, 5},
+		{1024, 4, 1, "flags", 0, 1},
+		{2048, 5, 0, "size", 1024, 2048},
+		{2048, 4, 1, "size", 1024, 2048},
+		{1024, 5, 1, "hash", 4, 5},
+		{2048, 5, 1, "size", 1024, 2048},
+	} {
+		m := craftRing(t, c.size, c.hash, c.flags)
+		for _, err := range []error{
+			base.Merge(m),
+			base.MergeAll(m),
+			ring.AddToAll([]byte("data"), base, m),
+		} {
+			if !errors.Is(err, ring.ErrIncompatible) {
+				t.Fatalf("%+v: error %v is not ErrIncompatible", c, err)
+			}
+			var inc *ring.IncompatibleError
+			if !errors.As(err, &inc) || inc.Field != c.field || inc.Receiver != c.r || inc.Argument != c.a {
+				t.Fatalf("%+v: unexpected error %#v", c, err)
+			}
+			if !strings.Contains(err.Error(), c.field) {
+				t.Fatalf("%+v: error %q does not name %s", c, err, c.field)
+			}
+		}
+		if ring.TestInAll([]byte("data"), base, m) != nil {
+			t.Fatalf("%+v: TestInAll of incompatible rings", c)
+		}
+	}
+	if base.Test([]byte("data")) {
+		t.Fatal("failed AddToAll modified a ring")
+	}
+}
+
+// TestMergeIncompatibleTypes ensures the other filters name their own
+// differing parameters.
+func TestMergeIncompatibleTypes(t *testing.T) {
+	c4, _ := ring.InitCounting(1000, fpRate, ring.WithCounterBits(4))
+	c8, _ := ring.InitCounting(1000, fpRate)
+	l2, _ := ring.InitLayered(1000, fpRate, 2)
+	l3, _ := ring.InitLayered(1000, fpRate, 3)
+	s2, _ := ring.InitRingSet(2, 1000, fpRate)
+	s3, _ := ring.InitRingSet(3, 1500, fpRate)
+	q1, _ := ring.InitQuotient(1000, 8)
+	q2, _ := ring.InitQuotient(1000, 9)
+	q3, _ := ring.InitQuotient(5000, 8)
+	m1, _ := ring.InitCountMin(0.01, 0.01)
+	m2, _ := ring.InitCountMin(0.001, 0.01)
+	m3, _ := ring.InitCountMin(0.01, 0.001)
+	for field, err := range map[string]error{
+		"counter bits":   c4.Merge(c8),
+		"layers":         l2.Merge(l3),
+		"shards":         s2.Merge(s3),
+		"remainder bits": q1.Merge(q2),
+		"quotient bits":  q1.Merge(q3),
+		"width":          m1.Merge(m2),
+		"depth":          m1.Merge(m3),
+	} {
+		var inc *ring.IncompatibleError
+		if !errors.Is(err, ring.ErrIncompatible) || !errors.As(err, &inc) || inc.Field != field {
+			t.Fatalf("%s: unexpected error %v", field, err)
+		}
+	}
+}
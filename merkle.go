@@ -0,0 +1,252 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// DigestChunkSize is the number of bytes of the bit array covered by each
+// digest of ChunkDigests, and the length of the chunks of GetChunks and
+// ApplyChunks. The final chunk covers the rest of the bit array, and may be
+// shorter.
+const DigestChunkSize = 1 << digestShift
+
+// digestShift is log2 of DigestChunkSize, which divides chunkBytes.
+const digestShift = 14
+
+// ErrChunks is returned by ApplyChunks given chunks that do not fit the ring.
+var ErrChunks = errors.New("error: chunks do not fit the ring")
+
+// digests holds the digest of each chunk of a bit array, and the chunks written
+// since they were hashed. Writers mark chunks under the write lock, while
+// readers hash them under the read lock, one reader at a time.
+type digests struct {
+	mutex  sync.Mutex    // serializes readers hashing dirty chunks
+	dirty  []atomic.Bool // chunks written since they were hashed
+	hashes []uint64      // digest of each chunk, valid unless dirty
+}
+
+// newDigests returns the digests of n chunks, all dirty.
+func newDigests(n int) *digests {
+	d := &digests{dirty: make([]atomic.Bool, n), hashes: make([]uint64, n)}
+	for i := range d.dirty {
+		d.dirty[i].Store(true)
+	}
+	return d
+}
+
+// mark marks the chunk holding the bit at index as written.
+func (d *digests) mark(index uint64) {
+	if c := &d.dirty[index>>(digestShift+3)]; !c.Load() {
+		c.Store(true)
+	}
+}
+
+// dropDigests discards the digests of the ring, after writes replacing the bit
+// array as a whole. They are hashed anew on the next request.
+func (r *Ring) dropDigests() {
+	if r.digests.Load() != nil {
+		r.digests.Store(nil)
+	}
+}
+
+// digestChunks returns the number of chunks of DigestChunkSize bytes of b.
+func (b *bitset) digestChunks() int {
+	return int((b.length + DigestChunkSize - 1) >> digestShift)
+}
+
+// chunkSize returns the number of bytes of the i-th chunk of DigestChunkSize
+// bytes.
+func (b *bitset) chunkSize(i int) int {
+	if rest := b.length - uint64(i)<<digestShift; rest < DigestChunkSize {
+		return int(rest)
+	}
+	return DigestChunkSize
+}
+
+// readChunk copies the logical bits of the i-th chunk of DigestChunkSize bytes
+// into buf, returning them. Writers must be excluded.
+func (b *bitset) readChunk(i int, buf []byte) []byte {
+	start := uint64(i) << digestShift
+	out := buf[:b.chunkSize(i)]
+	c := b.chunks[start>>chunkShift]
+	if c == nil {
+		for j := range out {
+			out[j] = 0
+		}
+		return out
+	}
+	copy(out, c[start&chunkMask:])
+	b.clearStale(out, start)
+	return out
+}
+
+// ChunkDigests returns a 64-bit digest of each chunk of DigestChunkSize bytes
+// of the bit array, so replicas of a ring can find the chunks in which they
+// differ by comparing digests, and exchange only those with GetChunks and
+// ApplyChunks. Digests are kept from one call to the next: Add marks the
+// chunks it writes, and only those are hashed again, while Reset, Merge and
+// UnmarshalBinary discard them all. The digests of the first call, and of the
+// first after such writes, cost a pass over the bit array. A zero Ring returns
+// nil.
+func (r *Ring) ChunkDigests() []uint64 {
+	if r.set.Load() == nil {
+		return nil
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, hashes := r.chunkDigests()
+	return hashes
+}
+
+// RootDigest returns a 64-bit digest of the parameters of the ring and of every
+// digest of ChunkDigests, the root of a two level hash tree. Replicas whose
+// roots are equal hold the same bits, with overwhelming probability, and
+// need not compare their chunk digests. A zero Ring returns 0.
+func (r *Ring) RootDigest() uint64 {
+	if r.set.Load() == nil {
+		return 0
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	b, hashes := r.chunkDigests()
+	var header [maxHeader]byte
+	buf := append(make([]byte, 0, maxHeader+8*len(hashes)), b.header(&header)...)
+	for _, h := range hashes {
+		buf = binary.BigEndian.AppendUint64(buf, h)
+	}
+	root, _ := murmur128(buf)
+	return root
+}
+
+// chunkDigests returns the published bitset and a copy of its digests, hashing
+// the chunks written since they were last hashed. The read lock must be held.
+func (r *Ring) chunkDigests() (*bitset, []uint64) {
+	b := r.set.Load()
+	d := r.digests.Load()
+	if d == nil || len(d.hashes) != b.digestChunks() {
+		// digests published by a concurrent reader are of the same bits
+		if n := newDigests(b.digestChunks()); r.digests.CompareAndSwap(d, n) {
+			d = n
+		} else {
+			d = r.digests.Load()
+		}
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	var buf []byte
+	for i := range d.hashes {
+		if !d.dirty[i].Load() {
+			continue
+		}
+		if buf == nil {
+			buf = make([]byte, DigestChunkSize)
+		}
+		d.dirty[i].Store(false)
+		d.hashes[i], _ = murmur128(b.readChunk(i, buf))
+	}
+	return b, append([]uint64(nil), d.hashes...)
+}
+
+// GetChunks returns a copy of the bits of each chunk of DigestChunkSize bytes
+// at indices, as numbered by ChunkDigests. Indices beyond the chunks of the
+// ring return nil. A zero Ring returns nil.
+func (r *Ring) GetChunks(indices []int) [][]byte {
+	if r.set.Load() == nil {
+		return nil
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	b := r.set.Load()
+	out := make([][]byte, len(indices))
+	for j, i := range indices {
+		if i < 0 || i >= b.digestChunks() {
+			continue
+		}
+		out[j] = b.readChunk(i, make([]byte, b.chunkSize(i)))
+	}
+	return out
+}
+
+// ApplyChunks replaces the bits of each chunk of DigestChunkSize bytes at
+// indices with the chunk of data, as returned by GetChunks of a ring with the
+// same parameters. Unlike Merge, bits are cleared as well as set, so a replica
+// applying every chunk whose digest differs from that of its source holds the
+// same bits afterwards. Chunks are written under the write lock, but lock-free
+// Test calls may observe a chunk partially written.
+//
+// Every chunk is checked before any is written: indices beyond the chunks of
+// the ring, chunks of the wrong length, and bits set beyond the size of the
+// ring return ErrChunks, leaving the ring unchanged. A zero Ring returns
+// ErrUninitialized.
+func (r *Ring) ApplyChunks(indices []int, data [][]byte) error {
+	if r.set.Load() == nil {
+		return ErrUninitialized
+	}
+	if len(indices) != len(data) {
+		return fmt.Errorf("%w: %d indices and %d chunks", ErrChunks, len(indices), len(data))
+	}
+	r.lock()
+	defer r.unlock()
+	b := r.set.Load()
+	for j, i := range indices {
+		if i < 0 || i >= b.digestChunks() {
+			return fmt.Errorf("%w: chunk %d of %d", ErrChunks, i, b.digestChunks())
+		}
+		if len(data[j]) != b.chunkSize(i) {
+			return fmt.Errorf("%w: chunk %d of %d bytes, expected %d", ErrChunks, i, len(data[j]), b.chunkSize(i))
+		}
+		if i == b.digestChunks()-1 && data[j][len(data[j])-1]>>(b.size%8) != 0 {
+			return fmt.Errorf("%w: chunk %d sets bits beyond %d", ErrChunks, i, b.size)
+		}
+	}
+	// stale blocks are zeroed, so chunks can be written in place
+	b.normalize()
+	d := r.digests.Load()
+	for j, i := range indices {
+		b = r.applyChunk(b, i, data[j])
+		if d != nil {
+			d.dirty[i].Store(true)
+		}
+	}
+	r.countSetBits(b)
+	r.truncateUpdates()
+	r.invalidateTruth()
+	return nil
+}
+
+// applyChunk writes the i-th chunk of DigestChunkSize bytes of the published
+// bitset b, which has no stale blocks, and sets the summary of its blocks
+// holding active bits. Summary bits of cleared blocks remain set, which only
+// costs Test a probe. It returns the bitset now published. The write lock must
+// be held.
+func (r *Ring) applyChunk(b *bitset, i int, data []byte) *bitset {
+	start := uint64(i) << digestShift
+	if b.chunks[start>>chunkShift] == nil {
+		if isZero(data) {
+			return b
+		}
+		// publish the new chunk before writing bits within it
+		b = b.withChunk(start * 8)
+		r.set.Store(b)
+	}
+	atomicCopy(b.chunks[start>>chunkShift], start&chunkMask, data)
+	for offset := 0; offset < len(data); offset += summaryBlock / 8 {
+		end := offset + summaryBlock/8
+		if end > len(data) {
+			end = len(data)
+		}
+		if !isZero(data[offset:end]) {
+			block := (start + uint64(offset)) * 8 / summaryBlock
+			atomicOr(b.summary, block/8, 1<<(block%8))
+		}
+	}
+	return b
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// syncChunks brings the replica up to date with the source by the chunks whose
+// digests differ, returning the number of chunks and bytes transferred.
+func syncChunks(t *testing.T, source, replica *ring.Ring) (int, int) {
+	t.Helper()
+	want, have := source.ChunkDigests(), replica.ChunkDigests()
+	if len(want) != len(have) {
+		t.Fatalf("%d digests of the source, %d of the replica", len(want), len(have))
+	}
+	var indices []int
+	for i := range want {
+		if want[i] != have[i] {
+			indices = append(indices, i)
+		}
+	}
+	chunks := source.GetChunks(indices)
+	bytes := 0
+	for _, c := range chunks {
+		bytes += len(c)
+	}
+	if err := replica.ApplyChunks(indices, chunks); err != nil {
+		t.Fatal(err)
+	}
+	return len(indices), bytes
+}
+
+// TestChunkSync ensures replicas synced by the digest diff converge bit for
+// bit, transferring only the chunks written.
+func TestChunkSync(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithFastReset()}, {ring.WithBlocked()}} {
+		source, _ := ring.Init(1000000, 0.01, opts...)
+		replica, _ := ring.Init(1000000, 0.01, opts...)
+		for i := 0; i < 20000; i++ {
+			source.Add([]byte(strconv.Itoa(i)))
+		}
+		syncChunks(t, source, replica)
+		if !replica.Equal(source) || replica.RootDigest() != source.RootDigest() {
+			t.Fatal("replica differs after the first sync")
+		}
+
+		// a few additions dirty at most a chunk per hash round
+		k := source.Parameters().HashRounds
+		for i := 0; i < 3; i++ {
+			source.Add([]byte("new" + strconv.Itoa(i)))
+		}
+		chunks, bytes := syncChunks(t, source, replica)
+		if chunks == 0 || uint64(chunks) > 3*k || bytes > chunks*ring.DigestChunkSize {
+			t.Fatalf("3 additions sent %d chunks of %d bytes", chunks, bytes)
+		}
+		if !replica.Equal(source) || !replica.Test([]byte("new2")) {
+			t.Fatal("replica differs after the delta")
+		}
+		if chunks, _ := syncChunks(t, source, replica); chunks != 0 {
+			t.Fatalf("equal rings sent %d chunks", chunks)
+		}
+
+		// clearing is replicated, and the replica may write too
+		source.Reset()
+		replica.Add([]byte("local"))
+		syncChunks(t, source, replica)
+		if !replica.Equal(source) || replica.Test([]byte("0")) || replica.Test([]byte("local")) {
+			t.Fatal("replica differs after Reset")
+		}
+	}
+}
+
+// TestChunkDigests ensures digests follow every kind of write.
+func TestChunkDigests(t *testing.T) {
+	r, _ := ring.Init(100000, 0.01)
+	empty := r.ChunkDigests()
+	if len(empty) != (int(r.Parameters().Bits)/8+ring.DigestChunkSize)/ring.DigestChunkSize {
+		t.Fatalf("unexpected number of digests: %d", len(empty))
+	}
+	root := r.RootDigest()
+	r.Add([]byte("data"))
+	if equalDigests(r.ChunkDigests(), empty) || r.RootDigest() == root {
+		t.Fatal("digests unchanged by Add")
+	}
+	r.Reset()
+	if !equalDigests(r.ChunkDigests(), empty) || r.RootDigest() != root {
+		t.Fatal("digests of a reset ring differ from an empty ring")
+	}
+	m, _ := ring.Init(100000, 0.01)
+	m.Add([]byte("other"))
+	r.Merge(m)
+	if !equalDigests(r.ChunkDigests(), m.ChunkDigests()) {
+		t.Fatal("digests unchanged by Merge")
+	}
+	seeded, _ := ring.Init(100000, 0.01, ring.WithSeed(1))
+	if seeded.RootDigest() == root {
+		t.Fatal("roots of rings of other parameters are equal")
+	}
+	if new(ring.Ring).ChunkDigests() != nil || new(ring.Ring).RootDigest() != 0 {
+		t.Fatal("zero ring has digests")
+	}
+}
+
+func equalDigests(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestApplyChunksInvalid ensures invalid chunks are rejected without changing
+// the ring.
+func TestApplyChunksInvalid(t *testing.T) {
+	r, _ := ring.Init(100000, 0.01)
+	r.Add([]byte("data"))
+	before := r.RootDigest()
+	n := len(r.ChunkDigests())
+	full := make([]byte, ring.DigestChunkSize)
+	last := r.GetChunks([]int{n - 1})[0]
+	last[len(last)-1] = 0xff
+	for _, c := range []struct {
+		name    string
+		indices []int
+		data    [][]byte
+	}{
+		{"count", []int{0, 1}, [][]byte{full}},
+		{"index", []int{0, n}, [][]byte{full, full}},
+		{"negative", []int{-1}, [][]byte{full}},
+		{"length", []int{0, 1}, [][]byte{full, full[:10]}},
+		{"beyond size", []int{0, n - 1}, [][]byte{full, last}},
+	} {
+		if err := r.ApplyChunks(c.indices, c.data); !errors.Is(err, ring.ErrChunks) {
+			t.Fatalf("%s: expected ErrChunks, got %v", c.name, err)
+		}
+		if r.RootDigest() != before {
+			t.Fatalf("%s: ring changed", c.name)
+		}
+	}
+	if got := r.GetChunks([]int{n}); len(got) != 1 || got[0] != nil {
+		t.Fatal("chunk beyond the ring returned")
+	}
+	if err := new(ring.Ring).ApplyChunks(nil, nil); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+}
+
+// TestChunkDigestsConcurrent runs ChunkDigests concurrently with writers, for
+// the race detector.
+func TestChunkDigestsConcurrent(t *testing.T) {
+	r, _ := ring.Init(100000, 0.01)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				r.Add([]byte(strconv.Itoa(w*1000 + i)))
+				if i%50 == 0 {
+					r.ChunkDigests()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	fresh, _ := ring.Init(100000, 0.01)
+	syncChunks(t, r, fresh)
+	if !fresh.Equal(r) {
+		t.Fatal("digests missed concurrent writes")
+	}
+}
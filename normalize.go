@@ -0,0 +1,100 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization selects how AddString and TestString normalize strings before
+// hashing them. Modes are combined with |.
+type Normalization uint8
+
+const (
+	// NormalizeFoldASCII maps the ASCII letters A to Z to a to z. Other
+	// letters, such as Ä, are unchanged.
+	NormalizeFoldASCII Normalization = 1 << iota
+	// NormalizeNFC converts strings to Unicode Normalization Form C, so the
+	// precomposed é and e followed by a combining acute accent are the same
+	// string. It applies before NormalizeFoldASCII.
+	NormalizeNFC
+
+	// normalizeAll holds every known mode.
+	normalizeAll = NormalizeFoldASCII | NormalizeNFC
+)
+
+// normalizeBuffer is the length of normalized strings held on the stack by
+// AddString and TestString, beyond which they are allocated.
+const normalizeBuffer = 128
+
+// WithNormalization normalizes the strings of AddString and TestString with the
+// mode, so producers and consumers disagreeing on case or Unicode form agree on
+// the ring. It does not apply to Add, Test, AddHash, or any other method taking
+// bytes or a Digest, which always use the data as given: a string added with
+// AddString is found by Test only in its normalized form. Like other Options,
+// it is not marshaled, and a ring loaded by UnmarshalBinary keeps its own.
+func WithNormalization(mode Normalization) Option {
+	return func(o *options) {
+		o.normalize = mode
+	}
+}
+
+// AddString adds the string to the ring, normalized as by WithNormalization.
+// Without WithNormalization, it is Add of the bytes of the string. Strings of
+// up to 128 bytes already in the normalized form are added without
+// allocating.
+func (r *Ring) AddString(s string) {
+	var buf [normalizeBuffer]byte
+	r.Add(r.normalize.append(buf[:0], s))
+}
+
+// TestString returns a bool if the string, normalized as by WithNormalization,
+// is in the ring. True indicates that the string may be in the ring, while
+// false indicates that the string is not in the ring.
+func (r *Ring) TestString(s string) bool {
+	var buf [normalizeBuffer]byte
+	return r.Test(r.normalize.append(buf[:0], s))
+}
+
+// append appends the normalized bytes of s to dst.
+func (mode Normalization) append(dst []byte, s string) []byte {
+	if mode&NormalizeNFC != 0 && !isASCII(s) && norm.NFC.QuickSpanString(s) != len(s) {
+		// may not be in the form; converted apart from dst, which norm would
+		// move to the heap
+		s = norm.NFC.String(s)
+	}
+	dst = append(dst, s...)
+	if mode&NormalizeFoldASCII != 0 {
+		// bytes of multibyte UTF-8 sequences are never within A to Z
+		for i, c := range dst {
+			if 'A' <= c && c <= 'Z' {
+				dst[i] = c + 'a' - 'A'
+			}
+		}
+	}
+	return dst
+}
+
+// validate returns a description of unknown modes, or an empty string.
+func (mode Normalization) validate() string {
+	if mode&^normalizeAll != 0 {
+		return fmt.Sprintf("WithNormalization(%d) holds unknown modes", mode)
+	}
+	return ""
+}
+
+// isASCII returns if s is only ASCII, which every Normalization Form leaves
+// unchanged.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestNormalization ensures strings differing only in ASCII case or Unicode
+// form unify when normalized, and stay distinct otherwise.
+func TestNormalization(t *testing.T) {
+	const (
+		nfc = "caf\u00e9"  // precomposed é
+		nfd = "cafe\u0301" // e and a combining acute accent
+	)
+	for _, c := range []struct {
+		mode       ring.Normalization
+		fold, form bool
+	}{
+		{0, false, false},
+		{ring.NormalizeFoldASCII, true, false},
+		{ring.NormalizeNFC, false, true},
+		{ring.NormalizeFoldASCII | ring.NormalizeNFC, true, true},
+	} {
+		r, err := ring.New(1000, 0.0001, ring.WithNormalization(c.mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.AddString("FOO")
+		r.AddString(nfd)
+		if r.TestString("foo") != c.fold || r.TestString("Foo") != c.fold {
+			t.Errorf("mode %d: FOO and foo unified: %v", c.mode, !c.fold)
+		}
+		if r.TestString(nfc) != c.form {
+			t.Errorf("mode %d: NFC and NFD unified: %v", c.mode, !c.form)
+		}
+		if !r.TestString("FOO") || !r.TestString(nfd) {
+			t.Errorf("mode %d: added strings missing", c.mode)
+		}
+		if r.TestString("bar") || r.TestString("FO") {
+			t.Errorf("mode %d: absent strings present", c.mode)
+		}
+		// letters beyond ASCII keep their case
+		r.AddString("Ä")
+		if r.TestString("ä") {
+			t.Errorf("mode %d: Ä and ä unified", c.mode)
+		}
+	}
+}
+
+// TestNormalizationRaw ensures the byte methods use data as given, finding
+// strings of AddString only in their normalized form.
+func TestNormalizationRaw(t *testing.T) {
+	r, _ := ring.New(1000, 0.0001, ring.WithNormalization(ring.NormalizeFoldASCII|ring.NormalizeNFC))
+	r.AddString("Café")
+	if !r.Test([]byte("café")) || r.Test([]byte("Café")) {
+		t.Error("AddString not found by Test in its normalized form only")
+	}
+	r.Add([]byte("BAR"))
+	if r.TestString("BAR") || r.TestString("bar") || !r.Test([]byte("BAR")) {
+		t.Error("Add not found by Test only")
+	}
+	r.Add([]byte("baz"))
+	if !r.TestString("BAZ") {
+		t.Error("Add of the normalized form not found by TestString")
+	}
+
+	plain, _ := ring.New(1000, 0.0001)
+	plain.AddString("Qux")
+	if !plain.Test([]byte("Qux")) || plain.TestString("qux") {
+		t.Error("AddString without normalization differs from Add")
+	}
+}
+
+// TestNormalizationLong ensures strings beyond the stack buffer are normalized
+// too.
+func TestNormalizationLong(t *testing.T) {
+	r, _ := ring.New(1000, 0.0001, ring.WithNormalization(ring.NormalizeFoldASCII|ring.NormalizeNFC))
+	r.AddString(strings.Repeat("AÉ", 200))
+	if !r.TestString(strings.Repeat("aÉ", 200)) {
+		t.Error("long string missing")
+	}
+}
+
+// TestNormalizationAllocs ensures strings already normalized are added and
+// tested without allocating.
+func TestNormalizationAllocs(t *testing.T) {
+	r, _ := ring.New(1000, 0.01, ring.WithNormalization(ring.NormalizeFoldASCII|ring.NormalizeNFC))
+	for _, s := range []string{"user@example.com", "USER@EXAMPLE.COM", "café"} {
+		if n := testing.AllocsPerRun(100, func() {
+			r.AddString(s)
+			r.TestString(s)
+		}); n != 0 {
+			t.Errorf("%q: %g allocations", s, n)
+		}
+	}
+}
+
+// TestNormalizationErrors ensures unknown modes are rejected.
+func TestNormalizationErrors(t *testing.T) {
+	if _, err := ring.New(10, 0.01, ring.WithNormalization(1<<7)); !errors.Is(err, ring.ErrOptions) {
+		t.Fatalf("expected ErrOptions, got %v", err)
+	}
+}
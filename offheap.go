@@ -0,0 +1,88 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+// newChunk allocates the i-th chunk, off the Go heap if requested and
+// supported. Failed mappings fall back to the Go heap.
+func (b *bitset) newChunk(i int) []uint8 {
+	n := int(b.chunkLen(i))
+	if b.offHeap {
+		// padded to whole words, as for newBytes
+		if c, err := mapChunk((n + 3) &^ 3); err == nil {
+			b.mapped[i] = true
+			return c[:n]
+		}
+	}
+	b.mapped[i] = false
+	return newBytes(uint64(n))
+}
+
+// release unmaps the off heap chunks of b which are not shared with keep, which
+// may be nil. b must not be used afterwards.
+func (b *bitset) release(keep *bitset) {
+	for i, c := range b.chunks {
+		if c == nil || !b.mapped[i] {
+			continue
+		}
+		if keep != nil && keep.chunks[i] != nil && &keep.chunks[i][0] == &c[0] {
+			continue
+		}
+		unmapChunk(c)
+	}
+}
+
+// clearInto moves the off heap chunks of b into the empty bitset dst after
+// dropping their physical pages, so they read as zero without being unmapped.
+// Chunks whose pages cannot be dropped are unmapped. b must not be used
+// afterwards.
+func (b *bitset) clearInto(dst *bitset) {
+	for i, c := range b.chunks {
+		if c == nil || !b.mapped[i] {
+			continue
+		}
+		if dropChunk(c) == nil {
+			dst.chunks[i], dst.mapped[i] = c, true
+			continue
+		}
+		unmapChunk(c)
+	}
+}
+
+// Release clears the ring and immediately returns the memory of its bit array.
+// For rings allocated off the Go heap the memory is unmapped; otherwise it is
+// left to the garbage collector. The ring remains usable afterwards.
+func (r *Ring) Release() {
+	if r.set.Load() == nil {
+		return
+	}
+	b := r.emptyBitset(r.set.Load().params)
+	r.mutex.Lock()
+	old := r.set.Load()
+	if b.params != old.params {
+		// replaced by UnmarshalBinary in the meantime
+		b = r.emptyBitset(old.params)
+	}
+	old.release(nil)
+	r.set.Store(b)
+	r.version.Add(1)
+	r.clearSetBits()
+	r.dropDigests()
+	r.truncateUpdates()
+	r.clearTruth()
+	r.mutex.Unlock()
+	r.warnSaturation()
+	if r.log != nil {
+		r.logEvent(levelDebug, "ring released")
+	}
+}
+
+// Close implements io.Closer, releasing the memory of the bit array and
+// stopping the sampling of WithSampling. Rings created with WithOffHeap or
+// WithSampling must be closed once no longer used.
+func (r *Ring) Close() error {
+	r.stopSampling()
+	r.Release()
+	return nil
+}
@@ -0,0 +1,17 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || freebsd || netbsd || openbsd
+
+package ring
+
+import "errors"
+
+var errUnsupported = errors.New("error: operation not supported")
+
+// dropChunk is unsupported, as MADV_DONTNEED does not guarantee zeroed pages
+// on these platforms; the chunk is unmapped instead.
+func dropChunk(c []uint8) error {
+	return errUnsupported
+}
@@ -0,0 +1,13 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "syscall"
+
+// dropChunk drops the physical pages of memory from mapChunk, which reads as
+// zero afterwards.
+func dropChunk(c []uint8) error {
+	return syscall.Madvise(c, syscall.MADV_DONTNEED)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// mincore returns the residency of each page of the mapping c.
+func mincore(c []uint8) ([]byte, error) {
+	c = c[:cap(c)]
+	vec := make([]byte, (len(c)+os.Getpagesize()-1)/os.Getpagesize())
+	_, _, errno := syscall.Syscall(syscall.SYS_MINCORE, uintptr(unsafe.Pointer(&c[0])),
+		uintptr(len(c)), uintptr(unsafe.Pointer(&vec[0])))
+	if errno != 0 {
+		return nil, errno
+	}
+	return vec, nil
+}
+
+// residentBytes returns the number of bytes of the mapped chunks resident in
+// memory. Unlike the resident set size of the process, it is not affected by
+// the Go heap or by tests running alongside.
+func residentBytes(t *testing.T, chunks [][]uint8) int64 {
+	var resident int64
+	for _, c := range chunks {
+		vec, err := mincore(c)
+		if err != nil {
+			t.Fatalf("mincore: %v", err)
+		}
+		for _, v := range vec {
+			resident += int64(v & 1)
+		}
+	}
+	return resident * int64(os.Getpagesize())
+}
+
+// touchPages activates one bit in every page of the bit array.
+func touchPages(r *Ring) {
+	b := r.set.Load()
+	for index := uint64(0); index < r.size; index += 4096 * 8 {
+		b.set(index)
+	}
+}
+
+func TestOffHeapResident(t *testing.T) {
+	// 128MB of bits over two chunks
+	size := uint64(1 << 30)
+	r := &Ring{params: params{size: size, hash: 7}, mutex: &sync.RWMutex{}, offHeap: true}
+	r.set.Store(newBitset(r.params, true))
+	defer r.Close()
+
+	touchPages(r)
+	b := r.set.Load()
+	if !b.mapped[0] || !b.mapped[1] {
+		t.Fatal("chunks not allocated off heap")
+	}
+	chunks := [][]uint8{b.chunks[0], b.chunks[1]}
+	if resident := residentBytes(t, chunks); resident < 100<<20 {
+		t.Fatalf("touched pages only made %d bytes resident", resident)
+	}
+
+	// Reset drops the pages but keeps the mappings
+	r.Reset()
+	if resident := residentBytes(t, chunks); resident != 0 {
+		t.Fatalf("Reset left %d bytes resident", resident)
+	}
+	b = r.set.Load()
+	if !b.mapped[0] || b.get(0) {
+		t.Fatal("Reset did not keep a zeroed mapping")
+	}
+
+	touchPages(r)
+	r.Release()
+	// the range may be mapped again by the time mincore could check it
+	b = r.set.Load()
+	if b.allocated() != 0 || b.mapped[0] || b.mapped[1] {
+		t.Fatal("Release kept chunks allocated")
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !windows
+
+package ring
+
+import "errors"
+
+var errUnsupported = errors.New("error: operation not supported")
+
+// mapChunk is unsupported, so chunks are allocated on the Go heap.
+func mapChunk(n int) ([]uint8, error) {
+	return nil, errUnsupported
+}
+
+// unmapChunk is never called, as mapChunk never succeeds.
+func unmapChunk(c []uint8) {}
+
+// dropChunk is unsupported.
+func dropChunk(c []uint8) error {
+	return errUnsupported
+}
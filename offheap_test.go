@@ -0,0 +1,62 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestOffHeap ensures a Ring allocated off the Go heap behaves like any other.
+func TestOffHeap(t *testing.T) {
+	r, _ := ring.Init(10000, fpRate, ring.WithOffHeap())
+	defer r.Close()
+	r2, _ := ring.Init(10000, fpRate, ring.WithOffHeap())
+	defer r2.Close()
+
+	data := []byte("hello")
+	other := []byte("world")
+	r.Add(data)
+	r2.Add(other)
+	if !r.Test(data) || r.Test(other) {
+		t.Fatal("Unexpected membership")
+	}
+
+	// both the in place and scratch merges
+	if err := r.Merge(r2); err != nil {
+		t.Fatalf("Error calling Merge: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := r2.MergeContext(ctx, r); err != nil {
+		t.Fatalf("Error calling MergeContext: %v", err)
+	}
+	if !r.Test(other) || !r2.Test(data) {
+		t.Fatal("Data missing after Merge")
+	}
+
+	out, _ := r.MarshalBinary()
+	r.Reset()
+	if r.Test(data) {
+		t.Fatal("Data not removed by Reset")
+	}
+	if err := r.UnmarshalBinary(out); err != nil {
+		t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+	}
+	if !r.Test(data) || !r.Test(other) {
+		t.Fatal("Data missing after UnmarshalBinary")
+	}
+
+	r.Release()
+	if r.Test(data) {
+		t.Fatal("Data not removed by Release")
+	}
+	r.Add(data)
+	if !r.Test(data) {
+		t.Fatal("Ring unusable after Release")
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package ring
+
+import "syscall"
+
+// mapChunk returns n bytes of zeroed anonymous memory.
+func mapChunk(n int) ([]uint8, error) {
+	return syscall.Mmap(-1, 0, n, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+// unmapChunk returns memory from mapChunk to the operating system.
+func unmapChunk(c []uint8) {
+	syscall.Munmap(c)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build windows
+
+package ring
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	memCommit     = 0x1000
+	memReserve    = 0x2000
+	memRelease    = 0x8000
+	pageReadWrite = 0x04
+)
+
+var (
+	kernel32     = syscall.NewLazyDLL("kernel32.dll")
+	virtualAlloc = kernel32.NewProc("VirtualAlloc")
+	virtualFree  = kernel32.NewProc("VirtualFree")
+
+	errUnsupported = errors.New("error: operation not supported")
+)
+
+// mapChunk returns n bytes of zeroed memory from VirtualAlloc.
+func mapChunk(n int) ([]uint8, error) {
+	addr, _, err := virtualAlloc.Call(0, uintptr(n), memReserve|memCommit, pageReadWrite)
+	if addr == 0 {
+		return nil, err
+	}
+	// addr is memory outside of the Go heap, converted without a uintptr to
+	// unsafe.Pointer cast
+	return unsafe.Slice(*(**uint8)(unsafe.Pointer(&addr)), n), nil
+}
+
+// unmapChunk returns memory from mapChunk to the operating system.
+func unmapChunk(c []uint8) {
+	virtualFree.Call(uintptr(unsafe.Pointer(&c[0])), 0, memRelease)
+}
+
+// dropChunk is unsupported, as MEM_RESET does not guarantee zeroed pages; the
+// chunk is unmapped instead.
+func dropChunk(c []uint8) error {
+	return errUnsupported
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// flagPowerOfTwo marks a ring sized to a power of two, reducing hash rounds
+	// to indexes with a mask.
+	flagPowerOfTwo uint8 = 1 << iota
+	// flagPartitioned marks a ring whose bits are split into one partition per
+	// hash round.
+	flagPartitioned
+	// flagOneHash marks a partitioned ring deriving all hash rounds from a
+	// single hash of the data.
+	flagOneHash
+	// flagBlocked marks a ring setting every bit of the data within a single
+	// block of summaryBlock bits.
+	flagBlocked
+)
+
+// ErrOptions is returned by New and Init given Options that conflict with each
+// other, or an Option given an invalid value.
+var ErrOptions = errors.New("error: invalid options")
+
+// Option configures the construction of a ring.
+type Option func(*options)
+
+// options holds the configuration collected from Options.
+type options struct {
+	powerOfTwo  bool                // round the number of bits up to a power of two
+	offHeap     bool                // allocate the bit array off the Go heap
+	adaptive    bool                // spin briefly before blocking on the write lock
+	fastReset   bool                // stamp blocks with epochs for constant time Reset
+	partitioned bool                // split the bits into one partition per hash round
+	oneHash     bool                // derive every hash round from a single hash
+	blocked     bool                // set the bits of each data within a single block
+	noLock      bool                // leave Add, AddHash and Reset unsynchronized
+	rounds      int                 // number of hash rounds, or 0 for the optimal number
+	seed        uint64              // seed of the hash rounds
+	maxBytes    uint64              // largest bit array in bytes
+	maxMemory   uint64              // largest bit array in bytes for ErrMemoryLimit, 0 for the default
+	normalize   Normalization       // normalization of AddString and TestString
+	warnings    []saturationWarning // thresholds of WithSaturationWarning
+	name        string              // name of WithName
+	logger      logFunc             // logger of WithLogger, or nil
+	updates     int                 // size of the log of WithUpdateLog, or 0
+
+	sampleInterval time.Duration // interval of WithSampling, or 0
+	sampleRetain   int           // samples kept by WithSampling
+	sampleClock    SamplingClock // clock of WithSamplingClock, or nil
+
+	truthRate     float64 // sample rate of WithGroundTruth, or 0
+	truthCapacity int     // data held by WithGroundTruth
+}
+
+// validate returns an error listing every conflict between the options, or
+// nil. Options are validated together rather than as each is applied, so a
+// single error describes all of them.
+func (o *options) validate() error {
+	var problems []string
+	if o.noLock && o.adaptive {
+		problems = append(problems, "WithNoLock conflicts with WithAdaptiveLock")
+	}
+	if o.blocked && o.oneHash {
+		problems = append(problems, "WithBlocked conflicts with WithOneHash")
+	} else if o.blocked && o.partitioned {
+		problems = append(problems, "WithBlocked conflicts with WithPartitioned")
+	}
+	if o.rounds < 0 || o.rounds > maxHash {
+		problems = append(problems, fmt.Sprintf("WithHashRounds(%d) is outside 1 to %d", o.rounds, maxHash))
+	}
+	if problem := o.normalize.validate(); problem != "" {
+		problems = append(problems, problem)
+	}
+	if o.updates < 0 {
+		problems = append(problems, fmt.Sprintf("WithUpdateLog(%d) is negative", o.updates))
+	}
+	problems = append(problems, validateWarnings(o.warnings)...)
+	problems = append(problems, o.validateSampling()...)
+	problems = append(problems, o.validateTruth()...)
+	if problems == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrOptions, strings.Join(problems, "; "))
+}
+
+// WithPowerOfTwoSize rounds the number of bits up to the next power of two, so
+// each hash round is reduced to an index with a single AND rather than a
+// modulo. This trades up to twice the memory for faster Add and Test; the extra
+// bits only lower the false positive rate. Rings in this mode can only be
+// merged with other rings in this mode.
+func WithPowerOfTwoSize() Option {
+	return func(o *options) {
+		o.powerOfTwo = true
+	}
+}
+
+// WithOffHeap allocates the bit array with anonymous memory mappings outside of
+// the Go heap (mmap on unix, VirtualAlloc on windows), so memory is returned to
+// the operating system as soon as it is no longer needed: Release and Close
+// unmap it immediately, and Reset drops its physical pages. Rings using this
+// option must be closed once no longer used, as the garbage collector does not
+// reclaim the mappings. On unsupported platforms the bit array is allocated on
+// the Go heap as usual.
+func WithOffHeap() Option {
+	return func(o *options) {
+		o.offHeap = true
+	}
+}
+
+// WithAdaptiveLock makes writers spin briefly, retrying with backoff, before
+// blocking on the write lock. Add holds the lock for far less time than it
+// takes to park and wake a goroutine, so under moderate write contention
+// spinning usually acquires the lock sooner. The uncontended path is unchanged.
+func WithAdaptiveLock() Option {
+	return func(o *options) {
+		o.adaptive = true
+	}
+}
+
+// WithFastReset makes Reset take constant time, regardless of the size of the
+// ring. Each 512-bit block of the bit array is stamped with the epoch in which
+// it was last written, and Reset only advances the epoch; stale blocks are
+// cleared when next written. This costs 6.25% more memory for the stamps and a
+// stamp check on every probe, so it suits rings that are reset frequently.
+// Marshaled rings hold only the bits of the current epoch.
+func WithFastReset() Option {
+	return func(o *options) {
+		o.fastReset = true
+	}
+}
+
+// WithPartitioned splits the bits into k equal partitions, one per hash round,
+// with each round selecting a bit only within its own partition. The number of
+// bits is rounded up to a multiple of k, and with WithPowerOfTwoSize each
+// partition is sized to a power of two. The false positive rate is marginally
+// higher for the same size, but each partition can be placed independently.
+// Partitioned rings can only be merged with other partitioned rings.
+func WithPartitioned() Option {
+	return func(o *options) {
+		o.partitioned = true
+	}
+}
+
+// WithOneHash derives every hash round from a single MurmurHash3 invocation,
+// rather than the two hashes of the data otherwise needed, halving the cost of
+// hashing long data. It implies WithPartitioned: each round selects a bit in
+// its own partition of whole 64-bit words, so no two rounds drawn from the one
+// digest select the same bit. Partitions are sized so the exact false positive
+// rate of the ring, (1-(1-1/s)^n)^k for partitions of s bits, is within the
+// falsePositive rate.
+// Rings in this mode can only be merged with other rings in this mode.
+func WithOneHash() Option {
+	return func(o *options) {
+		o.oneHash = true
+		o.partitioned = true
+	}
+}
+
+// WithMaxBytes limits the bit array of the ring to maxBytes bytes, so Init
+// returns ErrTooLarge rather than allocating more, for example when elements
+// and falsePositive come from untrusted configuration. The limit applies after
+// any rounding of the other Options. Bit arrays are otherwise limited only by
+// the platform: to 2GB on 32-bit platforms.
+func WithMaxBytes(maxBytes uint64) Option {
+	return func(o *options) {
+		o.maxBytes = maxBytes
+	}
+}
+
+// WithMaxMemory limits the bit array of the ring to maxBytes bytes, like
+// WithMaxBytes, but as a hard ceiling of the ring: New returns ErrMemoryLimit
+// rather than allocating more, and so does UnmarshalBinary into the ring given
+// data of a larger ring, which is rejected from its header alone. It overrides
+// the default limit of SetDefaultMaxMemory; a maxBytes of 0 keeps the default.
+func WithMaxMemory(maxBytes uint64) Option {
+	return func(o *options) {
+		o.maxMemory = maxBytes
+	}
+}
+
+// WithHashRounds fixes the number of hash rounds at rounds, between 1 and 64,
+// rather than the number needing the fewest bits. The ring is still sized so
+// its rate is within the falsePositive rate, so fewer rounds than optimal trade
+// memory for faster Add and Test.
+func WithHashRounds(rounds int) Option {
+	return func(o *options) {
+		if rounds == 0 {
+			// 0 would select the optimal number, so make it invalid instead
+			rounds = -1
+		}
+		o.rounds = rounds
+	}
+}
+
+// WithSeed seeds the hash rounds, so rings of different seeds map the same data
+// to unrelated bits, and data sharing all bits in one ring rarely does in
+// another. It does not defend against data chosen to collide, which share the
+// 128-bit hashes the rounds are derived from. A seed of 0 is the default,
+// unseeded ring. Seeded rings can only be merged with rings of the same seed,
+// and are marshaled in a format earlier releases reject.
+func WithSeed(seed uint64) Option {
+	return func(o *options) {
+		o.seed = seed
+	}
+}
+
+// WithNoLock leaves Add, AddHash and Reset unsynchronized with each other, for
+// rings only ever written by one goroutine at a time. Test remains safe
+// concurrently with a single writer, as bits are still set atomically, and
+// Merge and UnmarshalBinary still take the lock. It conflicts with
+// WithAdaptiveLock.
+func WithNoLock() Option {
+	return func(o *options) {
+		o.noLock = true
+	}
+}
+
+// WithBlocked sets every bit of a data within a single block of 512 bits, a
+// typical cache line, selected by an extra hash round, so Add and Test touch
+// one line of memory rather than one per round. Blocks fill unevenly, so the
+// ring needs more bits for the same false positive rate: about 3% more at 1%,
+// and 15% more at 0.01%.
+// With WithPowerOfTwoSize the number of blocks is a power of two. It conflicts
+// with WithPartitioned and WithOneHash, and blocked rings can only be merged
+// with other blocked rings.
+func WithBlocked() Option {
+	return func(o *options) {
+		o.blocked = true
+	}
+}
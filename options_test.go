@@ -0,0 +1,572 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// rPowerOfTwo is a power of two sized ring for benchmarks.
+var rPowerOfTwo, _ = ring.Init(tests, fpRate, ring.WithPowerOfTwoSize())
+
+// BenchmarkAddPowerOfTwo tests adding elements to a power of two sized Ring,
+// for comparison with BenchmarkAdd.
+func BenchmarkAddPowerOfTwo(b *testing.B) {
+	buff := make([]byte, 4)
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		rPowerOfTwo.Add(buff)
+	}
+}
+
+// BenchmarkTestPowerOfTwo tests elements in a power of two sized Ring, for
+// comparison with BenchmarkTest.
+func BenchmarkTestPowerOfTwo(b *testing.B) {
+	buff := make([]byte, 4)
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		rPowerOfTwo.Test(buff)
+	}
+}
+
+// TestPowerOfTwoSize ensures the size is rounded up to a power of two and
+// reflected in the marshaled header.
+func TestPowerOfTwoSize(t *testing.T) {
+	r, _ := ring.Init(1000, fpRate, ring.WithPowerOfTwoSize())
+	out, _ := r.MarshalBinary()
+	if out[0] != 2 || out[1] != 1 {
+		t.Fatalf("Unexpected header: version %d, flags %d", out[0], out[1])
+	}
+	size := binary.BigEndian.Uint64(out[2:10])
+	if size&(size-1) != 0 {
+		t.Fatalf("Size %d is not a power of two", size)
+	}
+
+	// default rings keep the version 1 format
+	r2, _ := ring.Init(1000, fpRate)
+	if out, _ := r2.MarshalBinary(); out[0] != 1 {
+		t.Fatalf("Unexpected version: %d", out[0])
+	}
+}
+
+// TestPowerOfTwoFalsePositive ensures a power of two sized Ring has no false
+// negatives and stays within the false positive rate.
+func TestPowerOfTwoFalsePositive(t *testing.T) {
+	elements := tests / 10
+	r, _ := ring.Init(elements, fpRate, ring.WithPowerOfTwoSize())
+	buff := make([]byte, 4)
+	for i := 0; i < elements; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	positives := 0
+	for i := 0; i < elements; i++ {
+		intToByte(buff, i)
+		if !r.Test(buff) {
+			t.Fatalf("False negative for %d", i)
+		}
+		intToByte(buff, i+elements)
+		if r.Test(buff) {
+			positives++
+		}
+	}
+	if rate := float64(positives) / float64(elements); rate > fpRate {
+		t.Fatalf("False positive rate %f exceeds %f", rate, fpRate)
+	}
+}
+
+// TestPowerOfTwoMarshalMerge ensures the mode survives a marshal round trip and
+// prevents merging with rings in the default mode.
+func TestPowerOfTwoMarshalMerge(t *testing.T) {
+	r, _ := ring.Init(1000, fpRate, ring.WithPowerOfTwoSize())
+	data := []byte("hello")
+	r.Add(data)
+	out, _ := r.MarshalBinary()
+
+	r2 := new(ring.Ring)
+	if err := r2.UnmarshalBinary(out); err != nil {
+		t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+	}
+	if !r2.Test(data) {
+		t.Fatal("Data missing after UnmarshalBinary")
+	}
+	if err := r2.Merge(r); err != nil {
+		t.Fatalf("Unexpected error calling Merge: %v", err)
+	}
+
+	// a default ring with identical size and hash rounds still differs in mode
+	size := binary.BigEndian.Uint64(out[2:10])
+	hash := binary.BigEndian.Uint64(out[10:18])
+	v1 := make([]byte, len(out)-1)
+	v1[0] = 1
+	binary.BigEndian.PutUint64(v1[1:9], size)
+	binary.BigEndian.PutUint64(v1[9:17], hash)
+	r3 := new(ring.Ring)
+	if err := r3.UnmarshalBinary(v1); err != nil {
+		t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+	}
+	if r.Merge(r3) == nil || r3.Merge(r) == nil {
+		t.Fatal("Expected error merging rings of different modes")
+	}
+
+	// the power of two flag requires a power of two size
+	binary.BigEndian.PutUint64(out[2:10], size-1)
+	if r2.UnmarshalBinary(out) == nil {
+		t.Fatal("Expected error unmarshaling a non power of two size")
+	}
+}
+
+// TestPartitionedData performs the statistical test of TestData on a
+// partitioned Ring.
+func TestPartitionedData(t *testing.T) {
+	r, _ := ring.Init(tests, fpRate, ring.WithPartitioned())
+	positives := 0
+	min, max := 8, 8192
+	for i := 0; i < tests; i++ {
+		token := make([]byte, rand.Intn(max-min)+min)
+		rand.Read(token)
+		if r.Test(token) {
+			positives++
+		}
+		r.Add(token)
+		if !r.Test(token) {
+			t.Fatalf("False negative for %x", token)
+		}
+	}
+	if rate := float64(positives) / tests; rate > fpRate {
+		t.Fatalf("False positive rate %f exceeds %f", rate, fpRate)
+	}
+}
+
+// TestPartitionedMarshalMerge ensures the mode survives a marshal round trip,
+// combines with power of two sizing, and prevents merging with other modes.
+func TestPartitionedMarshalMerge(t *testing.T) {
+	for _, opts := range [][]ring.Option{
+		{ring.WithPartitioned()},
+		{ring.WithPartitioned(), ring.WithPowerOfTwoSize()},
+	} {
+		r, _ := ring.Init(1000, fpRate, opts...)
+		data := []byte("hello")
+		r.Add(data)
+		out, _ := r.MarshalBinary()
+		if out[0] != 2 || out[1]&2 == 0 {
+			t.Fatalf("Unexpected header: version %d, flags %d", out[0], out[1])
+		}
+		size := binary.BigEndian.Uint64(out[2:10])
+		hash := binary.BigEndian.Uint64(out[10:18])
+		if size%hash != 0 {
+			t.Fatalf("Size %d is not a multiple of %d", size, hash)
+		}
+
+		r2 := new(ring.Ring)
+		if err := r2.UnmarshalBinary(out); err != nil {
+			t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+		}
+		if !r2.Test(data) {
+			t.Fatal("Data missing after UnmarshalBinary")
+		}
+		if err := r2.Merge(r); err != nil {
+			t.Fatalf("Unexpected error calling Merge: %v", err)
+		}
+
+		// the same size and hash rounds in the default mode
+		plain := append([]byte(nil), out...)
+		plain[1] = 0
+		r3 := new(ring.Ring)
+		if err := r3.UnmarshalBinary(plain); err != nil {
+			t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+		}
+		if r.Merge(r3) == nil || r3.Merge(r) == nil {
+			t.Fatal("Expected error merging rings of different modes")
+		}
+
+		// the partitioned flag requires a size divisible by the hash rounds
+		binary.BigEndian.PutUint64(out[2:10], size+1)
+		if r2.UnmarshalBinary(out) == nil {
+			t.Fatal("Expected error unmarshaling an indivisible size")
+		}
+	}
+}
+
+// benchmarkAdd4KB measures adding 4KB data, where hashing dominates.
+func benchmarkAdd4KB(b *testing.B, opts ...ring.Option) {
+	r, _ := ring.Init(tests, fpRate, opts...)
+	data := make([]byte, 4096)
+	rand.Read(data)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intToByte(data, i)
+		r.Add(data)
+	}
+}
+
+// benchmarkTest4KB measures testing 4KB data, where hashing dominates.
+func benchmarkTest4KB(b *testing.B, opts ...ring.Option) {
+	r, _ := ring.Init(tests, fpRate, opts...)
+	data := make([]byte, 4096)
+	rand.Read(data)
+	for i := 0; i < 1000; i++ {
+		intToByte(data, i)
+		r.Add(data)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intToByte(data, i%2000)
+		r.Test(data)
+	}
+}
+
+func BenchmarkAdd4KB(b *testing.B)         { benchmarkAdd4KB(b) }
+func BenchmarkAddOneHash4KB(b *testing.B)  { benchmarkAdd4KB(b, ring.WithOneHash()) }
+func BenchmarkTest4KB(b *testing.B)        { benchmarkTest4KB(b) }
+func BenchmarkTestOneHash4KB(b *testing.B) { benchmarkTest4KB(b, ring.WithOneHash()) }
+
+// TestOneHashFalsePositive ensures one hash rings have no false negatives and
+// stay within the false positive rate, for several rates.
+func TestOneHashFalsePositive(t *testing.T) {
+	const n = 100000
+	for _, fp := range []float64{0.1, 0.01, fpRate} {
+		r, _ := ring.Init(n, fp, ring.WithOneHash())
+		buff := make([]byte, 4)
+		for i := 0; i < n; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+		}
+		for i := 0; i < n; i++ {
+			intToByte(buff, i)
+			if !r.Test(buff) {
+				t.Fatalf("False negative for %d", i)
+			}
+		}
+		positives := 0
+		const probes = 1000000
+		for i := n; i < n+probes; i++ {
+			intToByte(buff, i)
+			if r.Test(buff) {
+				positives++
+			}
+		}
+		// allow for sampling noise around the target
+		if rate := float64(positives) / probes; rate > fp*1.1 {
+			t.Fatalf("False positive rate %f exceeds %f", rate, fp)
+		}
+	}
+}
+
+// TestOneHashMarshalMerge ensures the mode survives a marshal round trip,
+// combines with power of two sizing, and prevents merging with plain
+// partitioned rings.
+func TestOneHashMarshalMerge(t *testing.T) {
+	for _, opts := range [][]ring.Option{
+		{ring.WithOneHash()},
+		{ring.WithOneHash(), ring.WithPowerOfTwoSize()},
+	} {
+		r, _ := ring.Init(1000, fpRate, opts...)
+		data := []byte("hello")
+		r.Add(data)
+		out, _ := r.MarshalBinary()
+		if out[0] != 2 || out[1]&6 != 6 {
+			t.Fatalf("Unexpected header: version %d, flags %d", out[0], out[1])
+		}
+		r2 := new(ring.Ring)
+		if err := r2.UnmarshalBinary(out); err != nil {
+			t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+		}
+		if !r2.Test(data) {
+			t.Fatal("Data missing after UnmarshalBinary")
+		}
+		if err := r2.Merge(r); err != nil {
+			t.Fatalf("Unexpected error calling Merge: %v", err)
+		}
+
+		// the same partitions, hashed twice
+		plain := append([]byte(nil), out...)
+		plain[1] &^= 4
+		r3 := new(ring.Ring)
+		if err := r3.UnmarshalBinary(plain); err != nil {
+			t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+		}
+		if r.Merge(r3) == nil || r3.Merge(r) == nil {
+			t.Fatal("Expected error merging rings of different modes")
+		}
+
+		// the one hash flag requires the partitioned flag
+		out[1] &^= 2
+		if r2.UnmarshalBinary(out) == nil {
+			t.Fatal("Expected error unmarshaling one hash without partitions")
+		}
+	}
+}
+
+// TestNew ensures New and Init build identical rings, and that rings built
+// without options match the fixtures written by earlier releases.
+func TestNew(t *testing.T) {
+	for _, opts := range [][]ring.Option{
+		nil,
+		{ring.WithPartitioned(), ring.WithPowerOfTwoSize()},
+		{ring.WithOneHash()},
+		{ring.WithBlocked(), ring.WithSeed(7)},
+		{ring.WithHashRounds(3), ring.WithNoLock()},
+	} {
+		r, err := ring.New(1000, fpRate, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error from New: %v", err)
+		}
+		r2, _ := ring.Init(1000, fpRate, opts...)
+		r.Add([]byte("hello"))
+		r2.Add([]byte("hello"))
+		if !r.Equal(r2) {
+			t.Fatalf("New and Init differ with %d options", len(opts))
+		}
+	}
+
+	for file, opts := range map[string][]ring.Option{
+		"testdata/ring-v1.bin": nil,
+		"testdata/ring-v2.bin": {ring.WithPartitioned(), ring.WithPowerOfTwoSize()},
+	} {
+		fixture, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _ := ring.New(100, 0.01, opts...)
+		buff := make([]byte, 4)
+		for i := 0; i < 100; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+		}
+		if out, _ := r.MarshalBinary(); !bytes.Equal(out, fixture) {
+			t.Fatalf("%s: ring differs from the fixture", file)
+		}
+	}
+}
+
+// TestOptionsConflict ensures conflicting or invalid options are rejected with
+// a single ErrOptions naming every conflict.
+func TestOptionsConflict(t *testing.T) {
+	for _, c := range []struct {
+		opts []ring.Option
+		want []string
+	}{
+		{[]ring.Option{ring.WithNoLock(), ring.WithAdaptiveLock()}, []string{"WithAdaptiveLock"}},
+		{[]ring.Option{ring.WithBlocked(), ring.WithPartitioned()}, []string{"WithPartitioned"}},
+		{[]ring.Option{ring.WithOneHash(), ring.WithBlocked()}, []string{"WithOneHash"}},
+		{[]ring.Option{ring.WithHashRounds(0)}, []string{"WithHashRounds(-1)"}},
+		{[]ring.Option{ring.WithHashRounds(65)}, []string{"WithHashRounds(65)"}},
+		{[]ring.Option{ring.WithHashRounds(-2)}, []string{"WithHashRounds(-2)"}},
+		{
+			[]ring.Option{ring.WithAdaptiveLock(), ring.WithBlocked(), ring.WithHashRounds(100),
+				ring.WithPartitioned(), ring.WithNoLock()},
+			[]string{"WithAdaptiveLock", "WithPartitioned", "WithHashRounds(100)"},
+		},
+	} {
+		r, err := ring.New(1000, fpRate, c.opts...)
+		if r != nil || !errors.Is(err, ring.ErrOptions) {
+			t.Fatalf("Expected ErrOptions, got %v", err)
+		}
+		for _, want := range c.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Fatalf("Error %q does not mention %s", err, want)
+			}
+		}
+	}
+}
+
+// testOptionsRate adds elements to a ring built with opts, and fails on a false
+// negative or a false positive rate beyond the target.
+func testOptionsRate(t *testing.T, opts ...ring.Option) *ring.Ring {
+	t.Helper()
+	const n = 100000
+	r, err := ring.New(n, fpRate, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error from New: %v", err)
+	}
+	// allow for floating point error in the rate itself
+	if rate := r.Parameters().FalsePositiveRate(n); rate > fpRate*(1+1e-9) {
+		t.Fatalf("Theoretical false positive rate %f exceeds %f", rate, fpRate)
+	}
+	buff := make([]byte, 4)
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	positives := 0
+	const probes = 1000000
+	for i := 0; i < n+probes; i++ {
+		intToByte(buff, i)
+		if i < n && !r.Test(buff) {
+			t.Fatalf("False negative for %d", i)
+		}
+		if i >= n && r.Test(buff) {
+			positives++
+		}
+	}
+	// allow for sampling noise around the target
+	if rate := float64(positives) / probes; rate > fpRate*1.1 {
+		t.Fatalf("False positive rate %f exceeds %f with %+v", rate, fpRate, r.Parameters())
+	}
+	return r
+}
+
+// TestWithHashRounds ensures a fixed number of hash rounds is used, with the
+// ring sized to stay within the false positive rate.
+func TestWithHashRounds(t *testing.T) {
+	optimal, _ := ring.New(100000, fpRate)
+	for _, rounds := range []int{1, 4, 20} {
+		for _, opts := range [][]ring.Option{
+			{ring.WithHashRounds(rounds)},
+			{ring.WithHashRounds(rounds), ring.WithPartitioned()},
+			{ring.WithHashRounds(rounds), ring.WithBlocked()},
+		} {
+			r := testOptionsRate(t, opts...)
+			p := r.Parameters()
+			if p.HashRounds != uint64(rounds) {
+				t.Fatalf("Unexpected hash rounds: %d, expected %d", p.HashRounds, rounds)
+			}
+			if p.Bits < optimal.Parameters().Bits {
+				t.Fatalf("%d rounds need fewer bits than optimal: %d", rounds, p.Bits)
+			}
+		}
+	}
+}
+
+// TestWithSeed ensures seeded rings hold their data through marshaling,
+// hashing and compaction, map it to other bits than rings of other seeds, and
+// only merge with rings of the same seed.
+func TestWithSeed(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithOneHash()}, {ring.WithBlocked()}} {
+		testOptionsRate(t, append(opts, ring.WithSeed(1))...)
+
+		rings := make([]*ring.Ring, 3)
+		for i := range rings {
+			rings[i], _ = ring.New(1000, fpRate, append(opts, ring.WithSeed(uint64(i)))...)
+			rings[i].Add([]byte("hello"))
+			rings[i].AddHash(ring.NewDigest([]byte("world")))
+		}
+		seeded := rings[1]
+		if seeded.Parameters().Seed != 1 || seeded.Equal(rings[0]) || seeded.Equal(rings[2]) {
+			t.Fatal("Seeds do not change the bits of data")
+		}
+		if !seeded.TestHash(ring.NewDigest([]byte("hello"))) || !seeded.Test([]byte("world")) {
+			t.Fatal("Digests and data hash differently")
+		}
+		var err *ring.IncompatibleError
+		if !errors.As(seeded.Merge(rings[2]), &err) || err.Field != "seed" {
+			t.Fatalf("Unexpected error merging seeds: %v", err)
+		}
+
+		out, _ := seeded.MarshalBinary()
+		if out[0] != 3 {
+			t.Fatalf("Unexpected version: %d", out[0])
+		}
+		r := new(ring.Ring)
+		if err := r.UnmarshalBinary(out); err != nil {
+			t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+		}
+		if !r.Equal(seeded) || !r.Test([]byte("hello")) {
+			t.Fatal("Seeded ring changed by UnmarshalBinary")
+		}
+
+		out, _ = seeded.Compact().MarshalBinary()
+		c := new(ring.CompactRing)
+		if err := c.UnmarshalBinary(out); err != nil {
+			t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+		}
+		if !c.Test([]byte("hello")) || !c.Test([]byte("world")) {
+			t.Fatal("Data missing from the compacted seeded ring")
+		}
+	}
+}
+
+// TestWithNoLock ensures a ring without a write lock holds its data, with Test
+// concurrent with a single writer.
+func TestWithNoLock(t *testing.T) {
+	testOptionsRate(t, ring.WithNoLock())
+
+	r, _ := ring.New(10000, fpRate, ring.WithNoLock(), ring.WithFastReset())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buff := make([]byte, 4)
+		for i := 0; i < 10000; i++ {
+			intToByte(buff, i)
+			r.Test(buff)
+		}
+	}()
+	buff := make([]byte, 4)
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	<-done
+	r.Reset()
+	if r.Test(buff) {
+		t.Fatal("Data present after Reset")
+	}
+}
+
+// TestWithBlocked ensures blocked rings stay within the false positive rate,
+// set the bits of each data within a single block, and survive a marshal round
+// trip.
+func TestWithBlocked(t *testing.T) {
+	for _, opts := range [][]ring.Option{
+		{ring.WithBlocked()},
+		{ring.WithBlocked(), ring.WithPowerOfTwoSize()},
+	} {
+		testOptionsRate(t, opts...)
+
+		r, _ := ring.New(100000, fpRate, opts...)
+		p := r.Parameters()
+		if !p.Blocked || p.Bits%512 != 0 {
+			t.Fatalf("Unexpected parameters %+v", p)
+		}
+		r.Add([]byte("hello"))
+		out, _ := r.MarshalBinary()
+		if out[0] != 2 || out[1]&8 == 0 {
+			t.Fatalf("Unexpected header: version %d, flags %d", out[0], out[1])
+		}
+		blocks := map[int]bool{}
+		for i, v := range out[18:] {
+			if v != 0 {
+				blocks[i/64] = true
+			}
+		}
+		if len(blocks) != 1 {
+			t.Fatalf("Data set bits in %d blocks", len(blocks))
+		}
+
+		r2 := new(ring.Ring)
+		if err := r2.UnmarshalBinary(out); err != nil {
+			t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+		}
+		if !r2.Test([]byte("hello")) || r2.Parameters() != p {
+			t.Fatal("Blocked ring changed by UnmarshalBinary")
+		}
+		plain, _ := ring.New(100000, fpRate)
+		if r.Merge(plain) == nil {
+			t.Fatal("Expected error merging rings of different modes")
+		}
+
+		// blocked rings are whole blocks, and never partitioned
+		binary.BigEndian.PutUint64(out[2:10], p.Bits-8)
+		if r2.UnmarshalBinary(out[:len(out)-1]) == nil {
+			t.Fatal("Expected error unmarshaling a partial block")
+		}
+		binary.BigEndian.PutUint64(out[2:10], p.Bits)
+		out[1] |= 2
+		if r2.UnmarshalBinary(out) == nil {
+			t.Fatal("Expected error unmarshaling a partitioned blocked ring")
+		}
+	}
+}
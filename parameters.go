@@ -0,0 +1,302 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "math"
+
+// Parameters describes the construction of a ring, as chosen by Init or read by
+// UnmarshalBinary.
+type Parameters struct {
+	Bits        uint64 // number of bits (m)
+	HashRounds  uint64 // number of hash rounds (k)
+	Partitioned bool   // bits split into one partition per hash round
+	PowerOfTwo  bool   // number of bits, or of each partition, a power of two
+	Blocked     bool   // bits of each data set within one block of 512 bits
+	Seed        uint64 // seed of the hash rounds, 0 if unseeded
+}
+
+// Parameters returns the parameters of the ring. A zero Ring has zero
+// parameters.
+func (r *Ring) Parameters() Parameters {
+	b := r.set.Load()
+	if b == nil {
+		return Parameters{}
+	}
+	return b.parameters()
+}
+
+// parameters returns the parameters of the bitset.
+func (b *bitset) parameters() Parameters {
+	return Parameters{
+		Bits:        b.size,
+		HashRounds:  b.hash,
+		Partitioned: b.flags&flagPartitioned != 0,
+		PowerOfTwo:  b.flags&flagPowerOfTwo != 0,
+		Blocked:     b.flags&flagBlocked != 0,
+		Seed:        b.seed,
+	}
+}
+
+// FalsePositiveRate returns the theoretical false positive rate of a ring with
+// the parameters once elements have been added. For a ring created by Init it
+// is within the requested falsePositive rate for the requested elements.
+func (p Parameters) FalsePositiveRate(elements uint64) float64 {
+	if p.Bits == 0 || p.HashRounds == 0 {
+		return 1
+	}
+	n, k := float64(elements), float64(p.HashRounds)
+	if p.Partitioned {
+		// each round sets one of Bits/k bits in its own partition
+		s := float64(p.Bits / p.HashRounds)
+		return math.Pow(-math.Expm1(n*math.Log1p(-1/s)), k)
+	}
+	if p.Blocked {
+		return blockedRate(n, float64(p.Bits/summaryBlock), newBlockRates(p.HashRounds))
+	}
+	return FalsePositiveRate(p.Bits, p.HashRounds, elements)
+}
+
+// EstimateParameters returns the number of bits m and hash rounds k that New
+// chooses for a ring of elements within the falsePositive rate, without
+// Options, or the error New returns. It allocates nothing, so it suits
+// planning the memory of rings.
+func EstimateParameters(elements int, falsePositive float64) (m, k uint64, err error) {
+	n, err := checkArgs(elements, falsePositive)
+	if err != nil {
+		return 0, 0, err
+	}
+	return optimalParams(n, falsePositive, 0)
+}
+
+// EstimateFalsePositive returns the theoretical false positive rate of a ring
+// of m bits and k hash rounds, without Options, once elements have been added,
+// as by FalsePositiveRate. Negative elements count as none.
+func EstimateFalsePositive(m, k uint64, elements int) float64 {
+	if elements < 0 {
+		elements = 0
+	}
+	return FalsePositiveRate(m, k, uint64(elements))
+}
+
+// FalsePositiveRate returns the theoretical false positive rate of a filter of
+// m bits and k hash rounds once n elements have been added:
+//
+//	(1-(1-1/m)^(kn))^k
+//
+// which unlike the common approximation (1-e^(-kn/m))^k does not assume a
+// large number of bits, so it also holds for filters of a few elements. It is
+// the rate New sizes rings by, and that of the FalsePositiveRate of
+// Parameters for rings without WithPartitioned or WithBlocked. It is defined
+// for every input, and never NaN: without bits or hash rounds, the rate is 1,
+// and without elements, 0.
+func FalsePositiveRate(m, k, n uint64) float64 {
+	if m == 0 || k == 0 {
+		return 1
+	}
+	return math.Pow(-math.Expm1(float64(k)*float64(n)*math.Log1p(-1/float64(m))), float64(k))
+}
+
+// RequiredBits returns the fewest bits m holding n elements within the fp rate,
+// by FalsePositiveRate, with the better of the whole numbers of hash rounds
+// either side of the optimum, -log2(fp). It is the number of bits New chooses,
+// before raising it to the 64 bits of the smallest ring and checking it
+// against the limits of a ring, and is capped at 1<<62. Inputs without an
+// answer, n of 0 or fp outside (0, 1), return 0.
+func RequiredBits(n uint64, fp float64) uint64 {
+	if n == 0 || checkFalsePositive(fp) != nil {
+		return 0
+	}
+	m, _ := requiredBits(n, fp, 0)
+	return m
+}
+
+// OptimalK returns the number of hash rounds giving the lowest false positive
+// rate, by FalsePositiveRate, to a filter of m bits once n elements have been
+// added: the better of the whole numbers either side of the optimum,
+// (m/n)*ln(2), and at least 1. Any number of rounds is optimal for m or n of
+// 0, and 1 is returned.
+func OptimalK(m, n uint64) uint64 {
+	if m == 0 || n == 0 {
+		return 1
+	}
+	k := float64(m) / float64(n) * math.Ln2
+	best, rate := uint64(1), math.Inf(1)
+	for _, c := range []float64{math.Floor(k), math.Ceil(k)} {
+		c = math.Max(c, 1)
+		if r := FalsePositiveRate(m, uint64(c), n); r < rate {
+			best, rate = uint64(c), r
+		}
+	}
+	return best
+}
+
+// optimalRounds returns the number of bits of n elements within the fp rate by
+// the common approximation, -n*ln(fp)/ln(2)^2, and the optimal, fractional,
+// number of hash rounds for them.
+func optimalRounds(n uint64, fp float64) (m, k float64) {
+	m = (-1 * float64(n) * math.Log(fp)) / math.Pow(math.Log(2), 2)
+	k = (m / float64(n)) * math.Log(2)
+	return m, k
+}
+
+// requiredBits returns the fewest bits holding n elements within the fp rate,
+// capped at 1<<62, and the hash rounds for them: rounds if not 0, or otherwise
+// whichever of the whole numbers either side of the optimal number of rounds
+// needs fewer bits. The optimum is rarely whole, and rounding it alone could
+// exceed the rate, so each is tried with the least number of bits meeting it.
+func requiredBits(n uint64, fp float64, rounds uint64) (m, k uint64) {
+	_, optimal := optimalRounds(n, fp)
+	candidates := []float64{math.Floor(optimal), math.Ceil(optimal)}
+	if rounds != 0 {
+		candidates = []float64{float64(rounds)}
+	}
+	best := math.Inf(1)
+	var hash float64
+	for _, c := range candidates {
+		if c < 1 {
+			continue
+		}
+		// solve (1-(1-1/s)^(cn))^c = p for s
+		s := math.Ceil(-1 / math.Expm1(math.Log1p(-math.Pow(fp, 1/c))/(c*float64(n))))
+		if !(s < 1<<62) {
+			s = 1 << 62
+		}
+		// the rate of FalsePositiveRate is the one that must hold, so rounding
+		// error of the solution is corrected by it
+		if bits := float64(leastBits(uint64(s), uint64(c), n, fp)); bits < best {
+			best, hash = bits, c
+		}
+	}
+	return uint64(best), uint64(hash)
+}
+
+// leastBits returns the fewest bits, from s up to 1<<62, holding n elements
+// within the fp rate by FalsePositiveRate with k hash rounds. The rate falls as
+// bits are added, so the bits are found by doubling the step from s until the
+// rate holds, then bisecting the last step, in whole numbers: a float64 no
+// longer counts by one beyond 1<<53.
+func leastBits(s, k, n uint64, fp float64) uint64 {
+	const limit = 1 << 62
+	if s >= limit || FalsePositiveRate(s, k, n) <= fp {
+		return s
+	}
+	// the rate is exceeded at lo, and held at hi or hi is the limit
+	lo, hi := s, s
+	for step := uint64(1); ; step *= 2 {
+		if hi = lo + step; hi >= limit {
+			hi = limit
+			break
+		}
+		if FalsePositiveRate(hi, k, n) <= fp {
+			break
+		}
+		lo = hi
+	}
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if FalsePositiveRate(mid, k, n) > fp {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi
+}
+
+// blockedRate returns the false positive rate of a blocked ring of blocks
+// blocks once n elements have been added, with the rates of blocks of each
+// number of elements in t. The number of elements in a block is Poisson
+// distributed, so the rate is that of a block of each number of elements,
+// weighted by its probability. Numbers beyond a dozen standard deviations of
+// the mean are not weighed.
+func blockedRate(n, blocks float64, t *blockRates) float64 {
+	if n == 0 {
+		return 0
+	}
+	if blocks == 0 {
+		return 1
+	}
+	mean := n / blocks
+	spread := 12*math.Sqrt(mean) + 32
+	var rate float64
+	for j := math.Max(0, math.Floor(mean-spread)); j <= mean+spread; j++ {
+		lg, _ := math.Lgamma(j + 1)
+		rate += math.Exp(j*math.Log(mean)-mean-lg) * t.at(int(j))
+	}
+	return math.Min(rate, 1)
+}
+
+// blockRates holds the false positive rate of a block of summaryBlock bits
+// holding each number of elements of hash rounds, extended as needed. The
+// rate is not that of the expected number of set bits: it depends on their
+// spread too, which grows in importance with the number of rounds, so the
+// distribution of set bits is tracked round by round.
+type blockRates struct {
+	hash  uint64    // hash rounds of each element
+	dist  []float64 // probability of each number of set bits
+	pow   []float64 // probability a round of a query hits a block of each number of set bits
+	rates []float64 // rate of a block of each number of elements
+}
+
+// newBlockRates returns the rates of blocks with hash rounds per element.
+func newBlockRates(hash uint64) *blockRates {
+	t := &blockRates{hash: hash, dist: make([]float64, summaryBlock+1), pow: make([]float64, summaryBlock+1)}
+	t.dist[0] = 1
+	for x := range t.pow {
+		t.pow[x] = math.Pow(float64(x)/summaryBlock, float64(hash))
+	}
+	return t
+}
+
+// at returns the rate of a block holding j elements.
+func (t *blockRates) at(j int) float64 {
+	for len(t.rates) <= j {
+		if l := len(t.rates); l > 0 && t.rates[l-1] > 1-1e-12 {
+			// saturated, as are blocks of more elements
+			return 1
+		}
+		var rate float64
+		for x, p := range t.dist {
+			rate += p * t.pow[x]
+		}
+		t.rates = append(t.rates, rate)
+		// add the rounds of another element, each setting a uniformly
+		// chosen bit
+		for i := uint64(0); i < t.hash; i++ {
+			for x := summaryBlock; x > 0; x-- {
+				t.dist[x] = t.dist[x]*float64(x)/summaryBlock +
+					t.dist[x-1]*float64(summaryBlock-x+1)/summaryBlock
+			}
+			t.dist[0] = 0
+		}
+	}
+	return t.rates[j]
+}
+
+// Capacity returns the largest number of elements a ring with the parameters
+// holds within the falsePositive rate, by the rate of FalsePositiveRate. It is
+// 0 if not even a single element is within the rate.
+func (p Parameters) Capacity(falsePositive float64) uint64 {
+	if p.FalsePositiveRate(1) > falsePositive {
+		return 0
+	}
+	// the rate rises with every element, so the capacity is found by doubling,
+	// then bisecting
+	lo, hi := uint64(1), uint64(2)
+	for p.FalsePositiveRate(hi) <= falsePositive {
+		if hi >= 1<<62 {
+			return hi
+		}
+		lo, hi = hi, hi*2
+	}
+	for lo+1 < hi {
+		if mid := lo + (hi-lo)/2; p.FalsePositiveRate(mid) <= falsePositive {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestFalsePositiveRate ensures the theoretical false positive rate of the
+// parameters chosen by Init is within the requested rate, after rounding the
+// number of bits and hash rounds to whole numbers.
+func TestFalsePositiveRate(t *testing.T) {
+	for elements := uint64(10); elements <= 1e8; elements *= 10 {
+		for _, fp := range []float64{0.1, 0.05, 0.01, 0.005, 1e-3, 1e-4, 1e-5, 1e-6} {
+			r, err := ring.InitUint(elements, fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := r.Parameters()
+			// allow for floating point error in the rate itself
+			if got := p.FalsePositiveRate(elements); got > fp*(1+1e-9) {
+				t.Errorf("%d elements at %g: %d bits, %d rounds reach %g",
+					elements, fp, p.Bits, p.HashRounds, got)
+			}
+		}
+	}
+}
+
+// TestParameters ensures Parameters reports the parameters of rings, including
+// unmarshaled and zero Rings.
+func TestParameters(t *testing.T) {
+	r, _ := ring.Init(1000, 0.01, ring.WithPartitioned(), ring.WithPowerOfTwoSize())
+	p := r.Parameters()
+	if !p.Partitioned || !p.PowerOfTwo || p.HashRounds != 7 || p.Bits != 7*2048 {
+		t.Fatalf("unexpected parameters %+v", p)
+	}
+	if rate := p.FalsePositiveRate(1000); rate > 0.01 {
+		t.Fatalf("unexpected rate %g", rate)
+	}
+	data, _ := r.MarshalBinary()
+	var r2 ring.Ring
+	if r2.Parameters() != (ring.Parameters{}) {
+		t.Fatal("zero ring has parameters")
+	}
+	if err := r2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if r2.Parameters() != p {
+		t.Fatalf("unmarshaled parameters %+v, expected %+v", r2.Parameters(), p)
+	}
+}
+
+// TestTinyElements ensures rings of a few elements get at least 64 bits, with
+// a theoretical rate within the requested rate, and a rate measured by probing
+// near it. The rate of a single ring of a few elements depends on where their
+// bits happen to fall, so it is averaged over a thousand rings of distinct
+// elements. The rounds of an element are derived from a few hashes, which on a
+// ring of tens of bits share bits more often than independent hashes would,
+// raising the measured rate up to a quarter above the theoretical one.
+func TestTinyElements(t *testing.T) {
+	const (
+		trials = 1000
+		probes = 1000
+	)
+	opts := map[string][]ring.Option{
+		"default":     nil,
+		"partitioned": {ring.WithPartitioned()},
+		"oneHash":     {ring.WithOneHash()},
+		"blocked":     {ring.WithBlocked()},
+	}
+	key := make([]byte, 8)
+	for name, opt := range opts {
+		for _, elements := range []int{1, 2, 5, 10} {
+			for _, fp := range []float64{0.5, 0.1, 0.01, 0.001} {
+				var positives int
+				for trial := 0; trial < trials; trial++ {
+					r, err := ring.Init(elements, fp, opt...)
+					if err != nil {
+						t.Fatal(err)
+					}
+					p := r.Parameters()
+					if p.Bits < 64 || p.HashRounds > p.Bits ||
+						p.FalsePositiveRate(uint64(elements)) > fp*(1+1e-9) {
+						t.Fatalf("%s: %d elements at %g: %d bits, %d rounds",
+							name, elements, fp, p.Bits, p.HashRounds)
+					}
+					base := trial * (elements + probes)
+					for i := base; i < base+elements; i++ {
+						intToByte(key, i)
+						r.Add(key)
+					}
+					for i := base + elements; i < base+elements+probes; i++ {
+						intToByte(key, i)
+						if r.Test(key) {
+							positives++
+						}
+					}
+				}
+				// allow for the shared bits, and four standard deviations of
+				// sampling error
+				const n = trials * probes
+				rate := float64(positives) / n
+				if limit := 1.5*fp + 4*math.Sqrt(fp*(1-fp)/n); rate > limit {
+					t.Errorf("%s: %d elements at %g: reached %g", name, elements, fp, rate)
+				}
+			}
+		}
+	}
+}
+
+// TestEstimateParameters pins the parameters chosen for a range of elements and
+// rates, which must be those of New and within the rate of
+// EstimateFalsePositive.
+func TestEstimateParameters(t *testing.T) {
+	for _, c := range []struct {
+		elements int
+		fp       float64
+		m, k     uint64
+	}{
+		{1, 0.5, 64, 1},
+		{1, 0.01, 64, 6},
+		{1, 1e-12, 64, 39},
+		{10, 0.1, 64, 3},
+		{10, 0.01, 97, 6},
+		{10, 0.001, 145, 9},
+		{10, 1e-06, 289, 19},
+		{1000, 0.5, 1444, 1},
+		{1000, 0.1, 4809, 3},
+		{1000, 0.01, 9594, 7},
+		{1000, 0.001, 14379, 10},
+		{1000, 1e-06, 28756, 20},
+		{1000, 1e-12, 57512, 40},
+		{1000000, 0.5, 1442696, 1},
+		{1000000, 0.01, 9592956, 7},
+		{1000000, 1e-06, 28755280, 20},
+		{1000000000, 0.1, 4808327362, 3},
+		{1000000000, 0.001, 14377639340, 10},
+		{1000000000, 1e-12, 57510557355, 40},
+	} {
+		m, k, err := ring.EstimateParameters(c.elements, c.fp)
+		if m/8+1 > math.MaxInt32 && strconv.IntSize == 32 {
+			if !errors.Is(err, ring.ErrTooLarge) {
+				t.Errorf("%d elements at %g: expected ErrTooLarge, got %v", c.elements, c.fp, err)
+			}
+			continue
+		}
+		if err != nil || m != c.m || k != c.k {
+			t.Errorf("%d elements at %g: %d bits, %d rounds, %v, expected %d bits, %d rounds",
+				c.elements, c.fp, m, k, err, c.m, c.k)
+		}
+		if rate := ring.EstimateFalsePositive(m, k, c.elements); rate > c.fp {
+			t.Errorf("%d elements at %g: rate %g", c.elements, c.fp, rate)
+		}
+		if c.elements > 1000000 {
+			// allocating the ring is only worth it for the smaller ones
+			continue
+		}
+		r, _ := ring.New(c.elements, c.fp)
+		if p := r.Parameters(); p.Bits != m || p.HashRounds != k {
+			t.Errorf("%d elements at %g: New chose %+v", c.elements, c.fp, p)
+		}
+	}
+
+	for _, c := range []struct {
+		elements int
+		fp       float64
+		err      error
+	}{
+		{0, 0.01, ring.ErrElements},
+		{100, 0, ring.ErrFalsePositive},
+		{100, 1, ring.ErrFalsePositive},
+		{100, 1e-30, ring.ErrHashRounds},
+	} {
+		if _, _, err := ring.EstimateParameters(c.elements, c.fp); !errors.Is(err, c.err) {
+			t.Errorf("%d elements at %g: expected %v, got %v", c.elements, c.fp, c.err, err)
+		}
+	}
+}
+
+// TestRequiredBitsHuge ensures sizes beyond the 53 bits a float64 counts by one
+// are found, as UnmarshalBinary of a ScalableRing sizes its layers from
+// untrusted element counts and rates.
+func TestRequiredBitsHuge(t *testing.T) {
+	n, fp := uint64(0x0030303030303030), math.Float64frombits(0x3f30303030303030)
+	m := ring.RequiredBits(n, fp)
+	if m < 1<<53 || m >= 1<<62 {
+		t.Fatalf("%d elements at %g: %d bits", n, fp, m)
+	}
+	if rate := ring.FalsePositiveRate(m, ring.OptimalK(m, n), n); rate > fp {
+		t.Errorf("%d elements at %g: %d bits give rate %g", n, fp, m, rate)
+	}
+}
+
+// TestEstimateFalsePositive pins the rate of a few parameters against the
+// formula, including those without bits, rounds or elements.
+func TestEstimateFalsePositive(t *testing.T) {
+	for _, c := range []struct {
+		m, k     uint64
+		elements int
+		want     float64
+	}{
+		{1000, 7, 100, 0.008213554634050215},
+		{9586, 7, 1000, 0.010037019796068612},
+		{9586, 7, 2000, 0.15743051866973418},
+		{64, 1, 1, 1.0 / 64},
+		{1 << 20, 3, 1000000, 0.8380013605286685},
+		{1000, 7, 0, 0},
+		{1000, 7, -1, 0},
+		{0, 7, 100, 1},
+		{1000, 0, 100, 1},
+	} {
+		got := ring.EstimateFalsePositive(c.m, c.k, c.elements)
+		if math.Abs(got-c.want) > c.want*1e-12 {
+			t.Errorf("%d bits, %d rounds, %d elements: rate %v, expected %v", c.m, c.k, c.elements, got, c.want)
+		}
+		p := ring.Parameters{Bits: c.m, HashRounds: c.k}
+		if c.elements >= 0 && p.FalsePositiveRate(uint64(c.elements)) != got {
+			t.Errorf("%d bits, %d rounds: Parameters disagree", c.m, c.k)
+		}
+	}
+}
+
+// TestFalsePositiveRateFunc pins the rate against references computed
+// independently to 60 digits, and its degenerate inputs.
+func TestFalsePositiveRateFunc(t *testing.T) {
+	for _, c := range []struct {
+		m, k, n uint64
+		want    float64
+	}{
+		{1000, 7, 100, 0.0082135546340502165},
+		{9586, 7, 1000, 0.010037019796068617},
+		{64, 1, 1, 0.015625},
+		{1 << 20, 10, 50000, 6.1564556126896943e-05},
+		{1 << 30, 20, 10000000, 4.0384873554269018e-16},
+		{8, 3, 100, 1},
+		{100, 3, 0, 0},
+		{0, 3, 100, 1},
+		{100, 0, 100, 1},
+		{0, 0, 0, 1},
+	} {
+		got := ring.FalsePositiveRate(c.m, c.k, c.n)
+		if math.IsNaN(got) || math.Abs(got-c.want) > c.want*1e-9 {
+			t.Errorf("%d bits, %d rounds, %d elements: rate %v, expected %v", c.m, c.k, c.n, got, c.want)
+		}
+	}
+}
+
+// TestRequiredBits pins the bits against the fewest bits of any number of
+// rounds found by an independent search, and its degenerate inputs.
+func TestRequiredBits(t *testing.T) {
+	for _, c := range []struct {
+		n    uint64
+		fp   float64
+		want uint64
+	}{
+		{1, 0.5, 2},
+		{1, 0.01, 11},
+		{10, 1e-9, 432},
+		{100, 0.01, 960},
+		{1000, 0.001, 14379},
+		{12345, 0.05, 77120},
+		{1000000, 0.01, 9592956},
+		{0, 0.01, 0},
+		{100, 0, 0},
+		{100, 1, 0},
+		{100, -0.5, 0},
+		{100, math.NaN(), 0},
+	} {
+		if got := ring.RequiredBits(c.n, c.fp); got != c.want {
+			t.Errorf("%d elements at %g: %d bits, expected %d", c.n, c.fp, got, c.want)
+		}
+	}
+	if got := ring.RequiredBits(math.MaxUint64, 1e-300); got != 1<<62 {
+		t.Errorf("%d bits, expected the cap of %d", got, uint64(1<<62))
+	}
+}
+
+// TestOptimalK pins the rounds against the best of every number of rounds
+// found by an independent search, and its degenerate inputs.
+func TestOptimalK(t *testing.T) {
+	for _, c := range []struct {
+		m, n, want uint64
+	}{
+		{1000, 100, 7},
+		{9586, 1000, 7},
+		{64, 100, 1},
+		{10, 1, 7},
+		{1 << 20, 1000, 727},
+		{200, 1000, 1},
+		{0, 100, 1},
+		{100, 0, 1},
+	} {
+		if got := ring.OptimalK(c.m, c.n); got != c.want {
+			t.Errorf("%d bits, %d elements: %d rounds, expected %d", c.m, c.n, got, c.want)
+		}
+	}
+}
+
+// TestCalculatorsAgree ensures Init, Parameters, InitByBytes and Recommend
+// report the numbers of the calculators.
+func TestCalculatorsAgree(t *testing.T) {
+	for _, c := range []struct {
+		n  int
+		fp float64
+	}{{100, 0.01}, {1000, 0.001}, {12345, 0.05}, {1000000, 0.01}} {
+		r, _ := ring.Init(c.n, c.fp)
+		p := r.Parameters()
+		if p.Bits != ring.RequiredBits(uint64(c.n), c.fp) {
+			t.Errorf("%d elements at %g: Init chose %d bits, expected %d", c.n, c.fp, p.Bits, ring.RequiredBits(uint64(c.n), c.fp))
+		}
+		if got := p.FalsePositiveRate(uint64(c.n)); got != ring.FalsePositiveRate(p.Bits, p.HashRounds, uint64(c.n)) || got > c.fp {
+			t.Errorf("%d elements at %g: Parameters report rate %g", c.n, c.fp, got)
+		}
+		b, _ := ring.InitByBytes(p.Bits/8+1, c.n)
+		if bp := b.Parameters(); bp.HashRounds != ring.OptimalK(bp.Bits, uint64(c.n)) {
+			t.Errorf("%d elements: InitByBytes chose %d rounds, expected %d", c.n, bp.HashRounds, ring.OptimalK(bp.Bits, uint64(c.n)))
+		}
+		for _, key := range ring.RandomKeys(c.n, 1) {
+			r.Add(key)
+		}
+		rec := r.Recommend(c.fp)
+		if rec.Bits != ring.RequiredBits(rec.Elements, c.fp) {
+			t.Errorf("%d elements at %g: Recommend chose %d bits, expected %d", c.n, c.fp, rec.Bits, ring.RequiredBits(rec.Elements, c.fp))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Pool recycles empty rings of fixed parameters, for workloads creating and
+// discarding many short-lived rings, such as one per session. Recycled rings
+// keep their allocated bit arrays, which Put zeroes in place, so a Get served
+// from the pool allocates nothing. It is safe for concurrent use.
+type Pool struct {
+	template *Ring // empty ring of the parameters, never handed out
+	pool     sync.Pool
+}
+
+// NewPool returns a pool of rings of elements within the falsePositive rate,
+// sized by New with the same arguments, or the error of New.
+func NewPool(elements int, falsePositive float64, opts ...Option) (*Pool, error) {
+	r, err := New(elements, falsePositive, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Pool{template: r}, nil
+}
+
+// Get returns an empty ring with the parameters of the pool, recycled if one
+// is available.
+func (p *Pool) Get() *Ring {
+	if r, ok := p.pool.Get().(*Ring); ok {
+		return r
+	}
+	return p.template.emptyClone()
+}
+
+// Put zeroes the ring in place and returns it to the pool. The ring must no
+// longer be used by the caller, nor concurrently by anyone else. A ring whose
+// parameters or Options differ from those of the pool is rejected with an
+// error matching ErrIncompatible, and left unchanged.
+func (p *Pool) Put(r *Ring) error {
+	if r == nil {
+		return ErrNilRing
+	}
+	b := r.set.Load()
+	if b == nil {
+		return ErrUninitialized
+	}
+	t := p.template
+	if err := t.set.Load().compatible(b.params); err != nil {
+		return err
+	}
+	if r.offHeap != t.offHeap || r.adaptive != t.adaptive || r.noLock != t.noLock ||
+		r.fastReset != t.fastReset || r.maxMemory != t.maxMemory ||
+		r.normalize != t.normalize || !r.saturation.same(t.saturation) {
+		return fmt.Errorf("%w: Options differ from the pool", ErrIncompatible)
+	}
+	r.zero()
+	p.pool.Put(r)
+	return nil
+}
+
+// emptyClone returns an empty ring with the parameters and Options of the
+// ring.
+func (r *Ring) emptyClone() *Ring {
+	c := &Ring{
+		params:     r.params,
+		offHeap:    r.offHeap,
+		adaptive:   r.adaptive,
+		noLock:     r.noLock,
+		fastReset:  r.fastReset,
+		maxMemory:  r.maxMemory,
+		target:     r.target,
+		normalize:  r.normalize,
+		saturation: r.saturation.clone(),
+		log:        r.log,
+		updates:    r.updates.clone(),
+		truth:      r.truth.clone(),
+		mutex:      &sync.RWMutex{},
+	}
+	c.set.Store(c.emptyBitset(c.params))
+	return c
+}
+
+// zero clears the ring in place, keeping its allocated chunks, unlike Reset
+// which publishes a new bit array. Lock-free readers would observe a partially
+// cleared ring, so the ring must not be in use. Rings using WithFastReset are
+// cleared by Reset, which already clears them in place.
+func (r *Ring) zero() {
+	if r.fastReset {
+		r.Reset()
+		return
+	}
+	r.lock()
+	defer r.unlock()
+	b := r.set.Load()
+	for _, c := range b.chunks {
+		c = c[:cap(c)]
+		for i := range c {
+			c[i] = 0
+		}
+	}
+	summary := b.summary[:cap(b.summary)]
+	for i := range summary {
+		summary[i] = 0
+	}
+	r.clearSetBits()
+	r.dropDigests()
+	r.truncateUpdates()
+	r.clearTruth()
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestPool ensures rings of the pool have its parameters and are empty, with
+// no bits of earlier sessions.
+func TestPool(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithFastReset()}, {ring.WithBlocked(), ring.WithSeed(7)}} {
+		p, err := ring.NewPool(1000, 0.01, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		empty, _ := ring.New(1000, 0.01, opts...)
+		for session := 0; session < 10; session++ {
+			r := p.Get()
+			if !r.Equal(empty) {
+				t.Fatalf("session %d: ring is not empty", session)
+			}
+			for i := 0; i < 1000; i++ {
+				r.Add([]byte(strconv.Itoa(session) + "-" + strconv.Itoa(i)))
+			}
+			if err := p.Put(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// TestPoolPut ensures rings of other parameters or Options are rejected and
+// left unchanged.
+func TestPoolPut(t *testing.T) {
+	p, _ := ring.NewPool(1000, 0.01)
+	for _, c := range []struct {
+		name string
+		ring *ring.Ring
+	}{
+		{"size", mustInit(ring.New(2000, 0.01))},
+		{"seed", mustInit(ring.New(1000, 0.01, ring.WithSeed(1)))},
+		{"flags", mustInit(ring.New(1000, 0.01, ring.WithPowerOfTwoSize()))},
+		{"options", mustInit(ring.New(1000, 0.01, ring.WithNoLock()))},
+	} {
+		c.ring.Add([]byte("data"))
+		if err := p.Put(c.ring); !errors.Is(err, ring.ErrIncompatible) {
+			t.Fatalf("%s: expected ErrIncompatible, got %v", c.name, err)
+		}
+		if !c.ring.Test([]byte("data")) {
+			t.Fatalf("%s: rejected ring changed", c.name)
+		}
+	}
+	if err := p.Put(nil); !errors.Is(err, ring.ErrNilRing) {
+		t.Fatalf("expected ErrNilRing, got %v", err)
+	}
+	if err := p.Put(new(ring.Ring)); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+	if _, err := ring.NewPool(0, 0.01); !errors.Is(err, ring.ErrElements) {
+		t.Fatalf("expected ErrElements, got %v", err)
+	}
+}
+
+// mustInit returns the ring of a constructor known to succeed.
+func mustInit(r *ring.Ring, err error) *ring.Ring {
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// TestPoolConcurrent ensures concurrent sessions never observe each other's
+// data, which the race detector verifies too.
+func TestPoolConcurrent(t *testing.T) {
+	p, _ := ring.NewPool(100, 0.0001)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for session := 0; session < 200; session++ {
+				r := p.Get()
+				prefix := strconv.Itoa(w) + "-"
+				for i := 0; i < 100; i++ {
+					if r.Test([]byte(strconv.Itoa(i))) {
+						t.Errorf("worker %d: data of another session", w)
+						return
+					}
+					r.Add([]byte(prefix + strconv.Itoa(i)))
+				}
+				r.Add([]byte(strconv.Itoa(session % 100)))
+				if err := p.Put(r); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// BenchmarkPoolSession runs a session of 100 elements on a ring of the pool.
+func BenchmarkPoolSession(b *testing.B) {
+	p, _ := ring.NewPool(1000, 0.01)
+	buff := make([]byte, 4)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r := p.Get()
+		for j := 0; j < 100; j++ {
+			intToByte(buff, j)
+			r.Add(buff)
+		}
+		p.Put(r)
+	}
+}
+
+// BenchmarkInitSession runs a session of 100 elements on a new ring.
+func BenchmarkInitSession(b *testing.B) {
+	buff := make([]byte, 4)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r, _ := ring.Init(1000, 0.01)
+		for j := 0; j < 100; j++ {
+			intToByte(buff, j)
+			r.Add(buff)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+// maxSorted is the largest number of hash rounds whose indices are sorted
+// before probing.
+const maxSorted = 16
+
+// sortBits is the number of bits above which probes are issued in ascending
+// address order. Rings this large span several chunks and far exceed the last
+// level cache, so each probe is likely a cache and TLB miss, and ordered probes
+// let the hardware prefetcher and page walker overlap them.
+var sortBits uint64 = chunkBytes * 8
+
+// sorted returns if probes into b are issued in ascending order.
+func (b *bitset) sorted() bool {
+	return b.size > sortBits && b.hash <= maxSorted
+}
+
+// sortedProbes stores the indices of every hash round in buf, sorted in
+// ascending order, and returns them. The hash rounds of b must not exceed
+// maxSorted.
+func (b *bitset) sortedProbes(hash *rounds, buf *[maxSorted]uint64) []uint64 {
+	indices := buf[:b.hash]
+	for i := range indices {
+		index := b.index(hash, uint64(i))
+		// insertion sort, as there are only a few indices
+		j := i
+		for ; j > 0 && indices[j-1] > index; j-- {
+			indices[j] = indices[j-1]
+		}
+		indices[j] = index
+	}
+	return indices
+}
+
+// setIndex activates the bit at index of the published bitset b. If the chunk
+// holding it must be allocated, a copy of b with the chunk is published first.
+// It returns the bitset now published. The write lock must be held.
+func (r *Ring) setIndex(b *bitset, index uint64) *bitset {
+	if n := b.withChunk(index); n != b {
+		// publish the new chunk before setting bits within it
+		b = n
+		r.set.Store(b)
+	}
+	b.set(index)
+	return b
+}
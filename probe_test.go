@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// withUnsortedProbes runs f with probe sorting disabled.
+func withUnsortedProbes(f func()) {
+	old := sortBits
+	sortBits = math.MaxUint64
+	defer func() { sortBits = old }()
+	f()
+}
+
+// BenchmarkProbeLarge measures Add and Test with random keys on a 4GB ring,
+// with and without sorted probes. It is skipped unless RING_BENCH_LARGE is
+// set, as it allocates 4GB; RING_BENCH_LARGE may hold the ring size in MB
+// instead.
+func BenchmarkProbeLarge(b *testing.B) {
+	if os.Getenv("RING_BENCH_LARGE") == "" {
+		b.Skip("set RING_BENCH_LARGE to probe a 4GB ring")
+	}
+	mb, err := strconv.Atoi(os.Getenv("RING_BENCH_LARGE"))
+	if err != nil {
+		mb = 4096
+	}
+	r := newSizedRing(uint64(mb)<<23, 7)
+	defer r.Release()
+	// touch every page of the bit array
+	added := r.size / 32768
+	buff := make([]byte, 8)
+	for i := uint64(0); i < added; i++ {
+		binary.LittleEndian.PutUint64(buff, i)
+		r.Add(buff)
+	}
+
+	for _, sorted := range []bool{false, true} {
+		name := "Unsorted"
+		if sorted {
+			name = "Sorted"
+		}
+		probe := func() {
+			b.Run(name+"/Add", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					binary.LittleEndian.PutUint64(buff, rand.Uint64())
+					r.Add(buff)
+				}
+			})
+			b.Run(name+"/TestMiss", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					binary.LittleEndian.PutUint64(buff, rand.Uint64())
+					r.Test(buff)
+				}
+			})
+			b.Run(name+"/TestHit", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					binary.LittleEndian.PutUint64(buff, rand.Uint64()%added)
+					r.Test(buff)
+				}
+			})
+		}
+		if sorted {
+			probe()
+		} else {
+			withUnsortedProbes(probe)
+		}
+	}
+}
+
+// TestSortedProbes ensures sorted probes set and test the same bits.
+func TestSortedProbes(t *testing.T) {
+	size := uint64(chunkBytes*8 + 8192)
+	sorted := newSizedRing(size, 7)
+	unsorted := newSizedRing(size, 7)
+	if !sorted.set.Load().sorted() {
+		t.Fatal("probes not sorted")
+	}
+	addRange(0, 10000, sorted)
+	withUnsortedProbes(func() { addRange(0, 10000, unsorted) })
+	if !sameMarshal(sorted, unsorted) {
+		t.Fatal("sorted probes set different bits")
+	}
+	buff := make([]byte, 8)
+	for i := uint64(0); i < 20000; i++ {
+		binary.LittleEndian.PutUint64(buff, i)
+		found := sorted.Test(buff)
+		var want bool
+		withUnsortedProbes(func() { want = sorted.Test(buff) })
+		if found != want {
+			t.Fatalf("sorted probes changed result for %d", i)
+		}
+	}
+}
+
+func TestSortedProbesAllocs(t *testing.T) {
+	b := newBitset(params{size: chunkBytes*8 + 8192, hash: maxSorted}, false)
+	hash := hashRounds([]byte("data"), 0)
+	allocs := testing.AllocsPerRun(100, func() {
+		var buf [maxSorted]uint64
+		indices := b.sortedProbes(&hash, &buf)
+		for i := 1; i < len(indices); i++ {
+			if indices[i-1] > indices[i] {
+				t.Fatal("indices not sorted")
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("sorting allocated %v times", allocs)
+	}
+}
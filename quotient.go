@@ -0,0 +1,542 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// quotientVersion is the marshaled version of a quotient filter.
+	quotientVersion = 20
+	// quotientLoad is the load factor above which a quotient filter doubles.
+	quotientLoad = 0.75
+	// quotientMaxBits is the largest number of quotient bits.
+	quotientMaxBits = 48
+
+	// slot metadata bits, below the remainder
+	slotOccupied     = 1 // the run of this canonical slot is in the table
+	slotContinuation = 2 // the slot continues the run of the previous slot
+	slotShifted      = 4 // the slot holds a remainder outside its canonical slot
+	slotMetadata     = 3 // number of metadata bits
+)
+
+// ErrRemainderBits is returned by InitQuotient given remainderBits that are
+// not between 1 and 32.
+var ErrRemainderBits = errors.New("error: remainderBits must be between 1 and 32")
+
+// Quotient is a quotient filter (Bender et al.). The fingerprint of each data
+// is split into a quotient, which selects its canonical slot, and a remainder
+// stored in or near it, so the filter holds the fingerprints themselves and can
+// be resized or merged without the original data.
+//
+// Once more than 75% of the slots are used the filter doubles in place, moving
+// one bit of each fingerprint from the remainder to the quotient. Every
+// doubling keeps the false positive rate, about load/2^remainderBits, at the
+// same load, but with one fewer remainder bit, so it doubles for each doubling.
+// With a single remainder bit left the filter no longer grows, and Add returns
+// ErrFull once every slot is used.
+type Quotient struct {
+	quotient  uint          // bits of quotient, log2 of the number of slots
+	remainder uint          // bits of remainder
+	table     []uint64      // packed slots of metadata and remainder
+	count     uint64        // number of stored fingerprints
+	mutex     *sync.RWMutex // mutex for locking all operations
+}
+
+// InitQuotient initializes and returns a new quotient filter for elements, or
+// an error. remainderBits (1-32) determines the false positive rate. The slots
+// are sized to hold elements within a 75% load factor, rounded up to a power of
+// two.
+func InitQuotient(elements, remainderBits int) (*Quotient, error) {
+	_, err := elementCount(elements)
+	var bitsErr error
+	if remainderBits < 1 || remainderBits > 32 {
+		bitsErr = fmt.Errorf("%w, got %d", ErrRemainderBits, remainderBits)
+	}
+	if err := joinErrors(err, bitsErr); err != nil {
+		return nil, err
+	}
+	slots := uint64(math.Ceil(float64(elements) / quotientLoad))
+	quotient := uint(bits.Len64(slots - 1))
+	if quotient < 1 {
+		quotient = 1
+	}
+	if quotient > quotientMaxBits || quotient+uint(remainderBits) > 64 {
+		return nil, fmt.Errorf("%w: %d elements need too many quotient bits", ErrTooLarge, elements)
+	}
+	if words := ((uint64(1)<<quotient)*uint64(uint(remainderBits)+slotMetadata) + 63) / 64; words > maxLength/8 {
+		return nil, fmt.Errorf("%w: %d words", ErrTooLarge, words)
+	}
+	q := &Quotient{mutex: &sync.RWMutex{}}
+	q.init(quotient, uint(remainderBits))
+	return q, nil
+}
+
+// init empties the filter, with the sent numbers of quotient and remainder
+// bits.
+func (q *Quotient) init(quotient, remainder uint) {
+	q.quotient, q.remainder, q.count = quotient, remainder, 0
+	q.table = make([]uint64, (q.slots()*uint64(q.width())+63)/64)
+}
+
+// slots returns the number of slots.
+func (q *Quotient) slots() uint64 {
+	return 1 << q.quotient
+}
+
+// width returns the bits per slot.
+func (q *Quotient) width() uint {
+	return q.remainder + slotMetadata
+}
+
+// get returns slot i.
+func (q *Quotient) get(i uint64) uint64 {
+	bit := i * uint64(q.width())
+	word, shift := bit/64, bit%64
+	v := q.table[word] >> shift
+	if shift+uint64(q.width()) > 64 {
+		v |= q.table[word+1] << (64 - shift)
+	}
+	return v & (1<<q.width() - 1)
+}
+
+// set stores v in slot i.
+func (q *Quotient) set(i, v uint64) {
+	mask := uint64(1)<<q.width() - 1
+	bit := i * uint64(q.width())
+	word, shift := bit/64, bit%64
+	q.table[word] = q.table[word]&^(mask<<shift) | v<<shift
+	if shift+uint64(q.width()) > 64 {
+		q.table[word+1] = q.table[word+1]&^(mask>>(64-shift)) | v>>(64-shift)
+	}
+}
+
+// next returns the slot after i, wrapping around.
+func (q *Quotient) next(i uint64) uint64 {
+	return (i + 1) & (q.slots() - 1)
+}
+
+// prev returns the slot before i, wrapping around.
+func (q *Quotient) prev(i uint64) uint64 {
+	return (i - 1) & (q.slots() - 1)
+}
+
+// isEmpty returns if the slot v holds no remainder.
+func isEmpty(v uint64) bool {
+	return v&(slotOccupied|slotContinuation|slotShifted) == 0
+}
+
+// isRunStart returns if the slot v holds the first remainder of a run.
+func isRunStart(v uint64) bool {
+	return v&slotContinuation == 0 && v&(slotOccupied|slotShifted) != 0
+}
+
+// isClusterStart returns if the slot v holds the first remainder of a cluster,
+// in its canonical slot.
+func isClusterStart(v uint64) bool {
+	return v&(slotOccupied|slotContinuation|slotShifted) == slotOccupied
+}
+
+// splitHash returns the quotient and remainder of the fingerprint of data, the
+// leading bits of its hash h.
+func (q *Quotient) splitHash(h uint64) (uint64, uint64) {
+	f := h >> (64 - q.quotient - q.remainder)
+	return f >> q.remainder, f & (1<<q.remainder - 1)
+}
+
+// runStart returns the slot holding the first remainder of the run of the
+// quotient fq, or where it would be inserted.
+func (q *Quotient) runStart(fq uint64) uint64 {
+	// walk back to the start of the cluster
+	b := fq
+	for q.get(b)&slotShifted != 0 {
+		b = q.prev(b)
+	}
+	// walk forward, skipping one run for each occupied slot before fq
+	s := b
+	for b != fq {
+		for {
+			s = q.next(s)
+			if q.get(s)&slotContinuation == 0 {
+				break
+			}
+		}
+		for {
+			b = q.next(b)
+			if q.get(b)&slotOccupied != 0 {
+				break
+			}
+		}
+	}
+	return s
+}
+
+// shiftInto stores v in slot s, shifting the remainders from s up to the next
+// empty slot one slot forward. Occupied bits belong to the canonical slots, so
+// they stay in place.
+func (q *Quotient) shiftInto(s, v uint64) {
+	for {
+		prev := q.get(s)
+		empty := isEmpty(prev)
+		if !empty {
+			prev |= slotShifted
+			if prev&slotOccupied != 0 {
+				v |= slotOccupied
+				prev &^= slotOccupied
+			}
+		}
+		q.set(s, v)
+		if empty {
+			return
+		}
+		v = prev
+		s = q.next(s)
+	}
+}
+
+// insert stores the remainder fr in the run of the quotient fq, which must
+// have an empty slot. Runs are kept sorted by remainder.
+func (q *Quotient) insert(fq, fr uint64) {
+	v := fr << slotMetadata
+	canonical := q.get(fq)
+	q.count++
+	if isEmpty(canonical) {
+		q.set(fq, v|slotOccupied)
+		return
+	}
+	if canonical&slotOccupied == 0 {
+		q.set(fq, canonical|slotOccupied)
+	}
+	start := q.runStart(fq)
+	s := start
+	if canonical&slotOccupied != 0 {
+		// the run exists, so find the position of fr within it
+		for {
+			if q.get(s)>>slotMetadata >= fr {
+				break
+			}
+			s = q.next(s)
+			if q.get(s)&slotContinuation == 0 {
+				break
+			}
+		}
+		if s == start {
+			// fr becomes the start of the run, continued by the old start
+			q.set(start, q.get(start)|slotContinuation)
+		} else {
+			v |= slotContinuation
+		}
+	}
+	if s != fq {
+		v |= slotShifted
+	}
+	q.shiftInto(s, v)
+}
+
+// find returns the slot holding the remainder fr in the run of the quotient
+// fq, and if it was found.
+func (q *Quotient) find(fq, fr uint64) (uint64, bool) {
+	if q.get(fq)&slotOccupied == 0 {
+		return 0, false
+	}
+	s := q.runStart(fq)
+	for {
+		rem := q.get(s) >> slotMetadata
+		if rem == fr {
+			return s, true
+		}
+		if rem > fr {
+			return 0, false
+		}
+		s = q.next(s)
+		if q.get(s)&slotContinuation == 0 {
+			return 0, false
+		}
+	}
+}
+
+// remove deletes the remainder in slot s, in the run of the quotient fq.
+func (q *Quotient) remove(fq, s uint64) {
+	kill := q.get(s)
+	runStart := isRunStart(kill)
+	if runStart && q.get(q.next(s))&slotContinuation == 0 {
+		// deleting the only remainder of the run
+		q.set(fq, q.get(fq)&^slotOccupied)
+	}
+	q.shiftOut(s, fq)
+	if runStart {
+		v := q.get(s)
+		updated := v
+		if updated&slotContinuation != 0 {
+			// the new start of the run is no longer a continuation
+			updated &^= slotContinuation
+		}
+		if s == fq && isRunStart(updated) {
+			// the new start of the run is in its canonical slot
+			updated &^= slotShifted
+		}
+		if updated != v {
+			q.set(s, updated)
+		}
+	}
+	q.count--
+}
+
+// shiftOut removes slot s, in the run of the quotient fq, shifting the
+// remainders after it up to the end of the cluster one slot back. Remainders
+// shifted back into their canonical slot are no longer marked shifted.
+func (q *Quotient) shiftOut(s, fq uint64) {
+	orig := s
+	cur := q.get(s)
+	for sp := q.next(s); ; sp = q.next(sp) {
+		next := q.get(sp)
+		occupied := cur & slotOccupied
+		if isEmpty(next) || isClusterStart(next) || sp == orig {
+			q.set(s, 0)
+			return
+		}
+		updated := next
+		if isRunStart(next) {
+			// the next run belongs to the next occupied canonical slot
+			for {
+				fq = q.next(fq)
+				if q.get(fq)&slotOccupied != 0 {
+					break
+				}
+			}
+			if occupied != 0 && fq == s {
+				updated &^= slotShifted
+			}
+		}
+		q.set(s, updated&^slotOccupied|occupied)
+		s, cur = sp, next
+	}
+}
+
+// each calls fn with the quotient and remainder of every stored fingerprint.
+func (q *Quotient) each(fn func(fq, fr uint64)) {
+	// start at a cluster, where the quotient of each remainder is known
+	start := uint64(0)
+	for ; start < q.slots(); start++ {
+		if isClusterStart(q.get(start)) {
+			break
+		}
+	}
+	if start == q.slots() {
+		return
+	}
+	var fq uint64
+	for n := uint64(0); n < q.slots(); n++ {
+		s := (start + n) & (q.slots() - 1)
+		v := q.get(s)
+		switch {
+		case isEmpty(v):
+			continue
+		case isClusterStart(v):
+			fq = s
+		case v&slotContinuation == 0:
+			// a new run, of the next occupied canonical slot
+			for {
+				fq = q.next(fq)
+				if q.get(fq)&slotOccupied != 0 {
+					break
+				}
+			}
+		}
+		fn(fq, v>>slotMetadata)
+	}
+}
+
+// grow doubles the slots, moving one bit of every fingerprint from its
+// remainder to its quotient.
+func (q *Quotient) grow() {
+	old := *q
+	q.init(q.quotient+1, q.remainder-1)
+	old.each(func(fq, fr uint64) {
+		f := fq<<old.remainder | fr
+		q.insert(f>>q.remainder, f&(1<<q.remainder-1))
+	})
+}
+
+// full returns if no more fingerprints can be stored, doubling the filter
+// first if its load exceeds the threshold and it can still grow.
+func (q *Quotient) full() bool {
+	if float64(q.count+1) > quotientLoad*float64(q.slots()) && q.remainder > 1 &&
+		q.quotient < quotientMaxBits {
+		q.grow()
+	}
+	return q.count == q.slots()
+}
+
+// Add adds the data to the filter, doubling it first if it is too full. It
+// returns ErrFull, leaving the filter unchanged, if every slot is used and it
+// can no longer grow. Data added more than once is stored once per Add.
+func (q *Quotient) Add(data []byte) error {
+	h, _ := murmur128(data)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.full() {
+		return ErrFull
+	}
+	q.insert(q.splitHash(h))
+	return nil
+}
+
+// Test returns a bool if the data is in the filter. True indicates that the
+// data may be in the filter, while false indicates that the data is not in the
+// filter.
+func (q *Quotient) Test(data []byte) bool {
+	h, _ := murmur128(data)
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	_, found := q.find(q.splitHash(h))
+	return found
+}
+
+// Delete removes one copy of the data from the filter, returning false if it
+// is not in the filter. Only data that was added may be deleted: deleting a
+// false positive removes the fingerprint of other data.
+func (q *Quotient) Delete(data []byte) bool {
+	h, _ := murmur128(data)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	fq, fr := q.splitHash(h)
+	s, found := q.find(fq, fr)
+	if found {
+		q.remove(fq, s)
+	}
+	return found
+}
+
+// Reset clears the filter, keeping its current size.
+func (q *Quotient) Reset() {
+	q.mutex.Lock()
+	for i := range q.table {
+		q.table[i] = 0
+	}
+	q.count = 0
+	q.mutex.Unlock()
+}
+
+// LoadFactor returns the fraction of slots holding a fingerprint.
+func (q *Quotient) LoadFactor() float64 {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return float64(q.count) / float64(q.slots())
+}
+
+// Merge adds every fingerprint of the sent Quotient to its own, growing as
+// needed, so data added to either filter can be deleted from the result. The
+// filters must have the same numbers of quotient and remainder bits. It returns
+// ErrFull if the result cannot hold every fingerprint, leaving those merged
+// so far.
+func (q *Quotient) Merge(m *Quotient) error {
+	if q == nil || m == nil {
+		return ErrNilRing
+	}
+	if q == m {
+		return nil
+	}
+	// lock in address order, as in Ring.MergeContext
+	if uintptr(unsafe.Pointer(q)) < uintptr(unsafe.Pointer(m)) {
+		q.mutex.Lock()
+		m.mutex.RLock()
+	} else {
+		m.mutex.RLock()
+		q.mutex.Lock()
+	}
+	defer q.mutex.Unlock()
+	defer m.mutex.RUnlock()
+	if q.quotient != m.quotient {
+		return &IncompatibleError{"quotient bits", uint64(q.quotient), uint64(m.quotient)}
+	}
+	if q.remainder != m.remainder {
+		return &IncompatibleError{"remainder bits", uint64(q.remainder), uint64(m.remainder)}
+	}
+	var err error
+	m.each(func(fq, fr uint64) {
+		if err != nil {
+			return
+		}
+		f := fq<<m.remainder | fr
+		if q.full() {
+			err = ErrFull
+			return
+		}
+		// q may have grown, moving bits from remainder to quotient
+		q.insert(f>>q.remainder, f&(1<<q.remainder-1))
+	})
+	return err
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (q *Quotient) MarshalBinary() ([]byte, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	out := make([]byte, 11+len(q.table)*8)
+	out[0] = quotientVersion
+	out[1] = uint8(q.quotient)
+	out[2] = uint8(q.remainder)
+	binary.BigEndian.PutUint64(out[3:11], q.count)
+	for i, w := range q.table {
+		binary.BigEndian.PutUint64(out[11+i*8:], w)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (q *Quotient) UnmarshalBinary(data []byte) error {
+	if len(data) < 11 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != quotientVersion {
+		return versionError(data[0])
+	}
+	n := Quotient{
+		quotient:  uint(data[1]),
+		remainder: uint(data[2]),
+	}
+	if n.remainder < 1 || n.remainder > 32 {
+		return ErrRemainderBits
+	}
+	if n.quotient < 1 || n.quotient > quotientMaxBits || n.quotient+n.remainder > 64 ||
+		n.slots() > uint64(len(data))*8 {
+		return fmt.Errorf("%w: unexpected header", ErrCorrupt)
+	}
+	words := (n.slots()*uint64(n.width()) + 63) / 64
+	if err := checkData(uint64(len(data)), 11+words*8); err != nil {
+		return err
+	}
+	n.table = make([]uint64, words)
+	for i := range n.table {
+		n.table[i] = binary.BigEndian.Uint64(data[11+i*8:])
+	}
+	// the count must match the slots in use
+	count := binary.BigEndian.Uint64(data[3:11])
+	for i := uint64(0); i < n.slots(); i++ {
+		if !isEmpty(n.get(i)) {
+			n.count++
+		}
+	}
+	if n.count != count {
+		return &CorruptError{"count", count}
+	}
+
+	if q.mutex == nil {
+		q.mutex = &sync.RWMutex{}
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	n.mutex = q.mutex
+	*q = n
+	return nil
+}
@@ -0,0 +1,361 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// newQuotient returns an empty quotient filter with the sent bits.
+func newQuotient(quotient, remainder uint) *Quotient {
+	q := &Quotient{}
+	q.init(quotient, remainder)
+	return q
+}
+
+// checkQuotient compares the filter against oracle, the number of copies of
+// each fingerprint it should hold.
+func checkQuotient(t *testing.T, q *Quotient, oracle map[uint64]int) {
+	t.Helper()
+	var total uint64
+	quotients := map[uint64]bool{}
+	for f, n := range oracle {
+		total += uint64(n)
+		quotients[f>>q.remainder] = true
+	}
+	if q.count != total {
+		t.Fatalf("count %d, expected %d", q.count, total)
+	}
+	// every fingerprint is stored exactly as often as added
+	stored := map[uint64]int{}
+	q.each(func(fq, fr uint64) {
+		stored[fq<<q.remainder|fr]++
+	})
+	if len(stored) != len(oracle) {
+		t.Fatalf("stored %v, expected %v", stored, oracle)
+	}
+	for f, n := range oracle {
+		if stored[f] != n {
+			t.Fatalf("stored %v, expected %v", stored, oracle)
+		}
+	}
+	// one occupied bit per quotient with a run
+	occupied := 0
+	for i := uint64(0); i < q.slots(); i++ {
+		if q.get(i)&slotOccupied != 0 {
+			occupied++
+			if !quotients[i] {
+				t.Fatalf("slot %d occupied without a run", i)
+			}
+		}
+	}
+	if occupied != len(quotients) {
+		t.Fatalf("%d occupied slots, expected %d", occupied, len(quotients))
+	}
+	// every fingerprint of a small filter is found if and only if stored
+	if q.quotient+q.remainder <= 10 {
+		for f := uint64(0); f < 1<<(q.quotient+q.remainder); f++ {
+			if _, found := q.find(f>>q.remainder, f&(1<<q.remainder-1)); found != (oracle[f] > 0) {
+				t.Fatalf("fingerprint %d found %v, expected %d copies", f, found, oracle[f])
+			}
+		}
+	}
+}
+
+// removeQuotient deletes the fingerprint f from the filter and oracle.
+func removeQuotient(t *testing.T, q *Quotient, oracle map[uint64]int, f uint64) {
+	t.Helper()
+	fq, fr := f>>q.remainder, f&(1<<q.remainder-1)
+	s, found := q.find(fq, fr)
+	if !found {
+		t.Fatalf("fingerprint %d missing", f)
+	}
+	q.remove(fq, s)
+	if oracle[f]--; oracle[f] == 0 {
+		delete(oracle, f)
+	}
+}
+
+// TestQuotientExhaustive inserts every sequence of fingerprints that fills a
+// 4-slot filter, checking the filter after each insertion, and then deletes
+// them in insertion and reverse order, checking after each deletion.
+func TestQuotientExhaustive(t *testing.T) {
+	for _, remainder := range []uint{1, 2} {
+		q := newQuotient(2, remainder)
+		fingerprints := uint64(1) << (2 + remainder)
+		var seq [4]uint64
+		for n := uint64(0); n < fingerprints*fingerprints*fingerprints*fingerprints; n++ {
+			for i, v := 0, n; i < len(seq); i, v = i+1, v/fingerprints {
+				seq[i] = v % fingerprints
+			}
+			for _, reverse := range []bool{false, true} {
+				q.init(2, remainder)
+				oracle := map[uint64]int{}
+				for _, f := range seq {
+					q.insert(f>>remainder, f&(1<<remainder-1))
+					oracle[f]++
+					checkQuotient(t, q, oracle)
+				}
+				for i := range seq {
+					f := seq[i]
+					if reverse {
+						f = seq[len(seq)-1-i]
+					}
+					removeQuotient(t, q, oracle, f)
+					checkQuotient(t, q, oracle)
+				}
+			}
+		}
+	}
+}
+
+// TestQuotientDifferential runs random insertions and deletions against a map
+// oracle, on small filters where clusters wrap around the end of the table.
+func TestQuotientDifferential(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, bits := range [][2]uint{{3, 1}, {3, 3}, {4, 2}, {6, 4}, {8, 8}} {
+		q := newQuotient(bits[0], bits[1])
+		oracle := map[uint64]int{}
+		var added []uint64
+		for op := 0; op < 20000; op++ {
+			if len(added) < int(q.slots()) && rnd.Intn(3) != 0 {
+				// skew towards few quotients, for long runs and clusters
+				f := uint64(rnd.Intn(1 << (bits[0] + bits[1])))
+				if rnd.Intn(2) == 0 {
+					f &^= 1<<(bits[0]+bits[1]-1) | 1<<(bits[0]+bits[1]-2)
+				}
+				q.insert(f>>q.remainder, f&(1<<q.remainder-1))
+				oracle[f]++
+				added = append(added, f)
+			} else if len(added) > 0 {
+				i := rnd.Intn(len(added))
+				f := added[i]
+				added[i] = added[len(added)-1]
+				added = added[:len(added)-1]
+				removeQuotient(t, q, oracle, f)
+			}
+			checkQuotient(t, q, oracle)
+		}
+	}
+}
+
+// TestQuotientGrow ensures doubling keeps every fingerprint, with one bit moved
+// from the remainder to the quotient.
+func TestQuotientGrow(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	q := newQuotient(4, 6)
+	oracle := map[uint64]int{}
+	for i := 0; i < 12; i++ {
+		f := uint64(rnd.Intn(1 << 10))
+		q.insert(f>>q.remainder, f&(1<<q.remainder-1))
+		oracle[f]++
+	}
+	for q.remainder > 1 {
+		q.grow()
+		checkQuotient(t, q, oracle)
+	}
+}
+
+// TestQuotientData runs random Adds, Deletes and Tests of data against a map
+// oracle, through the public interface and across doublings.
+func TestQuotientData(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	q, _ := InitQuotient(16, 12)
+	oracle := map[string]int{}
+	var added []string
+	for op := 0; op < 50000; op++ {
+		switch {
+		case rnd.Intn(3) != 0:
+			key := fmt.Sprint(rnd.Intn(20000))
+			if err := q.Add([]byte(key)); err != nil {
+				t.Fatal(err)
+			}
+			oracle[key]++
+			added = append(added, key)
+		case len(added) > 0:
+			i := rnd.Intn(len(added))
+			key := added[i]
+			added[i] = added[len(added)-1]
+			added = added[:len(added)-1]
+			if !q.Delete([]byte(key)) {
+				t.Fatalf("delete of %s failed", key)
+			}
+			oracle[key]--
+		}
+		if op%1000 == 0 {
+			for key, n := range oracle {
+				if n > 0 && !q.Test([]byte(key)) {
+					t.Fatalf("data %s missing", key)
+				}
+			}
+		}
+	}
+	if q.count != uint64(len(added)) {
+		t.Fatalf("count %d, expected %d", q.count, len(added))
+	}
+}
+
+// TestQuotientFull ensures a filter that can no longer grow fills every slot
+// and then returns ErrFull.
+func TestQuotientFull(t *testing.T) {
+	q, _ := InitQuotient(1, 1)
+	buff := make([]byte, 4)
+	for i := 0; ; i++ {
+		intToByte(buff, i)
+		if err := q.Add(buff); errors.Is(err, ErrFull) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if load := q.LoadFactor(); load != 1 {
+		t.Fatalf("full at load factor %f", load)
+	}
+}
+
+// TestQuotientFalsePositive measures the false positive rate at the maximum
+// load against theory, load/2^remainderBits.
+func TestQuotientFalsePositive(t *testing.T) {
+	const remainder = 10
+	q, _ := InitQuotient(1<<16, remainder)
+	buff := make([]byte, 4)
+	added := int(quotientLoad * float64(q.slots()))
+	for i := 0; i < added; i++ {
+		intToByte(buff, i)
+		q.Add(buff)
+	}
+	if q.quotient != 17 {
+		t.Fatalf("grew to %d quotient bits", q.quotient)
+	}
+	fp := 0
+	const probes = 1000000
+	for i := added; i < added+probes; i++ {
+		intToByte(buff, i)
+		if q.Test(buff) {
+			fp++
+		}
+	}
+	theory := q.LoadFactor() / (1 << remainder)
+	if rate := float64(fp) / probes; rate > theory*1.2 || rate < theory*0.8 {
+		t.Fatalf("false positive rate %f, theory %f", rate, theory)
+	}
+}
+
+func TestQuotientMerge(t *testing.T) {
+	q, _ := InitQuotient(100, 16)
+	m, _ := InitQuotient(100, 16)
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		if i%2 == 0 {
+			q.Add(buff)
+		} else {
+			m.Add(buff)
+		}
+	}
+	m2, _ := InitQuotient(1000, 16)
+	if q.Merge(m) != nil || q.Merge(nil) == nil || q.Merge(m2) == nil {
+		t.Fatal("unexpected merge result")
+	}
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		if !q.Test(buff) {
+			t.Fatalf("data %d missing after merge", i)
+		}
+	}
+}
+
+func TestQuotientMarshal(t *testing.T) {
+	q, _ := InitQuotient(1000, 13)
+	buff := make([]byte, 4)
+	for i := 0; i < 5000; i++ {
+		intToByte(buff, i)
+		q.Add(buff)
+	}
+	data, _ := q.MarshalBinary()
+	var q2 Quotient
+	if err := q2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5000; i++ {
+		intToByte(buff, i)
+		if !q2.Test(buff) {
+			t.Fatalf("data %d missing after unmarshal", i)
+		}
+	}
+	if data2, _ := q2.MarshalBinary(); !bytes.Equal(data, data2) {
+		t.Fatal("marshaled data changed")
+	}
+	for _, n := range []int{0, 10, 11, len(data) - 1} {
+		if q2.UnmarshalBinary(data[:n]) == nil {
+			t.Fatalf("truncation to %d bytes not captured", n)
+		}
+	}
+	data[10]++
+	if q2.UnmarshalBinary(data) == nil {
+		t.Fatal("count not captured")
+	}
+}
+
+func TestQuotientParameters(t *testing.T) {
+	for _, p := range [][2]int{{0, 8}, {100, 0}, {100, 33}, {math.MaxInt, 32}} {
+		if _, err := InitQuotient(p[0], p[1]); err == nil {
+			t.Fatalf("parameters %v not captured", p)
+		}
+	}
+}
+
+// BenchmarkQuotientAdd tests adding elements to a Quotient filter sized for
+// them.
+func BenchmarkQuotientAdd(b *testing.B) {
+	q, _ := InitQuotient(b.N, 12)
+	buff := make([]byte, 4)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		q.Add(buff)
+	}
+}
+
+// BenchmarkQuotientLoad tests querying a Quotient filter at increasing load
+// factors, where clusters grow longer, reporting the false positive rate.
+func BenchmarkQuotientLoad(b *testing.B) {
+	for _, load := range []float64{0.25, 0.5, 0.75} {
+		b.Run(fmt.Sprintf("load=%.2f", load), func(b *testing.B) {
+			q := &Quotient{mutex: new(sync.RWMutex)}
+			q.init(20, 12)
+			buff := make([]byte, 4)
+			added := int(load * float64(q.slots()))
+			for i := 0; i < added; i++ {
+				intToByte(buff, i)
+				q.Add(buff)
+			}
+			fp := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				intToByte(buff, added+i)
+				if q.Test(buff) {
+					fp++
+				}
+			}
+			b.ReportMetric(float64(fp)/float64(b.N), "fp")
+		})
+	}
+}
+
+// intToByte converts an int (32-bit max) to byte array.
+func intToByte(b []byte, v int) {
+	_ = b[3] // memory safety
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
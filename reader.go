@@ -0,0 +1,132 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const (
+	// MaxTokenSize is the longest line accepted by AddFromReader, excluding
+	// its line ending.
+	MaxTokenSize = 64 * 1024
+
+	// readBatch is the number of lines hashed by AddFromReader before the
+	// write lock is taken to add them all.
+	readBatch = 256
+)
+
+// LineError describes an error reading the given line of the input of
+// AddFromReader. Lines are numbered from 1, counting empty lines.
+type LineError struct {
+	Line int64 // number of the line
+	Err  error // error reading the line, such as bufio.ErrTooLong
+}
+
+// Error implements the error interface.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("error: line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the error reading the line.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// AddFromReader adds each line of rd to the ring as AddFromReaderSize with a
+// limit of MaxTokenSize bytes per line.
+func (r *Ring) AddFromReader(rd io.Reader) (n int64, err error) {
+	return r.AddFromReaderSize(rd, MaxTokenSize)
+}
+
+// AddFromReaderSize adds each line of rd to the ring, without its trailing
+// "\n" or "\r\n", returning the number of lines added. Empty lines are
+// skipped. Lines are hashed outside the write lock, which is then taken once
+// per batch of lines rather than once per line.
+//
+// Reading stops at the first line longer than maxToken bytes, or the first
+// error of rd other than io.EOF, returned as a *LineError holding the number
+// of the line; every line before it has been added, and a final line without
+// a line ending is not added, as it may be incomplete. A zero Ring returns
+// ErrUninitialized.
+func (r *Ring) AddFromReaderSize(rd io.Reader, maxToken int) (n int64, err error) {
+	if r.set.Load() == nil {
+		return 0, ErrUninitialized
+	}
+	if maxToken < 0 {
+		maxToken = 0
+	}
+	scanner := bufio.NewScanner(rd)
+	initial := 4096
+	if maxToken < initial {
+		initial = maxToken + 1
+	}
+	// the buffer holds the line ending too, with which a line of maxToken
+	// bytes must fit
+	scanner.Buffer(make([]byte, 0, initial), maxToken+2)
+	// a final line without a line ending may have been cut short by an error,
+	// so it is only added once reading has ended cleanly
+	terminated := false
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		terminated = advance > 0 && data[advance-1] == '\n'
+		return advance, token, err
+	})
+	batch := make([]Digest, 0, readBatch)
+	var line int64
+	var last []byte
+	flush := func() {
+		r.addBatch(batch)
+		n += int64(len(batch))
+		batch = batch[:0]
+	}
+	for scanner.Scan() {
+		line++
+		token := scanner.Bytes()
+		if len(token) > maxToken {
+			flush()
+			return n, &LineError{line, bufio.ErrTooLong}
+		}
+		if !terminated {
+			last = token
+			break
+		}
+		if len(token) == 0 {
+			continue
+		}
+		batch = append(batch, NewDigest(token))
+		if len(batch) == readBatch {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		flush()
+		if last == nil {
+			line++
+		}
+		return n, &LineError{line, err}
+	}
+	if len(last) != 0 {
+		batch = append(batch, NewDigest(last))
+	}
+	flush()
+	return n, nil
+}
+
+// addBatch adds the data of each digest to the ring under a single write lock.
+func (r *Ring) addBatch(batch []Digest) {
+	if len(batch) == 0 {
+		return
+	}
+	r.lock()
+	defer r.unlock()
+	for i := range batch {
+		b := r.set.Load()
+		hash := batch[i].rounds(&b.params)
+		r.addRounds(b, &hash)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestAddFromReader ensures each line is added without its line ending, with
+// empty lines skipped, across batches.
+func TestAddFromReader(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		input.WriteString("key-" + strconv.Itoa(i))
+		if i%2 == 0 {
+			input.WriteString("\r\n")
+		} else {
+			input.WriteString("\n\n")
+		}
+	}
+	input.WriteString("last")
+	r, _ := ring.New(10000, 0.0001)
+	n, err := r.AddFromReader(strings.NewReader(input.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1001 {
+		t.Fatalf("%d lines added, expected 1001", n)
+	}
+	for i := 0; i < 1000; i++ {
+		if !r.Test([]byte("key-" + strconv.Itoa(i))) {
+			t.Fatalf("key-%d missing", i)
+		}
+	}
+	if !r.Test([]byte("last")) {
+		t.Fatal("final line without line ending missing")
+	}
+	if r.Test([]byte("key-0\r")) || r.Test([]byte("")) {
+		t.Fatal("line ending or empty line added")
+	}
+}
+
+// TestAddFromReaderTooLong ensures reading stops at the first line over the
+// limit, reporting its number, with the lines before it added.
+func TestAddFromReaderTooLong(t *testing.T) {
+	for _, long := range []int{11, 12, 100, 10000} {
+		input := "a\n\nb\r\n" + strings.Repeat("x", 10) + "\r\n" + strings.Repeat("y", long) + "\nc\n"
+		r, _ := ring.New(1000, 0.001)
+		n, err := r.AddFromReaderSize(strings.NewReader(input), 10)
+		var lineErr *ring.LineError
+		if !errors.As(err, &lineErr) || !errors.Is(err, bufio.ErrTooLong) || lineErr.Line != 5 {
+			t.Fatalf("%d bytes: expected line 5 to be too long, got %v", long, err)
+		}
+		if n != 3 || !r.Test([]byte("b")) || !r.Test([]byte(strings.Repeat("x", 10))) || r.Test([]byte("c")) {
+			t.Fatalf("%d bytes: %d lines added, expected the 3 lines before the error", long, n)
+		}
+	}
+}
+
+// TestAddFromReaderError ensures a read error mid-stream is reported with the
+// line being read, with the lines before it added.
+func TestAddFromReaderError(t *testing.T) {
+	errRead := errors.New("read failed")
+	input := io.MultiReader(strings.NewReader("a\nb\nc"), iotest.ErrReader(errRead))
+	r, _ := ring.New(1000, 0.001)
+	n, err := r.AddFromReader(iotest.OneByteReader(input))
+	var lineErr *ring.LineError
+	if !errors.As(err, &lineErr) || !errors.Is(err, errRead) || lineErr.Line != 3 {
+		t.Fatalf("expected an error at line 3, got %v", err)
+	}
+	if n != 2 || !r.Test([]byte("a")) || !r.Test([]byte("b")) {
+		t.Fatalf("%d lines added, expected 2", n)
+	}
+	var zero ring.Ring
+	if _, err := zero.AddFromReader(strings.NewReader("a")); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("zero ring: expected ErrUninitialized, got %v", err)
+	}
+}
+
+// BenchmarkAddFromReader loads a million lines.
+func BenchmarkAddFromReader(b *testing.B) {
+	var input bytes.Buffer
+	for i := 0; i < 1000000; i++ {
+		input.WriteString(strconv.Itoa(i))
+		input.WriteByte('\n')
+	}
+	r, _ := ring.New(1000000, 0.01)
+	b.SetBytes(int64(input.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.AddFromReader(bytes.NewReader(input.Bytes())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
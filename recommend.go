@@ -0,0 +1,115 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"math"
+	"time"
+)
+
+// Recommendation holds the parameters a ring should have been given for the
+// data it received, as returned by Recommend. It marshals to JSON for
+// dashboards.
+type Recommendation struct {
+	TargetFalsePositive float64 `json:"targetFalsePositive"` // rate the recommendation is sized for
+
+	EstimatedItems       uint64  `json:"estimatedItems"`       // distinct data estimated in the ring
+	Capacity             uint64  `json:"capacity"`             // data the ring holds within the target
+	CurrentFalsePositive float64 `json:"currentFalsePositive"` // theoretical rate of the ring now
+
+	Horizon                time.Duration `json:"horizon"`                // horizon of the projection, 0 without WithHorizon
+	ProjectedItems         uint64        `json:"projectedItems"`         // distinct data projected at the horizon
+	ProjectedFalsePositive float64       `json:"projectedFalsePositive"` // theoretical rate of the ring at the horizon
+
+	Elements    uint64 `json:"elements"`    // elements to pass to Init
+	Bits        uint64 `json:"bits"`        // bits Init chooses for them, m
+	HashRounds  uint64 `json:"hashRounds"`  // hash rounds Init chooses for them, k
+	MemoryBytes uint64 `json:"memoryBytes"` // bytes of the bit array of those bits
+}
+
+// RecommendOption configures Recommend.
+type RecommendOption func(*recommendOptions)
+
+// recommendOptions holds the configuration collected from RecommendOptions.
+type recommendOptions struct {
+	elapsed time.Duration // time over which the data was added
+	horizon time.Duration // time from now to project to
+}
+
+// WithHorizon projects the data of the ring horizon into the future, assuming
+// it was added at a steady rate over the elapsed time, such as the time since
+// the ring was created or last Reset. Recommend then sizes the ring for the
+// data projected at the horizon.
+func WithHorizon(elapsed, horizon time.Duration) RecommendOption {
+	return func(o *recommendOptions) {
+		o.elapsed = elapsed
+		o.horizon = horizon
+	}
+}
+
+// Recommend returns the parameters the ring should be given to hold the data it
+// received within the targetFP rate: the elements to pass to Init, sized for
+// the distinct data estimated from the fill of the ring, or projected at the
+// horizon of WithHorizon, and the bits, hash rounds and memory Init chooses for
+// them. Elements are rounded up to two significant digits, so the
+// recommendation changes only as the data grows, rather than with every
+// addition. It also reports the theoretical false positive rate of the ring,
+// now and at the horizon, and the data it holds within the target.
+//
+// The estimate of distinct data loses precision as the ring saturates, and
+// Elements is capped at 1<<62. A zero Ring, or a targetFP outside (0, 1),
+// returns a zero Recommendation; a recommendation beyond the limits of Init
+// leaves Bits, HashRounds and MemoryBytes 0.
+func (r *Ring) Recommend(targetFP float64, opts ...RecommendOption) Recommendation {
+	var o recommendOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if r.set.Load() == nil || checkFalsePositive(targetFP) != nil {
+		return Recommendation{}
+	}
+	s, p := r.Stats(), r.Parameters()
+	rec := Recommendation{
+		TargetFalsePositive: targetFP,
+		EstimatedItems:      capItems(s.EstimatedItems),
+		Capacity:            p.Capacity(targetFP),
+	}
+	rec.CurrentFalsePositive = p.FalsePositiveRate(rec.EstimatedItems)
+	projected := s.EstimatedItems
+	if o.elapsed > 0 && o.horizon > 0 {
+		rec.Horizon = o.horizon
+		projected *= float64(o.elapsed+o.horizon) / float64(o.elapsed)
+	}
+	rec.ProjectedItems = capItems(projected)
+	rec.ProjectedFalsePositive = p.FalsePositiveRate(rec.ProjectedItems)
+	rec.Elements = roundElements(rec.ProjectedItems)
+	if m, k, err := optimalParams(rec.Elements, targetFP, 0); err == nil {
+		rec.Bits, rec.HashRounds, rec.MemoryBytes = m, k, m/8+1
+	}
+	return rec
+}
+
+// capItems returns the number of items rounded, at most 1<<62.
+func capItems(items float64) uint64 {
+	if items >= 1<<62 {
+		return 1 << 62
+	}
+	return uint64(math.Round(items))
+}
+
+// roundElements rounds n up to two significant digits, and to at least 1.
+func roundElements(n uint64) uint64 {
+	if n < 100 {
+		if n == 0 {
+			return 1
+		}
+		return n
+	}
+	unit := uint64(1)
+	for n/unit >= 100 {
+		unit *= 10
+	}
+	return (n + unit - 1) / unit * unit
+}
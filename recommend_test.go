@@ -0,0 +1,84 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestRecommendOverfilled ensures a ring given three times its elements is
+// recommended about three times as many, beyond its target rate.
+func TestRecommendOverfilled(t *testing.T) {
+	r, _ := ring.Init(10000, 0.01)
+	for _, key := range ring.RandomKeys(30000, 1) {
+		r.Add(key)
+	}
+	rec := r.Recommend(0.01)
+	if rec.Elements < 27000 || rec.Elements > 33000 {
+		t.Fatalf("recommended %d elements, expected about 30000", rec.Elements)
+	}
+	if rec.ProjectedFalsePositive <= 0.01 || rec.CurrentFalsePositive <= 0.01 {
+		t.Fatalf("projected rate %g within the target", rec.ProjectedFalsePositive)
+	}
+	if rec.Capacity < 9000 || rec.Capacity > 11000 {
+		t.Fatalf("capacity %d, expected about 10000", rec.Capacity)
+	}
+	m, k, _ := ring.EstimateParameters(int(rec.Elements), 0.01)
+	if rec.Bits != m || rec.HashRounds != k || rec.MemoryBytes != m/8+1 {
+		t.Fatalf("recommended %d bits and %d rounds, expected %d and %d", rec.Bits, rec.HashRounds, m, k)
+	}
+	if rec.Elements%100 != 0 || rec.Elements < rec.ProjectedItems {
+		t.Fatalf("%d elements not rounded up from %d", rec.Elements, rec.ProjectedItems)
+	}
+}
+
+// TestRecommendHorizon ensures the projection extrapolates the rate of
+// additions.
+func TestRecommendHorizon(t *testing.T) {
+	r, _ := ring.Init(100000, 0.01)
+	for _, key := range ring.RandomKeys(10000, 2) {
+		r.Add(key)
+	}
+	now := r.Recommend(0.01)
+	if now.ProjectedItems != now.EstimatedItems || now.Horizon != 0 || now.ProjectedFalsePositive > 0.01 {
+		t.Fatalf("unexpected recommendation without a horizon %+v", now)
+	}
+	later := r.Recommend(0.01, ring.WithHorizon(time.Hour, 23*time.Hour))
+	if later.ProjectedItems < 23*now.EstimatedItems || later.ProjectedItems > 25*now.EstimatedItems {
+		t.Fatalf("projected %d items, expected about %d", later.ProjectedItems, 24*now.EstimatedItems)
+	}
+	if later.ProjectedFalsePositive <= 0.01 || later.Elements < later.ProjectedItems {
+		t.Fatalf("unexpected recommendation at the horizon %+v", later)
+	}
+}
+
+// TestRecommendJSON ensures recommendations marshal with stable names, and
+// invalid targets return a zero Recommendation.
+func TestRecommendJSON(t *testing.T) {
+	r, _ := ring.Init(1000, 0.01)
+	data, err := json.Marshal(r.Recommend(0.001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	for _, name := range []string{"targetFalsePositive", "estimatedItems", "capacity", "currentFalsePositive",
+		"horizon", "projectedItems", "projectedFalsePositive", "elements", "bits", "hashRounds", "memoryBytes"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("missing field %s in %s", name, data)
+		}
+	}
+	if fields["elements"] != float64(1) {
+		t.Fatalf("empty ring recommended %v elements", fields["elements"])
+	}
+	var zero ring.Ring
+	if zero.Recommend(0.01) != (ring.Recommendation{}) || r.Recommend(1) != (ring.Recommendation{}) {
+		t.Fatal("expected zero recommendations")
+	}
+}
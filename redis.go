@@ -0,0 +1,143 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"sync"
+)
+
+// redisChunk is the number of bytes of the bitmap written by each command of
+// ExportRedisCommands, well below the 512MB limit of Redis strings.
+const redisChunk = 1 << 20
+
+// defaultRedisKey is the key written by ExportRedisCommands without
+// WithRedisKey.
+const defaultRedisKey = "ring"
+
+// ErrRedisMode is returned by ExportRedisCommands given a ring whose bits are
+// not indexed by the formula Redis clients compute.
+var ErrRedisMode = errors.New("error: ring must be unseeded, without partitioned, blocked or one hash mode")
+
+// RedisOption configures ExportRedisCommands.
+type RedisOption func(*redisOptions)
+
+// redisOptions are the options of ExportRedisCommands.
+type redisOptions struct {
+	key string
+}
+
+// WithRedisKey sets the key of the bitmap written by ExportRedisCommands, by
+// default "ring".
+func WithRedisKey(key string) RedisOption {
+	return func(o *redisOptions) {
+		o.key = key
+	}
+}
+
+// ExportRedisCommands writes the bits of the ring as a Redis bitmap, so
+// services in other languages can test data with GETBIT alone, without the
+// RedisBloom module. The commands are written in RESP, as read by redis-cli
+// --pipe: a MULTI, a SET of the first megabyte of the bitmap, a SETRANGE of
+// each further megabyte holding set bits and of the last, and an EXEC, so
+// readers never see a partial bitmap. The bitmap is of a snapshot of the ring.
+//
+// Data is present in a ring of m bits and k hash rounds if, for each round i
+// from 0 to k-1, GETBIT of index(i) returns 1, where with the 128-bit x64
+// MurmurHash3 of seed 0, whose two 64-bit halves are read little endian:
+//
+//	h1, h2   = MurmurHash3_x64_128(data)
+//	h3, h4   = MurmurHash3_x64_128(data + "\x01")
+//	base     = [h1, h2, h1, h2][i % 4]
+//	step     = [h3, h4, h4, h3][i % 4]
+//	index(i) = (base + i*step) mod 2^64 mod m
+//
+// The parameters m and k are those of Parameters: Bits and HashRounds. Only
+// rings indexed by this formula are exported, those unseeded and without
+// partitioned, blocked or one hash mode; others return ErrRedisMode. A zero
+// Ring returns ErrUninitialized.
+func (r *Ring) ExportRedisCommands(w io.Writer, opts ...RedisOption) error {
+	o := redisOptions{key: defaultRedisKey}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	p, array, err := ringDecoders[data[0]](data, 0)
+	if err != nil {
+		return err
+	}
+	if p.seed != 0 || p.flags&^flagPowerOfTwo != 0 {
+		return fmt.Errorf("%w, got seed %d and flags %#x", ErrRedisMode, p.seed, p.flags)
+	}
+
+	// Redis numbers the bits of a byte from the most significant
+	for i, v := range array {
+		array[i] = bits.Reverse8(v)
+	}
+	bw := bufio.NewWriter(w)
+	writeRESP(bw, "MULTI")
+	for start := 0; start < len(array); start += redisChunk {
+		end := start + redisChunk
+		if end > len(array) {
+			end = len(array)
+		}
+		switch {
+		case start == 0:
+			writeRESP(bw, "SET", o.key, string(array[:end]))
+		case end == len(array) || !isZero(array[start:end]):
+			writeRESP(bw, "SETRANGE", o.key, strconv.Itoa(start), string(array[start:end]))
+		}
+	}
+	writeRESP(bw, "EXEC")
+	return bw.Flush()
+}
+
+// writeRESP writes the command as a RESP array of bulk strings. Errors are
+// reported by Flush.
+func writeRESP(w *bufio.Writer, args ...string) {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+}
+
+// ImportRedisBitmap returns a ring of m bits and k hash rounds holding the bits
+// of a Redis bitmap, as returned by GET of a key written by
+// ExportRedisCommands, or by services setting the bits of the formula it
+// documents with SETBIT. A bitmap written by SETBIT alone ends at the byte of
+// its highest bit set, so it may be shorter than the m/8+1 bytes of the ring.
+// A longer bitmap, or one setting bits beyond m, returns ErrCorrupt.
+func ImportRedisBitmap(data []byte, m, k uint64) (*Ring, error) {
+	p, err := newParams(m, k, 0)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) > m/8+1 {
+		return nil, fmt.Errorf("%w: bitmap of %d bytes, expected at most %d", ErrCorrupt, len(data), m/8+1)
+	}
+	array := make([]byte, len(data))
+	for i, v := range data {
+		array[i] = bits.Reverse8(v)
+	}
+	if uint64(len(data)) == m/8+1 && array[m/8]>>(m%8) != 0 {
+		return nil, fmt.Errorf("%w: bitmap sets bits beyond %d", ErrCorrupt, m)
+	}
+	r := &Ring{params: p, mutex: new(sync.RWMutex)}
+	b := r.emptyBitset(p)
+	b.copyFrom(array)
+	b.rebuildSummary()
+	r.set.Store(b)
+	return r, nil
+}
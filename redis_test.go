@@ -0,0 +1,164 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// replayRESP applies the SET and SETRANGE commands of a RESP stream as Redis
+// would, returning the strings of each key and the commands in order.
+func replayRESP(t *testing.T, stream []byte) (map[string][]byte, []string) {
+	t.Helper()
+	keys := make(map[string][]byte)
+	var commands []string
+	br := bufio.NewReader(bytes.NewReader(stream))
+	readLine := func(prefix byte) int {
+		line, err := br.ReadString('\n')
+		if err != nil || len(line) < 3 || line[0] != prefix || line[len(line)-2:] != "\r\n" {
+			t.Fatalf("malformed line %q: %v", line, err)
+		}
+		n, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return keys, commands
+		}
+		args := make([][]byte, readLine('*'))
+		for i := range args {
+			args[i] = make([]byte, readLine('$')+2)
+			if _, err := io.ReadFull(br, args[i]); err != nil {
+				t.Fatal(err)
+			}
+			args[i] = args[i][:len(args[i])-2]
+		}
+		commands = append(commands, string(args[0]))
+		switch string(args[0]) {
+		case "SET":
+			keys[string(args[1])] = append([]byte(nil), args[2]...)
+		case "SETRANGE":
+			offset, _ := strconv.Atoi(string(args[2]))
+			v := keys[string(args[1])]
+			if end := offset + len(args[3]); end > len(v) {
+				v = append(v, make([]byte, end-len(v))...)
+			}
+			copy(v[offset:], args[3])
+			keys[string(args[1])] = v
+		}
+	}
+}
+
+// TestRedisFixture ensures rings set the bits of a bitmap written with SETBIT
+// by an implementation of the documented formula in another language, held in
+// testdata with the elements 0 to 99 added with intToByte to 1000 bits and 7
+// hash rounds.
+func TestRedisFixture(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/redis-bitmap.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ring.ImportRedisBitmap(fixture, 1000, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, _ := ring.ImportRedisBitmap(nil, 1000, 7)
+	buff := make([]byte, 4)
+	for i := 0; i < 100; i++ {
+		intToByte(buff, i)
+		if !imported.Test(buff) {
+			t.Fatalf("element %d missing from the imported bitmap", i)
+		}
+		added.Add(buff)
+	}
+	if !added.Equal(imported) {
+		t.Fatal("ring differs from the bitmap of the formula")
+	}
+
+	var out bytes.Buffer
+	if err := added.ExportRedisCommands(&out, ring.WithRedisKey("filter")); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := replayRESP(t, out.Bytes())
+	// the export spans every byte of the ring, beyond the highest bit set
+	if want := append(fixture, 0); !bytes.Equal(keys["filter"], want) {
+		t.Fatalf("exported bitmap differs from the fixture:\n%x\n%x", keys["filter"], want)
+	}
+}
+
+// TestExportRedisCommands ensures the exported commands, as replayed by Redis,
+// hold a bitmap importing to the same ring, skipping ranges without set bits.
+func TestExportRedisCommands(t *testing.T) {
+	small, _ := ring.ImportRedisBitmap([]byte{0x80}, 8, 1)
+	var out bytes.Buffer
+	if err := small.ExportRedisCommands(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := "*1\r\n$5\r\nMULTI\r\n*3\r\n$3\r\nSET\r\n$4\r\nring\r\n$2\r\n\x80\x00\r\n*1\r\n$4\r\nEXEC\r\n"
+	if out.String() != want {
+		t.Fatalf("unexpected commands %q", out.String())
+	}
+
+	for _, opts := range [][]ring.Option{nil, {ring.WithPowerOfTwoSize()}} {
+		r, _ := ring.Init(3000000, 0.01, opts...)
+		r.Add([]byte("data"))
+		out.Reset()
+		if err := r.ExportRedisCommands(&out); err != nil {
+			t.Fatal(err)
+		}
+		keys, commands := replayRESP(t, out.Bytes())
+		if len(commands) < 4 || len(commands) > 3+int(r.Parameters().HashRounds)+1 ||
+			commands[0] != "MULTI" || commands[1] != "SET" || commands[len(commands)-1] != "EXEC" {
+			t.Fatalf("unexpected commands %v", commands)
+		}
+		p := r.Parameters()
+		if uint64(len(keys["ring"])) != p.Bits/8+1 {
+			t.Fatalf("bitmap of %d bytes for %d bits", len(keys["ring"]), p.Bits)
+		}
+		imported, err := ring.ImportRedisBitmap(keys["ring"], p.Bits, p.HashRounds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !imported.Test([]byte("data")) || opts == nil && !imported.Equal(r) {
+			t.Fatal("imported ring differs")
+		}
+	}
+}
+
+// TestRedisInvalid ensures rings of other modes are not exported, and bitmaps
+// not fitting the ring are not imported.
+func TestRedisInvalid(t *testing.T) {
+	for _, opts := range [][]ring.Option{{ring.WithSeed(1)}, {ring.WithPartitioned()}, {ring.WithBlocked()}} {
+		r, _ := ring.Init(1000, 0.01, opts...)
+		if err := r.ExportRedisCommands(io.Discard); !errors.Is(err, ring.ErrRedisMode) {
+			t.Fatalf("expected ErrRedisMode, got %v", err)
+		}
+	}
+	if err := new(ring.Ring).ExportRedisCommands(io.Discard); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+	// bit 1004 is within the last byte of a ring of 1000 bits, but beyond them
+	beyond := make([]byte, 126)
+	beyond[125] = 0x08
+	for _, data := range [][]byte{make([]byte, 127), beyond} {
+		if _, err := ring.ImportRedisBitmap(data, 1000, 7); !errors.Is(err, ring.ErrCorrupt) {
+			t.Fatalf("expected ErrCorrupt, got %v", err)
+		}
+	}
+	if _, err := ring.ImportRedisBitmap(nil, 1000, 0); !errors.Is(err, ring.ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
@@ -5,135 +5,906 @@
 package ring
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 var (
-	errElements      = errors.New("error: elements must be greater than 0")
-	errFalsePositive = errors.New("error: falsePositive must be greater than 0 and less than 1")
+	// ErrTooLarge is returned when the bit array of a ring would exceed the
+	// largest this platform can hold, or the limit set by WithMaxBytes, or as
+	// ErrMemoryLimit by WithMaxMemory.
+	ErrTooLarge = errors.New("error: ring is too large")
+	// ErrElements is returned by constructors given no elements.
+	ErrElements = errors.New("error: elements must be greater than 0")
+	// ErrFalsePositive is returned by constructors given a falsePositive rate
+	// that is not between 0 and 1.
+	ErrFalsePositive = errors.New("error: falsePositive must be greater than 0 and less than 1")
+	// ErrHashRounds is returned by constructors given a falsePositive rate
+	// needing more than 64 hash rounds.
+	ErrHashRounds = errors.New("error: too many hash rounds")
+
+	// ErrUninitialized is returned by the methods of a zero Ring that return
+	// errors. A zero Ring, such as a new(Ring) whose UnmarshalBinary has not
+	// succeeded, holds no data and cannot hold any: Test reports false, Add
+	// discards the data, for which TryAdd returns ErrUninitialized, and Reset
+	// and Release do nothing.
+	ErrUninitialized = errors.New("error: ring is not initialized")
+
+	// ErrTruncated is returned by UnmarshalBinary methods given data shorter
+	// than its header describes.
+	ErrTruncated = errors.New("error: data is truncated")
+	// ErrBadVersion is returned by UnmarshalBinary methods given data of
+	// another type, or of an unknown version as ErrUnknownVersion.
+	ErrBadVersion = errors.New("error: unexpected version")
+	// ErrUnknownVersion is returned by UnmarshalBinary methods given data of a
+	// version no filter of this release writes, such as one of a later
+	// release. It matches ErrBadVersion too.
+	ErrUnknownVersion = fmt.Errorf("%w, unknown to this release", ErrBadVersion)
+	// ErrCorrupt is returned by UnmarshalBinary methods given data with a
+	// header that is invalid or inconsistent with the rest of the data.
+	ErrCorrupt = errors.New("error: data is corrupt")
 )
 
-// Ring contains the information for a ring data store.
+// maxHash is the largest number of hash rounds of a ring, reached at a false
+// positive rate of about 5e-20. Each round costs a probe of Add and Test, so
+// beyond it the ring is impractically slow rather than more accurate.
+const maxHash = 64
+
+const (
+	// minSize is the smallest number of bits chosen by Init. Rings of a few
+	// elements would otherwise get a handful of bits, too coarse to reliably
+	// hold their rate, while saving only a few bytes.
+	minSize = 64
+	// minDecodedSize is the smallest number of bits accepted by
+	// UnmarshalBinary, which also reads rings of fewer than minSize bits from
+	// earlier releases.
+	minDecodedSize = 8
+)
+
+// maxLength is the largest bit array of a ring, in bytes. The marshaled ring,
+// with its header, must fit in a slice, which limits 32-bit platforms to 2GB,
+// while the 64PB limit of 64-bit platforms leaves room to round the number of
+// bits up without overflowing.
+var maxLength = uint64(math.MaxInt - 26)
+
+func init() {
+	if maxLength > 1<<56 {
+		maxLength = 1 << 56
+	}
+}
+
+// checkLength returns ErrTooLarge if the bit array of a ring of size bits
+// exceeds limit bytes.
+func checkLength(size, limit uint64) error {
+	if size/8+1 > limit {
+		return fmt.Errorf("%w: %d bits exceed %d bytes", ErrTooLarge, size, limit)
+	}
+	return nil
+}
+
+// Ring contains the information for a ring data store. Rings are created by
+// Init or UnmarshalBinary; the zero value is an empty ring that cannot hold
+// data, as described by ErrUninitialized.
 type Ring struct {
-	size  uint64        // number of bits (bit array is size/8+1)
-	bits  []uint8       // main bit array
-	hash  uint64        // number of hash rounds
-	mutex *sync.RWMutex // mutex for locking Add, Test, and Reset operations
+	params                              // size, hash rounds and mode, guarded by mutex
+	offHeap    bool                     // allocate the bit array off the Go heap
+	adaptive   bool                     // spin before blocking on the write lock
+	noLock     bool                     // Add, AddHash and Reset skip the write lock
+	fastReset  bool                     // stamp blocks with epochs for O(1) Reset
+	maxMemory  uint64                   // limit of WithMaxMemory in bytes, 0 for the default
+	target     float64                  // falsePositive rate the ring was sized for, or 0
+	normalize  Normalization            // normalization of AddString and TestString
+	counters   atomic.Pointer[counters] // operation counts, nil until enabled
+	saturation *saturation              // active bits of WithSaturationWarning, or nil
+	log        *eventLog                // events of WithLogger, or nil
+	updates    *updateLog               // additions of WithUpdateLog, or nil
+	sampler    *sampler                 // samples of WithSampling, or nil
+	truth      *groundTruth             // sampled data of WithGroundTruth, or nil
+	version    atomic.Uint64            // number of writes, advanced under the write lock
+	digests    atomic.Pointer[digests]  // chunk digests of ChunkDigests, nil until requested
+	set        atomic.Pointer[bitset]   // main bit array, read by Test without locking
+	mutex      *sync.RWMutex            // mutex for serializing writers
 }
 
-// Init initializes and returns a new ring, or an error. Given a number of
+// New initializes and returns a new ring, or an error. Given a number of
 // elements, it accurately states if data is not added. Within a falsePositive
-// rate, it will indicate if the data has been added.
-func Init(elements int, falsePositive float64) (*Ring, error) {
-	if elements <= 0 {
-		return nil, errElements
+// rate, it will indicate if the data has been added. Options may be provided to
+// alter the construction of the ring, and are validated together with the
+// arguments: every problem is reported at once with the offending values, in a
+// single error matching each of ErrElements, ErrFalsePositive and ErrOptions
+// that applies. Rates below about 5e-20, needing more than 64 hash rounds, are
+// rejected with ErrHashRounds, as are rings larger than ErrTooLarge allows.
+// Rings have at least 64 bits, so a ring of a few elements holds well within
+// its rate.
+func New(elements int, falsePositive float64, opts ...Option) (*Ring, error) {
+	n, err := elementCount(elements)
+	return initUint(n, err, falsePositive, opts)
+}
+
+// Init is New, under the name of earlier releases.
+func Init(elements int, falsePositive float64, opts ...Option) (*Ring, error) {
+	return New(elements, falsePositive, opts...)
+}
+
+// InitUint is like New, for a number of elements beyond the range of int. The
+// bit array is still limited as described by ErrTooLarge, to about 1.8 billion
+// elements at a 1% falsePositive rate on 32-bit platforms; the limit of 64-bit
+// platforms is far beyond any memory.
+func InitUint(elements uint64, falsePositive float64, opts ...Option) (*Ring, error) {
+	var err error
+	if elements == 0 {
+		err = fmt.Errorf("%w, got 0", ErrElements)
+	}
+	return initUint(elements, err, falsePositive, opts)
+}
+
+// initUint is InitUint, given the error of the elements of New. Every problem
+// of the arguments is reported at once, before any sizing.
+func initUint(elements uint64, elementsErr error, falsePositive float64, opts []Option) (*Ring, error) {
+	o := options{maxBytes: maxLength}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := joinErrors(elementsErr, checkFalsePositive(falsePositive), o.validate()); err != nil {
+		return nil, err
 	}
-	if falsePositive <= 0 || falsePositive >= 1 {
-		return nil, errFalsePositive
+	if o.maxBytes > maxLength {
+		o.maxBytes = maxLength
 	}
 
-	r := Ring{}
-	// number of bits
-	m := (-1 * float64(elements) * math.Log(falsePositive)) / math.Pow(math.Log(2), 2)
-	// number of hash operations
-	k := (m / float64(elements)) * math.Log(2)
+	size, hash, err := optimalParams(elements, falsePositive, uint64(o.rounds))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Ring{}
+	span := size
+	if o.partitioned {
+		// each hash round gets an equal share of the bits, enough for the
+		// slightly higher rate of partitions
+		span = (size + hash - 1) / hash
+		if s := partitionSize(elements, falsePositive, hash); s > span {
+			span = s
+		}
+		r.flags |= flagPartitioned
+	}
+	if o.oneHash {
+		span = segmentSize(elements, falsePositive, hash)
+		r.flags |= flagOneHash
+	}
+	if o.blocked {
+		span = blockedSize(elements, falsePositive, hash, size)
+		r.flags |= flagBlocked
+	}
+	if err := checkLength(span, maxLength); err != nil {
+		// rounding the span below cannot overflow from within the limit
+		return nil, err
+	}
+	if o.powerOfTwo {
+		// k is kept, as the extra bits only lower the false positive rate
+		span = uint64(math.Pow(2, math.Ceil(math.Log2(float64(span)))))
+		r.flags |= flagPowerOfTwo
+		r.mask = span - 1
+		if o.blocked {
+			// the mask reduces a round to a block
+			r.mask = span/summaryBlock - 1
+		}
+	}
+	size = span
+	if o.partitioned {
+		r.part = span
+		size = span * hash
+	}
+	if err := checkLength(size, o.maxBytes); err != nil {
+		return nil, err
+	}
+	r.maxMemory = o.maxMemory
+	if err := checkMemory(size, r.memoryLimit()); err != nil {
+		return nil, err
+	}
 
 	r.mutex = &sync.RWMutex{}
-	r.size = uint64(math.Ceil(m))
-	r.hash = uint64(math.Ceil(k))
-	r.bits = make([]uint8, r.size/8+1)
-	return &r, nil
+	r.size = size
+	r.hash = hash
+	r.seed = o.seed
+	r.target = falsePositive
+	r.offHeap = o.offHeap
+	r.adaptive = o.adaptive
+	r.noLock = o.noLock
+	r.fastReset = o.fastReset
+	r.normalize = o.normalize
+	r.saturation = newSaturation(o.warnings)
+	r.log = newEventLog(o.name, o.logger)
+	r.updates = newUpdateLog(o.updates)
+	r.truth = newGroundTruth(&o)
+	r.set.Store(r.emptyBitset(r.params))
+	r.startSampling(&o)
+	return r, nil
+}
+
+// optimalParams returns the number of bits and hash rounds for a filter of
+// elements within the falsePositive rate, or an error. The number of bits is
+// checked against maxLength, and the number of hash rounds against maxHash,
+// before either is converted from floating point, so neither is truncated.
+// The bits and rounds are those of requiredBits, the source of RequiredBits,
+// raised to minSize bits. A rate that cannot be met within maxHash rounds is
+// rejected rather than silently exceeded. A non-zero rounds, validated by the
+// caller, is used rather than the optimal number.
+//
+// It is the source of EstimateParameters, so the parameters it reports are
+// those New chooses.
+func optimalParams(elements uint64, falsePositive float64, rounds uint64) (size, hash uint64, err error) {
+	var elementsErr error
+	if elements == 0 {
+		elementsErr = fmt.Errorf("%w, got 0", ErrElements)
+	}
+	if err := joinErrors(elementsErr, checkFalsePositive(falsePositive)); err != nil {
+		return 0, 0, err
+	}
+	m, k := optimalRounds(elements, falsePositive)
+	if rounds == 0 && math.Ceil(k) > maxHash {
+		return 0, 0, fmt.Errorf("%w: falsePositive %g needs %.0f rounds of %.0f bits, limit %d",
+			ErrHashRounds, falsePositive, math.Ceil(k), m, maxHash)
+	}
+	if m/8+1 > float64(maxLength) {
+		return 0, 0, fmt.Errorf("%w: %.0f bits with %.0f hash rounds exceed %d bytes",
+			ErrTooLarge, m, math.Ceil(k), maxLength)
+	}
+	size, hash = requiredBits(elements, falsePositive, rounds)
+	// a few elements need only a few bits, which are raised to minSize; the
+	// extra bits only lower the rate, and every round still has a bit of its
+	// own
+	if size < minSize {
+		size = minSize
+	}
+	if hash > size {
+		hash = size
+	}
+	if size/8+1 > maxLength {
+		return 0, 0, fmt.Errorf("%w: %d bits with %d hash rounds exceed %d bytes",
+			ErrTooLarge, size, hash, maxLength)
+	}
+	return size, hash, nil
 }
 
-// Add adds the data to the ring.
+// elementCount returns elements as an element count, or ErrElements with the
+// value if it is not positive.
+func elementCount(elements int) (uint64, error) {
+	if elements <= 0 {
+		return 0, fmt.Errorf("%w, got %d", ErrElements, elements)
+	}
+	return uint64(elements), nil
+}
+
+// checkFalsePositive returns ErrFalsePositive with the value if falsePositive
+// is not a rate between 0 and 1, exclusive.
+func checkFalsePositive(falsePositive float64) error {
+	if !(falsePositive > 0 && falsePositive < 1) {
+		return fmt.Errorf("%w, got %g", ErrFalsePositive, falsePositive)
+	}
+	return nil
+}
+
+// checkArgs returns elements as an element count, or the errors of both
+// elements and falsePositive.
+func checkArgs(elements int, falsePositive float64) (uint64, error) {
+	n, err := elementCount(elements)
+	return n, joinErrors(err, checkFalsePositive(falsePositive))
+}
+
+// partitionSize returns the number of bits of each of the hash partitions of
+// a ring of elements, such that the false positive rate of the partitioned ring
+// is within falsePositive.
+func partitionSize(elements uint64, falsePositive float64, hash uint64) uint64 {
+	// solve (1-(1-1/s)^n)^k = p for s
+	n, k := float64(elements), float64(hash)
+	s := -1 / math.Expm1(math.Log1p(-math.Pow(falsePositive, 1/k))/n)
+	if s >= 1<<62 {
+		// beyond maxLength, so rejected by Init
+		return 1 << 62
+	}
+	return uint64(math.Ceil(s))
+}
+
+// segmentSize returns the number of bits, in whole 64-bit words, of each of the
+// hash partitions of a ring of elements, such that the false positive rate of
+// the partitioned ring is within falsePositive.
+func segmentSize(elements uint64, falsePositive float64, hash uint64) uint64 {
+	return (partitionSize(elements, falsePositive, hash) + 63) &^ 63
+}
+
+// blockedSize returns the number of bits of a blocked ring of elements within
+// the falsePositive rate with hash rounds per data, a whole number of blocks.
+// Blocked rings need more bits than the size bits of other rings, and their
+// rate falls as blocks are added, so the least number of blocks is found by
+// doubling from size, then bisecting.
+func blockedSize(elements uint64, falsePositive float64, hash, size uint64) uint64 {
+	rates := newBlockRates(hash)
+	within := func(blocks uint64) bool {
+		return blockedRate(float64(elements), float64(blocks), rates) <= falsePositive
+	}
+	lo, hi := uint64(0), (size+summaryBlock-1)/summaryBlock
+	for !within(hi) {
+		if hi >= 1<<52 {
+			// beyond maxLength, so rejected by Init
+			return 1 << 62
+		}
+		lo, hi = hi, hi*2
+	}
+	for lo+1 < hi {
+		if mid := lo + (hi-lo)/2; within(mid) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi * summaryBlock
+}
+
+// Add adds the data to the ring. Data added to a zero Ring is discarded; use
+// TryAdd to observe ErrUninitialized instead.
 func (r *Ring) Add(data []byte) {
+	b := r.set.Load()
+	if b == nil {
+		return
+	}
 	// generate hashes
-	hash := generateMultiHash(data)
-	r.mutex.Lock()
-	for i := uint64(0); i < r.hash; i++ {
-		index := getRound(hash, i) % r.size
-		r.bits[index/8] |= (1 << (index % 8))
+	p := b.params
+	hash := p.rounds(data)
+	r.lock()
+	b = r.set.Load()
+	if b.params != p {
+		// replaced by UnmarshalBinary or Reset in the meantime, with other
+		// flags or another seed
+		hash = b.rounds(data)
+	}
+	r.addRounds(b, &hash)
+	r.unlock()
+}
+
+// AddHash adds the data of the digest to the ring, like Add without hashing the
+// data again.
+func (r *Ring) AddHash(d Digest) {
+	if r.set.Load() == nil {
+		return
+	}
+	r.lock()
+	b := r.set.Load()
+	hash := d.rounds(&b.params)
+	r.addRounds(b, &hash)
+	r.unlock()
+}
+
+// TryAdd adds the data to the ring like Add, but returns ErrUninitialized for
+// a zero Ring rather than discarding the data.
+func (r *Ring) TryAdd(data []byte) error {
+	if r.set.Load() == nil {
+		return ErrUninitialized
+	}
+	r.Add(data)
+	return nil
+}
+
+// addRounds activates the bits of the hash rounds in b. It must be called with
+// the write lock held.
+func (r *Ring) addRounds(b *bitset, hash *rounds) {
+	r.countAdds(1)
+	if r.truth != nil {
+		// recorded before the bits, so a test never finds them unrecorded
+		r.truth.add(hash)
+	}
+	if r.updates != nil {
+		r.updates.append(hash)
+	}
+	if d := r.digests.Load(); d != nil {
+		for i := uint64(0); i < b.hash; i++ {
+			d.mark(b.index(hash, i))
+		}
+	}
+	if s := r.saturation; s != nil {
+		for i := uint64(0); i < b.hash; i++ {
+			b = r.setCounted(b, b.index(hash, i), s)
+		}
+	} else if bits := b.single(); bits != nil && b.stamps == nil {
+		// hot path for rings held in a single allocated chunk
+		summary := b.summary
+		for i := uint64(0); i < b.hash; i++ {
+			index := b.index(hash, i)
+			atomicOr(bits, index>>3, 1<<(index&7))
+			atomicOr(summary, index>>12, 1<<((index>>9)&7))
+		}
+	} else if b.sorted() {
+		var buf [maxSorted]uint64
+		for _, index := range b.sortedProbes(hash, &buf) {
+			b = r.setIndex(b, index)
+		}
+	} else {
+		for i := uint64(0); i < b.hash; i++ {
+			b = r.setIndex(b, b.index(hash, i))
+		}
 	}
-	r.mutex.Unlock()
 }
 
-// Reset clears the ring.
+// Reset clears the ring. The cleared bit array is built before the write lock
+// is taken and then swapped in as a whole, so a concurrent Test observes either
+// the complete old state or the empty one, never a partially cleared ring.
 func (r *Ring) Reset() {
-	r.mutex.Lock()
-	r.bits = make([]uint8, r.size/8+1)
-	r.mutex.Unlock()
+	if r.set.Load() == nil {
+		return
+	}
+	r.countReset()
+	if r.fastReset {
+		r.lock()
+		advanced := r.set.Load().advance()
+		if advanced {
+			r.clearSetBits()
+			r.dropDigests()
+			r.truncateUpdates()
+			r.clearTruth()
+		}
+		r.unlock()
+		if advanced {
+			if r.log != nil {
+				r.logEvent(levelInfo, "ring reset")
+			}
+			return
+		}
+	}
+	b := r.emptyBitset(r.set.Load().params)
+	r.lock()
+	old := r.set.Load()
+	if b.params != old.params {
+		// replaced by UnmarshalBinary in the meantime
+		b = r.emptyBitset(old.params)
+	}
+	old.clearInto(b)
+	r.set.Store(b)
+	r.clearSetBits()
+	r.dropDigests()
+	r.truncateUpdates()
+	r.clearTruth()
+	r.unlock()
+	if r.log != nil && r.fastReset {
+		r.logEvent(levelInfo, "ring reset", "epochs_exhausted", true)
+	} else if r.log != nil {
+		r.logEvent(levelInfo, "ring reset")
+	}
 }
 
 // Test returns a bool if the data is in the ring. True indicates that the data
 // may be in the ring, while false indicates that the data is not in the ring.
+//
+// Test takes no lock: it reads the published bit array atomically, so it never
+// waits behind Add, Merge, Reset or UnmarshalBinary. A concurrent Add may be
+// observed partially, which can only make Test report false for data whose Add
+// has not returned. Rings using WithOffHeap still take a read lock, as Release
+// unmaps memory that lock-free readers could otherwise be reading.
 func (r *Ring) Test(data []byte) bool {
+	if r.offHeap {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+	}
+	b := r.set.Load()
+	if b == nil {
+		return false
+	}
 	// generate hashes
-	hash := generateMultiHash(data)
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-	for i := uint64(0); i < uint64(r.hash); i++ {
-		index := getRound(hash, i) % r.size
-		// check if index%8-th bit is not active
-		if (r.bits[index/8] & (1 << (index % 8))) == 0 {
+	hash := b.rounds(data)
+	return r.countTest(&hash, b.test(&hash))
+}
+
+// TestHash returns a bool if the data of the digest is in the ring, like Test
+// without hashing the data again.
+func (r *Ring) TestHash(d Digest) bool {
+	if r.offHeap {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+	}
+	b := r.set.Load()
+	if b == nil {
+		return false
+	}
+	hash := d.rounds(&b.params)
+	return r.countTest(&hash, b.test(&hash))
+}
+
+// test returns if every bit of the hash rounds is active.
+func (b *bitset) test(hash *rounds) bool {
+	// reject with a single probe if the first block is entirely empty
+	if !b.testSummary(b.index(hash, 0)) {
+		return false
+	}
+	if bits := b.single(); bits != nil && b.stamps == nil {
+		// hot path for rings held in a single allocated chunk
+		for i := uint64(0); i < b.hash; i++ {
+			index := b.index(hash, i)
+			// check if index-th bit is not active
+			if atomicLoad(bits, index>>3)&(1<<(index&7)) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if b.sorted() {
+		// most misses are rejected by the first probe, which is issued before
+		// sorting the rest
+		if !b.get(b.index(hash, 0)) {
+			return false
+		}
+		var buf [maxSorted]uint64
+		for _, index := range b.sortedProbes(hash, &buf) {
+			if !b.get(index) {
+				return false
+			}
+		}
+		return true
+	}
+	for i := uint64(0); i < b.hash; i++ {
+		// check if index-th bit is not active
+		if !b.get(b.index(hash, i)) {
 			return false
 		}
 	}
 	return true
 }
 
-// Merges the sent Ring into itself.
-func (r *Ring) Merge(m *Ring) error {
-	if r.size != m.size || r.hash != m.hash {
-		return errors.New("rings must have the same m/k parameters")
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The bits
+// are copied under the read lock, so the marshaled ring holds every element
+// whose Add returned before the call, and none partially.
+func (r *Ring) MarshalBinary() ([]byte, error) {
+	if r.set.Load() == nil {
+		return nil, ErrUninitialized
 	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.countMarshaled(r.set.Load().marshal()), nil
+}
 
-	r.mutex.Lock()
-	m.mutex.RLock()
-	for i := 0; i < len(m.bits); i++ {
-		r.bits[i] |= m.bits[i]
+// marshal returns the binary form of the bitset. The header is written from
+// the parameters of the bitset itself, so it always describes the bits that
+// follow. Writers must be excluded.
+func (b *bitset) marshal() []byte {
+	var buf [maxHeader]byte
+	header := b.header(&buf)
+	out := make([]byte, uint64(len(header))+b.length)
+	copy(out, header)
+	b.copyTo(out[len(header):])
+	return out
+}
+
+// maxHeader is the length of the longest header of a marshaled ring.
+const maxHeader = 26
+
+// header returns the header of the binary form of the bitset, in buf.
+func (b *bitset) header(buf *[maxHeader]byte) []byte {
+	out := buf[:]
+	if b.seed != 0 {
+		// only seeded rings need version 3, which earlier releases reject
+		out[0] = 3
+		out[1] = b.flags
+		binary.BigEndian.PutUint64(out[2:10], b.seed)
+		binary.BigEndian.PutUint64(out[10:18], b.size)
+		binary.BigEndian.PutUint64(out[18:26], b.hash)
+		return out[:26]
+	}
+	if b.flags == 0 {
+		// rings without mode flags remain readable by version 1 decoders
+		out[0] = 1
+		binary.BigEndian.PutUint64(out[1:9], b.size)
+		binary.BigEndian.PutUint64(out[9:17], b.hash)
+		return out[:17]
+	}
+	out[0] = 2
+	out[1] = b.flags
+	binary.BigEndian.PutUint64(out[2:10], b.size)
+	binary.BigEndian.PutUint64(out[10:18], b.hash)
+	return out[:18]
+}
+
+// newParams returns the parameters of a ring of size bits and hash rounds in
+// the mode of flags, or an error if they are inconsistent. A ring without bits
+// cannot index them, and a ring without hash rounds would report every data as
+// present, so neither is accepted, nor more than maxHash rounds.
+func newParams(size, hash uint64, flags uint8) (params, error) {
+	// every field is checked, so each problem of the header is reported at once
+	var problems []error
+	if size < minDecodedSize {
+		problems = append(problems, fmt.Errorf("%w, expected at least %d", &CorruptError{"size", size}, minDecodedSize))
+	} else if err := checkLength(size, maxLength); err != nil {
+		problems = append(problems, err)
+	}
+	if hash == 0 || hash > maxHash {
+		problems = append(problems, fmt.Errorf("%w, expected 1 to %d", &CorruptError{"hash", hash}, maxHash))
+	}
+	if flags&^(flagPowerOfTwo|flagPartitioned|flagOneHash|flagBlocked) != 0 ||
+		flags&flagOneHash != 0 && flags&flagPartitioned == 0 ||
+		flags&flagBlocked != 0 && flags&flagPartitioned != 0 {
+		problems = append(problems, fmt.Errorf("%w, expected a valid combination of modes", &CorruptError{"flags", uint64(flags)}))
+	}
+	if err := joinErrors(problems...); err != nil {
+		return params{}, err
+	}
+	span := size
+	var mask, part uint64
+	if flags&flagPartitioned != 0 {
+		if size%hash != 0 {
+			return params{}, fmt.Errorf("%w, expected a multiple of %d hash rounds", &CorruptError{"size", size}, hash)
+		}
+		span = size / hash
+		part = span
+	}
+	if flags&flagBlocked != 0 {
+		if size%summaryBlock != 0 {
+			return params{}, fmt.Errorf("%w, expected a multiple of %d", &CorruptError{"size", size}, summaryBlock)
+		}
+		// the mask reduces a round to a block
+		span = size / summaryBlock
+	}
+	if flags&flagPowerOfTwo != 0 {
+		if span&(span-1) != 0 {
+			return params{}, fmt.Errorf("%w, expected a power of two", &CorruptError{"size", size})
+		}
+		mask = span - 1
+	}
+	return params{size: size, hash: hash, mask: mask, part: part, flags: flags}, nil
+}
+
+// CorruptError describes a field of marshaled data that is out of range, or
+// inconsistent with the other fields. It unwraps to ErrCorrupt.
+type CorruptError struct {
+	Field string // name of the field, such as "size" or "hash"
+	Value uint64 // decoded value of the field
+}
+
+// Error implements the error interface.
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("%v: unexpected %s: %d", ErrCorrupt, e.Field, e.Value)
+}
+
+// Unwrap returns ErrCorrupt.
+func (e *CorruptError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// joinErrors returns an error listing the non-nil errors of errs, or nil if
+// there are none, like errors.Join of later releases of Go. A single error is
+// returned as is.
+func joinErrors(errs ...error) error {
+	var list errorList
+	for _, err := range errs {
+		if err != nil {
+			list = append(list, err)
+		}
+	}
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+	return list
+}
+
+// errorList is a list of errors, matching each of them with errors.Is and
+// errors.As.
+type errorList []error
+
+// Error implements the error interface, joining the messages with "; ".
+func (l errorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is returns if any of the errors is target.
+func (l errorList) Is(target error) bool {
+	for _, err := range l {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors matching target.
+func (l errorList) As(target interface{}) bool {
+	for _, err := range l {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the errors, for errors.Is and errors.As of Go 1.20 onwards.
+func (l errorList) Unwrap() []error {
+	return l
+}
+
+// checkData returns ErrTruncated if length is short of the expected length of
+// marshaled data, or ErrCorrupt if it is beyond it.
+func checkData(length, expected uint64) error {
+	switch {
+	case length < expected:
+		return fmt.Errorf("%w: incorrect length: %d, expected %d", ErrTruncated, length, expected)
+	case length > expected:
+		return fmt.Errorf("%w: incorrect length: %d, expected %d", ErrCorrupt, length, expected)
 	}
-	r.mutex.Unlock()
-	m.mutex.RUnlock()
 	return nil
 }
 
-// MarshalBinary implements the encoding.BinaryMarshaler interface.
-func (r *Ring) MarshalBinary() ([]byte, error) {
-	r.mutex.RLock()
-	defer r.mutex.RUnlock()
-	out := make([]byte, len(r.bits)+17)
-	// store a version for future compatibility
-	out[0] = 1
-	binary.BigEndian.PutUint64(out[1:9], r.size)
-	binary.BigEndian.PutUint64(out[9:17], r.hash)
-	copy(out[17:], r.bits)
-	return out, nil
+// ringDecoders holds the decoder of each version of marshaled rings, which
+// returns the parameters and bit array of the data. Decoders of earlier
+// versions upgrade their data to the current parameters, so data of every
+// version ever written remains readable.
+var ringDecoders = map[byte]func(data []byte, limit uint64) (params, []byte, error){
+	1:                 decodeRingV1,
+	2:                 decodeRingV2,
+	3:                 decodeRingV3,
+	sparseVersion:     decodeRingSparse,
+	compressedVersion: decodeRingCompressed,
+}
+
+// decodeRingV1 decodes version 1 data: version, size and hash, followed by
+// size/8+1 bytes for bits. Rings of this version have no mode flags.
+func decodeRingV1(data []byte, limit uint64) (params, []byte, error) {
+	return decodeRing(data, 0, 17, limit)
+}
+
+// decodeRingV2 decodes version 2 data, which adds a byte of mode flags after
+// the version of version 1.
+func decodeRingV2(data []byte, limit uint64) (params, []byte, error) {
+	if len(data) < 2 {
+		return params{}, nil, fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	return decodeRing(data, data[1], 18, limit)
+}
+
+// decodeRingV3 decodes version 3 data, which adds the seed of the hash rounds
+// after the flags of version 2.
+func decodeRingV3(data []byte, limit uint64) (params, []byte, error) {
+	if len(data) < 10 {
+		return params{}, nil, fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	p, bits, err := decodeRing(data, data[1], 26, limit)
+	p.seed = binary.BigEndian.Uint64(data[2:10])
+	return p, bits, err
 }
 
-// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
-func (r *Ring) UnmarshalBinary(data []byte) error {
-	// 17 bytes for version + size + hash and 1 byte at least for bits
-	if len(data) < 17+1 {
-		return fmt.Errorf("incorrect length: %d", len(data))
+// decodeRing decodes the size and hash ending at header, and the bit array
+// following them. A bit array beyond limit bytes, unless 0, is rejected before
+// the rest of the data is checked.
+func decodeRing(data []byte, flags uint8, header int, limit uint64) (params, []byte, error) {
+	if len(data) < header+1 {
+		return params{}, nil, fmt.Errorf("%w: incorrect length: %d, expected at least %d",
+			ErrTruncated, len(data), header+1)
 	}
-	if data[0] != 1 {
-		return fmt.Errorf("unexpected version: %d", data[0])
+	size := binary.BigEndian.Uint64(data[header-16 : header-8])
+	hash := binary.BigEndian.Uint64(data[header-8 : header])
+	p, err := newParams(size, hash, flags)
+	if err != nil {
+		return params{}, nil, err
 	}
+	if err := checkMemory(size, limit); err != nil {
+		return params{}, nil, err
+	}
+	// newParams bounds size, so the expected length cannot overflow
+	if err := checkData(uint64(len(data)), uint64(header)+size/8+1); err != nil {
+		return params{}, nil, err
+	}
+	return p, data[header:], nil
+}
+
+// versions are the versions of marshaled data of every filter.
+var versions = []byte{
+	1, 2, 3, countingVersion, scalableVersion, cuckooVersion, xorVersion, quotientVersion,
+	bloomierVersion, ringSetVersion, compactVersion, countingPackedVersion, countMinVersion,
+	compactSeededVersion, replicatedVersion, sparseVersion, compressedVersion,
+}
+
+// versionError returns ErrBadVersion for version v of another filter, or
+// ErrUnknownVersion if no filter has version v, as for data written by a later
+// release.
+func versionError(v byte) error {
+	for _, known := range versions {
+		if v == known {
+			return fmt.Errorf("%w: %d", ErrBadVersion, v)
+		}
+	}
+	return fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface, reading
+// every binary form of MarshalBinaryFormat. Data that is truncated, or
+// otherwise inconsistent with its header, is rejected with ErrTruncated,
+// ErrBadVersion or ErrCorrupt without changing the ring.
+// Fields of the header are checked against each other and their ranges: at
+// least 8 bits, 1 to 64 hash rounds, and known mode flags. A bit array beyond
+// the limit of WithMaxMemory or SetDefaultMaxMemory is rejected with
+// ErrMemoryLimit from the header alone. A zero Ring, such as new(Ring), is
+// initialized by a successful UnmarshalBinary and is then ready for concurrent
+// use.
+//
+// UnmarshalBinary may replace the contents of a ring in use: the new bit array
+// and its parameters are published together under the write lock, so
+// concurrent Test, Add and MarshalBinary calls observe either the complete old
+// ring or the complete new one.
+func (r *Ring) UnmarshalBinary(data []byte) (err error) {
+	if r.log != nil {
+		defer func() { r.logLoaded(data, err) }()
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("%w: incorrect length: 0", ErrTruncated)
+	}
+	decode, ok := ringDecoders[data[0]]
+	if !ok {
+		return versionError(data[0])
+	}
+	p, bits, err := decode(data, r.memoryLimit())
+	if err != nil {
+		return err
+	}
+
+	// the bit array is decoded before taking the lock, so the ring changes
+	// all at once and only once the data is known to be valid
+	b := r.emptyBitset(p)
+	b.copyFrom(bits)
+	b.rebuildSummary()
+
 	if r.mutex == nil {
+		// a zero Ring has no mutex until its first successful unmarshal
 		r.mutex = new(sync.RWMutex)
 	}
+	defer r.warnSaturation()
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	r.size = binary.BigEndian.Uint64(data[1:9])
-	r.hash = binary.BigEndian.Uint64(data[9:17])
-	// sanity check against the bits being the wrong size
-	if len(r.bits) != int(r.size/8+1) {
-		r.bits = make([]uint8, r.size/8+1)
+	r.params = p
+	if old := r.set.Load(); old != nil {
+		old.release(nil)
 	}
-	copy(r.bits, data[17:])
+	r.set.Store(b)
+	r.version.Add(1)
+	r.countSetBits(b)
+	r.dropDigests()
+	r.truncateUpdates()
+	r.invalidateTruth()
 	return nil
 }
+
+// Fingerprint returns a 64-bit hash of the marshaled ring, its parameters and
+// bits, so that a ring loaded by UnmarshalBinary can be checked against the
+// fingerprint of the ring that was saved. Rings holding the same data with the
+// same parameters share a fingerprint, whatever their allocation options.
+func (r *Ring) Fingerprint() (uint64, error) {
+	data, err := r.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	h, _ := murmur128(data)
+	return h, nil
+}
+
+// Equal returns if m has the same parameters and bits as the ring. Zero Rings
+// are only equal to each other, and nil Rings are only equal to nil.
+func (r *Ring) Equal(m *Ring) bool {
+	if r == m {
+		return true
+	}
+	if r == nil || m == nil {
+		return false
+	}
+	a, aerr := r.MarshalBinary()
+	b, berr := m.MarshalBinary()
+	if aerr != nil || berr != nil {
+		return aerr != nil && berr != nil
+	}
+	return bytes.Equal(a, b)
+}
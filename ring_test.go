@@ -5,9 +5,19 @@
 package ring_test
 
 import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -80,6 +90,49 @@ func BenchmarkTest(b *testing.B) {
 	}
 }
 
+// BenchmarkTestLatency measures the latency distribution of Test while a writer
+// performs 1 million Adds, reporting the 99th and 99.9th percentiles.
+func BenchmarkTestLatency(b *testing.B) {
+	readers := runtime.GOMAXPROCS(0)
+	var lat []time.Duration
+	for n := 0; n < b.N; n++ {
+		r, _ := ring.Init(tests, fpRate)
+		var done int32
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for i := 0; i < readers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				buff := make([]byte, 4)
+				var local []time.Duration
+				for j := i; atomic.LoadInt32(&done) == 0; j += readers {
+					intToByte(buff, j)
+					start := time.Now()
+					r.Test(buff)
+					local = append(local, time.Since(start))
+				}
+				mu.Lock()
+				lat = append(lat, local...)
+				mu.Unlock()
+			}(i)
+		}
+		buff := make([]byte, 4)
+		for i := 0; i < tests; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+		}
+		atomic.StoreInt32(&done, 1)
+		wg.Wait()
+	}
+	if len(lat) == 0 {
+		return
+	}
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	b.ReportMetric(float64(lat[len(lat)*99/100]), "p99-ns")
+	b.ReportMetric(float64(lat[len(lat)*999/1000]), "p999-ns")
+}
+
 // TestBadParameters ensures that errornous parameters return an error.
 func TestBadParameters(t *testing.T) {
 	_, err := ring.Init(100, 1)
@@ -108,6 +161,260 @@ func TestBadParameters(t *testing.T) {
 	}
 }
 
+// TestErrors ensures constructors and UnmarshalBinary methods return errors
+// matching the exported sentinels with errors.Is.
+func TestErrors(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("a")}
+	errs := map[error][]error{}
+	// collect records the error of a constructor expected to match want
+	collect := func(want error) func(interface{}, error) {
+		return func(_ interface{}, err error) {
+			errs[want] = append(errs[want], err)
+		}
+	}
+	collect(ring.ErrElements)(ring.Init(0, fpRate))
+	collect(ring.ErrElements)(ring.InitUint(0, fpRate))
+	collect(ring.ErrElements)(ring.InitScalable(-1, fpRate))
+	collect(ring.ErrElements)(ring.InitInverse(0))
+	collect(ring.ErrElements)(ring.InitQuotient(0, 8))
+	collect(ring.ErrFalsePositive)(ring.Init(100, 0))
+	collect(ring.ErrFalsePositive)(ring.InitCounting(100, 1))
+	collect(ring.ErrHashRounds)(ring.Init(100, 1e-30))
+	collect(ring.ErrCounterBits)(ring.InitCounting(100, fpRate, ring.WithCounterBits(5)))
+	collect(ring.ErrEpsilon)(ring.InitCountMin(0, 0.01))
+	collect(ring.ErrDelta)(ring.InitCountMin(0.01, 1))
+	collect(ring.ErrFingerprintBits)(ring.InitCuckoo(100, 0, 4))
+	collect(ring.ErrBucketSize)(ring.InitCuckoo(100, 8, 9))
+	collect(ring.ErrLayers)(ring.InitLayered(100, fpRate, 0))
+	collect(ring.ErrRemainderBits)(ring.InitQuotient(100, 33))
+	collect(ring.ErrShards)(ring.InitRingSet(0, 100, fpRate))
+	collect(ring.ErrBitsPerValue)(ring.BuildMap(keys, []uint8{1, 2, 1}, 0))
+	collect(ring.ErrValueTooLarge)(ring.BuildMap(keys, []uint8{1, 2, 1}, 1))
+	collect(ring.ErrValues)(ring.BuildMap(keys, []uint8{1}, 2))
+	collect(ring.ErrConflict)(ring.BuildMap(keys, []uint8{1, 2, 3}, 2))
+	for want, got := range errs {
+		for _, err := range got {
+			if !errors.Is(err, want) {
+				t.Errorf("expected %v, got %v", want, err)
+			}
+		}
+	}
+}
+
+// TestErrorsJoined ensures constructors and UnmarshalBinary report every
+// problem at once, each with its offending value, matching every sentinel.
+func TestErrorsJoined(t *testing.T) {
+	header := func(size, hash uint64, flags byte) []byte {
+		// with a byte of bits, the least any ring has
+		out := make([]byte, 19)
+		out[0], out[1] = 2, flags
+		binary.BigEndian.PutUint64(out[2:10], size)
+		binary.BigEndian.PutUint64(out[10:18], hash)
+		return out
+	}
+	for _, c := range []struct {
+		name  string
+		err   error
+		wants []error
+		texts []string
+	}{
+		{"Init", second(ring.Init(0, 2.5)),
+			[]error{ring.ErrElements, ring.ErrFalsePositive}, []string{"got 0", "got 2.5"}},
+		{"New", second(ring.New(-3, 0.01, ring.WithBlocked(), ring.WithOneHash())),
+			[]error{ring.ErrElements, ring.ErrOptions}, []string{"greater than 0, got -3", "WithBlocked"}},
+		{"InitUint", second(ring.InitUint(0, math.NaN(), ring.WithHashRounds(65))),
+			[]error{ring.ErrElements, ring.ErrFalsePositive, ring.ErrOptions}, []string{"got 0", "got NaN", "65"}},
+		{"EstimateParameters", third(ring.EstimateParameters(-1, 1)),
+			[]error{ring.ErrElements, ring.ErrFalsePositive}, []string{"got -1", "got 1"}},
+		{"InitCounting", second(ring.InitCounting(0, 0, ring.WithCounterBits(5))),
+			[]error{ring.ErrCounterBits, ring.ErrElements, ring.ErrFalsePositive}, []string{"got 5"}},
+		{"InitCuckoo", second(ring.InitCuckoo(0, 33, 0)),
+			[]error{ring.ErrElements, ring.ErrFingerprintBits, ring.ErrBucketSize}, []string{"got 33"}},
+		{"InitQuotient", second(ring.InitQuotient(-1, 0)),
+			[]error{ring.ErrElements, ring.ErrRemainderBits}, []string{"got -1", "got 0"}},
+		{"InitCountMin", second(ring.InitCountMin(2, -1)),
+			[]error{ring.ErrEpsilon, ring.ErrDelta}, []string{"got 2", "got -1"}},
+		{"InitRingSet", second(ring.InitRingSet(0, 0, 0.01)),
+			[]error{ring.ErrShards, ring.ErrElements}, nil},
+		{"InitLayered", second(ring.InitLayered(10, 5, 0)),
+			[]error{ring.ErrLayers, ring.ErrFalsePositive}, []string{"got 5"}},
+		{"InitByBytesFP", second(ring.InitByBytesFP(1, -1)),
+			[]error{ring.ErrFalsePositive, ring.ErrBudget}, []string{"got -1", "1 bytes"}},
+		{"UnmarshalBinary", new(ring.Ring).UnmarshalBinary(header(3, 0, 0x80)),
+			[]error{ring.ErrCorrupt}, []string{"size: 3, expected at least 8", "hash: 0, expected 1 to 64", "flags: 128"}},
+	} {
+		if c.err == nil {
+			t.Fatalf("%s: expected an error", c.name)
+		}
+		for _, want := range c.wants {
+			if !errors.Is(c.err, want) {
+				t.Errorf("%s: %q does not match %v", c.name, c.err, want)
+			}
+		}
+		for _, text := range c.texts {
+			if !strings.Contains(c.err.Error(), text) {
+				t.Errorf("%s: %q does not hold %q", c.name, c.err, text)
+			}
+		}
+	}
+	var corrupt *ring.CorruptError
+	if err := new(ring.Ring).UnmarshalBinary(header(3, 0, 0)); !errors.As(err, &corrupt) || corrupt.Field != "size" {
+		t.Fatalf("expected the size to be corrupt first, got %v", err)
+	}
+}
+
+// second returns the second of two results.
+func second(_ interface{}, err error) error {
+	return err
+}
+
+// third returns the third of three results.
+func third(_, _ interface{}, err error) error {
+	return err
+}
+
+// TestTooLarge ensures rings beyond the platform or WithMaxBytes are rejected
+// with ErrTooLarge, exactly at the limit.
+func TestTooLarge(t *testing.T) {
+	if _, err := ring.Init(math.MaxInt, 1e-10); !errors.Is(err, ring.ErrTooLarge) {
+		t.Fatalf("ring beyond the platform not captured: %v", err)
+	}
+	if _, err := ring.InitCounting(math.MaxInt, 1e-10); !errors.Is(err, ring.ErrTooLarge) {
+		t.Fatalf("counting ring beyond the platform not captured: %v", err)
+	}
+	// 9594 bits in 1200 bytes, or 16384 bits in 2049 bytes rounded
+	for _, c := range []struct {
+		bytes uint64
+		opts  []ring.Option
+	}{
+		{1200, nil},
+		{2049, []ring.Option{ring.WithPowerOfTwoSize()}},
+	} {
+		if _, err := ring.Init(1000, 0.01, append(c.opts, ring.WithMaxBytes(c.bytes))...); err != nil {
+			t.Fatalf("ring of %d bytes rejected: %v", c.bytes, err)
+		}
+		_, err := ring.Init(1000, 0.01, append(c.opts, ring.WithMaxBytes(c.bytes-1))...)
+		if !errors.Is(err, ring.ErrTooLarge) {
+			t.Fatalf("ring of %d bytes not captured: %v", c.bytes, err)
+		}
+	}
+}
+
+// TestInitUint ensures element counts beyond 2^31 produce a usable ring on
+// 64-bit platforms, and ErrTooLarge rather than a truncated ring on 32-bit
+// platforms.
+func TestInitUint(t *testing.T) {
+	if _, err := ring.InitUint(0, fpRate); err == nil {
+		t.Fatal("element = 0 not captured")
+	}
+	const elements = 3 << 30
+	r, err := ring.InitUint(elements, 0.01)
+	if math.MaxInt == math.MaxInt32 {
+		if !errors.Is(err, ring.ErrTooLarge) {
+			t.Fatalf("%d elements not captured: %v", uint64(elements), err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := r.Parameters(); p.Bits < 9*elements || p.FalsePositiveRate(elements) > 0.01 {
+		t.Fatalf("unexpected parameters %+v", p)
+	}
+	r.Add([]byte("data"))
+	if !r.Test([]byte("data")) {
+		t.Fatal("added data missing")
+	}
+}
+
+// TestPathologicalFalsePositive ensures falsePositive rates needing more than
+// 64 hash rounds, or more memory than allowed, are rejected with the derived
+// parameters in the error, before anything large is allocated.
+func TestPathologicalFalsePositive(t *testing.T) {
+	// 64 hash rounds at 1e-19, 67 at 1e-20
+	for _, fp := range []float64{1e-10, 1e-19} {
+		if _, err := ring.Init(1000, fp); err != nil {
+			t.Fatalf("falsePositive %g rejected: %v", fp, err)
+		}
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for _, c := range []struct {
+		elements int
+		fp       float64
+		opts     []ring.Option
+		text     string
+	}{
+		{1000, 1e-20, nil, "67 rounds of 95851 bits"},
+		{1000, 1e-100, nil, "333 rounds of 479253 bits"},
+		{1, math.SmallestNonzeroFloat64, nil, "too many hash rounds"},
+		{1e9, 1e-10, []ring.Option{ring.WithMaxBytes(1 << 30)}, "ring is too large"},
+		{math.MaxInt, 1e-19, nil, "with 64 hash rounds"},
+	} {
+		_, err := ring.Init(c.elements, c.fp, c.opts...)
+		if err == nil || !strings.Contains(err.Error(), c.text) {
+			t.Fatalf("falsePositive %g: unexpected error %v", c.fp, err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if grown := after.TotalAlloc - before.TotalAlloc; grown > 1<<20 {
+		t.Fatalf("rejected rings allocated %d bytes", grown)
+	}
+}
+
+// TestZeroValue ensures every method of a zero Ring is safe, reporting
+// ErrUninitialized where it returns errors, and that the zero Ring becomes
+// usable once unmarshaled.
+func TestZeroValue(t *testing.T) {
+	r, _ := ring.Init(1000, fpRate)
+	r.Add([]byte("data"))
+	for _, z := range []*ring.Ring{{}, new(ring.Ring)} {
+		data := []byte("data")
+		z.Add(data)
+		z.AddHash(ring.NewDigest(data))
+		if z.TestAndAdd(data) {
+			t.Fatal("zero ring reported data present")
+		}
+		if z.Test(data) || z.TestHash(ring.NewDigest(data)) || z.Compact().Test(data) {
+			t.Fatal("zero ring holds data")
+		}
+		z.Reset()
+		z.Release()
+		if err := z.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for _, err := range []error{
+			z.Merge(r),
+			r.Merge(z),
+			z.MergeAll(r),
+			r.MergeAll(z),
+			ring.AddToAll(data, z),
+			z.TryAdd(data),
+		} {
+			if !errors.Is(err, ring.ErrUninitialized) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		}
+		if err := z.Merge(z); err != nil {
+			t.Fatal(err)
+		}
+		if ring.TestInAll(data, r, z) != nil {
+			t.Fatal("zero ring tested in all")
+		}
+		if _, err := z.MarshalBinary(); !errors.Is(err, ring.ErrUninitialized) {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		out, _ := r.MarshalBinary()
+		if err := z.UnmarshalBinary(out); err != nil {
+			t.Fatal(err)
+		}
+		if !z.Test(data) {
+			t.Fatal("unmarshaled data missing")
+		}
+	}
+}
+
 // TestReset ensures the Ring is cleared on Reset().
 func TestReset(t *testing.T) {
 	buff := make([]byte, 4)
@@ -128,6 +435,47 @@ func TestReset(t *testing.T) {
 	}
 }
 
+// TestResetConcurrent ensures Add and Test remain consistent while the Ring is
+// repeatedly Reset.
+func TestResetConcurrent(t *testing.T) {
+	r, _ := ring.Init(10000, fpRate)
+	var resets int64
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buff := make([]byte, 8)
+			for j := 0; ; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				intToByte(buff, i)
+				intToByte(buff[4:], j)
+				before := atomic.LoadInt64(&resets)
+				r.Add(buff)
+				found := r.Test(buff)
+				// data is only allowed to vanish if a Reset was in progress
+				if !found && before%2 == 0 && atomic.LoadInt64(&resets) == before {
+					t.Error("Data missing without a Reset")
+					return
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 1000; i++ {
+		// odd while a Reset is in progress
+		atomic.AddInt64(&resets, 1)
+		r.Reset()
+		atomic.AddInt64(&resets, 1)
+	}
+	close(done)
+	wg.Wait()
+}
+
 // TestData performs unit tests on the Ring.
 func TestData(t *testing.T) {
 	var token []byte
@@ -151,6 +499,111 @@ func TestData(t *testing.T) {
 	}
 }
 
+// TestEmptyData ensures nil and empty data are the same valid data for every
+// filter, distinct from data of a single byte, and that neither panics.
+func TestEmptyData(t *testing.T) {
+	keys := []struct {
+		name      string
+		add, test []byte
+	}{
+		{"nil", nil, []byte{}},
+		{"empty", []byte{}, nil},
+		{"byte", []byte{0}, []byte{0}},
+	}
+	for _, k := range keys {
+		// each check must find the added data, given as k.test
+		check := func(filter string, found bool) {
+			if !found {
+				t.Errorf("%s: %s data not found", filter, k.name)
+			}
+		}
+
+		for _, opts := range [][]ring.Option{nil, {ring.WithPartitioned()}, {ring.WithOneHash()}} {
+			r, _ := ring.Init(100, 0.01, opts...)
+			r.Add(k.add)
+			check("Ring", r.Test(k.test) && r.TestHash(ring.NewDigest(k.test)))
+			data, _ := r.MarshalBinary()
+			var r2 ring.Ring
+			if err := r2.UnmarshalBinary(data); err != nil {
+				t.Fatal(err)
+			}
+			check("unmarshaled Ring", r2.Test(k.test))
+			check("CompactRing", r.Compact().Test(k.test))
+			if k.name != "byte" && r.Test([]byte{0}) {
+				// a false positive of a 100 element ring is unlikely at 1%
+				t.Errorf("Ring: %s data matches a single byte", k.name)
+			}
+		}
+		if r, err := ring.BuildFrom([][]byte{k.add}, 0.01, 1); err != nil {
+			t.Fatal(err)
+		} else {
+			check("BuildFrom", r.Test(k.test))
+		}
+		if found := ring.TestInAll(k.test); found != nil {
+			t.Errorf("TestInAll of no rings: %v", found)
+		}
+
+		c, _ := ring.InitCounting(100, 0.01)
+		c.Add(k.add)
+		check("CountingRing", c.Test(k.test) && c.EstimateCount(k.test) == 1)
+		check("CountingRing.Remove", c.Remove(k.test) && !c.Test(k.add))
+
+		d, _ := ring.InitDecaying(100, 0.01, time.Hour, time.Now)
+		d.Add(k.add)
+		check("DecayingCounting", d.Test(k.test))
+
+		cm, _ := ring.InitCountMin(0.01, 0.01)
+		cm.Update(k.add)
+		check("CountMin", cm.Estimate(k.test) >= 1)
+
+		cu, _ := ring.InitCuckoo(100, 16, 4)
+		if err := cu.Add(k.add); err != nil {
+			t.Fatal(err)
+		}
+		check("Cuckoo", cu.Test(k.test))
+		check("Cuckoo.Delete", cu.Delete(k.test))
+
+		q, _ := ring.InitQuotient(100, 8)
+		if err := q.Add(k.add); err != nil {
+			t.Fatal(err)
+		}
+		check("Quotient", q.Test(k.test))
+		check("Quotient.Delete", q.Delete(k.test))
+
+		l, _ := ring.InitLayered(100, 0.01, 3)
+		l.Add(k.add)
+		l.Add(k.test)
+		check("Layered", l.TestAtLeast(k.add, 2))
+
+		rs, _ := ring.InitRingSet(4, 100, 0.01)
+		rs.Add(k.add)
+		check("RingSet", rs.Test(k.test) && rs.Shard(k.add) == rs.Shard(k.test))
+
+		sc, _ := ring.InitScalable(100, 0.01)
+		if err := sc.Add(k.add); err != nil {
+			t.Fatal(err)
+		}
+		check("ScalableRing", sc.Test(k.test))
+
+		x, err := ring.BuildXor([][]byte{k.add, k.test, []byte("other")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("Xor", x.Test(k.test))
+
+		m, err := ring.BuildMap([][]byte{k.add, k.test, []byte("other")}, []uint8{1, 1, 2}, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, ok := m.Get(k.test)
+		check("BloomierMap", ok && value == 1)
+
+		v, _ := ring.InitInverse(100)
+		v.Observe(k.add)
+		check("Inverse", v.Observe(k.test))
+	}
+}
+
 // TestMerge ensures that a Merge produces the right Ring.
 func TestMerge(t *testing.T) {
 	var token []byte
@@ -229,11 +682,16 @@ func TestMarshal(t *testing.T) {
 	}
 
 	r2 := new(ring.Ring)
-	r2.UnmarshalBinary(out)
+	if err := r2.UnmarshalBinary(out); err != nil {
+		t.Fatalf("Unexpected error from UnmarshalBinary: %v", err)
+	}
+	if !r2.Equal(r) {
+		t.Errorf("Unmarshaled ring differs from the marshaled ring")
+	}
 
 	notFound := 0
 	for _, el := range elems {
-		if !r.Test(el) {
+		if !r2.Test(el) {
 			notFound++
 		}
 	}
@@ -252,6 +710,544 @@ func TestMarshal(t *testing.T) {
 	}
 }
 
+// TestMarshalConcurrent ensures rings marshaled while a writer is adding hold
+// every element added before the marshal.
+func TestMarshalConcurrent(t *testing.T) {
+	r, _ := ring.Init(100000, fpRate)
+	var added int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buff := make([]byte, 4)
+		for i := 0; i < 100000; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+			atomic.StoreInt64(&added, int64(i+1))
+		}
+	}()
+	buff := make([]byte, 4)
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		n := int(atomic.LoadInt64(&added))
+		out, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r2 ring.Ring
+		if err := r2.UnmarshalBinary(out); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			intToByte(buff, i)
+			if !r2.Test(buff) {
+				t.Fatalf("element %d of %d missing from marshaled ring", i, n)
+			}
+		}
+	}
+}
+
+// TestFingerprint ensures Fingerprint and Equal tell apart rings differing in
+// parameters or data, while rings differing only in options match.
+func TestFingerprint(t *testing.T) {
+	a, _ := ring.Init(100, fpRate)
+	b, _ := ring.Init(100, fpRate, ring.WithFastReset())
+	a.Add([]byte("data"))
+	b.Add([]byte("data"))
+	fa, err := a.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb, _ := b.Fingerprint(); fa != fb || !a.Equal(b) {
+		t.Fatal("rings holding the same data differ")
+	}
+
+	b.Add([]byte("more"))
+	c, _ := ring.Init(100, fpRate, ring.WithPartitioned())
+	c.Add([]byte("data"))
+	d, _ := ring.Init(200, fpRate)
+	d.Add([]byte("data"))
+	for _, m := range []*ring.Ring{b, c, d, new(ring.Ring), nil} {
+		if a.Equal(m) {
+			t.Fatalf("ring equal to %v", m)
+		}
+		if m == nil {
+			continue
+		}
+		if fm, _ := m.Fingerprint(); fm == fa {
+			t.Fatal("differing rings share a fingerprint")
+		}
+	}
+	if _, err := new(ring.Ring).Fingerprint(); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("zero ring fingerprinted: %v", err)
+	}
+	if !new(ring.Ring).Equal(new(ring.Ring)) {
+		t.Fatal("zero rings differ")
+	}
+}
+
+// TestUnmarshalConcurrent ensures a ring unmarshaled into a zero Ring is fully
+// usable, with Add, Test, Reset and Merge running concurrently upon it.
+func TestUnmarshalConcurrent(t *testing.T) {
+	r, _ := ring.Init(10000, fpRate)
+	r.Add([]byte("data"))
+	out, _ := r.MarshalBinary()
+
+	r2 := new(ring.Ring)
+	if err := r2.UnmarshalBinary(out); err != nil {
+		t.Fatal(err)
+	}
+	if !r2.Test([]byte("data")) {
+		t.Fatal("unmarshaled data missing")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buff := make([]byte, 8)
+			for j := 0; j < 1000; j++ {
+				intToByte(buff, i)
+				intToByte(buff[4:], j)
+				switch j % 100 {
+				case 0:
+					r2.Reset()
+				case 50:
+					if err := r2.Merge(r); err != nil {
+						t.Error(err)
+						return
+					}
+				default:
+					r2.Add(buff)
+					r2.Test(buff)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := r2.Merge(r); err != nil {
+		t.Fatal(err)
+	}
+	if !r2.Test([]byte("data")) {
+		t.Fatal("merged data missing")
+	}
+}
+
+// TestUnmarshalReplace ensures readers of a ring whose contents are replaced
+// by UnmarshalBinary in a loop observe only the complete old or new ring: data
+// held by both is always found, and marshaled copies match one of them.
+func TestUnmarshalReplace(t *testing.T) {
+	var blobs [][]byte
+	for _, elements := range []int{1000, 5000} {
+		r, _ := ring.Init(elements, fpRate)
+		buff := make([]byte, 4)
+		for i := 0; i < 1000; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+		}
+		data, _ := r.MarshalBinary()
+		blobs = append(blobs, data)
+	}
+	r := new(ring.Ring)
+	r.UnmarshalBinary(blobs[0])
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buff := make([]byte, 4)
+			for j := i; ; j = (j + 1) % 1000 {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				intToByte(buff, j)
+				if !r.Test(buff) {
+					t.Errorf("element %d missing", j)
+					return
+				}
+				if j%100 == 0 {
+					out, _ := r.MarshalBinary()
+					if !bytes.Equal(out, blobs[0]) && !bytes.Equal(out, blobs[1]) {
+						t.Error("marshaled ring mixes both rings")
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := r.UnmarshalBinary(blobs[i%2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+// TestUnmarshalParameters ensures crafted data cannot produce a ring without
+// bits or hash rounds, which would divide by zero or report all data present.
+func TestUnmarshalParameters(t *testing.T) {
+	for _, c := range []struct {
+		size, hash uint64
+		flags      uint8
+	}{
+		{0, 3, 0},
+		{64, 0, 0},
+		{0, 0, 0},
+		{0, 3, 2},
+		{64, 0, 2},
+		{64, 0, 3},
+		{64, 65, 0},
+	} {
+		data := []byte{1}
+		if c.flags != 0 {
+			data = []byte{2, c.flags}
+		}
+		data = binary.BigEndian.AppendUint64(data, c.size)
+		data = binary.BigEndian.AppendUint64(data, c.hash)
+		data = append(data, make([]byte, 9)...)
+		var r ring.Ring
+		if err := r.UnmarshalBinary(data); err == nil {
+			t.Fatalf("size %d, hash %d, flags %d not captured", c.size, c.hash, c.flags)
+		}
+	}
+}
+
+// TestUnmarshalZeroSize ensures data describing a filter without bits or
+// counters is rejected with ErrCorrupt, rather than dividing by zero later.
+func TestUnmarshalZeroSize(t *testing.T) {
+	r, _ := ring.Init(100, fpRate)
+	c, _ := ring.InitCounting(100, fpRate)
+	m, _ := ring.InitCountMin(0.01, 0.01)
+	for _, f := range []struct {
+		filter filter
+		empty  filter
+		offset int // offset of the size in the marshaled data
+	}{
+		{r, new(ring.Ring), 1},
+		{r.Compact(), new(ring.CompactRing), 2},
+		{c, new(ring.CountingRing), 1},
+		{m, new(ring.CountMin), 2},
+		{m, new(ring.CountMin), 10},
+	} {
+		data, _ := f.filter.MarshalBinary()
+		binary.BigEndian.PutUint64(data[f.offset:], 0)
+		if err := f.empty.UnmarshalBinary(data); !errors.Is(err, ring.ErrCorrupt) {
+			t.Fatalf("%T: size 0 at %d not captured: %v", f.empty, f.offset, err)
+		}
+	}
+}
+
+// TestUnmarshalCorrupt ensures hand-corrupted data is rejected with an error
+// naming the offending field, leaving the populated receiver untouched.
+func TestUnmarshalCorrupt(t *testing.T) {
+	r, _ := ring.Init(100, fpRate, ring.WithPartitioned())
+	r.Add([]byte("data"))
+	valid, _ := r.MarshalBinary()
+	before, _ := r.Fingerprint()
+	// header builds version 2 data of size and hash, with the payload of valid
+	header := func(flags uint8, size, hash uint64, extra int) []byte {
+		data := []byte{2, flags}
+		data = binary.BigEndian.AppendUint64(data, size)
+		data = binary.BigEndian.AppendUint64(data, hash)
+		return append(data, make([]byte, size/8+1+uint64(extra))...)
+	}
+	size := binary.BigEndian.Uint64(valid[2:10])
+	hash := binary.BigEndian.Uint64(valid[10:18])
+	// the size of the valid data doubled, followed by its hash and payload
+	inflated := binary.BigEndian.AppendUint64(valid[:2:2], size*2)
+	inflated = append(inflated, valid[10:]...)
+	for _, c := range []struct {
+		name  string
+		data  []byte
+		want  error
+		field string
+	}{
+		{"no hash rounds", header(valid[1], size, 0, 0), ring.ErrCorrupt, "hash"},
+		{"too many hash rounds", header(valid[1], size, 65, 0), ring.ErrCorrupt, "hash"},
+		{"too few bits", header(0, 7, 1, 0), ring.ErrCorrupt, "size"},
+		{"unknown flags", header(0x80, size, hash, 0), ring.ErrCorrupt, "flags"},
+		{"uneven partitions", header(valid[1], size+1, hash, 0), ring.ErrCorrupt, "size"},
+		{"inflated size", inflated, ring.ErrTruncated, ""},
+		{"trailer", append(valid[:len(valid):len(valid)], 0), ring.ErrCorrupt, ""},
+	} {
+		err := r.UnmarshalBinary(c.data)
+		if !errors.Is(err, c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.want, err)
+		}
+		var corrupt *ring.CorruptError
+		if c.field != "" && (!errors.As(err, &corrupt) || corrupt.Field != c.field) {
+			t.Fatalf("%s: expected field %s, got %v", c.name, c.field, err)
+		}
+		if after, _ := r.Fingerprint(); after != before || !r.Test([]byte("data")) {
+			t.Fatalf("%s: receiver changed", c.name)
+		}
+	}
+}
+
+// TestUnmarshalUntouched ensures bad data unmarshaled into a populated ring,
+// or filter of any type, leaves its parameters and data unchanged.
+func TestUnmarshalUntouched(t *testing.T) {
+	r, _ := ring.Init(1000, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	params := r.Parameters()
+	for _, data := range marshaledRings() {
+		for n := 0; n < len(data); n++ {
+			if r.UnmarshalBinary(data[:n]) == nil {
+				t.Fatalf("%d of %d bytes accepted", n, len(data))
+			}
+		}
+	}
+	if r.Parameters() != params {
+		t.Fatalf("parameters changed to %+v", r.Parameters())
+	}
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		if !r.Test(buff) {
+			t.Fatalf("element %d missing", i)
+		}
+	}
+
+	for _, f := range filters() {
+		data, _ := f.filter.MarshalBinary()
+		for n := 0; n < len(data); n++ {
+			if f.filter.UnmarshalBinary(data[:n]) == nil {
+				t.Fatalf("%T: %d of %d bytes accepted", f.filter, n, len(data))
+			}
+		}
+		if after, _ := f.filter.MarshalBinary(); !bytes.Equal(after, data) {
+			t.Fatalf("%T: filter changed", f.filter)
+		}
+	}
+}
+
+// TestUnmarshalFixtures ensures rings marshaled by earlier releases, kept in
+// testdata, still load and answer membership exactly as when they were saved.
+// Each holds the elements 0 to 99 added with intToByte.
+func TestUnmarshalFixtures(t *testing.T) {
+	for _, c := range []struct {
+		file      string
+		positives int // false positives of elements 100 to 100099
+	}{
+		{"testdata/ring-v1.bin", 864},
+		{"testdata/ring-v2.bin", 39},
+	} {
+		data, err := os.ReadFile(c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r ring.Ring
+		if err := r.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", c.file, err)
+		}
+		buff := make([]byte, 4)
+		positives := 0
+		for i := 0; i < 100100; i++ {
+			intToByte(buff, i)
+			if found := r.Test(buff); i < 100 && !found {
+				t.Fatalf("%s: element %d missing", c.file, i)
+			} else if i >= 100 && found {
+				positives++
+			}
+		}
+		if positives != c.positives {
+			t.Fatalf("%s: %d false positives, expected %d", c.file, positives, c.positives)
+		}
+	}
+}
+
+// TestUnmarshalUnknownVersion ensures data of versions no filter writes, such
+// as those of later releases, is rejected with ErrUnknownVersion, while data
+// of other filters is only rejected with ErrBadVersion.
+func TestUnmarshalUnknownVersion(t *testing.T) {
+	data, _ := os.ReadFile("testdata/ring-v1.bin")
+	for v, unknown := range map[byte]bool{0: true, 4: true, 15: true, 16: false, 26: false, 27: false, 30: true, 255: true} {
+		data[0] = v
+		var r ring.Ring
+		err := r.UnmarshalBinary(data)
+		if !errors.Is(err, ring.ErrBadVersion) || errors.Is(err, ring.ErrUnknownVersion) != unknown {
+			t.Fatalf("version %d: unexpected error %v", v, err)
+		}
+	}
+}
+
+// marshaledRings returns marshaled rings of every version, holding data.
+func marshaledRings() [][]byte {
+	var out [][]byte
+	for _, opts := range [][]ring.Option{
+		nil,
+		{ring.WithPartitioned(), ring.WithPowerOfTwoSize()},
+		{ring.WithBlocked(), ring.WithSeed(42)},
+	} {
+		r, _ := ring.Init(100, fpRate, opts...)
+		r.Add([]byte("data"))
+		data, _ := r.MarshalBinary()
+		out = append(out, data)
+		for _, s := range []ring.Serialization{ring.SerializationSparse, ring.SerializationCompressed} {
+			data, _ := r.MarshalBinaryFormat(s)
+			out = append(out, data)
+		}
+	}
+	return out
+}
+
+// TestUnmarshalTruncated ensures every truncation of marshaled rings, and
+// every extension, is rejected without initializing the ring.
+func TestUnmarshalTruncated(t *testing.T) {
+	for _, data := range marshaledRings() {
+		for n := 0; n <= len(data)+1; n++ {
+			in := append([]byte{}, data...)
+			if n > len(data) {
+				in = append(in, 0)
+			} else {
+				in = in[:n]
+			}
+			var r ring.Ring
+			err := r.UnmarshalBinary(in)
+			if n == len(data) {
+				if err != nil || !r.Test([]byte("data")) {
+					t.Fatalf("version %d: complete data rejected: %v", data[0], err)
+				}
+				continue
+			}
+			want := ring.ErrTruncated
+			if n > len(data) {
+				want = ring.ErrCorrupt
+			}
+			if !errors.Is(err, want) {
+				t.Fatalf("version %d: %d of %d bytes not captured: %v", data[0], n, len(data), err)
+			}
+			if _, err := r.MarshalBinary(); !errors.Is(err, ring.ErrUninitialized) {
+				t.Fatalf("version %d: %d of %d bytes initialized the ring", data[0], n, len(data))
+			}
+		}
+	}
+}
+
+// filter is a filter of any type, as marshaled.
+type filter interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// filters returns a filter of every type, each with a constructor of an empty
+// filter of the same type to unmarshal into.
+func filters() []struct {
+	filter filter
+	empty  func() filter
+} {
+	keys := [][]byte{[]byte("a"), []byte("b")}
+	r, _ := ring.Init(100, fpRate)
+	c, _ := ring.InitCounting(100, fpRate)
+	m, _ := ring.InitCountMin(0.01, 0.01)
+	cf, _ := ring.InitCuckoo(100, 8, 4)
+	q, _ := ring.InitQuotient(100, 8)
+	rs, _ := ring.InitRingSet(2, 100, fpRate)
+	sc, _ := ring.InitScalable(100, fpRate)
+	x, _ := ring.BuildXor(keys)
+	bm, _ := ring.BuildMap(keys, []uint8{1, 2}, 2)
+	return []struct {
+		filter filter
+		empty  func() filter
+	}{
+		{r, func() filter { return new(ring.Ring) }},
+		{r.Compact(), func() filter { return new(ring.CompactRing) }},
+		{c, func() filter { return new(ring.CountingRing) }},
+		{m, func() filter { return new(ring.CountMin) }},
+		{cf, func() filter { return new(ring.Cuckoo) }},
+		{q, func() filter { return new(ring.Quotient) }},
+		{rs, func() filter { return new(ring.RingSet) }},
+		{sc, func() filter { return new(ring.ScalableRing) }},
+		{x, func() filter { return new(ring.Xor) }},
+		{bm, func() filter { return new(ring.BloomierMap) }},
+	}
+}
+
+// TestUnmarshalErrors ensures the UnmarshalBinary methods of every filter
+// report truncated, extended and foreign data with the exported sentinels.
+func TestUnmarshalErrors(t *testing.T) {
+	for _, f := range filters() {
+		data, err := f.filter.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.empty().UnmarshalBinary(data); err != nil {
+			t.Fatalf("%T: complete data rejected: %v", f.filter, err)
+		}
+		version := append([]byte{^data[0]}, data[1:]...)
+		for want, in := range map[error][][]byte{
+			ring.ErrTruncated:  {nil, data[:len(data)-1]},
+			ring.ErrCorrupt:    {append(data[:len(data):len(data)], 0)},
+			ring.ErrBadVersion: {version},
+		} {
+			for _, in := range in {
+				if err := f.empty().UnmarshalBinary(in); !errors.Is(err, want) {
+					t.Fatalf("%T: %d of %d bytes: expected %v, got %v", f.filter, len(in), len(data), want, err)
+				}
+			}
+		}
+	}
+}
+
+// FuzzUnmarshalBinary ensures arbitrary data never panics, and that data
+// accepted by UnmarshalBinary yields a usable ring marshaling back to it.
+func FuzzUnmarshalBinary(f *testing.F) {
+	for _, data := range marshaledRings() {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r ring.Ring
+		if err := r.UnmarshalBinary(data); err != nil {
+			if _, err := r.MarshalBinary(); !errors.Is(err, ring.ErrUninitialized) {
+				t.Fatal("rejected data initialized the ring")
+			}
+			return
+		}
+		r.Add([]byte("data"))
+		if !r.Test([]byte("data")) {
+			t.Fatal("added data missing")
+		}
+		r.Reset()
+		out, err := r.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.UnmarshalBinary(out); err != nil {
+			t.Fatalf("marshaled ring rejected: %v", err)
+		}
+	})
+}
+
+// FuzzUnmarshalFilters ensures arbitrary data never panics the UnmarshalBinary
+// method of any filter, and that filters accepting it can be marshaled again.
+func FuzzUnmarshalFilters(f *testing.F) {
+	cases := filters()
+	for _, c := range cases {
+		data, _ := c.filter.MarshalBinary()
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, c := range cases {
+			if n := c.empty(); n.UnmarshalBinary(data) == nil {
+				if _, err := n.MarshalBinary(); err != nil {
+					t.Fatalf("%T: accepted data cannot be marshaled: %v", n, err)
+				}
+			}
+		}
+	})
+}
+
 // intToByte converts an int (32-bit max) to byte array.
 func intToByte(b []byte, v int) {
 	_ = b[3] // memory safety
@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringhttp
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/tannerryan/ring"
+)
+
+// ErrNoIdempotencyKey is returned by DefaultKey for requests without an
+// Idempotency-Key header.
+var ErrNoIdempotencyKey = errors.New("error: request has no Idempotency-Key header")
+
+// DedupOption configures Dedup.
+type DedupOption func(*dedup)
+
+// WithFailClosed rejects requests whose key cannot be computed with 400 Bad
+// Request, rather than passing them to the next handler.
+func WithFailClosed() DedupOption {
+	return func(d *dedup) {
+		d.failClosed = true
+	}
+}
+
+// dedup suppresses requests whose key was seen before.
+type dedup struct {
+	next       http.Handler
+	ring       *ring.Ring
+	key        func(*http.Request) ([]byte, error)
+	duplicate  http.HandlerFunc
+	failClosed bool
+}
+
+// DefaultKey returns the key of a request for Dedup: its method, path and
+// Idempotency-Key header, separated by zero bytes. Requests without the header
+// return ErrNoIdempotencyKey, so they are never taken for duplicates of each
+// other.
+func DefaultKey(req *http.Request) ([]byte, error) {
+	id := req.Header.Get("Idempotency-Key")
+	if id == "" {
+		return nil, ErrNoIdempotencyKey
+	}
+	key := make([]byte, 0, len(req.Method)+len(req.URL.Path)+len(id)+2)
+	key = append(append(key, req.Method...), 0)
+	key = append(append(key, req.URL.Path...), 0)
+	return append(key, id...), nil
+}
+
+// Dedup returns a handler passing each request to next the first time its key
+// is seen, as by TestAndAdd of the ring, and answering requests with a key
+// seen before with onDuplicate, such as retried webhooks or replayed events.
+// Of concurrent requests with the same key, exactly one is passed to next.
+// keyFn computes the key of a request, DefaultKey if nil, and onDuplicate
+// answers duplicates with 409 Conflict if nil.
+//
+// Requests whose key cannot be computed fail open, passed to next without
+// being recorded, unless WithFailClosed is given. The ring may report a key
+// never seen as seen at its false positive rate, so a ring sized for the
+// expected number of keys suppresses that fraction of first requests; keys
+// are recorded before next is called, so a request failing in next is
+// suppressed when retried.
+func Dedup(next http.Handler, r *ring.Ring, keyFn func(*http.Request) ([]byte, error), onDuplicate http.HandlerFunc, opts ...DedupOption) http.Handler {
+	d := &dedup{next: next, ring: r, key: keyFn, duplicate: onDuplicate}
+	if d.key == nil {
+		d.key = DefaultKey
+	}
+	if d.duplicate == nil {
+		d.duplicate = func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, "duplicate request", http.StatusConflict)
+		}
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// ServeHTTP implements http.Handler.
+func (d *dedup) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key, err := d.key(req)
+	switch {
+	case err != nil && d.failClosed:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		d.next.ServeHTTP(w, req)
+	case d.ring.TestAndAdd(key):
+		d.duplicate(w, req)
+	default:
+		d.next.ServeHTTP(w, req)
+	}
+}
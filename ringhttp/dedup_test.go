@@ -0,0 +1,137 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringhttp_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringhttp"
+)
+
+// counter is a handler counting the requests passed to it.
+type counter struct {
+	n atomic.Int32
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c.n.Add(1)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveDedup sends a request with the Idempotency-Key header, if not empty, to
+// the handler, returning the status.
+func serveDedup(h http.Handler, method, path, id string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if id != "" {
+		req.Header.Set("Idempotency-Key", id)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+// TestDedup ensures first requests pass and duplicates are suppressed, by the
+// default key of the method, path and Idempotency-Key header.
+func TestDedup(t *testing.T) {
+	r, _ := ring.Init(1000, 0.001)
+	next := new(counter)
+	h := ringhttp.Dedup(next, r, nil, nil)
+	for _, c := range []struct {
+		method, path, id string
+		status           int
+	}{
+		{"POST", "/hook", "a", http.StatusAccepted},
+		{"POST", "/hook", "a", http.StatusConflict},
+		{"POST", "/hook", "b", http.StatusAccepted},
+		{"PUT", "/hook", "a", http.StatusAccepted},
+		{"POST", "/other", "a", http.StatusAccepted},
+		{"POST", "/other", "a", http.StatusConflict},
+		// without a key, requests fail open
+		{"POST", "/hook", "", http.StatusAccepted},
+		{"POST", "/hook", "", http.StatusAccepted},
+	} {
+		if status := serveDedup(h, c.method, c.path, c.id); status != c.status {
+			t.Fatalf("%s %s %q: expected %d, got %d", c.method, c.path, c.id, c.status, status)
+		}
+	}
+	if n := next.n.Load(); n != 6 {
+		t.Fatalf("expected 6 requests passed, got %d", n)
+	}
+}
+
+// TestDedupCustom ensures custom keys, duplicate handlers and failing closed.
+func TestDedupCustom(t *testing.T) {
+	r, _ := ring.Init(1000, 0.001)
+	next := new(counter)
+	errNoEvent := errors.New("no event")
+	key := func(req *http.Request) ([]byte, error) {
+		if id := req.URL.Query().Get("event"); id != "" {
+			return []byte(id), nil
+		}
+		return nil, errNoEvent
+	}
+	duplicate := func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	open := ringhttp.Dedup(next, r, key, duplicate)
+	closed := ringhttp.Dedup(next, r, key, duplicate, ringhttp.WithFailClosed())
+	for _, c := range []struct {
+		h      http.Handler
+		path   string
+		status int
+	}{
+		{open, "/?event=1", http.StatusAccepted},
+		{open, "/?event=1", http.StatusOK},
+		{closed, "/?event=1", http.StatusOK},
+		{closed, "/?event=2", http.StatusAccepted},
+		{open, "/", http.StatusAccepted},
+		{closed, "/", http.StatusBadRequest},
+	} {
+		if status := serveDedup(c.h, "POST", c.path, ""); status != c.status {
+			t.Fatalf("%s: expected %d, got %d", c.path, c.status, status)
+		}
+	}
+	if n := next.n.Load(); n != 3 {
+		t.Fatalf("expected 3 requests passed, got %d", n)
+	}
+}
+
+// TestDedupConcurrent ensures exactly one of concurrent identical requests is
+// passed on.
+func TestDedupConcurrent(t *testing.T) {
+	r, _ := ring.Init(1000, 0.001)
+	next := new(counter)
+	s := httptest.NewServer(ringhttp.Dedup(next, r, nil, nil))
+	defer s.Close()
+	var conflicts atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", s.URL+"/hook", nil)
+			req.Header.Set("Idempotency-Key", "same")
+			resp, err := s.Client().Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusConflict {
+				conflicts.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if next.n.Load() != 1 || conflicts.Load() != 15 {
+		t.Fatalf("%d requests passed, %d conflicts", next.n.Load(), conflicts.Load())
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ringhttp serves a ring over HTTP, for quick integrations and
+// debugging. The handler serves
+//
+//	POST /add       add the request body, or the base64 "key" of a JSON body
+//	GET  /test      test the query parameter key, or the base64 key64
+//	GET  /stats     the Stats of the ring, as JSON
+//	GET  /dump      the binary form of the ring, as written by WriteTo
+//
+// relative to the path it is mounted at with http.StripPrefix. ServeMerge
+// serves snapshots and merges of a ring to peers calling PullAndMerge and
+// Push. Dedup is middleware suppressing duplicate requests, such as retried
+// webhooks, with a ring of the keys seen.
+package ringhttp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tannerryan/ring"
+)
+
+// DefaultMaxBodySize is the largest body of POST /add accepted by default.
+const DefaultMaxBodySize = 64 << 10
+
+// Option configures a handler.
+type Option func(*handler)
+
+// WithMaxBodySize sets the largest body of POST /add accepted, in bytes.
+// Larger bodies are rejected with 413 Request Entity Too Large.
+func WithMaxBodySize(n int64) Option {
+	return func(h *handler) {
+		h.maxBody = n
+	}
+}
+
+// WithAuth checks the bearer token of the Authorization header of every
+// request, or the empty string if there is none, with check. Requests it
+// rejects are answered with 401 Unauthorized.
+func WithAuth(check func(token string) bool) Option {
+	return func(h *handler) {
+		h.auth = check
+	}
+}
+
+// handler serves a ring.
+type handler struct {
+	ring    *ring.Ring
+	maxBody int64
+	auth    func(token string) bool
+}
+
+// addRequest is the JSON body of POST /add.
+type addRequest struct {
+	Key []byte `json:"key"` // base64 encoded
+}
+
+// testResponse is the JSON response of GET /test.
+type testResponse struct {
+	Present bool `json:"present"`
+}
+
+// NewHandler returns a handler serving the ring.
+func NewHandler(r *ring.Ring, opts ...Option) http.Handler {
+	h := &handler{ring: r, maxBody: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.auth != nil {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !h.auth(token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	var serve func(http.ResponseWriter, *http.Request)
+	method := http.MethodGet
+	switch req.URL.Path {
+	case "/add":
+		serve, method = h.add, http.MethodPost
+	case "/test":
+		serve = h.test
+	case "/stats":
+		serve = h.stats
+	case "/dump":
+		serve = h.dump
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != method && !(method == http.MethodGet && req.Method == http.MethodHead) {
+		w.Header().Set("Allow", method)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	serve(w, req)
+}
+
+// add serves POST /add.
+func (h *handler) add(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, h.maxBody)
+	var key []byte
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/json" {
+		var body addRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			bodyError(w, err)
+			return
+		}
+		if body.Key == nil {
+			http.Error(w, "missing key", http.StatusBadRequest)
+			return
+		}
+		key = body.Key
+	} else {
+		var err error
+		if key, err = io.ReadAll(req.Body); err != nil {
+			bodyError(w, err)
+			return
+		}
+	}
+	if err := h.ring.TryAdd(key); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bodyError answers a request whose body could not be read.
+func bodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+}
+
+// test serves GET /test.
+func (h *handler) test(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	var key []byte
+	switch {
+	case query.Has("key"):
+		key = []byte(query.Get("key"))
+	case query.Has("key64"):
+		var err error
+		if key, err = base64.StdEncoding.DecodeString(query.Get("key64")); err != nil {
+			http.Error(w, "invalid key64: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, testResponse{h.ring.Test(key)})
+}
+
+// stats serves GET /stats.
+func (h *handler) stats(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, h.ring.Stats())
+}
+
+// dump serves GET /dump.
+func (h *handler) dump(w http.ResponseWriter, req *http.Request) {
+	size := h.ring.MarshaledSize()
+	if size == 0 {
+		http.Error(w, ring.ErrUninitialized.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(size))
+	if req.Method == http.MethodHead {
+		return
+	}
+	// the ring is streamed rather than buffered; should UnmarshalBinary
+	// replace it with one of another size meanwhile, the body disagrees with
+	// its length and the response fails rather than deliver the wrong ring
+	h.ring.WriteTo(w)
+}
+
+// writeJSON answers with v as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
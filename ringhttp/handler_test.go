@@ -0,0 +1,205 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringhttp_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringhttp"
+)
+
+// do sends a request to the server, returning the status and body.
+func do(t *testing.T, s *httptest.Server, method, path, contentType string, body io.Reader) (int, []byte, http.Header) {
+	t.Helper()
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data, resp.Header
+}
+
+// present returns the answer of GET /test for the query.
+func present(t *testing.T, s *httptest.Server, query string) bool {
+	t.Helper()
+	status, body, _ := do(t, s, http.MethodGet, "/test?"+query, "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", query, status, body)
+	}
+	var resp struct{ Present bool }
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Present
+}
+
+// TestHandler ensures each endpoint serves the ring.
+func TestHandler(t *testing.T) {
+	r, _ := ring.New(1000, 0.001)
+	r.EnableCounters()
+	s := httptest.NewServer(ringhttp.NewHandler(r))
+	defer s.Close()
+
+	if status, _, _ := do(t, s, http.MethodPost, "/add", "text/plain", strings.NewReader("raw key")); status != http.StatusNoContent {
+		t.Fatalf("raw add: status %d", status)
+	}
+	// "\x00\xff" in base64
+	if status, _, _ := do(t, s, http.MethodPost, "/add", "application/json; charset=utf-8", strings.NewReader(`{"key": "AP8="}`)); status != http.StatusNoContent {
+		t.Fatalf("JSON add: status %d", status)
+	}
+	if !r.Test([]byte("raw key")) || !r.Test([]byte{0, 0xff}) {
+		t.Fatal("added keys missing")
+	}
+	if !present(t, s, "key="+url.QueryEscape("raw key")) || !present(t, s, "key64="+url.QueryEscape("AP8=")) {
+		t.Fatal("added keys not present")
+	}
+	if present(t, s, "key=absent") {
+		t.Fatal("absent key present")
+	}
+
+	status, body, header := do(t, s, http.MethodGet, "/stats", "", nil)
+	var stats ring.Stats
+	if err := json.Unmarshal(body, &stats); status != http.StatusOK || err != nil {
+		t.Fatalf("stats: status %d, %v", status, err)
+	}
+	if header.Get("Content-Type") != "application/json" || stats.Bits != r.Parameters().Bits || stats.Adds != 2 || stats.Tests != 5 {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	status, body, header = do(t, s, http.MethodGet, "/dump", "", nil)
+	want, _ := r.MarshalBinary()
+	if status != http.StatusOK || !bytes.Equal(body, want) || header.Get("Content-Length") != strconv.Itoa(len(want)) {
+		t.Fatalf("dump: status %d, %d bytes of %s", status, len(body), header.Get("Content-Length"))
+	}
+	loaded := new(ring.Ring)
+	if err := loaded.UnmarshalBinary(body); err != nil || !loaded.Equal(r) {
+		t.Fatalf("dump does not load as the ring: %v", err)
+	}
+}
+
+// TestHandlerErrors ensures invalid requests are answered with their status.
+func TestHandlerErrors(t *testing.T) {
+	r, _ := ring.New(1000, 0.001)
+	s := httptest.NewServer(ringhttp.NewHandler(r, ringhttp.WithMaxBodySize(16)))
+	defer s.Close()
+	for _, c := range []struct {
+		method, path, contentType, body string
+		status                          int
+	}{
+		{http.MethodPost, "/add", "", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/add", "application/json", `{"key": "` + strings.Repeat("A", 20) + `"}`, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/add", "application/json", `{"key":"!!"}`, http.StatusBadRequest},
+		{http.MethodPost, "/add", "application/json", `{}`, http.StatusBadRequest},
+		{http.MethodGet, "/add", "", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/test?key=x", "", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/test", "", "", http.StatusBadRequest},
+		{http.MethodGet, "/test?key64=%25", "", "", http.StatusBadRequest},
+		{http.MethodDelete, "/dump", "", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/unknown", "", "", http.StatusNotFound},
+	} {
+		status, body, _ := do(t, s, c.method, c.path, c.contentType, strings.NewReader(c.body))
+		if status != c.status {
+			t.Errorf("%s %s %q: status %d, expected %d: %s", c.method, c.path, c.body, status, c.status, body)
+		}
+	}
+	if status, _, _ := do(t, s, http.MethodPost, "/add", "", strings.NewReader(strings.Repeat("x", 16))); status != http.StatusNoContent {
+		t.Errorf("body of the largest size: status %d", status)
+	}
+
+	zero := httptest.NewServer(ringhttp.NewHandler(new(ring.Ring)))
+	defer zero.Close()
+	if status, _, _ := do(t, zero, http.MethodGet, "/dump", "", nil); status != http.StatusServiceUnavailable {
+		t.Errorf("dump of a zero ring: status %d", status)
+	}
+	if status, _, _ := do(t, zero, http.MethodPost, "/add", "", strings.NewReader("x")); status != http.StatusServiceUnavailable {
+		t.Errorf("add to a zero ring: status %d", status)
+	}
+}
+
+// TestHandlerAuth ensures requests are checked with the bearer token.
+func TestHandlerAuth(t *testing.T) {
+	r, _ := ring.New(1000, 0.001)
+	s := httptest.NewServer(ringhttp.NewHandler(r, ringhttp.WithAuth(func(token string) bool {
+		return token == "secret"
+	})))
+	defer s.Close()
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "Bearer wrong": http.StatusUnauthorized, "Bearer secret": http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/stats", nil)
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%q: status %d, expected %d", token, resp.StatusCode, want)
+		}
+		if want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%q: no challenge", token)
+		}
+	}
+}
+
+// TestHandlerConcurrent ensures concurrent adds are each found by tests, which
+// the race detector verifies too.
+func TestHandlerConcurrent(t *testing.T) {
+	r, _ := ring.New(10000, 0.001)
+	s := httptest.NewServer(ringhttp.NewHandler(r))
+	defer s.Close()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				key := fmt.Sprintf("%d-%d", w, i)
+				req, _ := http.NewRequest(http.MethodPost, s.URL+"/add", strings.NewReader(key))
+				resp, err := s.Client().Do(req)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				resp, err = s.Client().Get(s.URL + "/test?key=" + key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var body struct{ Present bool }
+				json.NewDecoder(resp.Body).Decode(&body)
+				resp.Body.Close()
+				if !body.Present {
+					t.Errorf("%s missing after its add", key)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,374 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+const (
+	// defaultAttempts is the number of attempts of PullAndMerge and Push
+	// without WithRetries.
+	defaultAttempts = 3
+	// defaultBackoff is the wait before the first retry without WithRetries,
+	// doubled before each further retry.
+	defaultBackoff = 100 * time.Millisecond
+	// headerSlack is the number of bytes a ring of other parameters may be
+	// larger than the ring by its header alone, such as for a seed, so it is
+	// rejected as incompatible rather than too large.
+	headerSlack = 64
+)
+
+// mergeError is the JSON body of errors of POST /merge, with the parameter
+// that differs for 409 Conflict.
+type mergeError struct {
+	Error    string `json:"error"`
+	Field    string `json:"field,omitempty"`
+	Receiver uint64 `json:"receiver,omitempty"`
+	Argument uint64 `json:"argument,omitempty"`
+}
+
+// mergeHandler serves the snapshots and merges of ServeMerge.
+type mergeHandler struct {
+	handler
+}
+
+// ServeMerge returns a handler exchanging the ring with peers, a lighter
+// alternative to the ringsync package for peers reachable over HTTP. It serves
+//
+//	GET  /snapshot  the binary form of the ring, as written by WriteTo
+//	POST /merge     merge the ring of the binary form of the body
+//
+// relative to the path it is mounted at with http.StripPrefix, as fetched and
+// sent by PullAndMerge and Push. Both accept gzip content encoding. A ring of
+// other parameters is answered with 409 Conflict and a JSON body naming the
+// parameter, and a body larger than any ring of the size of the ring, once
+// decompressed, or than WithMaxBodySize, with 413 Request Entity Too Large.
+// Without WithMaxBodySize, bodies are only limited by the size of the ring.
+func ServeMerge(r *ring.Ring, opts ...Option) http.Handler {
+	h := &mergeHandler{handler{ring: r}}
+	for _, opt := range opts {
+		opt(&h.handler)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *mergeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if h.auth != nil {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !h.auth(token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	switch {
+	case req.URL.Path == "/snapshot" && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+		h.snapshot(w, req)
+	case req.URL.Path == "/merge" && req.Method == http.MethodPost:
+		h.merge(w, req)
+	case req.URL.Path == "/snapshot":
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	case req.URL.Path == "/merge":
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// snapshot serves GET /snapshot, compressed if the client accepts gzip.
+func (h *mergeHandler) snapshot(w http.ResponseWriter, req *http.Request) {
+	if !acceptsGzip(req) {
+		h.dump(w, req)
+		return
+	}
+	if h.ring.MarshaledSize() == 0 {
+		http.Error(w, ring.ErrUninitialized.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Set("Vary", "Accept-Encoding")
+	if req.Method == http.MethodHead {
+		return
+	}
+	// once the headers are sent, a failure can only cut the body short
+	zw := gzip.NewWriter(w)
+	if _, err := h.ring.WriteTo(zw); err == nil {
+		zw.Close()
+	}
+}
+
+// acceptsGzip returns if the request accepts gzip content encoding.
+func acceptsGzip(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		coding, q, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) == "gzip" && strings.ReplaceAll(q, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// merge serves POST /merge.
+func (h *mergeHandler) merge(w http.ResponseWriter, req *http.Request) {
+	limit := int64(h.ring.MarshaledSize())
+	if limit == 0 {
+		writeMergeError(w, http.StatusServiceUnavailable, mergeError{Error: ring.ErrUninitialized.Error()})
+		return
+	}
+	if h.maxBody > 0 {
+		req.Body = http.MaxBytesReader(w, req.Body, h.maxBody)
+	}
+	data, err := readRing(req.Body, req.Header.Get("Content-Encoding"), limit+headerSlack)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, ring.ErrTooLarge) || errors.As(err, &tooLarge):
+		writeMergeError(w, http.StatusRequestEntityTooLarge, mergeError{Error: "body too large"})
+		return
+	case err != nil:
+		writeMergeError(w, http.StatusBadRequest, mergeError{Error: "invalid body: " + err.Error()})
+		return
+	}
+	m := new(ring.Ring)
+	if err := m.UnmarshalBinary(data); err != nil {
+		writeMergeError(w, http.StatusBadRequest, mergeError{Error: err.Error()})
+		return
+	}
+	if err := h.ring.MergeContext(req.Context(), m); err != nil {
+		var incompatible *ring.IncompatibleError
+		if errors.As(err, &incompatible) {
+			writeMergeError(w, http.StatusConflict, mergeError{
+				Error:    err.Error(),
+				Field:    incompatible.Field,
+				Receiver: incompatible.Receiver,
+				Argument: incompatible.Argument,
+			})
+			return
+		}
+		writeMergeError(w, http.StatusServiceUnavailable, mergeError{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMergeError answers with the error as JSON.
+func writeMergeError(w http.ResponseWriter, status int, e mergeError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// readRing reads the binary form of a ring of the content encoding from body,
+// returning ring.ErrTooLarge once it exceeds limit bytes.
+func readRing(body io.Reader, encoding string, limit int64) ([]byte, error) {
+	switch encoding {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		body = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ring.ErrTooLarge, limit)
+	}
+	return data, nil
+}
+
+// ClientOption configures PullAndMerge and Push.
+type ClientOption func(*client)
+
+// client is the configuration of PullAndMerge and Push.
+type client struct {
+	http     *http.Client
+	attempts int
+	backoff  time.Duration
+}
+
+// WithHTTPClient sets the client of the requests, by default
+// http.DefaultClient.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(cl *client) {
+		cl.http = c
+	}
+}
+
+// WithRetries sets the number of attempts of a request, by default 3, and the
+// wait before the first retry, by default 100ms, doubled before each further
+// retry.
+func WithRetries(attempts int, backoff time.Duration) ClientOption {
+	return func(cl *client) {
+		cl.attempts = attempts
+		cl.backoff = backoff
+	}
+}
+
+// newClient returns the configuration of the options.
+func newClient(opts []ClientOption) *client {
+	c := &client{http: http.DefaultClient, attempts: defaultAttempts, backoff: defaultBackoff}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.attempts < 1 {
+		c.attempts = 1
+	}
+	return c
+}
+
+// statusError is the error of a response of an unexpected status.
+type statusError struct {
+	status int
+	body   string
+}
+
+// Error implements the error interface.
+func (e *statusError) Error() string {
+	return fmt.Sprintf("error: peer answered %d %s: %s", e.status, http.StatusText(e.status), e.body)
+}
+
+// PullAndMerge fetches the snapshot of the ring served by ServeMerge at url,
+// the path it is mounted at, and merges it into r. The snapshot is requested
+// gzip compressed, and read only up to the size of r, which a ring of the same
+// parameters has, give or take its header; a larger snapshot returns an error
+// matching ring.ErrTooLarge, and one of other parameters a
+// *ring.IncompatibleError. Requests failing to connect or answered with a 5xx
+// status are retried, as set by WithRetries, unless ctx is done, whose error
+// is then returned.
+func PullAndMerge(ctx context.Context, url string, r *ring.Ring, opts ...ClientOption) error {
+	limit := int64(r.MarshaledSize())
+	if limit == 0 {
+		return ring.ErrUninitialized
+	}
+	c := newClient(opts)
+	var data []byte
+	err := c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+"/snapshot", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return responseError(resp)
+		}
+		data, err = readRing(resp.Body, resp.Header.Get("Content-Encoding"), limit+headerSlack)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	m := new(ring.Ring)
+	if err := m.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	return r.MergeContext(ctx, m)
+}
+
+// Push sends r, gzip compressed, to be merged into the ring served by
+// ServeMerge at url, the path it is mounted at. A ring of other parameters
+// returns a *ring.IncompatibleError, whose receiver is r, and a ring larger
+// than the peer accepts an error matching ring.ErrTooLarge. Requests are
+// retried as by PullAndMerge; merging is idempotent, so a request retried
+// after the peer merged it is harmless.
+func Push(ctx context.Context, url string, r *ring.Ring, opts ...ClientOption) error {
+	c := newClient(opts)
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if _, err := r.WriteTo(zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return c.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(url, "/")+"/merge", bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+			return responseError(resp)
+		}
+		return nil
+	})
+}
+
+// responseError returns the error of a response of an unexpected status:
+// a *ring.IncompatibleError for 409 Conflict, seen from the client, an error
+// matching ring.ErrTooLarge for 413, and a *statusError otherwise.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	var e mergeError
+	json.Unmarshal(body, &e)
+	switch resp.StatusCode {
+	case http.StatusConflict:
+		if e.Field == "" {
+			return fmt.Errorf("%w: %s", ring.ErrIncompatible, e.Error)
+		}
+		return &ring.IncompatibleError{Field: e.Field, Receiver: e.Argument, Argument: e.Receiver}
+	case http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w: peer rejected the ring", ring.ErrTooLarge)
+	}
+	return &statusError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+}
+
+// retry calls do until it succeeds, fails with an error not worth retrying, or
+// the attempts are spent, waiting with backoff in between. Errors of requests
+// and of 5xx responses are retried.
+func (c *client) retry(ctx context.Context, do func() error) error {
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		err := do()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var status *statusError
+		if attempt == c.attempts || errors.As(err, &status) && status.status < 500 ||
+			errors.Is(err, ring.ErrIncompatible) || errors.Is(err, ring.ErrTooLarge) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
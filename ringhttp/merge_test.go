@@ -0,0 +1,212 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringhttp_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringhttp"
+)
+
+// encodings records the content encoding of each request and response.
+type encodings struct {
+	next     http.Handler
+	request  atomic.Value
+	response atomic.Value
+}
+
+func (e *encodings) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	e.request.Store(req.Header.Get("Content-Encoding"))
+	e.next.ServeHTTP(w, req)
+	e.response.Store(w.Header().Get("Content-Encoding"))
+}
+
+// filled returns a ring of 10000 elements holding the keys prefix0 to
+// prefix999.
+func filled(prefix string, opts ...ring.Option) *ring.Ring {
+	r, _ := ring.New(10000, 0.001, opts...)
+	for i := 0; i < 1000; i++ {
+		r.Add([]byte(prefix + strconv.Itoa(i)))
+	}
+	return r
+}
+
+// TestPullAndMerge ensures a pulled snapshot, compressed, is merged into the
+// ring.
+func TestPullAndMerge(t *testing.T) {
+	remote, local := filled("remote"), filled("local")
+	e := &encodings{next: ringhttp.ServeMerge(remote)}
+	s := httptest.NewServer(http.StripPrefix("/ring", e))
+	defer s.Close()
+	if err := ringhttp.PullAndMerge(context.Background(), s.URL+"/ring", local); err != nil {
+		t.Fatal(err)
+	}
+	if e.response.Load() != "gzip" {
+		t.Fatalf("snapshot sent with encoding %q", e.response.Load())
+	}
+	if !local.Test([]byte("remote999")) || !local.Test([]byte("local0")) || remote.Test([]byte("local0")) {
+		t.Fatal("snapshot not merged")
+	}
+
+	// clients not accepting gzip get the snapshot as is
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/ring/snapshot", nil)
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := s.Client().Transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(remote.MarshaledSize()) {
+		t.Fatalf("status %d, length %d", resp.StatusCode, resp.ContentLength)
+	}
+}
+
+// TestPush ensures a pushed ring, compressed, is merged into the served ring.
+func TestPush(t *testing.T) {
+	remote, local := filled("remote"), filled("local")
+	e := &encodings{next: ringhttp.ServeMerge(remote)}
+	s := httptest.NewServer(e)
+	defer s.Close()
+	if err := ringhttp.Push(context.Background(), s.URL, local); err != nil {
+		t.Fatal(err)
+	}
+	if e.request.Load() != "gzip" {
+		t.Fatalf("ring sent with encoding %q", e.request.Load())
+	}
+	if !remote.Test([]byte("local999")) || !remote.Test([]byte("remote0")) || local.Test([]byte("remote0")) {
+		t.Fatal("pushed ring not merged")
+	}
+	status, _, _ := do(t, s, http.MethodGet, "/merge", "", nil)
+	if status != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /merge: status %d", status)
+	}
+}
+
+// TestMergeIncompatible ensures rings of other parameters are answered with
+// 409 and a JSON body, converted back to an *ring.IncompatibleError.
+func TestMergeIncompatible(t *testing.T) {
+	remote, local := filled("remote"), filled("local", ring.WithSeed(5))
+	s := httptest.NewServer(ringhttp.ServeMerge(remote))
+	defer s.Close()
+
+	var incompatible *ring.IncompatibleError
+	err := ringhttp.Push(context.Background(), s.URL, local)
+	if !errors.As(err, &incompatible) || incompatible.Field != "seed" || incompatible.Receiver != 5 || incompatible.Argument != 0 {
+		t.Fatalf("expected an IncompatibleError of the seed, got %v", err)
+	}
+	if !errors.Is(err, ring.ErrIncompatible) || remote.Test([]byte("local0")) {
+		t.Fatalf("expected ErrIncompatible without merging, got %v", err)
+	}
+	if err := ringhttp.PullAndMerge(context.Background(), s.URL, local); !errors.Is(err, ring.ErrIncompatible) {
+		t.Fatalf("expected ErrIncompatible, got %v", err)
+	}
+
+	data, _ := local.MarshalBinary()
+	status, body, header := do(t, s, http.MethodPost, "/merge", "application/octet-stream", bytes.NewReader(data))
+	var resp struct {
+		Error string
+		Field string
+	}
+	if status != http.StatusConflict || header.Get("Content-Type") != "application/json" ||
+		json.Unmarshal(body, &resp) != nil || resp.Field != "seed" || resp.Error == "" {
+		t.Fatalf("status %d: %s", status, body)
+	}
+}
+
+// TestMergeOversized ensures payloads larger than the ring or the limit are
+// rejected with 413 and ring.ErrTooLarge, on either side.
+func TestMergeOversized(t *testing.T) {
+	small, _ := ring.New(1000, 0.001)
+	large := filled("large")
+	s := httptest.NewServer(ringhttp.ServeMerge(small))
+	defer s.Close()
+	if err := ringhttp.Push(context.Background(), s.URL, large); !errors.Is(err, ring.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	data, _ := large.MarshalBinary()
+	if status, _, _ := do(t, s, http.MethodPost, "/merge", "", bytes.NewReader(data)); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d", status)
+	}
+
+	pulled := httptest.NewServer(ringhttp.ServeMerge(large))
+	defer pulled.Close()
+	if err := ringhttp.PullAndMerge(context.Background(), pulled.URL, small); !errors.Is(err, ring.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+
+	limited := httptest.NewServer(ringhttp.ServeMerge(filled("limited"), ringhttp.WithMaxBodySize(64)))
+	defer limited.Close()
+	if err := ringhttp.Push(context.Background(), limited.URL, filled("other")); !errors.Is(err, ring.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+// TestMergeRetries ensures requests answered with 5xx are retried, and those
+// answered with 4xx are not.
+func TestMergeRetries(t *testing.T) {
+	remote, local := filled("remote"), filled("local")
+	serve := ringhttp.ServeMerge(remote)
+	var requests, failures atomic.Int32
+	failures.Store(2)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if failures.Add(-1) >= 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		serve.ServeHTTP(w, req)
+	}))
+	defer s.Close()
+	retries := ringhttp.WithRetries(3, time.Millisecond)
+	if err := ringhttp.PullAndMerge(context.Background(), s.URL, local, retries); err != nil || requests.Load() != 3 {
+		t.Fatalf("%d requests: %v", requests.Load(), err)
+	}
+	failures.Store(3)
+	requests.Store(0)
+	if err := ringhttp.Push(context.Background(), s.URL, local, retries); err == nil || requests.Load() != 3 {
+		t.Fatalf("%d requests: %v", requests.Load(), err)
+	}
+	requests.Store(0)
+	if err := ringhttp.Push(context.Background(), s.URL+"/missing", local, retries); err == nil || requests.Load() != 1 {
+		t.Fatalf("%d requests: %v", requests.Load(), err)
+	}
+}
+
+// TestPullCanceled ensures canceling the context mid-stream returns its error,
+// leaving the ring unchanged.
+func TestPullCanceled(t *testing.T) {
+	local := filled("local")
+	before, _ := local.MarshalBinary()
+	streaming := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(before)))
+		w.Write(before[:len(before)/2])
+		w.(http.Flusher).Flush()
+		close(streaming)
+		<-req.Context().Done()
+	}))
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-streaming
+		cancel()
+	}()
+	if err := ringhttp.PullAndMerge(ctx, s.URL, local); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if after, _ := local.MarshalBinary(); !bytes.Equal(before, after) {
+		t.Fatal("ring changed by a canceled pull")
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ringotel instruments a ring with OpenTelemetry. Expensive operations,
+// those of batches, merges and marshaling, are traced with spans, while each
+// Add and Test only counts, as a span per call would cost more than the call.
+// It is a module of its own, so the ring package does not depend on
+// OpenTelemetry.
+package ringotel
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/tannerryan/ring"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer and meter of the package.
+const instrumentationName = "github.com/tannerryan/ring/ringotel"
+
+// Attribute keys of the spans and metrics.
+const (
+	OperationKey  = attribute.Key("ring.operation")   // operation of a metric, such as "Merge"
+	BitsKey       = attribute.Key("ring.bits")        // bits of the ring
+	HashRoundsKey = attribute.Key("ring.hash_rounds") // hash rounds of the ring
+	ItemsKey      = attribute.Key("ring.items")       // data of a batch
+	BytesKey      = attribute.Key("ring.bytes")       // bytes marshaled or unmarshaled
+	RingsKey      = attribute.Key("ring.rings")       // rings merged
+)
+
+// Instrumented is a ring instrumented with OpenTelemetry. It has the method set
+// of the ring it wraps; those below record telemetry, and the rest are those of
+// the ring. Its metrics are
+//
+//	ring.adds                data added
+//	ring.tests               data tested
+//	ring.hits                data tested and reported present
+//	ring.operation.duration  seconds of each traced operation
+//	ring.operation.items     data of each batch
+//	ring.operation.bytes     bytes of each marshal or unmarshal
+//
+// the last three by the attribute ring.operation, and its spans, named after
+// the operation, such as "ring.Merge", hold the parameters of the ring along
+// with the counts of the operation. Operations without a context start root
+// spans.
+type Instrumented struct {
+	*ring.Ring
+
+	tracer   trace.Tracer
+	adds     metric.Int64Counter
+	tests    metric.Int64Counter
+	hits     metric.Int64Counter
+	duration metric.Float64Histogram
+	items    metric.Int64Histogram
+	bytes    metric.Int64Histogram
+}
+
+// Wrap returns the ring instrumented with the tracer and meter providers.
+// Instruments the meter fails to create are reported to otel.Handle, and
+// record nothing.
+func Wrap(r *ring.Ring, tp trace.TracerProvider, mp metric.MeterProvider) *Instrumented {
+	meter := mp.Meter(instrumentationName)
+	fallback := noop.Meter{}
+	counter := func(name, description string) metric.Int64Counter {
+		c, err := meter.Int64Counter(name, metric.WithDescription(description))
+		if err != nil {
+			otel.Handle(err)
+			c, _ = fallback.Int64Counter(name)
+		}
+		return c
+	}
+	histogram := func(name, unit, description string) metric.Int64Histogram {
+		h, err := meter.Int64Histogram(name, metric.WithUnit(unit), metric.WithDescription(description))
+		if err != nil {
+			otel.Handle(err)
+			h, _ = fallback.Int64Histogram(name)
+		}
+		return h
+	}
+	duration, err := meter.Float64Histogram("ring.operation.duration", metric.WithUnit("s"),
+		metric.WithDescription("Duration of traced operations of the ring."))
+	if err != nil {
+		otel.Handle(err)
+		duration, _ = fallback.Float64Histogram("ring.operation.duration")
+	}
+	return &Instrumented{
+		Ring:     r,
+		tracer:   tp.Tracer(instrumentationName),
+		adds:     counter("ring.adds", "Number of data added to the ring."),
+		tests:    counter("ring.tests", "Number of data tested against the ring."),
+		hits:     counter("ring.hits", "Number of data tested and reported present by the ring."),
+		duration: duration,
+		items:    histogram("ring.operation.items", "{item}", "Number of data of batch operations of the ring."),
+		bytes:    histogram("ring.operation.bytes", "By", "Bytes marshaled or unmarshaled by the ring."),
+	}
+}
+
+// operation is a traced operation in progress.
+type operation struct {
+	name  string
+	span  trace.Span
+	start time.Time
+}
+
+// start starts the span of the operation of the name, holding the parameters
+// of the ring.
+func (i *Instrumented) start(ctx context.Context, name string) (context.Context, *operation) {
+	p := i.Parameters()
+	ctx, span := i.tracer.Start(ctx, "ring."+name, trace.WithAttributes(
+		BitsKey.Int64(int64(p.Bits)),
+		HashRoundsKey.Int64(int64(p.HashRounds)),
+	))
+	return ctx, &operation{name: name, span: span, start: time.Now()}
+}
+
+// end ends the span of the operation, recording its error, if any, and its
+// duration.
+func (i *Instrumented) end(ctx context.Context, op *operation, err error) {
+	if err != nil {
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+	op.span.End()
+	i.duration.Record(ctx, time.Since(op.start).Seconds(), metric.WithAttributes(OperationKey.String(op.name)))
+}
+
+// recordItems records the data of a batch operation.
+func (i *Instrumented) recordItems(ctx context.Context, op *operation, n int64) {
+	op.span.SetAttributes(ItemsKey.Int64(n))
+	i.items.Record(ctx, n, metric.WithAttributes(OperationKey.String(op.name)))
+	i.adds.Add(ctx, n)
+}
+
+// recordBytes records the bytes of a marshal or unmarshal.
+func (i *Instrumented) recordBytes(ctx context.Context, op *operation, n int64) {
+	op.span.SetAttributes(BytesKey.Int64(n))
+	i.bytes.Record(ctx, n, metric.WithAttributes(OperationKey.String(op.name)))
+}
+
+// Add adds the data to the ring, counting it.
+func (i *Instrumented) Add(data []byte) {
+	i.Ring.Add(data)
+	i.adds.Add(context.Background(), 1)
+}
+
+// AddString adds the string to the ring, counting it.
+func (i *Instrumented) AddString(s string) {
+	i.Ring.AddString(s)
+	i.adds.Add(context.Background(), 1)
+}
+
+// AddHash adds the data of the digest to the ring, counting it.
+func (i *Instrumented) AddHash(d ring.Digest) {
+	i.Ring.AddHash(d)
+	i.adds.Add(context.Background(), 1)
+}
+
+// Test tests the data against the ring, counting it and any hit.
+func (i *Instrumented) Test(data []byte) bool {
+	return i.countTest(i.Ring.Test(data))
+}
+
+// TestString tests the string against the ring, counting it and any hit.
+func (i *Instrumented) TestString(s string) bool {
+	return i.countTest(i.Ring.TestString(s))
+}
+
+// TestHash tests the data of the digest against the ring, counting it and any
+// hit.
+func (i *Instrumented) TestHash(d ring.Digest) bool {
+	return i.countTest(i.Ring.TestHash(d))
+}
+
+// TestAndAdd tests and adds the data, counting both and any hit.
+func (i *Instrumented) TestAndAdd(data []byte) bool {
+	present := i.Ring.TestAndAdd(data)
+	i.adds.Add(context.Background(), 1)
+	return i.countTest(present)
+}
+
+// countTest counts a test of the result, returning it.
+func (i *Instrumented) countTest(present bool) bool {
+	ctx := context.Background()
+	i.tests.Add(ctx, 1)
+	if present {
+		i.hits.Add(ctx, 1)
+	}
+	return present
+}
+
+// AddBatch adds each data to the ring within a span of ctx.
+func (i *Instrumented) AddBatch(ctx context.Context, data [][]byte) {
+	ctx, op := i.start(ctx, "AddBatch")
+	for _, d := range data {
+		i.Ring.Add(d)
+	}
+	i.recordItems(ctx, op, int64(len(data)))
+	i.end(ctx, op, nil)
+}
+
+// AddFromReader adds the lines of rd to the ring within a span.
+func (i *Instrumented) AddFromReader(rd io.Reader) (int64, error) {
+	ctx, op := i.start(context.Background(), "AddFromReader")
+	n, err := i.Ring.AddFromReader(rd)
+	i.recordItems(ctx, op, n)
+	i.end(ctx, op, err)
+	return n, err
+}
+
+// Merge merges the sent ring into the ring within a span.
+func (i *Instrumented) Merge(m *ring.Ring) error {
+	return i.MergeContext(context.Background(), m)
+}
+
+// MergeContext merges the sent ring into the ring within a span of ctx.
+func (i *Instrumented) MergeContext(ctx context.Context, m *ring.Ring) error {
+	ctx, op := i.start(ctx, "Merge")
+	op.span.SetAttributes(RingsKey.Int(1))
+	err := i.Ring.MergeContext(ctx, m)
+	i.end(ctx, op, err)
+	return err
+}
+
+// MergeAll merges the sent rings into the ring within a span.
+func (i *Instrumented) MergeAll(rings ...*ring.Ring) error {
+	ctx, op := i.start(context.Background(), "MergeAll")
+	op.span.SetAttributes(RingsKey.Int(len(rings)))
+	err := i.Ring.MergeAll(rings...)
+	i.end(ctx, op, err)
+	return err
+}
+
+// MarshalBinary returns the binary form of the ring within a span.
+func (i *Instrumented) MarshalBinary() ([]byte, error) {
+	ctx, op := i.start(context.Background(), "MarshalBinary")
+	data, err := i.Ring.MarshalBinary()
+	i.recordBytes(ctx, op, int64(len(data)))
+	i.end(ctx, op, err)
+	return data, err
+}
+
+// UnmarshalBinary replaces the ring with the binary form within a span. The
+// span holds the parameters of the ring before it is replaced.
+func (i *Instrumented) UnmarshalBinary(data []byte) error {
+	ctx, op := i.start(context.Background(), "UnmarshalBinary")
+	err := i.Ring.UnmarshalBinary(data)
+	i.recordBytes(ctx, op, int64(len(data)))
+	i.end(ctx, op, err)
+	return err
+}
+
+// WriteTo writes the binary form of the ring to w within a span.
+func (i *Instrumented) WriteTo(w io.Writer) (int64, error) {
+	ctx, op := i.start(context.Background(), "WriteTo")
+	n, err := i.Ring.WriteTo(w)
+	i.recordBytes(ctx, op, n)
+	i.end(ctx, op, err)
+	return n, err
+}
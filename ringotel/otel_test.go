@@ -0,0 +1,169 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringotel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringotel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// instrumented returns an instrumented ring of 1000 elements, with the
+// recorder of its spans and the reader of its metrics.
+func instrumented(t *testing.T) (*ringotel.Instrumented, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	r, err := ring.Init(1000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return ringotel.Wrap(r, tp, mp), spans, reader
+}
+
+// collect returns the metrics of the reader by name.
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+// sum returns the value of a counter.
+func sum(t *testing.T, metrics map[string]metricdata.Aggregation, name string) int64 {
+	s, ok := metrics[name].(metricdata.Sum[int64])
+	if !ok || len(s.DataPoints) != 1 {
+		t.Fatalf("%s: unexpected data %#v", name, metrics[name])
+	}
+	return s.DataPoints[0].Value
+}
+
+// histogram returns the data point of a histogram of the operation.
+func histogram(t *testing.T, metrics map[string]metricdata.Aggregation, name, op string) metricdata.HistogramDataPoint[int64] {
+	h, ok := metrics[name].(metricdata.Histogram[int64])
+	if !ok {
+		t.Fatalf("%s: unexpected data %#v", name, metrics[name])
+	}
+	for _, dp := range h.DataPoints {
+		if v, _ := dp.Attributes.Value(ringotel.OperationKey); v.AsString() == op {
+			return dp
+		}
+	}
+	t.Fatalf("%s: no data point of %s", name, op)
+	return metricdata.HistogramDataPoint[int64]{}
+}
+
+// TestCounters ensures Add and Test are counted without spans.
+func TestCounters(t *testing.T) {
+	r, spans, reader := instrumented(t)
+	r.Add([]byte("a"))
+	r.AddString("b")
+	r.Test([]byte("a"))
+	r.TestString("b")
+	r.Test([]byte("c"))
+	r.TestAndAdd([]byte("c"))
+	if len(spans.Ended()) != 0 {
+		t.Fatalf("%d spans, expected none", len(spans.Ended()))
+	}
+	metrics := collect(t, reader)
+	if adds, tests, hits := sum(t, metrics, "ring.adds"), sum(t, metrics, "ring.tests"), sum(t, metrics, "ring.hits"); adds != 3 || tests != 4 || hits != 2 {
+		t.Fatalf("%d adds, %d tests and %d hits, expected 3, 4 and 2", adds, tests, hits)
+	}
+}
+
+// TestSpans ensures batches, merges and marshals are traced with their
+// attributes and measured.
+func TestSpans(t *testing.T) {
+	r, spans, reader := instrumented(t)
+	ctx := context.Background()
+	r.AddBatch(ctx, [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	m, _ := ring.Init(1000, 0.01)
+	m.Add([]byte("d"))
+	if err := r.Merge(m); err != nil {
+		t.Fatal(err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := ring.Init(10, 0.01)
+	if err := r.Merge(other); !errors.Is(err, ring.ErrIncompatible) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !r.Test([]byte("d")) {
+		t.Fatal("expected merged data")
+	}
+
+	p := r.Parameters()
+	ended := spans.Ended()
+	expected := []struct {
+		name  string
+		attrs []attribute.KeyValue
+		code  codes.Code
+	}{
+		{"ring.AddBatch", []attribute.KeyValue{ringotel.ItemsKey.Int64(3)}, codes.Unset},
+		{"ring.Merge", []attribute.KeyValue{ringotel.RingsKey.Int(1)}, codes.Unset},
+		{"ring.MarshalBinary", []attribute.KeyValue{ringotel.BytesKey.Int64(int64(len(data)))}, codes.Unset},
+		{"ring.UnmarshalBinary", []attribute.KeyValue{ringotel.BytesKey.Int64(int64(len(data)))}, codes.Unset},
+		{"ring.Merge", nil, codes.Error},
+	}
+	if len(ended) != len(expected) {
+		t.Fatalf("%d spans, expected %d", len(ended), len(expected))
+	}
+	for i, e := range expected {
+		s := ended[i]
+		if s.Name() != e.name || s.Status().Code != e.code {
+			t.Fatalf("span %d: %s with status %v, expected %s with %v", i, s.Name(), s.Status().Code, e.name, e.code)
+		}
+		attrs := attribute.NewSet(s.Attributes()...)
+		for _, kv := range append(e.attrs, ringotel.BitsKey.Int64(int64(p.Bits)), ringotel.HashRoundsKey.Int64(int64(p.HashRounds))) {
+			if v, ok := attrs.Value(kv.Key); !ok || v != kv.Value {
+				t.Fatalf("span %d: %s is %v, expected %v", i, kv.Key, v.Emit(), kv.Value.Emit())
+			}
+		}
+	}
+
+	metrics := collect(t, reader)
+	if adds := sum(t, metrics, "ring.adds"); adds != 3 {
+		t.Fatalf("%d adds, expected 3", adds)
+	}
+	if dp := histogram(t, metrics, "ring.operation.items", "AddBatch"); dp.Count != 1 || dp.Sum != 3 {
+		t.Fatalf("items of %d batches summing to %d, expected 1 and 3", dp.Count, dp.Sum)
+	}
+	if dp := histogram(t, metrics, "ring.operation.bytes", "MarshalBinary"); dp.Count != 1 || dp.Sum != int64(len(data)) {
+		t.Fatalf("%d marshals of %d bytes, expected 1 of %d", dp.Count, dp.Sum, len(data))
+	}
+	durations, ok := metrics["ring.operation.duration"].(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("unexpected durations %#v", metrics["ring.operation.duration"])
+	}
+	var count uint64
+	for _, dp := range durations.DataPoints {
+		count += dp.Count
+	}
+	if count != uint64(len(expected)) {
+		t.Fatalf("%d durations, expected %d", count, len(expected))
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ringprom exports the Stats of a ring as Prometheus metrics. It is a
+// module of its own, so the ring package does not depend on Prometheus.
+package ringprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tannerryan/ring"
+)
+
+// collector is the prometheus.Collector of a ring.
+type collector struct {
+	ring *ring.Ring
+
+	fill, setBits, items, falsePositive, memory *prometheus.Desc
+	adds, tests, hits                           *prometheus.Desc
+}
+
+// NewCollector returns a collector of the Stats of the ring, with metrics named
+// after name and holding the constant labels:
+//
+//	<name>_fill_ratio                      fraction of active bits
+//	<name>_set_bits                        number of active bits
+//	<name>_estimated_items                 estimated distinct data added
+//	<name>_estimated_false_positive_rate   estimated false positive rate
+//	<name>_memory_bytes                    bytes allocated for the bit array
+//	<name>_adds_total                      data added
+//	<name>_tests_total                     data tested
+//	<name>_hits_total                      data tested and reported present
+//
+// It calls EnableCounters on the ring, and the counters count from then on.
+// Each Collect reads Stats once, so it takes no lock other than a brief read
+// lock for rings using WithOffHeap.
+func NewCollector(name string, r *ring.Ring, labels prometheus.Labels) prometheus.Collector {
+	r.EnableCounters()
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name+"_"+metric, help, nil, labels)
+	}
+	return &collector{
+		ring:          r,
+		fill:          desc("fill_ratio", "Fraction of the bits of the ring that are active."),
+		setBits:       desc("set_bits", "Number of active bits of the ring."),
+		items:         desc("estimated_items", "Estimated number of distinct data added to the ring."),
+		falsePositive: desc("estimated_false_positive_rate", "Estimated false positive rate of tests of the ring."),
+		memory:        desc("memory_bytes", "Bytes allocated for the bit array of the ring."),
+		adds:          desc("adds_total", "Number of data added to the ring."),
+		tests:         desc("tests_total", "Number of data tested against the ring."),
+		hits:          desc("hits_total", "Number of data tested and reported present by the ring."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.fill, c.setBits, c.items, c.falsePositive, c.memory, c.adds, c.tests, c.hits} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.ring.Stats()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v uint64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v))
+	}
+	gauge(c.fill, s.Fill)
+	gauge(c.setBits, float64(s.SetBits))
+	gauge(c.items, s.EstimatedItems)
+	gauge(c.falsePositive, s.FalsePositive)
+	gauge(c.memory, float64(s.MemoryBytes))
+	counter(c.adds, s.Adds)
+	counter(c.tests, s.Tests)
+	counter(c.hits, s.Hits)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringprom_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringprom"
+)
+
+// TestCollector ensures the metrics of a ring have their names, help strings
+// and the values of Stats after scripted traffic.
+func TestCollector(t *testing.T) {
+	r, _ := ring.New(100, 0.01)
+	c := ringprom.NewCollector("ring", r, prometheus.Labels{"filter": "sessions"})
+	for i := 0; i < 50; i++ {
+		r.Add([]byte(fmt.Sprint(i)))
+	}
+	for i := 0; i < 80; i++ {
+		r.Test([]byte(fmt.Sprint(i)))
+	}
+	s := r.Stats()
+	if s.Adds != 50 || s.Tests != 80 || s.Hits < 50 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	want := fmt.Sprintf(`
+# HELP ring_adds_total Number of data added to the ring.
+# TYPE ring_adds_total counter
+ring_adds_total{filter="sessions"} 50
+# HELP ring_estimated_false_positive_rate Estimated false positive rate of tests of the ring.
+# TYPE ring_estimated_false_positive_rate gauge
+ring_estimated_false_positive_rate{filter="sessions"} %v
+# HELP ring_estimated_items Estimated number of distinct data added to the ring.
+# TYPE ring_estimated_items gauge
+ring_estimated_items{filter="sessions"} %v
+# HELP ring_fill_ratio Fraction of the bits of the ring that are active.
+# TYPE ring_fill_ratio gauge
+ring_fill_ratio{filter="sessions"} %v
+# HELP ring_hits_total Number of data tested and reported present by the ring.
+# TYPE ring_hits_total counter
+ring_hits_total{filter="sessions"} %d
+# HELP ring_memory_bytes Bytes allocated for the bit array of the ring.
+# TYPE ring_memory_bytes gauge
+ring_memory_bytes{filter="sessions"} %d
+# HELP ring_set_bits Number of active bits of the ring.
+# TYPE ring_set_bits gauge
+ring_set_bits{filter="sessions"} %d
+# HELP ring_tests_total Number of data tested against the ring.
+# TYPE ring_tests_total counter
+ring_tests_total{filter="sessions"} 80
+`, s.FalsePositive, s.EstimatedItems, s.Fill, s.Hits, s.MemoryBytes, s.SetBits)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c); n != 8 {
+		t.Fatalf("%d metrics, expected 8", n)
+	}
+}
+
+// TestCollectorRegister ensures the collector registers, and that collectors
+// of two rings coexist under different names.
+func TestCollectorRegister(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	a, _ := ring.New(100, 0.01)
+	b, _ := ring.New(100, 0.01)
+	if err := reg.Register(ringprom.NewCollector("a", a, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register(ringprom.NewCollector("b", b, prometheus.Labels{"shard": "1"})); err != nil {
+		t.Fatal(err)
+	}
+	a.Add([]byte("data"))
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 16 {
+		t.Fatalf("%d metric families, expected 16", len(families))
+	}
+	if n, err := testutil.GatherAndCount(reg, "a_adds_total", "b_adds_total"); err != nil || n != 2 {
+		t.Fatalf("%d adds metrics, %v", n, err)
+	}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP a_adds_total Number of data added to the ring.
+# TYPE a_adds_total counter
+a_adds_total 1
+`), "a_adds_total"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ringSetVersion is the marshaled version of a ring set.
+const ringSetVersion = 22
+
+// ErrShards is returned by InitRingSet given no shards.
+var ErrShards = errors.New("error: shards must be greater than 0")
+
+// RingSet distributes data across a number of identically parameterized rings,
+// its shards, routing each data to one shard by its hash. Each shard is an
+// independent Ring with its own lock, so a large filter can be merged,
+// persisted and replicated one shard at a time, and writers to different shards
+// never contend.
+//
+// Data is hashed once: the rounds selecting its bits within a shard also
+// select the shard, with a round beyond those probed.
+type RingSet struct {
+	params         // parameters shared by every shard
+	shards []*Ring // shards, indexed by Shard
+}
+
+// InitRingSet initializes and returns a new ring set of shards rings, or an
+// error. The shards share elements evenly, each sized like Init for its share
+// within the falsePositive rate, with the sent Options.
+func InitRingSet(shards, elements int, falsePositive float64, opts ...Option) (*RingSet, error) {
+	var shardsErr error
+	if shards <= 0 {
+		shardsErr = fmt.Errorf("%w, got %d", ErrShards, shards)
+	}
+	_, err := checkArgs(elements, falsePositive)
+	if err := joinErrors(shardsErr, err); err != nil {
+		return nil, err
+	}
+	s := &RingSet{}
+	for i := 0; i < shards; i++ {
+		r, err := Init((elements+shards-1)/shards, falsePositive, opts...)
+		if err != nil {
+			return nil, err
+		}
+		s.shards = append(s.shards, r)
+	}
+	s.params = s.shards[0].set.Load().params
+	return s, nil
+}
+
+// route returns the hash rounds of data with the shard it is routed to.
+func (s *RingSet) route(data []byte) (rounds, int) {
+	hash := s.rounds(data)
+	// scale the round rather than dividing
+	shard := (hash.at(s.hash) >> 32) * uint64(len(s.shards)) >> 32
+	return hash, int(shard)
+}
+
+// Shard returns the index of the shard the data is routed to.
+func (s *RingSet) Shard(data []byte) int {
+	_, shard := s.route(data)
+	return shard
+}
+
+// Shards returns the number of shards.
+func (s *RingSet) Shards() int {
+	return len(s.shards)
+}
+
+// ShardRing returns the i-th shard, which may be used directly, for example to
+// persist or replicate it on its own. Data must only be added to a shard
+// through the set, or it will not be found.
+func (s *RingSet) ShardRing(i int) *Ring {
+	return s.shards[i]
+}
+
+// Add adds the data to its shard.
+func (s *RingSet) Add(data []byte) {
+	hash, shard := s.route(data)
+	// the parameters of a shard only change by UnmarshalBinary of the set,
+	// which replaces the shard
+	_ = s.shards[shard].addHashed(s.params, &hash)
+}
+
+// Test returns a bool if the data is in its shard. True indicates that the
+// data may be in the set, while false indicates that the data is not in the
+// set.
+func (s *RingSet) Test(data []byte) bool {
+	var buf [32]uint64
+	hash, shard := s.route(data)
+	return s.shards[shard].testIndices(s.params, s.indices(&hash, buf[:0]))
+}
+
+// Reset clears every shard.
+func (s *RingSet) Reset() {
+	for _, r := range s.shards {
+		r.Reset()
+	}
+}
+
+// Merge merges each shard of the sent RingSet into the same shard of its own,
+// in parallel. The sets must have the same number of shards and parameters,
+// which is validated before any shard is merged. A failed merge of one shard
+// does not undo the others.
+func (s *RingSet) Merge(m *RingSet) error {
+	if s == nil || m == nil {
+		return ErrNilRing
+	}
+	if s == m {
+		return nil
+	}
+	if err := s.compatible(m.params); err != nil {
+		return err
+	}
+	if len(s.shards) != len(m.shards) {
+		return &IncompatibleError{"shards", uint64(len(s.shards)), uint64(len(m.shards))}
+	}
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i := range s.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.shards[i].Merge(m.shards[i])
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The shards
+// are marshaled in parallel and stored in order, each prefixed by its length,
+// in the format of Ring.MarshalBinary.
+func (s *RingSet) MarshalBinary() ([]byte, error) {
+	shards := make([][]byte, len(s.shards))
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i := range s.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shards[i], errs[i] = s.shards[i].MarshalBinary()
+		}(i)
+	}
+	wg.Wait()
+	length := 5
+	for i, data := range shards {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		length += 8 + len(data)
+	}
+	out := make([]byte, 5, length)
+	out[0] = ringSetVersion
+	binary.BigEndian.PutUint32(out[1:5], uint32(len(shards)))
+	for _, data := range shards {
+		out = binary.BigEndian.AppendUint64(out, uint64(len(data)))
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. Every
+// shard must have the same parameters. It must not be called concurrently with
+// other methods.
+func (s *RingSet) UnmarshalBinary(data []byte) error {
+	if len(data) < 5 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != ringSetVersion {
+		return versionError(data[0])
+	}
+	count := binary.BigEndian.Uint32(data[1:5])
+	if count == 0 {
+		return ErrShards
+	}
+	data = data[5:]
+	var shards []*Ring
+	for i := uint32(0); i < count; i++ {
+		if len(data) < 8 {
+			return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+		}
+		length := binary.BigEndian.Uint64(data[0:8])
+		data = data[8:]
+		if length > uint64(len(data)) {
+			return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+		}
+		r := &Ring{}
+		if err := r.UnmarshalBinary(data[:length]); err != nil {
+			return err
+		}
+		shards = append(shards, r)
+		data = data[length:]
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, len(data))
+	}
+	p, err := commonParams(shards)
+	if err != nil {
+		return err
+	}
+	s.params, s.shards = p, shards
+	return nil
+}
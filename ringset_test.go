@@ -0,0 +1,154 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// BenchmarkRingSetAdd tests adding elements to a 16-shard RingSet.
+func BenchmarkRingSetAdd(b *testing.B) {
+	s, _ := ring.InitRingSet(16, tests, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		s.Add(buff)
+	}
+}
+
+// TestRingSetEquivalence ensures a RingSet answers like a single ring of the
+// same capacity: no false negatives, and a false positive rate within the
+// target.
+func TestRingSetEquivalence(t *testing.T) {
+	const n, probes = 200000, 1000000
+	s, _ := ring.InitRingSet(8, n, fpRate)
+	r, _ := ring.Init(n, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		s.Add(buff)
+		r.Add(buff)
+	}
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		if !s.Test(buff) || !r.Test(buff) {
+			t.Fatalf("data %d missing", i)
+		}
+	}
+	setFP, ringFP := 0, 0
+	for i := n; i < n+probes; i++ {
+		intToByte(buff, i)
+		if s.Test(buff) {
+			setFP++
+		}
+		if r.Test(buff) {
+			ringFP++
+		}
+	}
+	if rate := float64(setFP) / probes; rate > fpRate*1.2 {
+		t.Fatalf("false positive rate %f, single ring %f", rate, float64(ringFP)/probes)
+	}
+}
+
+// TestRingSetBalance ensures random data is spread evenly across the shards,
+// within 5 standard deviations of a uniform split.
+func TestRingSetBalance(t *testing.T) {
+	const n, shards = 1000000, 16
+	s, _ := ring.InitRingSet(shards, n, fpRate)
+	counts := make([]int, shards)
+	rnd := rand.New(rand.NewSource(1))
+	token := make([]byte, 16)
+	for i := 0; i < n; i++ {
+		rnd.Read(token)
+		counts[s.Shard(token)]++
+	}
+	mean := float64(n) / shards
+	deviation := math.Sqrt(mean * (1 - 1.0/shards))
+	for i, c := range counts {
+		if math.Abs(float64(c)-mean) > 5*deviation {
+			t.Fatalf("shard %d holds %d of %d, expected %.0f", i, c, n, mean)
+		}
+	}
+	if s.Shards() != shards {
+		t.Fatalf("%d shards", s.Shards())
+	}
+}
+
+func TestRingSetMergeMarshal(t *testing.T) {
+	s, _ := ring.InitRingSet(4, 10000, fpRate, ring.WithPowerOfTwoSize())
+	m, _ := ring.InitRingSet(4, 10000, fpRate, ring.WithPowerOfTwoSize())
+	buff := make([]byte, 4)
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		if i%2 == 0 {
+			s.Add(buff)
+		} else {
+			m.Add(buff)
+		}
+	}
+	if err := s.Merge(m); err != nil {
+		t.Fatal(err)
+	}
+	other, _ := ring.InitRingSet(4, 10000, fpRate)
+	fewer, _ := ring.InitRingSet(2, 5000, fpRate, ring.WithPowerOfTwoSize())
+	if s.Merge(other) == nil || s.Merge(fewer) == nil || s.Merge(nil) == nil || s.Merge(s) != nil {
+		t.Fatal("unexpected Merge result")
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s2 ring.RingSet
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		if !s2.Test(buff) {
+			t.Fatalf("data %d missing after Merge and UnmarshalBinary", i)
+		}
+	}
+	if data2, _ := s2.MarshalBinary(); !bytes.Equal(data, data2) {
+		t.Fatal("marshaled data changed")
+	}
+
+	// a shard persisted on its own restores into its place
+	intToByte(buff, 3)
+	shard, _ := s.ShardRing(s.Shard(buff)).MarshalBinary()
+	s.Reset()
+	if err := s.ShardRing(s.Shard(buff)).UnmarshalBinary(shard); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Test(buff) {
+		t.Fatal("data missing after restoring its shard")
+	}
+
+	// shards with different parameters are rejected
+	spliced := []byte{22, 0, 0, 0, 2}
+	for _, elements := range []int{10000, 100} {
+		r, _ := ring.Init(elements, fpRate)
+		shard, _ := r.MarshalBinary()
+		spliced = binary.BigEndian.AppendUint64(spliced, uint64(len(shard)))
+		spliced = append(spliced, shard...)
+	}
+	if s2.UnmarshalBinary(spliced[:len(spliced)-1]) == nil || s2.UnmarshalBinary(spliced) == nil {
+		t.Fatal("mismatched shards not captured")
+	}
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 4, 5, len(data) - 1} {
+		if s2.UnmarshalBinary(data[:n]) == nil {
+			t.Fatalf("truncation to %d bytes not captured", n)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ringstore checkpoints rings to object storage, such as S3, as
+// numbered chunks written through a ChunkStore the caller implements, so it
+// depends on no cloud SDK. A manifest listing the checksum of every chunk is
+// written last, and a checkpoint cut short by a failure is resumed by saving
+// it again: chunks already stored are skipped. Load verifies every chunk
+// before unmarshaling.
+package ringstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tannerryan/ring"
+)
+
+const (
+	// DefaultChunkSize is the size of the chunks of Save without
+	// WithChunkSize.
+	DefaultChunkSize = 64 << 20
+	// manifestName is the name of the manifest within a checkpoint.
+	manifestName = "manifest"
+)
+
+var (
+	// ErrChecksum is returned by Load given a chunk whose size or checksum
+	// differs from the manifest.
+	ErrChecksum = errors.New("error: chunk does not match the manifest")
+	// ErrManifest is returned by Load given a manifest that is not valid.
+	ErrManifest = errors.New("error: invalid manifest")
+)
+
+// ChunkStore stores the chunks of checkpoints, such as objects of a bucket.
+// Names are paths of the checkpoint name and the chunk, separated by "/".
+type ChunkStore interface {
+	// PutChunk stores the chunk of the name, read from r, replacing any of
+	// the same name. A chunk must be stored whole or not at all, as a put of
+	// an object is.
+	PutChunk(ctx context.Context, name string, r io.Reader) error
+	// GetChunk returns a reader of the chunk of the name.
+	GetChunk(ctx context.Context, name string) (io.ReadCloser, error)
+	// ListChunks returns the names of the chunks stored beginning with the
+	// prefix, in any order.
+	ListChunks(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Manifest describes a checkpoint, listing its chunks in order.
+type Manifest struct {
+	Size      int64   `json:"size"`      // total length of the chunks
+	ChunkSize int     `json:"chunkSize"` // length of every chunk but the last
+	Chunks    []Chunk `json:"chunks"`    // chunks, in order
+}
+
+// Chunk describes a chunk of a checkpoint.
+type Chunk struct {
+	Name   string `json:"name"`   // name of the chunk within the store
+	Size   int    `json:"size"`   // length of the chunk
+	SHA256 string `json:"sha256"` // hex SHA-256 of the chunk
+}
+
+// Option configures Save.
+type Option func(*options)
+
+// options holds the configuration collected from Options.
+type options struct {
+	chunkSize int
+}
+
+// WithChunkSize sets the size of the chunks, by default 64MB. Each chunk is
+// held in memory while it is stored.
+func WithChunkSize(size int) Option {
+	return func(o *options) {
+		o.chunkSize = size
+	}
+}
+
+// chunkName returns the name of the chunk of the index and checksum. Naming
+// chunks by their checksum lets a resumed Save tell which are stored whole.
+func chunkName(name string, index int, sum string) string {
+	return fmt.Sprintf("%s/%08d-%s", name, index, sum)
+}
+
+// Save stores the data of src as a checkpoint of the name, in chunks written
+// through s, followed by the manifest, which it returns. If s holds chunks of
+// the name already, from a Save that failed or of an earlier checkpoint,
+// chunks of the same index and checksum are not stored again, so a failed Save
+// is resumed by calling it again with the same data: only the chunks after
+// the failure are stored. Chunks of earlier checkpoints that are no longer
+// listed by the manifest are left in s.
+//
+// A checkpoint is only loaded by Load once its manifest is stored, so a Save
+// that failed leaves any earlier checkpoint of the name loadable until the new
+// manifest replaces it.
+func Save(ctx context.Context, s ChunkStore, name string, src io.Reader, opts ...Option) (*Manifest, error) {
+	o := options{chunkSize: DefaultChunkSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.chunkSize <= 0 {
+		return nil, fmt.Errorf("%w: WithChunkSize(%d) is not positive", ring.ErrOptions, o.chunkSize)
+	}
+	listed, err := s.ListChunks(ctx, name+"/")
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool, len(listed))
+	for _, n := range listed {
+		stored[n] = true
+	}
+	m := &Manifest{ChunkSize: o.chunkSize}
+	buf := make([]byte, o.chunkSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(src, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		sum := sha256.Sum256(buf[:n])
+		c := Chunk{Size: n, SHA256: hex.EncodeToString(sum[:])}
+		c.Name = chunkName(name, index, c.SHA256)
+		if !stored[c.Name] {
+			if err := s.PutChunk(ctx, c.Name, bytes.NewReader(buf[:n])); err != nil {
+				return nil, fmt.Errorf("chunk %d: %w", index, err)
+			}
+		}
+		m.Chunks = append(m.Chunks, c)
+		m.Size += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.PutChunk(ctx, name+"/"+manifestName, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SaveRing stores the binary form of the ring as a checkpoint of the name, as
+// by Save. The ring is written as by WriteTo, holding its read lock until
+// every chunk is stored, so writers wait for the store. To write while saving,
+// pass Save a bytes.Reader of MarshalBinary instead.
+func SaveRing(ctx context.Context, s ChunkStore, name string, r *ring.Ring, opts ...Option) (*Manifest, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := r.WriteTo(pw)
+		pw.CloseWithError(err)
+	}()
+	m, err := Save(ctx, s, name, pr, opts...)
+	// unblock WriteTo if Save returned early
+	pr.CloseWithError(io.ErrClosedPipe)
+	return m, err
+}
+
+// LoadManifest returns the manifest of the checkpoint of the name.
+func LoadManifest(ctx context.Context, s ChunkStore, name string) (*Manifest, error) {
+	rc, err := s.GetChunk(ctx, name+"/"+manifestName)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var m Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrManifest, err)
+	}
+	var size int64
+	for i, c := range m.Chunks {
+		if c.Size <= 0 || c.Size > m.ChunkSize || (c.Size < m.ChunkSize && i != len(m.Chunks)-1) ||
+			!strings.HasPrefix(c.Name, name+"/") {
+			return nil, fmt.Errorf("%w: chunk %d", ErrManifest, i)
+		}
+		size += int64(c.Size)
+	}
+	if size != m.Size {
+		return nil, fmt.Errorf("%w: chunks hold %d bytes, expected %d", ErrManifest, size, m.Size)
+	}
+	return &m, nil
+}
+
+// Load reads the checkpoint of the name from s, verifying the size and
+// checksum of every chunk against the manifest, and unmarshals it into dst,
+// such as a *ring.Ring. A chunk that does not match returns an error matching
+// ErrChecksum without calling UnmarshalBinary.
+func Load(ctx context.Context, s ChunkStore, name string, dst encoding.BinaryUnmarshaler) error {
+	m, err := LoadManifest(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 0, m.Size)
+	for i, c := range m.Chunks {
+		if data, err = loadChunk(ctx, s, c, data); err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+	}
+	return dst.UnmarshalBinary(data)
+}
+
+// loadChunk appends the chunk to data, verifying it.
+func loadChunk(ctx context.Context, s ChunkStore, c Chunk, data []byte) ([]byte, error) {
+	rc, err := s.GetChunk(ctx, c.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	start := len(data)
+	buf := bytes.NewBuffer(data)
+	// one byte more than expected reveals longer chunks
+	if _, err := buf.ReadFrom(io.LimitReader(rc, int64(c.Size)+1)); err != nil {
+		return nil, err
+	}
+	data = buf.Bytes()
+	if len(data)-start != c.Size {
+		return nil, fmt.Errorf("%w: %d bytes, expected %d", ErrChecksum, len(data)-start, c.Size)
+	}
+	if sum := sha256.Sum256(data[start:]); hex.EncodeToString(sum[:]) != c.SHA256 {
+		return nil, fmt.Errorf("%w: checksum %x, expected %s", ErrChecksum, sum, c.SHA256)
+	}
+	return data, nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringstore"
+)
+
+// errInjected is the failure of the memory store.
+var errInjected = errors.New("injected failure")
+
+// memStore is a ChunkStore in memory, failing the put after failAfter
+// successful puts, if failAfter is not negative.
+type memStore struct {
+	mutex     sync.Mutex
+	chunks    map[string][]byte
+	puts      int
+	failAfter int
+}
+
+func newMemStore() *memStore {
+	return &memStore{chunks: make(map[string][]byte), failAfter: -1}
+}
+
+func (s *memStore) PutChunk(ctx context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failAfter == 0 {
+		s.failAfter = -1
+		return errInjected
+	}
+	if s.failAfter > 0 {
+		s.failAfter--
+	}
+	s.puts++
+	s.chunks[name] = data
+	return nil
+}
+
+func (s *memStore) GetChunk(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.chunks[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memStore) ListChunks(ctx context.Context, prefix string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var names []string
+	for name := range s.chunks {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// filledRing returns a ring holding n elements.
+func filledRing(t *testing.T, n int) *ring.Ring {
+	r, err := ring.Init(n, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		r.Add([]byte{byte(i), byte(i >> 8), byte(i >> 16)})
+	}
+	return r
+}
+
+// TestSaveLoad ensures a ring survives a checkpoint.
+func TestSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	r := filledRing(t, 10000)
+	s := newMemStore()
+	m, err := ringstore.SaveRing(ctx, s, "ckpt", r, ringstore.WithChunkSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != int64(r.MarshaledSize()) || len(m.Chunks) != (r.MarshaledSize()+999)/1000 {
+		t.Fatalf("unexpected manifest of %d bytes in %d chunks", m.Size, len(m.Chunks))
+	}
+	loaded := &ring.Ring{}
+	if err := ringstore.Load(ctx, s, "ckpt", loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(r) {
+		t.Fatal("loaded ring differs")
+	}
+}
+
+// TestSaveResume ensures a Save failing mid-upload is resumed without storing
+// the chunks stored before the failure again.
+func TestSaveResume(t *testing.T) {
+	ctx := context.Background()
+	r := filledRing(t, 10000)
+	data, _ := r.MarshalBinary()
+	chunks := (len(data) + 999) / 1000
+	s := newMemStore()
+	s.failAfter = 5
+	if _, err := ringstore.Save(ctx, s, "ckpt", bytes.NewReader(data), ringstore.WithChunkSize(1000)); !errors.Is(err, errInjected) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := ringstore.Load(ctx, s, "ckpt", &ring.Ring{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error loading a failed checkpoint %v", err)
+	}
+	s.puts = 0
+	if _, err := ringstore.Save(ctx, s, "ckpt", bytes.NewReader(data), ringstore.WithChunkSize(1000)); err != nil {
+		t.Fatal(err)
+	}
+	// the remaining chunks and the manifest
+	if s.puts != chunks-5+1 {
+		t.Fatalf("resume stored %d chunks, expected %d", s.puts, chunks-5+1)
+	}
+	loaded := &ring.Ring{}
+	if err := ringstore.Load(ctx, s, "ckpt", loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(r) {
+		t.Fatal("loaded ring differs")
+	}
+
+	// a changed ring stores only the chunks that changed
+	r.Add([]byte("changed"))
+	s.puts = 0
+	if _, err := ringstore.SaveRing(ctx, s, "ckpt", r, ringstore.WithChunkSize(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if s.puts > 1+int(r.Stats().HashRounds) {
+		t.Fatalf("changed ring stored %d chunks", s.puts)
+	}
+	if err := ringstore.Load(ctx, s, "ckpt", loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(r) {
+		t.Fatal("loaded ring differs")
+	}
+}
+
+// TestLoadCorrupt ensures chunks differing from the manifest are rejected
+// before unmarshaling.
+func TestLoadCorrupt(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	m, err := ringstore.SaveRing(ctx, s, "ckpt", filledRing(t, 1000), ringstore.WithChunkSize(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := m.Chunks[1].Name
+	good := s.chunks[name]
+	for _, bad := range [][]byte{
+		append(append([]byte{}, good[:50]...), good[50]^1),
+		good[:50],
+		append(append([]byte{}, good...), 0),
+	} {
+		s.chunks[name] = bad
+		if err := ringstore.Load(ctx, s, "ckpt", &ring.Ring{}); !errors.Is(err, ringstore.ErrChecksum) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	s.chunks["ckpt/manifest"] = []byte("{")
+	if err := ringstore.Load(ctx, s, "ckpt", &ring.Ring{}); !errors.Is(err, ringstore.ErrManifest) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestSaveRingUninitialized ensures the error of WriteTo is returned.
+func TestSaveRingUninitialized(t *testing.T) {
+	if _, err := ringstore.SaveRing(context.Background(), newMemStore(), "ckpt", &ring.Ring{}); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
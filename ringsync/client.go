@@ -0,0 +1,124 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringsync/ringsyncpb"
+	"google.golang.org/grpc"
+)
+
+// ErrProtocol is returned by a Client given chunks inconsistent with each other
+// or with the state it holds.
+var ErrProtocol = errors.New("ringsync: invalid chunks")
+
+// Client keeps a replica of the ring of a Server. It holds the binary form of
+// the last state it synced, so each Sync after the first fetches only the
+// parts of the ring that changed since. A Client keeps a single replica, and
+// is not safe for concurrent use.
+type Client struct {
+	rpc     ringsyncpb.RingSyncClient
+	data    []byte // binary form of the last state synced, nil before
+	version uint64 // version of the last state synced
+}
+
+// NewClient returns a Client of the RingSync service on the connection.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{rpc: ringsyncpb.NewRingSyncClient(cc)}
+}
+
+// Version returns the version of the ring of the server last synced, or 0
+// before the first Sync.
+func (c *Client) Version() uint64 {
+	return c.version
+}
+
+// Sync brings the replica up to date with the ring of the server, replacing its
+// bits and parameters with those of the server by UnmarshalBinary. The replica
+// should not be written otherwise, as the next Sync may only fetch the parts
+// of the ring the server changed. On error, the replica is left unchanged.
+func (c *Client) Sync(ctx context.Context, replica *ring.Ring) error {
+	var stream interface {
+		Recv() (*ringsyncpb.Chunk, error)
+	}
+	var err error
+	if c.data == nil {
+		stream, err = c.rpc.GetSnapshot(ctx, &ringsyncpb.SnapshotRequest{})
+	} else {
+		stream, err = c.rpc.GetDelta(ctx, &ringsyncpb.DeltaRequest{SinceVersion: c.version})
+	}
+	if err != nil {
+		return err
+	}
+	var data []byte
+	var first *ringsyncpb.Chunk
+	received := uint64(0)
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = chunk
+			switch {
+			case chunk.Full && chunk.Total <= uint64(maxInt):
+				data = make([]byte, chunk.Total)
+			case !chunk.Full && c.data != nil && chunk.Total == uint64(len(c.data)):
+				data = append([]byte(nil), c.data...)
+			default:
+				return fmt.Errorf("%w: stream of %d bytes", ErrProtocol, chunk.Total)
+			}
+		}
+		if chunk.Version != first.Version || chunk.Total != first.Total || chunk.Full != first.Full ||
+			chunk.Offset > chunk.Total || uint64(len(chunk.Data)) > chunk.Total-chunk.Offset ||
+			chunk.Full && chunk.Offset != received {
+			return fmt.Errorf("%w: chunk at %d inconsistent with the stream", ErrProtocol, chunk.Offset)
+		}
+		copy(data[chunk.Offset:], chunk.Data)
+		received += uint64(len(chunk.Data))
+	}
+	if first == nil || first.Full && received != first.Total {
+		return fmt.Errorf("%w: %d bytes received", ErrProtocol, received)
+	}
+	if err := replica.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	c.data, c.version = data, first.Version
+	return nil
+}
+
+// PushMerge merges the ring into the ring of the server, which must have the
+// same parameters, returning the version of the ring of the server after the
+// merge.
+func (c *Client) PushMerge(ctx context.Context, r *ring.Ring) (uint64, error) {
+	data, _, err := r.MarshalBinaryVersion()
+	if err != nil {
+		return 0, err
+	}
+	stream, err := c.rpc.PushMerge(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := sendFull(stream, state{data: data}); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	// a server rejecting the push reports its error here, ending the stream
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return 0, err
+	}
+	return resp.Version, nil
+}
+
+// maxInt is the largest int.
+const maxInt = int(^uint(0) >> 1)
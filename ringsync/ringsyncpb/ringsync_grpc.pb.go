@@ -0,0 +1,285 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: ringsync.proto
+
+package ringsyncpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	RingSync_GetSnapshot_FullMethodName = "/ringsync.v1.RingSync/GetSnapshot"
+	RingSync_GetDelta_FullMethodName    = "/ringsync.v1.RingSync/GetDelta"
+	RingSync_PushMerge_FullMethodName   = "/ringsync.v1.RingSync/PushMerge"
+)
+
+// RingSyncClient is the client API for RingSync service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RingSyncClient interface {
+	// GetSnapshot streams the whole binary form of the ring.
+	GetSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (RingSync_GetSnapshotClient, error)
+	// GetDelta streams the parts of the binary form that changed since a
+	// version, or the whole binary form if the server no longer holds it.
+	GetDelta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (RingSync_GetDeltaClient, error)
+	// PushMerge merges the ring whose binary form is streamed into the ring of
+	// the server.
+	PushMerge(ctx context.Context, opts ...grpc.CallOption) (RingSync_PushMergeClient, error)
+}
+
+type ringSyncClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRingSyncClient(cc grpc.ClientConnInterface) RingSyncClient {
+	return &ringSyncClient{cc}
+}
+
+func (c *ringSyncClient) GetSnapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (RingSync_GetSnapshotClient, error) {
+	stream, err := c.cc.NewStream(ctx, &RingSync_ServiceDesc.Streams[0], RingSync_GetSnapshot_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ringSyncGetSnapshotClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RingSync_GetSnapshotClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type ringSyncGetSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (x *ringSyncGetSnapshotClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *ringSyncClient) GetDelta(ctx context.Context, in *DeltaRequest, opts ...grpc.CallOption) (RingSync_GetDeltaClient, error) {
+	stream, err := c.cc.NewStream(ctx, &RingSync_ServiceDesc.Streams[1], RingSync_GetDelta_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ringSyncGetDeltaClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RingSync_GetDeltaClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type ringSyncGetDeltaClient struct {
+	grpc.ClientStream
+}
+
+func (x *ringSyncGetDeltaClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *ringSyncClient) PushMerge(ctx context.Context, opts ...grpc.CallOption) (RingSync_PushMergeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &RingSync_ServiceDesc.Streams[2], RingSync_PushMerge_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ringSyncPushMergeClient{stream}
+	return x, nil
+}
+
+type RingSync_PushMergeClient interface {
+	Send(*Chunk) error
+	CloseAndRecv() (*PushMergeResponse, error)
+	grpc.ClientStream
+}
+
+type ringSyncPushMergeClient struct {
+	grpc.ClientStream
+}
+
+func (x *ringSyncPushMergeClient) Send(m *Chunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ringSyncPushMergeClient) CloseAndRecv() (*PushMergeResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PushMergeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RingSyncServer is the server API for RingSync service.
+// All implementations must embed UnimplementedRingSyncServer
+// for forward compatibility
+type RingSyncServer interface {
+	// GetSnapshot streams the whole binary form of the ring.
+	GetSnapshot(*SnapshotRequest, RingSync_GetSnapshotServer) error
+	// GetDelta streams the parts of the binary form that changed since a
+	// version, or the whole binary form if the server no longer holds it.
+	GetDelta(*DeltaRequest, RingSync_GetDeltaServer) error
+	// PushMerge merges the ring whose binary form is streamed into the ring of
+	// the server.
+	PushMerge(RingSync_PushMergeServer) error
+	mustEmbedUnimplementedRingSyncServer()
+}
+
+// UnimplementedRingSyncServer must be embedded to have forward compatible implementations.
+type UnimplementedRingSyncServer struct {
+}
+
+func (UnimplementedRingSyncServer) GetSnapshot(*SnapshotRequest, RingSync_GetSnapshotServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetSnapshot not implemented")
+}
+func (UnimplementedRingSyncServer) GetDelta(*DeltaRequest, RingSync_GetDeltaServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetDelta not implemented")
+}
+func (UnimplementedRingSyncServer) PushMerge(RingSync_PushMergeServer) error {
+	return status.Errorf(codes.Unimplemented, "method PushMerge not implemented")
+}
+func (UnimplementedRingSyncServer) mustEmbedUnimplementedRingSyncServer() {}
+
+// UnsafeRingSyncServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RingSyncServer will
+// result in compilation errors.
+type UnsafeRingSyncServer interface {
+	mustEmbedUnimplementedRingSyncServer()
+}
+
+func RegisterRingSyncServer(s grpc.ServiceRegistrar, srv RingSyncServer) {
+	s.RegisterService(&RingSync_ServiceDesc, srv)
+}
+
+func _RingSync_GetSnapshot_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SnapshotRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RingSyncServer).GetSnapshot(m, &ringSyncGetSnapshotServer{stream})
+}
+
+type RingSync_GetSnapshotServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type ringSyncGetSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (x *ringSyncGetSnapshotServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RingSync_GetDelta_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DeltaRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RingSyncServer).GetDelta(m, &ringSyncGetDeltaServer{stream})
+}
+
+type RingSync_GetDeltaServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type ringSyncGetDeltaServer struct {
+	grpc.ServerStream
+}
+
+func (x *ringSyncGetDeltaServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RingSync_PushMerge_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RingSyncServer).PushMerge(&ringSyncPushMergeServer{stream})
+}
+
+type RingSync_PushMergeServer interface {
+	SendAndClose(*PushMergeResponse) error
+	Recv() (*Chunk, error)
+	grpc.ServerStream
+}
+
+type ringSyncPushMergeServer struct {
+	grpc.ServerStream
+}
+
+func (x *ringSyncPushMergeServer) SendAndClose(m *PushMergeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ringSyncPushMergeServer) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RingSync_ServiceDesc is the grpc.ServiceDesc for RingSync service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RingSync_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ringsync.v1.RingSync",
+	HandlerType: (*RingSyncServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetSnapshot",
+			Handler:       _RingSync_GetSnapshot_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetDelta",
+			Handler:       _RingSync_GetDelta_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PushMerge",
+			Handler:       _RingSync_PushMerge_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ringsync.proto",
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ringsync replicates rings over gRPC, with the RingSync service of
+// ringsyncpb. A Server serves a ring; a Client keeps a replica of it up to
+// date, fetching only the parts of the ring that changed since its last Sync,
+// and pushes rings to be merged into it. It is a module of its own, so the
+// ring package does not depend on gRPC.
+package ringsync
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringsync/ringsyncpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ChunkSize is the largest number of bytes of a ring sent in one Chunk.
+	ChunkSize = 64 << 10
+	// DefaultHistory is the number of states of its ring a Server retains by
+	// default, to serve deltas since them.
+	DefaultHistory = 4
+	// segmentSize is the granularity of deltas, in bytes of the binary form.
+	segmentSize = 1 << 10
+)
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithHistory sets the number of states of its ring a Server retains, to serve
+// deltas since them. Each state costs the memory of the binary form of the
+// ring. Deltas since older states are served as whole snapshots.
+func WithHistory(n int) ServerOption {
+	return func(s *Server) {
+		s.history = n
+	}
+}
+
+// Server implements the RingSync service for a ring. Snapshots are taken under
+// the read lock of the ring, and streamed once it is released; streams are
+// sent at the pace of the client, as gRPC flow control blocks Send while the
+// client is behind.
+type Server struct {
+	ringsyncpb.UnimplementedRingSyncServer
+
+	ring    *ring.Ring
+	history int
+
+	mutex  sync.Mutex
+	states []state // states served, oldest first
+}
+
+// state is a version of the ring, and its binary form.
+type state struct {
+	version uint64
+	data    []byte
+}
+
+// NewServer returns a Server of the ring.
+func NewServer(r *ring.Ring, opts ...ServerOption) *Server {
+	s := &Server{ring: r, history: DefaultHistory}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// snapshot returns the current state of the ring, retaining it for deltas.
+func (s *Server) snapshot() (state, error) {
+	data, version, err := s.ring.MarshalBinaryVersion()
+	if err != nil {
+		return state{}, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	st := state{version, data}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if n := len(s.states); n != 0 && s.states[n-1].version == version {
+		return s.states[n-1], nil
+	}
+	s.states = append(s.states, st)
+	if len(s.states) > s.history {
+		s.states = append(s.states[:0], s.states[len(s.states)-s.history:]...)
+	}
+	return st, nil
+}
+
+// retained returns the binary form of the version, or nil if it is not
+// retained.
+func (s *Server) retained(version uint64) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, st := range s.states {
+		if st.version == version {
+			return st.data
+		}
+	}
+	return nil
+}
+
+// GetSnapshot implements ringsyncpb.RingSyncServer.
+func (s *Server) GetSnapshot(req *ringsyncpb.SnapshotRequest, stream ringsyncpb.RingSync_GetSnapshotServer) error {
+	st, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	return sendFull(stream, st)
+}
+
+// GetDelta implements ringsyncpb.RingSyncServer. Each chunk of a delta
+// replaces a run of changed segments of the binary form.
+func (s *Server) GetDelta(req *ringsyncpb.DeltaRequest, stream ringsyncpb.RingSync_GetDeltaServer) error {
+	st, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	base := s.retained(req.SinceVersion)
+	if len(base) != len(st.data) {
+		// not retained, or replaced by a ring of other parameters
+		return sendFull(stream, st)
+	}
+	sent := false
+	for offset := nextChange(st.data, base, 0); offset < len(st.data); offset = nextChange(st.data, base, offset) {
+		// the run extends over consecutive changed segments, up to ChunkSize
+		end := segmentEnd(offset, len(st.data))
+		for end < len(st.data) && end-offset < ChunkSize {
+			next := segmentEnd(end, len(st.data))
+			if bytes.Equal(st.data[end:next], base[end:next]) {
+				break
+			}
+			end = next
+		}
+		if err := stream.Send(&ringsyncpb.Chunk{
+			Version: st.version,
+			Total:   uint64(len(st.data)),
+			Offset:  uint64(offset),
+			Data:    st.data[offset:end],
+		}); err != nil {
+			return err
+		}
+		sent = true
+		offset = end
+	}
+	if !sent {
+		// the version still travels when nothing changed
+		return stream.Send(&ringsyncpb.Chunk{Version: st.version, Total: uint64(len(st.data))})
+	}
+	return nil
+}
+
+// nextChange returns the offset of the first segment from offset in which data
+// and base differ, or the length of data.
+func nextChange(data, base []byte, offset int) int {
+	for ; offset < len(data); offset = segmentEnd(offset, len(data)) {
+		end := segmentEnd(offset, len(data))
+		if !bytes.Equal(data[offset:end], base[offset:end]) {
+			return offset
+		}
+	}
+	return len(data)
+}
+
+// segmentEnd returns the end of the segment from offset, in data of length n.
+func segmentEnd(offset, n int) int {
+	if offset+segmentSize > n {
+		return n
+	}
+	return offset + segmentSize
+}
+
+// chunkSender is a stream of chunks.
+type chunkSender interface {
+	Send(*ringsyncpb.Chunk) error
+}
+
+// sendFull sends the whole binary form of the state, in order.
+func sendFull(stream chunkSender, st state) error {
+	offset := 0
+	for {
+		end := offset + ChunkSize
+		if end > len(st.data) {
+			end = len(st.data)
+		}
+		if err := stream.Send(&ringsyncpb.Chunk{
+			Version: st.version,
+			Total:   uint64(len(st.data)),
+			Full:    true,
+			Offset:  uint64(offset),
+			Data:    st.data[offset:end],
+		}); err != nil {
+			return err
+		}
+		if offset = end; offset == len(st.data) {
+			return nil
+		}
+	}
+}
+
+// PushMerge implements ringsyncpb.RingSyncServer. The pushed ring must have the
+// parameters of the ring of the server, so its binary form is no longer than
+// that of the ring, which bounds the memory of a push.
+func (s *Server) PushMerge(stream ringsyncpb.RingSync_PushMergeServer) error {
+	limit := s.ring.MarshaledSize()
+	if limit == 0 {
+		return status.Error(codes.FailedPrecondition, ring.ErrUninitialized.Error())
+	}
+	var data []byte
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if chunk.Total != uint64(limit) {
+			// a ring of another size can never be merged
+			return status.Errorf(codes.FailedPrecondition, "%v: ring of %d bytes pushed to a ring of %d bytes",
+				ring.ErrIncompatible, chunk.Total, limit)
+		}
+		if !chunk.Full || chunk.Offset != uint64(len(data)) ||
+			uint64(len(chunk.Data)) > chunk.Total-chunk.Offset {
+			return status.Errorf(codes.InvalidArgument, "chunk at %d of %d bytes is not the next of a ring of %d bytes",
+				chunk.Offset, chunk.Total, limit)
+		}
+		if data == nil {
+			data = make([]byte, 0, limit)
+		}
+		data = append(data, chunk.Data...)
+	}
+	if len(data) != limit {
+		return status.Errorf(codes.InvalidArgument, "%d bytes pushed of a ring of %d bytes", len(data), limit)
+	}
+	m := new(ring.Ring)
+	if err := m.UnmarshalBinary(data); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.ring.Merge(m); err != nil {
+		if errors.Is(err, ring.ErrIncompatible) {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.SendAndClose(&ringsyncpb.PushMergeResponse{Version: s.ring.Version()})
+}
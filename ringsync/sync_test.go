@@ -0,0 +1,194 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringsync_test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringsync"
+	"github.com/tannerryan/ring/ringsync/ringsyncpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// serve runs a Server of the ring over bufconn, returning a connected Client
+// and a counter of the bytes of chunks the Client received.
+func serve(t *testing.T, r *ring.Ring) (*ringsync.Client, *int) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	ringsyncpb.RegisterRingSyncServer(srv, ringsync.NewServer(r))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	received := new(int)
+	count := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		return countingStream{s, received}, err
+	}
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(count))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return ringsync.NewClient(cc), received
+}
+
+// countingStream counts the bytes of the chunks received.
+type countingStream struct {
+	grpc.ClientStream
+	received *int
+}
+
+func (s countingStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if c, ok := m.(*ringsyncpb.Chunk); ok && err == nil {
+		*s.received += len(c.Data)
+	}
+	return err
+}
+
+// add adds the elements from to to of a prefix.
+func add(r *ring.Ring, prefix string, from, to int) {
+	for i := from; i < to; i++ {
+		r.Add([]byte(prefix + strconv.Itoa(i)))
+	}
+}
+
+// TestSync ensures a replica synced from a populated ring holds the same
+// members, and later syncs transfer only what changed.
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	primary, _ := ring.Init(1000000, 0.01)
+	add(primary, "a", 0, 20000)
+	client, received := serve(t, primary)
+
+	replica := new(ring.Ring)
+	if err := client.Sync(ctx, replica); err != nil {
+		t.Fatal(err)
+	}
+	if !replica.Equal(primary) {
+		t.Fatal("replica differs after the snapshot")
+	}
+	for i := 0; i < 20000; i++ {
+		if !replica.Test([]byte("a" + strconv.Itoa(i))) {
+			t.Fatalf("replica lacks a%d", i)
+		}
+	}
+	if client.Version() != primary.Version() {
+		t.Fatalf("expected version %d, got %d", primary.Version(), client.Version())
+	}
+	snapshot := *received
+
+	// a few additions change a few segments
+	*received = 0
+	add(primary, "b", 0, 10)
+	if err := client.Sync(ctx, replica); err != nil {
+		t.Fatal(err)
+	}
+	if !replica.Equal(primary) || !replica.Test([]byte("b9")) {
+		t.Fatal("replica differs after the delta")
+	}
+	if *received >= snapshot/8 {
+		t.Fatalf("delta of 10 elements sent %d bytes, snapshot %d", *received, snapshot)
+	}
+
+	// nothing changed
+	*received = 0
+	if err := client.Sync(ctx, replica); err != nil {
+		t.Fatal(err)
+	}
+	if *received != 0 || !replica.Equal(primary) {
+		t.Fatalf("unchanged ring sent %d bytes", *received)
+	}
+
+	// clearing bits is replicated too
+	primary.Reset()
+	if err := client.Sync(ctx, replica); err != nil {
+		t.Fatal(err)
+	}
+	if !replica.Equal(primary) || replica.Test([]byte("a0")) {
+		t.Fatal("replica differs after Reset")
+	}
+}
+
+// TestSyncStale ensures a client whose version is no longer retained falls
+// back to a snapshot.
+func TestSyncStale(t *testing.T) {
+	ctx := context.Background()
+	primary, _ := ring.Init(1000, 0.01)
+	client, _ := serve(t, primary)
+	replica := new(ring.Ring)
+	if err := client.Sync(ctx, replica); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*ringsync.DefaultHistory; i++ {
+		add(primary, strconv.Itoa(i), 0, 10)
+		// sync another client, so the server retains newer states
+		other, _ := serve(t, primary)
+		if err := other.Sync(ctx, new(ring.Ring)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Sync(ctx, replica); err != nil {
+		t.Fatal(err)
+	}
+	if !replica.Equal(primary) {
+		t.Fatal("replica differs after a stale sync")
+	}
+}
+
+// TestPushMerge ensures pushed rings are merged into the ring of the server,
+// and rings of other parameters are rejected.
+func TestPushMerge(t *testing.T) {
+	ctx := context.Background()
+	primary, _ := ring.Init(100000, 0.01)
+	add(primary, "a", 0, 100)
+	client, _ := serve(t, primary)
+
+	local, _ := ring.Init(100000, 0.01)
+	add(local, "b", 0, 100)
+	version, err := client.PushMerge(ctx, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != primary.Version() {
+		t.Fatalf("expected version %d, got %d", primary.Version(), version)
+	}
+	for i := 0; i < 100; i++ {
+		if !primary.Test([]byte("a"+strconv.Itoa(i))) || !primary.Test([]byte("b"+strconv.Itoa(i))) {
+			t.Fatalf("merged ring lacks element %d", i)
+		}
+	}
+
+	other, _ := ring.Init(1000, 0.01)
+	if _, err := client.PushMerge(ctx, other); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+	if _, err := client.PushMerge(ctx, new(ring.Ring)); err == nil {
+		t.Fatal("expected an error pushing a zero ring")
+	}
+}
+
+// TestSyncUninitialized ensures a server of a zero ring reports
+// FailedPrecondition.
+func TestSyncUninitialized(t *testing.T) {
+	client, _ := serve(t, new(ring.Ring))
+	err := client.Sync(context.Background(), new(ring.Ring))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ringtest provides helpers for testing code built on filters: random
+// keys, assertions of no false negatives, and measurements of the false
+// positive rate against keys never added. It accepts any Filter, so rings,
+// counting rings, cuckoo filters and filters of other packages are tested
+// alike.
+package ringtest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const (
+	// absentLen is the length of the keys generated by AssertFPWithin.
+	absentLen = 64
+	// absentSeed seeds the keys generated by AssertFPWithin.
+	absentSeed = -1
+	// sigmas is the number of standard deviations of sampling error allowed by
+	// AssertFPWithin.
+	sigmas = 3
+	// maxReported is the number of false negatives AssertNoFalseNegatives
+	// reports individually.
+	maxReported = 5
+)
+
+// Filter is a filter testing data for membership, such as *ring.Ring,
+// *ring.CountingRing or *ring.Cuckoo.
+type Filter interface {
+	Test(data []byte) bool
+}
+
+// GenKeys returns n random keys of minLen to maxLen bytes, the same for the
+// same seed. Short keys may repeat; keys of 16 bytes or more are distinct with
+// overwhelming probability.
+func GenKeys(n, minLen, maxLen int, seed int64) [][]byte {
+	rnd := rand.New(rand.NewSource(seed))
+	keys := make([][]byte, n)
+	for i := range keys {
+		key := make([]byte, minLen+rnd.Intn(maxLen-minLen+1))
+		rnd.Read(key)
+		keys[i] = key
+	}
+	return keys
+}
+
+// AssertNoFalseNegatives reports an error if f tests false for any of the keys,
+// naming the first few.
+func AssertNoFalseNegatives(t testing.TB, f Filter, keys [][]byte) {
+	t.Helper()
+	missing := 0
+	for i, key := range keys {
+		if f.Test(key) {
+			continue
+		}
+		if missing < maxReported {
+			t.Errorf("false negative for key %d: %x", i, key)
+		}
+		missing++
+	}
+	if missing > maxReported {
+		t.Errorf("%d false negatives of %d keys", missing, len(keys))
+	}
+}
+
+// MeasureFP returns the rate at which f tests true for absentKeys, keys never
+// added to it, or 0 given no keys.
+func MeasureFP(f Filter, absentKeys [][]byte) float64 {
+	if len(absentKeys) == 0 {
+		return 0
+	}
+	positives := 0
+	for _, key := range absentKeys {
+		if f.Test(key) {
+			positives++
+		}
+	}
+	return float64(positives) / float64(len(absentKeys))
+}
+
+// AssertFPWithin reports an error if the false positive rate of f, measured
+// over sampleSize random keys of 64 bytes, exceeds target by more than the
+// relative tolerance, such as 0.1 for 10%, and by more than three standard
+// deviations of the sampling error. The keys are disjoint with overwhelming
+// probability from any keys not chosen to collide with them, such as those of
+// GenKeys, and the same on every call, so the assertion is deterministic.
+func AssertFPWithin(t testing.TB, f Filter, target, tolerance float64, sampleSize int) {
+	t.Helper()
+	if sampleSize <= 0 {
+		t.Fatalf("sample size must be greater than 0, got %d", sampleSize)
+	}
+	fp := MeasureFP(f, GenKeys(sampleSize, absentLen, absentLen, absentSeed))
+	limit := target*(1+tolerance) + sigmas*math.Sqrt(target*(1-target)/float64(sampleSize))
+	if fp > limit {
+		t.Errorf("false positive rate %f exceeds %f, target %f within %g of %d samples", fp, limit, target, tolerance, sampleSize)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ringtest_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/tannerryan/ring"
+	"github.com/tannerryan/ring/ringtest"
+)
+
+// recorder is a testing.TB recording failures rather than reporting them.
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
+
+// filterFunc adapts a function to a ringtest.Filter.
+type filterFunc func([]byte) bool
+
+func (f filterFunc) Test(data []byte) bool {
+	return f(data)
+}
+
+// TestGenKeys ensures keys are deterministic for a seed and within bounds.
+func TestGenKeys(t *testing.T) {
+	a := ringtest.GenKeys(1000, 4, 12, 7)
+	b := ringtest.GenKeys(1000, 4, 12, 7)
+	c := ringtest.GenKeys(1000, 4, 12, 8)
+	if len(a) != 1000 {
+		t.Fatalf("%d keys, expected 1000", len(a))
+	}
+	for i := range a {
+		if len(a[i]) < 4 || len(a[i]) > 12 {
+			t.Fatalf("key %d has length %d", i, len(a[i]))
+		}
+		if !bytes.Equal(a[i], b[i]) {
+			t.Fatalf("key %d differs for the same seed", i)
+		}
+	}
+	if fmt.Sprint(a) == fmt.Sprint(c) {
+		t.Fatal("keys equal for different seeds")
+	}
+}
+
+// TestFilters dogfoods the helpers on the filters of the ring package.
+func TestFilters(t *testing.T) {
+	keys := ringtest.GenKeys(10000, 16, 32, 1)
+	r, _ := ring.Init(len(keys), 0.01)
+	c, _ := ring.InitCounting(len(keys), 0.01)
+	cf, _ := ring.InitCuckoo(len(keys), 12, 4)
+	for _, key := range keys {
+		r.Add(key)
+		c.Add(key)
+		if err := cf.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, f := range map[string]ringtest.Filter{"ring": r, "counting": c, "cuckoo": cf} {
+		t.Run(name, func(t *testing.T) {
+			ringtest.AssertNoFalseNegatives(t, f, keys)
+			ringtest.AssertFPWithin(t, f, 0.01, 0.2, 100000)
+		})
+	}
+}
+
+// TestMeasureFP ensures the rate counts the keys tested true.
+func TestMeasureFP(t *testing.T) {
+	keys := ringtest.GenKeys(100, 1, 1, 0)
+	half := filterFunc(func(data []byte) bool { return data[0]%2 == 0 })
+	var even int
+	for _, key := range keys {
+		if key[0]%2 == 0 {
+			even++
+		}
+	}
+	if fp := ringtest.MeasureFP(half, keys); fp != float64(even)/100 {
+		t.Fatalf("rate %f, expected %f", fp, float64(even)/100)
+	}
+	if fp := ringtest.MeasureFP(half, nil); fp != 0 {
+		t.Fatalf("rate %f without keys", fp)
+	}
+}
+
+// TestAssertionsFail ensures the assertions fail for filters violating them.
+func TestAssertionsFail(t *testing.T) {
+	none := filterFunc(func([]byte) bool { return false })
+	all := filterFunc(func([]byte) bool { return true })
+	rec := &recorder{TB: t}
+	ringtest.AssertNoFalseNegatives(rec, none, ringtest.GenKeys(10, 8, 8, 0))
+	if !rec.failed {
+		t.Fatal("expected false negatives to fail")
+	}
+	rec = &recorder{TB: t}
+	ringtest.AssertFPWithin(rec, all, 0.01, 0.5, 1000)
+	if !rec.failed {
+		t.Fatal("expected false positives to fail")
+	}
+	rec = &recorder{TB: t}
+	ringtest.AssertNoFalseNegatives(rec, all, ringtest.GenKeys(10, 8, 8, 0))
+	ringtest.AssertFPWithin(rec, none, 0.01, 0, 1000)
+	if rec.failed {
+		t.Fatal("expected assertions to pass")
+	}
+}
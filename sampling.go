@@ -0,0 +1,244 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Sample is a point of the fill history of a ring, as recorded by
+// WithSampling.
+type Sample struct {
+	Time    time.Time // time the sample was recorded
+	SetBits uint64    // number of active bits
+	Items   float64   // estimated number of distinct data added, as in Stats
+}
+
+// SamplingClock is the source of time of WithSampling, replaceable by
+// WithSamplingClock to drive the sampler from tests.
+type SamplingClock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Ticker returns a channel receiving the time every interval, and a
+	// function stopping it.
+	Ticker(interval time.Duration) (<-chan time.Time, func())
+}
+
+// systemClock is the SamplingClock of the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Ticker(interval time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(interval)
+	return t.C, t.Stop
+}
+
+// WithSampling records a Sample of the ring every interval, keeping the latest
+// retain of them, at least 2, for Samples and GrowthRate. The samples are
+// taken by a goroutine started with the ring, so the ring must be closed once
+// no longer used to stop it. Active bits are counted one chunk of the bit
+// array at a time, each under a brief read lock, so writers wait for at most
+// the count of a chunk; rings using WithSaturationWarning already count them,
+// and take no lock. Rings of a Pool, and rings loaded by UnmarshalBinary into
+// a zero Ring, are not sampled.
+func WithSampling(interval time.Duration, retain int) Option {
+	return func(o *options) {
+		o.sampleInterval = interval
+		o.sampleRetain = retain
+	}
+}
+
+// WithSamplingClock replaces the system clock of WithSampling.
+func WithSamplingClock(clock SamplingClock) Option {
+	return func(o *options) {
+		o.sampleClock = clock
+	}
+}
+
+// validateSampling returns a description of each invalid sampling option.
+func (o *options) validateSampling() []string {
+	var problems []string
+	if o.sampleInterval < 0 || (o.sampleInterval == 0 && o.sampleRetain != 0) {
+		problems = append(problems, fmt.Sprintf("WithSampling(%v) interval is not positive", o.sampleInterval))
+	}
+	if o.sampleInterval != 0 && o.sampleRetain < 2 {
+		problems = append(problems, fmt.Sprintf("WithSampling retains %d samples, fewer than 2", o.sampleRetain))
+	}
+	if o.sampleClock != nil && o.sampleInterval == 0 {
+		problems = append(problems, "WithSamplingClock without WithSampling")
+	}
+	return problems
+}
+
+// sampler holds the samples of a ring in a ring buffer, and stops the
+// goroutine recording them.
+type sampler struct {
+	mutex   sync.Mutex    // guards samples and next
+	samples []Sample      // samples, oldest first once full from next
+	next    int           // index of the next sample
+	full    bool          // every sample is recorded
+	stop    chan struct{} // closed to stop the goroutine
+	done    chan struct{} // closed once the goroutine has returned
+	once    sync.Once     // closes stop
+}
+
+// startSampling records a sample of the ring now, and starts the goroutine
+// recording one every interval, if the options ask for sampling.
+func (r *Ring) startSampling(o *options) {
+	if o.sampleInterval == 0 {
+		return
+	}
+	clock := o.sampleClock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	s := &sampler{
+		samples: make([]Sample, o.sampleRetain),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	r.sampler = s
+	s.record(r.sample(clock.Now()))
+	ticks, stop := clock.Ticker(o.sampleInterval)
+	go func() {
+		defer close(s.done)
+		defer stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticks:
+				s.record(r.sample(now))
+			}
+		}
+	}()
+}
+
+// stopSampling stops the goroutine of WithSampling, if any, and waits for it
+// to return. The samples are kept.
+func (r *Ring) stopSampling() {
+	if s := r.sampler; s != nil {
+		s.once.Do(func() { close(s.stop) })
+		<-s.done
+	}
+}
+
+// record appends the sample, overwriting the oldest once full.
+func (s *sampler) record(sample Sample) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.samples[s.next] = sample
+	s.next++
+	if s.next == len(s.samples) {
+		s.next, s.full = 0, true
+	}
+}
+
+// sample returns a sample of the ring at the time.
+func (r *Ring) sample(now time.Time) Sample {
+	var ones, size uint64
+	if sat := r.saturation; sat != nil {
+		ones = sat.setBits.Load()
+	} else {
+		ones = r.countChunks()
+	}
+	b := r.set.Load()
+	if b == nil {
+		return Sample{Time: now}
+	}
+	size = b.size
+	if ones > size {
+		// the bit array was replaced while counting
+		ones = size
+	}
+	return Sample{Time: now, SetBits: ones, Items: b.estimate(float64(ones) / float64(size))}
+}
+
+// countChunks counts the active bits of the ring one chunk at a time, taking
+// the read lock for each. A bit array replaced in the meantime, as by Reset,
+// is counted from the chunk reached.
+func (r *Ring) countChunks() uint64 {
+	var ones uint64
+	for i := 0; ; i++ {
+		r.mutex.RLock()
+		b := r.set.Load()
+		if b == nil || i >= len(b.chunks) {
+			r.mutex.RUnlock()
+			return ones
+		}
+		ones += b.chunkOnes(i)
+		r.mutex.RUnlock()
+	}
+}
+
+// chunkOnes returns the active bits of chunk i.
+func (b *bitset) chunkOnes(i int) uint64 {
+	blocks := (b.size + summaryBlock - 1) / summaryBlock
+	perChunk := uint64(chunkBytes * 8 / summaryBlock)
+	first := uint64(i) * perChunk
+	var ones uint64
+	for block := first; block < first+perChunk && block < blocks; block++ {
+		ones += b.blockOnes(block)
+	}
+	return ones
+}
+
+// Samples returns a copy of the samples of WithSampling, oldest first, or nil
+// for rings without it.
+func (r *Ring) Samples() []Sample {
+	s := r.sampler
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.full {
+		return append([]Sample(nil), s.samples[:s.next]...)
+	}
+	out := make([]Sample, 0, len(s.samples))
+	out = append(out, s.samples[s.next:]...)
+	return append(out, s.samples[:s.next]...)
+}
+
+// GrowthRate returns the number of distinct data added per second, the least
+// squares slope of the estimated items of the samples of WithSampling since
+// they last decreased, as by Reset. It is 0 for rings without sampling, and
+// until two samples of distinct times are recorded.
+func (r *Ring) GrowthRate() float64 {
+	samples := r.Samples()
+	for i := len(samples) - 1; i > 0; i-- {
+		if samples[i].Items < samples[i-1].Items {
+			samples = samples[i:]
+			break
+		}
+	}
+	if len(samples) < 2 {
+		return 0
+	}
+	// times are taken relative to the first sample, keeping their precision
+	var sumT, sumY float64
+	for _, s := range samples {
+		sumT += s.Time.Sub(samples[0].Time).Seconds()
+		sumY += s.Items
+	}
+	n := float64(len(samples))
+	meanT, meanY := sumT/n, sumY/n
+	var cov, variance float64
+	for _, s := range samples {
+		dt := s.Time.Sub(samples[0].Time).Seconds() - meanT
+		cov += dt * (s.Items - meanY)
+		variance += dt * dt
+	}
+	if variance == 0 || math.IsNaN(cov) {
+		return 0
+	}
+	return cov / variance
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// tickingClock is a fakeClock whose ticker fires as it is advanced.
+type tickingClock struct {
+	fakeClock
+	ticks   chan time.Time
+	stopped chan struct{}
+}
+
+func newTickingClock() *tickingClock {
+	return &tickingClock{
+		fakeClock: fakeClock{now: time.Unix(1000, 0)},
+		ticks:     make(chan time.Time),
+		stopped:   make(chan struct{}),
+	}
+}
+
+func (c *tickingClock) Ticker(time.Duration) (<-chan time.Time, func()) {
+	return c.ticks, func() { close(c.stopped) }
+}
+
+// Tick advances the clock by d, and waits for the ring to record the sample.
+func (c *tickingClock) Tick(t *testing.T, r *ring.Ring, d time.Duration) {
+	c.Advance(d)
+	now := c.Now()
+	c.ticks <- now
+	deadline := time.Now().Add(5 * time.Second)
+	for samples := r.Samples(); !samples[len(samples)-1].Time.Equal(now); samples = r.Samples() {
+		if time.Now().After(deadline) {
+			t.Fatal("sample not recorded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSamplingGrowthRate adds data at a known rate between ticks, ensuring the
+// growth rate recovers it, and that the samples are kept in order.
+func TestSamplingGrowthRate(t *testing.T) {
+	clock := newTickingClock()
+	r, err := ring.Init(100000, 0.01, ring.WithSampling(time.Second, 8), ring.WithSamplingClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.GrowthRate() != 0 {
+		t.Fatal("expected no growth from a single sample")
+	}
+	const perTick = 1000
+	keys := ring.RandomKeys(20*perTick, 1)
+	for i := 0; i < 20; i++ {
+		for _, key := range keys[i*perTick : (i+1)*perTick] {
+			r.Add(key)
+		}
+		clock.Tick(t, r, 10*time.Second)
+		samples := r.Samples()
+		if want := i + 2; len(samples) != want && !(want > 8 && len(samples) == 8) {
+			t.Fatalf("tick %d: %d samples", i, len(samples))
+		}
+		if last := samples[len(samples)-1]; !last.Time.Equal(clock.Now()) {
+			t.Fatalf("tick %d: latest sample at %v, expected %v", i, last.Time, clock.Now())
+		}
+		for j := 1; j < len(samples); j++ {
+			if !samples[j].Time.After(samples[j-1].Time) || samples[j].SetBits < samples[j-1].SetBits {
+				t.Fatalf("tick %d: samples out of order", i)
+			}
+		}
+	}
+	if rate := r.GrowthRate(); math.Abs(rate-perTick/10) > 0.05*perTick/10 {
+		t.Fatalf("growth rate %g, expected about %d", rate, perTick/10)
+	}
+	if items := r.Samples()[7].Items; math.Abs(items-20*perTick) > 0.05*20*perTick {
+		t.Fatalf("%g items sampled, expected about %d", items, 20*perTick)
+	}
+	// samples before a Reset are left out of the rate
+	r.Reset()
+	clock.Tick(t, r, 10*time.Second)
+	if rate := r.GrowthRate(); rate != 0 {
+		t.Fatalf("growth rate %g after Reset, expected 0", rate)
+	}
+}
+
+// TestSamplingCounts ensures samples count the active bits exactly, with and
+// without WithSaturationWarning.
+func TestSamplingCounts(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithSaturationWarning(0.9, func(ring.Stats) {})}} {
+		clock := newTickingClock()
+		r, _ := ring.Init(100000, 0.01, append(opts, ring.WithSampling(time.Second, 4), ring.WithSamplingClock(clock))...)
+		for _, key := range ring.RandomKeys(5000, 3) {
+			r.Add(key)
+		}
+		clock.Tick(t, r, time.Second)
+		want := r.Histogram(1)[0]
+		if got := r.Samples()[1].SetBits; got != want {
+			t.Fatalf("sampled %d active bits, expected %d", got, want)
+		}
+		r.Close()
+	}
+}
+
+// TestSamplingClose ensures Close stops the sampler, keeping its samples, and
+// that rings without sampling report none.
+func TestSamplingClose(t *testing.T) {
+	clock := newTickingClock()
+	r, _ := ring.Init(1000, 0.01, ring.WithSampling(time.Second, 4), ring.WithSamplingClock(clock))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-clock.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ticker not stopped")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Samples()) != 1 {
+		t.Fatalf("%d samples after Close, expected 1", len(r.Samples()))
+	}
+	plain, _ := ring.Init(1000, 0.01)
+	if plain.Samples() != nil || plain.GrowthRate() != 0 {
+		t.Fatal("expected no samples without WithSampling")
+	}
+	for _, opts := range [][]ring.Option{
+		{ring.WithSampling(0, 4)},
+		{ring.WithSampling(-time.Second, 4)},
+		{ring.WithSampling(time.Second, 1)},
+		{ring.WithSamplingClock(clock)},
+	} {
+		if _, err := ring.Init(1000, 0.01, opts...); !errors.Is(err, ring.ErrOptions) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// saturationWarning is a threshold of WithSaturationWarning.
+type saturationWarning struct {
+	threshold float64
+	fn        func(Stats)
+}
+
+// saturation counts the active bits of a ring with saturation warnings, and
+// which of the warnings have fired. The warnings are shared by the rings of a
+// Pool, and sorted by threshold.
+type saturation struct {
+	warnings []saturationWarning
+	crossed  []atomic.Bool // warnings fired since the fill was last below them
+	setBits  atomic.Uint64 // number of active bits, kept by the writers
+}
+
+// WithSaturationWarning calls fn with the Stats of the ring once the fill, the
+// fraction of active bits, reaches the threshold, a fraction above 0 and at
+// most 1. The call is made once per crossing rather than once per Add: fn is
+// called again only after the fill has dropped below the threshold, as by
+// Reset, and crossed it again. The Option may be given several times, as for a
+// warning at 0.5 and a critical alert at 0.7; warnings crossed by the same
+// write are called in order of their thresholds.
+//
+// The active bits are counted as they are set, rather than by counting the bit
+// array, so each Add costs slightly more; merges and UnmarshalBinary count the
+// bit array once. fn is called by the goroutine whose write crossed the
+// threshold, after the write lock is released, so it may use the ring.
+func WithSaturationWarning(threshold float64, fn func(Stats)) Option {
+	return func(o *options) {
+		o.warnings = append(o.warnings, saturationWarning{threshold, fn})
+	}
+}
+
+// validateWarnings returns a description of each invalid warning.
+func validateWarnings(warnings []saturationWarning) []string {
+	var problems []string
+	for _, w := range warnings {
+		if !(w.threshold > 0 && w.threshold <= 1) {
+			problems = append(problems, fmt.Sprintf("WithSaturationWarning(%g) is outside 0 to 1", w.threshold))
+		}
+		if w.fn == nil {
+			problems = append(problems, fmt.Sprintf("WithSaturationWarning(%g) has no function", w.threshold))
+		}
+	}
+	return problems
+}
+
+// newSaturation returns the saturation of a ring with the warnings, or nil if
+// there are none.
+func newSaturation(warnings []saturationWarning) *saturation {
+	if len(warnings) == 0 {
+		return nil
+	}
+	sorted := append([]saturationWarning(nil), warnings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].threshold < sorted[j].threshold
+	})
+	return &saturation{warnings: sorted, crossed: make([]atomic.Bool, len(sorted))}
+}
+
+// clone returns an empty saturation with the warnings of s, or nil for nil.
+func (s *saturation) clone() *saturation {
+	if s == nil {
+		return nil
+	}
+	return &saturation{warnings: s.warnings, crossed: make([]atomic.Bool, len(s.warnings))}
+}
+
+// same returns if s and t have the same warnings.
+func (s *saturation) same(t *saturation) bool {
+	if s == nil || t == nil {
+		return s == t
+	}
+	return len(s.warnings) != 0 && len(t.warnings) != 0 && &s.warnings[0] == &t.warnings[0]
+}
+
+// warnSaturation calls the functions of the warnings whose thresholds the fill
+// has reached since they last fired, and rearms those it is below. It must be
+// called without the write lock held.
+func (r *Ring) warnSaturation() {
+	s := r.saturation
+	if s == nil || r.set.Load() == nil {
+		return
+	}
+	fill := float64(s.setBits.Load()) / float64(r.set.Load().size)
+	for i, w := range s.warnings {
+		if fill < w.threshold {
+			s.crossed[i].Store(false)
+		} else if s.crossed[i].CompareAndSwap(false, true) {
+			if r.log != nil {
+				r.logEvent(levelWarn, "ring saturated", "threshold", w.threshold, "fill", fill,
+					"set_bits", s.setBits.Load())
+			}
+			w.fn(r.Stats())
+		}
+	}
+}
+
+// setCounted activates the bit at index as setIndex, counting it if it was not
+// already active. The write lock must be held.
+func (r *Ring) setCounted(b *bitset, index uint64, s *saturation) *bitset {
+	if !b.get(index) {
+		s.setBits.Add(1)
+	}
+	return r.setIndex(b, index)
+}
+
+// clearSetBits counts no active bits, once the ring is cleared.
+func (r *Ring) clearSetBits() {
+	if s := r.saturation; s != nil {
+		s.setBits.Store(0)
+	}
+}
+
+// countSetBits counts the active bits of b anew, after writes that did not
+// count them as they were set.
+func (r *Ring) countSetBits(b *bitset) {
+	if s := r.saturation; s != nil {
+		ones, _ := b.popcount(1)
+		s.setBits.Store(ones)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// warnings records the calls of saturation warnings.
+type warnings struct {
+	mutex  sync.Mutex
+	levels []string
+	fills  []float64
+}
+
+// option returns a warning at threshold recording the level.
+func (w *warnings) option(threshold float64, level string) ring.Option {
+	return ring.WithSaturationWarning(threshold, func(s ring.Stats) {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+		w.levels = append(w.levels, level)
+		w.fills = append(w.fills, s.Fill)
+	})
+}
+
+// TestSaturationWarning ensures each threshold fires once per crossing, in
+// order, and again once crossed after a Reset.
+func TestSaturationWarning(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithFastReset()}, {ring.WithBlocked()}, {ring.WithPartitioned()}} {
+		w := &warnings{}
+		// given in reverse, as the order of the Options does not matter
+		opts = append(opts, w.option(0.7, "critical"), w.option(0.5, "warn"))
+		r, err := ring.New(100, 0.01, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buff := make([]byte, 4)
+		for round := 0; round < 2; round++ {
+			for i := 0; r.Stats().Fill < 0.9; i++ {
+				intToByte(buff, i)
+				r.Add(buff)
+			}
+			want := 2 * (round + 1)
+			if len(w.levels) != want {
+				t.Fatalf("round %d: warnings %v", round, w.levels)
+			}
+			if w.levels[want-2] != "warn" || w.levels[want-1] != "critical" {
+				t.Fatalf("round %d: warnings out of order %v", round, w.levels)
+			}
+			if w.fills[want-2] < 0.5 || w.fills[want-1] < 0.7 {
+				t.Fatalf("round %d: warned below the thresholds at %v", round, w.fills)
+			}
+			r.Reset()
+			if s := r.Stats(); s.SetBits != 0 {
+				t.Fatalf("%d set bits after Reset", s.SetBits)
+			}
+		}
+	}
+}
+
+// TestSaturationCount ensures the counted active bits are those of the bit
+// array, through Add, AddHash, AddToAll, Merge and UnmarshalBinary.
+func TestSaturationCount(t *testing.T) {
+	warn := ring.WithSaturationWarning(1, func(ring.Stats) {})
+	counted, _ := ring.New(1000, 0.01, warn)
+	plain, _ := ring.New(1000, 0.01)
+	check := func(step string) {
+		t.Helper()
+		// rings of at most 64 blocks are counted exactly by Stats
+		if c, p := counted.Stats().SetBits, plain.Stats().SetBits; c != p {
+			t.Fatalf("%s: %d set bits counted, %d in the bit array", step, c, p)
+		}
+	}
+	buff := make([]byte, 4)
+	for i := 0; i < 300; i++ {
+		intToByte(buff, i)
+		counted.Add(buff)
+		plain.Add(buff)
+		counted.AddHash(ring.NewDigest(buff))
+	}
+	check("Add")
+	if err := ring.AddToAll([]byte("all"), counted, plain); err != nil {
+		t.Fatal(err)
+	}
+	check("AddToAll")
+	other, _ := ring.New(1000, 0.01)
+	for i := 300; i < 600; i++ {
+		intToByte(buff, i)
+		other.Add(buff)
+	}
+	counted.Merge(other)
+	plain.Merge(other)
+	check("Merge")
+	data, _ := other.MarshalBinary()
+	counted.UnmarshalBinary(data)
+	plain.UnmarshalBinary(data)
+	check("UnmarshalBinary")
+}
+
+// TestSaturationReentrant ensures a warning may use the ring, as it is called
+// without the write lock.
+func TestSaturationReentrant(t *testing.T) {
+	var r *ring.Ring
+	calls := 0
+	r, _ = ring.New(10, 0.01, ring.WithSaturationWarning(0.1, func(s ring.Stats) {
+		calls++
+		r.Add([]byte("from the warning"))
+		r.Reset()
+	}))
+	buff := make([]byte, 4)
+	for i := 0; i < 100; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	if calls < 2 {
+		t.Fatalf("%d calls, expected one per crossing after each Reset", calls)
+	}
+}
+
+// TestSaturationErrors ensures invalid warnings are rejected.
+func TestSaturationErrors(t *testing.T) {
+	for _, opt := range []ring.Option{
+		ring.WithSaturationWarning(0, func(ring.Stats) {}),
+		ring.WithSaturationWarning(1.5, func(ring.Stats) {}),
+		ring.WithSaturationWarning(0.5, nil),
+	} {
+		if _, err := ring.New(10, 0.01, opt); !errors.Is(err, ring.ErrOptions) {
+			t.Errorf("expected ErrOptions, got %v", err)
+		}
+	}
+}
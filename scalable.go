@@ -0,0 +1,267 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+)
+
+const (
+	// scalableVersion is the marshaled version of a scalable ring.
+	scalableVersion = 17
+	// scalableGrowth is the factor by which the capacity of each layer exceeds
+	// the previous one.
+	scalableGrowth = 2
+	// scalableTightening is the factor by which the false positive rate of each
+	// layer is below the previous one.
+	scalableTightening = 0.5
+)
+
+// ScalableRing is a scalable bloom filter (Almeida et al.), which grows beyond
+// its initial capacity while keeping its false positive rate. Data is added to
+// the newest ring; once it holds its designed number of elements, a ring with
+// twice the capacity and half the false positive rate is appended. The false
+// positive rates of the layers form a geometric series, so their sum, an upper
+// bound on the rate of the whole stack, stays below the configured rate.
+type ScalableRing struct {
+	elements      uint64        // capacity of the first layer
+	falsePositive float64       // false positive ceiling of the whole stack
+	layers        []*Ring       // layers, oldest first
+	added         []uint64      // number of data added to each layer
+	mutex         *sync.RWMutex // mutex for locking all operations
+}
+
+// ScalableStats describes the layers of a ScalableRing.
+type ScalableStats struct {
+	Layers   int    // number of layers
+	Elements uint64 // number of data added across all layers
+	Capacity uint64 // number of data the layers are designed to hold
+	Bytes    uint64 // memory used by the bit arrays of all layers
+}
+
+// InitScalable initializes and returns a new scalable ring, or an error. The
+// first layer holds elements within a share of the falsePositive rate, which
+// bounds the rate of the whole stack however far it grows.
+func InitScalable(elements int, falsePositive float64) (*ScalableRing, error) {
+	n, err := checkArgs(elements, falsePositive)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := optimalParams(n, falsePositive, 0); err != nil {
+		return nil, err
+	}
+	s := &ScalableRing{
+		elements:      n,
+		falsePositive: falsePositive,
+		mutex:         &sync.RWMutex{},
+	}
+	if err := s.grow(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// layerParams returns the capacity and false positive rate of the i-th layer.
+func (s *ScalableRing) layerParams(i int) (uint64, float64) {
+	// capped before converting, as far beyond the limit of InitUint
+	elements := math.Min(float64(s.elements)*math.Pow(scalableGrowth, float64(i)), 1<<63)
+	falsePositive := s.falsePositive * (1 - scalableTightening) *
+		math.Pow(scalableTightening, float64(i))
+	return uint64(elements), falsePositive
+}
+
+// grow appends a new layer.
+func (s *ScalableRing) grow() error {
+	r, err := InitUint(s.layerParams(len(s.layers)))
+	if err != nil {
+		return fmt.Errorf("error: cannot grow beyond %d layers: %w", len(s.layers), err)
+	}
+	s.layers = append(s.layers, r)
+	s.added = append(s.added, 0)
+	return nil
+}
+
+// Add adds the data to the newest layer, first appending a layer if it is
+// full. Data already in the ring is not added again, so duplicates do not use
+// up capacity. It returns an error if no further layer can be appended.
+func (s *ScalableRing) Add(data []byte) error {
+	return s.AddHash(NewDigest(data))
+}
+
+// AddHash adds the data of the digest to the ring, like Add without hashing the
+// data again.
+func (s *ScalableRing) AddHash(d Digest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.test(d) {
+		return nil
+	}
+	last := len(s.layers) - 1
+	if capacity, _ := s.layerParams(last); s.added[last] >= capacity {
+		if err := s.grow(); err != nil {
+			return err
+		}
+		last++
+	}
+	s.layers[last].AddHash(d)
+	s.added[last]++
+	return nil
+}
+
+// Test returns a bool if the data is in any layer of the ring. True indicates
+// that the data may be in the ring, while false indicates that the data is not
+// in the ring.
+func (s *ScalableRing) Test(data []byte) bool {
+	return s.TestHash(NewDigest(data))
+}
+
+// TestHash returns a bool if the data of the digest is in any layer of the
+// ring, like Test without hashing the data again.
+func (s *ScalableRing) TestHash(d Digest) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.test(d)
+}
+
+// test probes the layers newest first, as they hold most of the data. The data
+// is hashed once for all layers.
+func (s *ScalableRing) test(d Digest) bool {
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		if s.layers[i].TestHash(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset clears the ring, dropping every layer but the first.
+func (s *ScalableRing) Reset() {
+	s.mutex.Lock()
+	s.layers[0].Reset()
+	s.layers, s.added = s.layers[:1], s.added[:1]
+	s.added[0] = 0
+	s.mutex.Unlock()
+}
+
+// Stats returns the number of layers, elements, capacity and memory of the
+// ring.
+func (s *ScalableRing) Stats() ScalableStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	st := ScalableStats{Layers: len(s.layers)}
+	for i, r := range s.layers {
+		capacity, _ := s.layerParams(i)
+		st.Elements += s.added[i]
+		st.Capacity += capacity
+		st.Bytes += r.size/8 + 1
+	}
+	return st
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. The layers
+// are stored in order after the configuration, each prefixed by the number of
+// data added to it and its length.
+func (s *ScalableRing) MarshalBinary() ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	out := make([]byte, 21, 21+len(s.layers)*16)
+	out[0] = scalableVersion
+	binary.BigEndian.PutUint64(out[1:9], s.elements)
+	binary.BigEndian.PutUint64(out[9:17], math.Float64bits(s.falsePositive))
+	binary.BigEndian.PutUint32(out[17:21], uint32(len(s.layers)))
+	for i, r := range s.layers {
+		data, err := r.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out = binary.BigEndian.AppendUint64(out, s.added[i])
+		out = binary.BigEndian.AppendUint64(out, uint64(len(data)))
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. Each
+// layer must have the parameters grow gives it from the decoded capacity and
+// false positive rate, or the data is rejected with a *CorruptError.
+func (s *ScalableRing) UnmarshalBinary(data []byte) error {
+	if len(data) < 21 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != scalableVersion {
+		return versionError(data[0])
+	}
+	n := ScalableRing{
+		elements:      binary.BigEndian.Uint64(data[1:9]),
+		falsePositive: math.Float64frombits(binary.BigEndian.Uint64(data[9:17])),
+	}
+	if _, _, err := optimalParams(n.elements, n.falsePositive, 0); err != nil {
+		return err
+	}
+	layers := binary.BigEndian.Uint32(data[17:21])
+	if layers == 0 {
+		return &CorruptError{"layers", uint64(layers)}
+	}
+	data = data[21:]
+	for i := uint32(0); i < layers; i++ {
+		if len(data) < 16 {
+			return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+		}
+		added := binary.BigEndian.Uint64(data[0:8])
+		length := binary.BigEndian.Uint64(data[8:16])
+		data = data[16:]
+		if length > uint64(len(data)) {
+			return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+		}
+		r := &Ring{}
+		if err := r.UnmarshalBinary(data[:length]); err != nil {
+			return err
+		}
+		if err := n.checkLayer(int(i), r); err != nil {
+			return err
+		}
+		n.layers = append(n.layers, r)
+		n.added = append(n.added, added)
+		data = data[length:]
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorrupt, len(data))
+	}
+
+	if s.mutex == nil {
+		s.mutex = &sync.RWMutex{}
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.elements, s.falsePositive = n.elements, n.falsePositive
+	s.layers, s.added = n.layers, n.added
+	return nil
+}
+
+// checkLayer returns a *CorruptError if the unmarshaled ring r does not have
+// the parameters of the i-th layer grown by s.
+func (s *ScalableRing) checkLayer(i int, r *Ring) error {
+	elements, falsePositive := s.layerParams(i)
+	size, hash, err := optimalParams(elements, falsePositive, 0)
+	if err != nil {
+		// no such layer can be grown
+		return &CorruptError{"layers", uint64(i + 1)}
+	}
+	p := r.set.Load().params
+	switch {
+	case p.flags != 0:
+		return &CorruptError{"layer flags", uint64(p.flags)}
+	case p.seed != 0:
+		return &CorruptError{"layer seed", p.seed}
+	case p.size != size:
+		return &CorruptError{"layer size", p.size}
+	case p.hash != hash:
+		return &CorruptError{"layer hash", p.hash}
+	}
+	return nil
+}
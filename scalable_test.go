@@ -0,0 +1,132 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestScalableGrowth inserts 10 times the initial capacity, ensuring there are
+// no false negatives and the false positive rate stays below the ceiling.
+func TestScalableGrowth(t *testing.T) {
+	const initial, ceiling = 10000, 0.01
+	s, _ := ring.InitScalable(initial, ceiling)
+	buff := make([]byte, 4)
+	for i := 0; i < initial*10; i++ {
+		intToByte(buff, i)
+		if err := s.Add(buff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st := s.Stats()
+	// capacities 1, 2, 4 and 8 times the initial, as 10 times cannot fit in 3
+	if st.Layers != 4 || st.Capacity != initial*15 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+	if st.Elements > initial*10 || st.Elements < initial*10*99/100 {
+		t.Fatalf("unexpected elements: %d", st.Elements)
+	}
+	for i := 0; i < initial*10; i++ {
+		intToByte(buff, i)
+		if !s.Test(buff) {
+			t.Fatalf("data %d missing", i)
+		}
+	}
+	fp := 0
+	const probes = 1000000
+	for i := initial * 10; i < initial*10+probes; i++ {
+		intToByte(buff, i)
+		if s.Test(buff) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / probes; rate > ceiling {
+		t.Fatalf("false positive rate %v exceeds %v", rate, ceiling)
+	}
+}
+
+// TestScalableMarshalLayers ensures UnmarshalBinary rejects layers whose
+// parameters do not follow the growth of the decoded configuration.
+func TestScalableMarshalLayers(t *testing.T) {
+	s, _ := ring.InitScalable(1000, fpRate)
+	data, _ := s.MarshalBinary()
+	// the single layer follows the configuration and its added count and length
+	config, layer := data[:21], data[37:]
+	rehashed := append([]byte(nil), layer...)
+	rehashed[16]++
+	larger, _ := ring.Init(1000, fpRate)
+	seeded, _ := ring.Init(1000, fpRate, ring.WithSeed(1))
+	largerData, _ := larger.MarshalBinary()
+	seededData, _ := seeded.MarshalBinary()
+	for field, layer := range map[string][]byte{
+		"layer size": largerData,
+		"layer hash": rehashed,
+		"layer seed": seededData,
+	} {
+		corrupt := append([]byte(nil), config...)
+		corrupt = binary.BigEndian.AppendUint64(corrupt, 0)
+		corrupt = binary.BigEndian.AppendUint64(corrupt, uint64(len(layer)))
+		corrupt = append(corrupt, layer...)
+		var c *ring.CorruptError
+		if err := new(ring.ScalableRing).UnmarshalBinary(corrupt); !errors.As(err, &c) || c.Field != field {
+			t.Fatalf("%s: unexpected error %v", field, err)
+		}
+	}
+}
+
+func TestScalableMarshal(t *testing.T) {
+	s, _ := ring.InitScalable(1000, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < 5000; i++ {
+		intToByte(buff, i)
+		s.Add(buff)
+	}
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s2 ring.ScalableRing
+	if err := s2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if s2.Stats() != s.Stats() {
+		t.Fatalf("stats changed: %+v, %+v", s2.Stats(), s.Stats())
+	}
+	for i := 0; i < 5000; i++ {
+		intToByte(buff, i)
+		if !s2.Test(buff) {
+			t.Fatalf("data %d missing after unmarshal", i)
+		}
+	}
+	if data2, _ := s2.MarshalBinary(); !bytes.Equal(data, data2) {
+		t.Fatal("marshaled data changed")
+	}
+	for _, n := range []int{0, 20, len(data) - 1} {
+		if s2.UnmarshalBinary(data[:n]) == nil {
+			t.Fatalf("truncation to %d bytes not captured", n)
+		}
+	}
+}
+
+func TestScalableReset(t *testing.T) {
+	s, _ := ring.InitScalable(100, fpRate)
+	buff := make([]byte, 4)
+	for i := 0; i < 1000; i++ {
+		intToByte(buff, i)
+		s.Add(buff)
+	}
+	s.Reset()
+	if st := s.Stats(); st.Layers != 1 || st.Elements != 0 {
+		t.Fatalf("unexpected stats after Reset: %+v", st)
+	}
+	if s.Test(buff) {
+		t.Fatal("data present after Reset")
+	}
+}
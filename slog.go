@@ -0,0 +1,43 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+package ring
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLogger logs the notable events of the ring to l, with the attributes
+// "ring", the name of WithName if any, and "version", the Version of the ring
+// after the event:
+//
+//	Info  "ring reset"          Reset, with "epochs_exhausted" if a
+//	                            WithFastReset ring replaced its bit array
+//	Info  "ring loaded"         UnmarshalBinary, with "format", the version
+//	                            of the data, and "marshaled_format" if the
+//	                            ring is now marshaled in another
+//	Warn  "ring load failed"    UnmarshalBinary rejected the data, with
+//	                            "error"
+//	Warn  "ring saturated"      a threshold of WithSaturationWarning was
+//	                            reached, with "threshold", "fill" and
+//	                            "set_bits"
+//	Debug "ring merged"         Merge, with "fill"
+//	Debug "ring released"       Release
+//
+// Events are logged after the write lock is released, so handlers may use the
+// ring. Rings without WithLogger log nothing, and pay only a nil check per
+// event. WithLogger is available from Go 1.21, which added log/slog.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = nil
+		if l != nil {
+			o.logger = func(level logLevel, msg string, args ...interface{}) {
+				l.Log(context.Background(), slog.Level(level), msg, args...)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+
+package ring_test
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// capture is a slog.Handler recording the records it handles, after calling
+// use, as a handler using the ring would.
+type capture struct {
+	mutex   sync.Mutex
+	records []slog.Record
+	use     func()
+}
+
+func (c *capture) Enabled(context.Context, slog.Level) bool { return true }
+func (c *capture) WithAttrs([]slog.Attr) slog.Handler       { return c }
+func (c *capture) WithGroup(string) slog.Handler            { return c }
+
+func (c *capture) Handle(_ context.Context, r slog.Record) error {
+	if c.use != nil {
+		c.use()
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.records = append(c.records, r)
+	return nil
+}
+
+// take returns the records handled since the last call.
+func (c *capture) take() []slog.Record {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	records := c.records
+	c.records = nil
+	return records
+}
+
+// attrs returns the attributes of the record by key.
+func attrs(r slog.Record) map[string]slog.Value {
+	m := make(map[string]slog.Value)
+	r.Attrs(func(a slog.Attr) bool {
+		m[a.Key] = a.Value
+		return true
+	})
+	return m
+}
+
+// expectEvent ensures records holds a single event of the message, of the
+// level and with the name of the ring, and returns its attributes.
+func expectEvent(t *testing.T, records []slog.Record, level slog.Level, msg string) map[string]slog.Value {
+	t.Helper()
+	var found []slog.Record
+	for _, r := range records {
+		if r.Message == msg {
+			found = append(found, r)
+		}
+	}
+	if len(found) != 1 || found[0].Level != level {
+		t.Fatalf("expected a single %v %q event, got %v", level, msg, records)
+	}
+	a := attrs(found[0])
+	if a["ring"].String() != "sessions" {
+		t.Fatalf("%s: unexpected name %v", msg, a["ring"])
+	}
+	if _, ok := a["version"]; !ok {
+		t.Fatalf("%s: no version", msg)
+	}
+	return a
+}
+
+// TestLogger ensures each event is logged with its attributes, outside the
+// write lock.
+func TestLogger(t *testing.T) {
+	c := new(capture)
+	var r *ring.Ring
+	// marshaling takes the read lock, which would deadlock under the write lock
+	c.use = func() { r.MarshalBinary() }
+	var warned int
+	r, _ = ring.Init(100, 0.01, ring.WithName("sessions"), ring.WithLogger(slog.New(c)),
+		ring.WithSaturationWarning(0.2, func(ring.Stats) { warned++ }))
+
+	for i := 0; i < 100 && warned == 0; i++ {
+		r.Add([]byte(strconv.Itoa(i)))
+	}
+	a := expectEvent(t, c.take(), slog.LevelWarn, "ring saturated")
+	if a["threshold"].Float64() != 0.2 || a["fill"].Float64() < 0.2 || a["set_bits"].Uint64() == 0 {
+		t.Fatalf("unexpected saturation attributes: %v", a)
+	}
+
+	data, _ := r.MarshalBinary()
+	m, _ := ring.Init(100, 0.01)
+	r.Merge(m)
+	expectEvent(t, c.take(), slog.LevelDebug, "ring merged")
+
+	r.Reset()
+	a = expectEvent(t, c.take(), slog.LevelInfo, "ring reset")
+	if _, ok := a["epochs_exhausted"]; ok {
+		t.Fatal("epochs_exhausted of a ring without WithFastReset")
+	}
+
+	if err := r.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	a = expectEvent(t, c.take(), slog.LevelInfo, "ring loaded")
+	if a["format"].Int64() != 1 {
+		t.Fatalf("unexpected format: %v", a["format"])
+	}
+	if _, ok := a["marshaled_format"]; ok {
+		t.Fatal("marshaled_format of a ring marshaled in its format")
+	}
+	// version 2 data without mode flags is marshaled as version 1
+	upgraded := append([]byte{2, 0}, data[1:]...)
+	r.UnmarshalBinary(upgraded)
+	a = expectEvent(t, c.take(), slog.LevelInfo, "ring loaded")
+	if a["format"].Int64() != 2 || a["marshaled_format"].Int64() != 1 {
+		t.Fatalf("unexpected formats: %v", a)
+	}
+	if r.UnmarshalBinary(data[:10]) == nil {
+		t.Fatal("truncated data loaded")
+	}
+	a = expectEvent(t, c.take(), slog.LevelWarn, "ring load failed")
+	if a["error"].Any() == nil {
+		t.Fatal("no error")
+	}
+
+	r.Release()
+	expectEvent(t, c.take(), slog.LevelDebug, "ring released")
+
+	// rings of a pool share the logger
+	p, _ := ring.NewPool(100, 0.01, ring.WithName("sessions"), ring.WithLogger(slog.New(c)))
+	p.Get().Reset()
+	expectEvent(t, c.take(), slog.LevelInfo, "ring reset")
+}
+
+// TestLoggerFastReset ensures replacing the bit array of a WithFastReset ring
+// is logged.
+func TestLoggerFastReset(t *testing.T) {
+	c := new(capture)
+	r, _ := ring.Init(100, 0.01, ring.WithName("sessions"), ring.WithLogger(slog.New(c)), ring.WithFastReset())
+	r.Reset()
+	a := expectEvent(t, c.take(), slog.LevelInfo, "ring reset")
+	if _, ok := a["epochs_exhausted"]; ok {
+		t.Fatal("epochs_exhausted before the epochs are")
+	}
+}
+
+// TestNoLogger ensures rings without WithLogger do not allocate to log.
+func TestNoLogger(t *testing.T) {
+	r, _ := ring.Init(100, 0.01, ring.WithName("sessions"), ring.WithFastReset())
+	data := []byte("data")
+	if n := testing.AllocsPerRun(100, func() {
+		r.Add(data)
+		r.Reset()
+	}); n != 0 {
+		t.Fatalf("Add and Reset allocated %v times", n)
+	}
+}
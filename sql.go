@@ -0,0 +1,44 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNull is returned by Scan given a NULL value.
+	ErrNull = errors.New("error: value is NULL")
+	// ErrScanType is returned by Scan given a value other than []byte or
+	// string.
+	ErrScanType = errors.New("error: value must be []byte or string")
+)
+
+// Value implements the driver.Valuer interface, so a ring can be an argument of
+// Exec or Query, as for a BYTEA or BLOB column. The value is the output of
+// MarshalBinary. A zero Ring returns ErrUninitialized.
+func (r *Ring) Value() (driver.Value, error) {
+	return r.MarshalBinary()
+}
+
+// Scan implements the sql.Scanner interface, so a ring can be a destination of
+// Scan. The value, a []byte or string holding the output of MarshalBinary, is
+// loaded by UnmarshalBinary: it is checked before the ring changes, and copied,
+// so the driver may reuse it. A NULL value returns ErrNull, and other types
+// ErrScanType, leaving the ring unchanged; nullable columns can be scanned
+// into a *[]byte and loaded when not nil.
+func (r *Ring) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return r.UnmarshalBinary(v)
+	case string:
+		return r.UnmarshalBinary([]byte(v))
+	case nil:
+		return ErrNull
+	}
+	return fmt.Errorf("%w, got %T", ErrScanType, src)
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// table is a database of the fake driver: a single table of values by key,
+// written by "INSERT" with the key and the value, and read by "SELECT" with
+// the key.
+type table struct {
+	mutex  sync.Mutex
+	values map[int64]driver.Value
+}
+
+func (t *table) Open(string) (driver.Conn, error) { return t, nil }
+func (t *table) Prepare(query string) (driver.Stmt, error) {
+	return statement{t, query}, nil
+}
+func (t *table) Close() error              { return nil }
+func (t *table) Begin() (driver.Tx, error) { return nil, errors.New("transactions are not supported") }
+
+type statement struct {
+	table *table
+	query string
+}
+
+func (s statement) Close() error  { return nil }
+func (s statement) NumInput() int { return -1 }
+
+func (s statement) Exec(args []driver.Value) (driver.Result, error) {
+	s.table.mutex.Lock()
+	defer s.table.mutex.Unlock()
+	s.table.values[args[0].(int64)] = args[1]
+	return driver.RowsAffected(1), nil
+}
+
+func (s statement) Query(args []driver.Value) (driver.Rows, error) {
+	s.table.mutex.Lock()
+	defer s.table.mutex.Unlock()
+	v, ok := s.table.values[args[0].(int64)]
+	return &rows{v, !ok}, nil
+}
+
+type rows struct {
+	value driver.Value
+	done  bool
+}
+
+func (r *rows) Columns() []string { return []string{"filter"} }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.value
+	return nil
+}
+
+var openTable sync.Once
+
+// TestSQL round trips a ring through a table of a database.
+func TestSQL(t *testing.T) {
+	openTable.Do(func() {
+		sql.Register("ringtable", &table{values: make(map[int64]driver.Value)})
+	})
+	db, err := sql.Open("ringtable", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r, _ := ring.Init(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		r.Add([]byte(strconv.Itoa(i)))
+	}
+	if _, err := db.Exec("INSERT", 1, r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT", 2, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := new(ring.Ring)
+	if err := db.QueryRow("SELECT", 1).Scan(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(r) {
+		t.Fatal("scanned ring differs")
+	}
+	for i := 0; i < 1000; i++ {
+		if !loaded.Test([]byte(strconv.Itoa(i))) {
+			t.Fatalf("scanned ring lacks %d", i)
+		}
+	}
+	if err := db.QueryRow("SELECT", 2).Scan(loaded); !errors.Is(err, ring.ErrNull) {
+		t.Fatalf("expected ErrNull, got %v", err)
+	}
+	if !loaded.Equal(r) {
+		t.Fatal("ring changed by NULL")
+	}
+	if _, err := db.Exec("INSERT", 3, new(ring.Ring)); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+}
+
+// TestScan ensures Scan accepts strings and rejects other types and invalid
+// data without changing the ring.
+func TestScan(t *testing.T) {
+	r, _ := ring.Init(1000, 0.01)
+	r.Add([]byte("data"))
+	data, _ := r.Value()
+
+	s := new(ring.Ring)
+	if err := s.Scan(string(data.([]byte))); err != nil || !s.Equal(r) {
+		t.Fatalf("string not scanned: %v", err)
+	}
+	if err := s.Scan(int64(1)); !errors.Is(err, ring.ErrScanType) {
+		t.Fatalf("expected ErrScanType, got %v", err)
+	}
+	if err := s.Scan(data.([]byte)[:10]); !errors.Is(err, ring.ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	if !s.Equal(r) {
+		t.Fatal("ring changed by invalid values")
+	}
+}
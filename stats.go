@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "math"
+
+// Stats is a snapshot of the state of a ring, for monitoring. The fill and the
+// figures derived from it are those of String: exact for rings of at most 64
+// blocks of 512 bits, and otherwise sampled from 64 blocks spread over the bit
+// array. Rings using WithSaturationWarning count their active bits instead.
+type Stats struct {
+	Bits       uint64 // number of bits of the ring
+	HashRounds uint64 // number of hash rounds of the ring
+
+	SetBits        uint64  // number of active bits, estimated from the fill
+	Fill           float64 // fraction of active bits
+	EstimatedItems float64 // estimated number of distinct data added
+	FalsePositive  float64 // estimated false positive rate of Test, Fill^HashRounds
+	MemoryBytes    uint64  // bytes allocated for the bit array, its summary and stamps
+
+	Metrics // operation counts, zero unless EnableCounters has been called
+}
+
+// Stats returns a snapshot of the state of the ring. It takes no lock, other
+// than a brief read lock for rings using WithOffHeap, and costs the same for
+// any size of ring. A zero Ring returns zero Stats.
+func (r *Ring) Stats() Stats {
+	s := Stats{Metrics: r.Metrics()}
+	if r.offHeap {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+	}
+	b := r.set.Load()
+	if b == nil {
+		return s
+	}
+	s.Bits, s.HashRounds = b.size, b.hash
+	if sat := r.saturation; sat != nil {
+		s.SetBits = sat.setBits.Load()
+		s.Fill = float64(s.SetBits) / float64(b.size)
+	} else {
+		s.Fill = b.fill()
+		s.SetBits = uint64(math.Round(s.Fill * float64(b.size)))
+	}
+	s.EstimatedItems = b.estimate(s.Fill)
+	s.FalsePositive = math.Pow(s.Fill, float64(b.hash))
+	s.MemoryBytes = b.memory()
+	return s
+}
+
+// memory returns the number of bytes allocated for the bitset.
+func (b *bitset) memory() uint64 {
+	n := uint64(len(b.summary) + 4*len(b.stamps))
+	for _, c := range b.chunks {
+		n += uint64(len(c))
+	}
+	return n
+}
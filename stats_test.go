@@ -0,0 +1,58 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestStats ensures Stats reports the parameters, fill and counters of the
+// ring.
+func TestStats(t *testing.T) {
+	r, _ := ring.New(1000, 0.01)
+	if s := r.Stats(); s.Adds != 0 || s.Fill != 0 || s.SetBits != 0 || s.EstimatedItems != 0 {
+		t.Fatalf("empty ring: %+v", s)
+	}
+	r.Add([]byte("uncounted"))
+	r.EnableCounters()
+	buff := make([]byte, 4)
+	for i := 0; i < 500; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+		r.Test(buff)
+	}
+	r.Test([]byte("absent"))
+	p := r.Parameters()
+	s := r.Stats()
+	if s.Bits != p.Bits || s.HashRounds != p.HashRounds {
+		t.Fatalf("%+v, expected the parameters %+v", s, p)
+	}
+	if s.Adds != 500 || s.Tests != 501 || s.Hits != 500 || s.Resets != 0 {
+		t.Fatalf("counters: %+v", s)
+	}
+	// rings of at most 64 blocks are counted exactly
+	if s.Fill != float64(s.SetBits)/float64(s.Bits) || s.SetBits == 0 {
+		t.Fatalf("fill %g of %d set bits", s.Fill, s.SetBits)
+	}
+	if math.Abs(s.EstimatedItems-501) > 25 {
+		t.Fatalf("estimated %g items, expected about 501", s.EstimatedItems)
+	}
+	if want := math.Pow(s.Fill, float64(s.HashRounds)); s.FalsePositive != want || s.FalsePositive > 0.01 {
+		t.Fatalf("false positive rate %g, expected %g", s.FalsePositive, want)
+	}
+	if s.MemoryBytes < s.Bits/8 {
+		t.Fatalf("%d bytes for %d bits", s.MemoryBytes, s.Bits)
+	}
+	r.Reset()
+	if s := r.Stats(); s.Resets != 1 || s.SetBits != 0 || s.Adds != 500 {
+		t.Fatalf("after Reset: %+v", s)
+	}
+	if s := new(ring.Ring).Stats(); s != (ring.Stats{}) {
+		t.Fatalf("zero ring: %+v", s)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+// fillSamples is the number of 512-bit blocks read to estimate the fill of a
+// ring. Rings of at most as many blocks are counted exactly.
+const fillSamples = 64
+
+// String returns a one line summary of the ring, such as
+//
+//	ring(m=958506 bits, k=7, fill=12.3%, ~est 13k items)
+//
+// The prefix "ring(", the fields m and k with their exact values, and the order
+// of the fields are stable. The fill and the estimated number of distinct items
+// added are approximations whose formatting may change: the fill of large
+// rings is sampled from a fixed number of blocks, so String costs the same for
+// any size of ring. A zero Ring returns "ring(uninitialized)". String is safe
+// to call concurrently with other methods.
+func (r *Ring) String() string {
+	return r.summary(false)
+}
+
+// GoString returns the exact parameters of the ring for the %#v verb, such as
+//
+//	ring.Ring(ring.Parameters{Bits:958506, HashRounds:7, ...})
+func (r *Ring) GoString() string {
+	if r == nil {
+		return "(*ring.Ring)(nil)"
+	}
+	return fmt.Sprintf("ring.Ring(%#v)", r.Parameters())
+}
+
+// Format implements fmt.Formatter. The %v and %s verbs print String, and %q
+// prints it quoted. The %+v verb adds the estimated false positive rate of a
+// query given the fill, such as
+//
+//	ring(m=958506 bits, k=7, fill=12.3%, ~est 13k items, ~fp 4.3e-07)
+//
+// whose stability is that of String. The %#v verb prints GoString, the exact
+// parameters of the ring. Other verbs are reported as bad verbs, as by fmt.
+// No verb takes the write lock, and all are safe for nil and zero Rings.
+func (r *Ring) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		io.WriteString(f, r.GoString())
+	case verb == 'v' && f.Flag('+'):
+		io.WriteString(f, r.summary(true))
+	case verb == 'v' || verb == 's':
+		io.WriteString(f, r.summary(false))
+	case verb == 'q':
+		io.WriteString(f, strconv.Quote(r.summary(false)))
+	default:
+		fmt.Fprintf(f, "%%!%c(%s)", verb, r.summary(false))
+	}
+}
+
+// summary returns String, with the estimated false positive rate if verbose.
+func (r *Ring) summary(verbose bool) string {
+	if r == nil {
+		return "ring(uninitialized)"
+	}
+	if r.offHeap {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+	}
+	b := r.set.Load()
+	if b == nil {
+		return "ring(uninitialized)"
+	}
+	fill := b.fill()
+	if verbose {
+		return fmt.Sprintf("ring(m=%d bits, k=%d, fill=%.1f%%, ~est %s items, ~fp %.2g)",
+			b.size, b.hash, fill*100, formatCount(b.estimate(fill)), math.Pow(fill, float64(b.hash)))
+	}
+	return fmt.Sprintf("ring(m=%d bits, k=%d, fill=%.1f%%, ~est %s items)",
+		b.size, b.hash, fill*100, formatCount(b.estimate(fill)))
+}
+
+// fill returns the fraction of active bits, counted exactly in rings of at most
+// fillSamples blocks and otherwise in fillSamples blocks spread evenly over
+// the bit array. It is safe to call concurrently with set.
+func (b *bitset) fill() float64 {
+	step := uint64(1)
+	if blocks := (b.size + summaryBlock - 1) / summaryBlock; blocks > fillSamples {
+		step = blocks / fillSamples
+	}
+	ones, total := b.popcount(step)
+	return float64(ones) / float64(total)
+}
+
+// popcount returns the number of active bits in every step-th block, and the
+// number of bits of those blocks. It is safe to call concurrently with set.
+func (b *bitset) popcount(step uint64) (ones, total uint64) {
+	blocks := (b.size + summaryBlock - 1) / summaryBlock
+	for block := uint64(0); block < blocks; block += step {
+		start := block * summaryBlock
+		end := start + summaryBlock
+		if end > b.size {
+			end = b.size
+		}
+		total += end - start
+		ones += b.blockOnes(block)
+	}
+	return ones, total
+}
+
+// blockOnes returns the active bits of the block.
+func (b *bitset) blockOnes(block uint64) uint64 {
+	if b.stamps != nil && !b.fresh(block) {
+		return 0
+	}
+	start := block * summaryBlock
+	end := start + summaryBlock
+	if end > b.size {
+		end = b.size
+	}
+	c := b.chunks[start>>(chunkShift+3)]
+	if c == nil {
+		return 0
+	}
+	// blocks never straddle chunks, and bits past size are never set
+	var ones uint64
+	for i := start / 8; i < (end+7)/8; i++ {
+		ones += uint64(bits.OnesCount8(atomicLoad(c, i&chunkMask)))
+	}
+	return ones
+}
+
+// estimate returns the number of distinct items added to a ring with the fill,
+// -m/k*ln(1-fill). A saturated ring counts as short of a single bit.
+func (b *bitset) estimate(fill float64) float64 {
+	m := float64(b.size)
+	if fill >= 1 {
+		fill = 1 - 0.5/m
+	}
+	return -m / float64(b.hash) * math.Log1p(-fill)
+}
+
+// formatCount formats n with 3 significant digits and a k, M, G or T suffix,
+// or exactly below 1000.
+func formatCount(n float64) string {
+	if n < 999.5 {
+		return strconv.FormatFloat(math.Round(n), 'f', 0, 64)
+	}
+	suffix := 0
+	for n /= 1000; n >= 999.5 && suffix < 3; n /= 1000 {
+		suffix++
+	}
+	return strconv.FormatFloat(n, 'g', 3, 64) + "kMGT"[suffix:suffix+1]
+}
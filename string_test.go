@@ -0,0 +1,180 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// stringFormat matches the guaranteed parts of String: the prefix, the exact m
+// and k, and the order of the fields.
+var stringFormat = regexp.MustCompile(`^ring\(m=(\d+) bits, k=(\d+), fill=([\d.]+)%, ~est ([\d.]+[kMGT]?) items\)$`)
+
+// TestString ensures String reports the exact parameters in the documented
+// format, with a fill and estimate close to those of the added elements.
+func TestString(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithPartitioned()}, {ring.WithBlocked()}, {ring.WithFastReset()}} {
+		r, err := ring.New(100000, 0.01, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := r.Parameters()
+		buff := make([]byte, 4)
+		for i := 0; i < 13000; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+		}
+		s := r.String()
+		match := stringFormat.FindStringSubmatch(s)
+		if match == nil {
+			t.Fatalf("%q does not match the format", s)
+		}
+		if match[1] != strconv.FormatUint(p.Bits, 10) || match[2] != strconv.FormatUint(p.HashRounds, 10) {
+			t.Fatalf("%q does not hold the parameters %+v", s, p)
+		}
+		want := 100 * -math.Expm1(-float64(13000*p.HashRounds)/float64(p.Bits))
+		if fill, _ := strconv.ParseFloat(match[3], 64); math.Abs(fill-want) > want/10 {
+			t.Fatalf("%q: fill %g%%, expected about %.1f%%", s, fill, want)
+		}
+		est, err := strconv.ParseFloat(strings.TrimSuffix(match[4], "k"), 64)
+		if err != nil || !strings.HasSuffix(match[4], "k") || math.Abs(est-13) > 1.3 {
+			t.Fatalf("%q: estimate %s, expected about 13k", s, match[4])
+		}
+	}
+}
+
+// TestStringSmall ensures small rings are counted exactly.
+func TestStringSmall(t *testing.T) {
+	r, _ := ring.New(10, 0.01)
+	if s := r.String(); !strings.HasSuffix(s, "fill=0.0%, ~est 0 items)") {
+		t.Fatalf("empty ring: %q", s)
+	}
+	r.Add([]byte("hello"))
+	p := r.Parameters()
+	want := fmt.Sprintf("ring(m=%d bits, k=%d, fill=%.1f%%, ~est 1 items)",
+		p.Bits, p.HashRounds, 100*float64(p.HashRounds)/float64(p.Bits))
+	if s := r.String(); s != want {
+		t.Fatalf("%q, expected %q", s, want)
+	}
+}
+
+// TestStringZero ensures String and GoString do not panic on zero and nil
+// rings.
+func TestStringZero(t *testing.T) {
+	var zero ring.Ring
+	if s := zero.String(); s != "ring(uninitialized)" {
+		t.Fatalf("zero ring: %q", s)
+	}
+	var nilRing *ring.Ring
+	if s := nilRing.String(); s != "ring(uninitialized)" {
+		t.Fatalf("nil ring: %q", s)
+	}
+	if s := fmt.Sprintf("%#v", &zero); !strings.HasPrefix(s, "ring.Ring(") {
+		t.Fatalf("zero ring: %q", s)
+	}
+	if s := fmt.Sprintf("%#v", nilRing); s != "(*ring.Ring)(nil)" {
+		t.Fatalf("nil ring: %q", s)
+	}
+}
+
+// TestGoString ensures %#v holds the exact parameters of the ring.
+func TestGoString(t *testing.T) {
+	r, _ := ring.New(5000, 0.001, ring.WithPartitioned(), ring.WithSeed(42))
+	if s, want := fmt.Sprintf("%#v", r), fmt.Sprintf("ring.Ring(%#v)", r.Parameters()); s != want {
+		t.Fatalf("%q, expected %q", s, want)
+	}
+	if s := fmt.Sprintf("%v", r); s != r.String() {
+		t.Fatalf("%%v: %q, expected %q", s, r.String())
+	}
+}
+
+// TestStringConcurrent ensures String is safe to call concurrently with Add and
+// Reset, which the race detector verifies.
+func TestStringConcurrent(t *testing.T) {
+	r, _ := ring.New(100000, 0.01, ring.WithFastReset())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		buff := make([]byte, 4)
+		for i := 0; i < 20000; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+			if i%5000 == 0 {
+				r.Reset()
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			if s := r.String(); !stringFormat.MatchString(s) {
+				t.Errorf("%q does not match the format", s)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+// verboseFormat matches the guaranteed parts of %+v, which is String with the
+// estimated false positive rate.
+var verboseFormat = regexp.MustCompile(`^ring\(m=(\d+) bits, k=(\d+), fill=[\d.]+%, ~est [\d.]+[kMGT]? items, ~fp ([\d.e+-]+)\)$`)
+
+// TestFormat snapshots each verb, matching the unstable fields of %+v.
+func TestFormat(t *testing.T) {
+	r, _ := ring.New(10000, 0.01, ring.WithSeed(3))
+	buff := make([]byte, 4)
+	for i := 0; i < 10000; i++ {
+		intToByte(buff, i)
+		r.Add(buff)
+	}
+	p := r.Parameters()
+	for verb, want := range map[string]string{
+		"%v":  r.String(),
+		"%s":  r.String(),
+		"%q":  strconv.Quote(r.String()),
+		"%#v": fmt.Sprintf("ring.Ring(%#v)", p),
+		"%d":  "%!d(" + r.String() + ")",
+	} {
+		if s := fmt.Sprintf(verb, r); s != want {
+			t.Errorf("%s: %q, expected %q", verb, s, want)
+		}
+	}
+	s := fmt.Sprintf("%+v", r)
+	match := verboseFormat.FindStringSubmatch(s)
+	if match == nil {
+		t.Fatalf("%q does not match the format", s)
+	}
+	if match[1] != strconv.FormatUint(p.Bits, 10) || match[2] != strconv.FormatUint(p.HashRounds, 10) {
+		t.Fatalf("%q does not hold the parameters %+v", s, p)
+	}
+	if fp, err := strconv.ParseFloat(match[3], 64); err != nil || fp < 0.005 || fp > 0.015 {
+		t.Fatalf("%q: expected a false positive rate of about 0.01", s)
+	}
+}
+
+// TestFormatZero ensures every verb is safe on zero and nil rings.
+func TestFormatZero(t *testing.T) {
+	var nilRing *ring.Ring
+	for _, r := range []*ring.Ring{new(ring.Ring), nilRing} {
+		for _, verb := range []string{"%v", "%+v", "%s"} {
+			if s := fmt.Sprintf(verb, r); s != "ring(uninitialized)" {
+				t.Errorf("%s: %q", verb, s)
+			}
+		}
+		if s := fmt.Sprintf("%q", r); s != `"ring(uninitialized)"` {
+			t.Errorf("%%q: %q", s)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// WithGroundTruth checks a sampleRate fraction of tests, above 0 and at most
+// 1, against an exact set of the data added, counting the sampled tests along
+// with their true and false positives in Metrics, so the false positive rate
+// of a ring is measured in production rather than predicted.
+//
+// Data is sampled by its hash, so the set holds only the added data a sampled
+// test could ask for, at most capacity of them, 16 bytes each plus the
+// overhead of a map. Once the set is full, the sample rate is halved, dropping
+// the data it no longer samples, so the set stays both exact and bounded.
+// Sampled tests take a mutex of their own, and tests not sampled cost a hash
+// comparison; rings without the Option pay a single nil check per Add and
+// Test.
+//
+// Reset and Release empty the set along with the ring. Merge, UnmarshalBinary,
+// ApplyChunks and AddToAll add data the set cannot know, so tests are no
+// longer checked until the next Reset.
+func WithGroundTruth(sampleRate float64, capacity int) Option {
+	return func(o *options) {
+		o.truthRate = sampleRate
+		o.truthCapacity = capacity
+	}
+}
+
+// validateTruth returns a description of each invalid ground truth option.
+func (o *options) validateTruth() []string {
+	if o.truthRate == 0 && o.truthCapacity == 0 {
+		return nil
+	}
+	var problems []string
+	if !(o.truthRate > 0 && o.truthRate <= 1) {
+		problems = append(problems, fmt.Sprintf("WithGroundTruth(%g) is outside 0 to 1", o.truthRate))
+	}
+	if o.truthCapacity < 1 {
+		problems = append(problems, fmt.Sprintf("WithGroundTruth holds %d data, fewer than 1", o.truthCapacity))
+	}
+	return problems
+}
+
+// groundTruth holds the sampled data added to a ring, and the outcome of the
+// sampled tests.
+type groundTruth struct {
+	mutex     sync.Mutex             // guards added, stale and counts
+	threshold atomic.Uint64          // largest sampling hash sampled, lowered under mutex
+	capacity  int                    // largest number of data held
+	added     map[[2]uint64]struct{} // sampled data added, by hash
+	stale     bool                   // data was added without its hash
+	counts    [3]uint64              // sampled tests, true and false positives
+}
+
+// newGroundTruth returns the ground truth of the options, or nil without
+// WithGroundTruth.
+func newGroundTruth(o *options) *groundTruth {
+	if o.truthRate == 0 {
+		return nil
+	}
+	g := &groundTruth{capacity: o.truthCapacity, added: make(map[[2]uint64]struct{})}
+	if t := math.Ldexp(o.truthRate, 64); t < math.Ldexp(1, 64) {
+		g.threshold.Store(uint64(t))
+	} else {
+		g.threshold.Store(math.MaxUint64)
+	}
+	return g
+}
+
+// clone returns an empty ground truth at the sample rate of g, or nil for nil.
+func (g *groundTruth) clone() *groundTruth {
+	if g == nil {
+		return nil
+	}
+	c := &groundTruth{capacity: g.capacity, added: make(map[[2]uint64]struct{})}
+	c.threshold.Store(g.threshold.Load())
+	return c
+}
+
+// key returns the key of the data of the hash rounds in the set, and the hash
+// deciding if it is sampled. The sampling hash is mixed from every round, so
+// sampled data spreads over the bit array like any other.
+func truthKey(hash *rounds) ([2]uint64, uint64) {
+	return [2]uint64{hash.base[0], hash.base[1]}, sampleHash(hash.base[0], hash.base[1])
+}
+
+// sampleHash returns the hash deciding if the data of the key is sampled.
+func sampleHash(h1, h2 uint64) uint64 {
+	return fmix(h1 ^ fmix(h2^murmur64c2))
+}
+
+// add records the data of the hash rounds, if sampled, halving the sample
+// rate until it fits.
+func (g *groundTruth) add(hash *rounds) {
+	key, h := truthKey(hash)
+	if h > g.threshold.Load() {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if h > g.threshold.Load() {
+		return
+	}
+	g.added[key] = struct{}{}
+	for len(g.added) > g.capacity {
+		threshold := g.threshold.Load() / 2
+		g.threshold.Store(threshold)
+		for k := range g.added {
+			if sampleHash(k[0], k[1]) > threshold {
+				delete(g.added, k)
+			}
+		}
+	}
+}
+
+// observe counts a test of the data of the hash rounds reporting hit, if
+// sampled.
+func (g *groundTruth) observe(hash *rounds, hit bool) {
+	key, h := truthKey(hash)
+	if h > g.threshold.Load() {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	// the threshold only decreases, so it is compared again under the mutex
+	if h > g.threshold.Load() || g.stale {
+		return
+	}
+	g.counts[0]++
+	if !hit {
+		return
+	}
+	if _, ok := g.added[key]; ok {
+		g.counts[1]++
+	} else {
+		g.counts[2]++
+	}
+}
+
+// clear empties the set, once the ring is cleared.
+func (g *groundTruth) clear() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.added = make(map[[2]uint64]struct{})
+	g.stale = false
+}
+
+// invalidate stops checking tests, once data is added without its hash.
+func (g *groundTruth) invalidate() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.added = make(map[[2]uint64]struct{})
+	g.stale = true
+}
+
+// resetCounts sets the counts of the sampled tests to zero.
+func (g *groundTruth) resetCounts() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.counts = [3]uint64{}
+}
+
+// fill copies the counts of the sampled tests into m.
+func (g *groundTruth) fill(m *Metrics) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	m.SampledTests, m.TruePositives, m.FalsePositives = g.counts[0], g.counts[1], g.counts[2]
+}
+
+// clearTruth empties the ground truth of the ring, if any, once the ring is
+// cleared.
+func (r *Ring) clearTruth() {
+	if r.truth != nil {
+		r.truth.clear()
+	}
+}
+
+// invalidateTruth stops checking tests against the ground truth of the ring,
+// if any, once data is added without its hash.
+func (r *Ring) invalidateTruth() {
+	if r.truth != nil {
+		r.truth.invalidate()
+	}
+}
+
+// MeasuredFalsePositive returns the false positive rate measured by
+// WithGroundTruth: the fraction of sampled tests of data never added reported
+// present. It is 0 until such a test is sampled.
+func (m Metrics) MeasuredFalsePositive() float64 {
+	negatives := m.SampledTests - m.TruePositives
+	if negatives == 0 {
+		return 0
+	}
+	return float64(m.FalsePositives) / float64(negatives)
+}
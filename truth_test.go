@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// truthWorkload adds keys to a ring with ground truth and a copy without it,
+// then tests the added keys and absent ones against the former, returning the
+// false positive rate of the copy over the absent keys, computed offline.
+func truthWorkload(t *testing.T, rate float64, capacity int) (*ring.Ring, float64) {
+	r, err := ring.Init(20000, 0.05, ring.WithGroundTruth(rate, capacity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	offline, _ := ring.Init(20000, 0.05)
+	added := ring.RandomKeys(20000, 1)
+	for _, key := range added {
+		r.Add(key)
+		offline.Add(key)
+	}
+	absent := ring.RandomKeys(200000, 2)
+	var positives int
+	for _, key := range absent {
+		if offline.Test(key) {
+			positives++
+		}
+	}
+	for _, key := range added {
+		if !r.Test(key) {
+			t.Fatal("false negative")
+		}
+	}
+	for _, key := range absent {
+		r.Test(key)
+	}
+	return r, float64(positives) / float64(len(absent))
+}
+
+// TestGroundTruthMeasured ensures the measured false positive rate is near
+// that of the filter, and that data added is never counted as a false
+// positive, at several sample rates and with a set too small for them.
+func TestGroundTruthMeasured(t *testing.T) {
+	for _, c := range []struct {
+		rate     float64
+		capacity int
+	}{{1, 1 << 20}, {0.25, 1 << 20}, {1, 1000}} {
+		r, actual := truthWorkload(t, c.rate, c.capacity)
+		m := r.Metrics()
+		negatives := m.SampledTests - m.TruePositives
+		measured := m.MeasuredFalsePositive()
+		// within 4 standard deviations of the rate over the sampled negatives
+		if sd := math.Sqrt(actual * (1 - actual) / float64(negatives)); math.Abs(measured-actual) > 4*sd {
+			t.Fatalf("rate %g, capacity %d: measured %g over %d negatives, actual %g",
+				c.rate, c.capacity, measured, negatives, actual)
+		}
+		if c.capacity > 20000 {
+			// every added key is held, so sampled as it is tested
+			want := c.rate * 20000
+			if math.Abs(float64(m.TruePositives)-want) > 4*math.Sqrt(want) {
+				t.Fatalf("rate %g: %d true positives, expected about %g", c.rate, m.TruePositives, want)
+			}
+		}
+		if m.Tests != 0 || m.Adds != 0 {
+			t.Fatal("expected no operation counts without EnableCounters")
+		}
+	}
+}
+
+// TestGroundTruthExact ensures tests of added data are only ever counted as
+// true positives, even once the set has lowered its sample rate.
+func TestGroundTruthExact(t *testing.T) {
+	r, _ := ring.Init(10000, 0.01, ring.WithGroundTruth(1, 100))
+	keys := ring.RandomKeys(10000, 3)
+	for _, key := range keys {
+		r.Add(key)
+	}
+	for _, key := range keys {
+		r.Test(key)
+	}
+	m := r.Metrics()
+	if m.SampledTests == 0 || m.SampledTests > 200 || m.TruePositives != m.SampledTests || m.FalsePositives != 0 {
+		t.Fatalf("unexpected metrics %+v", m)
+	}
+	r.ResetMetrics()
+	if m := r.Metrics(); m.SampledTests != 0 || m.MeasuredFalsePositive() != 0 {
+		t.Fatalf("unexpected metrics after ResetMetrics %+v", m)
+	}
+}
+
+// TestGroundTruthStale ensures tests are no longer checked once data is merged
+// into the ring, until Reset.
+func TestGroundTruthStale(t *testing.T) {
+	r, _ := ring.Init(1000, 0.01, ring.WithGroundTruth(1, 1000))
+	other, _ := ring.Init(1000, 0.01)
+	other.Add([]byte("merged"))
+	if err := r.Merge(other); err != nil {
+		t.Fatal(err)
+	}
+	r.Test([]byte("merged"))
+	if m := r.Metrics(); m.SampledTests != 0 {
+		t.Fatalf("unexpected metrics after Merge %+v", m)
+	}
+	r.Reset()
+	r.Add([]byte("added"))
+	r.Test([]byte("added"))
+	r.Test([]byte("merged"))
+	if m := r.Metrics(); m.SampledTests != 2 || m.TruePositives != 1 || m.FalsePositives != 0 {
+		t.Fatalf("unexpected metrics after Reset %+v", m)
+	}
+	for _, opt := range []ring.Option{
+		ring.WithGroundTruth(0, 10),
+		ring.WithGroundTruth(1.5, 10),
+		ring.WithGroundTruth(math.NaN(), 10),
+		ring.WithGroundTruth(0.5, 0),
+	} {
+		if _, err := ring.Init(1000, 0.01, opt); !errors.Is(err, ring.ErrOptions) {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "encoding/binary"
+
+// Typed is a view of a ring holding values of type T, each added and tested as
+// the bytes of a single encoding, so call sites cannot encode a value one way
+// for Add and another for Test. Values are encoded into a scratch buffer reused
+// across calls, so a Typed is not safe for concurrent use; views are cheap, and
+// any number of views over one ring may be used concurrently, one per
+// goroutine.
+type Typed[T any] struct {
+	ring    *Ring
+	encode  func(T, []byte) []byte
+	scratch []byte
+}
+
+// OfFunc returns a view of the ring holding values of type T, encoded by
+// appending their bytes to the slice passed to encode. The encoding must be
+// deterministic, and views over one ring must share it.
+func OfFunc[T any](r *Ring, encode func(T, []byte) []byte) *Typed[T] {
+	return &Typed[T]{ring: r, encode: encode}
+}
+
+// OfString returns a view of the ring holding strings, encoded as their bytes,
+// so it agrees with Add([]byte(s)) on the ring.
+func OfString(r *Ring) *Typed[string] {
+	return OfFunc(r, func(s string, buf []byte) []byte {
+		return append(buf, s...)
+	})
+}
+
+// OfUint64 returns a view of the ring holding integers, encoded as 8 bytes in
+// big endian order.
+func OfUint64(r *Ring) *Typed[uint64] {
+	return OfFunc(r, func(v uint64, buf []byte) []byte {
+		return binary.BigEndian.AppendUint64(buf, v)
+	})
+}
+
+// OfBytes returns a view of the ring holding byte slices, encoded as
+// themselves.
+func OfBytes(r *Ring) *Typed[[]byte] {
+	return OfFunc(r, func(b []byte, buf []byte) []byte {
+		return append(buf, b...)
+	})
+}
+
+// Ring returns the ring of the view.
+func (t *Typed[T]) Ring() *Ring {
+	return t.ring
+}
+
+// bytes returns the encoding of v, in the scratch buffer.
+func (t *Typed[T]) bytes(v T) []byte {
+	t.scratch = t.encode(v, t.scratch[:0])
+	return t.scratch
+}
+
+// Add adds the value to the ring.
+func (t *Typed[T]) Add(v T) {
+	t.ring.Add(t.bytes(v))
+}
+
+// Test returns if the value may be in the ring, as Test of the ring.
+func (t *Typed[T]) Test(v T) bool {
+	return t.ring.Test(t.bytes(v))
+}
+
+// TestAndAdd adds the value to the ring, returning if it may have been in the
+// ring already. The test and the add are atomic with respect to other writers.
+func (t *Typed[T]) TestAndAdd(v T) bool {
+	return t.ring.testAndAdd(t.bytes(v))
+}
+
+// TestAndAdd adds the data to the ring, returning if it may have been in the
+// ring already, as Test before the Add. The test and the add are atomic with
+// respect to other writers, unless the ring uses WithNoLock, so of concurrent
+// calls with the same data exactly one returns false. Data added to a zero
+// Ring is discarded, and reported absent.
+func (r *Ring) TestAndAdd(data []byte) bool {
+	return r.testAndAdd(data)
+}
+
+// testAndAdd adds the data to the ring, returning if it was reported present
+// beforehand. Data added to a zero Ring is discarded.
+func (r *Ring) testAndAdd(data []byte) bool {
+	b := r.set.Load()
+	if b == nil {
+		return false
+	}
+	p := b.params
+	hash := p.rounds(data)
+	r.lock()
+	defer r.unlock()
+	b = r.set.Load()
+	if b.params != p {
+		// replaced by UnmarshalBinary or Reset in the meantime, with other
+		// flags or another seed
+		hash = b.rounds(data)
+	}
+	if r.countTest(&hash, b.test(&hash)) {
+		return true
+	}
+	r.addRounds(b, &hash)
+	return false
+}
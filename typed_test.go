@@ -0,0 +1,150 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestTyped ensures typed views and the raw ring agree on membership of the
+// same logical keys, in both directions.
+func TestTyped(t *testing.T) {
+	r, _ := ring.New(10000, 0.01)
+	strs, ints, raw := ring.OfString(r), ring.OfUint64(r), ring.OfBytes(r)
+	type uuid [16]byte
+	uuids := ring.OfFunc(r, func(u uuid, buf []byte) []byte {
+		return append(buf, u[:]...)
+	})
+	for i := 0; i < 1000; i++ {
+		strs.Add("user-" + strconv.Itoa(i))
+		r.Add(binary.BigEndian.AppendUint64(nil, uint64(i)))
+		raw.Add([]byte("raw-" + strconv.Itoa(i)))
+		uuids.Add(uuid{byte(i), byte(i >> 8), 1})
+	}
+	for i := 0; i < 1000; i++ {
+		if !r.Test([]byte("user-"+strconv.Itoa(i))) || !strs.Test("user-"+strconv.Itoa(i)) {
+			t.Fatalf("string %d missing", i)
+		}
+		if !ints.Test(uint64(i)) {
+			t.Fatalf("integer %d missing", i)
+		}
+		if !r.Test([]byte("raw-"+strconv.Itoa(i))) || !raw.Test([]byte("raw-"+strconv.Itoa(i))) {
+			t.Fatalf("bytes %d missing", i)
+		}
+		u := uuid{byte(i), byte(i >> 8), 1}
+		if !r.Test(u[:]) || !uuids.Test(u) {
+			t.Fatalf("uuid %d missing", i)
+		}
+	}
+	// every view agrees with the raw ring on absent keys too
+	for i := 1000; i < 100000; i++ {
+		s := "user-" + strconv.Itoa(i)
+		if strs.Test(s) != r.Test([]byte(s)) {
+			t.Fatalf("string %d: view and ring disagree", i)
+		}
+		if ints.Test(uint64(i)) != r.Test(binary.BigEndian.AppendUint64(nil, uint64(i))) {
+			t.Fatalf("integer %d: view and ring disagree", i)
+		}
+	}
+}
+
+// TestTypedTestAndAdd ensures TestAndAdd reports prior membership and adds.
+func TestTypedTestAndAdd(t *testing.T) {
+	r, _ := ring.New(10000, 0.001)
+	strs := ring.OfString(r)
+	if strs.TestAndAdd("a") {
+		t.Fatal("a reported present before its add")
+	}
+	if !strs.TestAndAdd("a") || !r.Test([]byte("a")) {
+		t.Fatal("a missing after TestAndAdd")
+	}
+	var zero ring.Ring
+	if ring.OfString(&zero).TestAndAdd("a") {
+		t.Fatal("zero ring reported a present")
+	}
+}
+
+// TestRingTestAndAdd ensures exactly one of concurrent TestAndAdd calls of the
+// same data reports it absent.
+func TestRingTestAndAdd(t *testing.T) {
+	r, _ := ring.New(10000, 0.001)
+	var absent int32
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !r.TestAndAdd([]byte("a")) {
+				atomic.AddInt32(&absent, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if absent != 1 {
+		t.Fatalf("%d calls reported a absent", absent)
+	}
+}
+
+// TestTypedAllocs ensures typed views do not allocate once their scratch
+// buffer has grown.
+func TestTypedAllocs(t *testing.T) {
+	r, _ := ring.New(10000, 0.01)
+	strs, ints := ring.OfString(r), ring.OfUint64(r)
+	key := "some key of moderate length"
+	strs.Add(key)
+	ints.Add(1)
+	if n := testing.AllocsPerRun(100, func() {
+		strs.Add(key)
+		strs.Test(key)
+		strs.TestAndAdd(key)
+		ints.Add(7)
+		ints.Test(7)
+	}); n != 0 {
+		t.Fatalf("%g allocations per run", n)
+	}
+}
+
+// TestTypedConcurrent ensures two views over one ring are safe to use
+// concurrently, which the race detector verifies, and that TestAndAdd admits
+// each key exactly once between them.
+func TestTypedConcurrent(t *testing.T) {
+	r, _ := ring.New(100000, 0.0001)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	admitted := 0
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ints := ring.OfUint64(r)
+			n := 0
+			for i := uint64(0); i < 20000; i++ {
+				if !ints.TestAndAdd(i) {
+					n++
+				}
+			}
+			mu.Lock()
+			admitted += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	// false positives may only lower the count
+	if admitted > 20000 || admitted < 19990 {
+		t.Fatalf("%d keys admitted, expected 20000", admitted)
+	}
+	ints := ring.OfUint64(r)
+	for i := uint64(0); i < 20000; i++ {
+		if !ints.Test(i) {
+			t.Fatalf("%d missing", i)
+		}
+	}
+}
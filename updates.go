@@ -0,0 +1,141 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrLogTruncated is returned by Updates when updates since the sequence
+	// number are no longer held, so the follower must load a snapshot.
+	ErrLogTruncated = errors.New("error: update log is truncated")
+	// ErrNoUpdateLog is returned by Updates of a ring without WithUpdateLog.
+	ErrNoUpdateLog = errors.New("error: ring has no update log")
+)
+
+// Update is an addition to a ring, as logged by WithUpdateLog. Hash holds the
+// hash rounds of the data for the parameters of the ring, so an update only
+// applies to rings of the same parameters, such as replicas loaded from a
+// snapshot of the ring.
+type Update struct {
+	Seq  uint64    // sequence number of the update
+	Hash [4]uint64 // hash rounds of the data added
+}
+
+// updateLog holds the latest updates of a ring in a ring buffer. It is written
+// under the write lock and read under the read lock.
+type updateLog struct {
+	seq     uint64      // sequence number of the latest update or truncation
+	first   uint64      // sequence number of the oldest update held
+	entries [][4]uint64 // updates, the one of sequence number s at s%len
+}
+
+// newUpdateLog returns a log of the latest size updates, or nil if size is 0.
+func newUpdateLog(size int) *updateLog {
+	if size == 0 {
+		return nil
+	}
+	return &updateLog{first: 1, entries: make([][4]uint64, size)}
+}
+
+// clone returns an empty log of the same size, or nil if l is nil.
+func (l *updateLog) clone() *updateLog {
+	if l == nil {
+		return nil
+	}
+	return newUpdateLog(len(l.entries))
+}
+
+// append logs an update of the hash rounds, overwriting the oldest once full.
+func (l *updateLog) append(hash *rounds) {
+	l.seq++
+	l.entries[l.seq%uint64(len(l.entries))] = [4]uint64{hash.base[0], hash.base[1], hash.step[0], hash.step[1]}
+	if l.seq-l.first >= uint64(len(l.entries)) {
+		l.first++
+	}
+}
+
+// truncate drops every update, after writes the log cannot express. The
+// truncation takes a sequence number, so followers that had applied every
+// update are behind it.
+func (l *updateLog) truncate() {
+	l.seq++
+	l.first = l.seq + 1
+}
+
+// truncateUpdates truncates the log of the ring, if any. The write lock must be
+// held.
+func (r *Ring) truncateUpdates() {
+	if r.updates != nil {
+		r.updates.truncate()
+	}
+}
+
+// WithUpdateLog keeps the latest size additions to the ring in a log, each
+// numbered by a sequence number, so read replicas can follow the ring with
+// Updates and ApplyUpdates rather than reloading it. Each addition costs 32
+// bytes of the log, allocated once, and no allocation to append. Writes the log
+// cannot express, those of Reset, Merge, UnmarshalBinary, ApplyChunks,
+// AddToAll and Release, truncate it, as do additions outpacing a follower by
+// more than size.
+func WithUpdateLog(size int) Option {
+	return func(o *options) {
+		o.updates = size
+	}
+}
+
+// Updates returns the updates of the ring after the sequence number since, and
+// the sequence number to pass to the next call. A follower holding a snapshot
+// of the ring applies them with ApplyUpdates to catch up.
+//
+// If updates since are no longer held, or since is ahead of the ring, as for a
+// ring restarted since, Updates returns ErrLogTruncated along with the current
+// sequence number: the follower loads a snapshot taken afterwards, and resumes
+// from that number. Updates only set bits, so a snapshot also holding some of
+// the updates after it is brought up to date all the same. Rings without
+// WithUpdateLog return ErrNoUpdateLog, and a zero Ring ErrUninitialized.
+func (r *Ring) Updates(since uint64) ([]Update, uint64, error) {
+	if r.set.Load() == nil {
+		return nil, 0, ErrUninitialized
+	}
+	if r.updates == nil {
+		return nil, 0, ErrNoUpdateLog
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	l := r.updates
+	if since > l.seq || since+1 < l.first {
+		return nil, l.seq, fmt.Errorf("%w: updates after %d of %d to %d", ErrLogTruncated, since, l.first, l.seq)
+	}
+	updates := make([]Update, 0, l.seq-since)
+	for seq := since + 1; seq <= l.seq; seq++ {
+		updates = append(updates, Update{Seq: seq, Hash: l.entries[seq%uint64(len(l.entries))]})
+	}
+	return updates, l.seq, nil
+}
+
+// ApplyUpdates adds the data of each update, as returned by Updates of a ring
+// with the same parameters, under a single write lock. Updates may be applied
+// more than once, and in any order, leaving the same bits; updates of a ring
+// of other parameters set bits unrelated to its data. Updates applied are
+// logged anew by a ring with WithUpdateLog, so followers can be chained. A zero
+// Ring returns ErrUninitialized.
+func (r *Ring) ApplyUpdates(updates []Update) error {
+	if r.set.Load() == nil {
+		return ErrUninitialized
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	r.lock()
+	defer r.unlock()
+	for i := range updates {
+		hash := newRounds(updates[i].Hash)
+		r.addRounds(r.set.Load(), &hash)
+	}
+	return nil
+}
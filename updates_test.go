@@ -0,0 +1,148 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// follow brings the follower up to date with the primary from the sequence
+// number since, loading a snapshot if the log is truncated, and returns the
+// sequence number to resume from and whether a snapshot was loaded.
+func follow(t *testing.T, primary, follower *ring.Ring, since uint64) (uint64, bool) {
+	t.Helper()
+	updates, next, err := primary.Updates(since)
+	if errors.Is(err, ring.ErrLogTruncated) {
+		data, err := primary.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := follower.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		return next, true
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) > 0 && (updates[0].Seq != since+1 || updates[len(updates)-1].Seq != next) {
+		t.Fatalf("updates %d to %d after %d, next %d", updates[0].Seq, updates[len(updates)-1].Seq, since, next)
+	}
+	if err := follower.ApplyUpdates(updates); err != nil {
+		t.Fatal(err)
+	}
+	return next, false
+}
+
+// TestUpdates ensures a follower catches up incrementally, survives truncation
+// of the log by a snapshot, and holds the same bits as the primary throughout.
+func TestUpdates(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithSeed(7)}, {ring.WithPartitioned(), ring.WithOneHash()}, {ring.WithBlocked()}} {
+		primary, _ := ring.Init(10000, 0.01, append(opts, ring.WithUpdateLog(100))...)
+		follower, _ := ring.Init(10000, 0.01, opts...)
+		var since uint64
+		snapshot := false
+		add := func(from, to int) {
+			for i := from; i < to; i++ {
+				primary.Add([]byte(strconv.Itoa(i)))
+			}
+		}
+
+		add(0, 50)
+		if since, snapshot = follow(t, primary, follower, since); snapshot || since != 50 {
+			t.Fatalf("caught up to %d, snapshot %v", since, snapshot)
+		}
+		if !follower.Equal(primary) {
+			t.Fatal("follower differs after catching up")
+		}
+		add(50, 140)
+		if since, snapshot = follow(t, primary, follower, since); snapshot || since != 140 {
+			t.Fatalf("caught up to %d, snapshot %v", since, snapshot)
+		}
+
+		// outpaced by more than the log holds
+		add(140, 300)
+		if since, snapshot = follow(t, primary, follower, since); !snapshot {
+			t.Fatal("no snapshot after the log was outpaced")
+		}
+		add(300, 310)
+		if since, snapshot = follow(t, primary, follower, since); snapshot || since != 310 {
+			t.Fatalf("resumed to %d, snapshot %v", since, snapshot)
+		}
+		if !follower.Equal(primary) {
+			t.Fatal("follower differs after resuming")
+		}
+
+		// writes the log cannot express truncate it
+		primary.Reset()
+		primary.Add([]byte("after reset"))
+		if since, snapshot = follow(t, primary, follower, since); !snapshot {
+			t.Fatal("no snapshot after Reset")
+		}
+		if _, snapshot = follow(t, primary, follower, since); snapshot {
+			t.Fatal("snapshot after resuming from Reset")
+		}
+		if !follower.Equal(primary) || follower.Test([]byte("0")) {
+			t.Fatal("follower differs after Reset")
+		}
+	}
+}
+
+// TestApplyUpdatesChained ensures updates may be applied twice, and are logged
+// anew by followers with a log of their own.
+func TestApplyUpdatesChained(t *testing.T) {
+	primary, _ := ring.Init(1000, 0.01, ring.WithUpdateLog(10))
+	middle, _ := ring.Init(1000, 0.01, ring.WithUpdateLog(10))
+	last, _ := ring.Init(1000, 0.01)
+	primary.Add([]byte("a"))
+	primary.Add([]byte("b"))
+	updates, _, _ := primary.Updates(0)
+	middle.ApplyUpdates(updates)
+	middle.ApplyUpdates(updates[1:])
+	chained, next, err := middle.Updates(0)
+	if err != nil || next != 3 || len(chained) != 3 {
+		t.Fatalf("unexpected updates of the follower: %d to %d, %v", len(chained), next, err)
+	}
+	last.ApplyUpdates(chained)
+	if !last.Equal(primary) || !last.Test([]byte("b")) {
+		t.Fatal("chained follower differs")
+	}
+}
+
+// TestUpdatesInvalid ensures rings without a log, zero Rings and sequence
+// numbers ahead of the ring are rejected.
+func TestUpdatesInvalid(t *testing.T) {
+	r, _ := ring.Init(1000, 0.01)
+	if _, _, err := r.Updates(0); !errors.Is(err, ring.ErrNoUpdateLog) {
+		t.Fatalf("expected ErrNoUpdateLog, got %v", err)
+	}
+	if _, _, err := new(ring.Ring).Updates(0); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+	if err := new(ring.Ring).ApplyUpdates(nil); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+	logged, _ := ring.Init(1000, 0.01, ring.WithUpdateLog(10))
+	logged.Add([]byte("a"))
+	if _, next, err := logged.Updates(5); !errors.Is(err, ring.ErrLogTruncated) || next != 1 {
+		t.Fatalf("expected ErrLogTruncated at 1, got %d, %v", next, err)
+	}
+	if _, err := ring.Init(1000, 0.01, ring.WithUpdateLog(-1)); !errors.Is(err, ring.ErrOptions) {
+		t.Fatalf("expected ErrOptions, got %v", err)
+	}
+}
+
+// TestUpdateLogAllocs ensures additions are logged without allocating.
+func TestUpdateLogAllocs(t *testing.T) {
+	r, _ := ring.Init(1000, 0.01, ring.WithUpdateLog(10))
+	data := []byte("data")
+	if allocs := testing.AllocsPerRun(100, func() { r.Add(data) }); allocs != 0 {
+		t.Fatalf("Add allocated %v times", allocs)
+	}
+}
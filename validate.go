@@ -0,0 +1,71 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "math/rand"
+
+// ValidateAgainst returns the fraction of the absent data reported present by
+// Test, the measured false positive rate of the ring if none of the data was
+// added, such as the keys of RandomKeys. All data is tested against the ring
+// as it was when the call began, under a single read lock. Tooling can compare
+// it to the configured rate before trusting a ring, allowing for sampling
+// noise: for n data at rate p, about 3*sqrt(p/n). It is 0 without data.
+func (r *Ring) ValidateAgainst(absent [][]byte) (measuredFP float64) {
+	if len(absent) == 0 {
+		return 0
+	}
+	positives := 0
+	r.probe(absent, func(found bool) {
+		if found {
+			positives++
+		}
+	})
+	return float64(positives) / float64(len(absent))
+}
+
+// ValidateMembership returns the number of the present data not reported
+// present by Test, which is 0 for a ring holding all of it: a ring has no
+// false negatives, so any missing data was never added, or was cleared by a
+// Reset. All data is tested as with ValidateAgainst.
+func (r *Ring) ValidateMembership(present [][]byte) (missing int) {
+	r.probe(present, func(found bool) {
+		if !found {
+			missing++
+		}
+	})
+	return missing
+}
+
+// probe calls fn with the outcome of Test for each data, under a single read
+// lock, against a single bit array. A zero Ring holds no data.
+func (r *Ring) probe(data [][]byte, fn func(bool)) {
+	if r.set.Load() == nil {
+		for range data {
+			fn(false)
+		}
+		return
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	b := r.set.Load()
+	for _, d := range data {
+		hash := b.rounds(d)
+		fn(b.test(&hash))
+	}
+}
+
+// RandomKeys returns n random keys of 16 bytes from the seed, which are absent
+// from a ring that was not given them, with overwhelming probability, for
+// ValidateAgainst. The same seed gives the same keys.
+func RandomKeys(n int, seed int64) [][]byte {
+	rng := rand.New(rand.NewSource(seed))
+	buf := make([]byte, 16*n)
+	rng.Read(buf)
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = buf[i*16 : (i+1)*16 : (i+1)*16]
+	}
+	return keys
+}
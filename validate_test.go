@@ -0,0 +1,58 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestValidateAgainst ensures a ring holding its designed number of elements
+// passes a gate at twice its rate, and an overfilled ring fails it.
+func TestValidateAgainst(t *testing.T) {
+	const fp = 0.01
+	absent := ring.RandomKeys(100000, 1)
+	for _, c := range []struct {
+		added int
+		pass  bool
+	}{{0, true}, {1000, true}, {3000, false}, {10000, false}} {
+		r, _ := ring.Init(1000, fp)
+		present := ring.RandomKeys(c.added, 2)
+		for _, key := range present {
+			r.Add(key)
+		}
+		if missing := r.ValidateMembership(present); missing != 0 {
+			t.Fatalf("%d elements: %d missing", c.added, missing)
+		}
+		measured := r.ValidateAgainst(absent)
+		if pass := measured <= 2*fp; pass != c.pass {
+			t.Fatalf("%d elements: measured rate %f, expected to pass the gate: %v", c.added, measured, c.pass)
+		}
+	}
+}
+
+// TestValidateZero ensures a zero ring has no false positives and misses all
+// data, and that no data measures no rate.
+func TestValidateZero(t *testing.T) {
+	var r ring.Ring
+	keys := ring.RandomKeys(10, 1)
+	if r.ValidateAgainst(keys) != 0 || r.ValidateMembership(keys) != 10 || r.ValidateAgainst(nil) != 0 {
+		t.Fatal("zero ring holds data")
+	}
+}
+
+// TestRandomKeys ensures keys are distinct, and reproducible from their seed.
+func TestRandomKeys(t *testing.T) {
+	a, b, c := ring.RandomKeys(1000, 1), ring.RandomKeys(1000, 1), ring.RandomKeys(1000, 2)
+	seen := map[string]bool{}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) || bytes.Equal(a[i], c[i]) || len(a[i]) != 16 || seen[string(a[i])] {
+			t.Fatalf("key %d is not reproducible and distinct", i)
+		}
+		seen[string(a[i])] = true
+	}
+}
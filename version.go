@@ -0,0 +1,26 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+// Version returns the version of the ring, a sequence number advanced by every
+// write: Add and its variants, Merge, Reset, UnmarshalBinary and Release. Equal
+// versions of a ring hold equal bits, while a write may advance the version
+// without changing any bit, as when adding data already present. Versions are
+// not marshaled, and are not comparable between rings. Rings using WithNoLock
+// advance the version without synchronization.
+func (r *Ring) Version() uint64 {
+	return r.version.Load()
+}
+
+// MarshalBinaryVersion returns the binary form of MarshalBinary together with
+// the version of the ring it holds, read under the same lock.
+func (r *Ring) MarshalBinaryVersion() ([]byte, uint64, error) {
+	if r.set.Load() == nil {
+		return nil, 0, ErrUninitialized
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.countMarshaled(r.set.Load().marshal()), r.version.Load(), nil
+}
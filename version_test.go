@@ -0,0 +1,73 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestVersion ensures every write advances the version, and reads do not.
+func TestVersion(t *testing.T) {
+	r, _ := ring.New(1000, 0.01)
+	other, _ := ring.New(1000, 0.01)
+	data, _ := other.MarshalBinary()
+	last := r.Version()
+	for _, c := range []struct {
+		name  string
+		write bool
+		op    func()
+	}{
+		{"Add", true, func() { r.Add([]byte("a")) }},
+		{"AddHash", true, func() { r.AddHash(ring.NewDigest([]byte("b"))) }},
+		{"AddString", true, func() { r.AddString("c") }},
+		{"Merge", true, func() { r.Merge(other) }},
+		{"Reset", true, func() { r.Reset() }},
+		{"UnmarshalBinary", true, func() { r.UnmarshalBinary(data) }},
+		{"Test", false, func() { r.Test([]byte("a")) }},
+		{"MarshalBinary", false, func() { r.MarshalBinary() }},
+		{"Stats", false, func() { r.Stats() }},
+	} {
+		c.op()
+		if v := r.Version(); (v > last) != c.write {
+			t.Errorf("%s: version %d after %d", c.name, v, last)
+		}
+		last = r.Version()
+	}
+}
+
+// TestMarshalBinaryVersion ensures the binary form and version are read
+// together, under concurrent writes.
+func TestMarshalBinaryVersion(t *testing.T) {
+	r, _ := ring.New(1000, 0.01)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buff := make([]byte, 4)
+		for i := 0; i < 1000; i++ {
+			intToByte(buff, i)
+			r.Add(buff)
+		}
+	}()
+	seen := map[uint64][]byte{}
+	for i := 0; i < 200; i++ {
+		data, version, err := r.MarshalBinaryVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev, ok := seen[version]; ok && !bytes.Equal(prev, data) {
+			t.Fatalf("version %d holds different bits", version)
+		}
+		seen[version] = data
+	}
+	wg.Wait()
+	if _, _, err := new(ring.Ring).MarshalBinaryVersion(); err != ring.ErrUninitialized {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+}
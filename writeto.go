@@ -0,0 +1,102 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import "io"
+
+// writeBuffer is the number of bytes of the bit array WriteTo copies at once
+// from rings using WithFastReset, or writes at once from unallocated chunks.
+const writeBuffer = 64 << 10
+
+// MarshaledSize returns the length of the binary form of the ring, as written
+// by MarshalBinary and WriteTo, or 0 for a zero Ring. The length changes only
+// if the ring is replaced by UnmarshalBinary.
+func (r *Ring) MarshaledSize() int {
+	b := r.set.Load()
+	if b == nil {
+		return 0
+	}
+	var buf [maxHeader]byte
+	return len(b.header(&buf)) + int(b.length)
+}
+
+// WriteTo implements io.WriterTo, writing the binary form of MarshalBinary to
+// w. The allocated chunks of the bit array are copied under a read lock, which
+// is released before anything is written, so a slow w never blocks Add, Merge
+// or Reset. A zero Ring returns ErrUninitialized.
+func (r *Ring) WriteTo(w io.Writer) (int64, error) {
+	if r.set.Load() == nil {
+		return 0, ErrUninitialized
+	}
+	r.mutex.RLock()
+	b := r.set.Load().snapshot()
+	r.mutex.RUnlock()
+	var header [maxHeader]byte
+	n, err := w.Write(b.header(&header))
+	written := int64(n)
+	if err == nil {
+		var m int64
+		m, err = b.writeBits(w)
+		written += m
+	}
+	if c := r.counters.Load(); c != nil {
+		c.marshaled.Add(uint64(written))
+	}
+	return written, err
+}
+
+// snapshot returns a copy of the logical bits of b, leaving unallocated chunks
+// unallocated, for reading once writers are no longer excluded. The copy has no
+// summary. Writers must be excluded.
+func (b *bitset) snapshot() *bitset {
+	s := &bitset{params: b.params, length: b.length, chunks: make([][]uint8, len(b.chunks))}
+	for i, c := range b.chunks {
+		if c == nil {
+			continue
+		}
+		s.chunks[i] = append([]uint8(nil), c...)
+		b.clearStale(s.chunks[i], uint64(i)<<chunkShift)
+	}
+	return s
+}
+
+// writeBits writes the logical main bit array to w. Writers must be excluded.
+func (b *bitset) writeBits(w io.Writer) (int64, error) {
+	var written int64
+	var buf []byte
+	for i, c := range b.chunks {
+		start := uint64(i) << chunkShift
+		for offset, end := uint64(0), b.chunkLen(i); offset < end; {
+			piece := end - offset
+			if piece > writeBuffer {
+				piece = writeBuffer
+			}
+			var out []byte
+			if c != nil && b.stamps == nil {
+				out = c[offset : offset+piece]
+			} else {
+				if buf == nil {
+					buf = make([]byte, writeBuffer)
+				}
+				out = buf[:piece]
+				if c == nil {
+					for j := range out {
+						out[j] = 0
+					}
+				} else {
+					copy(out, c[offset:])
+					b.clearStale(out, start+offset)
+				}
+			}
+			n, err := w.Write(out)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			offset += piece
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tannerryan/ring"
+)
+
+// TestWriteTo ensures WriteTo writes the binary form of MarshalBinary, of the
+// length of MarshaledSize, in every mode.
+func TestWriteTo(t *testing.T) {
+	for _, opts := range [][]ring.Option{nil, {ring.WithSeed(9)}, {ring.WithPartitioned()}, {ring.WithFastReset()}} {
+		// large enough for the bit array to be written in several pieces
+		r, _ := ring.New(200000, 0.01, opts...)
+		buff := make([]byte, 4)
+		for round := 0; round < 3; round++ {
+			var buf bytes.Buffer
+			n, err := r.WriteTo(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := r.MarshalBinary()
+			if n != int64(len(want)) || r.MarshaledSize() != len(want) || !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("%d bytes written, %d expected of size %d", n, len(want), r.MarshaledSize())
+			}
+			// stale blocks of WithFastReset are written as zeros
+			for i := 0; i < 50000; i++ {
+				intToByte(buff, i+round*50000)
+				r.Add(buff)
+			}
+			if round == 1 {
+				r.Reset()
+			}
+		}
+	}
+	if _, err := new(ring.Ring).WriteTo(&bytes.Buffer{}); !errors.Is(err, ring.ErrUninitialized) {
+		t.Fatalf("expected ErrUninitialized, got %v", err)
+	}
+	if n := new(ring.Ring).MarshaledSize(); n != 0 {
+		t.Fatalf("zero ring of size %d", n)
+	}
+}
+
+// failingWriter accepts n bytes, and then fails.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("failed")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+// TestWriteToError ensures WriteTo stops at the first error of the writer, and
+// counts the bytes written before it.
+func TestWriteToError(t *testing.T) {
+	r, _ := ring.New(200000, 0.01)
+	r.EnableCounters()
+	n, err := r.WriteTo(&failingWriter{100000})
+	if err == nil || n != 100000 {
+		t.Fatalf("%d bytes written, error %v", n, err)
+	}
+	if m := r.Metrics(); m.BytesMarshaled != 100000 {
+		t.Fatalf("%d bytes counted", m.BytesMarshaled)
+	}
+}
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	writing chan struct{}
+	release chan struct{}
+	once    sync.Once
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.release
+	return w.buf.Write(p)
+}
+
+// TestWriteToStalled ensures a stalled writer does not block writers of the
+// ring, and is sent the ring as it was when WriteTo was called.
+func TestWriteToStalled(t *testing.T) {
+	r, _ := ring.New(200000, 0.01)
+	r.Add([]byte("before"))
+	want, _ := r.MarshalBinary()
+	w := &blockingWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	written := make(chan int64)
+	go func() {
+		n, _ := r.WriteTo(w)
+		written <- n
+	}()
+	<-w.writing
+
+	added := make(chan struct{})
+	go func() {
+		r.Add([]byte("after"))
+		r.Reset()
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Minute):
+		t.Fatal("stalled WriteTo blocked Add and Reset")
+	}
+	close(w.release)
+	if n := <-written; n != int64(len(want)) || !bytes.Equal(w.buf.Bytes(), want) {
+		t.Fatalf("%d bytes written, expected the %d bytes before Add", n, len(want))
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// xorVersion is the marshaled version of a xor filter.
+	xorVersion = 19
+	// xorAttempts is the number of seeds tried before construction fails.
+	xorAttempts = 100
+)
+
+var errXorBuild = errors.New("error: xor filter construction failed")
+
+// Xor is a static xor filter (Graf and Lemire) with 8-bit fingerprints, built
+// once from a fixed set of keys. It needs about 1.23 bytes per key for a false
+// positive rate of 0.39%, far less than a bloom filter, but no data can be
+// added after construction. It is safe for concurrent use.
+type Xor struct {
+	xorTable
+	fingerprints []uint8 // 3 blocks of fingerprints
+}
+
+// xorTable places the keys of a static filter in three blocks of slots, such
+// that the xor of the slots of a key can be assigned any value. It is shared by
+// Xor and BloomierMap.
+type xorTable struct {
+	seed        uint64 // seed mixed into every key hash
+	blockLength uint64 // number of slots per hash function
+}
+
+// newXorTable returns a table with room for keys.
+func newXorTable(keys int) xorTable {
+	return xorTable{blockLength: (32 + uint64(keys)*123/100) / 3}
+}
+
+// xorHash returns the 64-bit hash of data, before seeding.
+func xorHash(data []byte) uint64 {
+	h, _ := murmur128(data)
+	return h
+}
+
+// locations returns the seeded hash and the three slots of the hash of a key.
+func (t *xorTable) locations(hash uint64) (uint64, uint64, uint64, uint64) {
+	h := fmix(hash + t.seed)
+	// one slot per block, scaling 32 bits of the hash rather than dividing
+	h0 := uint64(uint32(h)) * t.blockLength >> 32
+	h1 := uint64(uint32(bits.RotateLeft64(h, 21))) * t.blockLength >> 32
+	h2 := uint64(uint32(bits.RotateLeft64(h, 42))) * t.blockLength >> 32
+	return h, h0, t.blockLength + h1, 2*t.blockLength + h2
+}
+
+// peel finds a seed for which every distinct hash can be assigned a slot no
+// hash after it maps to. It returns the distinct hashes in that order with
+// their slots, so assigning slots in reverse leaves earlier slots free, or an
+// error. Peeling fails with small probability for a given seed, in which case
+// it is retried with the next seed, up to 100 attempts. The first failure also
+// removes duplicate hashes, which can never be peeled.
+func (t *xorTable) peel(hashes []uint64) ([]uint64, []uint64, error) {
+	slots := 3 * t.blockLength
+	// per slot, the xor of the hashes mapping to it and their number
+	masks := make([]uint64, slots)
+	counts := make([]uint32, slots)
+	queue := make([]uint64, 0, slots)
+	// peeled hashes and the slot each was assigned, in order
+	stack := make([]uint64, 0, len(hashes))
+	assigned := make([]uint64, 0, len(hashes))
+	seed := uint64(0x9e3779b97f4a7c15)
+	unique := false
+	for attempt := 0; attempt < xorAttempts; attempt++ {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		t.seed = fmix(seed)
+		for i := range masks {
+			masks[i], counts[i] = 0, 0
+		}
+		for _, h := range hashes {
+			_, h0, h1, h2 := t.locations(h)
+			masks[h0] ^= h
+			counts[h0]++
+			masks[h1] ^= h
+			counts[h1]++
+			masks[h2] ^= h
+			counts[h2]++
+		}
+		queue, stack, assigned = queue[:0], stack[:0], assigned[:0]
+		for i, c := range counts {
+			if c == 1 {
+				queue = append(queue, uint64(i))
+			}
+		}
+		for len(queue) > 0 {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			if counts[i] != 1 {
+				continue
+			}
+			h := masks[i]
+			stack, assigned = append(stack, h), append(assigned, i)
+			_, h0, h1, h2 := t.locations(h)
+			for _, j := range [3]uint64{h0, h1, h2} {
+				masks[j] ^= h
+				counts[j]--
+				if counts[j] == 1 {
+					queue = append(queue, j)
+				}
+			}
+		}
+		if len(stack) == len(hashes) {
+			return stack, assigned, nil
+		}
+		if !unique {
+			hashes, unique = dedupe(hashes), true
+		}
+	}
+	return nil, nil, errXorBuild
+}
+
+// BuildXor builds a xor filter holding keys, or returns an error. Duplicate
+// keys are allowed. Construction assigns each key a slot no other key maps to
+// by repeatedly peeling such keys off; this fails with small probability for a
+// given seed, in which case the filter is rebuilt with the next seed, up to 100
+// attempts. The first failure also removes duplicate keys, which can never be
+// peeled.
+func BuildXor(keys [][]byte) (*Xor, error) {
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i] = xorHash(key)
+	}
+	x := &Xor{xorTable: newXorTable(len(keys))}
+	stack, slots, err := x.peel(hashes)
+	if err != nil {
+		return nil, err
+	}
+	// assign in reverse, so each slot is set after its other two
+	x.fingerprints = make([]uint8, 3*x.blockLength)
+	for n := len(stack) - 1; n >= 0; n-- {
+		h, h0, h1, h2 := x.locations(stack[n])
+		x.fingerprints[slots[n]] = 0
+		x.fingerprints[slots[n]] = uint8(h^h>>32) ^ x.fingerprints[h0] ^ x.fingerprints[h1] ^ x.fingerprints[h2]
+	}
+	return x, nil
+}
+
+// dedupe sorts hashes and removes duplicates, which share all three slots.
+func dedupe(hashes []uint64) []uint64 {
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	unique := hashes[:0]
+	for i, h := range hashes {
+		if i == 0 || h != hashes[i-1] {
+			unique = append(unique, h)
+		}
+	}
+	return unique
+}
+
+// Test returns a bool if the data is in the filter. True indicates that the
+// data may be in the filter, while false indicates that the data is not in the
+// filter.
+func (x *Xor) Test(data []byte) bool {
+	h, h0, h1, h2 := x.locations(xorHash(data))
+	return uint8(h^h>>32) == x.fingerprints[h0]^x.fingerprints[h1]^x.fingerprints[h2]
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (x *Xor) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 17+len(x.fingerprints))
+	out[0] = xorVersion
+	binary.BigEndian.PutUint64(out[1:9], x.seed)
+	binary.BigEndian.PutUint64(out[9:17], x.blockLength)
+	copy(out[17:], x.fingerprints)
+	return out, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. It must
+// not be called concurrently with Test.
+func (x *Xor) UnmarshalBinary(data []byte) error {
+	if len(data) < 17 {
+		return fmt.Errorf("%w: incorrect length: %d", ErrTruncated, len(data))
+	}
+	if data[0] != xorVersion {
+		return versionError(data[0])
+	}
+	blockLength := binary.BigEndian.Uint64(data[9:17])
+	if blockLength == 0 || blockLength > math.MaxUint32 {
+		return &CorruptError{"block length", blockLength}
+	}
+	if err := checkData(uint64(len(data)), 17+3*blockLength); err != nil {
+		return err
+	}
+	x.seed = binary.BigEndian.Uint64(data[1:9])
+	x.blockLength = blockLength
+	x.fingerprints = append([]uint8(nil), data[17:]...)
+	return nil
+}
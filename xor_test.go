@@ -0,0 +1,119 @@
+// Copyright (c) 2019 Tanner Ryan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ring_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tannerryan/ring"
+)
+
+// xorKeys returns n distinct 4-byte keys, starting from start.
+func xorKeys(start, n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = make([]byte, 4)
+		intToByte(keys[i], start+i)
+	}
+	return keys
+}
+
+// BenchmarkBuildXor tests building a Xor filter from 10M keys.
+func BenchmarkBuildXor(b *testing.B) {
+	keys := xorKeys(0, 10000000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ring.BuildXor(keys); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkXorTest tests querying a Xor filter of 1M keys.
+func BenchmarkXorTest(b *testing.B) {
+	x, _ := ring.BuildXor(xorKeys(0, 1000000))
+	buff := make([]byte, 4)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intToByte(buff, i)
+		x.Test(buff)
+	}
+}
+
+// TestXor ensures there are no false negatives over the construction set, and
+// measures the false positive rate over disjoint keys against the expected
+// 1/256.
+func TestXor(t *testing.T) {
+	const n, probes = 1000000, 1000000
+	x, err := ring.BuildXor(xorKeys(0, n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buff := make([]byte, 4)
+	for i := 0; i < n; i++ {
+		intToByte(buff, i)
+		if !x.Test(buff) {
+			t.Fatalf("data %d missing", i)
+		}
+	}
+	fp := 0
+	for i := n; i < n+probes; i++ {
+		intToByte(buff, i)
+		if x.Test(buff) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / probes; rate > 0.0039*1.2 || rate < 0.0039*0.8 {
+		t.Fatalf("false positive rate %f, expected 0.0039", rate)
+	}
+}
+
+// TestXorSmall builds filters from empty, tiny and duplicated key sets.
+func TestXorSmall(t *testing.T) {
+	for _, keys := range [][][]byte{
+		nil,
+		{[]byte("ring")},
+		{[]byte("ring"), []byte("ring"), []byte("xor"), nil},
+		append(xorKeys(0, 100), xorKeys(0, 100)...),
+	} {
+		x, err := ring.BuildXor(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			if !x.Test(key) {
+				t.Fatalf("data %q missing", key)
+			}
+		}
+	}
+}
+
+func TestXorMarshal(t *testing.T) {
+	keys := xorKeys(0, 10000)
+	x, _ := ring.BuildXor(keys)
+	data, _ := x.MarshalBinary()
+	var x2 ring.Xor
+	if err := x2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if !x2.Test(key) {
+			t.Fatalf("data %v missing after unmarshal", key)
+		}
+	}
+	if data2, _ := x2.MarshalBinary(); !bytes.Equal(data, data2) {
+		t.Fatal("marshaled data changed")
+	}
+	for _, n := range []int{0, 16, 17, len(data) - 1} {
+		if x2.UnmarshalBinary(data[:n]) == nil {
+			t.Fatalf("truncation to %d bytes not captured", n)
+		}
+	}
+	data[0] = 18
+	if x2.UnmarshalBinary(data) == nil {
+		t.Fatal("version not captured")
+	}
+}